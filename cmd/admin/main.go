@@ -0,0 +1,267 @@
+// Package main is the GophKeeper administration tool. It backs up and
+// restores the server database as logical dumps with integrity checksums,
+// lists the devices of users and manages the client certificates bound to
+// them:
+//
+//	admin backup  -d <dsn> [-user login] [-o file]
+//	admin restore -d <dsn> [-i file] [-replace]
+//	admin verify  [-i file]
+//	admin devices     -d <dsn> -user login
+//	admin certs       -d <dsn> -user login
+//	admin revoke-cert -d <dsn> -user login [-serial hex]
+//
+// Files default to standard output and input, so dumps can be piped
+// through compression or encryption tools.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/db"
+	"github.com/atinyakov/GophKeeper/internal/repository"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "backup":
+		err = backup(os.Args[2:])
+	case "restore":
+		err = restore(os.Args[2:])
+	case "verify":
+		err = verify(os.Args[2:])
+	case "devices":
+		err = devices(os.Args[2:])
+	case "certs":
+		err = certs(os.Args[2:])
+	case "revoke-cert":
+		err = revokeCert(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: admin backup|restore|verify|devices|certs|revoke-cert [flags]; see admin <command> -h")
+	os.Exit(2)
+}
+
+// dsnFlag registers the -d flag, defaulting to $DATABASE_DSN.
+func dsnFlag(fs *flag.FlagSet) *string {
+	return fs.String("d", os.Getenv("DATABASE_DSN"), "database DSN (default $DATABASE_DSN)")
+}
+
+// backup implements the backup command. A backup written to a file is
+// written under a temporary name first, so that a failed backup does not
+// leave a partial file in place.
+func backup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	dsn := dsnFlag(fs)
+	user := fs.String("user", "", "back up only this user")
+	out := fs.String("o", "-", "output file, - for standard output")
+	_ = fs.Parse(args)
+
+	conn, err := db.InitPostgres(*dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if *out == "-" {
+		_, err := db.Backup(context.Background(), conn, os.Stdout, *user)
+		return err
+	}
+	tmp := *out + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	rows, err := db.Backup(context.Background(), conn, f, *user)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, *out)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "backed up %d rows to %s\n", rows, *out)
+	return nil
+}
+
+// restore implements the restore command.
+func restore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	dsn := dsnFlag(fs)
+	in := fs.String("i", "-", "backup file, - for standard input")
+	replace := fs.Bool("replace", false, "delete existing data in the scope of the backup first")
+	_ = fs.Parse(args)
+
+	r, closeInput, err := openInput(*in)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	conn, err := db.InitPostgres(*dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	header, rows, err := db.Restore(context.Background(), conn, r, *replace)
+	if errors.Is(err, db.ErrRestoreConflict) {
+		return fmt.Errorf("%w; use -replace to overwrite it", err)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "restored %d rows of %s\n", rows, scope(header))
+	return nil
+}
+
+// verify implements the verify command.
+func verify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	in := fs.String("i", "-", "backup file, - for standard input")
+	_ = fs.Parse(args)
+
+	r, closeInput, err := openInput(*in)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	header, rows, err := db.VerifyBackup(r)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("ok: %d rows of %s\n", rows, scope(header))
+	return nil
+}
+
+// devices implements the devices command, listing when the devices of a
+// user last synced and were last seen.
+func devices(args []string) error {
+	fs := flag.NewFlagSet("devices", flag.ExitOnError)
+	dsn := dsnFlag(fs)
+	user := fs.String("user", "", "user login")
+	_ = fs.Parse(args)
+	if *user == "" {
+		return errors.New("-user is required")
+	}
+
+	conn, err := db.InitPostgres(*dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	list, err := repository.NewPostgresSyncRepostitory(conn).GetDevices(context.Background(), *user)
+	if err != nil {
+		return err
+	}
+	for _, d := range list {
+		fmt.Printf("%-34s  last sync %-20s  last seen %s\n", d.ID, formatUnix(d.LastSync), formatUnix(d.LastSeen))
+	}
+	return nil
+}
+
+// formatUnix renders a Unix time in UTC, or "never" for zero.
+func formatUnix(ts int64) string {
+	if ts == 0 {
+		return "never"
+	}
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
+
+// certs implements the certs command, listing the certificates of a user.
+func certs(args []string) error {
+	fs := flag.NewFlagSet("certs", flag.ExitOnError)
+	dsn := dsnFlag(fs)
+	user := fs.String("user", "", "user login")
+	_ = fs.Parse(args)
+	if *user == "" {
+		return errors.New("-user is required")
+	}
+
+	conn, err := db.InitPostgres(*dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	list, err := repository.NewPostgresAuthRepository(conn).GetCertificates(context.Background(), *user)
+	if err != nil {
+		return err
+	}
+	for _, c := range list {
+		status := "active"
+		if c.RevokedAt != 0 {
+			status = "revoked " + formatUnix(c.RevokedAt)
+		}
+		fmt.Printf("%s  issued %s  %s  sha256:%s\n", c.Serial, formatUnix(c.IssuedAt), status, c.Fingerprint)
+	}
+	return nil
+}
+
+// revokeCert implements the revoke-cert command. Without -serial it revokes
+// all certificates of the user, e.g. when a device is lost.
+func revokeCert(args []string) error {
+	fs := flag.NewFlagSet("revoke-cert", flag.ExitOnError)
+	dsn := dsnFlag(fs)
+	user := fs.String("user", "", "user login")
+	serial := fs.String("serial", "", "serial number of the certificate; all certificates if empty")
+	_ = fs.Parse(args)
+	if *user == "" {
+		return errors.New("-user is required")
+	}
+
+	conn, err := db.InitPostgres(*dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	n, err := repository.NewPostgresAuthRepository(conn).RevokeCertificates(context.Background(), *user, *serial, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "revoked %d certificates of %s\n", n, *user)
+	return nil
+}
+
+// openInput opens a file, or standard input for "-".
+func openInput(path string) (io.Reader, func(), error) {
+	if path == "-" {
+		return os.Stdin, func() {}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { f.Close() }, nil
+}
+
+// scope describes what a backup holds.
+func scope(h *db.BackupHeader) string {
+	if h.User != "" {
+		return "user " + h.User
+	}
+	return "all users"
+}
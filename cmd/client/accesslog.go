@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+// accessLog implements the access-log command: it prints which devices
+// the server sent a secret to and when, newest first, to spot devices that
+// should not have it.
+func (s *shell) accessLog(args []string) error {
+	if len(args) != 1 {
+		return usageError("access-log <id>")
+	}
+	if s.offline {
+		return errOffline
+	}
+	id, err := s.ls.Resolve(args[0], s.aead)
+	if err != nil {
+		return err
+	}
+
+	accesses, err := storage.FetchAccessLog(s.client, s.baseURL, id)
+	if err != nil {
+		return i18n.Errorf("failed to fetch access log: %w", err)
+	}
+	if len(accesses) == 0 {
+		s.info(i18n.T("No accesses recorded"))
+		return nil
+	}
+	storage.PrintAccessLog(os.Stdout, accesses)
+	return nil
+}
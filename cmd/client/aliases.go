@@ -0,0 +1,70 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/output"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+const aliasUsage = `
+  alias                   list aliases
+  alias <id> <name>       name a secret, e.g. alias 3f2a aws-prod-db
+  alias --rm <name>       remove an alias`
+
+// alias implements the alias command, which manages the user-chosen names
+// commands accept instead of secret IDs.
+func (s *shell) alias(args []string) error {
+	fs := newFlagSet("alias")
+	rm := fs.Bool("rm", false, "remove the alias")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return usageError(aliasUsage)
+	}
+
+	switch {
+	case len(args) == 0 && !*rm:
+		aliases, err := s.ls.Aliases(s.aead)
+		if err != nil {
+			return err
+		}
+		if len(aliases) == 0 {
+			s.info(i18n.T("No aliases"))
+			return nil
+		}
+		var tbl output.Table
+		tbl.Header("ALIAS", "ID", "NAME")
+		for _, name := range slices.Sorted(maps.Keys(aliases)) {
+			id := aliases[name]
+			tbl.Row(output.Cell{Text: name}, output.Cell{Text: id, Style: output.Dim}, output.Cell{Text: storage.DecryptName(s.aead, s.ls.Get(id))})
+		}
+		return tbl.Write(os.Stdout)
+
+	case len(args) == 1 && *rm:
+		if err := s.ls.SetAlias(args[0], "", s.aead); err != nil {
+			return err
+		}
+
+	case len(args) == 2 && !*rm:
+		id, err := s.ls.Resolve(args[0], s.aead)
+		if err != nil {
+			return err
+		}
+		if err := s.ls.SetAlias(args[1], id, s.aead); err != nil {
+			return err
+		}
+		s.record(storage.ActivityEdit, id, "alias "+args[1])
+
+	default:
+		return usageError(aliasUsage)
+	}
+
+	if err := s.ls.Save(); err != nil {
+		return i18n.Errorf("failed to save local store: %w", err)
+	}
+	s.info(i18n.T("Aliases updated"))
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"os"
+)
+
+// newFlagSet creates a flag set for a shell command. Errors are reported
+// to the caller instead of exiting the shell.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// parseArgs parses the flags defined in fs from args, allowing flags and
+// positional arguments to be interleaved, and returns the positional ones.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
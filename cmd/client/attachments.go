@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+	"github.com/atinyakov/GophKeeper/internal/limits"
+)
+
+const attachmentsUsage = `
+  attachments <id>                          list attachments
+  attachments add <id> <file> [--name n]    attach a file
+  attachments get <id> <name> [--out file]  extract an attachment`
+
+// attachments implements the attachments shell command.
+func (s *shell) attachments(args []string) error {
+	fs := newFlagSet("attachments")
+	out := fs.String("out", "", "output file (defaults to the attachment name)")
+	name := fs.String("name", "", "attachment name (defaults to the file name)")
+	args, err := parseArgs(fs, args)
+	if err != nil || len(args) == 0 {
+		return usageError(attachmentsUsage)
+	}
+
+	switch {
+	case len(args) == 1:
+		id, err := s.ls.Resolve(args[0], s.aead)
+		if err != nil {
+			return err
+		}
+		atts, err := s.ls.Attachments(id, s.aead)
+		if err != nil {
+			return i18n.Errorf("failed to read attachments: %w", err)
+		}
+		if len(atts) == 0 {
+			s.info(i18n.T("No attachments"))
+			return nil
+		}
+		for _, a := range atts {
+			fmt.Print(i18n.Sprintf("%-30s %10d bytes\n", a.Name, a.Size))
+		}
+
+	case args[0] == "add" && len(args) == 3:
+		// Refuse oversized files before reading them into memory
+		if fi, err := os.Stat(args[2]); err == nil && fi.Size() > limits.Attachment {
+			return &limits.SizeError{Type: "attachment", Size: int(fi.Size()), Limit: limits.Attachment}
+		}
+		data, err := os.ReadFile(args[2])
+		if err != nil {
+			return i18n.Errorf("failed to read file: %w", err)
+		}
+		attName := *name
+		if attName == "" {
+			attName = filepath.Base(args[2])
+		}
+		id, err := s.ls.Resolve(args[1], s.aead)
+		if err != nil {
+			return err
+		}
+		if err := s.ls.AddAttachment(id, attName, data, s.aead); err != nil {
+			return i18n.Errorf("failed to add attachment: %w", err)
+		}
+		if err := s.ls.Save(); err != nil {
+			return i18n.Errorf("failed to save local store: %w", err)
+		}
+		s.record(storage.ActivityEdit, id, "attachment added")
+		s.info(i18n.Sprintf("Attached %s (%d bytes)", attName, len(data)))
+
+	case args[0] == "get" && len(args) == 3:
+		id, err := s.ls.Resolve(args[1], s.aead)
+		if err != nil {
+			return err
+		}
+		if err := s.reveal(s.ls.Get(id)); err != nil {
+			return err
+		}
+		path := *out
+		if path == "" {
+			path = filepath.Base(args[2])
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return i18n.Errorf("failed to create file: %w", err)
+		}
+		err = s.ls.ExtractAttachment(id, args[2], f, s.aead)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(path)
+			return i18n.Errorf("failed to extract attachment: %w", err)
+		}
+		s.record(storage.ActivityView, id, "attachment")
+		s.info(i18n.Sprintf("Saved to %s", path))
+
+	default:
+		return usageError(attachmentsUsage)
+	}
+	return nil
+}
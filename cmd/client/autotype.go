@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/client/autotype"
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+// autotype implements the autotype command. After a countdown, during which
+// the user focuses the login form, it types the login, TAB, the password
+// and ENTER into the focused window.
+func (s *shell) autotype(args []string) error {
+	fs := newFlagSet("autotype")
+	delay := fs.Duration("delay", 3*time.Second, "time to focus the login form before typing")
+	noEnter := fs.Bool("no-enter", false, "do not press ENTER after the password")
+	args, err := parseArgs(fs, args)
+	if err != nil || len(args) != 1 || *delay < 0 {
+		return usageError("autotype <id> [--delay 3s] [--no-enter]")
+	}
+
+	id, err := s.ls.Resolve(args[0], s.aead)
+	if err != nil {
+		return err
+	}
+	backend, err := autotype.Detect()
+	if err != nil {
+		return err
+	}
+	sec := s.ls.Get(id)
+	if err := s.reveal(sec); err != nil {
+		return err
+	}
+	plain, err := storage.Decrypt(s.aead, sec.Data)
+	if err != nil {
+		return i18n.Errorf("failed to decrypt secret: %w", err)
+	}
+	login, password, err := storage.Credentials(plain)
+	if err != nil {
+		return err
+	}
+
+	for left := *delay; left > 0; left -= time.Second {
+		if !s.quiet {
+			fmt.Fprintf(os.Stderr, "\r%s", i18n.Sprintf("Focus the login form, typing in %ds...", int((left+time.Second-1)/time.Second)))
+		}
+		time.Sleep(min(left, time.Second))
+	}
+	if !s.quiet && *delay > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+
+	s.record(storage.ActivityView, id, "autotype")
+	if err := autotype.Run(backend, autotype.Login(login, password, !*noEnter)); err != nil {
+		return i18n.Errorf("failed to type credentials: %w", err)
+	}
+	return nil
+}
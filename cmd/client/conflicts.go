@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+// conflicts implements the conflicts command. It shows both versions of
+// each secret edited here and on another device since the last sync and,
+// unless --list is given, asks which to keep: the local one, the server's
+// or both. "conflicts resolve <id> local|remote|both" resolves one
+// conflict without asking, e.g. from scripts. The choices are written
+// back to the servers by a sync, unless offline.
+func (s *shell) conflicts(args []string) error {
+	const usage = "conflicts [--list] | conflicts resolve <id> local|remote|both"
+	if len(args) > 0 && args[0] == "resolve" {
+		if len(args) != 3 {
+			return usageError(usage)
+		}
+		id, err := s.resolveConflictID(args[1])
+		if err != nil {
+			return err
+		}
+		if err := s.resolveConflict(id, args[2]); err != nil {
+			return err
+		}
+		return s.writeBackConflicts(1)
+	}
+	fs := newFlagSet("conflicts")
+	list := fs.Bool("list", false, "only list the conflicts")
+	if rest, err := parseArgs(fs, args); err != nil || len(rest) != 0 {
+		return usageError(usage)
+	}
+
+	pending := s.ls.PendingConflicts()
+	if len(pending) == 0 {
+		s.info(i18n.T("No conflicts"))
+		return nil
+	}
+
+	scanner := storage.StdinScanner()
+	resolved := 0
+	for _, c := range pending {
+		c.Print(os.Stdout, s.aead)
+		if *list {
+			fmt.Println()
+			continue
+		}
+		fmt.Print(i18n.T("Keep which? l for local, r for remote, b for both, Enter to skip, q to stop: "))
+		if !scanner.Scan() {
+			break
+		}
+		var choice string
+		switch strings.ToLower(strings.TrimSpace(scanner.Text())) {
+		case "q":
+			return s.writeBackConflicts(resolved)
+		case "l", storage.KeepLocal:
+			choice = storage.KeepLocal
+		case "r", storage.KeepRemote:
+			choice = storage.KeepRemote
+		case "b", storage.KeepBoth:
+			choice = storage.KeepBoth
+		default:
+			continue
+		}
+		if err := s.resolveConflict(c.ID, choice); err != nil {
+			return err
+		}
+		resolved++
+	}
+	return s.writeBackConflicts(resolved)
+}
+
+// resolveConflictID returns the ID of the pending conflict whose secret ID
+// starts with prefix, or the secret ref resolves to.
+func (s *shell) resolveConflictID(ref string) (string, error) {
+	var match string
+	for _, c := range s.ls.PendingConflicts() {
+		if !strings.HasPrefix(c.ID, ref) {
+			continue
+		}
+		if match != "" {
+			return "", storage.ErrAmbiguousID
+		}
+		match = c.ID
+	}
+	if match != "" {
+		return match, nil
+	}
+	return s.ls.Resolve(ref, s.aead)
+}
+
+// resolveConflict resolves the conflict of the secret id by choice and
+// records it in the activity log.
+func (s *shell) resolveConflict(id, choice string) error {
+	sec, err := s.ls.ResolveConflict(id, choice, s.aead)
+	if err != nil {
+		return i18n.Errorf("failed to resolve conflict: %w", err)
+	}
+	s.record(storage.ActivityEdit, id, "conflict resolved: "+choice)
+	if choice == storage.KeepBoth {
+		s.record(storage.ActivityAdd, sec.ID, "local copy of "+id)
+		s.info(i18n.Sprintf("Kept the local version as %s", sec.ID))
+	}
+	return nil
+}
+
+// writeBackConflicts saves the vault after resolved conflicts were
+// resolved and syncs the choices to the servers, unless offline.
+func (s *shell) writeBackConflicts(resolved int) error {
+	if resolved == 0 {
+		return nil
+	}
+	if err := s.ls.Save(); err != nil {
+		return i18n.Errorf("failed to save local store: %w", err)
+	}
+	s.info(i18n.Sprintf("Resolved %d conflicts", resolved))
+	if s.offline {
+		return nil
+	}
+	if err := s.retry.Do(func() error {
+		return storage.SyncWithServers(s.client, s.syncURLs(), s.ls)
+	}); err != nil {
+		return i18n.Errorf("failed to sync resolved conflicts: %w", err)
+	}
+	s.info(i18n.T("Synced"))
+	return nil
+}
+
+// warnConflicts points out the conflicts left to resolve after a sync.
+func (s *shell) warnConflicts() {
+	if n := len(s.ls.PendingConflicts()); n > 0 {
+		diag.Warn(i18n.Sprintf("%d conflicts to resolve, see 'conflicts'", n))
+	}
+}
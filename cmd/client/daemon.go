@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/sdnotify"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+// daemon syncs the vault in the foreground until SIGINT or SIGTERM, so the
+// client can run as a service. Servers push changes made by other devices
+// over watch streams, which are applied right away, see storage.AutoSync.
+// Under a systemd Type=notify unit, the service is reported ready after the
+// first sync and its status shows the outcome of the last one. Started by
+// the Windows service control manager, it runs until the service is
+// stopped instead, see serveService.
+func (s *shell) daemon() error {
+	if s.offline {
+		return errOffline
+	}
+	if runningAsService() {
+		return s.serveService()
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ready := false
+	s.syncUntil(ctx, func(err error, next time.Duration) {
+		status := sdnotify.Status("Synced at " + time.Now().Format(time.DateTime))
+		if err != nil {
+			status = sdnotify.Status(fmt.Sprintf("Sync failed, next attempt in %s: %v", next.Round(time.Second), err))
+		}
+		states := []string{status}
+		if !ready {
+			states = append(states, sdnotify.Ready)
+			ready = true
+		}
+		if _, err := sdnotify.Notify(states...); err != nil {
+			printError(err)
+		}
+	})
+
+	s.info(i18n.T("Bye"))
+	_, _ = sdnotify.Notify(sdnotify.Stopping)
+	return nil
+}
+
+// syncUntil syncs the vault until ctx is done, logging sync errors. report
+// is called after every sync with its error and the time until the next.
+func (s *shell) syncUntil(ctx context.Context, report func(err error, next time.Duration)) {
+	// Take the changes of other devices as the servers push them
+	pushes := make(chan storage.Push, 1)
+	storage.WatchServers(ctx, s.client, s.syncURLs(), s.ls, pushes)
+
+	storage.AutoSync(ctx, s.client, s.syncURLs(), s.ls, s.retry, pushes, func(err error, next time.Duration) {
+		if err != nil {
+			diag.Error(i18n.Sprintf("sync error: %v (next attempt in %s)", err, next.Round(time.Second)))
+		}
+		report(err, next)
+	})
+}
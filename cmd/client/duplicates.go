@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+// duplicates implements the duplicates command. It lists the groups of
+// duplicate secrets and, unless --list is given, asks for each group which
+// secret to keep; the others are merged into it and deleted.
+func (s *shell) duplicates(args []string) error {
+	fs := newFlagSet("duplicates")
+	list := fs.Bool("list", false, "only list the duplicates")
+	if rest, err := parseArgs(fs, args); err != nil || len(rest) != 0 {
+		return usageError("duplicates [--list]")
+	}
+
+	groups := s.ls.FindDuplicates(s.aead)
+	if len(groups) == 0 {
+		s.info(i18n.T("No duplicates found"))
+		return nil
+	}
+
+	scanner := storage.StdinScanner()
+	merged := 0
+	for _, g := range groups {
+		g.Print(os.Stdout, s.aead)
+		if *list {
+			continue
+		}
+		fmt.Print(i18n.T("Keep which? Number to keep it and merge the others into it, Enter to skip, q to stop: "))
+		if !scanner.Scan() {
+			break
+		}
+		answer := strings.TrimSpace(scanner.Text())
+		if answer == "q" {
+			break
+		}
+		n, err := strconv.Atoi(answer)
+		if err != nil || n < 1 || n > len(g.Secrets) {
+			continue
+		}
+		keep := g.Secrets[n-1].ID
+		var remove []string
+		for _, sec := range g.Secrets {
+			if sec.ID != keep {
+				remove = append(remove, sec.ID)
+			}
+		}
+		if err := s.ls.MergeDuplicates(keep, remove, s.aead); err != nil {
+			return i18n.Errorf("failed to merge duplicates: %w", err)
+		}
+		s.record(storage.ActivityEdit, keep, "duplicates merged")
+		for _, id := range remove {
+			s.record(storage.ActivityDelete, id, "duplicate of "+keep)
+		}
+		merged += len(remove)
+	}
+
+	if merged > 0 {
+		if err := s.ls.Save(); err != nil {
+			return i18n.Errorf("failed to save local store: %w", err)
+		}
+		s.info(i18n.Sprintf("Merged %d duplicates", merged))
+	}
+	return nil
+}
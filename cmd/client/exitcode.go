@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/fs"
+	"net"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+// Exit codes of the client, so that scripts can branch on the result of a
+// command.
+const (
+	exitOK       = 0
+	exitError    = 1 // any other error, including usage errors
+	exitNotFound = 2 // secret, attachment, field or file not found
+	exitAuth     = 3 // missing or rejected credentials, or server pin mismatch
+	exitConflict = 4 // the server rejected a change as conflicting
+	exitNetwork  = 5 // the server could not be reached, or offline mode
+)
+
+// errCredentials is returned when the client certificate or key cannot be loaded.
+var errCredentials = i18n.NewError("cannot load client credentials")
+
+// exitCode maps the error of a command to the client exit code.
+func exitCode(err error) int {
+	var (
+		alertErr    tls.AlertError
+		unknownCA   x509.UnknownAuthorityError
+		invalidCert x509.CertificateInvalidError
+		hostErr     x509.HostnameError
+		netErr      net.Error
+	)
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errCredentials), errors.Is(err, storage.ErrPinMismatch),
+		errors.Is(err, storage.ErrIncorrectPassphrase), errors.Is(err, storage.ErrUnauthorized):
+		return exitAuth
+	case errors.Is(err, errOffline):
+		return exitNetwork
+	case errors.Is(err, storage.ErrConflict):
+		return exitConflict
+	case errors.Is(err, storage.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		return exitNotFound
+	// TLS failures are network errors too, so check them first.
+	case errors.As(err, &alertErr), errors.As(err, &unknownCA),
+		errors.As(err, &invalidCert), errors.As(err, &hostErr):
+		return exitAuth
+	case errors.As(err, &netErr):
+		return exitNetwork
+	}
+	return exitError
+}
+
+// errorClass returns the coarse class of a command error reported by
+// telemetry, derived from its exit code; "" for success. Error messages
+// are never reported since they may quote user data.
+func errorClass(err error) string {
+	var usageErr usageError
+	if errors.As(err, &usageErr) {
+		return "usage"
+	}
+	switch exitCode(err) {
+	case exitOK:
+		return ""
+	case exitNotFound:
+		return "not_found"
+	case exitAuth:
+		return "auth"
+	case exitConflict:
+		return "conflict"
+	case exitNetwork:
+		return "network"
+	}
+	return "error"
+}
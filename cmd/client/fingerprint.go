@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/output"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+	"github.com/atinyakov/GophKeeper/internal/fingerprint"
+)
+
+// fingerprint implements the fingerprint command. It prints a hash of the
+// ID and version of every local secret, see package fingerprint, which
+// users compare across devices to verify that all replicas have converged
+// after a sync. Unless --local is given, it is compared with the
+// fingerprint each server reports too, and a mismatch fails the command.
+// --full prints the whole hash instead of its first 16 digits.
+func (s *shell) fingerprint(args []string) error {
+	fs := newFlagSet("fingerprint")
+	local := fs.Bool("local", false, "do not compare with the servers")
+	full := fs.Bool("full", false, "print the whole fingerprint")
+	if rest, err := parseArgs(fs, args); err != nil || len(rest) != 0 {
+		return usageError("fingerprint [--local] [--full]")
+	}
+	format := fingerprint.Short
+	if *full {
+		format = func(fp string) string { return fp }
+	}
+
+	fp, n := s.ls.Fingerprint()
+	fmt.Println(i18n.Sprintf("Local fingerprint: %s (%d secrets)", format(fp), n))
+	if *local || s.offline {
+		return nil
+	}
+	if f := s.ls.Filter(); !f.Empty() {
+		// Servers hash the whole vault, the device only the part it syncs
+		s.info(i18n.Sprintf("Not compared with the servers: this device syncs only %s", describeFilter(f)))
+		return nil
+	}
+
+	differ := 0
+	for _, u := range s.syncURLs() {
+		stats, err := storage.FetchStats(s.client, u)
+		if err != nil {
+			return i18n.Errorf("failed to fetch fingerprint from %s: %w", u, err)
+		}
+		switch stats.Fingerprint {
+		case "":
+			fmt.Println(output.Warning(i18n.Sprintf("%s: the server does not report fingerprints", u)))
+		case fp:
+			fmt.Println(output.Success(i18n.Sprintf("%s: %s, matches", u, format(stats.Fingerprint))))
+		default:
+			fmt.Println(output.Error(i18n.Sprintf("%s: %s, differs", u, format(stats.Fingerprint))))
+			differ++
+		}
+	}
+	if differ > 0 {
+		return i18n.Errorf("the local secrets differ from %d servers, sync and compare again", differ)
+	}
+	return nil
+}
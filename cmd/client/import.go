@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+// importSecrets implements the import command, which moves plaintext
+// files into the vault. With --format dotenv, each KEY=VALUE of the file,
+// or of stdin if it is "-", becomes a text secret named KEY in the folder
+// --prefix; importing a file again updates the changed values.
+func (s *shell) importSecrets(args []string) error {
+	fs := newFlagSet("import")
+	format := fs.String("format", "dotenv", "format of the file: dotenv")
+	prefix := fs.String("prefix", "", "folder of the imported secrets, e.g. myapp/")
+	args, err := parseArgs(fs, args)
+	if err != nil || len(args) != 1 {
+		return usageError("import [--format dotenv] [--prefix folder/] <file|->")
+	}
+	if *format != "dotenv" {
+		return i18n.Errorf("unknown import format %q, use dotenv", *format)
+	}
+
+	var r io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return i18n.Errorf("failed to import %s: %w", args[0], err)
+		}
+		defer f.Close()
+		r = f
+	}
+	vars, err := storage.ParseDotenv(r)
+	if err != nil {
+		return i18n.Errorf("failed to import %s: %w", args[0], err)
+	}
+	res, err := s.ls.ImportEnv(vars, *prefix, s.aead)
+	if err != nil {
+		return i18n.Errorf("failed to import %s: %w", args[0], err)
+	}
+	if err := s.ls.Save(); err != nil {
+		return i18n.Errorf("failed to save local store: %w", err)
+	}
+	for _, id := range res.Added {
+		s.record(storage.ActivityAdd, id, "import")
+	}
+	for _, id := range res.Updated {
+		s.record(storage.ActivityEdit, id, "import")
+	}
+	s.info(i18n.Sprintf("Imported %d new and %d changed secrets, %d unchanged", len(res.Added), len(res.Updated), res.Unchanged))
+	return nil
+}
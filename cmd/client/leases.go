@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+// token implements the token command: it issues an API token, which
+// expires after --ttl if given, e.g. for a CI job.
+func (s *shell) token(args []string) error {
+	fs := newFlagSet("token")
+	ttl := fs.Duration("ttl", 0, "expire the token after this long, e.g. 1h")
+	if rest, err := parseArgs(fs, args); err != nil || len(rest) != 0 || *ttl < 0 {
+		return usageError("token [--ttl d]")
+	}
+	if s.offline {
+		return errOffline
+	}
+
+	if *ttl == 0 {
+		token, err := storage.RequestToken(s.client, s.baseURL)
+		if err != nil {
+			return i18n.Errorf("failed to issue token: %w", err)
+		}
+		if s.quiet {
+			fmt.Println(token)
+		} else {
+			fmt.Println(i18n.Sprintf("API token: %s", token))
+		}
+		return nil
+	}
+
+	token, lease, err := storage.RequestLease(s.client, s.baseURL, *ttl)
+	if err != nil {
+		return i18n.Errorf("failed to issue token: %w", err)
+	}
+	if s.quiet {
+		fmt.Println(token)
+		return nil
+	}
+	fmt.Println(i18n.Sprintf("API token: %s", token))
+	fmt.Println(i18n.Sprintf("Lease %s expires at %s", lease.ID, time.Unix(lease.ExpiresAt, 0).Format(time.DateTime)))
+	return nil
+}
+
+// leases implements the leases command: "leases" lists the leases of the
+// API tokens, "leases renew <id>" extends one by its TTL or by --ttl and
+// "leases revoke <id>" revokes its token.
+func (s *shell) leases(args []string) error {
+	if s.offline {
+		return errOffline
+	}
+	if len(args) == 0 {
+		leases, err := storage.FetchLeases(s.client, s.baseURL)
+		if err != nil {
+			return i18n.Errorf("failed to fetch leases: %w", err)
+		}
+		if len(leases) == 0 {
+			s.info(i18n.T("No API tokens issued"))
+			return nil
+		}
+		storage.PrintLeases(os.Stdout, leases, time.Now())
+		return nil
+	}
+
+	switch args[0] {
+	case "renew":
+		fs := newFlagSet("leases renew")
+		ttl := fs.Duration("ttl", 0, "expire the token this long from now instead of after its TTL")
+		rest, err := parseArgs(fs, args[1:])
+		if err != nil || len(rest) != 1 || *ttl < 0 {
+			return usageError("leases renew <id> [--ttl d]")
+		}
+		lease, err := storage.RenewLease(s.client, s.baseURL, rest[0], *ttl)
+		if err != nil {
+			return i18n.Errorf("failed to renew lease %s: %w", rest[0], err)
+		}
+		s.info(i18n.Sprintf("Lease %s expires at %s", lease.ID, time.Unix(lease.ExpiresAt, 0).Format(time.DateTime)))
+	case "revoke":
+		if len(args) != 2 {
+			return usageError("leases revoke <id>")
+		}
+		if err := storage.RevokeLease(s.client, s.baseURL, args[1]); err != nil {
+			return i18n.Errorf("failed to revoke lease %s: %w", args[1], err)
+		}
+		s.info(i18n.Sprintf("Lease %s revoked", args[1]))
+	default:
+		return usageError("leases | leases renew <id> [--ttl d] | leases revoke <id>")
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/output"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+	"github.com/atinyakov/GophKeeper/internal/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Formats of -log-format.
+const (
+	logHuman = "human"
+	logJSON  = "json"
+)
+
+// diag receives the diagnostics of the client: informational messages,
+// warnings and, with -debug, the requests sent to the servers. They are
+// written to stderr or the -log-file, never to stdout, which carries only
+// command results. Messages are discarded until setupLogging is called.
+var diag = zap.NewNop()
+
+// logSettings are the flags configuring diag.
+type logSettings struct {
+	level  string // -log-level; empty for the default of -quiet and -debug
+	format string // -log-format
+	file   string // -log-file; empty for stderr
+	debug  bool
+	quiet  bool
+}
+
+// setupLogging configures diag, and the storage package with it, from s.
+// Human-readable entries are translated and colored like the rest of the
+// output, except in a file, where they are plain and carry the time. The
+// returned function closes the log file.
+func setupLogging(s logSettings) (closeLog func(), err error) {
+	level := s.level
+	switch {
+	case level != "":
+	case s.debug:
+		level = "debug"
+	case s.quiet:
+		level = "error"
+	}
+	if s.format != logHuman && s.format != logJSON {
+		return nil, i18n.Errorf("unknown log format %q, want %s or %s", s.format, logHuman, logJSON)
+	}
+
+	var w io.Writer = os.Stderr
+	closeLog = func() {}
+	if s.file != "" {
+		f, err := os.OpenFile(s.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, i18n.Errorf("failed to open log file: %w", err)
+		}
+		w, closeLog = f, func() { _ = f.Close() }
+	}
+	color := s.file == "" && output.ColorEnabled()
+	l, err := logger.NewConsole(w, logger.Console{
+		Level: level,
+		JSON:  s.format == logJSON,
+		Time:  s.file != "",
+		Decorate: func(level zapcore.Level, line string) string {
+			return decorate(level, line, color)
+		},
+	})
+	if err != nil {
+		closeLog()
+		return nil, i18n.Errorf("invalid log level: %w", err)
+	}
+	diag = l.Log
+	storage.SetLogger(diag)
+	return closeLog, nil
+}
+
+// decorate prefixes a human-readable entry with its translated level and,
+// if color is set, colors warnings and errors.
+func decorate(level zapcore.Level, line string, color bool) string {
+	paint := func(render func(string) string, s string) string {
+		if color {
+			return render(s)
+		}
+		return s
+	}
+	switch {
+	case level >= zapcore.ErrorLevel:
+		return paint(output.Error, i18n.Sprintf("Error: %s", line))
+	case level == zapcore.WarnLevel:
+		return paint(output.Warning, i18n.Sprintf("Warning: %s", line))
+	case level == zapcore.DebugLevel:
+		return i18n.Sprintf("Debug: %s", line)
+	}
+	return line
+}
+
+// info logs an informational message, which -quiet suppresses.
+func (s *shell) info(a ...any) {
+	diag.Info(fmt.Sprint(a...))
+}
@@ -1,163 +1,605 @@
 package main
 
 import (
-	"bufio"
+	"cmp"
+	"context"
 	"crypto/cipher"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
+	"github.com/atinyakov/GophKeeper/internal/buildinfo"
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
 	"github.com/atinyakov/GophKeeper/internal/client/storage"
+	"github.com/atinyakov/GophKeeper/internal/client/telemetry"
 )
 
 const (
 	apiRegister = "/api/register"
+	apiRecover  = "/api/recover"
 	apiSync     = "/api/sync"
 )
 
+// Paths of the client files, placed in the directories of storage.Paths
+// by usePaths.
+var (
+	// syncLogFile records the outcome of every sync, see "sync log".
+	syncLogFile = "sync.log"
+	// activityLogFile records local operations on the vault, see "activity".
+	activityLogFile = "activity.log"
+	// pinFile stores the SPKI pins of servers, see -trust-on-first-use.
+	pinFile = "pins.json"
+	// configFile stores the settings changed in the shell, see "use".
+	configFile = "client.json"
+	// serviceEnvFile holds the passwords of the Windows service, sealed for
+	// its account, see "service install".
+	serviceEnvFile = "service.env"
+)
+
+// usePaths places the client files in the directories of p.
+func usePaths(p storage.Paths) {
+	syncLogFile = p.Data(syncLogFile)
+	activityLogFile = p.Data(activityLogFile)
+	pinFile = p.Config(pinFile)
+	configFile = p.Config(configFile)
+	serviceEnvFile = p.Config(serviceEnvFile)
+}
+
 var (
 	version   string
 	buildDate string
 )
 
-// repl runs the interactive shell loop, accepting commands to manage secrets.
-func repl(client *http.Client, baseURL string, ls *storage.LocalStorage, aead cipher.AEAD) {
-	storage.StartAutoSync(client, baseURL, ls)
-
-	scanner := bufio.NewScanner(os.Stdin)
-
-	for {
-		fmt.Print("gophkeeper> ")
-		if !scanner.Scan() {
-			break
-		}
-		line := strings.TrimSpace(scanner.Text())
-		args := strings.Fields(line)
-		if len(args) == 0 {
-			continue
-		}
-		switch args[0] {
-		case "help":
-			fmt.Println("Available commands: help, add, list, get <id>, delete <id>, edit <id>, exit")
-		case "add":
-			sec := storage.PromptForSecret(aead)
-			ls.Add(sec)
-			if err := ls.Save(); err != nil {
-				fmt.Println("Failed to save local store:", err)
-			}
+// recorder collects opt-in usage statistics; nil unless -telemetry is set.
+var recorder *telemetry.Recorder
 
-		case "list":
-			ls.List(aead)
+// checkServerVersion compares the client with the server version and
+// reports warnings and errors. It returns false if the client must not sync
+// with the server.
+func checkServerVersion(client *http.Client, baseURL string) bool {
+	if err := compatibleServer(client, baseURL); err != nil {
+		printError(i18n.Errorf("%w, sync is disabled", err))
+		return false
+	}
+	return true
+}
 
-		case "get":
-			if len(args) < 2 {
-				fmt.Println("Usage: get <id>")
-				continue
-			}
-			sec := ls.Get(args[1])
-			if sec == nil {
-				fmt.Println("Secret not found")
-			} else {
-				b, _ := json.MarshalIndent(sec, "", "  ")
-				fmt.Println(string(b))
-			}
+// compatibleServer compares the client with the server version and logs
+// warnings. It returns an error if the client must not sync with the
+// server; a server that cannot be reached is assumed compatible.
+func compatibleServer(client *http.Client, baseURL string) error {
+	sv, err := storage.FetchServerVersion(client, baseURL)
+	if err != nil {
+		diag.Warn(i18n.Sprintf("could not check server version: %s", err))
+		return nil
+	}
+	warning, err := storage.CheckCompatibility(sv, version)
+	if err != nil {
+		return i18n.Errorf("%w (server %s)", err, cmp.Or(sv.Version, "N/A"))
+	}
+	if warning != "" {
+		diag.Warn(warning)
+	}
+	return nil
+}
 
-		case "delete":
-			if len(args) < 2 {
-				fmt.Println("Usage: delete <id>")
-				continue
-			}
-			if !ls.Delete(args[1]) {
-				fmt.Println("Secret not found")
-				continue
-			}
-			if err := ls.Save(); err != nil {
-				fmt.Println("Failed to save local store:", err)
-			} else {
-				fmt.Println("Secret deleted")
-			}
+// printBuild prints the build info b under title, see -version.
+func printBuild(title string, b buildinfo.Info) {
+	fmt.Println(title)
+	fmt.Println(i18n.Sprintf("Version: %s", cmp.Or(b.Version, "N/A")))
+	fmt.Println(i18n.Sprintf("Build Date: %s", cmp.Or(b.BuildDate, "N/A")))
+	if b.GoVersion != "" {
+		fmt.Println(i18n.Sprintf("Go Version: %s", b.GoVersion))
+	}
+	if b.Revision != "" {
+		revision := b.Revision
+		if b.Modified {
+			revision = i18n.Sprintf("%s (uncommitted changes)", revision)
+		}
+		fmt.Println(i18n.Sprintf("Revision: %s", revision))
+	}
+}
 
-		case "edit":
-			if len(args) < 2 {
-				fmt.Println("Usage: edit <id>")
-				continue
-			}
-			raw, comment := storage.PromptEditSecret()
-			if !ls.Edit(args[1], raw, comment, aead) {
-				fmt.Println("Secret not found")
-				continue
-			}
-			if err := ls.Save(); err != nil {
-				fmt.Println("Failed to save local store:", err)
-			} else {
-				fmt.Println("Secret updated")
-			}
-		case "exit":
-			fmt.Println("Bye")
-			return
-		default:
-			fmt.Println("Unknown command. Type 'help' for a list of commands.")
+// printServerBuild prints the build info of the server at baseURL for
+// -version. The version needs no client certificate, so the client key is
+// not unlocked; a server that cannot be reached is only warned about.
+func printServerBuild(baseURL, caFile string, opts ...storage.ClientOption) {
+	client, err := storage.NewClient(caFile, opts...)
+	var sv *storage.ServerVersion
+	if err == nil {
+		sv, err = storage.FetchServerVersion(client, baseURL)
+	}
+	if err != nil {
+		diag.Warn(i18n.Sprintf("could not check server version: %s", err))
+		return
+	}
+	fmt.Println()
+	printBuild(i18n.Sprintf("GophKeeper Server at %s", baseURL), buildinfo.Info{
+		Version:   sv.Version,
+		BuildDate: sv.BuildDate,
+		GoVersion: sv.GoVersion,
+		Revision:  sv.Revision,
+		Modified:  sv.Modified,
+	})
+}
+
+// newShell loads the client credentials, local storage and templates. A
+// local storage without a vault yet is filled by pull, if not nil, before
+// it is unlocked, see openVault.
+func newShell(baseURL, storeFile, certFile, keyFile, caFile, tmplFile string, pull func(*http.Client, *storage.LocalStorage) error, clientOpts ...storage.ClientOption) (*shell, error) {
+	// The passphrase is asked once, even if the key is read again to migrate the vault
+	passphrase := storage.PromptPassphrase()
+	clientOpts = append(clientOpts, storage.WithPassphrase(passphrase))
+	client, err := storage.LoadClientCertificate(certFile, keyFile, caFile, clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCredentials, err)
+	}
+	ls := &storage.LocalStorage{}
+	ls.SetPath(storeFile)
+	_ = ls.Load()
+	ls.SetSyncLog(syncLogFile)
+
+	var fetch func() error
+	if pull != nil {
+		fetch = func() error { return pull(client, ls) }
+	}
+	aead, err := unlockVault(ls, keyFile, passphrase, fetch)
+	if err != nil {
+		return nil, err
+	}
+
+	templates, err := storage.LoadTemplates(tmplFile)
+	if err != nil {
+		return nil, err
+	}
+
+	activity := storage.NewActivityLog(activityLogFile, aead)
+	loadClient := func() (*http.Client, error) {
+		return storage.LoadClientCertificate(certFile, keyFile, caFile, clientOpts...)
+	}
+	return &shell{
+		client: client, baseURL: baseURL, certFile: certFile, keyFile: keyFile, ls: ls, aead: aead,
+		templates: templates, activity: activity, passphrase: passphrase, loadClient: loadClient,
+	}, nil
+}
+
+// unlockVault returns the vault key, see openVault. Secrets sealed under a
+// reused nonce, e.g. by other tools, get fresh ones after every unlock,
+// whichever way the vault was opened.
+func unlockVault(ls *storage.LocalStorage, keyFile string, passphrase storage.PassphraseFunc, pull func() error) (cipher.AEAD, error) {
+	aead, err := openVault(ls, keyFile, passphrase, pull)
+	if err != nil {
+		return nil, err
+	}
+	renewed, err := ls.RenewNonces(aead)
+	if renewed > 0 {
+		if err := ls.Save(); err != nil {
+			return nil, err
 		}
+		diag.Info(i18n.Sprintf("Re-encrypted %d secrets that shared a nonce.", renewed))
 	}
+	if err != nil {
+		diag.Warn(i18n.Sprintf("failed to re-encrypt secrets: %s", err))
+	}
+	return aead, nil
+}
+
+// openVault derives the vault key from the master password. Vaults without
+// one are given one first. Vaults of earlier releases were encrypted with a
+// key derived from the client key; their secrets and activity log are
+// re-encrypted with the new key, so that they stay readable when the
+// certificate is lost or rotated.
+//
+// A new vault is synced with pull, if not nil, before a master password is
+// chosen: if the account has a vault already, e.g. on a second device or
+// after a recovery, the servers hold its key derivation parameters, and
+// its master password opens it here too.
+func openVault(ls *storage.LocalStorage, keyFile string, passphrase storage.PassphraseFunc, pull func() error) (cipher.AEAD, error) {
+	_, err := os.Stat(activityLogFile)
+	migrate := ls.KDF == nil && (err == nil || ls.EncryptedWithClientKey())
+	if ls.KDF == nil && !migrate && pull != nil {
+		if err := pull(); err != nil {
+			return nil, i18n.Errorf("fetching the vault from the server: %w", err)
+		}
+	}
+	if ls.KDF != nil {
+		pass, err := storage.ReadMasterPassword(false)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := ls.Unlock(pass)
+		if err != nil {
+			return nil, i18n.Errorf("%w: unlocking the vault: %w", errCredentials, err)
+		}
+		return aead, nil
+	}
+
+	var legacy cipher.AEAD
+	if migrate {
+		keyPEM, err := storage.ReadKeyPEM(keyFile, passphrase)
+		if err != nil {
+			return nil, i18n.Errorf("%w: reading client key: %w", errCredentials, err)
+		}
+		if legacy, err = storage.NewAEADFromKeyPEM(keyPEM); err != nil {
+			return nil, i18n.Errorf("%w: deriving AEAD from private key: %w", errCredentials, err)
+		}
+		diag.Warn(i18n.T("The vault is encrypted with a key derived from the client key; choose a master password to re-encrypt it."))
+	}
+	pass, err := storage.ReadMasterPassword(true)
+	if err != nil {
+		return nil, err
+	}
+	aead, rekeyed, err := ls.SetMasterPassword(pass, legacy)
+	if err != nil {
+		return nil, err
+	}
+	if err := ls.Save(); err != nil {
+		return nil, err
+	}
+	if legacy != nil {
+		if err := storage.NewActivityLog(activityLogFile, legacy).Rekey(aead); err != nil {
+			diag.Warn(i18n.Sprintf("failed to re-encrypt the activity log: %s", err))
+		}
+		diag.Info(i18n.Sprintf("Re-encrypted %d secrets with the master password.", rekeyed))
+	}
+	return aead, nil
+}
+
+// isFlagSet reports whether the named command-line flag was given.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
-// main parses command-line flags and dispatches to the register or shell commands.
+// exit reports err, if any, and exits with the matching exit code.
+func exit(err error) {
+	if err != nil {
+		printError(err)
+	}
+	_ = recorder.Send()
+	os.Exit(exitCode(err))
+}
+
+// main parses command-line flags and dispatches to the register or shell
+// commands. Any other command is run once as a shell command, e.g.
+// "gophkeeper get <id> --field password", and its result is reported
+// through the exit code (see exitCode).
 func main() {
 	var (
 		cmd      string
 		baseURL  string
+		regURL   string
+		store    string
 		certFile string
 		keyFile  string
 		caFile   string
 		loginStr string
+		tmplFile string
 		showVer  bool
+		noColor  bool
+		quiet    bool
+		proxy    string
+		caBundle string
+		retries  int
+		timeouts = storage.DefaultTimeouts
+		offline  bool
+		remotes  []string
+		pins     []string
+		tofu     bool
+		lang     string
+		telURL   string
+		daemon   bool
+		rate     string
+		parallel int
+		idFormat string
+		logs     = logSettings{format: logHuman}
+		protocol = storage.TransportHTTP
 	)
 
-	flag.StringVar(&cmd, "cmd", "", "command: register | shell")
+	flag.StringVar(&cmd, "cmd", "", "command: register | recover | encrypt-key | keystore | shell | daemon | service | ssh-agent | any shell command")
 	flag.StringVar(&baseURL, "url", "https://localhost:8080", "server base URL")
-	flag.StringVar(&certFile, "cert", "client.crt", "path to client cert")
-	flag.StringVar(&keyFile, "key", "client.key", "path to client key")
-	flag.StringVar(&caFile, "ca", "certs/ca.crt", "path to CA cert")
-	flag.StringVar(&loginStr, "login", "", "username for registration")
+	flag.StringVar(&regURL, "register-url", "", "registration base URL (defaults to -url)")
+	paths, err := storage.DefaultPaths()
+	if err != nil {
+		exit(err)
+	}
+	flag.StringVar(&paths.ConfigDir, "config-dir", paths.ConfigDir, "directory of the settings, credentials, pins and templates (also $"+storage.ConfigDirEnv+")")
+	flag.StringVar(&paths.DataDir, "data-dir", paths.DataDir, "directory of the local store and logs (also $"+storage.DataDirEnv+")")
+	flag.StringVar(&store, "storage", "", "path to the local store (default storage.json in -data-dir)")
+	flag.StringVar(&certFile, "cert", "", "path to client cert (default "+storage.CertFile+" in -config-dir)")
+	flag.StringVar(&keyFile, "key", "", "path to client key (default "+storage.KeyFile+" in -config-dir)")
+	flag.StringVar(&caFile, "ca", "", `path to CA cert, or "system" for the OS root certificates (default ca.crt in -config-dir, or else certs/ca.crt)`)
+	flag.StringVar(&loginStr, "login", "", "username for registration and recovery")
+	flag.StringVar(&tmplFile, "templates", "", "path to user-defined secret templates (default templates.json in -config-dir)")
 	flag.BoolVar(&showVer, "version", false, "show build version and date")
+	flag.BoolVar(&noColor, "no-color", false, "disable colored output (also honors NO_COLOR)")
+	flag.BoolVar(&quiet, "quiet", false, "print only command results and errors")
+	flag.StringVar(&logs.level, "log-level", "", "lowest level of diagnostics logged: debug, info, warn or error (defaults to info, error with -quiet)")
+	flag.BoolVar(&logs.debug, "debug", false, "log debug diagnostics, e.g. every request sent to the servers")
+	flag.StringVar(&logs.format, "log-format", logs.format, "format of diagnostics: human or json")
+	flag.StringVar(&logs.file, "log-file", "", "append diagnostics to this file instead of stderr, e.g. for -daemon and ssh-agent")
+	flag.StringVar(&proxy, "proxy", "", "proxy URL, e.g. socks5://127.0.0.1:1080 (defaults to HTTPS_PROXY/NO_PROXY)")
+	flag.StringVar(&caBundle, "ca-bundle", "", "PEM file with trusted CA certs (used instead of the default -ca)")
+	flag.IntVar(&retries, "sync-retries", storage.DefaultRetryPolicy.MaxAttempts, "attempts per sync on network and server errors")
+	flag.DurationVar(&timeouts.Request, "timeout", timeouts.Request, "limit for a whole request including the response, 0 for none")
+	flag.DurationVar(&timeouts.TLSHandshake, "tls-timeout", timeouts.TLSHandshake, "TLS handshake timeout")
+	flag.DurationVar(&timeouts.IdleConn, "idle-timeout", timeouts.IdleConn, "how long idle keep-alive connections are kept")
+	flag.IntVar(&timeouts.MaxIdleConns, "max-idle-conns", timeouts.MaxIdleConns, "maximum idle keep-alive connections")
+	flag.BoolVar(&offline, "offline", false, "disable all network operations, e.g. on air-gapped machines")
+	flag.Func("remote", "additional server base URL to sync with, e.g. a backup (repeatable)", func(v string) error {
+		remotes = append(remotes, strings.TrimRight(v, "/"))
+		return nil
+	})
+	flag.Func("pin", "SPKI pin of the -url server, sha256/<base64> (repeatable)", func(v string) error {
+		pin, err := storage.ParsePin(v)
+		pins = append(pins, pin)
+		return err
+	})
+	flag.BoolVar(&tofu, "trust-on-first-use", false, "pin the key of servers without pins on first connect, saved in "+pinFile)
+	flag.StringVar(&lang, "lang", "", "message language: "+strings.Join(i18n.Langs(), ", ")+" (defaults to LC_ALL/LC_MESSAGES/LANG)")
+	flag.StringVar(&rate, "limit-rate", "", "cap the transfer rate in bytes per second, e.g. 500K or 1M")
+	flag.IntVar(&parallel, "transfers", 4, "number of servers (-url and -remote) synced with concurrently")
+	flag.Func("transport", "protocol of syncs and registration: http, or grpc for the smaller protobuf messages of the gRPC API", func(v string) error {
+		t, err := storage.ParseTransport(v)
+		protocol = t
+		return err
+	})
+	flag.StringVar(&idFormat, "id-format", storage.IDFormatUUID, "format of new secret IDs: uuid, or short for 12 characters")
+	flag.BoolVar(&daemon, "daemon", false, "sync in the foreground without a shell until stopped, e.g. as a systemd service")
+	flag.StringVar(&telURL, "telemetry", "", "opt in to sending anonymous usage statistics (command counts, durations, error classes) to this URL")
 	flag.Parse()
 
+	if err := i18n.SetLang(cmp.Or(lang, i18n.Detect())); err != nil {
+		exit(err)
+	}
+	// Clients set up in the working directory keep using it
+	legacy := !isFlagSet("config-dir") && !isFlagSet("data-dir") &&
+		os.Getenv(storage.ConfigDirEnv) == "" && os.Getenv(storage.DataDirEnv) == "" && paths.Legacy()
+	xdg := paths
+	if legacy {
+		paths = storage.LegacyPaths()
+	}
+	if err := paths.Create(); err != nil {
+		exit(err)
+	}
+	usePaths(paths)
+	// Settings saved in the shell apply unless given as flags
+	config, err := storage.LoadClientConfig(configFile)
+	if err != nil {
+		exit(err)
+	}
+	storeDefault, certDefault, keyDefault := config.Files(paths)
+	store = cmp.Or(store, storeDefault)
+	certFile = cmp.Or(certFile, certDefault)
+	keyFile = cmp.Or(keyFile, keyDefault)
+	tmplFile = cmp.Or(tmplFile, paths.Config("templates.json"))
+	if caFile == "" {
+		caFile = paths.Config("ca.crt")
+		if _, err := os.Stat(caFile); err != nil {
+			caFile = "certs/ca.crt"
+		}
+	}
+	if config.URL != "" && !isFlagSet("url") {
+		baseURL = config.URL
+	}
+	if noColor {
+		setOutput(storage.OutputPlain)
+	} else {
+		setOutput(config.Output)
+	}
+	logs.quiet = quiet
+	closeLog, err := setupLogging(logs)
+	if err != nil {
+		exit(err)
+	}
+	defer closeLog()
+	if legacy {
+		diag.Info(i18n.Sprintf("Using the client files in the working directory; move them to %s and %s to use the client from anywhere.", xdg.ConfigDir, xdg.DataDir))
+	}
+	if err := storage.SetIDFormat(idFormat); err != nil {
+		exit(err)
+	}
+	recorder = telemetry.New(telURL, version)
+
+	clientOpts := []storage.ClientOption{
+		storage.WithTimeouts(timeouts), storage.WithTransport(protocol), storage.WithCredentialFiles(certFile, keyFile),
+	}
+	if proxy != "" {
+		u, err := storage.ParseProxy(proxy)
+		if err != nil {
+			exit(err)
+		}
+		clientOpts = append(clientOpts, storage.WithProxy(u))
+	}
+	if rate != "" {
+		r, err := storage.ParseRate(rate)
+		if err != nil {
+			exit(err)
+		}
+		clientOpts = append(clientOpts, storage.WithRateLimit(r))
+	}
+	pinStore, err := storage.LoadPinStore(pinFile)
+	if err != nil {
+		exit(err)
+	}
+	if u, err := url.Parse(baseURL); err == nil && len(pins) > 0 {
+		pinStore.Pin(u.Hostname(), pins...)
+	}
+	clientOpts = append(clientOpts, storage.WithPins(pinStore, tofu))
+	if caBundle != "" {
+		clientOpts = append(clientOpts, storage.WithCABundle(caBundle))
+		if !isFlagSet("ca") {
+			caFile = ""
+		}
+	}
+
 	if showVer {
-		fmt.Printf("GophKeeper Client\nVersion: %s\nBuild Date: %s\n", version, buildDate)
+		printBuild(i18n.T("GophKeeper Client"), buildinfo.Read(version, buildDate))
+		if !offline {
+			printServerBuild(baseURL, caFile, clientOpts...)
+		}
 		return
 	}
 
+	args := flag.Args()
+	if daemon {
+		cmd = "daemon"
+	}
+	if cmd == "" && len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	openShell := func() *shell {
+		// New vaults take the key derivation parameters of the account's
+		// vault from the servers
+		var pull func(*http.Client, *storage.LocalStorage) error
+		if !offline {
+			pull = func(client *http.Client, ls *storage.LocalStorage) error {
+				ls.SetTransfers(parallel)
+				ls.SetTransport(protocol)
+				return storage.SyncWithServers(client, append([]string{baseURL}, remotes...), ls)
+			}
+		}
+		sh, err := newShell(baseURL, store, certFile, keyFile, caFile, tmplFile, pull, clientOpts...)
+		if err != nil {
+			exit(err)
+		}
+		if storage.IsUnencryptedKeyFile(keyFile) {
+			diag.Warn(i18n.T("Client key is stored unencrypted; run \"encrypt-key\" to protect it with a passphrase."))
+		}
+		warnCertificateExpiry(certFile)
+		sh.telemetry = recorder
+		sh.config = config
+		sh.quiet = quiet
+		sh.offline = offline
+		sh.remotes = remotes
+		sh.ls.SetTransfers(parallel)
+		sh.ls.SetTransport(protocol)
+		sh.retry = storage.DefaultRetryPolicy
+		sh.retry.MaxAttempts = retries
+		return sh
+	}
+
 	switch cmd {
 	case "register":
+		if offline {
+			exit(errOffline)
+		}
 		if loginStr == "" {
-			log.Fatal("please provide -login=username")
+			exit(usageError("register -login=username"))
+		}
+		clientOpts = append(clientOpts, storage.WithPassphrase(storage.PromptNewPassphrase()))
+		codes, err := storage.Register(cmp.Or(regURL, baseURL)+apiRegister, loginStr, caFile, clientOpts...)
+		if err != nil {
+			exit(err)
 		}
-		if err := storage.Register(baseURL+apiRegister, loginStr, caFile); err != nil {
-			log.Fatal(err)
+		if !quiet {
+			fmt.Println(i18n.T("\u2705 Registration successful. Certificate and key saved."))
+			fmt.Println(i18n.T("Recovery codes, each usable once to replace a lost certificate. Store them safely:"))
+		}
+		for _, c := range codes {
+			fmt.Println(c)
+		}
+	case "recover":
+		if offline {
+			exit(errOffline)
+		}
+		if loginStr == "" || len(args) > 1 {
+			exit(usageError("recover -login=username [code]"))
+		}
+		var code string
+		if len(args) == 1 {
+			code = args[0]
+		} else {
+			c, err := storage.ReadPassphrase(i18n.T("Recovery code: "))
+			if err != nil {
+				exit(err)
+			}
+			code = string(c)
+		}
+		clientOpts = append(clientOpts, storage.WithPassphrase(storage.PromptNewPassphrase()))
+		if err := storage.Recover(cmp.Or(regURL, baseURL)+apiRecover, loginStr, code, caFile, clientOpts...); err != nil {
+			exit(err)
+		}
+		if !quiet {
+			fmt.Println(i18n.T("\u2705 Recovery successful. New certificate and key saved."))
+		}
+		// Vaults with a master password do not depend on the client key
+		var ls storage.LocalStorage
+		ls.SetPath(store)
+		if ls.Load() == nil && ls.EncryptedWithClientKey() {
+			diag.Warn(i18n.T("Secrets encrypted with the lost key cannot be decrypted with the new one."))
+		}
+	case "encrypt-key":
+		pass, err := storage.PromptNewPassphrase()()
+		if err == nil && len(pass) == 0 {
+			err = i18n.NewError("a non-empty passphrase is required")
+		}
+		if err == nil {
+			err = storage.EncryptKeyFile(keyFile, pass)
 		}
-	case "shell":
-		client, err := storage.LoadClientCertificate(certFile, keyFile, caFile)
 		if err != nil {
-			log.Fatal(err)
+			exit(err)
 		}
-		ls := &storage.LocalStorage{}
+		if !quiet {
+			fmt.Println(i18n.T("\u2705 Client key encrypted."))
+		}
+	case "keystore":
+		// Vaults of earlier releases need the key file to be decrypted
+		var ls storage.LocalStorage
+		ls.SetPath(store)
 		_ = ls.Load()
-
-		keyPEM, err := os.ReadFile(keyFile)
-		if err != nil {
-			log.Fatalf("reading client key: %v", err)
+		if _, err := os.Stat(activityLogFile); ls.KDF == nil && (err == nil || ls.EncryptedWithClientKey()) {
+			exit(i18n.NewError("the vault is encrypted with a key derived from the client key; open the shell once to choose a master password first"))
 		}
-		aead, err := storage.NewAEADFromKeyPEM(keyPEM)
-		if err != nil {
-			log.Fatalf("deriving AEAD from private key: %v", err)
+		clientOpts = append(clientOpts, storage.WithPassphrase(storage.PromptPassphrase()))
+		if _, err := storage.MoveKeyToKeystore(certFile, keyFile, clientOpts...); err != nil {
+			exit(err)
 		}
-
-		repl(client, baseURL, ls, aead)
+		if !quiet {
+			fmt.Println(i18n.T("\u2705 Client key moved to the OS keystore."))
+		}
+	case "shell":
+		sh := openShell()
+		compatible := !offline && checkServerVersion(sh.client, baseURL)
+		sh.repl(compatible && config.AutoSyncEnabled())
+		_ = recorder.Send()
+	case "daemon":
+		if err := loadServiceEnv(); err != nil {
+			exit(err)
+		}
+		sh := openShell()
+		if !offline && !checkServerVersion(sh.client, baseURL) {
+			// The incompatibility has been reported already
+			os.Exit(exitError)
+		}
+		exit(sh.daemon())
+	case "service":
+		exit(manageService(args, serviceSetup{
+			flags: os.Args[1 : len(os.Args)-flag.NArg()], paths: paths,
+			store: store, keyFile: keyFile, logFile: logs.file, quiet: quiet,
+		}))
+	case "ssh-agent":
+		exit(openShell().sshAgent(args))
+	case "":
+		exit(i18n.NewError("please provide a command, e.g. -cmd=shell"))
 	default:
-		log.Fatalf("unknown command: %s", cmd)
+		sh := openShell()
+		err := sh.run(append([]string{cmd}, args...))
+		// Rendered files live until their deletion or an interrupt
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		sh.rendered.wait(ctx)
+		stop()
+		exit(err)
 	}
 }
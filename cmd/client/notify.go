@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+// notify implements the notify command: "notify" lists the notification
+// channels, "notify add <kind> <target>" registers one, subscribed to the
+// events given with --event or to all, and "notify rm <id>" removes one.
+func (s *shell) notify(args []string) error {
+	if s.offline {
+		return errOffline
+	}
+	if len(args) == 0 {
+		channels, err := storage.FetchChannels(s.client, s.baseURL)
+		if err != nil {
+			return i18n.Errorf("failed to fetch notification channels: %w", err)
+		}
+		if len(channels) == 0 {
+			s.info(i18n.T("No notification channels"))
+			return nil
+		}
+		storage.PrintChannels(os.Stdout, channels)
+		return nil
+	}
+
+	switch args[0] {
+	case "add":
+		var c storage.Channel
+		fs := newFlagSet("notify add")
+		fs.Func("event", "notify only of this event: secret-expiry, certificate-expiry or new-device", func(v string) error {
+			c.Events = append(c.Events, v)
+			return nil
+		})
+		rest, err := parseArgs(fs, args[1:])
+		if err != nil || len(rest) != 2 {
+			return usageError("notify add email|webhook|ntfy <target> [--event e]...")
+		}
+		c.Kind, c.Target = rest[0], rest[1]
+		added, err := storage.AddChannel(s.client, s.baseURL, c)
+		if err != nil {
+			return i18n.Errorf("failed to add notification channel: %w", err)
+		}
+		s.info(i18n.Sprintf("Notification channel %d added", added.ID))
+	case "rm":
+		if len(args) != 2 {
+			return usageError("notify rm <id>")
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return usageError("notify rm <id>")
+		}
+		if err := storage.DeleteChannel(s.client, s.baseURL, id); err != nil {
+			return i18n.Errorf("failed to remove notification channel %d: %w", id, err)
+		}
+		s.info(i18n.Sprintf("Notification channel %d removed", id))
+	default:
+		return usageError("notify | notify add email|webhook|ntfy <target> [--event e]... | notify rm <id>")
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// withPager calls fn with a writer that pipes its output through $PAGER when
+// stdout is a terminal and PAGER is set; otherwise fn writes to stdout.
+func withPager(fn func(w io.Writer)) {
+	args := strings.Fields(os.Getenv("PAGER"))
+	if len(args) == 0 || !isTerminal(os.Stdout) {
+		fn(os.Stdout)
+		return
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		// Let less pass colors through and quit if the output fits on one screen.
+		cmd.Env = append(os.Environ(), "LESS=FRX")
+	}
+	in, err := cmd.StdinPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		fn(os.Stdout)
+		return
+	}
+	fn(in)
+	_ = in.Close()
+	_ = cmd.Wait()
+}
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
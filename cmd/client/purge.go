@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+// purge implements the purge command. "purge --all-deleted" syncs, so that
+// the servers hold every local deletion, then has the servers permanently
+// delete the tombstones of all deleted secrets instead of keeping them for
+// the retention period, and drops them from the local store.
+func (s *shell) purge(args []string) error {
+	fs := newFlagSet("purge")
+	all := fs.Bool("all-deleted", false, "purge all deleted secrets")
+	force := fs.Bool("force", false, "purge without asking for confirmation")
+	if rest, err := parseArgs(fs, args); err != nil || len(rest) != 0 || !*all {
+		return usageError("purge --all-deleted [--force]")
+	}
+	if s.offline {
+		return errOffline
+	}
+
+	if err := s.retry.Do(func() error {
+		return storage.SyncWithServers(s.client, s.syncURLs(), s.ls)
+	}); err != nil {
+		return err
+	}
+	ids := s.ls.DeletedIDs()
+	if len(ids) == 0 {
+		s.info(i18n.T("No deleted secrets"))
+		return nil
+	}
+	if err := s.confirm(i18n.Sprintf("Permanently purge %d deleted secrets? Devices that have not synced the deletions keep their copies.", len(ids)), *force); err != nil {
+		return err
+	}
+
+	purged := 0
+	for _, u := range s.syncURLs() {
+		done, err := storage.Purge(s.client, u, ids)
+		if err != nil {
+			return i18n.Errorf("failed to purge deleted secrets on %s: %w", u, err)
+		}
+		purged = max(purged, len(done))
+	}
+	s.ls.DropTombstones(ids)
+	if err := s.ls.Save(); err != nil {
+		return i18n.Errorf("failed to save local store: %w", err)
+	}
+	for _, id := range ids {
+		s.record(storage.ActivityPurge, id, "")
+	}
+	s.info(i18n.Sprintf("Purged %d deleted secrets", purged))
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+// refresh implements the refresh command. "refresh <id>" discards the
+// local copy of a secret and syncs, taking the copy the servers hold even
+// if it is older than the local one, e.g. after the secret was restored on
+// the server. Local changes not yet synced are lost, so the user confirms
+// first unless --force is given.
+func (s *shell) refresh(args []string) error {
+	fs := newFlagSet("refresh")
+	force := fs.Bool("force", false, "refresh without asking for confirmation")
+	rest, err := parseArgs(fs, args)
+	if err != nil || len(rest) != 1 {
+		return usageError("refresh <id> [--force]")
+	}
+	if s.offline {
+		return errOffline
+	}
+	id, err := s.ls.Resolve(rest[0], s.aead)
+	if err != nil {
+		return err
+	}
+	if err := s.confirm(i18n.Sprintf("Replace the local copy of %s with the server's? Local changes not yet synced are lost.", id), *force); err != nil {
+		return err
+	}
+
+	s.ls.Invalidate(id)
+	if err := s.retry.Do(func() error {
+		return storage.SyncWithServers(s.client, s.syncURLs(), s.ls)
+	}); err != nil {
+		return err
+	}
+	if sec := s.ls.Get(id); sec != nil {
+		s.info(i18n.Sprintf("Refreshed %s at version %d", id, sec.Version))
+	} else {
+		s.info(i18n.Sprintf("%s is deleted on the server", id))
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+// templateUsage describes the subcommands of template.
+const templateUsage = "template render <file> [-o file] [--delete-after d] | template watch <file> -o file [--pid n|--pidfile file]"
+
+// template implements the template command: "template render <file>"
+// fills the secrets referenced by a template into a config file, see
+// storage.RenderTemplate, and "template watch" keeps it up to date, see
+// watchTemplate.
+func (s *shell) template(args []string) error {
+	if len(args) > 0 && args[0] == "watch" {
+		return s.watchTemplate(args[1:])
+	}
+	if len(args) == 0 || args[0] != "render" {
+		return usageError(templateUsage)
+	}
+	return s.renderTemplate(args[1:])
+}
+
+// renderTemplate implements "template render". The result is written to
+// -o, readable by the user only, or to stdout. With --delete-after the
+// file is deleted after the given time, or when the client exits,
+// whichever is first.
+func (s *shell) renderTemplate(args []string) error {
+	fs := newFlagSet("template render")
+	out := fs.String("o", "", "write the result to this file instead of stdout")
+	deleteAfter := fs.Duration("delete-after", 0, "delete the file after this long, e.g. 10m")
+	rest, err := parseArgs(fs, args)
+	if err != nil || len(rest) != 1 || *deleteAfter < 0 || (*deleteAfter > 0 && *out == "") {
+		return usageError(templateUsage)
+	}
+
+	r := &templateRenderer{s: s, path: rest[0]}
+	rendered, err := r.render()
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err := os.Stdout.Write(rendered)
+		return err
+	}
+	if err := storage.WritePrivateFile(*out, rendered); err != nil {
+		return i18n.Errorf("failed to write %s: %w", *out, err)
+	}
+	if *deleteAfter > 0 {
+		s.rendered.deleteAfter(*out, *deleteAfter)
+		s.info(i18n.Sprintf("Rendered %s, deleted in %s", *out, *deleteAfter))
+	} else {
+		s.info(i18n.Sprintf("Rendered %s", *out))
+	}
+	return nil
+}
+
+// watchTemplate implements "template watch": it renders the template to
+// -o and syncs in the foreground until SIGINT or SIGTERM, like daemon,
+// rendering the file again whenever a sync brings a new version of a
+// secret it references. After each update, the process --pid, or the one
+// whose ID is read from --pidfile at the time, is sent SIGHUP so that it
+// reloads its config.
+func (s *shell) watchTemplate(args []string) error {
+	fs := newFlagSet("template watch")
+	out := fs.String("o", "", "file to keep up to date")
+	pid := fs.Int("pid", 0, "send SIGHUP to this process after each update")
+	pidFile := fs.String("pidfile", "", "send SIGHUP to the process whose ID this file holds after each update")
+	rest, err := parseArgs(fs, args)
+	if err != nil || len(rest) != 1 || *out == "" || (*pid != 0 && *pidFile != "") {
+		return usageError(templateUsage)
+	}
+	if s.offline {
+		return errOffline
+	}
+
+	r := &templateRenderer{s: s, path: rest[0]}
+	update := func() error {
+		rendered, err := r.render()
+		if err != nil {
+			return err
+		}
+		if err := storage.WritePrivateFile(*out, rendered); err != nil {
+			return i18n.Errorf("failed to write %s: %w", *out, err)
+		}
+		s.info(i18n.Sprintf("Rendered %s", *out))
+		if *pid != 0 || *pidFile != "" {
+			if err := signalReload(*pid, *pidFile); err != nil {
+				return i18n.Errorf("failed to signal the process: %w", err)
+			}
+		}
+		return nil
+	}
+	if err := update(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pushes := make(chan storage.Push, 1)
+	storage.WatchServers(ctx, s.client, s.syncURLs(), s.ls, pushes)
+	storage.AutoSync(ctx, s.client, s.syncURLs(), s.ls, s.retry, pushes, func(err error, next time.Duration) {
+		if err != nil {
+			diag.Error(i18n.Sprintf("sync error: %v (next attempt in %s)", err, next.Round(time.Second)))
+			return
+		}
+		if !r.changed() {
+			return
+		}
+		// A failed update is retried after the next sync
+		if err := update(); err != nil {
+			printError(err)
+		}
+	})
+	return nil
+}
+
+// signalReload sends SIGHUP to the process pid, or to the one whose ID is
+// stored in pidFile.
+func signalReload(pid int, pidFile string) error {
+	if pidFile != "" {
+		data, err := os.ReadFile(pidFile)
+		if err != nil {
+			return err
+		}
+		if pid, err = strconv.Atoi(strings.TrimSpace(string(data))); err != nil {
+			return fmt.Errorf("%s: invalid process ID: %w", pidFile, err)
+		}
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(syscall.SIGHUP)
+}
+
+// templateRenderer renders a template file with the secrets of the shell
+// and remembers the versions of the secrets it referenced, so that a
+// watch renders it again only when one of them changes.
+type templateRenderer struct {
+	s        *shell
+	path     string
+	versions map[string]int64 // by ID, as of the last rendering
+	revealed map[string]bool  // reprompt secrets the passphrase was given for
+}
+
+// render renders the template file.
+func (r *templateRenderer) render() ([]byte, error) {
+	text, err := os.ReadFile(r.path)
+	if err != nil {
+		return nil, i18n.Errorf("failed to read template: %w", err)
+	}
+	if r.revealed == nil {
+		r.revealed = map[string]bool{}
+	}
+	versions := map[string]int64{}
+	rendered, err := storage.RenderTemplate(r.path, string(text), func(ref, field string) (string, error) {
+		id, err := r.s.ls.Resolve(ref, r.s.aead)
+		if err != nil {
+			return "", err
+		}
+		sec := r.s.ls.Get(id)
+		// A watch asks for the passphrase once, not on every change
+		if !r.revealed[id] {
+			if err := r.s.reveal(sec); err != nil {
+				return "", err
+			}
+			r.revealed[id] = true
+		}
+		plain, err := storage.Decrypt(r.s.aead, sec.Data)
+		if err != nil {
+			return "", i18n.Errorf("failed to decrypt secret: %w", err)
+		}
+		value, err := storage.ExtractField(plain, field)
+		if err != nil {
+			return "", err
+		}
+		versions[id] = sec.Version
+		r.s.record(storage.ActivityView, id, "template "+field)
+		return value, nil
+	})
+	if err != nil {
+		return nil, i18n.Errorf("failed to render template: %w", err)
+	}
+	r.versions = versions
+	return rendered, nil
+}
+
+// changed reports whether a secret referenced by the last rendering has
+// been changed or deleted since.
+func (r *templateRenderer) changed() bool {
+	for id, version := range r.versions {
+		if sec := r.s.ls.Get(id); sec == nil || sec.Version != version {
+			return true
+		}
+	}
+	return false
+}
+
+// renderedFiles deletes rendered files once they are no longer needed, see
+// template. The zero value is ready to use.
+type renderedFiles struct {
+	mu      sync.Mutex
+	pending map[string]*time.Timer // by path
+	wg      sync.WaitGroup         // counts the pending deletions
+}
+
+// deleteAfter deletes the file at path after d. A deletion pending for the
+// same path is replaced.
+func (r *renderedFiles) deleteAfter(path string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending == nil {
+		r.pending = map[string]*time.Timer{}
+	}
+	if t, ok := r.pending[path]; ok && t.Stop() {
+		r.wg.Done()
+	}
+	r.wg.Add(1)
+	var t *time.Timer
+	t = time.AfterFunc(d, func() {
+		r.mu.Lock()
+		if r.pending[path] == t {
+			delete(r.pending, path)
+		}
+		r.mu.Unlock()
+		r.remove(path)
+		r.wg.Done()
+	})
+	r.pending[path] = t
+}
+
+// flush deletes the files with pending deletions now.
+func (r *renderedFiles) flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for path, t := range r.pending {
+		if t.Stop() {
+			r.remove(path)
+			r.wg.Done()
+		}
+		delete(r.pending, path)
+	}
+}
+
+// wait waits until the pending deletions are done, or until ctx is done,
+// and then deletes the files left at once.
+func (r *renderedFiles) wait(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		r.flush()
+		<-done
+	}
+}
+
+// remove deletes a rendered file, reporting failures.
+func (r *renderedFiles) remove(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		diag.Warn(i18n.Sprintf("failed to delete %s: %s", path, err))
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+// renewWarning is how long before its expiry the shell suggests renewing
+// the client certificate.
+const renewWarning = 30 * 24 * time.Hour
+
+// renew implements the renew command. It has the server issue a fresh
+// client certificate and key in place of the current ones, swaps the
+// certificate and key files and reconnects with them. The vault does not
+// depend on the client key once it has a master password, which newShell
+// ensures; an encrypted key keeps its passphrase.
+func (s *shell) renew(args []string) error {
+	if len(args) != 0 {
+		return usageError("renew")
+	}
+	if s.offline {
+		return errOffline
+	}
+
+	// Renewals go to the HTTP API whatever the transport of syncs
+	remote := storage.NewRemote(s.client, storage.TransportHTTP)
+	cert, err := storage.RenewCertificate(remote, s.baseURL, s.certFile, s.keyFile, s.passphrase)
+	if err != nil {
+		return i18n.Errorf("failed to renew certificate: %w", err)
+	}
+	client, err := s.loadClient()
+	if err != nil {
+		return i18n.Errorf("failed to load renewed certificate: %w", err)
+	}
+	s.client.CloseIdleConnections()
+	s.client = client
+	// Restart the background syncs with the new certificate
+	if s.stopSync != nil {
+		s.stopAutoSync()
+		s.startAutoSync()
+	}
+	s.info(i18n.Sprintf("Certificate renewed; valid until %s.", cert.NotAfter.Local().Format(time.DateOnly)))
+	return nil
+}
+
+// warnCertificateExpiry warns if the client certificate in certFile
+// expires within renewWarning or has expired.
+func warnCertificateExpiry(certFile string) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return
+	}
+	switch left := time.Until(cert.NotAfter); {
+	case left <= 0:
+		diag.Warn(i18n.T("The client certificate has expired; recover access with \"recover\"."))
+	case left <= renewWarning:
+		diag.Warn(i18n.Sprintf("The client certificate expires on %s; run \"renew\" to replace it.", cert.NotAfter.Local().Format(time.DateOnly)))
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"cmp"
+	"path/filepath"
+	"strings"
+
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+// serviceName is the name the client is registered under as a Windows
+// service.
+const serviceName = "GophKeeper"
+
+// serviceUsage is the usage of the service command.
+const serviceUsage = "service install|uninstall"
+
+// serviceSetup is what "service install" needs to know about the client.
+type serviceSetup struct {
+	flags   []string // command-line flags given, without the arguments
+	paths   storage.Paths
+	store   string
+	keyFile string
+	logFile string // -log-file; empty for the default
+	quiet   bool
+}
+
+// serviceArgs returns the arguments the service starts the client with:
+// the flags given to "service install" other than the command, and the
+// directories and the log file as absolute paths, as services start in the
+// system directory and have no stderr.
+func serviceArgs(setup serviceSetup) ([]string, error) {
+	configDir, err := filepath.Abs(setup.paths.ConfigDir)
+	if err != nil {
+		return nil, err
+	}
+	dataDir, err := filepath.Abs(setup.paths.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	logFile, err := filepath.Abs(cmp.Or(setup.logFile, setup.paths.Data("daemon.log")))
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"-daemon", "-config-dir=" + configDir, "-data-dir=" + dataDir, "-log-file=" + logFile}
+
+	replaced := map[string]bool{"cmd": true, "daemon": true, "config-dir": true, "data-dir": true, "log-file": true}
+	for i := 0; i < len(setup.flags); i++ {
+		arg := setup.flags[i]
+		if arg == "--" {
+			continue
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !replaced[name] {
+			args = append(args, arg)
+			continue
+		}
+		// Drop the value given as the next argument too
+		if !hasValue && name != "daemon" {
+			i++
+		}
+	}
+	return args, nil
+}
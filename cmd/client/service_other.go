@@ -0,0 +1,31 @@
+//go:build !windows
+
+package main
+
+import "github.com/atinyakov/GophKeeper/internal/client/i18n"
+
+// runningAsService reports whether the client was started by the Windows
+// service control manager, which it never is elsewhere.
+func runningAsService() bool {
+	return false
+}
+
+// loadServiceEnv does nothing: services of other systems are given the
+// passwords by their manager, e.g. in the EnvironmentFile of systemd.
+func loadServiceEnv() error {
+	return nil
+}
+
+func (s *shell) serveService() error {
+	return errNoService
+}
+
+// manageService fails, as only Windows has services to register.
+func manageService(args []string, _ serviceSetup) error {
+	if len(args) != 1 {
+		return usageError(serviceUsage)
+	}
+	return errNoService
+}
+
+var errNoService = i18n.NewError("Windows services are only available on Windows; run -daemon under systemd, see init/gophkeeper-client.service")
@@ -0,0 +1,277 @@
+//go:build windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+// serviceEnv names the variables "service install" seals for the service,
+// which cannot prompt for them.
+var serviceEnv = []string{storage.MasterPasswordEnv, storage.PassphraseEnv}
+
+// runningAsService reports whether the client was started by the service
+// control manager.
+func runningAsService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// loadServiceEnv sets the variables sealed by "service install" when the
+// client runs as the service, unless they are set already.
+func loadServiceEnv() error {
+	if !runningAsService() {
+		return nil
+	}
+	sealed, err := os.ReadFile(serviceEnvFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	plain, err := unprotect(sealed)
+	if err != nil {
+		return i18n.Errorf("failed to unseal %s: %w", serviceEnvFile, err)
+	}
+	defer clear(plain)
+	var env map[string]string
+	if err := json.Unmarshal(plain, &env); err != nil {
+		return i18n.Errorf("failed to unseal %s: %w", serviceEnvFile, err)
+	}
+	for name, value := range env {
+		if _, ok := os.LookupEnv(name); !ok {
+			if err := os.Setenv(name, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// serveService runs the daemon under the service control manager until
+// the service is stopped or the system shuts down.
+func (s *shell) serveService() error {
+	return svc.Run(serviceName, serviceHandler{s})
+}
+
+// serviceHandler runs the daemon of s as the Windows service.
+type serviceHandler struct {
+	s *shell
+}
+
+func (h serviceHandler) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.s.syncUntil(ctx, func(error, time.Duration) {})
+	}()
+	// Unlike systemd, the service control manager gives up on services
+	// starting for longer than 30 seconds, so the first sync is not waited
+	// for
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for req := range requests {
+		switch req.Cmd {
+		case svc.Interrogate:
+			status <- req.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			status <- svc.Status{State: svc.StopPending}
+			cancel()
+			<-done
+			h.s.info(i18n.T("Bye"))
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// manageService installs or uninstalls the Windows service.
+func manageService(args []string, setup serviceSetup) error {
+	if len(args) != 1 {
+		return usageError(serviceUsage)
+	}
+	switch args[0] {
+	case "install":
+		return installService(setup)
+	case "uninstall":
+		return uninstallService(setup)
+	}
+	return usageError(serviceUsage)
+}
+
+// installService registers the client as a service started at boot that
+// runs the daemon under the account of the current user, so that it uses
+// the same files and OS keystore. The passwords the daemon needs are
+// sealed with DPAPI for that account in serviceEnvFile.
+func installService(setup serviceSetup) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args, err := serviceArgs(setup)
+	if err != nil {
+		return err
+	}
+	env, err := servicePasswords(setup)
+	if err != nil {
+		return err
+	}
+	u, err := user.Current()
+	if err != nil {
+		return err
+	}
+	password, err := storage.ReadPassphrase(i18n.Sprintf("Windows password of %s: ", u.Username))
+	if err != nil {
+		return err
+	}
+
+	plain, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	defer clear(plain)
+	sealed, err := protect(plain)
+	if err != nil {
+		return i18n.Errorf("failed to seal the passwords: %w", err)
+	}
+	if err := storage.WritePrivateFile(serviceEnvFile, sealed); err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return i18n.Errorf("connecting to the service control manager: %w", err)
+	}
+	defer m.Disconnect()
+	service, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName:      "GophKeeper sync daemon",
+		Description:      "Keeps the GophKeeper vault of " + u.Username + " in sync with its servers.",
+		StartType:        mgr.StartAutomatic,
+		DelayedAutoStart: true,
+		ServiceStartName: u.Username,
+		Password:         string(password),
+	}, args...)
+	if err != nil {
+		_ = os.Remove(serviceEnvFile)
+		return i18n.Errorf("creating the service: %w", err)
+	}
+	defer service.Close()
+	// Restart after failures, like Restart=on-failure of the systemd unit
+	restart := mgr.RecoveryAction{Type: mgr.ServiceRestart, Delay: 30 * time.Second}
+	if err := service.SetRecoveryActions([]mgr.RecoveryAction{restart}, uint32((24 * time.Hour).Seconds())); err != nil {
+		diag.Warn(i18n.Sprintf("failed to set the restart policy of the service: %s", err))
+	}
+	if err := service.Start(); err != nil {
+		return i18n.Errorf("the service is installed, but failed to start: %w", err)
+	}
+	if !setup.quiet {
+		fmt.Println(i18n.Sprintf("✅ Service %s installed and started.", serviceName))
+	}
+	return nil
+}
+
+// servicePasswords returns the variables of serviceEnv to seal, asking for
+// the passwords not set in the environment and checking them.
+func servicePasswords(setup serviceSetup) (map[string]string, error) {
+	env := make(map[string]string)
+	for _, name := range serviceEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env[name] = value
+		}
+	}
+
+	pass, err := storage.ReadMasterPassword(false)
+	if err != nil {
+		return nil, err
+	}
+	var ls storage.LocalStorage
+	ls.SetPath(setup.store)
+	if err := ls.Load(); err != nil {
+		return nil, err
+	}
+	if _, err := ls.Unlock(pass); err != nil {
+		return nil, i18n.Errorf("%w: unlocking the vault: %w", errCredentials, err)
+	}
+	env[storage.MasterPasswordEnv] = string(pass)
+
+	if keyPEM, err := os.ReadFile(setup.keyFile); err == nil && storage.IsEncryptedKeyPEM(keyPEM) {
+		pass, err := storage.PromptPassphrase()()
+		if err != nil {
+			return nil, err
+		}
+		if err := storage.VerifyPassphrase(setup.keyFile, pass); err != nil {
+			return nil, i18n.Errorf("%w: reading client key: %w", errCredentials, err)
+		}
+		env[storage.PassphraseEnv] = string(pass)
+	}
+	return env, nil
+}
+
+// uninstallService stops and removes the service and its sealed
+// passwords.
+func uninstallService(setup serviceSetup) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return i18n.Errorf("connecting to the service control manager: %w", err)
+	}
+	defer m.Disconnect()
+	service, err := m.OpenService(serviceName)
+	if err != nil {
+		return i18n.Errorf("opening the service: %w", err)
+	}
+	defer service.Close()
+	// Deleted services are removed once stopped
+	_, _ = service.Control(svc.Stop)
+	if err := service.Delete(); err != nil {
+		return i18n.Errorf("deleting the service: %w", err)
+	}
+	if err := os.Remove(serviceEnvFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if !setup.quiet {
+		fmt.Println(i18n.Sprintf("✅ Service %s uninstalled.", serviceName))
+	}
+	return nil
+}
+
+// protect seals plain with DPAPI for the current user.
+func protect(plain []byte) ([]byte, error) {
+	in := windows.DataBlob{Size: uint32(len(plain)), Data: unsafe.SliceData(plain)}
+	var out windows.DataBlob
+	if err := windows.CryptProtectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	return bytes.Clone(unsafe.Slice(out.Data, out.Size)), nil
+}
+
+// unprotect opens data sealed by protect for the current user.
+func unprotect(sealed []byte) ([]byte, error) {
+	in := windows.DataBlob{Size: uint32(len(sealed)), Data: unsafe.SliceData(sealed)}
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data)))
+	return bytes.Clone(unsafe.Slice(out.Data, out.Size)), nil
+}
@@ -0,0 +1,719 @@
+package main
+
+import (
+	"context"
+	"crypto/cipher"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/output"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+	"github.com/atinyakov/GophKeeper/internal/client/telemetry"
+	"github.com/atinyakov/GophKeeper/internal/limits"
+)
+
+// shell holds the state shared by the client commands. Commands run either
+// interactively (see repl) or one at a time from the command line.
+type shell struct {
+	client    *http.Client
+	baseURL   string
+	certFile  string   // path of the client certificate, see renew
+	keyFile   string   // path of the client key, see reveal
+	remotes   []string // additional servers to sync with, e.g. a backup
+	ls        *storage.LocalStorage
+	aead      cipher.AEAD
+	templates storage.Templates
+	quiet     bool                  // print bare results, e.g. IDs, for scripts
+	retry     storage.RetryPolicy   // retry policy of syncs
+	offline   bool                  // disable all network operations
+	telemetry *telemetry.Recorder   // opt-in usage statistics, nil if disabled
+	activity  *storage.ActivityLog  // local operations on the vault, nil if disabled
+	config    *storage.ClientConfig // settings changed with use, see configFile
+	stopSync  context.CancelFunc    // stops the background syncs, nil if not running
+	rendered  renderedFiles         // rendered files to delete, see template
+
+	passphrase storage.PassphraseFunc       // passphrase of the client key, asked once
+	loadClient func() (*http.Client, error) // rebuilds client from the credential files
+}
+
+// commands lists the shell commands by name, as reported by telemetry.
+var commands = []string{
+	"help", "add", "list", "get", "delete", "edit", "set", "clone",
+	"attachments", "templates", "sync", "stats", "token", "activity",
+	"takeout", "duplicates", "autotype", "wifi", "alias", "purge",
+	"access-log", "leases", "notify", "use", "import", "template",
+	"fingerprint", "tui", "renew", "refresh", "conflicts",
+}
+
+// errOffline is returned by commands needing the server in offline mode.
+var errOffline = i18n.NewError("offline mode: network operations are disabled")
+
+// usageError is returned when a command is called with invalid arguments.
+type usageError string
+
+func (e usageError) Error() string {
+	return i18n.Sprintf("usage: %s", string(e))
+}
+
+// repl runs the interactive shell loop, accepting commands to manage secrets.
+// Secrets are synced in the background unless autoSync is false; see use
+// to change it at runtime.
+func (s *shell) repl(autoSync bool) {
+	if autoSync && !s.offline {
+		s.startAutoSync()
+	}
+	defer s.stopAutoSync()
+	defer s.rendered.flush()
+	if !s.offline {
+		s.warnStaleDevices()
+	}
+
+	scanner := storage.StdinScanner()
+
+	for {
+		fmt.Print("gophkeeper> ")
+		if !scanner.Scan() {
+			break
+		}
+		args := strings.Fields(strings.TrimSpace(scanner.Text()))
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "exit" {
+			s.info(i18n.T("Bye"))
+			return
+		}
+		if err := s.run(args); err != nil {
+			printError(err)
+		}
+	}
+}
+
+// warnStaleDevices warns about devices that have not synced for
+// storage.StaleDeviceAge. The check is best effort: errors are ignored.
+func (s *shell) warnStaleDevices() {
+	stats, err := storage.FetchStats(s.client, s.baseURL)
+	if err != nil {
+		return
+	}
+	for _, d := range storage.StaleDevices(stats, time.Now(), storage.StaleDeviceAge) {
+		since := time.Unix(d.LastSync, 0).Format(time.DateOnly)
+		diag.Warn(i18n.Sprintf("device %s has not synced since %s; revoke it if it was lost", d.ID, since))
+	}
+}
+
+// syncURLs returns the base URLs of all servers the vault is synced with.
+func (s *shell) syncURLs() []string {
+	return append([]string{s.baseURL}, s.remotes...)
+}
+
+// record appends op on the secret id to the activity log. Failing to write
+// the log is reported but does not fail the command.
+func (s *shell) record(op, id, note string) {
+	if err := s.activity.Record(op, id, note); err != nil {
+		diag.Warn(i18n.Sprintf("failed to write activity log: %s", err))
+	}
+}
+
+// printError reports the error of a command on stderr.
+func printError(err error) {
+	fmt.Fprintln(os.Stderr, output.Error(i18n.Sprintf("Error: %s", err)))
+}
+
+// run executes one command and records it for telemetry. Only the name
+// of known commands is recorded, never their arguments.
+func (s *shell) run(args []string) error {
+	start := time.Now()
+	err := s.dispatch(args)
+	name := args[0]
+	if !slices.Contains(commands, name) {
+		name = "unknown"
+	}
+	s.telemetry.Record(name, time.Since(start), errorClass(err))
+	return err
+}
+
+// dispatch executes one command.
+func (s *shell) dispatch(args []string) error {
+	switch args[0] {
+	case "help":
+		fmt.Println(i18n.Sprintf("Available commands: %s", "help, add, list, list [filters], get <id> [--field path], delete <id> [--force], purge --all-deleted [--force], edit <id>, set <id> [--name n] [--comment c] [--folder f] [--tag t] [--untag t] [--reprompt] [--expires date], clone <id> [--name n] [--edit], alias [<id> <name>] [--rm name], duplicates [--list], conflicts [--list], conflicts resolve <id> local|remote|both, autotype <id> [--delay d] [--no-enter], wifi qr|profile <id>, attachments, templates, template render|watch <file> [-o file], sync, sync log, sync filter, refresh <id> [--force], activity, access-log <id>, stats, fingerprint [--local] [--full], takeout [file], import [--format dotenv] [--prefix folder/] <file>, token [--ttl d], leases, leases renew|revoke <id>, notify [add <kind> <target>|rm <id>], use [server <url>|autosync on|off|output auto|color|plain], renew, tui, exit"))
+	case "add":
+		sec, err := storage.PromptForSecret(s.aead, s.templates)
+		if err != nil {
+			return err
+		}
+		s.ls.Add(sec)
+		if err := s.ls.Save(); err != nil {
+			return i18n.Errorf("failed to save local store: %w", err)
+		}
+		s.record(storage.ActivityAdd, sec.ID, "")
+
+	case "list":
+		return s.list(args[1:])
+
+	case "get":
+		return s.get(args[1:])
+
+	case "delete":
+		return s.delete(args[1:])
+
+	case "purge":
+		return s.purge(args[1:])
+
+	case "edit":
+		if len(args) < 2 {
+			return usageError("edit <id>")
+		}
+		id, err := s.ls.Resolve(args[1], s.aead)
+		if err != nil {
+			return err
+		}
+		if err := s.edit(id); err != nil {
+			return err
+		}
+		s.info(i18n.T("Secret updated"))
+	case "set":
+		return s.set(args[1:])
+	case "clone":
+		return s.clone(args[1:])
+	case "attachments":
+		return s.attachments(args[1:])
+	case "duplicates":
+		return s.duplicates(args[1:])
+	case "conflicts":
+		return s.conflicts(args[1:])
+	case "alias":
+		return s.alias(args[1:])
+	case "autotype":
+		return s.autotype(args[1:])
+	case "wifi":
+		return s.wifi(args[1:])
+	case "templates":
+		s.templates.Print(os.Stdout)
+	case "template":
+		return s.template(args[1:])
+	case "sync":
+		return s.sync(args[1:])
+	case "activity":
+		return s.showActivity(args[1:])
+	case "access-log":
+		return s.accessLog(args[1:])
+	case "stats":
+		// Offline, the composition reported by the last sync is shown
+		summary := s.ls.VaultSummary()
+		if s.offline {
+			if summary == nil {
+				return errOffline
+			}
+			storage.PrintSummary(os.Stdout, summary)
+			return nil
+		}
+		stats, err := storage.FetchStats(s.client, s.baseURL)
+		if err != nil {
+			return i18n.Errorf("failed to fetch stats: %w", err)
+		}
+		storage.PrintStats(os.Stdout, stats)
+		if summary != nil {
+			storage.PrintGroups(os.Stdout, summary)
+		}
+	case "fingerprint":
+		return s.fingerprint(args[1:])
+	case "takeout":
+		return s.takeout(args[1:])
+	case "import":
+		return s.importSecrets(args[1:])
+	case "token":
+		return s.token(args[1:])
+	case "leases":
+		return s.leases(args[1:])
+	case "notify":
+		return s.notify(args[1:])
+	case "use":
+		return s.use(args[1:])
+	case "refresh":
+		return s.refresh(args[1:])
+	case "renew":
+		return s.renew(args[1:])
+	case "tui":
+		return s.tui(args[1:])
+	default:
+		return i18n.Errorf("unknown command %q, type 'help' for a list of commands", args[0])
+	}
+	return nil
+}
+
+// errAborted is returned when the user declines a confirmation prompt.
+var errAborted = i18n.NewError("aborted")
+
+// confirm asks the user to confirm a destructive action. The question
+// should show the name of the secret so the right one is affected. It
+// returns errAborted unless confirmed; force skips the question.
+func (s *shell) confirm(question string, force bool) error {
+	if force {
+		return nil
+	}
+	if !storage.Confirm(question) {
+		return errAborted
+	}
+	return nil
+}
+
+// edit asks for the new data and comment of the secret id and saves it.
+func (s *shell) edit(id string) error {
+	sec := s.ls.Get(id)
+	if sec == nil {
+		return storage.ErrSecretNotFound
+	}
+	raw, comment, err := s.promptEdit(sec.Type)
+	if err != nil {
+		return err
+	}
+	if !s.ls.Edit(id, raw, comment, s.aead) {
+		return storage.ErrSecretNotFound
+	}
+	if err := s.ls.Save(); err != nil {
+		return i18n.Errorf("failed to save local store: %w", err)
+	}
+	s.record(storage.ActivityEdit, id, "")
+	return nil
+}
+
+// promptEdit asks for the new data and comment of a secret of type typ:
+// the fields of its template if it has one, free-form data otherwise. The
+// data must fit the size limit and the payload schema of the type.
+func (s *shell) promptEdit(typ string) (raw []byte, comment string, err error) {
+	if tmpl, ok := s.templates[typ]; ok {
+		raw, comment, err = storage.PromptEditFields(tmpl)
+		if err != nil {
+			return nil, "", err
+		}
+	} else {
+		raw, comment = storage.PromptEditSecret(typ == "text")
+	}
+	if err := limits.CheckContent(typ, raw); err != nil {
+		return nil, "", err
+	}
+	if err := storage.ValidatePayload(typ, raw); err != nil {
+		return nil, "", err
+	}
+	return raw, comment, nil
+}
+
+// reveal asks for the client key passphrase again before the data of a
+// reprompt secret is shown or used, even though the vault is unlocked.
+// Secrets without the flag are revealed without asking. The passphrase is
+// taken from storage.PassphraseEnv if set, so scripts keep working. Keys
+// held by the OS keystore have no passphrase: the master password is asked
+// instead.
+func (s *shell) reveal(sec *storage.Secret) error {
+	if !sec.Reprompt {
+		return nil
+	}
+	if storage.IsKeystoreKeyFile(s.keyFile) {
+		pass, err := storage.ReadPassphrase(i18n.Sprintf("Master password to reveal %s: ", sec.ID))
+		if err != nil {
+			return err
+		}
+		_, err = s.ls.Unlock(pass)
+		return err
+	}
+	pass, ok := os.LookupEnv(storage.PassphraseEnv)
+	if !ok {
+		p, err := storage.ReadPassphrase(i18n.Sprintf("Passphrase to reveal %s: ", sec.ID))
+		if err != nil {
+			return err
+		}
+		pass = string(p)
+	}
+	return storage.VerifyPassphrase(s.keyFile, []byte(pass))
+}
+
+// delete implements the delete command. Deletions sync to all devices, so
+// they have to be confirmed unless --force is given.
+func (s *shell) delete(args []string) error {
+	fs := newFlagSet("delete")
+	force := fs.Bool("force", false, "delete without asking for confirmation")
+	args, err := parseArgs(fs, args)
+	if err != nil || len(args) != 1 {
+		return usageError("delete <id> [--force]")
+	}
+
+	id, err := s.ls.Resolve(args[0], s.aead)
+	if err != nil {
+		return err
+	}
+	sec := s.ls.Get(id)
+	if err := s.confirm(i18n.Sprintf("Delete %s secret %s %q?", sec.Type, sec.ID, storage.DecryptName(s.aead, sec)), *force); err != nil {
+		return err
+	}
+	if err := s.ls.DeleteAttachments(id, s.aead); err != nil {
+		diag.Warn(i18n.Sprintf("failed to delete attachments: %s", err))
+	}
+	if !s.ls.Delete(id) {
+		return storage.ErrSecretNotFound
+	}
+	if err := s.ls.Save(); err != nil {
+		return i18n.Errorf("failed to save local store: %w", err)
+	}
+	s.record(storage.ActivityDelete, id, "")
+	s.info(i18n.T("Secret deleted"))
+	return nil
+}
+
+// set implements the set command, which changes the name, comment, folder
+// or tags of a secret without re-entering its data. --tag and --untag may
+// be repeated.
+func (s *shell) set(args []string) error {
+	var u storage.MetadataUpdate
+	fs := newFlagSet("set")
+	fs.Func("name", "new name", func(v string) error {
+		if strings.TrimSpace(v) == "" {
+			return storage.ErrNameRequired
+		}
+		name, err := storage.EncryptName(s.aead, strings.TrimSpace(v))
+		u.Name = &name
+		return err
+	})
+	comment := fs.String("comment", "", "new comment")
+	folder := fs.String("folder", "", "new folder, empty to remove the secret from its folder")
+	fs.Func("tag", "add a tag", func(v string) error {
+		u.AddTags = append(u.AddTags, v)
+		return nil
+	})
+	fs.Func("untag", "remove a tag", func(v string) error {
+		u.RemoveTags = append(u.RemoveTags, v)
+		return nil
+	})
+	reprompt := fs.Bool("reprompt", false, "ask for the passphrase before revealing the data (--reprompt=false to stop)")
+	fs.Func("expires", "expiry date, YYYY-MM-DD or none", func(v string) error {
+		var at int64
+		if v != "none" {
+			var err error
+			if at, err = storage.ParseTime(v); err != nil {
+				return err
+			}
+		}
+		u.ExpiresAt = &at
+		return nil
+	})
+	args, err := parseArgs(fs, args)
+	if err != nil || len(args) != 1 || fs.NFlag() == 0 {
+		return usageError("set <id> [--name n] [--comment c] [--folder f] [--tag t]... [--untag t]... [--reprompt[=false]] [--expires YYYY-MM-DD|none]")
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "comment":
+			u.Comment = comment
+		case "folder":
+			u.Folder = folder
+		case "reprompt":
+			u.Reprompt = reprompt
+		}
+	})
+
+	id, err := s.ls.Resolve(args[0], s.aead)
+	if err != nil {
+		return err
+	}
+	// Removing the flag reveals the data too
+	if u.Reprompt != nil && !*u.Reprompt {
+		if err := s.reveal(s.ls.Get(id)); err != nil {
+			return err
+		}
+	}
+	if u.Reprompt != nil && *u.Reprompt {
+		if storage.IsUnencryptedKeyFile(s.keyFile) {
+			return storage.ErrKeyNotEncrypted
+		}
+	}
+	if err := s.ls.UpdateMetadata(id, u); err != nil {
+		return err
+	}
+	if err := s.ls.Save(); err != nil {
+		return i18n.Errorf("failed to save local store: %w", err)
+	}
+	s.record(storage.ActivityEdit, id, "metadata")
+	s.info(i18n.T("Secret updated"))
+	return nil
+}
+
+// clone implements the clone command, which copies a secret under a new ID,
+// e.g. to create per-environment variants of credentials. With --edit the
+// copy is edited before it is saved.
+func (s *shell) clone(args []string) error {
+	fs := newFlagSet("clone")
+	edit := fs.Bool("edit", false, "edit the data and comment of the copy")
+	name := fs.String("name", "", "name of the copy (defaults to the original's)")
+	comment := fs.String("comment", "", "comment of the copy (defaults to the original's)")
+	args, err := parseArgs(fs, args)
+	if err != nil || len(args) != 1 {
+		return usageError("clone <id> [--name n] [--comment c] [--edit]")
+	}
+
+	id, err := s.ls.Resolve(args[0], s.aead)
+	if err != nil {
+		return err
+	}
+	clone, err := s.ls.Clone(id, s.aead)
+	if err != nil {
+		return err
+	}
+	var u storage.MetadataUpdate
+	if *name != "" {
+		enc, err := storage.EncryptName(s.aead, *name)
+		if err != nil {
+			return err
+		}
+		u.Name = &enc
+	}
+	if *comment != "" {
+		u.Comment = comment
+	}
+	if u.Name != nil || u.Comment != nil {
+		if err := s.ls.UpdateMetadata(clone.ID, u); err != nil {
+			return err
+		}
+	}
+	if *edit {
+		raw, newComment, err := s.promptEdit(clone.Type)
+		if err != nil {
+			return err
+		}
+		if !s.ls.Edit(clone.ID, raw, newComment, s.aead) {
+			return storage.ErrSecretNotFound
+		}
+	}
+	if err := s.ls.Save(); err != nil {
+		return i18n.Errorf("failed to save local store: %w", err)
+	}
+	s.record(storage.ActivityAdd, clone.ID, "clone of "+id)
+	if s.quiet {
+		fmt.Println(clone.ID)
+	} else {
+		fmt.Println(i18n.Sprintf("Secret cloned: %s", clone.ID))
+	}
+	return nil
+}
+
+// sync implements the sync command: "sync" syncs with the servers now and
+// "sync log" prints the recorded outcomes of past syncs. With --timings
+// both print how long the syncs took in each layer instead. "sync filter"
+// subscribes the device to part of the vault, see syncFilter.
+func (s *shell) sync(args []string) error {
+	if len(args) > 0 && args[0] == "filter" {
+		return s.syncFilter(args[1:])
+	}
+	if len(args) > 0 && args[0] == "log" {
+		fs := newFlagSet("sync log")
+		limit := fs.Int("limit", 20, "print at most this many entries, 0 for all")
+		timings := fs.Bool("timings", false, "print the timings of the syncs")
+		if rest, err := parseArgs(fs, args[1:]); err != nil || len(rest) != 0 {
+			return usageError("sync log [--limit n] [--timings]")
+		}
+		entries, err := storage.ReadSyncLog(syncLogFile, *limit)
+		if err != nil {
+			return i18n.Errorf("failed to read sync log: %w", err)
+		}
+		if len(entries) == 0 {
+			s.info(i18n.T("No syncs recorded"))
+			return nil
+		}
+		if *timings {
+			storage.PrintSyncTimings(os.Stdout, entries)
+		} else {
+			storage.PrintSyncLog(os.Stdout, entries)
+		}
+		return nil
+	}
+	fs := newFlagSet("sync")
+	timings := fs.Bool("timings", false, "print how long the sync took in each layer")
+	if rest, err := parseArgs(fs, args); err != nil || len(rest) != 0 {
+		return usageError("sync [--timings] | sync log [--limit n] [--timings] | sync filter [--folder f] [--tag t] [--clear]")
+	}
+
+	if s.offline {
+		return errOffline
+	}
+	if err := s.retry.Do(func() error {
+		return storage.SyncWithServers(s.client, s.syncURLs(), s.ls)
+	}); err != nil {
+		return err
+	}
+	s.info(i18n.T("Synced"))
+	s.warnConflicts()
+	if *timings {
+		// The sync has just logged one entry per server
+		entries, err := storage.ReadSyncLog(syncLogFile, len(s.syncURLs()))
+		if err != nil {
+			return i18n.Errorf("failed to read sync log: %w", err)
+		}
+		storage.PrintSyncTimings(os.Stdout, entries)
+	}
+	return nil
+}
+
+// syncFilter implements "sync filter": without flags it prints the part of
+// the vault the device is subscribed to, with --folder and --tag it
+// subscribes the device to the secrets in those folders or with those tags
+// and with --clear to the whole vault again. Secrets outside the filter
+// are dropped from the local store with the next sync.
+func (s *shell) syncFilter(args []string) error {
+	fs := newFlagSet("sync filter")
+	var f storage.SyncFilter
+	fs.Func("folder", "sync the secrets in this folder and its subfolders", func(v string) error {
+		f.Folders = append(f.Folders, v)
+		return nil
+	})
+	fs.Func("tag", "sync the secrets with this tag", func(v string) error {
+		f.Tags = append(f.Tags, v)
+		return nil
+	})
+	clearFilter := fs.Bool("clear", false, "sync the whole vault")
+	if rest, err := parseArgs(fs, args); err != nil || len(rest) != 0 || (*clearFilter && !f.Empty()) {
+		return usageError("sync filter [--folder f]... [--tag t]... | sync filter --clear")
+	}
+	if !*clearFilter && f.Empty() {
+		fmt.Println(i18n.Sprintf("Syncing: %s", describeFilter(s.ls.Filter())))
+		return nil
+	}
+
+	s.ls.SetFilter(f)
+	if err := s.ls.Save(); err != nil {
+		return i18n.Errorf("failed to save local store: %w", err)
+	}
+	s.info(i18n.Sprintf("Syncing: %s", describeFilter(f)))
+	return nil
+}
+
+// describeFilter describes f for "sync filter".
+func describeFilter(f storage.SyncFilter) string {
+	if f.Empty() {
+		return i18n.T("whole vault")
+	}
+	return f.String()
+}
+
+// get implements the get command. With --field it prints only the
+// decrypted value at the given payload path, for use in scripts.
+func (s *shell) get(args []string) error {
+	fs := newFlagSet("get")
+	field := fs.String("field", "", "print only this payload field (e.g. password or data.url)")
+	args, err := parseArgs(fs, args)
+	if err != nil || len(args) != 1 {
+		return usageError("get <id> [--field path]")
+	}
+
+	id, err := s.ls.Resolve(args[0], s.aead)
+	if err != nil {
+		return err
+	}
+	sec := s.ls.Get(id)
+	if err := s.reveal(sec); err != nil {
+		return err
+	}
+	s.record(storage.ActivityView, id, *field)
+	if *field == "" {
+		storage.PrintSecret(os.Stdout, sec, s.aead)
+		return nil
+	}
+
+	plain, err := storage.Decrypt(s.aead, sec.Data)
+	if err != nil {
+		return i18n.Errorf("failed to decrypt secret: %w", err)
+	}
+	value, err := storage.ExtractField(plain, *field)
+	if err != nil {
+		return err
+	}
+	fmt.Println(value)
+	return nil
+}
+
+// list implements the list command with its filter and sort flags.
+func (s *shell) list(args []string) error {
+	var opts storage.ListOptions
+	var since string
+	fs := newFlagSet("list")
+	fs.StringVar(&opts.Type, "type", "", "only secrets of this type")
+	fs.StringVar(&since, "since", "", "only secrets modified since this date (YYYY-MM-DD or RFC 3339)")
+	fs.BoolVar(&opts.Deleted, "deleted", false, "show deleted secrets")
+	fs.StringVar(&opts.Grep, "grep", "", "only secrets whose name, comment or data contain this text")
+	fs.StringVar(&opts.Sort, "sort", "", "sort by name, comment or modified (newest first)")
+	fs.IntVar(&opts.Limit, "limit", 0, "print at most this many secrets")
+	fs.IntVar(&opts.Offset, "offset", 0, "skip this many secrets")
+	fs.BoolVar(&opts.Long, "long", false, "print secrets in full, including decrypted data")
+	args, err := parseArgs(fs, args)
+	if err != nil || len(args) != 0 {
+		return usageError("list [--type t] [--since date] [--deleted] [--grep text] [--sort name|comment|modified] [--limit n] [--offset n] [--long]")
+	}
+	if opts.Sort != "" && opts.Sort != "name" && opts.Sort != "comment" && opts.Sort != "modified" {
+		return i18n.NewError("unknown sort order, use name, comment or modified")
+	}
+	if since != "" {
+		if opts.Since, err = storage.ParseTime(since); err != nil {
+			return err
+		}
+	}
+	withPager(func(w io.Writer) {
+		s.ls.List(w, s.aead, opts)
+	})
+	return nil
+}
+
+// showActivity implements the activity command, which prints the recent
+// local operations on the vault.
+func (s *shell) showActivity(args []string) error {
+	fs := newFlagSet("activity")
+	limit := fs.Int("limit", 20, "print at most this many entries, 0 for all")
+	if rest, err := parseArgs(fs, args); err != nil || len(rest) != 0 {
+		return usageError("activity [--limit n]")
+	}
+	entries, err := s.activity.Read(*limit)
+	if err != nil {
+		return i18n.Errorf("failed to read activity log: %w", err)
+	}
+	if len(entries) == 0 {
+		s.info(i18n.T("No activity recorded"))
+		return nil
+	}
+	storage.PrintActivity(os.Stdout, entries, s.ls, s.aead)
+	return nil
+}
+
+// takeout implements the takeout command, which saves everything the server
+// stores about the user to a file. The file holds the metadata of secrets
+// in the clear and is created readable by the user only.
+func (s *shell) takeout(args []string) error {
+	if len(args) > 1 {
+		return usageError("takeout [file]")
+	}
+	if s.offline {
+		return errOffline
+	}
+	path := "gophkeeper-export.json"
+	if len(args) == 1 {
+		path = args[0]
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return i18n.Errorf("failed to export data: %w", err)
+	}
+	n, err := storage.Takeout(s.client, s.baseURL, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return i18n.Errorf("failed to export data: %w", err)
+	}
+	s.info(i18n.Sprintf("Exported %d secrets to %s", n, path))
+	return nil
+}
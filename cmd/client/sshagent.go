@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+	"github.com/atinyakov/GophKeeper/internal/sshagent"
+)
+
+// sshAgent serves the ssh-key secrets of the vault over the ssh-agent
+// protocol until SIGINT or SIGTERM, so that ssh can use them without the
+// private keys being written to disk. The socket is created readable by
+// the user only and removed on exit; by default it is placed in a new
+// directory accessible only to the user.
+func (s *shell) sshAgent(args []string) error {
+	fs := newFlagSet("ssh-agent")
+	socket := fs.String("socket", "", "path of the agent socket (defaults to a new private directory)")
+	if rest, err := parseArgs(fs, args); err != nil || len(rest) != 0 {
+		return usageError("ssh-agent [--socket path]")
+	}
+
+	keys, ids, errs := s.ls.SSHKeys(s.aead)
+	for _, err := range errs {
+		diag.Warn(i18n.Sprintf("skipping SSH key: %s", err))
+	}
+	if len(keys) == 0 {
+		return i18n.NewError("no usable ssh-key secrets in the vault")
+	}
+	// The passphrase is asked once for all reprompt keys
+	for _, id := range ids {
+		if sec := s.ls.Get(id); sec.Reprompt {
+			if err := s.reveal(sec); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	agent, err := sshagent.New(keys)
+	if err != nil {
+		return err
+	}
+	agent.OnSign = func(i int) {
+		s.record(storage.ActivityView, ids[i], "ssh-agent sign")
+	}
+
+	path := *socket
+	if path == "" {
+		dir, err := os.MkdirTemp("", "gophkeeper-agent-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(dir)
+		path = filepath.Join(dir, "agent.sock")
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return i18n.Errorf("failed to listen on %s: %w", path, err)
+	}
+	defer os.Remove(path)
+	if err := os.Chmod(path, 0o600); err != nil {
+		return err
+	}
+
+	fmt.Printf("SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", path)
+	s.info(i18n.Sprintf("Serving %d SSH keys, stop with Ctrl-C", len(keys)))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return agent.Serve(ctx, l)
+}
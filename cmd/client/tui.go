@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/atinyakov/GophKeeper/internal/client/clipboard"
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+	"github.com/atinyakov/GophKeeper/internal/client/tui"
+)
+
+// tui implements the tui command, a full-screen interface to search,
+// view, copy and edit secrets, see the tui package.
+func (s *shell) tui(args []string) error {
+	if len(args) != 0 {
+		return usageError("tui")
+	}
+	backend, clipErr := clipboard.Detect(os.Stdout)
+	copyText := func(text string) error {
+		if clipErr != nil {
+			return clipErr
+		}
+		if err := backend.Copy(text); err != nil {
+			return i18n.Errorf("failed to copy to the clipboard: %w", err)
+		}
+		return nil
+	}
+	err := tui.Run(os.Stdin, os.Stdout, &tuiVault{s: s}, copyText)
+	if errors.Is(err, storage.ErrNotTerminal) {
+		return i18n.NewError("the tui command needs a terminal")
+	}
+	return err
+}
+
+// tuiVault is the vault browsed by the tui command.
+type tuiVault struct {
+	s *shell
+	// viewed is the ID of the secret whose data was shown last, so that
+	// showing it is recorded once rather than on every redraw.
+	viewed string
+}
+
+func (v *tuiVault) Items(query string) []tui.Item {
+	secrets := v.s.ls.Select(v.s.aead, storage.ListOptions{Grep: query, Sort: "name"})
+	items := make([]tui.Item, len(secrets))
+	for i, sec := range secrets {
+		name := storage.DecryptName(v.s.aead, &sec)
+		items[i] = tui.Item{ID: sec.ID, Type: sec.Type, Name: name, Folder: sec.Folder, Hidden: sec.Reprompt}
+	}
+	return items
+}
+
+func (v *tuiVault) Detail(id string, reveal bool) string {
+	sec := v.s.ls.Get(id)
+	if sec == nil {
+		return storage.ErrSecretNotFound.Error()
+	}
+	var b strings.Builder
+	if !reveal {
+		storage.PrintSecretHidden(&b, sec, v.s.aead, i18n.T("(hidden, press ENTER to reveal)"))
+		return b.String()
+	}
+	if id != v.viewed {
+		v.viewed = id
+		v.s.record(storage.ActivityView, id, "tui")
+	}
+	storage.PrintSecret(&b, sec, v.s.aead)
+	return b.String()
+}
+
+func (v *tuiVault) Reveal(id string) error {
+	sec := v.s.ls.Get(id)
+	if sec == nil {
+		return storage.ErrSecretNotFound
+	}
+	return v.s.reveal(sec)
+}
+
+func (v *tuiVault) Credentials(id string) (login, password string, err error) {
+	sec := v.s.ls.Get(id)
+	if sec == nil {
+		return "", "", storage.ErrSecretNotFound
+	}
+	plain, err := storage.Decrypt(v.s.aead, sec.Data)
+	if err != nil {
+		return "", "", i18n.Errorf("failed to decrypt secret: %w", err)
+	}
+	v.s.record(storage.ActivityView, id, "copy")
+	return storage.Credentials(plain)
+}
+
+func (v *tuiVault) Rename(id, name string) error {
+	enc, err := storage.EncryptName(v.s.aead, name)
+	if err != nil {
+		return err
+	}
+	if err := v.s.ls.UpdateMetadata(id, storage.MetadataUpdate{Name: &enc}); err != nil {
+		return err
+	}
+	if err := v.s.ls.Save(); err != nil {
+		return i18n.Errorf("failed to save local store: %w", err)
+	}
+	v.s.record(storage.ActivityEdit, id, "metadata")
+	return nil
+}
+
+func (v *tuiVault) Edit(id string) error {
+	return v.s.edit(id)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/output"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+const useUsage = "use | use server <url> | use autosync on|off | use output auto|color|plain"
+
+// use implements the use command, which changes the settings of the
+// client without restarting it: "use server <url>" switches to another
+// server, "use autosync on|off" starts or stops syncing in the background
+// and "use output <format>" changes the output format. Changes are saved
+// to configFile and apply to later sessions too. Without arguments it
+// prints the current settings.
+func (s *shell) use(args []string) error {
+	if len(args) == 0 {
+		fmt.Println(i18n.Sprintf("Server: %s", s.baseURL))
+		fmt.Println(i18n.Sprintf("Auto-sync: %s", onOff(s.stopSync != nil)))
+		fmt.Println(i18n.Sprintf("Output: %s", cmp.Or(s.config.Output, storage.OutputAuto)))
+		return nil
+	}
+	if len(args) != 2 {
+		return usageError(useUsage)
+	}
+
+	switch args[0] {
+	case "server":
+		u, err := storage.ParseServerURL(args[1])
+		if err != nil {
+			return err
+		}
+		if !s.offline {
+			if err := compatibleServer(s.client, u); err != nil {
+				return i18n.Errorf("%w, staying on %s", err, s.baseURL)
+			}
+		}
+		s.baseURL = u
+		s.config.URL = u
+		// Restart the background syncs with the new server
+		if s.stopSync != nil {
+			s.stopAutoSync()
+			s.startAutoSync()
+		}
+		s.info(i18n.Sprintf("Using server %s", u))
+	case "autosync":
+		on := args[1] == "on"
+		if !on && args[1] != "off" {
+			return usageError(useUsage)
+		}
+		if on && s.stopSync == nil {
+			if s.offline {
+				return errOffline
+			}
+			if err := compatibleServer(s.client, s.baseURL); err != nil {
+				return err
+			}
+			s.startAutoSync()
+		}
+		if !on {
+			s.stopAutoSync()
+		}
+		s.config.AutoSync = &on
+		s.info(i18n.Sprintf("Auto-sync: %s", onOff(on)))
+	case "output":
+		if !slices.Contains(storage.OutputFormats, args[1]) {
+			return i18n.Errorf("unknown output format %q, use %s", args[1], strings.Join(storage.OutputFormats, ", "))
+		}
+		setOutput(args[1])
+		s.config.Output = args[1]
+		s.info(i18n.Sprintf("Output: %s", args[1]))
+	default:
+		return usageError(useUsage)
+	}
+
+	if err := s.config.Save(configFile); err != nil {
+		return i18n.Errorf("failed to save client config: %w", err)
+	}
+	return nil
+}
+
+// startAutoSync starts syncing with the servers in the background, until
+// stopAutoSync is called.
+func (s *shell) startAutoSync() {
+	ctx, cancel := context.WithCancel(context.Background())
+	storage.StartAutoSync(ctx, s.client, s.syncURLs(), s.ls, s.retry)
+	s.stopSync = cancel
+}
+
+// stopAutoSync stops syncing in the background, if it was started. A sync
+// in progress is completed.
+func (s *shell) stopAutoSync() {
+	if s.stopSync != nil {
+		s.stopSync()
+		s.stopSync = nil
+	}
+}
+
+// setOutput applies an output format, one of storage.OutputFormats.
+func setOutput(format string) {
+	switch format {
+	case storage.OutputColor:
+		output.SetColor(true)
+	case storage.OutputPlain:
+		output.SetColor(false)
+	default:
+		output.SetColor(output.DetectColor(false, os.Stdout))
+	}
+}
+
+// onOff describes a setting that is on or off.
+func onOff(on bool) string {
+	if on {
+		return i18n.T("on")
+	}
+	return i18n.T("off")
+}
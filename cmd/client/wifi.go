@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+const wifiUsage = `
+  wifi qr <id>                                      show the network as a QR code, drawn with qrencode if installed, else as text
+  wifi profile <id> --format nm|mobileconfig|windows [--out file]  export an OS network profile`
+
+// wifi implements the wifi command for secrets of the wifi type.
+func (s *shell) wifi(args []string) error {
+	fs := newFlagSet("wifi")
+	format := fs.String("format", "", "profile format: "+strings.Join(storage.WiFiProfileFormats, ", "))
+	out := fs.String("out", "", "write the profile to this file instead of stdout")
+	args, err := parseArgs(fs, args)
+	if err != nil || len(args) != 2 || (args[0] != "qr" && args[0] != "profile") {
+		return usageError(wifiUsage)
+	}
+
+	id, err := s.ls.Resolve(args[1], s.aead)
+	if err != nil {
+		return err
+	}
+	sec := s.ls.Get(id)
+	if sec.Type != "wifi" {
+		return i18n.Errorf("secret %s is of type %s, not wifi", id, sec.Type)
+	}
+	if err := s.reveal(sec); err != nil {
+		return err
+	}
+	plain, err := storage.Decrypt(s.aead, sec.Data)
+	if err != nil {
+		return i18n.Errorf("failed to decrypt secret: %w", err)
+	}
+	w, err := storage.ParseWiFi(plain)
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "qr" {
+		s.record(storage.ActivityView, id, "wifi qr")
+		printQR(w.QRString())
+		return nil
+	}
+	if *format == "" {
+		return usageError(wifiUsage)
+	}
+	profile, err := w.Profile(*format)
+	if err != nil {
+		return err
+	}
+	s.record(storage.ActivityView, id, "wifi profile "+*format)
+	if *out == "" {
+		_, err = os.Stdout.Write(profile)
+		return err
+	}
+	// The profile holds the password in the clear
+	if err := os.WriteFile(*out, profile, 0o600); err != nil {
+		return i18n.Errorf("failed to write profile: %w", err)
+	}
+	s.info(i18n.Sprintf("Profile saved to %s", *out))
+	return nil
+}
+
+// printQR prints text as a QR code drawn with qrencode when it is
+// installed and stdout is a terminal, and text itself otherwise, e.g. to
+// be piped into a QR generator.
+func printQR(text string) {
+	if isTerminal(os.Stdout) {
+		if path, err := exec.LookPath("qrencode"); err == nil {
+			// Text is passed on stdin to keep it out of the process list
+			cmd := exec.Command(path, "-t", "UTF8")
+			cmd.Stdin = strings.NewReader(text)
+			cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+			if cmd.Run() == nil {
+				return
+			}
+		}
+	}
+	fmt.Println(text)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/certgen"
+	"github.com/atinyakov/GophKeeper/internal/config"
+	"github.com/atinyakov/GophKeeper/internal/db"
+	"github.com/atinyakov/GophKeeper/internal/rediscache"
+)
+
+// checkTimeout bounds the database checks of -check.
+const checkTimeout = 30 * time.Second
+
+// certExpiryWarning is how long before its expiry -check warns that the
+// server certificate needs to be renewed.
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// selfCheck implements -check: it validates the configuration, connects to
+// the database and checks that its schema is up to date, and verifies that
+// the TLS files parse and chain to the CA, writing one line per check to
+// w. Nothing is changed, not even the schema. It reports whether all
+// checks passed.
+func selfCheck(w io.Writer, options *config.Options) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+
+	ok := true
+	report := func(name string, err error, detail string) {
+		switch {
+		case err != nil:
+			ok = false
+			fmt.Fprintf(w, "FAIL  %s: %s\n", name, strings.ReplaceAll(err.Error(), "\n", "\n      "))
+		case detail != "":
+			fmt.Fprintf(w, "ok    %s (%s)\n", name, detail)
+		default:
+			fmt.Fprintf(w, "ok    %s\n", name)
+		}
+	}
+
+	err := options.Validate()
+	if err == nil && options.KMS != "" {
+		_, err = keyWrapper(options)
+	}
+	if err == nil && options.RedisURL != "" {
+		var cache *rediscache.Client
+		if cache, err = rediscache.New(options.RedisURL); err == nil {
+			_ = cache.Close()
+		}
+	}
+	report("configuration", err, "")
+
+	conn, err := db.Connect(ctx, options.DatabaseDSN)
+	report("database connection", err, "")
+	if err == nil {
+		defer conn.Close()
+		err = db.CheckSchema(ctx, conn)
+		if err != nil {
+			err = fmt.Errorf("%w; start the server once to apply it", err)
+		}
+		report("database schema", err, "")
+	} else {
+		fmt.Fprintln(w, "skip  database schema: no database connection")
+	}
+
+	cert, err := certgen.CheckServerCredentials(serverCertFile, serverKeyFile, caCertFile, caKeyFile, time.Now())
+	var detail string
+	if err == nil {
+		detail = fmt.Sprintf("%s, valid until %s", cert.Subject.CommonName, cert.NotAfter.Format(time.DateOnly))
+		if time.Until(cert.NotAfter) < certExpiryWarning {
+			detail += ", renew it soon"
+		}
+	}
+	report("TLS files", err, detail)
+
+	return ok
+}
@@ -14,11 +14,22 @@ import (
 
 	nethttp "net/http"
 
+	"github.com/atinyakov/GophKeeper/internal/awssig"
+	"github.com/atinyakov/GophKeeper/internal/blobstore"
+	"github.com/atinyakov/GophKeeper/internal/buildinfo"
+	"github.com/atinyakov/GophKeeper/internal/certgen"
 	"github.com/atinyakov/GophKeeper/internal/config"
 	"github.com/atinyakov/GophKeeper/internal/db"
+	"github.com/atinyakov/GophKeeper/internal/envelope"
 	"github.com/atinyakov/GophKeeper/internal/logger"
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/notify"
+	"github.com/atinyakov/GophKeeper/internal/pow"
+	"github.com/atinyakov/GophKeeper/internal/rediscache"
 	"github.com/atinyakov/GophKeeper/internal/repository"
+	"github.com/atinyakov/GophKeeper/internal/server/handler/grpc"
 	"github.com/atinyakov/GophKeeper/internal/server/handler/http"
+	"github.com/atinyakov/GophKeeper/internal/server/webui"
 	"github.com/atinyakov/GophKeeper/internal/service"
 	"go.uber.org/zap"
 )
@@ -30,15 +41,38 @@ var (
 	buildDate string
 )
 
+// TLS files of the server, relative to its working directory. The CA key
+// signs the certificates issued to users.
+const (
+	serverCertFile = "certs/server.crt"
+	serverKeyFile  = "certs/server.key"
+	caCertFile     = "certs/ca.crt"
+	caKeyFile      = "certs/ca.key"
+)
+
 func main() {
 	// Parse command-line and environment configuration.
 	options := config.Parse()
 	addr := options.Port
 	dbName := options.DatabaseDSN
 
-	// Print build metadata (or "N/A" if unset).
-	fmt.Printf("Build version: %s\n", cmp.Or(version, "N/A"))
-	fmt.Printf("Build date: %s\n", cmp.Or(buildDate, "N/A"))
+	// Print build metadata (or "N/A" if unset). Builds without ldflags
+	// fall back to the metadata embedded by the go command.
+	build := buildinfo.Read(version, buildDate)
+	fmt.Printf("Build version: %s\n", cmp.Or(build.Version, "N/A"))
+	fmt.Printf("Build date: %s\n", cmp.Or(build.BuildDate, "N/A"))
+	fmt.Printf("Go version: %s\n", build.GoVersion)
+	if build.Revision != "" {
+		fmt.Printf("Revision: %s\n", build.Revision)
+	}
+
+	// Check the deployment instead of serving with -check
+	if options.Check {
+		if !selfCheck(os.Stdout, options) {
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Initialize structured logging.
 	log := logger.New()
@@ -55,35 +89,168 @@ func main() {
 	}
 
 	// Initialize PostgreSQL clean
-	db.StartSoftDeleteCleaner(context.Background(), postgressDB,
-		time.Hour,       // interval
-		30*24*time.Hour, // retention: 30 days
-		zapLogger,
-	)
+	cleaner := db.NewSoftDeleteCleaner(postgressDB, options.Retention, zapLogger)
+	cleaner.BatchSize = options.CleanerBatchSize
+	cleaner.DryRun = options.CleanerDryRun
+	cleaner.Start(context.Background(), options.CleanerInterval)
 
-	// Initialize repositories for authentication and synchronization.
+	// Initialize repositories for authentication and synchronization. Their
+	// queries are counted and slow ones logged.
+	queries := &repository.QueryMetrics{Log: zapLogger, SlowThreshold: options.SlowQuery}
 	authRepo := repository.NewPostgresAuthRepository(postgressDB)
+	authRepo.Hook = queries
 	syncRepo := repository.NewPostgresSyncRepostitory(postgressDB)
+	syncRepo.Hook = queries
+	auditRepo := repository.NewPostgresAuditRepository(postgressDB)
+	auditRepo.Hook = queries
+	if options.S3Endpoint != "" {
+		syncRepo.Blobs = blobstore.NewS3(blobstore.S3Config{
+			Endpoint:  options.S3Endpoint,
+			Bucket:    options.S3Bucket,
+			Region:    options.S3Region,
+			AccessKey: options.S3AccessKey,
+			SecretKey: options.S3SecretKey,
+		})
+		syncRepo.BlobThreshold = options.BlobThreshold
+	}
+	if options.KMS != "" {
+		wrapper, err := keyWrapper(options)
+		if err != nil {
+			zapLogger.Fatal("cannot init key service", zap.Error(err))
+		}
+		keyRepo := repository.NewPostgresDataKeyRepository(postgressDB)
+		keyRepo.Hook = queries
+		syncRepo.Sealer, err = envelope.Open(context.Background(), wrapper, keyRepo, options.RotateKeys)
+		if err != nil {
+			zapLogger.Fatal("cannot load data keys", zap.Error(err))
+		}
+	}
+
+	// Scan the stored secrets for violated invariants
+	var integrity *repository.IntegrityScanner
+	if options.IntegrityInterval > 0 {
+		integrity = repository.NewIntegrityScanner(syncRepo, auditRepo, zapLogger)
+		integrity.Start(context.Background(), options.IntegrityInterval)
+	}
+
+	// Initialize notifications and the scheduler of expiry notifications.
+	notificationRepo := repository.NewPostgresNotificationRepository(postgressDB)
+	notificationRepo.Hook = queries
+	notifyClient := notify.NewHTTPClient(options.NotifyAllowPrivate)
+	notifier := &notify.Notifier{
+		Channels: notificationRepo,
+		Senders: map[string]notify.Sender{
+			notify.KindWebhook: notify.Webhook{Client: notifyClient},
+			notify.KindNtfy:    notify.Ntfy{Client: notifyClient},
+		},
+		Log: zapLogger,
+	}
+	if options.SMTPAddr != "" {
+		notifier.Senders[notify.KindEmail] = &notify.Email{
+			Addr:     options.SMTPAddr,
+			From:     options.SMTPFrom,
+			Username: options.SMTPUsername,
+			Password: options.SMTPPassword,
+		}
+	}
+	if options.NotifyInterval > 0 {
+		notify.NewScheduler(notificationRepo, notifier, options.NotifyHorizon, certgen.UserCertValidity, zapLogger).
+			Start(context.Background(), options.NotifyInterval)
+	}
 
 	// Initialize business-logic services.
 	authService := service.NewAuthService(authRepo)
 	syncService := service.NewSyncService(syncRepo)
+	accountService := service.NewAccountService(syncRepo)
+	if options.RedisURL != "" {
+		redisClient, err := rediscache.New(options.RedisURL)
+		if err != nil {
+			zapLogger.Fatal("cannot init redis cache", zap.Error(err))
+		}
+		defer redisClient.Close()
+		syncCache := &rediscache.SyncCache{Client: redisClient, TTL: options.RedisTTL}
+		syncService.SetCache(syncCache)
+		accountService.SetCache(syncCache)
+	}
 
 	// Create HTTP handlers for auth and sync endpoints.
-	authHandler := &http.AuthHandler{AuthService: authService}
+	authHandler := &http.AuthHandler{AuthService: authService, Notifier: notifier}
+	if options.RegisterMaxFailures > 0 {
+		authHandler.Guard = service.NewRegistrationGuard(auditRepo,
+			options.RegisterMaxFailures, options.RegisterBan, options.RegisterBanMax)
+	}
+	if options.RegisterPoWBits > 0 {
+		challenges, err := pow.NewIssuer(options.RegisterPoWBits, 5*time.Minute)
+		if err != nil {
+			zapLogger.Fatal("cannot init registration challenges", zap.Error(err))
+		}
+		authHandler.Challenges = challenges
+	}
 	syncHandler := &http.SyncHandler{SyncService: syncService}
 
-	// Build the router with middleware and routes.
-	router := http.NewRouter(authHandler, syncHandler, zapLogger)
+	// Build the router with middleware and routes. When client certificates
+	// are required at the TLS layer, registration moves to its own listener.
+	clientAuth := tls.VerifyClientCertIfGiven
+	seen := service.NewSeenTracker(syncRepo, time.Minute)
+	routerOpts := []http.RouterOption{
+		http.WithVersion(&http.VersionHandler{
+			Version:          build.Version,
+			BuildDate:        build.BuildDate,
+			GoVersion:        build.GoVersion,
+			Revision:         build.Revision,
+			Modified:         build.Modified,
+			MinClientVersion: options.MinClientVersion,
+		}),
+		http.WithCertBinding(authService),
+		http.WithLastSeen(seen),
+		http.WithSyncConcurrency(options.SyncConcurrency),
+	}
+	if options.RequireClientCert {
+		clientAuth = tls.RequireAndVerifyClientCert
+		routerOpts = append(routerOpts, http.WithoutRegister())
+	}
+	var corsOpts []http.RouterOption
+	if len(options.CORSAllowedOrigins) > 0 {
+		corsOpts = append(corsOpts, http.WithCORS(middleware.CORSConfig{
+			AllowedOrigins: options.CORSAllowedOrigins,
+			AllowedMethods: options.CORSAllowedMethods,
+			AllowedHeaders: options.CORSAllowedHeaders,
+		}))
+		routerOpts = append(routerOpts, corsOpts...)
+	}
+	if options.WebUI {
+		sessionRepo := repository.NewPostgresSessionRepository(postgressDB)
+		sessionRepo.Hook = queries
+		sessionService := service.NewSessionService(sessionRepo, options.SessionTTL)
+		db.StartExpiredSessionCleaner(context.Background(), postgressDB, time.Hour, zapLogger)
+
+		routerOpts = append(routerOpts,
+			http.WithWebUI(webui.Handler()),
+			http.WithSessions(&http.SessionHandler{SessionService: sessionService}),
+		)
+	}
+	exportService := service.NewExportService(syncRepo, auditRepo)
+	routerOpts = append(routerOpts, http.WithExport(&http.ExportHandler{ExportService: exportService}))
+	notificationService := service.NewNotificationService(notificationRepo, notifier.Kinds())
+	routerOpts = append(routerOpts, http.WithNotifications(&http.NotificationHandler{NotificationService: notificationService}))
+	routerOpts = append(routerOpts, http.WithAccounts(&http.AccountHandler{AccountService: accountService}))
+	router := http.NewRouter(authHandler, syncHandler, zapLogger, routerOpts...)
+
+	// Serve the gRPC API on the same listeners as the HTTP API
+	grpcServer := grpc.NewServer(authHandler, syncHandler, zapLogger,
+		grpc.WithCertBinding(authService),
+		grpc.WithLastSeen(seen),
+		grpc.WithSyncConcurrency(options.SyncConcurrency),
+	)
 
 	// Load server TLS certificate and key.
-	cert, err := tls.LoadX509KeyPair("certs/server.crt", "certs/server.key")
+	cert, err := tls.LoadX509KeyPair(serverCertFile, serverKeyFile)
 	if err != nil {
 		zapLogger.Fatal("failed to load server TLS cert/key", zap.Error(err))
 	}
 
 	// Load and append CA certificate for client cert verification.
-	caCert, err := os.ReadFile("certs/ca.crt")
+	caCert, err := os.ReadFile(caCertFile)
 	if err != nil {
 		zapLogger.Fatal("failed to read CA cert", zap.Error(err))
 	}
@@ -95,7 +262,7 @@ func main() {
 	// Configure TLS to require or verify client certificates.
 	tlsConfig := &tls.Config{
 		Certificates: []tls.Certificate{cert},
-		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientAuth:   clientAuth,
 		ClientCAs:    caCertPool,
 		MinVersion:   tls.VersionTLS12,
 	}
@@ -103,12 +270,79 @@ func main() {
 	// Create and start the HTTPS server.
 	server := &nethttp.Server{
 		Addr:      addr,
-		Handler:   router,
+		Handler:   grpc.Handler(grpcServer, router),
 		TLSConfig: tlsConfig,
 	}
 
+	// Serve registration on a separate listener that does not demand
+	// client certificates; a certificate given is verified, so that users
+	// can enroll further devices.
+	if options.RequireClientCert {
+		registerRouter := http.NewRegisterRouter(authHandler, zapLogger, corsOpts...)
+		registerServer := &nethttp.Server{
+			Addr:    options.RegisterAddr,
+			Handler: grpc.Handler(grpc.NewRegisterServer(authHandler, zapLogger), registerRouter),
+			TLSConfig: &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				ClientAuth:   tls.VerifyClientCertIfGiven,
+				ClientCAs:    caCertPool,
+				MinVersion:   tls.VersionTLS12,
+			},
+		}
+		go func() {
+			zapLogger.Info("starting registration HTTPS server", zap.String("addr", options.RegisterAddr))
+			if err := registerServer.ListenAndServeTLS("", ""); err != nil {
+				zapLogger.Fatal("failed to start registration HTTPS server", zap.Error(err))
+			}
+		}()
+	}
+
+	// Serve the operator endpoints over plain HTTP on a private address.
+	if options.AdminAddr != "" {
+		adminHandler := &http.AdminHandler{Cleaner: cleaner, Accounts: accountService, Queries: queries}
+		if integrity != nil {
+			adminHandler.Integrity = integrity
+		}
+		adminServer := &nethttp.Server{
+			Addr:    options.AdminAddr,
+			Handler: http.NewAdminRouter(adminHandler, zapLogger),
+		}
+		go func() {
+			zapLogger.Info("starting admin HTTP server", zap.String("addr", options.AdminAddr))
+			if err := adminServer.ListenAndServe(); err != nil {
+				zapLogger.Fatal("failed to start admin HTTP server", zap.Error(err))
+			}
+		}()
+	}
+
 	zapLogger.Info("starting HTTPS server", zap.String("addr", addr))
 	if err := server.ListenAndServeTLS("", ""); err != nil {
 		zapLogger.Fatal("failed to start HTTPS server", zap.Error(err))
 	}
 }
+
+// keyWrapper returns the key encryption key service selected by options.
+func keyWrapper(options *config.Options) (envelope.KeyWrapper, error) {
+	switch options.KMS {
+	case "local":
+		return envelope.ParseLocalKeys(options.MasterKeys)
+	case "vault":
+		return &envelope.VaultTransit{
+			Addr:  options.VaultAddr,
+			Token: options.VaultToken,
+			Mount: options.VaultTransitMount,
+			Key:   options.VaultTransitKey,
+		}, nil
+	case "awskms":
+		return &envelope.AWSKMS{
+			Key:    options.KMSKey,
+			Region: options.KMSRegion,
+			Credentials: awssig.Credentials{
+				AccessKey: options.KMSAccessKey,
+				SecretKey: options.KMSSecretKey,
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown key service %q, want local, vault or awskms", options.KMS)
+	}
+}
@@ -0,0 +1,22 @@
+// Package blobstore stores large secret payloads outside the database, in
+// S3-compatible object storage.
+package blobstore
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned by Get for keys that are not stored.
+var ErrNotFound = errors.New("blob not found")
+
+// Store holds blobs by key.
+type Store interface {
+	// Put stores data under key, replacing any previous blob.
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns the blob stored under key, or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete removes the blob stored under key. Deleting a missing blob
+	// is not an error.
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,122 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/awssig"
+)
+
+// S3Config configures an S3-compatible object store, e.g. AWS S3 or MinIO.
+type S3Config struct {
+	// Endpoint is the base URL of the service, e.g.
+	// https://s3.eu-central-1.amazonaws.com or http://localhost:9000.
+	Endpoint string
+	// Bucket holds the blobs; it must exist.
+	Bucket string
+	// Region is the signing region, e.g. us-east-1.
+	Region string
+	// AccessKey and SecretKey are the credentials requests are signed with.
+	AccessKey string
+	SecretKey string
+}
+
+// S3 is a Store in an S3 bucket, addressed path-style so that it works with
+// any S3-compatible service.
+type S3 struct {
+	cfg    S3Config
+	client *http.Client
+}
+
+// NewS3 returns the Store in the bucket described by cfg.
+func NewS3(cfg S3Config) *S3 {
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	return &S3{cfg: cfg, client: &http.Client{Timeout: time.Minute}}
+}
+
+// Put implements Store.
+func (s *S3) Put(ctx context.Context, key string, data []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("put", key, resp)
+	}
+	return nil
+}
+
+// Get implements Store.
+func (s *S3) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("s3 get %s: %w", key, err)
+		}
+		return data, nil
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("s3 get %s: %w", key, ErrNotFound)
+	default:
+		return nil, s3Error("get", key, resp)
+	}
+}
+
+// Delete implements Store.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error("delete", key, resp)
+	}
+	return nil
+}
+
+// do sends a signed request for the object key.
+func (s *S3) do(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	u := s.cfg.Endpoint + "/" + url.PathEscape(s.cfg.Bucket) + "/" + escapeKey(key)
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	awssig.Sign(req, body, awssig.Credentials{AccessKey: s.cfg.AccessKey, SecretKey: s.cfg.SecretKey}, s.cfg.Region, "s3", time.Now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s %s: %w", strings.ToLower(method), key, err)
+	}
+	return resp, nil
+}
+
+// s3Error describes an unexpected response to an operation on key.
+func s3Error(op, key string, resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s %s: %s: %s", op, key, resp.Status, bytes.TrimSpace(msg))
+}
+
+// escapeKey escapes the segments of an object key for the URL path.
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,73 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is an in-memory S3 bucket that checks requests are signed.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		http.Error(w, "unsigned", http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[r.URL.Path], _ = io.ReadAll(r.Body)
+	case http.MethodGet:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	store := NewS3(S3Config{Endpoint: srv.URL + "/", Bucket: "vault", Region: "us-east-1", AccessKey: "key", SecretKey: "secret"})
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "alice/s1/3", []byte("payload")); err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+	if _, ok := fake.objects["/vault/alice/s1/3"]; !ok {
+		t.Errorf("objects = %v; want /vault/alice/s1/3", fake.objects)
+	}
+	if data, err := store.Get(ctx, "alice/s1/3"); err != nil || string(data) != "payload" {
+		t.Errorf("Get = %q, %v; want payload", data, err)
+	}
+	if err := store.Delete(ctx, "alice/s1/3"); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if _, err := store.Get(ctx, "alice/s1/3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete = %v; want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "alice/s1/3"); err != nil {
+		t.Errorf("Delete of missing blob returned error: %v", err)
+	}
+
+	bad := NewS3(S3Config{Endpoint: srv.URL, Bucket: "vault", AccessKey: "other"})
+	if err := bad.Put(ctx, "k", nil); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Put with wrong credentials = %v; want 403 error", err)
+	}
+}
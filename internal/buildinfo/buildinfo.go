@@ -0,0 +1,56 @@
+// Package buildinfo describes the build of the running binary: the version
+// and date set with -ldflags, completed with the Go version and the module
+// and VCS metadata the go command embeds, so that builds without ldflags,
+// e.g. from go install, still tell where they come from.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Info describes a build.
+type Info struct {
+	// Version is the build version; empty if unknown.
+	Version string
+	// BuildDate is the build date, or the time of the VCS revision.
+	BuildDate string
+	// GoVersion is the Go toolchain that built the binary.
+	GoVersion string
+	// Revision is the VCS revision built; empty if unknown.
+	Revision string
+	// Modified is set if the working tree had uncommitted changes.
+	Modified bool
+}
+
+// Read returns the build info of the running binary. version and
+// buildDate are the values set with -ldflags; where they are empty, the
+// module version and the time of the VCS revision are used instead.
+func Read(version, buildDate string) Info {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return Info{Version: version, BuildDate: buildDate, GoVersion: runtime.Version()}
+	}
+	return fromBuildInfo(bi, version, buildDate)
+}
+
+// fromBuildInfo completes version and buildDate from bi.
+func fromBuildInfo(bi *debug.BuildInfo, version, buildDate string) Info {
+	info := Info{Version: version, BuildDate: buildDate, GoVersion: bi.GoVersion}
+	if info.Version == "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			if info.BuildDate == "" {
+				info.BuildDate = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
@@ -0,0 +1,42 @@
+package buildinfo
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestFromBuildInfo(t *testing.T) {
+	bi := &debug.BuildInfo{
+		GoVersion: "go1.23.4",
+		Main:      debug.Module{Version: "v1.4.0"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs", Value: "git"},
+			{Key: "vcs.revision", Value: "1b605b7c0ffee"},
+			{Key: "vcs.time", Value: "2026-10-16T12:00:00Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+
+	// Without ldflags the embedded metadata is used
+	want := Info{Version: "v1.4.0", BuildDate: "2026-10-16T12:00:00Z", GoVersion: "go1.23.4", Revision: "1b605b7c0ffee", Modified: true}
+	if got := fromBuildInfo(bi, "", ""); got != want {
+		t.Errorf("fromBuildInfo = %+v; want %+v", got, want)
+	}
+
+	// ldflags take precedence
+	got := fromBuildInfo(bi, "20261016", "2026-10-16")
+	if got.Version != "20261016" || got.BuildDate != "2026-10-16" || got.Revision != "1b605b7c0ffee" {
+		t.Errorf("fromBuildInfo with ldflags = %+v", got)
+	}
+
+	// Builds from a checkout without VCS stamping have no version
+	if got := fromBuildInfo(&debug.BuildInfo{GoVersion: "go1.23.4", Main: debug.Module{Version: "(devel)"}}, "", ""); got != (Info{GoVersion: "go1.23.4"}) {
+		t.Errorf("fromBuildInfo of a devel build = %+v", got)
+	}
+}
+
+func TestRead(t *testing.T) {
+	if info := Read("1.0", ""); info.Version != "1.0" || info.GoVersion == "" {
+		t.Errorf("Read = %+v; want version 1.0 and the Go version", info)
+	}
+}
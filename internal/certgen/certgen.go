@@ -3,9 +3,11 @@
 package certgen
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
@@ -16,6 +18,9 @@ import (
 	"time"
 )
 
+// UserCertValidity is how long user certificates are valid.
+const UserCertValidity = 365 * 24 * time.Hour
+
 // LoadCACredentials loads a CA certificate and its private key from PEM files.
 // It returns the parsed *x509.Certificate, the private key (either *ecdsa.PrivateKey or *rsa.PrivateKey),
 // or an error if reading or parsing fails.
@@ -75,6 +80,31 @@ func GenerateUserCertificate(commonName string, caCert *x509.Certificate, caKey
 		return nil, nil, fmt.Errorf("gen key: %w", err)
 	}
 
+	certPEM, err := IssueUserCertificate(commonName, &priv.PublicKey, caCert, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Marshal and PEM-encode the private key
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal priv key: %w", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM, nil
+}
+
+// IssueUserCertificate issues a certificate for a user's existing public
+// key, signed by the provided CA certificate and key, e.g. to rename the
+// user without replacing the key the client derives its vault key from.
+// It returns the PEM-encoded certificate, or an error.
+//
+//	commonName: desired Common Name (CN) for the user certificate
+//	pub:        public key of the user, e.g. from its current certificate
+//	caCert:     parsed CA *x509.Certificate for signing
+//	caKey:      CA private key (*ecdsa.PrivateKey or *rsa.PrivateKey)
+func IssueUserCertificate(commonName string, pub any, caCert *x509.Certificate, caKey any) ([]byte, error) {
 	// Create a serial number for the certificate
 	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
 	template := &x509.Certificate{
@@ -83,25 +113,60 @@ func GenerateUserCertificate(commonName string, caCert *x509.Certificate, caKey
 			CommonName: commonName,
 		},
 		NotBefore:   time.Now().Add(-1 * time.Minute),
-		NotAfter:    time.Now().Add(365 * 24 * time.Hour),
+		NotAfter:    time.Now().Add(UserCertValidity),
 		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
 		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
 	}
 
 	// Create and sign the certificate
-	certDER, err := x509.CreateCertificate(rand.Reader, template, caCert, &priv.PublicKey, caKey)
+	certDER, err := x509.CreateCertificate(rand.Reader, template, caCert, pub, caKey)
 	if err != nil {
-		return nil, nil, fmt.Errorf("create cert: %w", err)
+		return nil, fmt.Errorf("create cert: %w", err)
 	}
 
 	// PEM-encode the certificate
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
-	// Marshal and PEM-encode the private key
-	keyDER, err := x509.MarshalECPrivateKey(priv)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), nil
+}
+
+// CheckServerCredentials verifies the TLS files of the server: that the
+// certificate at certPath matches the key at keyPath and chains to the CA
+// certificate at caPath, valid for server authentication at now, and that
+// the CA key at caKeyPath, which signs user certificates, belongs to the
+// CA certificate. It returns the server certificate.
+func CheckServerCredentials(certPath, keyPath, caPath, caKeyPath string, now time.Time) (*x509.Certificate, error) {
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("marshal priv key: %w", err)
+		return nil, fmt.Errorf("load server cert/key: %w", err)
+	}
+	chain := make([]*x509.Certificate, len(pair.Certificate))
+	for i, der := range pair.Certificate {
+		if chain[i], err = x509.ParseCertificate(der); err != nil {
+			return nil, fmt.Errorf("parse server cert: %w", err)
+		}
 	}
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
 
-	return certPEM, keyPEM, nil
+	caCert, caKey, err := LoadCACredentials(caPath, caKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	signer, _ := caKey.(crypto.Signer)
+	pub, _ := caCert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if signer == nil || pub == nil || !pub.Equal(signer.Public()) {
+		return nil, errors.New("ca key does not match the ca cert")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	opts.Roots.AddCert(caCert)
+	for _, c := range chain[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	if _, err := chain[0].Verify(opts); err != nil {
+		return nil, fmt.Errorf("verify server cert: %w", err)
+	}
+	return chain[0], nil
 }
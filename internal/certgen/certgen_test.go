@@ -9,6 +9,7 @@ import (
 	"encoding/pem"
 	"math/big"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -195,3 +196,108 @@ func TestGenerateUserCertificate_Success(t *testing.T) {
 		t.Errorf("parse private key failed: %v", err)
 	}
 }
+
+func TestIssueUserCertificate_KeepsKey(t *testing.T) {
+	_, _, caCert, caKey := setupTestCA(t)
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := IssueUserCertificate("renamedCN", &priv.PublicKey, caCert, caKey)
+	if err != nil {
+		t.Fatalf("IssueUserCertificate error: %v", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		t.Fatalf("cert PEM invalid")
+	}
+	userCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("parse user cert: %v", err)
+	}
+	if userCert.Subject.CommonName != "renamedCN" {
+		t.Errorf("CommonName = %q; want %q", userCert.Subject.CommonName, "renamedCN")
+	}
+	if !priv.PublicKey.Equal(userCert.PublicKey) {
+		t.Error("certificate does not carry the given public key")
+	}
+}
+
+// writeServerFiles writes the CA files of a new test CA and a server
+// certificate it signed, valid until notAfter, to dir.
+func writeServerFiles(t *testing.T, dir string, notAfter time.Time) {
+	t.Helper()
+	caPEM, caKeyPEM, _, caKey := setupTestCA(t)
+	block, _ := pem.Decode(caPEM)
+	caCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &priv.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		"ca.crt":     caPEM,
+		"ca.key":     caKeyPEM,
+		"server.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"server.key": pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckServerCredentials(t *testing.T) {
+	dir := t.TempDir()
+	writeServerFiles(t, dir, time.Now().Add(24*time.Hour))
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	cert, err := CheckServerCredentials(path("server.crt"), path("server.key"), path("ca.crt"), path("ca.key"), time.Now())
+	if err != nil {
+		t.Fatalf("CheckServerCredentials error: %v", err)
+	}
+	if cert.Subject.CommonName != "localhost" {
+		t.Errorf("CommonName = %q; want localhost", cert.Subject.CommonName)
+	}
+
+	// A certificate past its expiry fails verification
+	if _, err := CheckServerCredentials(path("server.crt"), path("server.key"), path("ca.crt"), path("ca.key"), time.Now().Add(48*time.Hour)); err == nil || !strings.Contains(err.Error(), "verify server cert") {
+		t.Errorf("expired certificate: error = %v; want verify error", err)
+	}
+
+	// Files of another CA neither chain nor match
+	other := t.TempDir()
+	writeServerFiles(t, other, time.Now().Add(24*time.Hour))
+	if _, err := CheckServerCredentials(path("server.crt"), path("server.key"), filepath.Join(other, "ca.crt"), filepath.Join(other, "ca.key"), time.Now()); err == nil || !strings.Contains(err.Error(), "verify server cert") {
+		t.Errorf("other CA: error = %v; want verify error", err)
+	}
+	if _, err := CheckServerCredentials(path("server.crt"), path("server.key"), path("ca.crt"), filepath.Join(other, "ca.key"), time.Now()); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("other CA key: error = %v; want mismatch error", err)
+	}
+	if _, err := CheckServerCredentials(path("server.crt"), filepath.Join(other, "server.key"), path("ca.crt"), path("ca.key"), time.Now()); err == nil || !strings.Contains(err.Error(), "load server cert/key") {
+		t.Errorf("other server key: error = %v; want load error", err)
+	}
+}
@@ -0,0 +1,166 @@
+// Package autotype fills login forms by injecting keyboard events into the
+// focused window, for applications that block pasting. Events are injected
+// by platform tools (xdotool, wtype, osascript), or by SendInput on
+// Windows, so no cgo is needed.
+package autotype
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Key is a special key pressed by a sequence.
+type Key string
+
+// Keys used by sequences, named as in X11 keysyms.
+const (
+	Tab   Key = "Tab"
+	Enter Key = "Return"
+)
+
+// ErrUnsupported is returned by Detect when no keyboard-injection backend
+// is available, e.g. without a graphical session.
+var ErrUnsupported = errors.New("auto-type is not supported here: install xdotool (X11) or wtype (Wayland)")
+
+// Step is one action of a sequence: Text is typed, or Key is pressed if
+// Text is empty.
+type Step struct {
+	Text string
+	Key  Key
+}
+
+// Backend injects keyboard events into the focused window.
+type Backend interface {
+	// Name identifies the backend, e.g. "xdotool".
+	Name() string
+	// Type types text as if entered on the keyboard.
+	Type(text string) error
+	// Press presses and releases key.
+	Press(key Key) error
+}
+
+// Login returns the sequence filling a login form: login, TAB, password
+// and, if enter is set, ENTER. Without a login only the password is typed.
+func Login(login, password string, enter bool) []Step {
+	var steps []Step
+	if login != "" {
+		steps = append(steps, Step{Text: login}, Step{Key: Tab})
+	}
+	steps = append(steps, Step{Text: password})
+	if enter {
+		steps = append(steps, Step{Key: Enter})
+	}
+	return steps
+}
+
+// Run performs steps with b, stopping at the first error.
+func Run(b Backend, steps []Step) error {
+	for _, s := range steps {
+		var err error
+		if s.Text != "" {
+			err = b.Type(s.Text)
+		} else if s.Key != "" {
+			err = b.Press(s.Key)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", b.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Detect returns the backend for the current session: SendInput on
+// Windows, osascript on macOS, wtype under Wayland and xdotool under X11.
+func Detect() (Backend, error) {
+	switch {
+	case runtime.GOOS == "darwin":
+		return osascript{}, nil
+	case runtime.GOOS == "windows":
+		return windowsBackend()
+	case os.Getenv("WAYLAND_DISPLAY") != "" && hasTool("wtype"):
+		return wtype{}, nil
+	case os.Getenv("DISPLAY") != "" && hasTool("xdotool"):
+		return xdotool{}, nil
+	}
+	return nil, ErrUnsupported
+}
+
+// hasTool reports whether the named program is in PATH.
+func hasTool(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// run runs the named program with args and stdin as its input. Text is
+// always passed on stdin, never as an argument, so that it does not show
+// up in the process list.
+func run(stdin string, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = io.Discard
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// xdotool injects events into X11 sessions.
+type xdotool struct{}
+
+func (xdotool) Name() string { return "xdotool" }
+
+func (xdotool) Type(text string) error {
+	return run(text, "xdotool", "type", "--clearmodifiers", "--file", "-")
+}
+
+func (xdotool) Press(key Key) error {
+	return run("", "xdotool", "key", "--clearmodifiers", string(key))
+}
+
+// wtype injects events into Wayland sessions supporting the virtual
+// keyboard protocol.
+type wtype struct{}
+
+func (wtype) Name() string { return "wtype" }
+
+func (wtype) Type(text string) error {
+	return run(text, "wtype", "-")
+}
+
+func (wtype) Press(key Key) error {
+	return run("", "wtype", "-k", string(key))
+}
+
+// osascript injects events through System Events on macOS. The terminal
+// needs the Accessibility permission.
+type osascript struct{}
+
+func (osascript) Name() string { return "osascript" }
+
+func (osascript) Type(text string) error {
+	return run(`tell application "System Events" to keystroke `+appleScriptString(text), "osascript", "-")
+}
+
+func (osascript) Press(key Key) error {
+	code := map[Key]string{Tab: "48", Enter: "36"}[key]
+	if code == "" {
+		return fmt.Errorf("unsupported key %s", key)
+	}
+	return run(`tell application "System Events" to key code `+code, "osascript", "-")
+}
+
+// appleScriptString quotes s as an AppleScript string literal.
+func appleScriptString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
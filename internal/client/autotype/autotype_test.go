@@ -0,0 +1,68 @@
+package autotype
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// recorder is a backend recording the events it is asked to inject.
+type recorder struct {
+	events []string
+	fail   bool
+}
+
+func (r *recorder) Name() string { return "recorder" }
+
+func (r *recorder) Type(text string) error {
+	if r.fail {
+		return errors.New("no display")
+	}
+	r.events = append(r.events, "type "+text)
+	return nil
+}
+
+func (r *recorder) Press(key Key) error {
+	r.events = append(r.events, "key "+string(key))
+	return nil
+}
+
+func TestRun_Login(t *testing.T) {
+	tests := []struct {
+		name        string
+		login, pass string
+		enter       bool
+		want        []string
+	}{
+		{"full", "alice", "s3cret", true, []string{"type alice", "key Tab", "type s3cret", "key Return"}},
+		{"no enter", "alice", "s3cret", false, []string{"type alice", "key Tab", "type s3cret"}},
+		{"password only", "", "s3cret", true, []string{"type s3cret", "key Return"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r recorder
+			if err := Run(&r, Login(tt.login, tt.pass, tt.enter)); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if !slices.Equal(r.events, tt.want) {
+				t.Errorf("events = %q; want %q", r.events, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_StopsOnError(t *testing.T) {
+	r := recorder{fail: true}
+	if err := Run(&r, Login("alice", "s3cret", true)); err == nil {
+		t.Fatal("Run succeeded; want error")
+	}
+	if len(r.events) != 0 {
+		t.Errorf("events after error = %q", r.events)
+	}
+}
+
+func TestAppleScriptString(t *testing.T) {
+	if got, want := appleScriptString(`a"b\c`), `"a\"b\\c"`; got != want {
+		t.Errorf("appleScriptString = %s; want %s", got, want)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package autotype
+
+// windowsBackend is only available on Windows.
+func windowsBackend() (Backend, error) {
+	return nil, ErrUnsupported
+}
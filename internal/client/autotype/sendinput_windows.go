@@ -0,0 +1,90 @@
+//go:build windows
+
+package autotype
+
+import (
+	"fmt"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procSendInput = windows.NewLazySystemDLL("user32.dll").NewProc("SendInput")
+
+// Keyboard input flags and virtual keys, see winuser.h.
+const (
+	inputKeyboard   = 1
+	keyEventKeyUp   = 0x0002
+	keyEventUnicode = 0x0004
+	vkTab           = 0x09
+	vkReturn        = 0x0D
+)
+
+// keyboardInput is an INPUT structure holding a KEYBDINPUT.
+type keyboardInput struct {
+	typ       uint32
+	_         [unsafe.Sizeof(uintptr(0)) - 4]byte // the union is pointer-aligned
+	vk        uint16
+	scan      uint16
+	flags     uint32
+	time      uint32
+	extraInfo uintptr
+	_         [8]byte // pads to MOUSEINPUT, the largest member of the union
+}
+
+// windowsBackend returns the SendInput backend.
+func windowsBackend() (Backend, error) {
+	if err := procSendInput.Find(); err != nil {
+		return nil, err
+	}
+	return sendInput{}, nil
+}
+
+// sendInput injects events with SendInput from user32.dll. Windows drops
+// them when the focused window belongs to a process of a higher integrity
+// level, e.g. one run as administrator.
+type sendInput struct{}
+
+func (sendInput) Name() string { return "SendInput" }
+
+// Type sends every UTF-16 code unit of text as a Unicode key stroke, so
+// that text is typed regardless of the keyboard layout.
+func (sendInput) Type(text string) error {
+	var inputs []keyboardInput
+	for _, unit := range utf16.Encode([]rune(text)) {
+		inputs = append(inputs,
+			keyboardInput{typ: inputKeyboard, scan: unit, flags: keyEventUnicode},
+			keyboardInput{typ: inputKeyboard, scan: unit, flags: keyEventUnicode | keyEventKeyUp})
+	}
+	defer clear(inputs)
+	return send(inputs)
+}
+
+func (sendInput) Press(key Key) error {
+	vk := map[Key]uint16{Tab: vkTab, Enter: vkReturn}[key]
+	if vk == 0 {
+		return fmt.Errorf("unsupported key %s", key)
+	}
+	return send([]keyboardInput{
+		{typ: inputKeyboard, vk: vk},
+		{typ: inputKeyboard, vk: vk, flags: keyEventKeyUp},
+	})
+}
+
+// send injects inputs in one call, so that they are not interleaved with
+// the events of the user.
+func send(inputs []keyboardInput) error {
+	if len(inputs) == 0 {
+		return nil
+	}
+	n, _, err := procSendInput.Call(uintptr(len(inputs)), uintptr(unsafe.Pointer(&inputs[0])), unsafe.Sizeof(inputs[0]))
+	if int(n) == len(inputs) {
+		return nil
+	}
+	if errno, ok := err.(windows.Errno); ok && errno != 0 {
+		return fmt.Errorf("injected %d of %d events: %w", n, len(inputs), err)
+	}
+	// Events blocked for the integrity level are dropped without an error
+	return fmt.Errorf("injected %d of %d events; the focused window may belong to a program run as administrator", n, len(inputs))
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package autotype
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestKeyboardInputSize(t *testing.T) {
+	// sizeof(INPUT) in winuser.h
+	want := uintptr(28)
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		want = 40
+	}
+	if got := unsafe.Sizeof(keyboardInput{}); got != want {
+		t.Errorf("sizeof keyboardInput = %d; want %d", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+// Package clipboard copies text to the system clipboard. Like autotype it
+// runs platform tools (pbcopy, wl-copy, xclip, xsel, clip), so no cgo is
+// needed; over SSH the terminal is asked to set the clipboard with an
+// OSC 52 escape sequence instead.
+package clipboard
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ErrUnsupported is returned by Detect when no clipboard backend is
+// available, e.g. without a graphical session.
+var ErrUnsupported = errors.New("clipboard is not supported here: install wl-clipboard (Wayland), xclip or xsel (X11)")
+
+// Backend copies text to a clipboard.
+type Backend interface {
+	// Name identifies the backend, e.g. "xclip".
+	Name() string
+	// Copy replaces the content of the clipboard with text.
+	Copy(text string) error
+}
+
+// Detect returns the backend for the current session: OSC 52 written to
+// term in SSH sessions, pbcopy on macOS, clip on Windows, wl-copy under
+// Wayland and xclip or xsel under X11. Without a tool, OSC 52 is used if
+// term is not nil; terminals not supporting it ignore the sequence.
+func Detect(term io.Writer) (Backend, error) {
+	switch {
+	case os.Getenv("SSH_TTY") != "" && term != nil:
+		return OSC52{W: term}, nil
+	case runtime.GOOS == "darwin":
+		return tool{name: "pbcopy"}, nil
+	case runtime.GOOS == "windows":
+		return tool{name: "clip"}, nil
+	case os.Getenv("WAYLAND_DISPLAY") != "" && hasTool("wl-copy"):
+		return tool{name: "wl-copy"}, nil
+	case os.Getenv("DISPLAY") != "" && hasTool("xclip"):
+		return tool{name: "xclip", args: []string{"-selection", "clipboard"}}, nil
+	case os.Getenv("DISPLAY") != "" && hasTool("xsel"):
+		return tool{name: "xsel", args: []string{"--clipboard", "--input"}}, nil
+	case term != nil:
+		return OSC52{W: term}, nil
+	}
+	return nil, ErrUnsupported
+}
+
+// hasTool reports whether the named program is in PATH.
+func hasTool(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// tool copies with a program reading the text on stdin. The text is never
+// passed as an argument, so that it does not show up in the process list.
+type tool struct {
+	name string
+	args []string
+}
+
+func (t tool) Name() string { return t.name }
+
+func (t tool) Copy(text string) error {
+	cmd := exec.Command(t.name, t.args...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = io.Discard
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %w: %s", t.name, err, msg)
+		}
+		return fmt.Errorf("%s: %w", t.name, err)
+	}
+	return nil
+}
+
+// OSC52 copies by writing the OSC 52 escape sequence to the terminal W,
+// which sets the clipboard of the machine the terminal runs on.
+type OSC52 struct {
+	W io.Writer
+}
+
+func (OSC52) Name() string { return "osc52" }
+
+func (o OSC52) Copy(text string) error {
+	_, err := fmt.Fprintf(o.W, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return err
+}
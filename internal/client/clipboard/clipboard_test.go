@@ -0,0 +1,46 @@
+package clipboard
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestOSC52_Copy(t *testing.T) {
+	var term strings.Builder
+	if err := (OSC52{W: &term}).Copy("s3cret"); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	if got, want := term.String(), "\x1b]52;c;czNjcmV0\a"; got != want {
+		t.Errorf("sequence = %q; want %q", got, want)
+	}
+}
+
+func TestDetect_SSH(t *testing.T) {
+	t.Setenv("SSH_TTY", "/dev/pts/0")
+	var term strings.Builder
+	b, err := Detect(&term)
+	if err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+	if b.Name() != "osc52" {
+		t.Errorf("backend = %s; want osc52", b.Name())
+	}
+}
+
+func TestDetect_NoBackend(t *testing.T) {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		t.Skip("the clipboard tool is always available on " + runtime.GOOS)
+	}
+	t.Setenv("SSH_TTY", "")
+	t.Setenv("WAYLAND_DISPLAY", "")
+	t.Setenv("DISPLAY", "")
+	if _, err := Detect(nil); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Detect error = %v; want ErrUnsupported", err)
+	}
+	if b, err := Detect(io.Discard); err != nil || b.Name() != "osc52" {
+		t.Errorf("Detect with a terminal = %v, %v; want osc52", b, err)
+	}
+}
@@ -0,0 +1,126 @@
+// Package i18n translates the user-facing messages of the client.
+//
+// Messages are looked up by their English text, which doubles as the
+// fallback: English needs no catalog, and a message missing from a catalog
+// is shown in English. Format strings are translated before formatting, so
+// translations must use the same verbs, reordered with explicit argument
+// indexes (%[2]s) where the grammar requires it.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DefaultLang is the language of the message keys.
+const DefaultLang = "en"
+
+// catalogs maps a language to its translations, keyed by English message.
+var catalogs = map[string]map[string]string{
+	"ru": ru,
+}
+
+// lang is the current language and catalog its translations.
+var (
+	lang    = DefaultLang
+	catalog map[string]string
+)
+
+// Langs returns the supported languages, sorted.
+func Langs() []string {
+	langs := []string{DefaultLang}
+	for l := range catalogs {
+		langs = append(langs, l)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// SetLang selects the language of all messages. It accepts a language
+// code ("ru") or a locale name ("ru_RU.UTF-8").
+func SetLang(l string) error {
+	code := langCode(l)
+	if code == DefaultLang {
+		lang, catalog = DefaultLang, nil
+		return nil
+	}
+	c, ok := catalogs[code]
+	if !ok {
+		return fmt.Errorf("unsupported language %q, use one of %s", l, strings.Join(Langs(), ", "))
+	}
+	lang, catalog = code, c
+	return nil
+}
+
+// Lang returns the current language.
+func Lang() string {
+	return lang
+}
+
+// Detect returns the language of the user's locale from the LC_ALL,
+// LC_MESSAGES and LANG environment variables, in that order, or
+// DefaultLang if it is not supported.
+func Detect() string {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+		code := langCode(v)
+		if _, ok := catalogs[code]; ok {
+			return code
+		}
+		return DefaultLang
+	}
+	return DefaultLang
+}
+
+// langCode extracts the language code from a locale name, e.g. "ru" from
+// "ru_RU.UTF-8". The C and POSIX locales are English.
+func langCode(locale string) string {
+	code := strings.ToLower(locale)
+	if i := strings.IndexAny(code, "_.@-"); i >= 0 {
+		code = code[:i]
+	}
+	if code == "" || code == "c" || code == "posix" {
+		return DefaultLang
+	}
+	return code
+}
+
+// T returns the translation of msg in the current language.
+func T(msg string) string {
+	if t, ok := catalog[msg]; ok {
+		return t
+	}
+	return msg
+}
+
+// Sprintf formats the translation of format.
+func Sprintf(format string, a ...any) string {
+	return fmt.Sprintf(T(format), a...)
+}
+
+// Errorf is fmt.Errorf with the translation of format; %w wraps errors as
+// usual.
+func Errorf(format string, a ...any) error {
+	return fmt.Errorf(T(format), a...)
+}
+
+// messageError is an error whose text is translated when it is printed.
+type messageError struct {
+	msg string
+}
+
+func (e *messageError) Error() string {
+	return T(e.msg)
+}
+
+// NewError returns a sentinel error with the text msg, translated to the
+// language current when the error is printed rather than when it is
+// created. Like errors.New, each call returns a distinct error.
+func NewError(msg string) error {
+	return &messageError{msg: msg}
+}
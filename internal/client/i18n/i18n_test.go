@@ -0,0 +1,99 @@
+package i18n
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+// verb matches a formatting verb, capturing its flags and verb letter but
+// not an explicit argument index.
+var verb = regexp.MustCompile(`%(?:\[\d+\])?([-+# 0]*\d*(?:\.\d+)?[a-zA-Z%])`)
+
+// verbs returns the sorted formatting verbs of format.
+func verbs(format string) []string {
+	var vs []string
+	for _, m := range verb.FindAllStringSubmatch(format, -1) {
+		vs = append(vs, m[1])
+	}
+	slices.Sort(vs)
+	return vs
+}
+
+func TestCatalogsKeepVerbs(t *testing.T) {
+	for lang, c := range catalogs {
+		for key, msg := range c {
+			if !slices.Equal(verbs(key), verbs(msg)) {
+				t.Errorf("%s: %q has verbs %v; want %v", lang, msg, verbs(msg), verbs(key))
+			}
+		}
+	}
+}
+
+func TestSetLang(t *testing.T) {
+	defer SetLang(DefaultLang)
+
+	if err := SetLang("ru_RU.UTF-8"); err != nil {
+		t.Fatalf("SetLang returned error: %v", err)
+	}
+	if Lang() != "ru" {
+		t.Errorf("Lang() = %q; want ru", Lang())
+	}
+	if got := Sprintf("Saved to %s", "a.txt"); got != "Сохранено в a.txt" {
+		t.Errorf("Sprintf = %q", got)
+	}
+	if got := Sprintf("Delete %s secret %s %q?", "text", "42", "note"); got != `Удалить секрет 42 (text) "note"?` {
+		t.Errorf("Sprintf with reordered arguments = %q", got)
+	}
+	if got := T("not in the catalog"); got != "not in the catalog" {
+		t.Errorf("T of an untranslated message = %q", got)
+	}
+
+	if err := SetLang("xx"); err == nil {
+		t.Error("SetLang(xx) succeeded; want error")
+	}
+	if err := SetLang("C"); err != nil || Lang() != DefaultLang {
+		t.Errorf("SetLang(C) = %v, Lang() = %q; want English", err, Lang())
+	}
+}
+
+func TestErrors(t *testing.T) {
+	defer SetLang(DefaultLang)
+
+	errAborted := NewError("aborted")
+	wrapped := Errorf("failed to save local store: %w", errAborted)
+	if !errors.Is(wrapped, errAborted) {
+		t.Error("Errorf does not wrap with %w")
+	}
+	if errors.Is(errAborted, NewError("aborted")) {
+		t.Error("NewError errors with the same text are equal")
+	}
+
+	// Sentinel errors are translated when printed, not when created.
+	_ = SetLang("ru")
+	if got := errAborted.Error(); got != "отменено" {
+		t.Errorf("Error() = %q; want отменено", got)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		lcAll, lcMessages, lang string
+		want                    string
+	}{
+		{"", "", "", "en"},
+		{"", "", "ru_RU.UTF-8", "ru"},
+		{"", "ru_RU.UTF-8", "en_US.UTF-8", "ru"},
+		{"C", "", "ru_RU.UTF-8", "en"},
+		{"", "", "de_DE.UTF-8", "en"},
+	}
+	for _, tt := range tests {
+		t.Setenv("LC_ALL", tt.lcAll)
+		t.Setenv("LC_MESSAGES", tt.lcMessages)
+		t.Setenv("LANG", tt.lang)
+		if got := Detect(); got != tt.want {
+			t.Errorf("Detect(LC_ALL=%q, LC_MESSAGES=%q, LANG=%q) = %q; want %q", tt.lcAll, tt.lcMessages, tt.lang, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package i18n
+
+// ru is the Russian catalog.
+var ru = map[string]string{
+	// Shell
+	"Available commands: %s": "Доступные команды: %s",
+	"Bye":                    "Пока",
+	"Error: %s":              "Ошибка: %s",
+	"Warning: %s":            "Предупреждение: %s",
+	"Debug: %s":              "Отладка: %s",
+	"usage: %s":              "использование: %s",
+	"unknown command %q, type 'help' for a list of commands": "неизвестная команда %q, введите 'help' для списка команд",
+	"offline mode: network operations are disabled":          "автономный режим: сетевые операции отключены",
+	"aborted": "отменено",
+
+	// Secrets
+	"Delete %s secret %s %q?":                           "Удалить секрет %[2]s (%[1]s) %[3]q?",
+	"Secret updated":                                    "Секрет обновлён",
+	"Secret deleted":                                    "Секрет удалён",
+	"Secret cloned: %s":                                 "Секрет скопирован: %s",
+	"failed to save local store: %w":                    "не удалось сохранить локальное хранилище: %w",
+	"failed to decrypt secret: %w":                      "не удалось расшифровать секрет: %w",
+	"failed to delete attachments: %s":                  "не удалось удалить вложения: %s",
+	"unknown sort order, use name, comment or modified": "неизвестный порядок сортировки, используйте name, comment или modified",
+	"No duplicates found":                               "Дубликатов не найдено",
+	"Merged %d duplicates":                              "Объединено дубликатов: %d",
+	"failed to merge duplicates: %w":                    "не удалось объединить дубликаты: %w",
+	"Focus the login form, typing in %ds...":            "Переключитесь на форму входа, ввод через %d с...",
+	"failed to type credentials: %w":                    "не удалось ввести учётные данные: %w",
+	"secret %s is of type %s, not wifi":                 "секрет %s имеет тип %s, а не wifi",
+	"failed to write profile: %w":                       "не удалось записать профиль: %w",
+	"Profile saved to %s":                               "Профиль сохранён в %s",
+	"skipping SSH key: %s":                              "SSH-ключ пропущен: %s",
+	"no usable ssh-key secrets in the vault":            "в хранилище нет пригодных секретов ssh-key",
+	"failed to listen on %s: %w":                        "не удалось открыть %s: %w",
+	"Serving %d SSH keys, stop with Ctrl-C":             "Обслуживается SSH-ключей: %d, остановка — Ctrl-C",
+	"Passphrase to reveal %s: ":                         "Пароль для показа %s: ",
+	"Master password to reveal %s: ":                    "Мастер-пароль для показа %s: ",
+	"No aliases":                                        "Псевдонимов нет",
+	"Aliases updated":                                   "Псевдонимы обновлены",
+	"No deleted secrets":                                "Удалённых секретов нет",
+	"Purged %d deleted secrets":                         "Окончательно удалено секретов: %d",
+	"Permanently purge %d deleted secrets? Devices that have not synced the deletions keep their copies.": "Окончательно удалить удалённые секреты (%d)? Устройства, не синхронизировавшие удаление, сохранят свои копии.",
+	"failed to purge deleted secrets on %s: %w":                                                           "не удалось окончательно удалить секреты на %s: %w",
+	"Keep which? Number to keep it and merge the others into it, Enter to skip, q to stop: ":              "Какой оставить? Номер — оставить его и объединить с ним остальные, Enter — пропустить, q — закончить: ",
+	"No conflicts": "Конфликтов нет",
+	"Keep which? l for local, r for remote, b for both, Enter to skip, q to stop: ": "Какую версию оставить? l — локальную, r — с сервера, b — обе, Enter — пропустить, q — закончить: ",
+	"Kept the local version as %s":             "Локальная версия сохранена как %s",
+	"Resolved %d conflicts":                    "Разрешено конфликтов: %d",
+	"failed to resolve conflict: %w":           "не удалось разрешить конфликт: %w",
+	"failed to sync resolved conflicts: %w":    "не удалось синхронизировать разрешённые конфликты: %w",
+	"%d conflicts to resolve, see 'conflicts'": "конфликтов для разрешения: %d, см. 'conflicts'",
+
+	// Settings
+	"Server: %s":                       "Сервер: %s",
+	"Auto-sync: %s":                    "Автосинхронизация: %s",
+	"Output: %s":                       "Вывод: %s",
+	"on":                               "вкл",
+	"off":                              "выкл",
+	"unknown output format %q, use %s": "неизвестный формат вывода %q, используйте %s",
+	"failed to save client config: %w": "не удалось сохранить настройки клиента: %w",
+
+	// Import
+	"unknown import format %q, use dotenv":                 "неизвестный формат импорта %q, используйте dotenv",
+	"failed to import %s: %w":                              "не удалось импортировать %s: %w",
+	"Imported %d new and %d changed secrets, %d unchanged": "Импортировано новых секретов: %d, изменённых: %d, без изменений: %d",
+
+	// Template rendering
+	"failed to read template: %w":      "не удалось прочитать шаблон: %w",
+	"failed to render template: %w":    "не удалось заполнить шаблон: %w",
+	"failed to write %s: %w":           "не удалось записать %s: %w",
+	"Rendered %s":                      "Файл %s создан",
+	"Rendered %s, deleted in %s":       "Файл %s создан, будет удалён через %s",
+	"failed to delete %s: %s":          "не удалось удалить %s: %s",
+	"failed to signal the process: %w": "не удалось отправить сигнал процессу: %w",
+
+	// Fingerprint
+	"Local fingerprint: %s (%d secrets)":                       "Отпечаток локальных секретов: %s (секретов: %d)",
+	"Not compared with the servers: this device syncs only %s": "Не сравнивается с серверами: устройство синхронизирует только %s",
+	"failed to fetch fingerprint from %s: %w":                  "не удалось получить отпечаток с %s: %w",
+	"%s: the server does not report fingerprints":              "%s: сервер не сообщает отпечаток",
+	"%s: %s, matches": "%s: %s, совпадает",
+	"%s: %s, differs": "%s: %s, отличается",
+	"the local secrets differ from %d servers, sync and compare again": "локальные секреты отличаются от серверов (%d), выполните синхронизацию и сравните снова",
+
+	// Logging
+	"unknown log format %q, want %s or %s": "неизвестный формат журнала %q, ожидается %s или %s",
+	"failed to open log file: %w":          "не удалось открыть файл журнала: %w",
+	"invalid log level: %w":                "неверный уровень журнала: %w",
+
+	// Attachments
+	"No attachments":                   "Вложений нет",
+	"%-30s %10d bytes\n":               "%-30s %10d байт\n",
+	"Attached %s (%d bytes)":           "Вложение %s добавлено (%d байт)",
+	"Saved to %s":                      "Сохранено в %s",
+	"failed to read attachments: %w":   "не удалось прочитать вложения: %w",
+	"failed to read file: %w":          "не удалось прочитать файл: %w",
+	"failed to add attachment: %w":     "не удалось добавить вложение: %w",
+	"failed to create file: %w":        "не удалось создать файл: %w",
+	"failed to extract attachment: %w": "не удалось извлечь вложение: %w",
+
+	// Terminal interface
+	"the tui command needs a terminal":    "команде tui нужен терминал",
+	"failed to copy to the clipboard: %w": "не удалось скопировать в буфер обмена: %w",
+	"(hidden, press ENTER to reveal)":     "(скрыто, нажмите ENTER, чтобы показать)",
+	"/ to search":                         "/ для поиска",
+	"Search: %s":                          "Поиск: %s",
+	"%d secrets":                          "Секретов: %d",
+	"No secrets found":                    "Секреты не найдены",
+	"Name: %s":                            "Имя: %s",
+	"%s has no password":                  "у %s нет пароля",
+	"%s has no login":                     "у %s нет логина",
+	"Copied the password of %s":           "Пароль %s скопирован",
+	"Copied the login of %s":              "Логин %s скопирован",
+	"↑↓ move  / search  enter reveal  c password  u login  r rename  e edit  q quit": "↑↓ выбор  / поиск  enter показать  c пароль  u логин  r имя  e изменить  q выход",
+
+	// Activity log
+	"No activity recorded":             "Действий ещё не было",
+	"failed to read activity log: %w":  "не удалось прочитать журнал действий: %w",
+	"failed to write activity log: %s": "не удалось записать журнал действий: %s",
+
+	// Server communication
+	"sync error: %v (next attempt in %s)": "ошибка синхронизации: %v (следующая попытка через %s)",
+	"Windows services are only available on Windows; run -daemon under systemd, see init/gophkeeper-client.service": "службы Windows доступны только в Windows; запускайте -daemon под systemd, см. init/gophkeeper-client.service",
+	"failed to unseal %s: %w":                                     "не удалось расшифровать %s: %w",
+	"Windows password of %s: ":                                    "Пароль Windows пользователя %s: ",
+	"failed to seal the passwords: %w":                            "не удалось зашифровать пароли: %w",
+	"connecting to the service control manager: %w":               "подключение к диспетчеру служб: %w",
+	"creating the service: %w":                                    "создание службы: %w",
+	"failed to set the restart policy of the service: %s":         "не удалось задать перезапуск службы: %s",
+	"the service is installed, but failed to start: %w":           "служба установлена, но не запустилась: %w",
+	"✅ Service %s installed and started.":                         "✅ Служба %s установлена и запущена.",
+	"opening the service: %w":                                     "открытие службы: %w",
+	"deleting the service: %w":                                    "удаление службы: %w",
+	"✅ Service %s uninstalled.":                                   "✅ Служба %s удалена.",
+	"Syncing: %s":                                                 "Синхронизируется: %s",
+	"whole vault":                                                 "всё хранилище",
+	"Synced":                                                      "Синхронизировано",
+	"No accesses recorded":                                        "Обращений не было",
+	"failed to fetch access log: %w":                              "не удалось получить журнал доступа: %w",
+	"Lease %s expires at %s":                                      "Аренда %s истекает %s",
+	"No API tokens issued":                                        "API-токены не выпускались",
+	"failed to fetch leases: %w":                                  "не удалось получить аренды: %w",
+	"failed to renew lease %s: %w":                                "не удалось продлить аренду %s: %w",
+	"failed to revoke lease %s: %w":                               "не удалось отозвать аренду %s: %w",
+	"Lease %s revoked":                                            "Аренда %s отозвана",
+	"No notification channels":                                    "Каналы уведомлений не настроены",
+	"failed to fetch notification channels: %w":                   "не удалось получить каналы уведомлений: %w",
+	"failed to add notification channel: %w":                      "не удалось добавить канал уведомлений: %w",
+	"Notification channel %d added":                               "Канал уведомлений %d добавлен",
+	"failed to remove notification channel %d: %w":                "не удалось удалить канал уведомлений %d: %w",
+	"Notification channel %d removed":                             "Канал уведомлений %d удалён",
+	"No syncs recorded":                                           "Синхронизаций ещё не было",
+	"failed to read sync log: %w":                                 "не удалось прочитать журнал синхронизации: %w",
+	"failed to fetch stats: %w":                                   "не удалось получить статистику: %w",
+	"device %s has not synced since %s; revoke it if it was lost": "устройство %s не синхронизировалось с %s; отзовите его, если оно утеряно",
+	"failed to export data: %w":                                   "не удалось выгрузить данные: %w",
+	"Exported %d secrets to %s":                                   "Выгружено секретов: %d, файл %s",
+	"failed to issue token: %w":                                   "не удалось выпустить токен: %w",
+	"API token: %s":                                               "API-токен: %s",
+	"could not check server version: %s":                          "не удалось проверить версию сервера: %s",
+	"%w (server %s)":                                              "%w (сервер %s)",
+	"%w, sync is disabled":                                        "%w, синхронизация отключена",
+	"%w, staying on %s":                                           "%w, остаётся сервер %s",
+	"Using server %s":                                             "Используется сервер %s",
+	"please provide a command, e.g. -cmd=shell":                   "укажите команду, например -cmd=shell",
+	"GophKeeper Client":                                           "Клиент GophKeeper",
+	"GophKeeper Server at %s":                                     "Сервер GophKeeper %s",
+	"Version: %s":                                                 "Версия: %s",
+	"Build Date: %s":                                              "Дата сборки: %s",
+	"Go Version: %s":                                              "Версия Go: %s",
+	"Revision: %s":                                                "Ревизия: %s",
+	"%s (uncommitted changes)":                                    "%s (с незафиксированными изменениями)",
+
+	// Credentials
+	"cannot load client credentials":         "не удалось загрузить учётные данные клиента",
+	"%w: reading client key: %w":             "%w: чтение ключа клиента: %w",
+	"%w: deriving AEAD from private key: %w": "%w: получение ключа хранилища из закрытого ключа: %w",
+	"%w: unlocking the vault: %w":            "%w: разблокировка хранилища: %w",
+	"fetching the vault from the server: %w": "получение хранилища с сервера: %w",
+	"The vault is encrypted with a key derived from the client key; choose a master password to re-encrypt it.":            "Хранилище зашифровано ключом, полученным из ключа клиента; задайте мастер-пароль, чтобы перешифровать его.",
+	"failed to re-encrypt the activity log: %s":                                                                            "не удалось перешифровать журнал действий: %s",
+	"Re-encrypted %d secrets with the master password.":                                                                    "Перешифровано секретов мастер-паролем: %d.",
+	"Re-encrypted %d secrets that shared a nonce.":                                                                         "Перешифровано секретов с повторяющимся nonce: %d.",
+	"failed to re-encrypt secrets: %s":                                                                                     "не удалось перешифровать секреты: %s",
+	"Client key is stored unencrypted; run \"encrypt-key\" to protect it with a passphrase.":                               "Ключ клиента хранится незашифрованным; выполните \"encrypt-key\", чтобы защитить его паролем.",
+	"a non-empty passphrase is required":                                                                                   "требуется непустой пароль",
+	"✅ Client key encrypted.":                                                                                              "✅ Ключ клиента зашифрован.",
+	"✅ Client key moved to the OS keystore.":                                                                               "✅ Ключ клиента перемещён в хранилище ключей ОС.",
+	"the vault is encrypted with a key derived from the client key; open the shell once to choose a master password first": "хранилище зашифровано ключом, полученным из ключа клиента; сначала откройте оболочку, чтобы задать мастер-пароль",
+	"✅ Registration successful. Certificate and key saved.":                                                                "✅ Регистрация выполнена. Сертификат и ключ сохранены.",
+	"Recovery codes, each usable once to replace a lost certificate. Store them safely:":                                   "Коды восстановления, каждый действует один раз для замены утерянного сертификата. Храните их в надёжном месте:",
+	"Recovery code: ": "Код восстановления: ",
+	"✅ Recovery successful. New certificate and key saved.":                                                    "✅ Восстановление выполнено. Новый сертификат и ключ сохранены.",
+	"Secrets encrypted with the lost key cannot be decrypted with the new one.":                                "Секреты, зашифрованные утерянным ключом, нельзя расшифровать новым.",
+	"failed to renew certificate: %w":                                                                          "не удалось обновить сертификат: %w",
+	"failed to load renewed certificate: %w":                                                                   "не удалось загрузить обновлённый сертификат: %w",
+	"Certificate renewed; valid until %s.":                                                                     "Сертификат обновлён; действителен до %s.",
+	"The client certificate has expired; recover access with \"recover\".":                                     "Срок действия сертификата клиента истёк; восстановите доступ командой \"recover\".",
+	"The client certificate expires on %s; run \"renew\" to replace it.":                                       "Срок действия сертификата клиента истекает %s; выполните \"renew\", чтобы заменить его.",
+	"Replace the local copy of %s with the server's? Local changes not yet synced are lost.":                   "Заменить локальную копию %s копией с сервера? Несинхронизированные локальные изменения будут потеряны.",
+	"Refreshed %s at version %d":                                                                               "%s обновлён до версии %d",
+	"%s is deleted on the server":                                                                              "%s удалён на сервере",
+	"Using the client files in the working directory; move them to %s and %s to use the client from anywhere.": "Используются файлы клиента из рабочего каталога; переместите их в %s и %s, чтобы запускать клиент из любого каталога.",
+}
@@ -0,0 +1,150 @@
+// Package keystore keeps the client key in the keystore of the operating
+// system, the Keychain on macOS and CNG (the Microsoft Software Key Storage
+// Provider) on Windows, where it is stored non-exportable: the client only
+// gets a crypto.Signer for the TLS handshake, and the key never exists as
+// a file. Keys are ECDSA P-256, the type the server issues.
+package keystore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+)
+
+var (
+	// ErrUnsupported is returned by System on platforms without a
+	// supported keystore, or builds without cgo on macOS.
+	ErrUnsupported = errors.New("keystore: no OS keystore is supported on this platform")
+	// ErrNotFound is returned when no key has the given label.
+	ErrNotFound = errors.New("keystore: key not found")
+)
+
+// Store holds private keys that cannot be exported, identified by a label.
+type Store interface {
+	// Generate creates a new key under label, replacing any key with the
+	// same label.
+	Generate(label string) (crypto.Signer, error)
+	// Import stores key under label, replacing any key with the same label.
+	// Only its signer can be got back.
+	Import(label string, key *ecdsa.PrivateKey) (crypto.Signer, error)
+	// Open returns the signer of the key under label, or ErrNotFound.
+	Open(label string) (crypto.Signer, error)
+	// Delete removes the key under label. Deleting a missing key is not an
+	// error.
+	Delete(label string) error
+}
+
+// System returns the keystore of the operating system, or ErrUnsupported.
+func System() (Store, error) {
+	return system()
+}
+
+// checkKey returns an error unless key is an ECDSA P-256 key, the only
+// type stored.
+func checkKey(key *ecdsa.PrivateKey) error {
+	if key.Curve != elliptic.P256() {
+		return fmt.Errorf("keystore: unsupported curve %s, want P-256", key.Curve.Params().Name)
+	}
+	return nil
+}
+
+// publicKey returns the P-256 public key with the big-endian coordinates x
+// and y, as exported by the keystores.
+func publicKey(x, y []byte) (*ecdsa.PublicKey, error) {
+	pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, errors.New("keystore: invalid public key")
+	}
+	return pub, nil
+}
+
+// asn1Signature encodes the raw signature r||s, as made by CNG, in the
+// ASN.1 form crypto.Signer returns for ECDSA keys.
+func asn1Signature(raw []byte) ([]byte, error) {
+	if len(raw) == 0 || len(raw)%2 != 0 {
+		return nil, fmt.Errorf("keystore: invalid signature of %d bytes", len(raw))
+	}
+	half := len(raw) / 2
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		new(big.Int).SetBytes(raw[:half]),
+		new(big.Int).SetBytes(raw[half:]),
+	})
+}
+
+// Memory is a Store keeping keys in memory, for tests. Its signers do not
+// give access to the keys either. The zero value is ready to use.
+type Memory struct {
+	mu   sync.Mutex
+	keys map[string]*ecdsa.PrivateKey
+}
+
+// Generate creates a new key under label.
+func (m *Memory) Generate(label string) (crypto.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return m.Import(label, key)
+}
+
+// Import stores a copy of key under label.
+func (m *Memory) Import(label string, key *ecdsa.PrivateKey) (crypto.Signer, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.keys == nil {
+		m.keys = make(map[string]*ecdsa.PrivateKey)
+	}
+	stored := *key
+	stored.D = new(big.Int).Set(key.D)
+	m.keys[label] = &stored
+	return memorySigner{&stored}, nil
+}
+
+// Open returns the signer of the key under label.
+func (m *Memory) Open(label string) (crypto.Signer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[label]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return memorySigner{key}, nil
+}
+
+// Delete removes the key under label.
+func (m *Memory) Delete(label string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.keys, label)
+	return nil
+}
+
+// Len returns the number of keys stored.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.keys)
+}
+
+// memorySigner signs with a key of a Memory store without exposing it.
+type memorySigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s memorySigner) Public() crypto.PublicKey {
+	return &s.key.PublicKey
+}
+
+func (s memorySigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.key.Sign(rand, digest, opts)
+}
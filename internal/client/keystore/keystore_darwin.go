@@ -0,0 +1,276 @@
+//go:build darwin && cgo
+
+package keystore
+
+/*
+#cgo LDFLAGS: -framework Security -framework CoreFoundation
+#include <stdlib.h>
+#include <CoreFoundation/CoreFoundation.h>
+#include <Security/Security.h>
+
+// keyQuery returns the attributes naming the private key tagged tag.
+static CFMutableDictionaryRef keyQuery(CFDataRef tag) {
+	CFMutableDictionaryRef q = CFDictionaryCreateMutable(NULL, 0,
+		&kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+	CFDictionarySetValue(q, kSecClass, kSecClassKey);
+	CFDictionarySetValue(q, kSecAttrKeyType, kSecAttrKeyTypeECSECPrimeRandom);
+	CFDictionarySetValue(q, kSecAttrKeyClass, kSecAttrKeyClassPrivate);
+	CFDictionarySetValue(q, kSecAttrApplicationTag, tag);
+	return q;
+}
+
+// generateKey creates a permanent, non-extractable P-256 key tagged tag.
+static SecKeyRef generateKey(CFDataRef tag, CFStringRef label, CFErrorRef *err) {
+	int bits = 256;
+	CFNumberRef size = CFNumberCreate(NULL, kCFNumberIntType, &bits);
+	CFMutableDictionaryRef priv = CFDictionaryCreateMutable(NULL, 0,
+		&kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+	CFDictionarySetValue(priv, kSecAttrIsPermanent, kCFBooleanTrue);
+	CFDictionarySetValue(priv, kSecAttrIsExtractable, kCFBooleanFalse);
+	CFDictionarySetValue(priv, kSecAttrApplicationTag, tag);
+	CFDictionarySetValue(priv, kSecAttrLabel, label);
+	CFMutableDictionaryRef attrs = CFDictionaryCreateMutable(NULL, 0,
+		&kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+	CFDictionarySetValue(attrs, kSecAttrKeyType, kSecAttrKeyTypeECSECPrimeRandom);
+	CFDictionarySetValue(attrs, kSecAttrKeySizeInBits, size);
+	CFDictionarySetValue(attrs, kSecPrivateKeyAttrs, priv);
+	SecKeyRef key = SecKeyCreateRandomKey(attrs, err);
+	CFRelease(attrs);
+	CFRelease(priv);
+	CFRelease(size);
+	return key;
+}
+
+// importKey stores the P-256 key given in X9.63 form (04 || X || Y || D)
+// as a non-extractable key tagged tag.
+static OSStatus importKey(CFDataRef tag, CFStringRef label, CFDataRef data, CFErrorRef *err) {
+	CFMutableDictionaryRef attrs = CFDictionaryCreateMutable(NULL, 0,
+		&kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+	CFDictionarySetValue(attrs, kSecAttrKeyType, kSecAttrKeyTypeECSECPrimeRandom);
+	CFDictionarySetValue(attrs, kSecAttrKeyClass, kSecAttrKeyClassPrivate);
+	SecKeyRef key = SecKeyCreateWithData(data, attrs, err);
+	CFRelease(attrs);
+	if (key == NULL) {
+		return errSecParam;
+	}
+	CFMutableDictionaryRef item = CFDictionaryCreateMutable(NULL, 0,
+		&kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+	CFDictionarySetValue(item, kSecClass, kSecClassKey);
+	CFDictionarySetValue(item, kSecValueRef, key);
+	CFDictionarySetValue(item, kSecAttrApplicationTag, tag);
+	CFDictionarySetValue(item, kSecAttrLabel, label);
+	CFDictionarySetValue(item, kSecAttrIsExtractable, kCFBooleanFalse);
+	OSStatus status = SecItemAdd(item, NULL);
+	CFRelease(item);
+	CFRelease(key);
+	return status;
+}
+
+// openKey returns the private key tagged tag, or NULL with the status.
+static SecKeyRef openKey(CFDataRef tag, OSStatus *status) {
+	CFMutableDictionaryRef q = keyQuery(tag);
+	CFDictionarySetValue(q, kSecReturnRef, kCFBooleanTrue);
+	CFDictionarySetValue(q, kSecMatchLimit, kSecMatchLimitOne);
+	CFTypeRef key = NULL;
+	*status = SecItemCopyMatching(q, &key);
+	CFRelease(q);
+	return (SecKeyRef)key;
+}
+
+static OSStatus deleteKey(CFDataRef tag) {
+	CFMutableDictionaryRef q = keyQuery(tag);
+	OSStatus status = SecItemDelete(q);
+	CFRelease(q);
+	return status;
+}
+
+// publicKey returns the public key of key in X9.63 form (04 || X || Y).
+static CFDataRef publicKey(SecKeyRef key, CFErrorRef *err) {
+	SecKeyRef pub = SecKeyCopyPublicKey(key);
+	if (pub == NULL) {
+		return NULL;
+	}
+	CFDataRef data = SecKeyCopyExternalRepresentation(pub, err);
+	CFRelease(pub);
+	return data;
+}
+
+// sign returns the ASN.1 ECDSA signature of digest.
+static CFDataRef sign(SecKeyRef key, CFDataRef digest, CFErrorRef *err) {
+	return SecKeyCreateSignature(key, kSecKeyAlgorithmECDSASignatureDigestX962, digest, err);
+}
+*/
+import "C"
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"unsafe"
+)
+
+// Security framework result codes, see SecBase.h.
+const (
+	errSecSuccess      = 0
+	errSecItemNotFound = -25300
+)
+
+// keychain stores keys in the default keychain, tagged and labeled with
+// their label, as non-extractable items.
+type keychain struct{}
+
+func system() (Store, error) {
+	return keychain{}, nil
+}
+
+func (keychain) Generate(label string) (crypto.Signer, error) {
+	tag, name := cfData([]byte(label)), cfString(label)
+	defer C.CFRelease(C.CFTypeRef(tag))
+	defer C.CFRelease(C.CFTypeRef(name))
+	if st := C.deleteKey(tag); st != errSecSuccess && st != errSecItemNotFound {
+		return nil, statusError("replace key", st)
+	}
+	var cerr C.CFErrorRef
+	key := C.generateKey(tag, name, &cerr)
+	if key == 0 {
+		return nil, cfError("create key", cerr)
+	}
+	return newSigner(key)
+}
+
+func (keychain) Import(label string, key *ecdsa.PrivateKey) (crypto.Signer, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	raw := make([]byte, 1+3*32)
+	defer clear(raw)
+	raw[0] = 4
+	key.X.FillBytes(raw[1:33])
+	key.Y.FillBytes(raw[33:65])
+	key.D.FillBytes(raw[65:])
+
+	tag, name, data := cfData([]byte(label)), cfString(label), cfData(raw)
+	defer C.CFRelease(C.CFTypeRef(tag))
+	defer C.CFRelease(C.CFTypeRef(name))
+	defer C.CFRelease(C.CFTypeRef(data))
+	if st := C.deleteKey(tag); st != errSecSuccess && st != errSecItemNotFound {
+		return nil, statusError("replace key", st)
+	}
+	var cerr C.CFErrorRef
+	if st := C.importKey(tag, name, data, &cerr); st != errSecSuccess {
+		if cerr != 0 {
+			return nil, cfError("import key", cerr)
+		}
+		return nil, statusError("import key", st)
+	}
+	return keychain{}.Open(label)
+}
+
+func (keychain) Open(label string) (crypto.Signer, error) {
+	tag := cfData([]byte(label))
+	defer C.CFRelease(C.CFTypeRef(tag))
+	var st C.OSStatus
+	key := C.openKey(tag, &st)
+	switch {
+	case st == errSecItemNotFound:
+		return nil, ErrNotFound
+	case st != errSecSuccess:
+		return nil, statusError("open key", st)
+	}
+	return newSigner(key)
+}
+
+func (keychain) Delete(label string) error {
+	tag := cfData([]byte(label))
+	defer C.CFRelease(C.CFTypeRef(tag))
+	if st := C.deleteKey(tag); st != errSecSuccess && st != errSecItemNotFound {
+		return statusError("delete key", st)
+	}
+	return nil
+}
+
+// keychainSigner signs with a keychain key, released when the signer is
+// collected.
+type keychainSigner struct {
+	key C.SecKeyRef
+	pub *ecdsa.PublicKey
+}
+
+// newSigner returns the signer of key, which it takes over.
+func newSigner(key C.SecKeyRef) (crypto.Signer, error) {
+	var cerr C.CFErrorRef
+	data := C.publicKey(key, &cerr)
+	if data == 0 {
+		C.CFRelease(C.CFTypeRef(key))
+		return nil, cfError("export public key", cerr)
+	}
+	raw := goBytes(data)
+	C.CFRelease(C.CFTypeRef(data))
+	if len(raw) != 65 || raw[0] != 4 {
+		C.CFRelease(C.CFTypeRef(key))
+		return nil, errors.New("keystore: key is not a P-256 key")
+	}
+	pub, err := publicKey(raw[1:33], raw[33:])
+	if err != nil {
+		C.CFRelease(C.CFTypeRef(key))
+		return nil, err
+	}
+	s := &keychainSigner{key: key, pub: pub}
+	runtime.SetFinalizer(s, func(s *keychainSigner) { C.CFRelease(C.CFTypeRef(s.key)) })
+	return s, nil
+}
+
+func (s *keychainSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign signs digest in the keychain; rand and opts are unused, as the hash
+// is implied by the length of digest.
+func (s *keychainSigner) Sign(_ io.Reader, digest []byte, _ crypto.SignerOpts) ([]byte, error) {
+	in := cfData(digest)
+	defer C.CFRelease(C.CFTypeRef(in))
+	var cerr C.CFErrorRef
+	sig := C.sign(s.key, in, &cerr)
+	runtime.KeepAlive(s)
+	if sig == 0 {
+		return nil, cfError("sign", cerr)
+	}
+	defer C.CFRelease(C.CFTypeRef(sig))
+	return goBytes(sig), nil
+}
+
+func cfData(b []byte) C.CFDataRef {
+	return C.CFDataCreate(0, (*C.UInt8)(unsafe.Pointer(unsafe.SliceData(b))), C.CFIndex(len(b)))
+}
+
+func cfString(s string) C.CFStringRef {
+	cs := C.CString(s)
+	defer C.free(unsafe.Pointer(cs))
+	return C.CFStringCreateWithCString(0, cs, C.CFStringEncoding(C.kCFStringEncodingUTF8))
+}
+
+func goBytes(d C.CFDataRef) []byte {
+	return C.GoBytes(unsafe.Pointer(C.CFDataGetBytePtr(d)), C.int(C.CFDataGetLength(d)))
+}
+
+func statusError(op string, st C.OSStatus) error {
+	return fmt.Errorf("keystore: %s: OSStatus %d", op, int(st))
+}
+
+// cfError returns an error describing op and err, which it releases.
+func cfError(op string, err C.CFErrorRef) error {
+	if err == 0 {
+		return fmt.Errorf("keystore: %s failed", op)
+	}
+	defer C.CFRelease(C.CFTypeRef(err))
+	desc := C.CFErrorCopyDescription(err)
+	defer C.CFRelease(C.CFTypeRef(desc))
+	buf := make([]byte, 512)
+	if C.CFStringGetCString(desc, (*C.char)(unsafe.Pointer(&buf[0])), C.CFIndex(len(buf)), C.CFStringEncoding(C.kCFStringEncodingUTF8)) == 0 {
+		return fmt.Errorf("keystore: %s failed: error %d", op, int(C.CFErrorGetCode(err)))
+	}
+	return fmt.Errorf("keystore: %s failed: %s", op, C.GoString((*C.char)(unsafe.Pointer(&buf[0]))))
+}
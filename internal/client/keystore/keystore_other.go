@@ -0,0 +1,7 @@
+//go:build !windows && !(darwin && cgo)
+
+package keystore
+
+func system() (Store, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,105 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"runtime"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	var m Memory
+	digest := sha256.Sum256([]byte("handshake"))
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Import("alice", key); err != nil {
+		t.Fatalf("Import returned error: %v", err)
+	}
+	signer, err := m.Open("alice")
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	if !key.PublicKey.Equal(signer.Public()) {
+		t.Error("opened key differs from the imported one")
+	}
+	sig, err := signer.Sign(rand.Reader, digest[:], nil)
+	if err != nil || !ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig) {
+		t.Errorf("signature does not verify: %v", err)
+	}
+
+	generated, err := m.Generate("bob")
+	if err != nil {
+		t.Fatalf("Generate returned error: %v", err)
+	}
+	if key.PublicKey.Equal(generated.Public()) || m.Len() != 2 {
+		t.Errorf("Generate did not add a new key: %d keys", m.Len())
+	}
+
+	if err := m.Delete("alice"); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if _, err := m.Open("alice"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open of a deleted key = %v; want ErrNotFound", err)
+	}
+	if err := m.Delete("alice"); err != nil {
+		t.Errorf("Delete of a missing key = %v; want nil", err)
+	}
+
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if _, err := m.Import("carol", p384); err == nil {
+		t.Error("Import accepted a P-384 key")
+	}
+}
+
+func TestAsn1Signature(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	digest := sha256.Sum256([]byte("handshake"))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The raw form CNG returns
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+		t.Fatal(err)
+	}
+	raw := make([]byte, 64)
+	rs.R.FillBytes(raw[:32])
+	rs.S.FillBytes(raw[32:])
+
+	got, err := asn1Signature(raw)
+	if err != nil || !ecdsa.VerifyASN1(&key.PublicKey, digest[:], got) {
+		t.Errorf("converted signature does not verify: %v", err)
+	}
+	if _, err := asn1Signature(raw[:63]); err == nil {
+		t.Error("asn1Signature accepted an odd length")
+	}
+}
+
+func TestPublicKey(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pub, err := publicKey(key.X.Bytes(), key.Y.Bytes())
+	if err != nil || !key.PublicKey.Equal(pub) {
+		t.Errorf("publicKey = %v, %v; want the key's", pub, err)
+	}
+	if _, err := publicKey([]byte{1}, []byte{2}); err == nil {
+		t.Error("publicKey accepted a point off the curve")
+	}
+}
+
+func TestSystem_Unsupported(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("the keystore of the OS is supported")
+	}
+	if _, err := System(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("System() = %v; want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,262 @@
+package keystore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	ncrypt = windows.NewLazySystemDLL("ncrypt.dll")
+
+	procOpenStorageProvider = ncrypt.NewProc("NCryptOpenStorageProvider")
+	procCreatePersistedKey  = ncrypt.NewProc("NCryptCreatePersistedKey")
+	procImportKey           = ncrypt.NewProc("NCryptImportKey")
+	procOpenKey             = ncrypt.NewProc("NCryptOpenKey")
+	procSetProperty         = ncrypt.NewProc("NCryptSetProperty")
+	procFinalizeKey         = ncrypt.NewProc("NCryptFinalizeKey")
+	procExportKey           = ncrypt.NewProc("NCryptExportKey")
+	procSignHash            = ncrypt.NewProc("NCryptSignHash")
+	procDeleteKey           = ncrypt.NewProc("NCryptDeleteKey")
+	procFreeObject          = ncrypt.NewProc("NCryptFreeObject")
+)
+
+// CNG names and flags, see ncrypt.h and bcrypt.h.
+const (
+	providerName     = "Microsoft Software Key Storage Provider"
+	algorithmP256    = "ECDSA_P256"
+	exportPolicyProp = "Export Policy"
+	privateBlobType  = "ECCPRIVATEBLOB"
+	publicBlobType   = "ECCPUBLICBLOB"
+
+	overwriteKeyFlag  = 0x00000080
+	doNotFinalizeFlag = 0x00000400
+	persistFlag       = 0x80000000
+
+	bufferPKCSKeyName = 45
+
+	privateP256Magic = 0x32534345 // BCRYPT_ECDSA_PRIVATE_P256_MAGIC
+	p256Size         = 32
+
+	nteBadKeyset = 0x80090016 // NTE_BAD_KEYSET: no key of that name
+)
+
+// Pointers are converted to uintptr in the argument lists of the calls
+// themselves, which keeps what they point to alive and in place.
+
+// cngStore stores keys with the Microsoft Software Key Storage Provider,
+// under the name of their label, with an export policy allowing no export.
+type cngStore struct {
+	provider uintptr
+}
+
+func system() (Store, error) {
+	if err := ncrypt.Load(); err != nil {
+		return nil, ErrUnsupported
+	}
+	var s cngStore
+	name := utf16(providerName)
+	r, _, _ := procOpenStorageProvider.Call(uintptr(unsafe.Pointer(&s.provider)), uintptr(unsafe.Pointer(name)), 0)
+	if err := status("open key storage provider", r); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *cngStore) Generate(label string) (crypto.Signer, error) {
+	name, err := windows.UTF16PtrFromString(label)
+	if err != nil {
+		return nil, err
+	}
+	var key uintptr
+	r, _, _ := procCreatePersistedKey.Call(s.provider, uintptr(unsafe.Pointer(&key)),
+		uintptr(unsafe.Pointer(utf16(algorithmP256))), uintptr(unsafe.Pointer(name)), 0, overwriteKeyFlag)
+	if err := status("create key", r); err != nil {
+		return nil, err
+	}
+	return finalize(key)
+}
+
+func (s *cngStore) Import(label string, key *ecdsa.PrivateKey) (crypto.Signer, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	// BCRYPT_ECCKEY_BLOB followed by X, Y and D
+	blob := make([]byte, 8+3*p256Size)
+	defer clear(blob)
+	binary.LittleEndian.PutUint32(blob, privateP256Magic)
+	binary.LittleEndian.PutUint32(blob[4:], p256Size)
+	key.X.FillBytes(blob[8 : 8+p256Size])
+	key.Y.FillBytes(blob[8+p256Size : 8+2*p256Size])
+	key.D.FillBytes(blob[8+2*p256Size:])
+
+	name, err := windows.UTF16FromString(label)
+	if err != nil {
+		return nil, err
+	}
+	// The buffers hold pointers, so they are allocated where the GC sees them
+	buf := &ncryptBuffer{size: uint32(2 * len(name)), typ: bufferPKCSKeyName, data: &name[0]}
+	desc := &ncryptBufferDesc{count: 1, buffers: buf}
+	var handle uintptr
+	r, _, _ := procImportKey.Call(s.provider, 0, uintptr(unsafe.Pointer(utf16(privateBlobType))),
+		uintptr(unsafe.Pointer(desc)), uintptr(unsafe.Pointer(&handle)),
+		uintptr(unsafe.Pointer(&blob[0])), uintptr(len(blob)), overwriteKeyFlag|doNotFinalizeFlag)
+	if err := status("import key", r); err != nil {
+		return nil, err
+	}
+	return finalize(handle)
+}
+
+func (s *cngStore) Open(label string) (crypto.Signer, error) {
+	key, err := s.open(label)
+	if err != nil {
+		return nil, err
+	}
+	return newSigner(key)
+}
+
+func (s *cngStore) Delete(label string) error {
+	key, err := s.open(label)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// The handle is freed by the deletion
+	r, _, _ := procDeleteKey.Call(key, 0)
+	return status("delete key", r)
+}
+
+// open returns the handle of the key named label.
+func (s *cngStore) open(label string) (uintptr, error) {
+	name, err := windows.UTF16PtrFromString(label)
+	if err != nil {
+		return 0, err
+	}
+	var key uintptr
+	r, _, _ := procOpenKey.Call(s.provider, uintptr(unsafe.Pointer(&key)), uintptr(unsafe.Pointer(name)), 0, 0)
+	if r == nteBadKeyset {
+		return 0, ErrNotFound
+	}
+	return key, status("open key", r)
+}
+
+// finalize makes the new key non-exportable and stores it.
+func finalize(key uintptr) (crypto.Signer, error) {
+	policy := new(uint32) // no export allowed
+	r, _, _ := procSetProperty.Call(key, uintptr(unsafe.Pointer(utf16(exportPolicyProp))),
+		uintptr(unsafe.Pointer(policy)), 4, persistFlag)
+	if err := status("set export policy", r); err != nil {
+		freeObject(key)
+		return nil, err
+	}
+	r, _, _ = procFinalizeKey.Call(key, 0)
+	if err := status("finalize key", r); err != nil {
+		freeObject(key)
+		return nil, err
+	}
+	return newSigner(key)
+}
+
+// cngSigner signs with a CNG key handle, kept open for the life of the
+// process.
+type cngSigner struct {
+	key uintptr
+	pub *ecdsa.PublicKey
+}
+
+// newSigner returns the signer of the key handle, which it takes over.
+func newSigner(key uintptr) (crypto.Signer, error) {
+	pub, err := exportPublicKey(key)
+	if err != nil {
+		freeObject(key)
+		return nil, err
+	}
+	return &cngSigner{key: key, pub: pub}, nil
+}
+
+// exportPublicKey returns the public key of the key handle.
+func exportPublicKey(key uintptr) (*ecdsa.PublicKey, error) {
+	blobType := utf16(publicBlobType)
+	var size uint32
+	r, _, _ := procExportKey.Call(key, 0, uintptr(unsafe.Pointer(blobType)), 0, 0, 0, uintptr(unsafe.Pointer(&size)), 0)
+	if err := status("export public key", r); err != nil {
+		return nil, err
+	}
+	blob := make([]byte, size)
+	r, _, _ = procExportKey.Call(key, 0, uintptr(unsafe.Pointer(blobType)), 0,
+		uintptr(unsafe.Pointer(&blob[0])), uintptr(size), uintptr(unsafe.Pointer(&size)), 0)
+	if err := status("export public key", r); err != nil {
+		return nil, err
+	}
+	// BCRYPT_ECCKEY_BLOB followed by X and Y
+	if len(blob) < 8 || binary.LittleEndian.Uint32(blob[4:]) != p256Size || len(blob) < 8+2*p256Size {
+		return nil, errors.New("keystore: key is not a P-256 key")
+	}
+	return publicKey(blob[8:8+p256Size], blob[8+p256Size:8+2*p256Size])
+}
+
+func (s *cngSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign signs digest in the key storage provider; rand and opts are unused,
+// as the hash is implied by the length of digest.
+func (s *cngSigner) Sign(_ io.Reader, digest []byte, _ crypto.SignerOpts) ([]byte, error) {
+	if len(digest) == 0 {
+		return nil, errors.New("keystore: empty digest")
+	}
+	var size uint32
+	r, _, _ := procSignHash.Call(s.key, 0, uintptr(unsafe.Pointer(&digest[0])), uintptr(len(digest)),
+		0, 0, uintptr(unsafe.Pointer(&size)), 0)
+	if err := status("sign", r); err != nil {
+		return nil, err
+	}
+	raw := make([]byte, size)
+	r, _, _ = procSignHash.Call(s.key, 0, uintptr(unsafe.Pointer(&digest[0])), uintptr(len(digest)),
+		uintptr(unsafe.Pointer(&raw[0])), uintptr(size), uintptr(unsafe.Pointer(&size)), 0)
+	if err := status("sign", r); err != nil {
+		return nil, err
+	}
+	return asn1Signature(raw[:size])
+}
+
+// ncryptBuffer and ncryptBufferDesc mirror NCryptBuffer and
+// NCryptBufferDesc.
+type ncryptBuffer struct {
+	size uint32
+	typ  uint32
+	data *uint16
+}
+
+type ncryptBufferDesc struct {
+	version uint32
+	count   uint32
+	buffers *ncryptBuffer
+}
+
+// status returns an error describing op if the SECURITY_STATUS r reports
+// a failure.
+func status(op string, r uintptr) error {
+	if r == 0 {
+		return nil
+	}
+	return fmt.Errorf("keystore: %s: %w", op, windows.Errno(r))
+}
+
+func freeObject(handle uintptr) {
+	_, _, _ = procFreeObject.Call(handle)
+}
+
+// utf16 returns the NUL-terminated UTF-16 form of the constant s.
+func utf16(s string) *uint16 {
+	p, _ := windows.UTF16PtrFromString(s)
+	return p
+}
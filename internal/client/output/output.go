@@ -0,0 +1,143 @@
+// Package output renders client output: ANSI colors that honor NO_COLOR
+// and --no-color, and aligned tables whose widths ignore color codes.
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Style is an ANSI SGR style.
+type Style string
+
+// Styles used by the client.
+const (
+	None    Style = ""
+	Bold    Style = "1"
+	Dim     Style = "2"
+	Red     Style = "31"
+	Green   Style = "32"
+	Yellow  Style = "33"
+	Blue    Style = "34"
+	Magenta Style = "35"
+	Cyan    Style = "36"
+)
+
+// colorEnabled reports whether Paint emits ANSI codes. Colors are off until
+// enabled with SetColor, so output written by tests and libraries is plain.
+var colorEnabled bool
+
+// SetColor turns colored output on or off.
+func SetColor(on bool) {
+	colorEnabled = on
+}
+
+// ColorEnabled reports whether colored output is on.
+func ColorEnabled() bool {
+	return colorEnabled
+}
+
+// DetectColor reports whether colors should be used for f: not disabled by
+// the --no-color flag, the NO_COLOR environment variable (any non-empty
+// value, see https://no-color.org) or TERM=dumb, and f is a terminal.
+func DetectColor(noColor bool, f *os.File) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Paint wraps s in the ANSI codes of style when colors are enabled.
+func Paint(s string, style Style) string {
+	if !colorEnabled || style == None || s == "" {
+		return s
+	}
+	return "\x1b[" + string(style) + "m" + s + "\x1b[0m"
+}
+
+// Warning renders a warning message.
+func Warning(s string) string {
+	return Paint(s, Yellow)
+}
+
+// Error renders an error message.
+func Error(s string) string {
+	return Paint(s, Red)
+}
+
+// Success renders a success message.
+func Success(s string) string {
+	return Paint(s, Green)
+}
+
+// typeStyles maps secret types to their colors.
+var typeStyles = map[string]Style{
+	"login_password": Blue,
+	"card":           Magenta,
+	"text":           Green,
+	"binary":         Cyan,
+}
+
+// TypeStyle returns the color of a secret type. Other types are yellow.
+func TypeStyle(t string) Style {
+	if s, ok := typeStyles[t]; ok {
+		return s
+	}
+	return Yellow
+}
+
+// Cell is a table cell.
+type Cell struct {
+	Text  string
+	Style Style
+}
+
+// Table collects rows and writes them with aligned columns.
+type Table struct {
+	rows [][]Cell
+}
+
+// Header adds a bold header row.
+func (t *Table) Header(titles ...string) {
+	row := make([]Cell, len(titles))
+	for i, title := range titles {
+		row[i] = Cell{Text: title, Style: Bold}
+	}
+	t.rows = append(t.rows, row)
+}
+
+// Row adds a row.
+func (t *Table) Row(cells ...Cell) {
+	t.rows = append(t.rows, cells)
+}
+
+// Write writes the table to w. Columns are separated by two spaces and
+// padded to the width of their widest cell; the last column is not padded.
+func (t *Table) Write(w io.Writer) error {
+	var widths []int
+	for _, row := range t.rows {
+		for i, c := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(c.Text))
+		}
+	}
+
+	var b strings.Builder
+	for _, row := range t.rows {
+		for i, c := range row {
+			b.WriteString(Paint(c.Text, c.Style))
+			if i < len(row)-1 {
+				b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c.Text)+2))
+			}
+		}
+		b.WriteByte('\n')
+	}
+	_, err := fmt.Fprint(w, b.String())
+	return err
+}
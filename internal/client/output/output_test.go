@@ -0,0 +1,85 @@
+package output
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPaint(t *testing.T) {
+	defer SetColor(false)
+
+	SetColor(false)
+	if got := Paint("x", Red); got != "x" {
+		t.Errorf("Paint without color = %q; want %q", got, "x")
+	}
+
+	SetColor(true)
+	if got := Paint("x", Red); got != "\x1b[31mx\x1b[0m" {
+		t.Errorf("Paint with color = %q", got)
+	}
+	if got := Paint("x", None); got != "x" {
+		t.Errorf("Paint with no style = %q; want %q", got, "x")
+	}
+}
+
+func TestDetectColor(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	t.Setenv("NO_COLOR", "")
+	t.Setenv("TERM", "xterm")
+	if DetectColor(false, f) {
+		t.Error("regular files are not terminals")
+	}
+	if DetectColor(true, os.Stdout) {
+		t.Error("--no-color must disable colors")
+	}
+	t.Setenv("NO_COLOR", "1")
+	if DetectColor(false, os.Stdout) {
+		t.Error("NO_COLOR must disable colors")
+	}
+}
+
+func TestTable_AlignsColoredCells(t *testing.T) {
+	defer SetColor(false)
+	SetColor(true)
+
+	var tbl Table
+	tbl.Header("ID", "TYPE", "AGE")
+	tbl.Row(Cell{Text: "abc"}, Cell{Text: "card", Style: TypeStyle("card")}, Cell{Text: "3h"})
+	tbl.Row(Cell{Text: "d"}, Cell{Text: "api-token", Style: TypeStyle("api-token")}, Cell{Text: "5d"})
+
+	var buf strings.Builder
+	if err := tbl.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once colors are stripped, every AGE cell starts at the same column.
+	var cols []int
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		plain := stripANSI(line)
+		cols = append(cols, strings.LastIndex(plain, "  ")+2)
+	}
+	if cols[0] != cols[1] || cols[1] != cols[2] {
+		t.Errorf("columns not aligned: %v in %q", cols, buf.String())
+	}
+}
+
+// stripANSI removes ANSI SGR sequences from s.
+func stripANSI(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\x1b' {
+			for i < len(s) && s[i] != 'm' {
+				i++
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
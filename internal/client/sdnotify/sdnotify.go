@@ -0,0 +1,53 @@
+// Package sdnotify implements the systemd service notification protocol,
+// so that a client started by a Type=notify unit can report readiness and
+// status to the service manager.
+package sdnotify
+
+import (
+	"net"
+	"os"
+)
+
+// Protocol states, see sd_notify(3).
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+)
+
+// Status returns the state setting the free-form status of the service
+// shown by "systemctl status".
+func Status(s string) string {
+	return "STATUS=" + s
+}
+
+// Notify sends the newline-separated states to the service manager. It
+// does nothing and returns false if the process was not started by a
+// service manager expecting notifications, i.e. NOTIFY_SOCKET is unset.
+func Notify(states ...string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// A leading @ denotes a socket in the abstract namespace
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	var msg []byte
+	for i, s := range states {
+		if i > 0 {
+			msg = append(msg, '\n')
+		}
+		msg = append(msg, s...)
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return false, err
+	}
+	return true, nil
+}
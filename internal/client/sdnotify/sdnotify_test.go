@@ -0,0 +1,42 @@
+package sdnotify
+
+import (
+	"net"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestNotify(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unixgram sockets are not supported on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	sent, err := Notify(Ready, Status("Synced"))
+	if err != nil || !sent {
+		t.Fatalf("Notify = %v, %v; want true, nil", sent, err)
+	}
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got, want := string(buf[:n]), "READY=1\nSTATUS=Synced"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestNotify_NoSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	sent, err := Notify(Ready)
+	if err != nil || sent {
+		t.Errorf("Notify = %v, %v; want false, nil", sent, err)
+	}
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Access records that a device fetched a secret from the server.
+type Access struct {
+	DeviceID string `json:"device_id"` // e.g. the serial of its client certificate
+	Time     int64  `json:"time"`      // Unix time of the sync that sent the secret
+}
+
+// FetchAccessLog retrieves the recent accesses of the secret with the given
+// ID from the server's /api/secrets/{id}/access-log endpoint, newest first.
+func FetchAccessLog(client *http.Client, baseURL, id string) ([]Access, error) {
+	resp, err := client.Get(baseURL + "/api/secrets/" + url.PathEscape(id) + "/access-log")
+	if err != nil {
+		return nil, fmt.Errorf("access log request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp)
+	}
+
+	var body struct {
+		Accesses []Access `json:"accesses"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return body.Accesses, nil
+}
+
+// PrintAccessLog writes one line per access to w: the time and the device.
+func PrintAccessLog(w io.Writer, accesses []Access) {
+	for _, a := range accesses {
+		fmt.Fprintf(w, "%s  %s\n", formatUnix(a.Time), a.DeviceID)
+	}
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchAccessLog(t *testing.T) {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodGet || req.URL.String() != "http://example.com/api/secrets/a%2Fb/access-log" {
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL)
+		}
+		body := `{"id":"a/b","accesses":[{"device_id":"ff","time":20},{"device_id":"api-token","time":10}]}`
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+
+	accesses, err := FetchAccessLog(client, "http://example.com", "a/b")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Access{{DeviceID: "ff", Time: 20}, {DeviceID: "api-token", Time: 10}}
+	if !reflect.DeepEqual(accesses, want) {
+		t.Errorf("accesses = %+v; want %+v", accesses, want)
+	}
+
+	var buf bytes.Buffer
+	PrintAccessLog(&buf, accesses)
+	if want := time.Unix(20, 0).Format(time.DateTime) + "  ff\n"; !strings.HasPrefix(buf.String(), want) {
+		t.Errorf("output = %q; want it to start with %q", buf.String(), want)
+	}
+}
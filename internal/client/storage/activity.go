@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Operations recorded in the activity log.
+const (
+	ActivityAdd    = "add"
+	ActivityEdit   = "edit"
+	ActivityDelete = "delete"
+	ActivityView   = "view"
+	ActivityPurge  = "purge"
+)
+
+// ActivityEntry records one local operation on a secret. It holds no
+// secret data, not even the comment.
+type ActivityEntry struct {
+	Time int64  `json:"time"`           // Unix time of the operation
+	Op   string `json:"op"`             // one of the Activity* operations
+	ID   string `json:"id"`             // ID of the secret
+	Note string `json:"note,omitempty"` // e.g. the name of an attachment
+}
+
+// ActivityLog is an append-only log of the local operations on a vault.
+// Each line holds one entry encrypted with the vault key, so the log shows
+// neither what was done nor to which secret without the key. A nil
+// *ActivityLog records nothing.
+type ActivityLog struct {
+	path string
+	aead cipher.AEAD
+}
+
+// NewActivityLog returns the activity log at path, encrypted with aead.
+func NewActivityLog(path string, aead cipher.AEAD) *ActivityLog {
+	return &ActivityLog{path: path, aead: aead}
+}
+
+// Record appends an entry for op on the secret id to the log.
+func (l *ActivityLog) Record(op, id, note string) error {
+	if l == nil {
+		return nil
+	}
+	plain, err := json.Marshal(ActivityEntry{Time: time.Now().Unix(), Op: op, ID: id, Note: note})
+	if err != nil {
+		return err
+	}
+	line, err := Encrypt(l.aead, plain)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, line+"\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read returns the last n entries of the log, oldest first; n <= 0 returns
+// all. A missing log has no entries. Entries that cannot be decrypted,
+// e.g. because the log was tampered with, fail the read.
+func (l *ActivityLog) Read(n int) ([]ActivityEntry, error) {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []ActivityEntry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		plain, err := Decrypt(l.aead, scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("activity log line %d: %w", line, err)
+		}
+		var e ActivityEntry
+		if err := json.Unmarshal(plain, &e); err != nil {
+			return nil, fmt.Errorf("activity log line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if n > 0 && len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	return entries, nil
+}
+
+// Rekey re-encrypts the log with aead, e.g. after the vault got a master
+// password, and records with aead from then on. Entries that cannot be
+// decrypted fail the rekey and leave the log as it was.
+func (l *ActivityLog) Rekey(aead cipher.AEAD) error {
+	entries, err := l.Read(0)
+	if err != nil {
+		return err
+	}
+	var buf strings.Builder
+	for _, e := range entries {
+		plain, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		line, err := Encrypt(aead, plain)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(line + "\n")
+	}
+	if len(entries) > 0 {
+		if err := os.WriteFile(l.path, []byte(buf.String()), 0600); err != nil {
+			return err
+		}
+	}
+	l.aead = aead
+	return nil
+}
+
+// PrintActivity writes entries to w, one line each. The name of secrets
+// still in ls, decrypted with aead, is shown to make the entries readable.
+func PrintActivity(w io.Writer, entries []ActivityEntry, ls *LocalStorage, aead cipher.AEAD) {
+	for _, e := range entries {
+		ts := time.Unix(e.Time, 0).Format(time.DateTime)
+		line := fmt.Sprintf("%s  %-6s  %s", ts, e.Op, e.ID)
+		if e.Note != "" {
+			line += "  " + e.Note
+		}
+		if sec := ls.Get(e.ID); sec != nil {
+			if name := DecryptName(aead, sec); name != "" {
+				line += "  " + truncate(name, maxNameWidth)
+			}
+		}
+		fmt.Fprintln(w, line)
+	}
+}
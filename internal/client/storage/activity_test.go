@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestAEAD returns AES-GCM with a random key.
+func newTestAEAD(t *testing.T) cipher.AEAD {
+	t.Helper()
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aead
+}
+
+func TestActivityLog(t *testing.T) {
+	aead := newTestAEAD(t)
+	path := filepath.Join(t.TempDir(), "activity.log")
+	log := NewActivityLog(path, aead)
+
+	if entries, err := log.Read(0); err != nil || len(entries) != 0 {
+		t.Fatalf("Read of missing log = %v, %v; want no entries", entries, err)
+	}
+	for _, op := range []string{ActivityAdd, ActivityView, ActivityEdit, ActivityDelete} {
+		if err := log.Record(op, "secret-id", ""); err != nil {
+			t.Fatalf("Record(%s) returned error: %v", op, err)
+		}
+	}
+
+	raw, _ := os.ReadFile(path)
+	if bytes.Contains(raw, []byte("secret-id")) || bytes.Contains(raw, []byte(ActivityView)) {
+		t.Errorf("log file is not encrypted: %s", raw)
+	}
+
+	entries, err := log.Read(2)
+	if err != nil {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Op != ActivityEdit || entries[1].Op != ActivityDelete ||
+		entries[1].ID != "secret-id" || entries[1].Time == 0 {
+		t.Errorf("entries = %+v; want the edit and delete of secret-id", entries)
+	}
+
+	var buf bytes.Buffer
+	PrintActivity(&buf, entries, &LocalStorage{Secrets: []Secret{{ID: "secret-id", Comment: "mail"}}}, fakeAEADStorage{})
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 ||
+		!strings.Contains(lines[1], "delete") || !strings.HasSuffix(lines[1], "mail") {
+		t.Errorf("PrintActivity wrote %q; want two lines with the name", buf.String())
+	}
+}
+
+func TestActivityLog_WrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "activity.log")
+	if err := NewActivityLog(path, newTestAEAD(t)).Record(ActivityAdd, "s1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewActivityLog(path, newTestAEAD(t)).Read(0); err == nil {
+		t.Error("Read with another key succeeded; want error")
+	}
+}
+
+func TestActivityLog_Nil(t *testing.T) {
+	var log *ActivityLog
+	if err := log.Record(ActivityAdd, "s1", ""); err != nil {
+		t.Errorf("Record on nil log returned error: %v", err)
+	}
+}
+
+func TestActivityLog_Rekey(t *testing.T) {
+	oldKey, newKey := newTestAEAD(t), newTestAEAD(t)
+	path := filepath.Join(t.TempDir(), "activity.log")
+	log := NewActivityLog(path, oldKey)
+	if err := log.Record(ActivityAdd, "secret-id", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := log.Rekey(newKey); err != nil {
+		t.Fatalf("Rekey returned error: %v", err)
+	}
+	if err := log.Record(ActivityView, "secret-id", ""); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := NewActivityLog(path, newKey).Read(0)
+	if err != nil || len(entries) != 2 || entries[0].Op != ActivityAdd || entries[1].Op != ActivityView {
+		t.Errorf("Read with the new key = %+v, %v; want the add and view", entries, err)
+	}
+	if _, err := NewActivityLog(path, oldKey).Read(0); err == nil {
+		t.Error("Read with the old key succeeded after Rekey")
+	}
+}
@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Aliases are user-chosen names of secrets, such as "aws-prod-db", that
+// commands accept instead of IDs. The alias map of a vault is stored as a
+// single secret of AliasType, encrypted like any other secret, so it syncs
+// with the vault. Its ID is a keyed hash, the same on every device of the
+// user and unrelated between users.
+const (
+	// AliasType is the type of the secret holding the alias map.
+	AliasType = "aliases"
+	// aliasIDPrefix starts the ID of the alias map secret.
+	aliasIDPrefix = "aliases-"
+)
+
+// ID formats of new secrets, see SetIDFormat.
+const (
+	IDFormatUUID  = "uuid"
+	IDFormatShort = "short"
+)
+
+var (
+	// ErrInvalidAlias is returned for alias names that are not slugs.
+	ErrInvalidAlias = errors.New("invalid alias: use lowercase letters, digits, '.', '_' and '-', starting with a letter")
+	// ErrAliasExists is returned when an alias names another secret.
+	ErrAliasExists = errors.New("alias already names another secret")
+
+	aliasPattern = regexp.MustCompile(`^[a-z][a-z0-9._-]{0,63}$`)
+
+	// idFormat is the format of new secret IDs.
+	idFormat = IDFormatUUID
+)
+
+// SetIDFormat sets the format of the IDs of new secrets: IDFormatUUID, or
+// IDFormatShort for 12 random base32 characters (60 bits), which are
+// easier to type. Existing secrets keep their IDs.
+func SetIDFormat(format string) error {
+	if format != IDFormatUUID && format != IDFormatShort {
+		return fmt.Errorf("unknown ID format %q, use %s or %s", format, IDFormatUUID, IDFormatShort)
+	}
+	idFormat = format
+	return nil
+}
+
+// NewID returns the ID of a new secret in the format set by SetIDFormat.
+func NewID() string {
+	if idFormat == IDFormatShort {
+		b := make([]byte, 8)
+		_, _ = rand.Read(b)
+		return strings.ToLower(base32.StdEncoding.EncodeToString(b))[:12]
+	}
+	return uuid.NewString()
+}
+
+// aliasMapID returns the ID of the alias map secret of the vault keyed by
+// key, the chunk key of the vault, see chunkKey.
+func aliasMapID(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("alias map"))
+	return aliasIDPrefix + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// aliasMap returns the ID of the alias map secret of the vault keyed by
+// aead and the secret, nil if there is none. A map saved by earlier
+// versions under the ID of legacyChunkKey is returned if there is none
+// under the ID; SetAlias moves it.
+func (ls *LocalStorage) aliasMap(aead cipher.AEAD) (string, *Secret, error) {
+	key, err := chunkKey(aead)
+	if err != nil {
+		return "", nil, err
+	}
+	id := aliasMapID(key)
+	if sec := ls.Get(id); sec != nil {
+		return id, sec, nil
+	}
+	return id, ls.Get(aliasMapID(legacyChunkKey(aead))), nil
+}
+
+// Aliases returns the alias map of the vault, mapping alias names to
+// secret IDs. Aliases of secrets deleted since are left out.
+func (ls *LocalStorage) Aliases(aead cipher.AEAD) (map[string]string, error) {
+	aliases := map[string]string{}
+	_, sec, err := ls.aliasMap(aead)
+	if err != nil || sec == nil {
+		return aliases, err
+	}
+	plain, err := Decrypt(aead, sec.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt aliases: %w", err)
+	}
+	if err := json.Unmarshal(plain, &aliases); err != nil {
+		return nil, fmt.Errorf("failed to parse aliases: %w", err)
+	}
+	for name, id := range aliases {
+		if ls.Get(id) == nil {
+			delete(aliases, name)
+		}
+	}
+	return aliases, nil
+}
+
+// SetAlias makes name an alias of the secret id, or removes the alias if
+// id is empty. A secret may have several aliases.
+func (ls *LocalStorage) SetAlias(name, id string, aead cipher.AEAD) error {
+	if !aliasPattern.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidAlias, name)
+	}
+	aliases, err := ls.Aliases(aead)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		if _, ok := aliases[name]; !ok {
+			return fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+		}
+		delete(aliases, name)
+	} else {
+		if prev, ok := aliases[name]; ok && prev != id {
+			return fmt.Errorf("%w: %s", ErrAliasExists, name)
+		}
+		aliases[name] = id
+	}
+
+	plain, err := json.Marshal(aliases)
+	if err != nil {
+		return err
+	}
+	mapID, sec, err := ls.aliasMap(aead)
+	if err != nil {
+		return err
+	}
+	if sec != nil && sec.ID != mapID {
+		// Move the map of an earlier version to its current ID
+		ls.Delete(sec.ID)
+	}
+	if ls.Edit(mapID, plain, "aliases", aead) {
+		return nil
+	}
+	data, err := Encrypt(aead, plain)
+	if err != nil {
+		return err
+	}
+	ls.Add(Secret{ID: mapID, Type: AliasType, Data: data, Comment: "aliases", Version: time.Now().Unix()})
+	return nil
+}
+
+// Resolve returns the ID of the secret referenced by ref: an alias, a full
+// ID, a unique ID prefix, see ResolveID, or the name of a secret, matched
+// ignoring case. Aliases take precedence, names are tried last.
+func (ls *LocalStorage) Resolve(ref string, aead cipher.AEAD) (string, error) {
+	if aliasPattern.MatchString(ref) {
+		aliases, err := ls.Aliases(aead)
+		if err != nil {
+			return "", err
+		}
+		if id, ok := aliases[ref]; ok {
+			return id, nil
+		}
+	}
+	id, err := ls.ResolveID(ref)
+	if !errors.Is(err, ErrSecretNotFound) {
+		return id, err
+	}
+	if named, nerr := ls.resolveName(ref, aead); nerr == nil || !errors.Is(nerr, ErrSecretNotFound) {
+		return named, nerr
+	}
+	return "", err
+}
+
+// resolveName returns the ID of the live secret named name, ignoring case.
+func (ls *LocalStorage) resolveName(name string, aead cipher.AEAD) (string, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	var match string
+	for _, s := range ls.Secrets {
+		if s.Deleted || ls.deleted[s.ID] || isInternalType(s.Type) || name == "" {
+			continue
+		}
+		if !strings.EqualFold(DecryptName(aead, &s), name) {
+			continue
+		}
+		if match != "" {
+			return "", fmt.Errorf("%w: %s", ErrAmbiguousName, name)
+		}
+		match = s.ID
+	}
+	if match == "" {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	return match, nil
+}
+
+// isInternalType reports whether secrets of typ hold client data structures
+// rather than user secrets, so that they are not listed or resolved.
+func isInternalType(typ string) bool {
+	return typ == ChunkType || typ == AliasType
+}
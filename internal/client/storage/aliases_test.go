@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAliases(t *testing.T) {
+	aead := fakeAEADStorage{}
+	ls := &LocalStorage{deleted: make(map[string]bool)}
+	ls.Add(Secret{ID: "3f2a0000-aaaa", Type: "text", Comment: "db", Version: 1})
+	ls.Add(Secret{ID: "9b1c0000-bbbb", Type: "text", Comment: "other", Version: 1})
+
+	if err := ls.SetAlias("aws-prod-db", "3f2a0000-aaaa", aead); err != nil {
+		t.Fatalf("SetAlias: %v", err)
+	}
+	if id, err := ls.Resolve("aws-prod-db", aead); err != nil || id != "3f2a0000-aaaa" {
+		t.Errorf("Resolve(alias) = %q, %v", id, err)
+	}
+	if id, err := ls.Resolve("9b1c", aead); err != nil || id != "9b1c0000-bbbb" {
+		t.Errorf("Resolve(prefix) = %q, %v", id, err)
+	}
+
+	if err := ls.SetAlias("aws-prod-db", "9b1c0000-bbbb", aead); !errors.Is(err, ErrAliasExists) {
+		t.Errorf("SetAlias(taken) error = %v; want ErrAliasExists", err)
+	}
+	for _, name := range []string{"AWS", "1db", "a b", ""} {
+		if err := ls.SetAlias(name, "9b1c0000-bbbb", aead); !errors.Is(err, ErrInvalidAlias) {
+			t.Errorf("SetAlias(%q) error = %v; want ErrInvalidAlias", name, err)
+		}
+	}
+
+	// The alias map is stored as a hidden secret
+	if out := captureList(t, ls, ListOptions{}); strings.Contains(out, aliasIDPrefix) {
+		t.Errorf("alias map is listed: %q", out)
+	}
+	if _, err := ls.ResolveID(aliasIDPrefix); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("ResolveID(alias map) error = %v; want ErrSecretNotFound", err)
+	}
+
+	// Aliases of deleted secrets are dropped
+	ls.Delete("3f2a0000-aaaa")
+	if _, err := ls.Resolve("aws-prod-db", aead); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("Resolve(alias of deleted) error = %v; want ErrSecretNotFound", err)
+	}
+	if err := ls.SetAlias("aws-prod-db", "9b1c0000-bbbb", aead); err != nil {
+		t.Fatalf("SetAlias after deletion: %v", err)
+	}
+	if err := ls.SetAlias("aws-prod-db", "", aead); err != nil {
+		t.Fatalf("removing alias: %v", err)
+	}
+	if aliases, _ := ls.Aliases(aead); len(aliases) != 0 {
+		t.Errorf("aliases after removal = %v", aliases)
+	}
+}
+
+func TestResolve_Name(t *testing.T) {
+	aead := fakeAEADStorage{}
+	ls := &LocalStorage{deleted: make(map[string]bool)}
+	for _, s := range []struct{ id, name string }{{"a1", "GitHub"}, {"b2", "Mail"}, {"c3", "mail"}} {
+		name, _ := EncryptName(aead, s.name)
+		ls.Add(Secret{ID: s.id, Type: "text", Name: name, Version: 1})
+	}
+	ls.Add(Secret{ID: "d4", Type: "text", Comment: "legacy note", Version: 1})
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr error
+	}{
+		{"github", "a1", nil},
+		{"legacy note", "d4", nil},
+		{"b2", "b2", nil},
+		{"mail", "", ErrAmbiguousName},
+		{"gitlab", "", ErrSecretNotFound},
+	}
+	for _, tt := range tests {
+		got, err := ls.Resolve(tt.ref, aead)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("Resolve(%q) = %q, %v; want %q, %v", tt.ref, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestAliases_LegacyMapID(t *testing.T) {
+	aead, _ := newAEAD(bytes.Repeat([]byte{1}, 32))
+	ls := &LocalStorage{deleted: make(map[string]bool)}
+	ls.Add(Secret{ID: "3f2a0000-aaaa", Type: "text", Version: 1})
+	ls.Add(Secret{ID: "9b1c0000-bbbb", Type: "text", Version: 1})
+	// A map saved by an earlier version
+	legacyID := aliasMapID(legacyChunkKey(aead))
+	data, _ := Encrypt(aead, []byte(`{"db":"3f2a0000-aaaa"}`))
+	ls.Add(Secret{ID: legacyID, Type: AliasType, Data: data, Version: 1})
+
+	if id, err := ls.Resolve("db", aead); err != nil || id != "3f2a0000-aaaa" {
+		t.Fatalf("Resolve(legacy alias) = %q, %v", id, err)
+	}
+	if err := ls.SetAlias("other", "9b1c0000-bbbb", aead); err != nil {
+		t.Fatalf("SetAlias returned error: %v", err)
+	}
+	if ls.Get(legacyID) != nil {
+		t.Error("map kept under the legacy ID")
+	}
+	key, _ := chunkKey(aead)
+	if ls.Get(aliasMapID(key)) == nil {
+		t.Fatal("map not saved under the current ID")
+	}
+	if aliases, err := ls.Aliases(aead); err != nil || len(aliases) != 2 {
+		t.Errorf("Aliases = %v, %v; want both aliases", aliases, err)
+	}
+}
+
+func TestNewID(t *testing.T) {
+	defer SetIDFormat(IDFormatUUID)
+
+	if id := NewID(); len(id) != 36 {
+		t.Errorf("UUID ID = %q", id)
+	}
+	if err := SetIDFormat(IDFormatShort); err != nil {
+		t.Fatalf("SetIDFormat: %v", err)
+	}
+	if a, b := NewID(), NewID(); len(a) != 12 || a == b || strings.ToLower(a) != a {
+		t.Errorf("short IDs = %q, %q", a, b)
+	}
+	if err := SetIDFormat("numeric"); err == nil {
+		t.Error("SetIDFormat(numeric) succeeded; want error")
+	}
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/atinyakov/GophKeeper/internal/limits"
+)
+
+// ChunkType is the type of secrets holding attachment chunks. Chunks are
+// synced like any other secret but hidden from listings.
+const ChunkType = "chunk"
+
+// ErrAttachmentNotFound is returned when a secret has no attachment with the given name.
+var ErrAttachmentNotFound = fmt.Errorf("attachment %w", ErrNotFound)
+
+// Attachment is a file attached to a secret. Its content is split into
+// chunks stored as separately encrypted secrets of ChunkType, referenced
+// by ID from the "attachments" list of the owning secret's payload, which
+// thus serves as the manifest of the file. See chunkstore.go.
+type Attachment struct {
+	Name   string   `json:"name"`
+	Size   int64    `json:"size"`
+	Chunks []string `json:"chunks"`
+}
+
+// Attachments returns the attachments of the secret with the given ID.
+func (ls *LocalStorage) Attachments(id string, aead cipher.AEAD) ([]Attachment, error) {
+	_, atts, err := ls.loadPayload(id, aead)
+	return atts, err
+}
+
+// AddAttachment attaches data as name to the secret with the given ID,
+// replacing an existing attachment of the same name. Files larger than
+// limits.Attachment are refused with a *limits.SizeError.
+func (ls *LocalStorage) AddAttachment(id, name string, data []byte, aead cipher.AEAD) error {
+	if len(data) > limits.Attachment {
+		return &limits.SizeError{Type: "attachment", Size: len(data), Limit: limits.Attachment}
+	}
+	payload, atts, err := ls.loadPayload(id, aead)
+	if err != nil {
+		return err
+	}
+
+	key, err := chunkKey(aead)
+	if err != nil {
+		return err
+	}
+	att := Attachment{Name: name, Size: int64(len(data))}
+	for chunk := range chunks(data) {
+		chunkID, err := ls.storeChunk(key, chunk, aead)
+		if err != nil {
+			return err
+		}
+		att.Chunks = append(att.Chunks, chunkID)
+	}
+
+	var replaced []string
+	for i, a := range atts {
+		if a.Name == name {
+			replaced = append(replaced, a.Chunks...)
+			atts[i] = att
+		}
+	}
+	if replaced == nil {
+		atts = append(atts, att)
+	}
+	if err := ls.savePayload(id, payload, atts, aead); err != nil {
+		return err
+	}
+	ls.releaseChunks(replaced, "", aead)
+	return nil
+}
+
+// ExtractAttachment writes the content of the named attachment to w.
+func (ls *LocalStorage) ExtractAttachment(id, name string, w io.Writer, aead cipher.AEAD) error {
+	_, atts, err := ls.loadPayload(id, aead)
+	if err != nil {
+		return err
+	}
+	for _, a := range atts {
+		if a.Name != name {
+			continue
+		}
+		for _, chunkID := range a.Chunks {
+			sec := ls.Get(chunkID)
+			if sec == nil {
+				return fmt.Errorf("attachment %q: chunk %s %w, sync and try again", name, chunkID, ErrNotFound)
+			}
+			chunk, err := Decrypt(aead, sec.Data)
+			if err != nil {
+				return fmt.Errorf("attachment %q: %w", name, err)
+			}
+			if _, err := w.Write(chunk); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return ErrAttachmentNotFound
+}
+
+// DeleteAttachments deletes the chunks of all attachments of the secret
+// with the given ID that no other secret references. It is called before
+// deleting the secret itself.
+func (ls *LocalStorage) DeleteAttachments(id string, aead cipher.AEAD) error {
+	_, atts, err := ls.loadPayload(id, aead)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for _, a := range atts {
+		ids = append(ids, a.Chunks...)
+	}
+	ls.releaseChunks(ids, id, aead)
+	return nil
+}
+
+// loadPayload decrypts the secret with the given ID and splits its payload
+// into the remaining fields and the attachment list. A payload that is not
+// a JSON object is kept under the "data" key.
+func (ls *LocalStorage) loadPayload(id string, aead cipher.AEAD) (map[string]json.RawMessage, []Attachment, error) {
+	sec := ls.Get(id)
+	if sec == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrSecretNotFound, id)
+	}
+	plain, err := Decrypt(aead, sec.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload := map[string]json.RawMessage{}
+	if len(bytes.TrimSpace(plain)) > 0 && json.Unmarshal(plain, &payload) != nil {
+		raw, _ := json.Marshal(string(plain))
+		payload = map[string]json.RawMessage{"data": raw}
+	}
+
+	var atts []Attachment
+	if raw, ok := payload["attachments"]; ok {
+		if err := json.Unmarshal(raw, &atts); err != nil {
+			return nil, nil, fmt.Errorf("invalid attachment list: %w", err)
+		}
+	}
+	return payload, atts, nil
+}
+
+// savePayload stores payload with the attachment list into the secret with
+// the given ID. The list must fit into limits.Manifest beyond the content
+// limit of the secret.
+func (ls *LocalStorage) savePayload(id string, payload map[string]json.RawMessage, atts []Attachment, aead cipher.AEAD) error {
+	sec := ls.Get(id)
+	if sec == nil {
+		return fmt.Errorf("%w: %s", ErrSecretNotFound, id)
+	}
+	if len(atts) > 0 {
+		raw, err := json.Marshal(atts)
+		if err != nil {
+			return err
+		}
+		payload["attachments"] = raw
+	} else {
+		delete(payload, "attachments")
+	}
+	plain, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if limit := limits.Content(sec.Type) + limits.Manifest; len(plain) > limit {
+		return fmt.Errorf("too many attachments: %w", &limits.SizeError{ID: id, Type: sec.Type, Size: len(plain), Limit: limit})
+	}
+	if !ls.Edit(id, plain, sec.Comment, aead) {
+		return fmt.Errorf("failed to update secret %s", id)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func newAttachmentStorage(t *testing.T, payload string) (*LocalStorage, string) {
+	t.Helper()
+	ls := &LocalStorage{deleted: make(map[string]bool)}
+	data, err := Encrypt(fakeAEADStorage{}, []byte(payload))
+	if err != nil {
+		t.Fatalf("Encrypt returned error: %v", err)
+	}
+	ls.Add(Secret{ID: "parent", Type: "binary", Data: data, Comment: "docs", Version: 1})
+	return ls, "parent"
+}
+
+func TestAttachments_AddListExtract(t *testing.T) {
+	aead := fakeAEADStorage{}
+	ls, id := newAttachmentStorage(t, `{"note":"scans"}`)
+
+	big := bytes.Repeat([]byte("x"), 2*chunkSize+10)
+	if err := ls.AddAttachment(id, "scan.pdf", big, aead); err != nil {
+		t.Fatalf("AddAttachment returned error: %v", err)
+	}
+	if err := ls.AddAttachment(id, "small.txt", []byte("hi"), aead); err != nil {
+		t.Fatalf("AddAttachment returned error: %v", err)
+	}
+
+	atts, err := ls.Attachments(id, aead)
+	if err != nil {
+		t.Fatalf("Attachments returned error: %v", err)
+	}
+	if len(atts) != 2 || atts[0].Name != "scan.pdf" || atts[0].Size != int64(len(big)) || len(atts[0].Chunks) != 3 {
+		t.Fatalf("unexpected attachments: %+v", atts)
+	}
+
+	var buf bytes.Buffer
+	if err := ls.ExtractAttachment(id, "scan.pdf", &buf, aead); err != nil {
+		t.Fatalf("ExtractAttachment returned error: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), big) {
+		t.Errorf("extracted %d bytes; want %d", buf.Len(), len(big))
+	}
+
+	// Other payload fields are kept.
+	plain, _ := Decrypt(aead, ls.Get(id).Data)
+	if !bytes.Contains(plain, []byte(`"note":"scans"`)) {
+		t.Errorf("payload lost fields: %s", plain)
+	}
+
+	if err := ls.ExtractAttachment(id, "missing", &buf, aead); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Errorf("ExtractAttachment error = %v; want %v", err, ErrAttachmentNotFound)
+	}
+}
+
+func TestAttachments_ReplaceAndDelete(t *testing.T) {
+	aead := fakeAEADStorage{}
+	ls, id := newAttachmentStorage(t, "free-form data")
+
+	if err := ls.AddAttachment(id, "a.txt", []byte("v1"), aead); err != nil {
+		t.Fatalf("AddAttachment returned error: %v", err)
+	}
+	atts, _ := ls.Attachments(id, aead)
+	oldChunk := atts[0].Chunks[0]
+
+	if err := ls.AddAttachment(id, "a.txt", []byte("v2"), aead); err != nil {
+		t.Fatalf("AddAttachment returned error: %v", err)
+	}
+	atts, _ = ls.Attachments(id, aead)
+	if len(atts) != 1 {
+		t.Fatalf("expected attachment to be replaced, got %+v", atts)
+	}
+	if ls.Get(oldChunk) != nil {
+		t.Error("old chunk must be deleted")
+	}
+
+	// Free-form data is preserved under the "data" key.
+	plain, _ := Decrypt(aead, ls.Get(id).Data)
+	if !bytes.Contains(plain, []byte(`"data":"free-form data"`)) {
+		t.Errorf("payload = %s", plain)
+	}
+
+	if err := ls.DeleteAttachments(id, aead); err != nil {
+		t.Fatalf("DeleteAttachments returned error: %v", err)
+	}
+	if ls.Get(atts[0].Chunks[0]) != nil {
+		t.Error("chunks must be deleted")
+	}
+}
+
+func TestClone_SharesAttachments(t *testing.T) {
+	aead := fakeAEADStorage{}
+	ls, id := newAttachmentStorage(t, `{"note":"scans"}`)
+	if err := ls.AddAttachment(id, "a.txt", []byte("content"), aead); err != nil {
+		t.Fatalf("AddAttachment returned error: %v", err)
+	}
+
+	clone, err := ls.Clone(id, aead)
+	if err != nil {
+		t.Fatalf("Clone returned error: %v", err)
+	}
+
+	orig, _ := ls.Attachments(id, aead)
+	copied, _ := ls.Attachments(clone.ID, aead)
+	if len(copied) != 1 || copied[0].Chunks[0] != orig[0].Chunks[0] {
+		t.Fatalf("clone attachments = %+v; want the chunks of the original", copied)
+	}
+
+	// Deleting the original keeps the clone's attachment intact.
+	if err := ls.DeleteAttachments(id, aead); err != nil {
+		t.Fatalf("DeleteAttachments returned error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := ls.ExtractAttachment(clone.ID, "a.txt", &buf, aead); err != nil || buf.String() != "content" {
+		t.Errorf("ExtractAttachment = %q, %v; want content", buf.String(), err)
+	}
+}
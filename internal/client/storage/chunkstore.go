@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+
+	"github.com/atinyakov/GophKeeper/internal/limits"
+)
+
+// Attachment content is kept in a content-addressed chunk store. Files are
+// cut at content-defined boundaries, so that inserting into a file changes
+// only the chunks around the insertion, and each chunk is stored once as a
+// secret of ChunkType whose ID is a keyed hash of its content. A chunk
+// already in the store, from an earlier version of the file or from the
+// same file attached elsewhere, is referenced instead of stored and synced
+// again. Chunk IDs are keyed with the vault key, so the server cannot tell
+// whether two users store the same content.
+const (
+	// minChunkSize and chunkSize bound the size of a chunk, except for the
+	// last chunk of a file.
+	minChunkSize = 64 << 10
+	chunkSize    = limits.Chunk
+
+	// chunkMask selects the rolling hashes ending a chunk: with 17 bits,
+	// a chunk ends about every 128 KiB after minChunkSize.
+	chunkMask = (1<<17 - 1) << (64 - 17)
+
+	// chunkIDPrefix starts the ID of content-addressed chunks. Chunks of
+	// attachments added by earlier versions have random IDs.
+	chunkIDPrefix = "chunk-"
+)
+
+// gear holds the values of the gear rolling hash for each byte. They are
+// fixed so that all clients cut the same content at the same boundaries.
+var gear = func() (g [256]uint64) {
+	for i := range g {
+		sum := sha256.Sum256([]byte{'g', 'e', 'a', 'r', byte(i)})
+		g[i] = binary.BigEndian.Uint64(sum[:8])
+	}
+	return g
+}()
+
+// chunks yields data in content-defined pieces of minChunkSize to
+// chunkSize bytes. Empty data yields a single empty chunk.
+func chunks(data []byte) func(yield func([]byte) bool) {
+	return func(yield func([]byte) bool) {
+		for {
+			n := chunkBoundary(data)
+			if !yield(data[:n]) || n == len(data) {
+				return
+			}
+			data = data[n:]
+		}
+	}
+}
+
+// chunkBoundary returns the length of the first chunk of data.
+func chunkBoundary(data []byte) int {
+	if len(data) <= minChunkSize {
+		return len(data)
+	}
+	end := min(len(data), chunkSize)
+	var h uint64
+	for i := minChunkSize; i < end; i++ {
+		h = h<<1 + gear[data[i]]
+		if h&chunkMask == 0 {
+			return i + 1
+		}
+	}
+	return end
+}
+
+// chunkKeyInfo is the HKDF info the chunk key is derived from the vault
+// key with.
+const chunkKeyInfo = "gophkeeper chunk id key"
+
+// errNoChunkKey is returned for AEADs not made by newAEAD, which have no
+// vault key to derive the chunk key from.
+var errNoChunkKey = errors.New("storage: the AEAD has no chunk key")
+
+// chunkKey returns the key of chunk IDs, derived from the vault key with
+// HKDF when aead was made, see newAEAD.
+func chunkKey(aead cipher.AEAD) ([]byte, error) {
+	k, ok := aead.(interface{ chunkKey() []byte })
+	if !ok {
+		return nil, errNoChunkKey
+	}
+	return k.chunkKey(), nil
+}
+
+// legacyChunkKey returns the chunk key of earlier versions, which sealed
+// a fixed text under the all-zero nonce with aead. It is only computed to
+// find the alias maps they saved, see Aliases; chunks they saved stay
+// referenced by their IDs, only new copies of their content are not
+// deduplicated against them.
+func legacyChunkKey(aead cipher.AEAD) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	sum := sha256.Sum256(aead.Seal(nil, nonce, []byte(chunkKeyInfo), nil))
+	return sum[:]
+}
+
+// chunkID returns the ID of the chunk with the given content.
+func chunkID(key, chunk []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(chunk)
+	return chunkIDPrefix + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// storeChunk stores chunk unless the store already holds it and returns
+// its ID.
+func (ls *LocalStorage) storeChunk(key, chunk []byte, aead cipher.AEAD) (string, error) {
+	id := chunkID(key, chunk)
+	if ls.Get(id) != nil {
+		return id, nil
+	}
+	enc, err := Encrypt(aead, chunk)
+	if err != nil {
+		return "", err
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	sec := Secret{ID: id, Type: ChunkType, Data: enc, Comment: "attachment chunk", Version: ls.issueVersion(0)}
+	ls.Version = sec.Version
+	// A chunk deleted earlier is revived under its ID
+	delete(ls.deleted, id)
+	for i, s := range ls.Secrets {
+		if s.ID == id {
+			ls.Secrets[i] = sec
+			return id, nil
+		}
+	}
+	ls.Secrets = append(ls.Secrets, sec)
+	return id, nil
+}
+
+// releaseChunks deletes the chunks with the given IDs that no attachment
+// references, ignoring the attachments of the secret exclude. If the
+// references cannot be determined, e.g. because a secret does not
+// decrypt, the chunks are kept: an orphaned chunk only wastes space, while
+// a missing one corrupts an attachment.
+func (ls *LocalStorage) releaseChunks(ids []string, exclude string, aead cipher.AEAD) {
+	if len(ids) == 0 {
+		return
+	}
+	refs, ok := ls.chunkRefs(exclude, aead)
+	if !ok {
+		return
+	}
+	for _, id := range ids {
+		if !refs[id] {
+			ls.Delete(id)
+		}
+	}
+}
+
+// chunkRefs returns the IDs of the chunks referenced by the attachments of
+// all live secrets except exclude. It reports false if a secret could not
+// be read.
+func (ls *LocalStorage) chunkRefs(exclude string, aead cipher.AEAD) (map[string]bool, bool) {
+	ls.mu.Lock()
+	var owners []string
+	for _, s := range ls.Secrets {
+		if s.ID != exclude && !isInternalType(s.Type) && !s.Deleted && !ls.deleted[s.ID] {
+			owners = append(owners, s.ID)
+		}
+	}
+	ls.mu.Unlock()
+
+	refs := map[string]bool{}
+	for _, id := range owners {
+		_, atts, err := ls.loadPayload(id, aead)
+		if err != nil {
+			return nil, false
+		}
+		for _, a := range atts {
+			for _, c := range a.Chunks {
+				refs[c] = true
+			}
+		}
+	}
+	return refs, true
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// randomBytes returns n deterministic pseudo-random bytes.
+func randomBytes(n int, seed uint64) []byte {
+	r := rand.New(rand.NewPCG(seed, seed))
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(r.Uint32())
+	}
+	return b
+}
+
+func TestChunks_ContentDefined(t *testing.T) {
+	data := randomBytes(2<<20, 1)
+	var sizes []int
+	for c := range chunks(data) {
+		sizes = append(sizes, len(c))
+	}
+	for i, n := range sizes[:len(sizes)-1] {
+		if n < minChunkSize || n > chunkSize {
+			t.Fatalf("chunk %d has %d bytes; want %d to %d", i, n, minChunkSize, chunkSize)
+		}
+	}
+
+	// Inserting bytes changes only the chunks around the insertion
+	key, _ := chunkKey(fakeAEADStorage{})
+	ids := func(data []byte) []string {
+		var ids []string
+		for c := range chunks(data) {
+			ids = append(ids, chunkID(key, c))
+		}
+		return ids
+	}
+	before := ids(data)
+	after := ids(slices.Insert(slices.Clone(data), 1<<20, []byte("inserted")...))
+	shared := 0
+	for _, id := range after {
+		if slices.Contains(before, id) {
+			shared++
+		}
+	}
+	if shared < len(before)-2 {
+		t.Errorf("%d of %d chunks unchanged after an insertion; want all but 2", shared, len(before))
+	}
+}
+
+func TestAttachments_Deduplicated(t *testing.T) {
+	aead := fakeAEADStorage{}
+	ls, id := newAttachmentStorage(t, `{}`)
+	data := randomBytes(1<<20, 2)
+
+	if err := ls.AddAttachment(id, "a.bin", data, aead); err != nil {
+		t.Fatalf("AddAttachment returned error: %v", err)
+	}
+	stored := len(ls.Secrets)
+	if err := ls.AddAttachment(id, "b.bin", data, aead); err != nil {
+		t.Fatalf("AddAttachment returned error: %v", err)
+	}
+	if len(ls.Secrets) != stored {
+		t.Errorf("attaching the same file again stored %d more secrets; want none", len(ls.Secrets)-stored)
+	}
+
+	// Replacing one copy keeps the chunks the other references
+	if err := ls.AddAttachment(id, "a.bin", []byte("new"), aead); err != nil {
+		t.Fatalf("AddAttachment returned error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := ls.ExtractAttachment(id, "b.bin", &buf, aead); err != nil || !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("ExtractAttachment(b.bin) = %d bytes, %v; want the original file", buf.Len(), err)
+	}
+
+	// A chunk deleted with its last reference is revived when needed again
+	if err := ls.AddAttachment(id, "b.bin", []byte("other"), aead); err != nil {
+		t.Fatalf("AddAttachment returned error: %v", err)
+	}
+	if err := ls.AddAttachment(id, "c.bin", data, aead); err != nil {
+		t.Fatalf("AddAttachment returned error: %v", err)
+	}
+	buf.Reset()
+	if err := ls.ExtractAttachment(id, "c.bin", &buf, aead); err != nil || !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("ExtractAttachment(c.bin) = %d bytes, %v; want the original file", buf.Len(), err)
+	}
+	ids := map[string]int{}
+	for _, s := range ls.Secrets {
+		ids[s.ID]++
+		if ids[s.ID] > 1 {
+			t.Errorf("secret %s is stored twice", s.ID)
+		}
+	}
+}
+
+func TestChunkKey(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	a, _ := newAEAD(key)
+	b, _ := newAEAD(key)
+	other, _ := newAEAD(bytes.Repeat([]byte{2}, 32))
+	ka, err := chunkKey(a)
+	if err != nil {
+		t.Fatalf("chunkKey returned error: %v", err)
+	}
+	kb, _ := chunkKey(b)
+	kother, _ := chunkKey(other)
+	if !bytes.Equal(ka, kb) || bytes.Equal(ka, kother) {
+		t.Error("chunk key does not depend on the vault key alone")
+	}
+	if bytes.Equal(ka, legacyChunkKey(a)) {
+		t.Error("chunk key not derived with HKDF")
+	}
+	if _, err := chunkKey(fakeAEADPromt{}); !errors.Is(err, errNoChunkKey) {
+		t.Errorf("chunkKey of a foreign AEAD = %v; want errNoChunkKey", err)
+	}
+}
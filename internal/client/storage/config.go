@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Output formats of the client, see ClientConfig.Output.
+const (
+	// OutputAuto colors the output on terminals, see output.DetectColor.
+	OutputAuto = "auto"
+	// OutputColor always colors the output.
+	OutputColor = "color"
+	// OutputPlain never colors the output.
+	OutputPlain = "plain"
+)
+
+// OutputFormats lists the output formats of the client.
+var OutputFormats = []string{OutputAuto, OutputColor, OutputPlain}
+
+// ClientConfig holds the settings the shell can change at runtime with
+// "use", and the paths of the client files, persisted in a JSON file so
+// they survive restarts. Unset fields keep the defaults of the
+// command-line flags, and flags given explicitly take precedence over the
+// file.
+type ClientConfig struct {
+	// Storage, Cert and Key are the paths of the local store, client
+	// certificate and key, relative to the config directory; empty
+	// fields take the defaults of Paths, see Files.
+	Storage string `json:"storage,omitempty"`
+	Cert    string `json:"cert,omitempty"`
+	Key     string `json:"key,omitempty"`
+	// URL is the base URL of the server.
+	URL string `json:"url,omitempty"`
+	// AutoSync tells whether the shell syncs in the background; nil
+	// means on.
+	AutoSync *bool `json:"auto_sync,omitempty"`
+	// Output is the output format, one of OutputFormats.
+	Output string `json:"output,omitempty"`
+}
+
+// LoadClientConfig reads the config stored at path. A missing file is an
+// empty config.
+func LoadClientConfig(path string) (*ClientConfig, error) {
+	var c ClientConfig
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Validate checks the values of the set fields.
+func (c *ClientConfig) Validate() error {
+	switch c.Output {
+	case "", OutputAuto, OutputColor, OutputPlain:
+	default:
+		return fmt.Errorf("unknown output format %q, use auto, color or plain", c.Output)
+	}
+	if c.URL != "" {
+		if _, err := ParseServerURL(c.URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Files returns the paths of the local store, client certificate and key:
+// those set in c, relative paths taken relative to p.ConfigDir, or else the
+// defaults of p.
+func (c *ClientConfig) Files(p Paths) (storage, cert, key string) {
+	path := func(set, def string) string {
+		if set == "" {
+			return def
+		}
+		if filepath.IsAbs(set) {
+			return set
+		}
+		return p.Config(set)
+	}
+	return path(c.Storage, p.Storage()), path(c.Cert, p.Config(CertFile)), path(c.Key, p.Config(KeyFile))
+}
+
+// AutoSyncEnabled tells whether the shell syncs in the background.
+func (c *ClientConfig) AutoSyncEnabled() bool {
+	return c.AutoSync == nil || *c.AutoSync
+}
+
+// Save writes the config to path, readable by the user only.
+func (c *ClientConfig) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
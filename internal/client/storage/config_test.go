@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClientConfig_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.json")
+
+	c, err := LoadClientConfig(path)
+	if err != nil || *c != (ClientConfig{}) || !c.AutoSyncEnabled() {
+		t.Fatalf("missing file: %+v, %v; want an empty config with auto-sync on", c, err)
+	}
+
+	off := false
+	c = &ClientConfig{URL: "https://backup.example.com", AutoSync: &off, Output: OutputPlain}
+	if err := c.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("file mode %v, %v; want 0600", fi.Mode().Perm(), err)
+	}
+	got, err := LoadClientConfig(path)
+	if err != nil {
+		t.Fatalf("LoadClientConfig: %v", err)
+	}
+	if got.URL != c.URL || got.Output != OutputPlain || got.AutoSyncEnabled() {
+		t.Errorf("loaded %+v; want %+v", got, c)
+	}
+}
+
+func TestLoadClientConfig_Invalid(t *testing.T) {
+	for _, data := range []string{
+		`{`,
+		`{"output": "json"}`,
+		`{"url": "keeper.example.com"}`,
+	} {
+		path := filepath.Join(t.TempDir(), "client.json")
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadClientConfig(path); err == nil {
+			t.Errorf("LoadClientConfig(%s): want error", data)
+		}
+	}
+}
+
+func TestClientConfig_Files(t *testing.T) {
+	p := Paths{ConfigDir: "/home/u/.config/gophkeeper", DataDir: "/home/u/.local/share/gophkeeper"}
+
+	store, cert, key := (&ClientConfig{}).Files(p)
+	if store != p.Storage() || cert != p.Config(CertFile) || key != p.Config(KeyFile) {
+		t.Errorf("defaults = %s, %s, %s; want the files in the directories of %+v", store, cert, key, p)
+	}
+
+	c := &ClientConfig{Storage: "/srv/vault.json", Cert: "work.crt", Key: "keys/work.key"}
+	store, cert, key = c.Files(p)
+	if store != "/srv/vault.json" || cert != p.Config("work.crt") || key != p.Config("keys/work.key") {
+		t.Errorf("Files = %s, %s, %s; want relative paths in the config directory", store, cert, key)
+	}
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/client/output"
+)
+
+// Choices of ResolveConflict.
+const (
+	// KeepLocal stores the local version over the server's.
+	KeepLocal = "local"
+	// KeepRemote drops the local version for the server's.
+	KeepRemote = "remote"
+	// KeepBoth keeps the server's version and stores the local one as a
+	// new secret.
+	KeepBoth = "both"
+)
+
+// ErrNoConflict is returned by ResolveConflict for secrets without a
+// pending conflict.
+var ErrNoConflict = fmt.Errorf("conflict %w", ErrNotFound)
+
+// localCopySuffix is appended to the name of the local version kept as a
+// new secret by KeepBoth.
+const localCopySuffix = " (local copy)"
+
+// PendingConflicts returns the concurrent edits reported by the servers
+// and not resolved yet, in the order they were reported. Their secrets are
+// not uploaded until resolved, see ResolveConflict, so that the next sync
+// does not silently store one version over the other.
+func (ls *LocalStorage) PendingConflicts() []SyncConflict {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return slices.Clone(ls.Conflicts)
+}
+
+// addConflicts records the concurrent conflicts among conflicts, replacing
+// pending ones of the same secrets. Conflicts lacking either version, e.g.
+// from servers that do not send them, cannot be resolved and are left to
+// the sync log. ls.mu must be held.
+func (ls *LocalStorage) addConflicts(conflicts []SyncConflict) {
+	for _, c := range conflicts {
+		if !c.Concurrent || c.Client == nil || c.Server == nil {
+			continue
+		}
+		if i := slices.IndexFunc(ls.Conflicts, func(p SyncConflict) bool { return p.ID == c.ID }); i >= 0 {
+			ls.Conflicts[i] = c
+		} else {
+			ls.Conflicts = append(ls.Conflicts, c)
+		}
+	}
+}
+
+// conflictIDs returns the IDs of the secrets with pending conflicts.
+// ls.mu must be held.
+func (ls *LocalStorage) conflictIDs() map[string]bool {
+	ids := make(map[string]bool, len(ls.Conflicts))
+	for _, c := range ls.Conflicts {
+		ids[c.ID] = true
+	}
+	return ids
+}
+
+// ResolveConflict resolves the pending conflict of the secret id by
+// choice: KeepLocal, KeepRemote or KeepBoth. The local version is stored
+// under a new version, so that the next sync writes it to the servers;
+// KeepBoth stores it under a new ID, with localCopySuffix appended to its
+// name, and returns that copy. The other choices return the secret kept.
+func (ls *LocalStorage) ResolveConflict(id, choice string, aead cipher.AEAD) (*Secret, error) {
+	if choice != KeepLocal && choice != KeepRemote && choice != KeepBoth {
+		return nil, fmt.Errorf("unknown choice %q, use %s, %s or %s", choice, KeepLocal, KeepRemote, KeepBoth)
+	}
+	ls.mu.Lock()
+	i := slices.IndexFunc(ls.Conflicts, func(c SyncConflict) bool { return c.ID == id })
+	if i < 0 {
+		ls.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrNoConflict, id)
+	}
+	c := ls.Conflicts[i]
+	ls.mu.Unlock()
+
+	var copied Secret
+	if choice == KeepBoth {
+		plain, err := Decrypt(aead, c.Client.Data)
+		if err != nil {
+			return nil, err
+		}
+		copied = *c.Client
+		copied.ID = NewID()
+		copied.Tags = slices.Clone(c.Client.Tags)
+		if copied.Data, err = Encrypt(aead, plain); err != nil {
+			return nil, err
+		}
+		if copied.Name, err = EncryptName(aead, DecryptName(aead, c.Client)+localCopySuffix); err != nil {
+			return nil, err
+		}
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.Conflicts = slices.DeleteFunc(ls.Conflicts, func(p SyncConflict) bool { return p.ID == id })
+	j := slices.IndexFunc(ls.Secrets, func(s Secret) bool { return s.ID == id })
+	kept := *c.Server
+	if choice == KeepLocal {
+		prev := c.ServerVersion
+		if j >= 0 {
+			prev = max(prev, ls.Secrets[j].Version)
+		}
+		kept = *c.Client
+		kept.Version = ls.issueVersion(prev)
+	}
+	if j >= 0 {
+		ls.Secrets[j] = kept
+	} else {
+		ls.Secrets = append(ls.Secrets, kept)
+	}
+	if ls.deleted != nil {
+		delete(ls.deleted, id)
+	}
+	if choice == KeepBoth {
+		copied.Version = ls.issueVersion(copied.Version)
+		ls.Secrets = append(ls.Secrets, copied)
+		return &copied, nil
+	}
+	return &kept, nil
+}
+
+// Differences names what differs between the two versions of a concurrent
+// conflict: the metadata fields the server reported, and the name and data
+// if they differ once decrypted with aead.
+func (c SyncConflict) Differences(aead cipher.AEAD) []string {
+	diff := slices.Clone(c.Changed)
+	if c.Client == nil || c.Server == nil {
+		return diff
+	}
+	if DecryptName(aead, c.Client) != DecryptName(aead, c.Server) {
+		diff = append(diff, "name")
+	}
+	local, errLocal := Decrypt(aead, c.Client.Data)
+	remote, errRemote := Decrypt(aead, c.Server.Data)
+	if errLocal != nil || errRemote != nil || !bytes.Equal(local, remote) {
+		diff = append(diff, "data")
+	}
+	return diff
+}
+
+// Print writes both versions of a concurrent conflict to w, with the
+// differences between them, so that the user can choose one. Names and
+// data are decrypted with aead; the data of reprompt secrets is hidden.
+func (c SyncConflict) Print(w io.Writer, aead cipher.AEAD) {
+	now := time.Now()
+	fmt.Fprintf(w, "Conflict %s, edited here %s and on the server %s\n", c.ID,
+		FormatAge(now, time.Unix(c.Version, 0)), FormatAge(now, time.Unix(c.ServerVersion, 0)))
+	if diff := c.Differences(aead); len(diff) > 0 {
+		fmt.Fprintf(w, "Differs in: %s\n", strings.Join(diff, ", "))
+	}
+	for _, v := range []struct {
+		title string
+		sec   *Secret
+	}{{"Local version:", c.Client}, {"Server version:", c.Server}} {
+		if v.sec == nil {
+			continue
+		}
+		fmt.Fprintln(w, output.Paint(v.title, output.Bold))
+		if v.sec.Reprompt {
+			PrintSecretHidden(w, v.sec, aead, "(hidden)")
+		} else {
+			PrintSecret(w, v.sec, aead)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestConflict returns storage holding the local version of s1 and a
+// pending concurrent conflict with the server's version, encrypted with
+// the returned key.
+func newTestConflict(t *testing.T) (*LocalStorage, cipher.AEAD, *Secret, *Secret) {
+	t.Helper()
+	aead := newTestAEAD(t)
+	encrypt := func(s string) string {
+		enc, err := Encrypt(aead, []byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return enc
+	}
+	local := &Secret{ID: "s1", Type: "text", Name: encrypt("mail"), Data: encrypt("local"), Version: 20, Tags: []string{"work"}}
+	remote := &Secret{ID: "s1", Type: "text", Name: encrypt("mail"), Data: encrypt("remote"), Version: 15, Comment: "edited"}
+	ls := &LocalStorage{Secrets: []Secret{*local}}
+	ls.addConflicts([]SyncConflict{{ID: "s1", Version: 20, ServerVersion: 15, Concurrent: true, Client: local, Server: remote, Changed: []string{"comment", "tags"}}})
+	return ls, aead, local, remote
+}
+
+func TestResolveConflict(t *testing.T) {
+	t.Run("local", func(t *testing.T) {
+		ls, aead, local, _ := newTestConflict(t)
+		kept, err := ls.ResolveConflict("s1", KeepLocal, aead)
+		if err != nil {
+			t.Fatalf("ResolveConflict returned error: %v", err)
+		}
+		if kept.Data != local.Data || kept.Version <= 20 {
+			t.Errorf("kept %+v; want the local data under a version above 20", kept)
+		}
+		if got := ls.Get("s1"); got == nil || got.Version != kept.Version {
+			t.Errorf("stored %+v; want version %d", got, kept.Version)
+		}
+		if len(ls.PendingConflicts()) != 0 {
+			t.Error("conflict still pending")
+		}
+	})
+
+	t.Run("remote", func(t *testing.T) {
+		ls, aead, _, remote := newTestConflict(t)
+		if _, err := ls.ResolveConflict("s1", KeepRemote, aead); err != nil {
+			t.Fatalf("ResolveConflict returned error: %v", err)
+		}
+		if got := ls.Get("s1"); got == nil || got.Data != remote.Data || got.Version != 15 || got.Comment != "edited" {
+			t.Errorf("stored %+v; want the server's copy", got)
+		}
+		if len(ls.Secrets) != 1 || len(ls.PendingConflicts()) != 0 {
+			t.Errorf("secrets %d, conflicts %d; want 1 and 0", len(ls.Secrets), len(ls.PendingConflicts()))
+		}
+	})
+
+	t.Run("both", func(t *testing.T) {
+		ls, aead, _, remote := newTestConflict(t)
+		copied, err := ls.ResolveConflict("s1", KeepBoth, aead)
+		if err != nil {
+			t.Fatalf("ResolveConflict returned error: %v", err)
+		}
+		if got := ls.Get("s1"); got == nil || got.Data != remote.Data {
+			t.Errorf("s1 = %+v; want the server's copy", got)
+		}
+		if copied.ID == "s1" || ls.Get(copied.ID) == nil {
+			t.Fatalf("copy %+v not stored under a new ID", copied)
+		}
+		if name := DecryptName(aead, copied); name != "mail"+localCopySuffix {
+			t.Errorf("copy name = %q; want %q", name, "mail"+localCopySuffix)
+		}
+		if data, err := Decrypt(aead, copied.Data); err != nil || string(data) != "local" {
+			t.Errorf("copy data = %q, %v; want local", data, err)
+		}
+		if !slices.Equal(copied.Tags, []string{"work"}) {
+			t.Errorf("copy tags = %v; want [work]", copied.Tags)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		ls, aead, _, _ := newTestConflict(t)
+		if _, err := ls.ResolveConflict("s1", "mine", aead); err == nil {
+			t.Error("expected error for an unknown choice")
+		}
+		if _, err := ls.ResolveConflict("s2", KeepLocal, aead); !errors.Is(err, ErrNoConflict) || !errors.Is(err, ErrNotFound) {
+			t.Errorf("err = %v; want ErrNoConflict", err)
+		}
+		if len(ls.PendingConflicts()) != 1 {
+			t.Error("failed resolutions dropped the conflict")
+		}
+	})
+}
+
+func TestSyncConflict_Differences(t *testing.T) {
+	_, aead, local, remote := newTestConflict(t)
+	c := SyncConflict{ID: "s1", Concurrent: true, Client: local, Server: remote, Changed: []string{"comment"}}
+	if got := c.Differences(aead); !slices.Equal(got, []string{"comment", "data"}) {
+		t.Errorf("Differences = %v; want [comment data]", got)
+	}
+	c.Server = local
+	c.Changed = nil
+	if got := c.Differences(aead); len(got) != 0 {
+		t.Errorf("Differences of equal versions = %v; want none", got)
+	}
+
+	var buf bytes.Buffer
+	c.Server = remote
+	c.Print(&buf, aead)
+	for _, want := range []string{"Conflict s1", "Differs in: data", "Local version:", "Server version:"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Print output lacks %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestSyncWithServers_PendingConflicts(t *testing.T) {
+	dir := t.TempDir()
+	origDir, _ := os.Getwd()
+	defer func() { _ = os.Chdir(origDir) }()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server holds a concurrent edit of s1 and reports the conflict
+	var uploaded []string
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		var payload struct {
+			Secrets []Secret `json:"secrets"`
+		}
+		_ = json.NewDecoder(req.Body).Decode(&payload)
+		uploaded = uploaded[:0]
+		for _, sec := range payload.Secrets {
+			uploaded = append(uploaded, sec.ID)
+		}
+		resp := map[string]any{
+			"secrets": []Secret{{ID: "s1", Data: "server", Version: 4}, {ID: "s2", Version: 1}},
+			"version": int64(4),
+		}
+		if slices.Contains(uploaded, "s1") {
+			resp["conflicts"] = []SyncConflict{{
+				ID: "s1", Version: 5, ServerVersion: 4, Concurrent: true,
+				Client: &Secret{ID: "s1", Data: "edited", Version: 5},
+				Server: &Secret{ID: "s1", Data: "server", Version: 4},
+			}, {ID: "s3", Version: 2, ServerVersion: 3}}
+		}
+		body, _ := json.Marshal(resp)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body))}, nil
+	})
+
+	ls := &LocalStorage{Secrets: []Secret{{ID: "s1", Data: "edited", Version: 5}, {ID: "s2", Version: 1}}}
+	if err := SyncWithServer(client, "http://a.example", ls); err != nil {
+		t.Fatalf("SyncWithServer returned error: %v", err)
+	}
+	// Only the concurrent conflict is pending
+	pending := ls.PendingConflicts()
+	if len(pending) != 1 || pending[0].ID != "s1" {
+		t.Fatalf("pending conflicts = %+v; want s1", pending)
+	}
+
+	// Until resolved, s1 is not uploaded again
+	if err := SyncWithServer(client, "http://a.example", ls); err != nil {
+		t.Fatalf("SyncWithServer returned error: %v", err)
+	}
+	if slices.Contains(uploaded, "s1") {
+		t.Errorf("uploaded %v; want s1 held back", uploaded)
+	}
+	if len(ls.PendingConflicts()) != 1 {
+		t.Error("conflict dropped by a sync")
+	}
+}
@@ -3,14 +3,22 @@ package storage
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
 )
 
 // NewAEADFromKeyPEM parses a PEM-encoded private key (RSA or ECDSA),
 // hashes its DER bytes to a 32-byte key, and returns an AES-GCM AEAD.
+// Vaults were encrypted with this key before they had a master password;
+// it is only used to migrate them, see SetMasterPassword.
 func NewAEADFromKeyPEM(keyPEM []byte) (cipher.AEAD, error) {
 	block, _ := pem.Decode(keyPEM)
 	if block == nil {
@@ -38,7 +46,13 @@ func NewAEADFromKeyPEM(keyPEM []byte) (cipher.AEAD, error) {
 
 	// derive 32-byte key by hashing the private-key DER
 	sum := sha256.Sum256(der)
-	blockCipher, err := aes.NewCipher(sum[:])
+	return newAEAD(sum[:])
+}
+
+// newAEAD returns an AES-GCM AEAD with the 32-byte key, which also holds
+// the chunk key derived from key, see chunkKey.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	blockCipher, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, fmt.Errorf("storage: aes.NewCipher: %w", err)
 	}
@@ -46,5 +60,103 @@ func NewAEADFromKeyPEM(keyPEM []byte) (cipher.AEAD, error) {
 	if err != nil {
 		return nil, fmt.Errorf("storage: cipher.NewGCM: %w", err)
 	}
-	return aead, nil
+	chunk := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, []byte(chunkKeyInfo)), chunk); err != nil {
+		return nil, fmt.Errorf("storage: derive chunk key: %w", err)
+	}
+	return vaultAEAD{AEAD: aead, chunk: chunk}, nil
+}
+
+// vaultAEAD is the AEAD of a vault key together with the keys derived
+// from it for other uses, as the key itself is not kept.
+type vaultAEAD struct {
+	cipher.AEAD
+	chunk []byte
+}
+
+func (a vaultAEAD) chunkKey() []byte { return a.chunk }
+
+// Encrypt seals plain with aead under a fresh random nonce and returns
+// base64(nonce || ciphertext), the format stored in Secret.Data.
+func Encrypt(aead cipher.AEAD, plain []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("storage: generate nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// Decrypt opens data produced by Encrypt. Its errors match ErrDecryption.
+func Decrypt(aead cipher.AEAD, data string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("storage: %w: decode: %w", ErrDecryption, err)
+	}
+	if len(raw) < aead.NonceSize() {
+		return nil, fmt.Errorf("storage: %w: ciphertext too short", ErrDecryption)
+	}
+	plain, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("storage: %w: %w", ErrDecryption, err)
+	}
+	return plain, nil
+}
+
+// EncryptName encrypts the name of a secret with aead like its data, so
+// the server never sees it. The empty name stays empty.
+func EncryptName(aead cipher.AEAD, name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	return Encrypt(aead, []byte(name))
+}
+
+// DecryptName returns the name of sec decrypted with aead, or "" if aead
+// does not decrypt it. Secrets stored before they had names return their
+// comment, which served as the name until then.
+func DecryptName(aead cipher.AEAD, sec *Secret) string {
+	if sec.Name == "" {
+		return sec.Comment
+	}
+	name, err := Decrypt(aead, sec.Name)
+	if err != nil {
+		return ""
+	}
+	return string(name)
+}
+
+// RenewNonces re-encrypts under fresh random nonces the secrets whose
+// nonce is all zeros or shared with another secret, as written by tools
+// that sealed every value under a fixed nonce: with AES-GCM, two values
+// under one nonce leak their XOR and allow forging. Encrypt never reuses
+// nonces, so vaults written by this client are left as they are. Renewed
+// secrets get a new version, so that the server keeps them in the new
+// form too; their number is returned. Secrets aead does not decrypt are
+// skipped. The caller saves ls.
+func (ls *LocalStorage) RenewNonces(aead cipher.AEAD) (int, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	seen := make(map[string]bool)
+	renewed := 0
+	for i, sec := range ls.Secrets {
+		raw, err := base64.StdEncoding.DecodeString(sec.Data)
+		if err != nil || len(raw) < aead.NonceSize() {
+			continue
+		}
+		nonce := string(raw[:aead.NonceSize()])
+		if !seen[nonce] && strings.Trim(nonce, "\x00") != "" {
+			seen[nonce] = true
+			continue
+		}
+		plain, err := Decrypt(aead, sec.Data)
+		if err != nil {
+			continue
+		}
+		if ls.Secrets[i].Data, err = Encrypt(aead, plain); err != nil {
+			return renewed, err
+		}
+		ls.Secrets[i].Version = ls.issueVersion(sec.Version)
+		renewed++
+	}
+	return renewed, nil
 }
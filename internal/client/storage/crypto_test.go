@@ -2,9 +2,11 @@ package storage
 
 import (
 	"bytes"
+	"crypto/cipher"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"testing"
 )
@@ -45,3 +47,77 @@ func TestNewAEADFromKeyPEM(t *testing.T) {
 		t.Errorf("unexpected plaintext: got %q, want %q", plain, "helloworld")
 	}
 }
+
+// sealWithNonce encrypts plain like Encrypt, but under the given nonce.
+func sealWithNonce(aead cipher.AEAD, nonce []byte, plain string) string {
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(plain), nil))
+}
+
+func TestRenewNonces(t *testing.T) {
+	aead := newTestAEAD(t)
+	zero := make([]byte, aead.NonceSize())
+	shared := bytes.Repeat([]byte{7}, aead.NonceSize())
+	fresh, err := Encrypt(aead, []byte("fresh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign := sealWithNonce(newTestAEAD(t), zero, "foreign")
+	ls := &LocalStorage{Secrets: []Secret{
+		{ID: "zero", Data: sealWithNonce(aead, zero, "zero"), Version: 1},
+		{ID: "first", Data: sealWithNonce(aead, shared, "first"), Version: 2},
+		{ID: "second", Data: sealWithNonce(aead, shared, "second"), Version: 3},
+		{ID: "fresh", Data: fresh, Version: 4},
+		{ID: "foreign", Data: foreign, Version: 5},
+	}}
+
+	renewed, err := ls.RenewNonces(aead)
+	if err != nil {
+		t.Fatalf("RenewNonces returned error: %v", err)
+	}
+	if renewed != 2 {
+		t.Errorf("renewed = %d, want the zero and the second shared nonce", renewed)
+	}
+	nonces := map[string]bool{}
+	for _, sec := range ls.Secrets[:4] {
+		plain, err := Decrypt(aead, sec.Data)
+		if err != nil || string(plain) != sec.ID {
+			t.Errorf("secret %s decrypts to %q, %v", sec.ID, plain, err)
+		}
+		raw, _ := base64.StdEncoding.DecodeString(sec.Data)
+		nonce := string(raw[:aead.NonceSize()])
+		if nonces[nonce] || nonce == string(zero) {
+			t.Errorf("secret %s kept a reused nonce", sec.ID)
+		}
+		nonces[nonce] = true
+	}
+	if ls.Secrets[0].Version <= 1 || ls.Secrets[2].Version <= 3 {
+		t.Errorf("renewed secrets kept their versions: %+v", ls.Secrets)
+	}
+	if ls.Secrets[1].Version != 2 || ls.Secrets[3].Data != fresh || ls.Secrets[4].Data != foreign {
+		t.Errorf("secrets with unique nonces or another key changed: %+v", ls.Secrets)
+	}
+
+	if renewed, err := ls.RenewNonces(aead); err != nil || renewed != 0 {
+		t.Errorf("second RenewNonces = %d, %v; want nothing to renew", renewed, err)
+	}
+}
+
+func TestDecryptName(t *testing.T) {
+	aead := newTestAEAD(t)
+	name, err := EncryptName(aead, "GitHub")
+	if err != nil || name == "" || name == "GitHub" {
+		t.Fatalf("EncryptName = %q, %v; want the encrypted name", name, err)
+	}
+	if got := DecryptName(aead, &Secret{Name: name, Comment: "work account"}); got != "GitHub" {
+		t.Errorf("DecryptName = %q; want GitHub", got)
+	}
+	if got := DecryptName(aead, &Secret{Comment: "legacy"}); got != "legacy" {
+		t.Errorf("DecryptName without a name = %q; want the comment", got)
+	}
+	if got := DecryptName(newTestAEAD(t), &Secret{Name: name}); got != "" {
+		t.Errorf("DecryptName with another key = %q; want empty", got)
+	}
+	if empty, err := EncryptName(aead, ""); err != nil || empty != "" {
+		t.Errorf("EncryptName(\"\") = %q, %v; want empty", empty, err)
+	}
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/atinyakov/GophKeeper/internal/limits"
+)
+
+// EnvVar is a variable read from a dotenv file.
+type EnvVar struct {
+	Key   string
+	Value string
+}
+
+// ParseDotenv reads variables in the dotenv format: KEY=VALUE lines,
+// optionally starting with "export". Blank lines and lines starting with
+// "#" are skipped. Values in single quotes are taken literally; values in
+// double quotes may span lines and expand \n, \r, \t, \" and \\. Unquoted
+// values are trimmed and end at " #", which starts a comment. Variables
+// are returned in order of first appearance; a key set twice keeps the
+// later value, as when the file is sourced by a shell.
+func ParseDotenv(r io.Reader) ([]EnvVar, error) {
+	var (
+		vars  []EnvVar
+		index = map[string]int{}
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, limits.Text+4096)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		start := lineNo
+		// Trailing blanks are kept for values in double quotes spanning lines
+		line := strings.TrimLeft(scanner.Text(), " \t")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !validEnvKey(key) {
+			return nil, fmt.Errorf("line %d: want KEY=VALUE", start)
+		}
+		value = strings.TrimLeft(value, " \t")
+
+		switch {
+		case strings.HasPrefix(value, "'"):
+			end := strings.IndexByte(value[1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated single quote", start)
+			}
+			value = value[1 : end+1]
+		case strings.HasPrefix(value, `"`):
+			// The value continues on the next lines until the closing quote
+			raw := value[1:]
+			for {
+				v, ok := unquoteEnv(raw)
+				if ok {
+					value = v
+					break
+				}
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("line %d: unterminated double quote", start)
+				}
+				lineNo++
+				raw += "\n" + scanner.Text()
+			}
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = value[:i]
+			}
+			value = strings.TrimSpace(value)
+		}
+
+		if i, ok := index[key]; ok {
+			vars[i].Value = value
+			continue
+		}
+		index[key] = len(vars)
+		vars = append(vars, EnvVar{Key: key, Value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// unquoteEnv expands the escapes of a double-quoted dotenv value up to its
+// closing quote; raw is the text after the opening quote. It reports false
+// if raw has no closing quote.
+func unquoteEnv(raw string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '"':
+			return b.String(), true
+		case c == '\\' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\':
+				b.WriteByte(raw[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(raw[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", false
+}
+
+// validEnvKey reports whether key is a valid variable name: letters,
+// digits, underscores, dots and dashes, not starting with a digit.
+func validEnvKey(key string) bool {
+	if key == "" || key[0] >= '0' && key[0] <= '9' {
+		return false
+	}
+	for _, c := range []byte(key) {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// EnvImport is the outcome of ImportEnv.
+type EnvImport struct {
+	// Added are the IDs of the new secrets.
+	Added []string
+	// Updated are the IDs of the secrets whose value changed.
+	Updated []string
+	// Unchanged is the number of variables already stored with their value.
+	Unchanged int
+}
+
+// ImportEnv stores each variable as a text secret in folder, with the key
+// as its name and the value as its data. A live text secret in folder
+// with the key as name is updated instead, so that importing a file
+// again only stores the changed values. All values are checked against the
+// size limit before any is stored.
+func (ls *LocalStorage) ImportEnv(vars []EnvVar, folder string, aead cipher.AEAD) (EnvImport, error) {
+	var res EnvImport
+	for _, v := range vars {
+		if err := limits.CheckContent("text", []byte(v.Value)); err != nil {
+			return res, fmt.Errorf("%s: %w", v.Key, err)
+		}
+	}
+	folder = strings.Trim(strings.TrimSpace(folder), "/")
+
+	ls.mu.Lock()
+	existing := map[string]Secret{}
+	for _, s := range ls.Secrets {
+		if s.Type == "text" && s.Folder == folder && !s.Deleted && !ls.deleted[s.ID] {
+			existing[DecryptName(aead, &s)] = s
+		}
+	}
+	ls.mu.Unlock()
+
+	for _, v := range vars {
+		if s, ok := existing[v.Key]; ok {
+			if plain, err := Decrypt(aead, s.Data); err == nil && bytes.Equal(plain, []byte(v.Value)) {
+				res.Unchanged++
+				continue
+			}
+			if !ls.Edit(s.ID, []byte(v.Value), s.Comment, aead) {
+				return res, fmt.Errorf("%s: failed to update secret %s", v.Key, s.ID)
+			}
+			res.Updated = append(res.Updated, s.ID)
+			continue
+		}
+		data, err := Encrypt(aead, []byte(v.Value))
+		if err != nil {
+			return res, fmt.Errorf("%s: %w", v.Key, err)
+		}
+		name, err := EncryptName(aead, v.Key)
+		if err != nil {
+			return res, fmt.Errorf("%s: %w", v.Key, err)
+		}
+		sec := Secret{
+			ID:      NewID(),
+			Type:    "text",
+			Data:    data,
+			Name:    name,
+			Folder:  folder,
+			Version: ls.now().Unix(),
+		}
+		ls.Add(sec)
+		res.Added = append(res.Added, sec.ID)
+	}
+	return res, nil
+}
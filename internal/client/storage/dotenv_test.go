@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	in := `# database
+DB_HOST=localhost
+export DB_USER = app
+DB_PASS='p#ss "quoted"'
+GREETING="hello\n\"world\""
+CERT="-----BEGIN-----
+abc
+-----END-----"
+EMPTY=
+PORT=5432 # default
+DB_HOST=db.internal
+`
+	got, err := ParseDotenv(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseDotenv: %v", err)
+	}
+	want := []EnvVar{
+		{"DB_HOST", "db.internal"},
+		{"DB_USER", "app"},
+		{"DB_PASS", `p#ss "quoted"`},
+		{"GREETING", "hello\n\"world\""},
+		{"CERT", "-----BEGIN-----\nabc\n-----END-----"},
+		{"EMPTY", ""},
+		{"PORT", "5432"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDotenv = %q; want %q", got, want)
+	}
+}
+
+func TestParseDotenv_Invalid(t *testing.T) {
+	for _, in := range []string{
+		"JUST_A_KEY",
+		"1KEY=x",
+		"BAD KEY=x",
+		"KEY='open",
+		"OK=1\nKEY=\"open\nstill open",
+	} {
+		if _, err := ParseDotenv(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseDotenv(%q): want error", in)
+		}
+	}
+}
+
+func TestImportEnv(t *testing.T) {
+	ls := &LocalStorage{deleted: make(map[string]bool)}
+	aead := fakeAEADStorage{}
+	vars := []EnvVar{{"DB_HOST", "localhost"}, {"DB_PASS", "secret"}}
+
+	res, err := ls.ImportEnv(vars, "myapp/", aead)
+	if err != nil || len(res.Added) != 2 || len(res.Updated) != 0 {
+		t.Fatalf("first import: %+v, %v; want 2 added", res, err)
+	}
+	sec := ls.Get(res.Added[1])
+	if sec.Type != "text" || DecryptName(aead, sec) != "DB_PASS" || sec.Folder != "myapp" {
+		t.Errorf("secret %+v; want text DB_PASS in myapp", sec)
+	}
+	if plain, err := Decrypt(aead, sec.Data); err != nil || string(plain) != "secret" {
+		t.Errorf("data %q, %v; want secret", plain, err)
+	}
+
+	// Importing again updates changed values only; other folders are apart
+	vars[1].Value = "rotated"
+	vars = append(vars, EnvVar{"API_KEY", "k"})
+	res, err = ls.ImportEnv(vars, "myapp", aead)
+	if err != nil || len(res.Added) != 1 || len(res.Updated) != 1 || res.Unchanged != 1 {
+		t.Fatalf("second import: %+v, %v; want 1 added, 1 updated, 1 unchanged", res, err)
+	}
+	if plain, _ := Decrypt(aead, ls.Get(sec.ID).Data); string(plain) != "rotated" {
+		t.Errorf("updated data %q; want rotated", plain)
+	}
+	if res, err = ls.ImportEnv(vars[:1], "other", aead); err != nil || len(res.Added) != 1 {
+		t.Errorf("import into another folder: %+v, %v; want 1 added", res, err)
+	}
+}
+
+func TestImportEnv_TooLarge(t *testing.T) {
+	ls := &LocalStorage{deleted: make(map[string]bool)}
+	vars := []EnvVar{{"SMALL", "x"}, {"HUGE", strings.Repeat("x", 2<<20)}}
+	if _, err := ls.ImportEnv(vars, "", fakeAEADStorage{}); err == nil || len(ls.Secrets) != 0 {
+		t.Errorf("ImportEnv = %v with %d secrets stored; want an error and none stored", err, len(ls.Secrets))
+	}
+}
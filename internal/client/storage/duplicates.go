@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"cmp"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/client/output"
+)
+
+// Match kinds of duplicate groups.
+const (
+	// MatchLogin groups secrets with the same login and URL.
+	MatchLogin = "login and URL"
+	// MatchFile groups binary secrets with the same content and attachments.
+	MatchFile = "file hash"
+	// MatchContent groups secrets with the same decrypted content.
+	MatchContent = "content"
+)
+
+// loginFields and urlFields name the payload fields identifying the
+// account of a structured secret, in order of preference.
+var (
+	loginFields = []string{"login", "username", "user", "email"}
+	urlFields   = []string{"url", "uri", "website", "dsn", "host"}
+)
+
+// DuplicateGroup is a set of live secrets of one type holding the same
+// credentials or file.
+type DuplicateGroup struct {
+	Type string
+	// Match is what the secrets have in common: MatchLogin, MatchFile or
+	// MatchContent.
+	Match string
+	// Secrets are the duplicates, most recently modified first.
+	Secrets []Secret
+}
+
+// FindDuplicates decrypts the vault and returns the groups of duplicate
+// secrets, largest first. Structured secrets with a login or URL field
+// are duplicates if both match, ignoring case and the URL scheme; binary
+// secrets if their content and attachments hash alike; other secrets if
+// their content is identical. Attachments themselves, chunks and secrets
+// that cannot be decrypted are left out.
+func (ls *LocalStorage) FindDuplicates(aead cipher.AEAD) []DuplicateGroup {
+	ls.mu.Lock()
+	var live []Secret
+	for _, s := range ls.Secrets {
+		if !isInternalType(s.Type) && !s.Deleted && !ls.deleted[s.ID] {
+			live = append(live, s)
+		}
+	}
+	ls.mu.Unlock()
+
+	groups := map[string]*DuplicateGroup{}
+	var keys []string
+	for _, s := range live {
+		plain, err := Decrypt(aead, s.Data)
+		if err != nil {
+			continue
+		}
+		key, match := duplicateKey(s.Type, plain)
+		key = s.Type + "\x00" + key
+		g, ok := groups[key]
+		if !ok {
+			g = &DuplicateGroup{Type: s.Type, Match: match}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		g.Secrets = append(g.Secrets, s)
+	}
+
+	var dups []DuplicateGroup
+	for _, key := range keys {
+		g := groups[key]
+		if len(g.Secrets) < 2 {
+			continue
+		}
+		slices.SortStableFunc(g.Secrets, func(a, b Secret) int { return cmp.Compare(b.Version, a.Version) })
+		dups = append(dups, *g)
+	}
+	slices.SortStableFunc(dups, func(a, b DuplicateGroup) int { return cmp.Compare(len(b.Secrets), len(a.Secrets)) })
+	return dups
+}
+
+// Print writes the group as a numbered table to w, so that a secret can
+// be chosen by its number. Names are decrypted with aead.
+func (g DuplicateGroup) Print(w io.Writer, aead cipher.AEAD) {
+	fmt.Fprintf(w, "%d %s secrets with the same %s:\n", len(g.Secrets), output.Paint(g.Type, output.TypeStyle(g.Type)), g.Match)
+	now := time.Now()
+	var tbl output.Table
+	tbl.Header("#", "ID", "FOLDER", "NAME", "TAGS", "AGE")
+	for i, s := range g.Secrets {
+		tbl.Row(
+			output.Cell{Text: strconv.Itoa(i + 1)},
+			output.Cell{Text: shortID(s.ID), Style: output.Dim},
+			output.Cell{Text: s.Folder},
+			output.Cell{Text: truncate(DecryptName(aead, &s), maxNameWidth)},
+			output.Cell{Text: strings.Join(s.Tags, ",")},
+			output.Cell{Text: FormatAge(now, time.Unix(s.Version, 0))},
+		)
+	}
+	_ = tbl.Write(w)
+}
+
+// duplicateKey returns the key under which a decrypted payload of the
+// given type is compared, and the kind of match it stands for.
+func duplicateKey(typ string, plain []byte) (key, match string) {
+	var payload map[string]any
+	if json.Unmarshal(plain, &payload) != nil {
+		return hashContent(plain), MatchContent
+	}
+
+	// Attachments are compared by their content-addressed chunks, not by
+	// their names
+	var chunks []string
+	if atts, ok := payload["attachments"].([]any); ok {
+		for _, a := range atts {
+			if att, ok := a.(map[string]any); ok {
+				b, _ := json.Marshal(att["chunks"])
+				chunks = append(chunks, string(b))
+			}
+		}
+		slices.Sort(chunks)
+		delete(payload, "attachments")
+	}
+
+	if typ != "binary" {
+		login := strings.ToLower(firstField(payload, loginFields))
+		site := normalizeURL(firstField(payload, urlFields))
+		if login != "" || site != "" {
+			return login + "\x00" + site, MatchLogin
+		}
+	}
+	content, _ := json.Marshal(payload)
+	match = MatchContent
+	if typ == "binary" {
+		match = MatchFile
+	}
+	return hashContent(append(content, strings.Join(chunks, "\x00")...)), match
+}
+
+// firstField returns the first non-empty string among the given fields of
+// payload.
+func firstField(payload map[string]any, fields []string) string {
+	for _, f := range fields {
+		if s, ok := payload[f].(string); ok && strings.TrimSpace(s) != "" {
+			return strings.TrimSpace(s)
+		}
+	}
+	return ""
+}
+
+// normalizeURL reduces a URL to its lower-cased host and path, so that
+// "https://Example.com/" and "example.com" compare equal.
+func normalizeURL(raw string) string {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	if raw == "" {
+		return ""
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "//" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	host := strings.TrimPrefix(u.Host, "www.")
+	return host + strings.TrimSuffix(u.Path, "/")
+}
+
+// hashContent returns the hex SHA-256 of data.
+func hashContent(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// MergeDuplicates keeps the secret keep and deletes the secrets remove,
+// its duplicates. The tags of the removed secrets are added to keep, as are
+// the first name and comment if keep has none, and attachments keep lacks by name
+// are moved to it, so that nothing but the duplicated data is lost.
+func (ls *LocalStorage) MergeDuplicates(keep string, remove []string, aead cipher.AEAD) error {
+	kept := ls.Get(keep)
+	if kept == nil {
+		return ErrSecretNotFound
+	}
+	payload, atts, err := ls.loadPayload(keep, aead)
+	if err != nil {
+		return err
+	}
+
+	update := MetadataUpdate{}
+	name, comment := kept.Name, kept.Comment
+	moved := false
+	for _, id := range remove {
+		dup := ls.Get(id)
+		if dup == nil {
+			return ErrSecretNotFound
+		}
+		update.AddTags = append(update.AddTags, dup.Tags...)
+		if name == "" && dup.Name != "" {
+			name = dup.Name
+			update.Name = &name
+		}
+		if comment == "" && dup.Comment != "" {
+			comment = dup.Comment
+			update.Comment = &comment
+		}
+		_, dupAtts, err := ls.loadPayload(id, aead)
+		if err != nil {
+			return err
+		}
+		for _, a := range dupAtts {
+			if !slices.ContainsFunc(atts, func(k Attachment) bool { return k.Name == a.Name }) {
+				atts = append(atts, a)
+				moved = true
+			}
+		}
+	}
+	if moved {
+		if err := ls.savePayload(keep, payload, atts, aead); err != nil {
+			return err
+		}
+	}
+	if update.Name != nil || update.Comment != nil || len(update.AddTags) > 0 {
+		if err := ls.UpdateMetadata(keep, update); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range remove {
+		// Chunks now referenced by keep are not released
+		if err := ls.DeleteAttachments(id, aead); err != nil {
+			return err
+		}
+		ls.Delete(id)
+	}
+	return nil
+}
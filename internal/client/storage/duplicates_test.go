@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// addPlain adds a secret with the given plaintext payload to ls.
+func addPlain(t *testing.T, ls *LocalStorage, id, typ, payload string, version int64, tags ...string) {
+	t.Helper()
+	data, err := Encrypt(fakeAEADStorage{}, []byte(payload))
+	if err != nil {
+		t.Fatalf("Encrypt returned error: %v", err)
+	}
+	ls.Add(Secret{ID: id, Type: typ, Data: data, Version: version, Tags: tags})
+}
+
+func TestFindDuplicates(t *testing.T) {
+	ls := &LocalStorage{deleted: make(map[string]bool)}
+	addPlain(t, ls, "a", "api-token", `{"user":"Alice","url":"https://example.com/","token":"1"}`, 1)
+	addPlain(t, ls, "b", "api-token", `{"user":"alice","url":"example.com","token":"2"}`, 2)
+	addPlain(t, ls, "c", "api-token", `{"user":"bob","url":"example.com","token":"1"}`, 3)
+	addPlain(t, ls, "d", "text", "same note", 4)
+	addPlain(t, ls, "e", "text", "same note", 5)
+	addPlain(t, ls, "f", "login_password", "same note", 6)
+	addPlain(t, ls, "g", "binary", `{"attachments":[{"name":"x.pdf","size":1,"chunks":["chunk-1"]}]}`, 7)
+	addPlain(t, ls, "h", "binary", `{"attachments":[{"name":"y.pdf","size":1,"chunks":["chunk-1"]}]}`, 8)
+	addPlain(t, ls, "i", "binary", `{"attachments":[{"name":"x.pdf","size":1,"chunks":["chunk-2"]}]}`, 9)
+	ls.Delete("e")
+	addPlain(t, ls, "j", "text", "same note", 10)
+
+	var got []string
+	for _, g := range ls.FindDuplicates(fakeAEADStorage{}) {
+		var ids []string
+		for _, s := range g.Secrets {
+			ids = append(ids, s.ID)
+		}
+		got = append(got, g.Type+"/"+g.Match+":"+strings.Join(ids, ","))
+	}
+	// Deleted secrets and secrets of other types are not duplicates
+	want := []string{
+		"api-token/login and URL:b,a",
+		"text/content:j,d",
+		"binary/file hash:h,g",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("FindDuplicates = %q; want %q", got, want)
+	}
+}
+
+func TestMergeDuplicates(t *testing.T) {
+	aead := fakeAEADStorage{}
+	ls := &LocalStorage{deleted: make(map[string]bool)}
+	addPlain(t, ls, "keep", "binary", "scan", 1, "work")
+	addPlain(t, ls, "dup", "binary", "scan", 2, "tax")
+	ls.Secrets[1].Comment = "2023 return"
+	if err := ls.AddAttachment("dup", "return.pdf", []byte("pdf"), aead); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ls.MergeDuplicates("keep", []string{"dup"}, aead); err != nil {
+		t.Fatalf("MergeDuplicates returned error: %v", err)
+	}
+
+	kept := ls.Get("keep")
+	if kept.Comment != "2023 return" || !slices.Equal(kept.Tags, []string{"tax", "work"}) {
+		t.Errorf("kept secret = %+v; want the comment and tags merged", kept)
+	}
+	if ls.Get("dup") != nil {
+		t.Error("duplicate not deleted")
+	}
+	// The attachment moved, so its chunk is still there
+	atts, err := ls.Attachments("keep", aead)
+	if err != nil || len(atts) != 1 || ls.Get(atts[0].Chunks[0]) == nil {
+		t.Errorf("attachments of kept secret = %+v, %v; want return.pdf with its chunk", atts, err)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux && !darwin
+
+package storage
+
+import "os"
+
+// setEcho is not supported on this platform; passphrases are echoed.
+func setEcho(f *os.File, on bool) bool {
+	return false
+}
+
+// MakeRaw is not supported on this platform.
+func MakeRaw(f *os.File) (restore func(), err error) {
+	return nil, ErrNotTerminal
+}
+
+// TerminalSize is not supported on this platform.
+func TerminalSize(f *os.File) (cols, rows int, ok bool) {
+	return 0, 0, false
+}
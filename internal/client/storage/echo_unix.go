@@ -0,0 +1,64 @@
+//go:build linux || darwin
+
+package storage
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// setEcho turns terminal echo on f on or off. It reports false if f is not
+// a terminal.
+func setEcho(f *os.File, on bool) bool {
+	var t syscall.Termios
+	if !termios(f, ioctlGetTermios, &t) {
+		return false
+	}
+	if on {
+		t.Lflag |= syscall.ECHO
+	} else {
+		t.Lflag &^= syscall.ECHO
+	}
+	return termios(f, ioctlSetTermios, &t)
+}
+
+// MakeRaw puts the terminal f into raw mode for full-screen interfaces:
+// input is passed on key by key, without echo, line editing or signals,
+// and output is not translated. restore returns f to its previous mode.
+func MakeRaw(f *os.File) (restore func(), err error) {
+	var old syscall.Termios
+	if !termios(f, ioctlGetTermios, &old) {
+		return nil, ErrNotTerminal
+	}
+	t := old
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB
+	t.Cflag |= syscall.CS8
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+	if !termios(f, ioctlSetTermios, &t) {
+		return nil, ErrNotTerminal
+	}
+	return func() { termios(f, ioctlSetTermios, &old) }, nil
+}
+
+// TerminalSize returns the number of columns and rows of the terminal f.
+// It reports false if f is not a terminal.
+func TerminalSize(f *os.File) (cols, rows int, ok bool) {
+	var ws struct{ Row, Col, X, Y uint16 }
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 || ws.Col == 0 || ws.Row == 0 {
+		return 0, 0, false
+	}
+	return int(ws.Col), int(ws.Row), true
+}
+
+// termios gets or sets the terminal attributes of f with the ioctl req.
+func termios(f *os.File, req uintptr, t *syscall.Termios) bool {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(unsafe.Pointer(t)))
+	return errno == 0
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/atinyakov/GophKeeper/internal/limits"
+	"github.com/atinyakov/GophKeeper/internal/problem"
+)
+
+// Kinds of errors returned by the client, for errors.Is. The more specific
+// errors of the package match them too, e.g. ErrSecretNotFound is an
+// ErrNotFound, as do server responses with the matching status.
+var (
+	// ErrNotFound matches errors of missing secrets, attachments and
+	// fields, and of servers answering 404 Not Found.
+	ErrNotFound = errors.New("not found")
+	// ErrDecryption matches errors of payloads that cannot be decrypted,
+	// e.g. as they were encrypted with another key.
+	ErrDecryption = errors.New("decryption failed")
+	// ErrConflict matches errors of servers rejecting a change as
+	// conflicting: 409 Conflict, 412 Precondition Failed and
+	// ErrFutureVersion.
+	ErrConflict = errors.New("conflict")
+	// ErrUnauthorized matches errors of servers rejecting the credentials
+	// of the client: 401 Unauthorized and 403 Forbidden.
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+// ErrFutureVersion matches the *StatusError of a server rejecting a secret
+// whose version is too far in the future, i.e. a change made while the
+// clock of the device was wrong.
+var ErrFutureVersion = errors.New("secret version ahead of the server clock")
+
+// StatusError is returned when the server answers a request with an
+// unexpected HTTP status.
+type StatusError struct {
+	StatusCode int
+	Message    string
+	// Code names the kind of error, if the server reported one in its
+	// problem details or, as earlier releases did, in
+	// limits.ErrorCodeHeader; see the problem package for the codes.
+	Code string
+	// RequestID identifies the request in the server log, if reported.
+	RequestID string
+}
+
+func (e *StatusError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("server error: %s (request %s)", e.Message, e.RequestID)
+	}
+	return fmt.Sprintf("server error: %s", e.Message)
+}
+
+// Is reports whether the server error is of the kind target:
+// ErrFutureVersion, or ErrNotFound, ErrConflict or ErrUnauthorized by its
+// status.
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrFutureVersion:
+		return e.Code == limits.FutureVersionCode
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.Code == limits.FutureVersionCode ||
+			e.StatusCode == http.StatusConflict || e.StatusCode == http.StatusPreconditionFailed
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// newStatusError reads the error from resp: problem details, or the plain
+// text message of servers that do not send them.
+func newStatusError(resp *http.Response) *StatusError {
+	data, _ := io.ReadAll(resp.Body)
+	e := &StatusError{StatusCode: resp.StatusCode, Code: resp.Header.Get(limits.ErrorCodeHeader)}
+	var p problem.Details
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt == problem.ContentType && json.Unmarshal(data, &p) == nil {
+		e.Message = cmp.Or(p.Detail, p.Title, resp.Status)
+		e.Code = cmp.Or(p.Code, e.Code)
+		e.RequestID = p.RequestID
+		return e
+	}
+	e.Message = strings.TrimSpace(string(data))
+	if e.Message == "" {
+		e.Message = resp.Status
+	}
+	return e
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/atinyakov/GophKeeper/internal/limits"
+)
+
+func TestStatusError_Is(t *testing.T) {
+	kinds := []error{ErrNotFound, ErrConflict, ErrUnauthorized, ErrFutureVersion}
+	tests := []struct {
+		err  *StatusError
+		want []error
+	}{
+		{&StatusError{StatusCode: http.StatusNotFound}, []error{ErrNotFound}},
+		{&StatusError{StatusCode: http.StatusConflict}, []error{ErrConflict}},
+		{&StatusError{StatusCode: http.StatusPreconditionFailed}, []error{ErrConflict}},
+		{&StatusError{StatusCode: http.StatusUnprocessableEntity, Code: limits.FutureVersionCode}, []error{ErrConflict, ErrFutureVersion}},
+		{&StatusError{StatusCode: http.StatusUnauthorized}, []error{ErrUnauthorized}},
+		{&StatusError{StatusCode: http.StatusForbidden}, []error{ErrUnauthorized}},
+		{&StatusError{StatusCode: http.StatusInternalServerError}, nil},
+	}
+	for _, tt := range tests {
+		// Callers see the error wrapped
+		err := fmt.Errorf("sync: %w", tt.err)
+		for _, kind := range kinds {
+			want := false
+			for _, w := range tt.want {
+				want = want || w == kind
+			}
+			if got := errors.Is(err, kind); got != want {
+				t.Errorf("status %d, code %q: errors.Is(%v) = %v; want %v", tt.err.StatusCode, tt.err.Code, kind, got, want)
+			}
+		}
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	ls := &LocalStorage{deleted: make(map[string]bool)}
+	if _, err := ls.ResolveID("missing"); !errors.Is(err, ErrSecretNotFound) || !errors.Is(err, ErrNotFound) {
+		t.Errorf("ResolveID: %v; want ErrSecretNotFound and ErrNotFound", err)
+	}
+	if _, err := ExtractField([]byte(`{"a":1}`), "b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ExtractField: %v; want ErrNotFound", err)
+	}
+	if !errors.Is(ErrAttachmentNotFound, ErrNotFound) {
+		t.Error("ErrAttachmentNotFound is not ErrNotFound")
+	}
+
+	data, err := Encrypt(newTestAEAD(t), []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{data, "not base64!", "AAAA"} {
+		if _, err := Decrypt(newTestAEAD(t), d); !errors.Is(err, ErrDecryption) {
+			t.Errorf("Decrypt(%q) with another key: %v; want ErrDecryption", d, err)
+		}
+	}
+}
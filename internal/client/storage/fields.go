@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrFieldNotFound is returned when a field path does not exist in a payload.
+var ErrFieldNotFound = fmt.Errorf("field %w", ErrNotFound)
+
+// ExtractField returns the value at path in a decrypted payload. Paths are
+// dot-separated keys into the JSON object payload of structured secrets,
+// with numeric segments indexing arrays (e.g. "password", "data.url",
+// "attachments.0.name"). A payload that is not a JSON object is treated as
+// {"data": payload}. Strings are returned as is, other values JSON-encoded.
+func ExtractField(plain []byte, path string) (string, error) {
+	var value any
+	if err := json.Unmarshal(plain, &value); err != nil || !isObject(value) {
+		value = map[string]any{"data": string(plain)}
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]any:
+			next, ok := v[key]
+			if !ok {
+				return "", fmt.Errorf("%w: %s", ErrFieldNotFound, path)
+			}
+			value = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", fmt.Errorf("%w: %s", ErrFieldNotFound, path)
+			}
+			value = v[i]
+		default:
+			return "", fmt.Errorf("%w: %s", ErrFieldNotFound, path)
+		}
+	}
+
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSpace(b)), nil
+}
+
+// isObject reports whether v is a decoded JSON object.
+func isObject(v any) bool {
+	_, ok := v.(map[string]any)
+	return ok
+}
+
+// passwordFields name the payload fields holding the password of a
+// structured secret, in order of preference.
+var passwordFields = []string{"password", "pass", "secret"}
+
+// Credentials returns the login and password of a decrypted payload for
+// filling login forms. Structured payloads are searched for the fields in
+// loginFields and passwordFields; any other payload is the password.
+func Credentials(plain []byte) (login, password string, err error) {
+	var payload map[string]any
+	if json.Unmarshal(plain, &payload) != nil {
+		return "", strings.TrimRight(string(plain), "\n"), nil
+	}
+	password = firstField(payload, passwordFields)
+	if password == "" {
+		return "", "", fmt.Errorf("%w: password", ErrFieldNotFound)
+	}
+	return firstField(payload, loginFields), password, nil
+}
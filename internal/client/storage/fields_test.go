@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExtractField(t *testing.T) {
+	payload := []byte(`{"user":"bob","password":"s3cret","data":{"url":"https://db","port":5432},"attachments":[{"name":"a.txt"}]}`)
+
+	tests := []struct {
+		name    string
+		plain   []byte
+		path    string
+		want    string
+		wantErr error
+	}{
+		{"top-level", payload, "password", "s3cret", nil},
+		{"nested", payload, "data.url", "https://db", nil},
+		{"number", payload, "data.port", "5432", nil},
+		{"array index", payload, "attachments.0.name", "a.txt", nil},
+		{"object", payload, "data", `{"port":5432,"url":"https://db"}`, nil},
+		{"missing", payload, "token", "", ErrFieldNotFound},
+		{"through scalar", payload, "user.name", "", ErrFieldNotFound},
+		{"bad index", payload, "attachments.5", "", ErrFieldNotFound},
+		{"free-form", []byte("line1\nline2"), "data", "line1\nline2", nil},
+		{"JSON scalar", []byte(`"quoted"`), "data", `"quoted"`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractField(tt.plain, tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ExtractField error = %v; want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ExtractField = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	tests := []struct {
+		name      string
+		plain     string
+		wantLogin string
+		wantPass  string
+		wantErr   error
+	}{
+		{"structured", `{"username":"bob","password":"s3cret","url":"https://x"}`, "bob", "s3cret", nil},
+		{"no login", `{"pass":"s3cret"}`, "", "s3cret", nil},
+		{"no password", `{"login":"bob"}`, "", "", ErrFieldNotFound},
+		{"free-form", "s3cret\n", "", "s3cret", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login, pass, err := Credentials([]byte(tt.plain))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Credentials error = %v; want %v", err, tt.wantErr)
+			}
+			if login != tt.wantLogin || pass != tt.wantPass {
+				t.Errorf("Credentials = %q, %q; want %q, %q", login, pass, tt.wantLogin, tt.wantPass)
+			}
+		})
+	}
+}
@@ -0,0 +1,485 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/pb"
+	"github.com/atinyakov/GophKeeper/internal/pow"
+	"go.uber.org/zap"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+)
+
+// Transport is the protocol syncs and registrations are sent with.
+type Transport string
+
+// Transports, see ParseTransport.
+const (
+	// TransportHTTP sends JSON requests to the HTTP API.
+	TransportHTTP Transport = "http"
+	// TransportGRPC calls the gRPC API, served on the same port. Its
+	// protobuf messages are smaller and quicker to encode than JSON, which
+	// pays off for syncs of large vaults. It needs an https server URL.
+	TransportGRPC Transport = "grpc"
+)
+
+// ParseTransport parses the name of a transport, "http" or "grpc".
+func ParseTransport(s string) (Transport, error) {
+	switch t := Transport(s); t {
+	case TransportHTTP, TransportGRPC:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown transport %q, want http or grpc", s)
+}
+
+// WithTransport sends registrations with transport t. TransportGRPC also
+// makes the client speak HTTP/2, as gRPC needs, so that it can be passed
+// to SyncWithServers after SetTransport.
+func WithTransport(t Transport) ClientOption {
+	return func(o *clientOptions) {
+		o.transport = t
+	}
+}
+
+// SetTransport sets the transport ls is synced with. The client passed to
+// SyncWithServers must be built WithTransport(TransportGRPC) for gRPC.
+func (ls *LocalStorage) SetTransport(t Transport) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.transport = t
+}
+
+const (
+	// grpcContentType is the content type of gRPC requests and responses.
+	grpcContentType = "application/grpc+proto"
+	// maxGRPCMessage caps the size of received gRPC messages, so that a
+	// broken response does not make the client allocate at will.
+	maxGRPCMessage = 64 << 20
+)
+
+// writeMessage writes m to w as a length-prefixed gRPC message.
+func writeMessage(w io.Writer, m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return writeFrame(w, b)
+}
+
+// writeFrame writes the marshaled message b to w with its gRPC prefix.
+func writeFrame(w io.Writer, b []byte) error {
+	var prefix [5]byte // uncompressed flag and length
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(b)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// readMessage reads the next length-prefixed gRPC message from r. It
+// returns io.EOF at the end of the stream.
+func readMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed gRPC message")
+	}
+	n := binary.BigEndian.Uint32(prefix[1:])
+	if n > maxGRPCMessage {
+		return nil, fmt.Errorf("gRPC message of %d bytes too large", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("truncated gRPC message: %w", err)
+	}
+	return b, nil
+}
+
+// newGRPCRequest returns a call of the gRPC method, e.g.
+// pb.GophKeeper_Sync_FullMethodName, of the server at baseURL whose
+// messages are read from body.
+func newGRPCRequest(baseURL, method string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodPost, baseURL+method, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", grpcContentType)
+	req.Header.Set("TE", "trailers")
+	return req, nil
+}
+
+// doGRPC sends req with client and returns the response, whose messages
+// are read with readMessage. Servers without the gRPC API answer with the
+// *StatusError of an HTTP error.
+func doGRPC(client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/grpc") {
+		defer resp.Body.Close()
+		return nil, newStatusError(resp)
+	}
+	return resp, nil
+}
+
+// callGRPC calls the unary gRPC method of the server at baseURL with in
+// and unmarshals the response into out.
+func callGRPC(client *http.Client, baseURL, method string, in, out proto.Message) error {
+	var body bytes.Buffer
+	if err := writeMessage(&body, in); err != nil {
+		return err
+	}
+	req, err := newGRPCRequest(baseURL, method, &body)
+	if err != nil {
+		return err
+	}
+	resp, err := doGRPC(client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := readMessage(resp.Body)
+	if errors.Is(err, io.EOF) {
+		// The status of failed calls is all there is
+		if err := grpcStatusError(resp); err != nil {
+			return err
+		}
+		return errors.New("invalid response: no message")
+	}
+	if err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	if err := proto.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return grpcStatusError(resp)
+}
+
+// grpcStatusError returns the error reported by the gRPC status of resp,
+// nil if the call succeeded. The status is read from the trailers, which
+// are only available once the body was read to the end, or from the
+// header of responses without messages. The returned *StatusError carries
+// the HTTP status and problem code the HTTP API would have answered with,
+// so that errors.Is and IsTransient treat both transports alike.
+func grpcStatusError(resp *http.Response) error {
+	md := resp.Trailer
+	if md.Get("Grpc-Status") == "" {
+		md = resp.Header
+	}
+	s := md.Get("Grpc-Status")
+	if s == "" {
+		return errors.New("invalid response: no gRPC status")
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid response: gRPC status %q", s)
+	}
+	if codes.Code(code) == codes.OK {
+		return nil
+	}
+
+	msg, err := url.PathUnescape(md.Get("Grpc-Message"))
+	if err != nil {
+		msg = md.Get("Grpc-Message")
+	}
+	e := &StatusError{
+		StatusCode: grpcHTTPStatus(codes.Code(code)),
+		Message:    cmp.Or(msg, codes.Code(code).String()),
+	}
+	if p := grpcProblem(md.Get("Grpc-Status-Details-Bin")); p != nil {
+		e.StatusCode, e.Code = int(p.GetStatus()), p.GetCode()
+	}
+	return e
+}
+
+// grpcProblem returns the problem attached to the details of a gRPC
+// status, nil if there is none.
+func grpcProblem(details string) *pb.Problem {
+	b, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(details, "="))
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	var s spb.Status
+	if err := proto.Unmarshal(b, &s); err != nil {
+		return nil
+	}
+	for _, d := range s.GetDetails() {
+		var p pb.Problem
+		if d.MessageIs(&p) && d.UnmarshalTo(&p) == nil && p.GetStatus() != 0 {
+			return &p
+		}
+	}
+	return nil
+}
+
+// grpcHTTPStatus returns the HTTP status matching a gRPC status code, for
+// servers that do not attach the problem.
+func grpcHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound, codes.Unimplemented:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// Register registers login through the Register call of the server at
+// baseURL, solving a proof-of-work challenge first if required.
+func (g grpcRemote) Register(baseURL, login string) (IssuedCredentials, error) {
+	req := &pb.RegisterRequest{Login: login}
+	var resp pb.RegisterResponse
+	if err := callGRPC(g.client, baseURL, pb.GophKeeper_Register_FullMethodName, req, &resp); err != nil {
+		return IssuedCredentials{}, fmt.Errorf("register failed: %w", err)
+	}
+	if c := resp.GetChallenge(); c != nil {
+		logger.Info("Solving registration challenge...", zap.Int("difficulty", int(c.GetDifficulty())))
+		req.Challenge, req.Solution = c.GetChallenge(), pow.Solve(c.GetChallenge(), int(c.GetDifficulty()))
+		resp.Reset()
+		if err := callGRPC(g.client, baseURL, pb.GophKeeper_Register_FullMethodName, req, &resp); err != nil {
+			return IssuedCredentials{}, fmt.Errorf("register failed: %w", err)
+		}
+		if resp.GetChallenge() != nil {
+			return IssuedCredentials{}, errors.New("challenge issued twice")
+		}
+	}
+	return IssuedCredentials{Cert: resp.GetCert(), Key: resp.GetKey(), RecoveryCodes: resp.GetRecoveryCodes()}, nil
+}
+
+// Sync is httpRemote.Sync over the Sync call of the gRPC API. The
+// options and secrets are streamed to the server as they are encoded, and
+// the secrets it answers with staged as they arrive, see spool, but passed
+// to add only once the final result shows the answer is complete.
+func (g grpcRemote) Sync(baseURL string, call SyncCall, add func(Secret)) (*SyncResult, error) {
+	start := time.Now()
+	body, w := io.Pipe()
+	encoded := make(chan time.Duration, 1)
+	go func() {
+		d, err := encodeSyncStream(w, call)
+		encoded <- d
+		w.CloseWithError(err)
+	}()
+	// Unblock the encoder if the request body is not read to the end
+	defer body.Close()
+
+	req, err := newGRPCRequest(baseURL, pb.GophKeeper_Sync_FullMethodName, body)
+	if err != nil {
+		return nil, fmt.Errorf("sync failed: %w", err)
+	}
+	resp, err := doGRPC(g.client, req)
+	if err != nil {
+		return nil, fmt.Errorf("sync failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	result := SyncResult{Versions: map[string]int64{}}
+	var (
+		done     *pb.SyncResult
+		received spool
+	)
+	defer received.close()
+	r := bufio.NewReader(resp.Body)
+	for {
+		b, err := readMessage(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		t := time.Now()
+		var msg pb.SyncResponse
+		err = proto.Unmarshal(b, &msg)
+		result.Timings.Decode += time.Since(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		if msg.GetSecret() != nil {
+			if err := received.write(b); err != nil {
+				return nil, fmt.Errorf("invalid response: %w", err)
+			}
+			continue
+		}
+		done = msg.GetResult()
+	}
+	if err := grpcStatusError(resp); err != nil {
+		return nil, err
+	}
+	if done == nil {
+		return nil, errors.New("invalid response: no sync result")
+	}
+	err = received.each(func(b []byte) error {
+		t := time.Now()
+		var msg pb.SyncResponse
+		err := proto.Unmarshal(b, &msg)
+		result.Timings.Decode += time.Since(t)
+		if err != nil {
+			return err
+		}
+		s := secretFromPB(msg.GetSecret())
+		if !s.Deleted {
+			result.Versions[s.ID] = s.Version
+		}
+		add(s)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+
+	result.ETag = done.GetEtag()
+	if kdf := done.GetKdf(); kdf != "" {
+		if err := json.Unmarshal([]byte(kdf), &result.KDF); err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+	}
+	if done.GetNotModified() {
+		result.NotModified, result.Version = true, call.LastVersion
+		result.ETag = cmp.Or(result.ETag, call.ETag)
+	} else {
+		result.Version = done.GetVersion()
+		result.Updated, result.Skipped, result.Restored = done.GetUpdated(), done.GetSkipped(), done.GetRestored()
+		result.Conflicts = []SyncConflict{}
+		for _, c := range done.GetConflicts() {
+			conflict := SyncConflict{
+				ID:             c.GetId(),
+				Version:        c.GetVersion(),
+				ServerVersion:  c.GetServerVersion(),
+				ServerModified: c.GetServerModified(),
+				Concurrent:     c.GetConcurrent(),
+				Changed:        c.GetChanged(),
+			}
+			if c.GetClient() != nil {
+				sec := secretFromPB(c.GetClient())
+				conflict.Client = &sec
+			}
+			if c.GetServer() != nil {
+				sec := secretFromPB(c.GetServer())
+				conflict.Server = &sec
+			}
+			result.Conflicts = append(result.Conflicts, conflict)
+		}
+		if sum := done.GetSummary(); sum != nil {
+			result.Summary = &VaultSummary{
+				Types:      sum.GetTypes(),
+				Folders:    sum.GetFolders(),
+				Tags:       sum.GetTags(),
+				TotalBytes: sum.GetTotalBytes(),
+			}
+		}
+	}
+
+	_ = body.Close()
+	t := &result.Timings
+	t.Encode = <-encoded
+	t.Network = max(time.Since(start)-t.Encode-t.Decode, 0)
+	return &result, nil
+}
+
+// encodeSyncStream writes the messages of call to w: the options,
+// followed by the secrets. It returns the time spent encoding them, apart
+// from writing, which waits for the network.
+func encodeSyncStream(w io.Writer, call SyncCall) (time.Duration, error) {
+	var encoding time.Duration
+	bw := bufio.NewWriter(w)
+	send := func(m *pb.SyncRequest) error {
+		t := time.Now()
+		b, err := proto.Marshal(m)
+		encoding += time.Since(t)
+		if err != nil {
+			return err
+		}
+		return writeFrame(bw, b)
+	}
+
+	opts := &pb.SyncOptions{IfNoneMatch: call.ETag, IncludeDeleted: true, LastKnownVersion: call.LastVersion}
+	if call.KDF != nil {
+		kdf, err := json.Marshal(call.KDF)
+		if err != nil {
+			return encoding, err
+		}
+		opts.Kdf = string(kdf)
+	}
+	if wire := call.Filter.wire(); wire != nil {
+		opts.Filter = &pb.SyncFilter{Folders: wire["folders"], Tags: wire["tags"], Types: wire["types"]}
+	}
+	if err := send(&pb.SyncRequest{Message: &pb.SyncRequest_Options{Options: opts}}); err != nil {
+		return encoding, err
+	}
+	for _, sec := range call.Secrets {
+		if err := send(&pb.SyncRequest{Message: &pb.SyncRequest_Secret{Secret: secretToPB(sec)}}); err != nil {
+			return encoding, err
+		}
+	}
+	return encoding, bw.Flush()
+}
+
+// secretFromPB converts a secret received from the server.
+func secretFromPB(s *pb.Secret) Secret {
+	return Secret{
+		ID:          s.GetId(),
+		Type:        s.GetType(),
+		Data:        s.GetData(),
+		Name:        s.GetName(),
+		Comment:     s.GetComment(),
+		Folder:      s.GetFolder(),
+		Tags:        s.GetTags(),
+		Version:     s.GetVersion(),
+		Deleted:     s.GetDeleted(),
+		Reprompt:    s.GetReprompt(),
+		ExpiresAt:   s.GetExpiresAt(),
+		BaseVersion: s.GetBaseVersion(),
+	}
+}
+
+// secretToPB converts a secret sent to the server.
+func secretToPB(s Secret) *pb.Secret {
+	return &pb.Secret{
+		Id:          s.ID,
+		Type:        s.Type,
+		Data:        s.Data,
+		Name:        s.Name,
+		Comment:     s.Comment,
+		Folder:      s.Folder,
+		Tags:        s.Tags,
+		Version:     s.Version,
+		Deleted:     s.Deleted,
+		Reprompt:    s.Reprompt,
+		ExpiresAt:   s.ExpiresAt,
+		BaseVersion: s.BaseVersion,
+	}
+}
@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atinyakov/GophKeeper/internal/limits"
+	"github.com/atinyakov/GophKeeper/internal/pb"
+	"github.com/atinyakov/GophKeeper/internal/pow"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeGRPCServer implements the gRPC API with the given calls.
+type fakeGRPCServer struct {
+	pb.UnimplementedGophKeeperServer
+	register func(*pb.RegisterRequest) (*pb.RegisterResponse, error)
+	sync     func(pb.GophKeeper_SyncServer) error
+	watch    func(*pb.WatchRequest, pb.GophKeeper_WatchServer) error
+}
+
+func (f *fakeGRPCServer) Register(_ context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	return f.register(req)
+}
+
+func (f *fakeGRPCServer) Sync(stream pb.GophKeeper_SyncServer) error {
+	return f.sync(stream)
+}
+
+func (f *fakeGRPCServer) Watch(req *pb.WatchRequest, stream pb.GophKeeper_WatchServer) error {
+	if f.watch == nil {
+		return status.Error(codes.Unimplemented, "unknown method Watch")
+	}
+	return f.watch(req, stream)
+}
+
+// startGRPCServer serves fake over HTTP/2 with TLS, like the server serves
+// its gRPC API, and returns its URL and the path of its CA file.
+func startGRPCServer(t *testing.T, fake *fakeGRPCServer) (baseURL, caFile string) {
+	t.Helper()
+	srv := grpc.NewServer()
+	pb.RegisterGophKeeperServer(srv, fake)
+	ts := httptest.NewUnstartedServer(srv)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+
+	caFile = filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return ts.URL, caFile
+}
+
+// chdirTemp changes to a temporary directory for the files the client
+// saves, until the test ends.
+func chdirTemp(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+func TestSyncWithServer_GRPC(t *testing.T) {
+	chdirTemp(t)
+
+	var (
+		gotFilter    []string
+		gotLastKnown int64
+		gotKDF       string
+		uploaded     []string
+	)
+	baseURL, caFile := startGRPCServer(t, &fakeGRPCServer{sync: func(stream pb.GophKeeper_SyncServer) error {
+		first, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		gotFilter = first.GetOptions().GetFilter().GetFolders()
+		gotLastKnown = first.GetOptions().GetLastKnownVersion()
+		gotKDF = first.GetOptions().GetKdf()
+		for {
+			msg, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			uploaded = append(uploaded, msg.GetSecret().GetId())
+		}
+		if err := stream.Send(&pb.SyncResponse{Message: &pb.SyncResponse_Secret{Secret: &pb.Secret{
+			Id: "s1", Type: "text", Data: "d1", Folder: "work", Version: 42,
+		}}}); err != nil {
+			return err
+		}
+		return stream.Send(&pb.SyncResponse{Message: &pb.SyncResponse_Result{Result: &pb.SyncResult{
+			Version: 42,
+			Skipped: []string{"mine"},
+			Conflicts: []*pb.Conflict{{
+				Id: "mine", Version: 8, ServerVersion: 9, Concurrent: true,
+				Client:  &pb.Secret{Id: "mine", Data: "local", Version: 8},
+				Server:  &pb.Secret{Id: "mine", Data: "remote", Version: 9},
+				Changed: []string{"comment"},
+			}},
+			Summary: &pb.VaultSummary{Types: map[string]int64{"text": 1}, Folders: map[string]int64{"work": 1}, TotalBytes: 2},
+		}}})
+	}})
+	client, err := NewClient(caFile, WithTransport(TransportGRPC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ls := &LocalStorage{
+		Secrets:    []Secret{{ID: "mine", Type: "text", Folder: "work", Data: "local", Version: 8}},
+		SyncFilter: &SyncFilter{Folders: []string{"work"}},
+		Version:    7,
+		KDF:        &KDFParams{Salt: []byte("salt"), Time: 1, Memory: 8, Threads: 1, Check: "check"},
+	}
+	ls.SetTransport(TransportGRPC)
+	ls.SetSyncLog("sync.log")
+	if err := SyncWithServer(client, baseURL, ls); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	if len(gotFilter) != 1 || gotFilter[0] != "work" {
+		t.Errorf("filter folders = %v, want [work]", gotFilter)
+	}
+	if len(uploaded) != 1 || uploaded[0] != "mine" {
+		t.Errorf("uploaded = %v, want [mine]", uploaded)
+	}
+	if gotLastKnown != 7 {
+		t.Errorf("last known version = %d, want 7", gotLastKnown)
+	}
+	var sent KDFParams
+	if err := json.Unmarshal([]byte(gotKDF), &sent); err != nil || string(sent.Salt) != "salt" || sent.Check != "check" {
+		t.Errorf("kdf = %q, want the vault's", gotKDF)
+	}
+	entries, err := ReadSyncLog("sync.log", 0)
+	if err != nil || len(entries) != 1 || len(entries[0].Conflicts) != 1 {
+		t.Fatalf("sync log = %+v, %v; want one conflict", entries, err)
+	}
+	if c := entries[0].Conflicts[0]; !c.Concurrent || c.Client.Data != "local" || c.Server.Data != "remote" || len(c.Changed) != 1 {
+		t.Errorf("conflict = %+v, want both versions of the concurrent edit", c)
+	}
+	if ls.Version != 42 || len(ls.Secrets) != 1 || ls.Secrets[0].ID != "s1" || ls.Secrets[0].Data != "d1" {
+		t.Errorf("storage = version %d, %+v", ls.Version, ls.Secrets)
+	}
+	if sum := ls.VaultSummary(); sum == nil || sum.Folders["work"] != 1 || sum.TotalBytes != 2 {
+		t.Errorf("summary = %+v, want the server's", sum)
+	}
+}
+
+func TestSyncWithServer_GRPCError(t *testing.T) {
+	chdirTemp(t)
+
+	var fail error
+	baseURL, caFile := startGRPCServer(t, &fakeGRPCServer{sync: func(pb.GophKeeper_SyncServer) error {
+		return fail
+	}})
+	client, err := NewClient(caFile, WithTransport(TransportGRPC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls := &LocalStorage{}
+	ls.SetTransport(TransportGRPC)
+
+	s, err := status.New(codes.InvalidArgument, "version ahead").WithDetails(&pb.Problem{Status: 422, Code: limits.FutureVersionCode})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fail = s.Err()
+	err = SyncWithServer(client, baseURL, ls)
+	if !errors.Is(err, ErrFutureVersion) || !errors.Is(err, ErrConflict) {
+		t.Errorf("error = %v, want ErrFutureVersion", err)
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 422 || statusErr.Message != "version ahead" {
+		t.Errorf("error = %#v, want 422 version ahead", err)
+	}
+
+	// Statuses without a problem map to the matching HTTP status
+	fail = status.Error(codes.Unavailable, "shutting down")
+	if err := SyncWithServer(client, baseURL, ls); !IsTransient(err) {
+		t.Errorf("error = %v, want transient", err)
+	}
+	fail = status.Error(codes.Unauthenticated, "no certificate")
+	if err := SyncWithServer(client, baseURL, ls); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("error = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestRegister_GRPC(t *testing.T) {
+	chdirTemp(t)
+
+	var logins []string
+	baseURL, caFile := startGRPCServer(t, &fakeGRPCServer{register: func(req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+		logins = append(logins, req.GetLogin())
+		if req.GetSolution() == "" {
+			return &pb.RegisterResponse{Challenge: &pb.Challenge{Challenge: "c1", Difficulty: 4}}, nil
+		}
+		if !pow.Valid(req.GetChallenge(), req.GetSolution(), 4) {
+			return nil, status.Error(codes.InvalidArgument, "wrong solution")
+		}
+		return &pb.RegisterResponse{Cert: "certdata", Key: "keydata", RecoveryCodes: []string{"AAAA-BBBB"}}, nil
+	}})
+
+	recovery, err := Register(baseURL+registerPath, "alice", caFile, WithTransport(TransportGRPC))
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	if len(recovery) != 1 || recovery[0] != "AAAA-BBBB" {
+		t.Errorf("recovery codes = %v", recovery)
+	}
+	if len(logins) != 2 || logins[1] != "alice" {
+		t.Errorf("logins = %v, want the login twice", logins)
+	}
+	if b, err := os.ReadFile("client.crt"); err != nil || string(b) != "certdata" {
+		t.Errorf("client.crt = %q, %v", b, err)
+	}
+}
@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/atinyakov/GophKeeper/internal/pkcs8"
+)
+
+// PassphraseEnv names the environment variable that, when set, supplies
+// the client key passphrase instead of prompting for it.
+const PassphraseEnv = "GOPHKEEPER_PASSPHRASE"
+
+var (
+	// ErrKeyEncrypted is returned when an encrypted client key is loaded
+	// without a way to ask for its passphrase.
+	ErrKeyEncrypted = errors.New("client key is encrypted, but no passphrase was given")
+	// ErrKeyAlreadyEncrypted is returned by EncryptKeyPEM for keys that are
+	// already encrypted.
+	ErrKeyAlreadyEncrypted = errors.New("client key is already encrypted")
+	// ErrIncorrectPassphrase is returned when the client key cannot be
+	// decrypted with the given passphrase.
+	ErrIncorrectPassphrase = pkcs8.ErrIncorrectPassphrase
+	// ErrKeyNotEncrypted is returned by VerifyPassphrase for keys stored
+	// without a passphrase.
+	ErrKeyNotEncrypted = errors.New("client key is not encrypted, run encrypt-key to set a passphrase")
+)
+
+// PassphraseFunc returns the passphrase protecting the client key. It is
+// only called when an encrypted key is read or a new key is written.
+type PassphraseFunc func() ([]byte, error)
+
+// IsEncryptedKeyPEM reports whether keyPEM holds an encrypted PKCS#8 key.
+func IsEncryptedKeyPEM(keyPEM []byte) bool {
+	block, _ := pem.Decode(keyPEM)
+	return block != nil && block.Type == pkcs8.PEMType
+}
+
+// IsUnencryptedKeyFile reports whether the file at path holds a client key
+// stored without a passphrase. Unreadable files and keys held by the OS
+// keystore report false.
+func IsUnencryptedKeyFile(path string) bool {
+	keyPEM, err := os.ReadFile(path)
+	if err != nil || IsEncryptedKeyPEM(keyPEM) {
+		return false
+	}
+	_, inKeystore := keystoreLabel(keyPEM)
+	return !inKeystore
+}
+
+// EncryptKeyPEM encrypts the PEM-encoded private key keyPEM with
+// passphrase as PKCS#8 with scrypt. It fails if DecryptKeyPEM could not
+// restore keyPEM's exact DER bytes, since the vault key derived by
+// NewAEADFromKeyPEM would change and existing secrets become unreadable.
+func EncryptKeyPEM(keyPEM, passphrase []byte) ([]byte, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("storage: failed to decode PEM")
+	}
+	switch block.Type {
+	case pkcs8.PEMType:
+		return nil, ErrKeyAlreadyEncrypted
+	case keystoreBlockType:
+		return nil, ErrKeyInKeystore
+	}
+	key, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, err
+	}
+	restored, err := marshalPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if restored.Type != block.Type || !bytes.Equal(restored.Bytes, block.Bytes) {
+		return nil, fmt.Errorf("storage: %s encoding cannot be restored after encryption", block.Type)
+	}
+
+	enc, err := pkcs8.Encrypt(key, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(enc), nil
+}
+
+// DecryptKeyPEM decrypts a key produced by EncryptKeyPEM and returns it in
+// its original unencrypted PEM form. Unencrypted keys are returned as is.
+func DecryptKeyPEM(keyPEM, passphrase []byte) ([]byte, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("storage: failed to decode PEM")
+	}
+	if block.Type != pkcs8.PEMType {
+		return keyPEM, nil
+	}
+	key, err := pkcs8.Decrypt(block, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := marshalPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(plain), nil
+}
+
+// ReadKeyPEM reads the client key from path, decrypting it with the
+// passphrase returned by passphrase if it is encrypted. Keys held by the
+// OS keystore cannot be read and return ErrKeyInKeystore.
+func ReadKeyPEM(path string, passphrase PassphraseFunc) ([]byte, error) {
+	keyPEM, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := keystoreLabel(keyPEM); ok {
+		return nil, ErrKeyInKeystore
+	}
+	if !IsEncryptedKeyPEM(keyPEM) {
+		return keyPEM, nil
+	}
+	if passphrase == nil {
+		return nil, ErrKeyEncrypted
+	}
+	pass, err := passphrase()
+	if err != nil {
+		return nil, fmt.Errorf("reading passphrase: %w", err)
+	}
+	return DecryptKeyPEM(keyPEM, pass)
+}
+
+// VerifyPassphrase checks passphrase against the encrypted client key at
+// path, e.g. before revealing a reprompt secret. It returns
+// ErrIncorrectPassphrase if the passphrase is wrong, ErrKeyNotEncrypted
+// if the key has no passphrase to check and ErrKeyInKeystore if the key is
+// held by the OS keystore.
+func VerifyPassphrase(path string, passphrase []byte) error {
+	keyPEM, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := keystoreLabel(keyPEM); ok {
+		return ErrKeyInKeystore
+	}
+	if !IsEncryptedKeyPEM(keyPEM) {
+		return ErrKeyNotEncrypted
+	}
+	_, err = DecryptKeyPEM(keyPEM, passphrase)
+	return err
+}
+
+// EncryptKeyFile encrypts the plaintext client key at path in place, which
+// migrates keys saved by clients that stored them unencrypted.
+func EncryptKeyFile(path string, passphrase []byte) error {
+	keyPEM, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	enc, err := EncryptKeyPEM(keyPEM, passphrase)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, enc, 0600)
+}
+
+// parsePrivateKey parses an unencrypted RSA, ECDSA or PKCS#8 key block.
+func parsePrivateKey(block *pem.Block) (any, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("storage: unsupported key type %q", block.Type)
+}
+
+// marshalPrivateKey encodes key in the traditional format for its type,
+// the format the server issues keys in.
+func marshalPrivateKey(key any) (*pem.Block, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}, nil
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("storage: %w", err)
+		}
+		return &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}, nil
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("storage: %w", err)
+	}
+	return &pem.Block{Type: "PRIVATE KEY", Bytes: der}, nil
+}
+
+// PromptPassphrase returns a PassphraseFunc that takes the passphrase from
+// PassphraseEnv or asks for it once, remembering the answer so the key can
+// be read several times with a single prompt.
+func PromptPassphrase() PassphraseFunc {
+	var pass []byte
+	return func() ([]byte, error) {
+		if pass != nil {
+			return pass, nil
+		}
+		if env, ok := os.LookupEnv(PassphraseEnv); ok {
+			pass = []byte(env)
+			return pass, nil
+		}
+		p, err := ReadPassphrase("Client key passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		pass = p
+		return pass, nil
+	}
+}
+
+// PromptNewPassphrase returns a PassphraseFunc that takes a new passphrase
+// from PassphraseEnv or asks for it twice. An empty passphrase means the
+// key is stored unencrypted.
+func PromptNewPassphrase() PassphraseFunc {
+	return func() ([]byte, error) {
+		if env, ok := os.LookupEnv(PassphraseEnv); ok {
+			return []byte(env), nil
+		}
+		pass, err := ReadPassphrase("New client key passphrase (empty for none): ")
+		if err != nil || len(pass) == 0 {
+			return pass, err
+		}
+		again, err := ReadPassphrase("Repeat passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(pass, again) {
+			return nil, errors.New("passphrases do not match")
+		}
+		return pass, nil
+	}
+}
+
+// ReadPassphrase prints prompt to stderr and reads a line from stdin with
+// terminal echo turned off.
+func ReadPassphrase(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if setEcho(os.Stdin, false) {
+		defer func() {
+			setEcho(os.Stdin, true)
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	scanner := StdinScanner()
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	return []byte(scanner.Text()), nil
+}
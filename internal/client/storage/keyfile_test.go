@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func generateTestECKey(t *testing.T) []byte {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey failed: %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey failed: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func TestEncryptKeyPEM_RoundTrip(t *testing.T) {
+	pass := []byte("s3cret")
+	for name, keyPEM := range map[string][]byte{"EC": generateTestECKey(t), "RSA": generateTestRSAKey(t)} {
+		enc, err := EncryptKeyPEM(keyPEM, pass)
+		if err != nil {
+			t.Fatalf("%s: EncryptKeyPEM returned error: %v", name, err)
+		}
+		if !IsEncryptedKeyPEM(enc) || IsEncryptedKeyPEM(keyPEM) {
+			t.Errorf("%s: IsEncryptedKeyPEM does not tell encrypted and plain keys apart", name)
+		}
+		if bytes.Contains(enc, keyPEM) {
+			t.Errorf("%s: encrypted key contains the plaintext key", name)
+		}
+
+		// The vault key is derived from the decrypted key, so it must
+		// be restored byte for byte.
+		dec, err := DecryptKeyPEM(enc, pass)
+		if err != nil {
+			t.Fatalf("%s: DecryptKeyPEM returned error: %v", name, err)
+		}
+		if !bytes.Equal(dec, keyPEM) {
+			t.Errorf("%s: decrypted key differs from the original", name)
+		}
+
+		if _, err := DecryptKeyPEM(enc, []byte("wrong")); !errors.Is(err, ErrIncorrectPassphrase) {
+			t.Errorf("%s: DecryptKeyPEM with wrong passphrase = %v; want %v", name, err, ErrIncorrectPassphrase)
+		}
+		if _, err := EncryptKeyPEM(enc, pass); !errors.Is(err, ErrKeyAlreadyEncrypted) {
+			t.Errorf("%s: EncryptKeyPEM of encrypted key = %v; want %v", name, err, ErrKeyAlreadyEncrypted)
+		}
+	}
+}
+
+func TestEncryptKeyFile(t *testing.T) {
+	keyPEM := generateTestECKey(t)
+	path := filepath.Join(t.TempDir(), "client.key")
+	if err := os.WriteFile(path, keyPEM, 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+
+	if !IsUnencryptedKeyFile(path) {
+		t.Error("IsUnencryptedKeyFile = false before encryption")
+	}
+	if err := EncryptKeyFile(path, []byte("pw")); err != nil {
+		t.Fatalf("EncryptKeyFile returned error: %v", err)
+	}
+	if IsUnencryptedKeyFile(path) || IsUnencryptedKeyFile(path+".missing") {
+		t.Error("IsUnencryptedKeyFile = true for an encrypted or missing key")
+	}
+	if _, err := ReadKeyPEM(path, nil); !errors.Is(err, ErrKeyEncrypted) {
+		t.Errorf("ReadKeyPEM without passphrase = %v; want %v", err, ErrKeyEncrypted)
+	}
+
+	calls := 0
+	passphrase := func() ([]byte, error) {
+		calls++
+		return []byte("pw"), nil
+	}
+	got, err := ReadKeyPEM(path, passphrase)
+	if err != nil {
+		t.Fatalf("ReadKeyPEM returned error: %v", err)
+	}
+	if !bytes.Equal(got, keyPEM) {
+		t.Error("ReadKeyPEM did not return the original key")
+	}
+	if calls != 1 {
+		t.Errorf("passphrase asked %d times; want 1", calls)
+	}
+}
+
+func TestVerifyPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.key")
+	if err := os.WriteFile(path, generateTestECKey(t), 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	if err := VerifyPassphrase(path, []byte("pw")); !errors.Is(err, ErrKeyNotEncrypted) {
+		t.Errorf("unencrypted key: error = %v; want %v", err, ErrKeyNotEncrypted)
+	}
+	if err := EncryptKeyFile(path, []byte("pw")); err != nil {
+		t.Fatalf("EncryptKeyFile returned error: %v", err)
+	}
+	if err := VerifyPassphrase(path, []byte("pw")); err != nil {
+		t.Errorf("correct passphrase: error = %v", err)
+	}
+	if err := VerifyPassphrase(path, []byte("wrong")); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Errorf("wrong passphrase: error = %v; want %v", err, ErrIncorrectPassphrase)
+	}
+}
+
+func TestLoadClientCertificate_EncryptedKey(t *testing.T) {
+	certPEM, keyPEM, _, _ := generateCACert(t)
+	enc, err := EncryptKeyPEM(keyPEM, []byte("pw"))
+	if err != nil {
+		t.Fatalf("EncryptKeyPEM returned error: %v", err)
+	}
+
+	tmp := t.TempDir()
+	certPath := filepath.Join(tmp, "client.crt")
+	keyPath := filepath.Join(tmp, "client.key")
+	if err := os.WriteFile(certPath, certPEM, 0600); err != nil {
+		t.Fatalf("failed to write cert file: %v", err)
+	}
+	if err := os.WriteFile(keyPath, enc, 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+
+	if _, err := LoadClientCertificate(certPath, keyPath, certPath); !errors.Is(err, ErrKeyEncrypted) {
+		t.Errorf("LoadClientCertificate without passphrase = %v; want %v", err, ErrKeyEncrypted)
+	}
+	wrong := WithPassphrase(func() ([]byte, error) { return []byte("nope"), nil })
+	if _, err := LoadClientCertificate(certPath, keyPath, certPath, wrong); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Errorf("LoadClientCertificate with wrong passphrase = %v; want %v", err, ErrIncorrectPassphrase)
+	}
+	right := WithPassphrase(func() ([]byte, error) { return []byte("pw"), nil })
+	if _, err := LoadClientCertificate(certPath, keyPath, certPath, right); err != nil {
+		t.Errorf("LoadClientCertificate returned error: %v", err)
+	}
+}
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/atinyakov/GophKeeper/internal/client/keystore"
+)
+
+// keystoreBlockType is the PEM type of key files standing for a client key
+// held by the OS keystore, which cannot be exported. The label of the key
+// in the keystore is in the Label header.
+const keystoreBlockType = "GOPHKEEPER KEYSTORE KEY"
+
+// ErrKeyInKeystore is returned by the operations that need the client key
+// itself, e.g. encrypting it, when it is held by the OS keystore.
+var ErrKeyInKeystore = errors.New("client key is held by the OS keystore")
+
+// WithKeystore makes the client keep keys in ks, e.g. a keystore.Memory in
+// tests, instead of the keystore of the OS.
+func WithKeystore(ks keystore.Store) ClientOption {
+	return func(o *clientOptions) {
+		o.keystore = ks
+	}
+}
+
+// keystoreStore returns the keystore set by WithKeystore, or the one of
+// the OS.
+func (o clientOptions) keystoreStore() (keystore.Store, error) {
+	if o.keystore != nil {
+		return o.keystore, nil
+	}
+	return keystore.System()
+}
+
+// keystoreLabel returns the label of the key keyPEM stands for, if it is a
+// reference to a key held by the OS keystore.
+func keystoreLabel(keyPEM []byte) (string, bool) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil || block.Type != keystoreBlockType || block.Headers["Label"] == "" {
+		return "", false
+	}
+	return block.Headers["Label"], true
+}
+
+// keystoreKeyPEM returns the key file content standing for the key under
+// label in the OS keystore.
+func keystoreKeyPEM(label string) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: keystoreBlockType, Headers: map[string]string{"Label": label}})
+}
+
+// newKeystoreLabel returns a fresh label for a client key of login.
+func newKeystoreLabel(login string) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "gophkeeper:" + login + ":" + hex.EncodeToString(b), nil
+}
+
+// IsKeystoreKeyFile reports whether the file at path stands for a client
+// key held by the OS keystore. Unreadable files report false.
+func IsKeystoreKeyFile(path string) bool {
+	keyPEM, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	_, ok := keystoreLabel(keyPEM)
+	return ok
+}
+
+// MoveKeyToKeystore imports the client key at keyFile, decrypted with the
+// passphrase given by WithPassphrase if needed, into the OS keystore as a
+// non-exportable key, and replaces keyFile with a reference to it. From
+// then on LoadClientCertificate signs with the keystore, and renewals
+// generate the new key in it, see RenewCertificate. The key must match the
+// certificate at certFile. It returns the label of the key.
+//
+// Vaults that predate master passwords are encrypted with a key derived
+// from the client key, which is unavailable once moved; callers migrate
+// them first, see LocalStorage.SetMasterPassword.
+func MoveKeyToKeystore(certFile, keyFile string, opts ...ClientOption) (string, error) {
+	o := newClientOptions(opts)
+	ks, err := o.keystoreStore()
+	if err != nil {
+		return "", err
+	}
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read client cert: %w", err)
+	}
+	keyPEM, err := ReadKeyPEM(keyFile, o.passphrase)
+	if err != nil {
+		return "", fmt.Errorf("failed to read client key: %w", err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return "", fmt.Errorf("failed to load client cert/key: %w", err)
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("client key of type %T cannot be moved to the keystore", pair.PrivateKey)
+	}
+
+	label, err := newKeystoreLabel(pair.Leaf.Subject.CommonName)
+	if err != nil {
+		return "", err
+	}
+	if _, err := ks.Import(label, key); err != nil {
+		return "", err
+	}
+	if err := WritePrivateFile(keyFile, keystoreKeyPEM(label)); err != nil {
+		_ = ks.Delete(label)
+		return "", fmt.Errorf("failed to save %s: %w", keyFile, err)
+	}
+	return label, nil
+}
+
+// loadKeystoreClient builds an mTLS client from the certificate at
+// certFile and the key under label in the keystore.
+func loadKeystoreClient(certFile, label, caFile string, o clientOptions, opts []ClientOption) (*http.Client, error) {
+	ks, err := o.keystoreStore()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client key: %w", err)
+	}
+	signer, err := ks.Open(label)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client key: %w", err)
+	}
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client cert: %w", err)
+	}
+	return NewSignerClient(certPEM, signer, caFile, opts...)
+}
+
+// renewInKeystore renews the certificate whose key is under oldLabel in
+// the keystore: a new key is generated in the keystore and certified by
+// the server from a certificate request, so that it never leaves the
+// keystore either. keyFile, which holds oldKey, is replaced with a
+// reference to the new key and the old key deleted, once the certificate
+// is saved.
+func renewInKeystore(remote Remote, baseURL, certFile, keyFile string, oldKey []byte, oldLabel string, o clientOptions) (*x509.Certificate, error) {
+	ks, err := o.keystoreStore()
+	if err != nil {
+		return nil, err
+	}
+	old, err := ks.Open(oldLabel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client key: %w", err)
+	}
+	oldCert, err := readCertFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	if !samePublicKey(old, oldCert) {
+		return nil, errors.New("client key does not match the certificate")
+	}
+
+	label, err := newKeystoreLabel(oldCert.Subject.CommonName)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ks.Generate(label)
+	if err != nil {
+		return nil, err
+	}
+	renewed := false
+	defer func() {
+		if !renewed {
+			_ = ks.Delete(label)
+		}
+	}()
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, signer)
+	if err != nil {
+		return nil, fmt.Errorf("creating certificate request: %w", err)
+	}
+	creds, err := remote.Renew(baseURL, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}))
+	if err != nil {
+		return nil, err
+	}
+	cert, err := parseCertPEM([]byte(creds.Cert))
+	if err != nil {
+		return nil, fmt.Errorf("invalid renewed certificate: %w", err)
+	}
+	if !samePublicKey(signer, cert) {
+		return nil, errors.New("invalid renewed certificate: not issued for the new key")
+	}
+
+	if err := WritePrivateFile(keyFile, keystoreKeyPEM(label)); err != nil {
+		return nil, fmt.Errorf("failed to save %s: %w", keyFile, err)
+	}
+	if err := WritePrivateFile(certFile, []byte(creds.Cert)); err != nil {
+		// Keep the files a matching pair
+		if restoreErr := WritePrivateFile(keyFile, oldKey); restoreErr != nil {
+			logger.Error("failed to restore client key", zap.Error(restoreErr))
+		}
+		return nil, fmt.Errorf("failed to save %s: %w", certFile, err)
+	}
+	renewed = true
+	// The old certificate is revoked, so its key is of no further use
+	if err := ks.Delete(oldLabel); err != nil {
+		logger.Warn("failed to delete the replaced key from the keystore", zap.Error(err))
+	}
+	return cert, nil
+}
+
+// samePublicKey reports whether signer holds the key certified by cert.
+func samePublicKey(signer crypto.Signer, cert *x509.Certificate) bool {
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pub.Equal(cert.PublicKey)
+}
+
+// readCertFile parses the first certificate in the PEM file at path.
+func readCertFile(path string) (*x509.Certificate, error) {
+	certPEM, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client cert: %w", err)
+	}
+	cert, err := parseCertPEM(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client cert: %w", err)
+	}
+	return cert, nil
+}
+
+// parseCertPEM parses the first certificate in certPEM.
+func parseCertPEM(certPEM []byte) (*x509.Certificate, error) {
+	for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+	return nil, errors.New("no certificate found")
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atinyakov/GophKeeper/internal/client/keystore"
+)
+
+// newKeystoreCredentials registers alice with remote and returns the
+// certificate and key files saved, the key unencrypted.
+func newKeystoreCredentials(t *testing.T, remote *MemoryRemote) (certFile, keyFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if _, err := Register("https://a.example", "alice", "", WithRemote(remote), WithCredentialFiles(certFile, keyFile)); err != nil {
+		t.Fatalf("Register returned error: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestMoveKeyToKeystore(t *testing.T) {
+	ks := &keystore.Memory{}
+	certFile, keyFile := newKeystoreCredentials(t, &MemoryRemote{})
+
+	label, err := MoveKeyToKeystore(certFile, keyFile, WithKeystore(ks))
+	if err != nil {
+		t.Fatalf("MoveKeyToKeystore returned error: %v", err)
+	}
+	if _, err := ks.Open(label); err != nil {
+		t.Fatalf("key not in the keystore: %v", err)
+	}
+	keyPEM, _ := os.ReadFile(keyFile)
+	if block, _ := pem.Decode(keyPEM); block == nil || block.Type != keystoreBlockType {
+		t.Fatalf("key file = %q; want a keystore reference", keyPEM)
+	}
+	if !IsKeystoreKeyFile(keyFile) || IsUnencryptedKeyFile(keyFile) {
+		t.Error("key file not reported as held by the keystore")
+	}
+
+	// The key cannot be read or moved again
+	if _, err := ReadKeyPEM(keyFile, nil); !errors.Is(err, ErrKeyInKeystore) {
+		t.Errorf("ReadKeyPEM = %v; want ErrKeyInKeystore", err)
+	}
+	if err := EncryptKeyFile(keyFile, []byte("pass")); !errors.Is(err, ErrKeyInKeystore) {
+		t.Errorf("EncryptKeyFile = %v; want ErrKeyInKeystore", err)
+	}
+	if err := VerifyPassphrase(keyFile, []byte("pass")); !errors.Is(err, ErrKeyInKeystore) {
+		t.Errorf("VerifyPassphrase = %v; want ErrKeyInKeystore", err)
+	}
+	if _, err := MoveKeyToKeystore(certFile, keyFile, WithKeystore(ks)); !errors.Is(err, ErrKeyInKeystore) {
+		t.Errorf("second MoveKeyToKeystore = %v; want ErrKeyInKeystore", err)
+	}
+	if ks.Len() != 1 {
+		t.Errorf("keystore holds %d keys; want 1", ks.Len())
+	}
+}
+
+func TestLoadClientCertificate_Keystore(t *testing.T) {
+	ks := &keystore.Memory{}
+	certFile, keyFile := newKeystoreCredentials(t, &MemoryRemote{})
+	if _, err := MoveKeyToKeystore(certFile, keyFile, WithKeystore(ks)); err != nil {
+		t.Fatalf("MoveKeyToKeystore returned error: %v", err)
+	}
+
+	var peer string
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer = r.TLS.PeerCertificates[0].Subject.CommonName
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := LoadClientCertificate(certFile, keyFile, caPath, WithKeystore(ks))
+	if err != nil {
+		t.Fatalf("LoadClientCertificate returned error: %v", err)
+	}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if peer != "alice" {
+		t.Errorf("server saw certificate of %q; want alice", peer)
+	}
+
+	// Without the key in the keystore the client cannot be built
+	if _, err := LoadClientCertificate(certFile, keyFile, caPath, WithKeystore(&keystore.Memory{})); !errors.Is(err, keystore.ErrNotFound) {
+		t.Errorf("LoadClientCertificate with an empty keystore = %v; want ErrNotFound", err)
+	}
+}
+
+func TestRenewCertificate_Keystore(t *testing.T) {
+	ks := &keystore.Memory{}
+	remote := &MemoryRemote{}
+	certFile, keyFile := newKeystoreCredentials(t, remote)
+	oldLabel, err := MoveKeyToKeystore(certFile, keyFile, WithKeystore(ks))
+	if err != nil {
+		t.Fatalf("MoveKeyToKeystore returned error: %v", err)
+	}
+
+	// Failed renewals keep the current key
+	remote.Err = errors.New("down")
+	if _, err := RenewCertificate(remote, "https://a.example", certFile, keyFile, nil, WithKeystore(ks)); !errors.Is(err, remote.Err) {
+		t.Fatalf("RenewCertificate = %v; want the remote's error", err)
+	}
+	if _, err := ks.Open(oldLabel); err != nil || ks.Len() != 1 {
+		t.Fatalf("failed renewal left %d keys, current %v; want the current key only", ks.Len(), err)
+	}
+
+	remote.Err = nil
+	cert, err := RenewCertificate(remote, "https://a.example", certFile, keyFile, nil, WithKeystore(ks))
+	if err != nil {
+		t.Fatalf("RenewCertificate returned error: %v", err)
+	}
+	keyPEM, _ := os.ReadFile(keyFile)
+	label, ok := keystoreLabel(keyPEM)
+	if !ok || label == oldLabel {
+		t.Fatalf("key file = %q; want a reference to a new key", keyPEM)
+	}
+	signer, err := ks.Open(label)
+	if err != nil {
+		t.Fatalf("new key not in the keystore: %v", err)
+	}
+	if !samePublicKey(signer, cert) {
+		t.Error("renewed certificate is not for the new key")
+	}
+	if _, err := ks.Open(oldLabel); !errors.Is(err, keystore.ErrNotFound) || ks.Len() != 1 {
+		t.Errorf("replaced key kept: %d keys", ks.Len())
+	}
+	saved, err := readCertFile(certFile)
+	if err != nil || !saved.Equal(cert) {
+		t.Errorf("certificate file not replaced: %v", err)
+	}
+}
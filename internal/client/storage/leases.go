@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Lease is the lifetime of an API token, see RequestLease.
+type Lease struct {
+	ID        string `json:"id"`
+	IssuedAt  int64  `json:"issued_at"`  // Unix time the token was issued
+	TTL       int64  `json:"ttl"`        // lifetime in seconds granted by renewals, 0 for never expiring
+	ExpiresAt int64  `json:"expires_at"` // Unix time from which the token is rejected, 0 for never
+	LastFetch int64  `json:"last_fetch"` // Unix time the token was last sent a secret
+	Fetched   int64  `json:"fetched"`    // number of distinct secrets sent to the token
+}
+
+// RequestLease asks the server for an API token expiring after ttl, e.g.
+// for a CI job, and returns the token and its lease. Only the ID and
+// expiry of the lease are set.
+func RequestLease(client *http.Client, baseURL string, ttl time.Duration) (string, *Lease, error) {
+	body, err := json.Marshal(map[string]int64{"ttl": int64(ttl / time.Second)})
+	if err != nil {
+		return "", nil, err
+	}
+	resp, err := client.Post(baseURL+"/api/tokens", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, newStatusError(resp)
+	}
+
+	var result struct {
+		Token     string `json:"token"`
+		LeaseID   string `json:"lease_id"`
+		ExpiresAt int64  `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.Token, &Lease{ID: result.LeaseID, TTL: int64(ttl / time.Second), ExpiresAt: result.ExpiresAt}, nil
+}
+
+// FetchLeases retrieves the leases of the user's API tokens from the
+// server's /api/leases endpoint, oldest first.
+func FetchLeases(client *http.Client, baseURL string) ([]Lease, error) {
+	resp, err := client.Get(baseURL + "/api/leases")
+	if err != nil {
+		return nil, fmt.Errorf("leases request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp)
+	}
+
+	var result struct {
+		Leases []Lease `json:"leases"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return result.Leases, nil
+}
+
+// RenewLease extends the lease with the given ID to expire ttl from now,
+// or its own TTL if ttl is 0, and returns the renewed lease.
+func RenewLease(client *http.Client, baseURL, id string, ttl time.Duration) (*Lease, error) {
+	var body io.Reader = http.NoBody
+	if ttl != 0 {
+		data, err := json.Marshal(map[string]int64{"ttl": int64(ttl / time.Second)})
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	resp, err := client.Post(baseURL+"/api/leases/"+url.PathEscape(id)+"/renew", "application/json", body)
+	if err != nil {
+		return nil, fmt.Errorf("renew request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp)
+	}
+
+	var lease Lease
+	if err := json.NewDecoder(resp.Body).Decode(&lease); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return &lease, nil
+}
+
+// RevokeLease revokes the API token with the given lease ID.
+func RevokeLease(client *http.Client, baseURL, id string) error {
+	req, err := http.NewRequest(http.MethodDelete, baseURL+"/api/leases/"+url.PathEscape(id), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("revoke request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return newStatusError(resp)
+	}
+	return nil
+}
+
+// PrintLeases writes one line per lease to w: the ID, when it was issued
+// and expires, and the secrets sent to the token.
+func PrintLeases(w io.Writer, leases []Lease, now time.Time) {
+	for _, l := range leases {
+		expires := "never expires"
+		switch {
+		case l.ExpiresAt == 0:
+		case now.Unix() >= l.ExpiresAt:
+			expires = "expired " + formatUnix(l.ExpiresAt)
+		default:
+			expires = "expires " + formatUnix(l.ExpiresAt)
+		}
+		fmt.Fprintf(w, "%s  issued %s  %-27s  %d secrets fetched, last %s\n", l.ID, formatUnix(l.IssuedAt), expires, l.Fetched, formatUnix(l.LastFetch))
+	}
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLeases(t *testing.T) {
+	var requests []string
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		var body []byte
+		if req.Body != nil {
+			body, _ = io.ReadAll(req.Body)
+		}
+		requests = append(requests, req.Method+" "+req.URL.Path+" "+string(body))
+		resp := &http.Response{StatusCode: http.StatusOK}
+		switch req.URL.Path {
+		case "/api/tokens":
+			resp.Body = io.NopCloser(strings.NewReader(`{"token":"t1","lease_id":"l1","expires_at":4600}`))
+		case "/api/leases":
+			resp.Body = io.NopCloser(strings.NewReader(`{"leases":[{"id":"l1","issued_at":1000,"ttl":3600,"expires_at":4600,"last_fetch":0,"fetched":0}]}`))
+		case "/api/leases/l1/renew":
+			resp.Body = io.NopCloser(strings.NewReader(`{"id":"l1","ttl":60,"expires_at":2000}`))
+		default:
+			resp.StatusCode = http.StatusNoContent
+			resp.Body = http.NoBody
+		}
+		return resp, nil
+	})
+
+	token, lease, err := RequestLease(client, "http://example.com", time.Hour)
+	if err != nil || token != "t1" || lease.ID != "l1" || lease.ExpiresAt != 4600 {
+		t.Fatalf("RequestLease = %q, %+v, %v", token, lease, err)
+	}
+	leases, err := FetchLeases(client, "http://example.com")
+	if err != nil || len(leases) != 1 || leases[0].TTL != 3600 {
+		t.Fatalf("FetchLeases = %+v, %v", leases, err)
+	}
+	if lease, err := RenewLease(client, "http://example.com", "l1", time.Minute); err != nil || lease.ExpiresAt != 2000 {
+		t.Fatalf("RenewLease = %+v, %v", lease, err)
+	}
+	if _, err := RenewLease(client, "http://example.com", "l1", 0); err != nil {
+		t.Fatalf("RenewLease without ttl: %v", err)
+	}
+	if err := RevokeLease(client, "http://example.com", "l1"); err != nil {
+		t.Fatalf("RevokeLease: %v", err)
+	}
+
+	want := []string{
+		`POST /api/tokens {"ttl":3600}`,
+		`GET /api/leases `,
+		`POST /api/leases/l1/renew {"ttl":60}`,
+		`POST /api/leases/l1/renew `,
+		`DELETE /api/leases/l1 `,
+	}
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests:\n%s\nwant:\n%s", strings.Join(requests, "\n"), strings.Join(want, "\n"))
+	}
+
+	var buf bytes.Buffer
+	PrintLeases(&buf, leases, time.Unix(5000, 0))
+	if !strings.Contains(buf.String(), "l1") || !strings.Contains(buf.String(), "expired") {
+		t.Errorf("output = %q; want the expired lease l1", buf.String())
+	}
+}
+
+func TestRevokeLease_ServerError(t *testing.T) {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body, _ := json.Marshal(map[string]any{"status": 404, "code": "not-found", "detail": "lease not found"})
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Header:     http.Header{"Content-Type": {"application/problem+json"}},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+
+	if err := RevokeLease(client, "http://example.com", "l1"); err == nil || !strings.Contains(err.Error(), "lease not found") {
+		t.Errorf("expected server error, got %v", err)
+	}
+}
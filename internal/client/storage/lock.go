@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// lockSuffix is appended to the path of the local store to name the
+// advisory lock serializing its saves between processes, e.g. the shell
+// and the ssh-agent, see Save.
+const lockSuffix = ".lock"
+
+// lockTimeout is how long acquireLock waits for another process to
+// release the lock, polling every lockRetry.
+var (
+	lockTimeout = 10 * time.Second
+	lockRetry   = 50 * time.Millisecond
+)
+
+// ErrVaultLocked is returned when another process holds the vault lock
+// for longer than a save waits for it.
+var ErrVaultLocked = errors.New("vault is locked by another process")
+
+// fileLock is an advisory lock held on a file, see acquireLock.
+type fileLock struct {
+	f *os.File
+}
+
+// acquireLock locks the file at path exclusively with flock or
+// LockFileEx, waiting up to lockTimeout for other processes. The lock is
+// released by the system when its holder exits, even if it crashed. The
+// holder writes its PID and host into the file, so that a lock the
+// system keeps for a process that is gone, as network file systems may,
+// is detected as stale and broken by removing the file.
+func acquireLock(path string) (*fileLock, error) {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+		if locked {
+			// A stale lock may have been broken after the file was opened
+			if current(f, path) {
+				_ = f.Truncate(0)
+				_, _ = f.WriteAt([]byte(lockHolder()), 0)
+				return &fileLock{f: f}, nil
+			}
+			_ = unlockFile(f)
+			f.Close()
+			continue
+		}
+
+		pid, host := readLockHolder(f)
+		f.Close()
+		if self, _ := os.Hostname(); pid > 0 && host == self && !processAlive(pid) {
+			logger.Warn("breaking stale vault lock", zap.String("path", path), zap.Int("pid", pid))
+			if os.Remove(path) == nil {
+				continue
+			}
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w (pid %d on %s)", ErrVaultLocked, pid, host)
+		}
+		time.Sleep(lockRetry)
+	}
+}
+
+// release releases the lock. The file is kept, since other processes may
+// have it open to wait for the lock.
+func (l *fileLock) release() error {
+	err := unlockFile(l.f)
+	return errors.Join(err, l.f.Close())
+}
+
+// current reports whether f is still the file at path.
+func current(f *os.File, path string) bool {
+	opened, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	named, err := os.Stat(path)
+	return err == nil && os.SameFile(opened, named)
+}
+
+// lockHolder returns the content of a held lock file: the PID and host of
+// the process.
+func lockHolder() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%d %s\n", os.Getpid(), host)
+}
+
+// readLockHolder returns the PID and host written into the lock file f by
+// its holder, or 0 if it wrote none.
+func readLockHolder(f *os.File) (pid int, host string) {
+	buf := make([]byte, 256)
+	n, _ := f.ReadAt(buf, 0)
+	fields := strings.Fields(string(buf[:n]))
+	if len(fields) != 2 {
+		return 0, ""
+	}
+	pid, _ = strconv.Atoi(fields[0])
+	return pid, fields[1]
+}
@@ -0,0 +1,22 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly && !windows
+
+package storage
+
+import "os"
+
+// tryLockFile is not supported on this platform; saves are not serialized
+// between processes, but still merged, see Save.
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+// unlockFile releases the lock of tryLockFile.
+func unlockFile(f *os.File) error {
+	return nil
+}
+
+// processAlive reports whether the process pid exists; without locks it is
+// never asked.
+func processAlive(pid int) bool {
+	return true
+}
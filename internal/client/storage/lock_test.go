@@ -0,0 +1,79 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package storage
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// shortLockTimeout makes acquireLock give up quickly until the test ends.
+func shortLockTimeout(t *testing.T) {
+	t.Helper()
+	timeout, retry := lockTimeout, lockRetry
+	lockTimeout, lockRetry = 100*time.Millisecond, 10*time.Millisecond
+	t.Cleanup(func() { lockTimeout, lockRetry = timeout, retry })
+}
+
+func TestAcquireLock(t *testing.T) {
+	shortLockTimeout(t)
+	path := filepath.Join(t.TempDir(), "vault.lock")
+
+	lock, err := acquireLock(path)
+	if err != nil {
+		t.Fatalf("acquireLock failed: %v", err)
+	}
+	if pid, _ := readLockHolder(lock.f); pid != os.Getpid() {
+		t.Errorf("lock holder = %d, want %d", pid, os.Getpid())
+	}
+	// flock locks belong to the open file, so a second one waits here too
+	if _, err := acquireLock(path); !errors.Is(err, ErrVaultLocked) {
+		t.Errorf("second acquireLock = %v, want ErrVaultLocked", err)
+	}
+	if err := lock.release(); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+	lock, err = acquireLock(path)
+	if err != nil {
+		t.Fatalf("acquireLock after release failed: %v", err)
+	}
+	_ = lock.release()
+}
+
+func TestAcquireLock_Stale(t *testing.T) {
+	shortLockTimeout(t)
+	path := filepath.Join(t.TempDir(), "vault.lock")
+
+	// A process that is gone, still holding the lock as network file
+	// systems may keep it
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("cannot run a process: %v", err)
+	}
+	held, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+	if ok, err := tryLockFile(held); !ok || err != nil {
+		t.Fatalf("tryLockFile = %v, %v", ok, err)
+	}
+	host, _ := os.Hostname()
+	if _, err := held.WriteString(strconv.Itoa(cmd.Process.Pid) + " " + host + "\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := acquireLock(path)
+	if err != nil {
+		t.Fatalf("acquireLock of a stale lock = %v, want it broken", err)
+	}
+	defer lock.release()
+	if pid, _ := readLockHolder(lock.f); pid != os.Getpid() {
+		t.Errorf("lock holder = %d, want %d", pid, os.Getpid())
+	}
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// logger receives the diagnostics of the package, see SetLogger.
+var logger = zap.NewNop()
+
+// SetLogger routes the diagnostics of the package to l: failed background
+// syncs and other warnings and, at debug level, every request sent to the
+// servers. It must be called before any client is built.
+func SetLogger(l *zap.Logger) {
+	logger = l
+}
+
+// logTransport logs the requests of base and their outcome at debug level.
+type logTransport struct {
+	base http.RoundTripper
+}
+
+func (t *logTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	fields := []zap.Field{
+		zap.String("method", req.Method),
+		zap.String("url", req.URL.Redacted()),
+		zap.Duration("took", time.Since(start).Round(time.Millisecond)),
+	}
+	if err != nil {
+		logger.Debug("request failed", append(fields, zap.Error(err))...)
+		return nil, err
+	}
+	logger.Debug("request", append(fields, zap.Int("status", resp.StatusCode))...)
+	return resp, nil
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// observeLogs routes the package logs at level and above to the returned
+// observer for the duration of the test.
+func observeLogs(t *testing.T, level zapcore.Level) *observer.ObservedLogs {
+	core, logs := observer.New(level)
+	old := logger
+	SetLogger(zap.New(core))
+	t.Cleanup(func() { SetLogger(old) })
+	return logs
+}
+
+func TestClientLogsRequestsAtDebugLevel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer srv.Close()
+
+	logs := observeLogs(t, zapcore.DebugLevel)
+	resp, err := (clientOptions{}).client(nil).Get(srv.URL + "/api/version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	entries := logs.FilterMessage("request").All()
+	if len(entries) != 1 {
+		t.Fatalf("logged %d requests; want 1: %v", len(entries), logs.All())
+	}
+	fields := entries[0].ContextMap()
+	if fields["method"] != "GET" || fields["url"] != srv.URL+"/api/version" || fields["status"] != int64(http.StatusTeapot) {
+		t.Errorf("request logged with %v", fields)
+	}
+}
+
+func TestClientSkipsRequestLogAboveDebugLevel(t *testing.T) {
+	observeLogs(t, zapcore.InfoLevel)
+	if _, ok := (clientOptions{}).client(nil).Transport.(*logTransport); ok {
+		t.Error("client logs requests although debug logging is disabled")
+	}
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryRemote is a Remote that keeps the vault of one user in memory, so
+// that the sync, registration and renewal code can be tested end to end
+// without a server or sockets. The base URLs of the calls are ignored: one
+// MemoryRemote stands for all servers. The zero value is ready to use.
+//
+// Like the server, it stores uploads newer than its copies, reporting
+// conflicts for older ones changed since their BaseVersion, deletes the
+// secrets uploaded as deleted, keeping their tombstones, keeps the first
+// key derivation parameters sent and answers every sync with all its
+// secrets and tombstones and those parameters. Filters, etags and last known
+// versions are ignored, and neither concurrent edits nor vault summaries
+// are reported.
+type MemoryRemote struct {
+	// Err, if set, is returned by every call instead of answering it,
+	// e.g. to test how failing servers are handled.
+	Err error
+
+	mu      sync.Mutex
+	secrets map[string]Secret
+	kdf     *KDFParams
+	order   []string // IDs in the order they were first stored
+	login   string   // registered login, "" before Register
+	serial  int64    // serial number of the last certificate issued
+}
+
+// Secrets returns the secrets and tombstones the remote holds, in the order
+// they were first stored.
+func (m *MemoryRemote) Secrets() []Secret {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	secrets := make([]Secret, 0, len(m.order))
+	for _, id := range m.order {
+		secrets = append(secrets, m.secrets[id])
+	}
+	return secrets
+}
+
+// Sync stores the secrets of call and passes all secrets the remote holds
+// to add.
+func (m *MemoryRemote) Sync(_ string, call SyncCall, add func(Secret)) (*SyncResult, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.secrets == nil {
+		m.secrets = make(map[string]Secret)
+	}
+
+	if m.kdf == nil && call.KDF != nil {
+		kdf := *call.KDF
+		m.kdf = &kdf
+	}
+	res := &SyncResult{Versions: map[string]int64{}, Conflicts: []SyncConflict{}}
+	if m.kdf != nil {
+		kdf := *m.kdf
+		res.KDF = &kdf
+	}
+	for _, sec := range call.Secrets {
+		stored, ok := m.secrets[sec.ID]
+		switch {
+		case sec.Deleted:
+			// Deletions apply whatever the version, as on the server
+			sec = Secret{ID: sec.ID, Version: sec.Version, Deleted: true}
+		case ok && stored.Version >= sec.Version:
+			res.Skipped = append(res.Skipped, sec.ID)
+			if stored.Version > sec.Version && sec.BaseVersion != sec.Version {
+				res.Conflicts = append(res.Conflicts, SyncConflict{ID: sec.ID, Version: sec.Version, ServerVersion: stored.Version})
+			}
+			continue
+		default:
+			res.Updated = append(res.Updated, sec.ID)
+		}
+		if !ok {
+			m.order = append(m.order, sec.ID)
+		}
+		sec.Tags = slices.Clone(sec.Tags)
+		sec.BaseVersion = 0
+		m.secrets[sec.ID] = sec
+	}
+
+	for _, id := range m.order {
+		sec := m.secrets[id]
+		if !sec.Deleted {
+			res.Versions[id] = sec.Version
+			res.Version = max(res.Version, sec.Version)
+		}
+		add(sec)
+	}
+	return res, nil
+}
+
+// Register registers login and issues a self-signed certificate for it.
+// Only one login can be registered.
+func (m *MemoryRemote) Register(_, login string) (IssuedCredentials, error) {
+	if m.Err != nil {
+		return IssuedCredentials{}, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.login != "" {
+		return IssuedCredentials{}, &StatusError{StatusCode: http.StatusConflict, Message: "login already registered"}
+	}
+	creds, err := m.issue(login)
+	if err != nil {
+		return IssuedCredentials{}, err
+	}
+	m.login = login
+	creds.RecoveryCodes = []string{"MEMO-RY00"}
+	return creds, nil
+}
+
+// Renew issues a new self-signed certificate for the registered login,
+// for a new key or, if csr is not nil, the key of the request.
+func (m *MemoryRemote) Renew(_ string, csr []byte) (IssuedCredentials, error) {
+	if m.Err != nil {
+		return IssuedCredentials{}, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.login == "" {
+		return IssuedCredentials{}, &StatusError{StatusCode: http.StatusUnauthorized, Message: "not registered"}
+	}
+	if csr == nil {
+		return m.issue(m.login)
+	}
+	block, _ := pem.Decode(csr)
+	if block == nil {
+		return IssuedCredentials{}, &StatusError{StatusCode: http.StatusBadRequest, Message: "invalid certificate request"}
+	}
+	req, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil || req.CheckSignature() != nil {
+		return IssuedCredentials{}, &StatusError{StatusCode: http.StatusBadRequest, Message: "invalid certificate request"}
+	}
+	return m.certify(m.login, req.PublicKey, nil)
+}
+
+// issue returns a new key and a self-signed certificate for login, valid
+// for a day. m.mu must be held.
+func (m *MemoryRemote) issue(login string) (IssuedCredentials, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return IssuedCredentials{}, err
+	}
+	return m.certify(login, &key.PublicKey, key)
+}
+
+// certify returns a certificate for login and pub, valid for a day, signed
+// with key if it is set or self-signed. Only the credentials of generated
+// keys carry the key. m.mu must be held.
+func (m *MemoryRemote) certify(login string, pub any, key *ecdsa.PrivateKey) (IssuedCredentials, error) {
+	signer := key
+	if signer == nil {
+		// Certificates of client keys are signed by a throwaway CA key
+		var err error
+		if signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			return IssuedCredentials{}, err
+		}
+	}
+	m.serial++
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(m.serial),
+		Subject:      pkix.Name{CommonName: login},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, signer)
+	if err != nil {
+		return IssuedCredentials{}, err
+	}
+	creds := IssuedCredentials{Cert: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}))}
+	if key != nil {
+		keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return IssuedCredentials{}, err
+		}
+		creds.Key = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+	}
+	return creds, nil
+}
@@ -2,74 +2,369 @@ package storage
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"time"
+	"strings"
+
+	"github.com/atinyakov/GophKeeper/internal/pow"
+	"go.uber.org/zap"
 )
 
-func Register(baseURL, login, caPath string) error {
-	caCert, err := os.ReadFile(caPath)
+// registerPath is the path of the registration endpoint of the HTTP API.
+const registerPath = "/api/register"
+
+// IssuedCredentials are the certificate and key a server issues on
+// registration, recovery and renewal, with the recovery codes of a new
+// registration.
+type IssuedCredentials struct {
+	Cert          string   `json:"cert"`
+	Key           string   `json:"key"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Register registers login, saves the issued certificate and key as
+// client.crt and client.key, or the files set with WithCredentialFiles, and
+// returns the one-time recovery codes, which must be kept somewhere safe to
+// replace the certificate if it is lost.
+//
+// With WithTransport(TransportGRPC), the Register call of the gRPC API is
+// used instead, and with WithRemote the given Remote; baseURL still ends
+// in the path of the HTTP endpoint, /api/register.
+func Register(baseURL, login, caPath string, opts ...ClientOption) ([]string, error) {
+	o := newClientOptions(opts)
+	remote := o.remote
+	if remote == nil {
+		caPool, err := o.rootCAs(caPath)
+		if err != nil {
+			return nil, err
+		}
+		remote = NewRemote(o.client(&tls.Config{RootCAs: caPool}), o.transport)
+	}
+
+	// Ask for the passphrase up front: the issued key cannot be fetched again
+	pass, err := o.newPassphrase()
 	if err != nil {
-		return fmt.Errorf("failed to read CA cert: %w", err)
+		return nil, err
 	}
-	caPool := x509.NewCertPool()
-	if !caPool.AppendCertsFromPEM(caCert) {
-		return errors.New("failed to parse CA cert")
+
+	creds, err := remote.Register(strings.TrimSuffix(baseURL, registerPath), login)
+	if err != nil {
+		return nil, err
 	}
-	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: caPool}}}
+	return creds.RecoveryCodes, o.saveCredentials(creds, pass)
+}
 
+// Register registers login at the registration endpoint of the server at
+// baseURL, solving a proof-of-work challenge first if required.
+func (h httpRemote) Register(baseURL, login string) (IssuedCredentials, error) {
 	payload := map[string]string{"login": login}
-	b, _ := json.Marshal(payload)
-	resp, err := client.Post(baseURL, "application/json", bytes.NewReader(b))
+	resp, err := postJSON(h.client, baseURL+registerPath, payload)
+	if err != nil {
+		return IssuedCredentials{}, fmt.Errorf("register failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// The server may require a proof-of-work challenge to be solved first
+	if resp.StatusCode == http.StatusPreconditionRequired {
+		var c pow.Challenge
+		if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+			return IssuedCredentials{}, fmt.Errorf("failed to decode challenge: %w", err)
+		}
+		logger.Info("Solving registration challenge...", zap.Int("difficulty", c.Difficulty))
+		payload["challenge"] = c.Challenge
+		payload["solution"] = pow.Solve(c.Challenge, c.Difficulty)
+
+		resp, err = postJSON(h.client, baseURL+registerPath, payload)
+		if err != nil {
+			return IssuedCredentials{}, fmt.Errorf("register failed: %w", err)
+		}
+		defer resp.Body.Close()
+	}
+	return decodeCredentials(resp)
+}
+
+// Recover redeems one of the recovery codes of login for a replacement
+// certificate and key, saved as client.crt and client.key like on
+// registration. The code cannot be used again.
+func Recover(baseURL, login, code, caPath string, opts ...ClientOption) error {
+	o := newClientOptions(opts)
+	caPool, err := o.rootCAs(caPath)
+	if err != nil {
+		return err
+	}
+	client := o.client(&tls.Config{RootCAs: caPool})
+
+	pass, err := o.newPassphrase()
+	if err != nil {
+		return err
+	}
+
+	resp, err := postJSON(client, baseURL, map[string]string{"login": login, "code": code})
 	if err != nil {
-		return fmt.Errorf("register failed: %w", err)
+		return fmt.Errorf("recovery failed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	creds, err := decodeCredentials(resp)
+	if err != nil {
+		return err
+	}
+	return o.saveCredentials(creds, pass)
+}
+
+// newPassphrase returns the passphrase for a new client key, or nil if the
+// key is to be stored unencrypted.
+func (o clientOptions) newPassphrase() ([]byte, error) {
+	if o.passphrase == nil {
+		return nil, nil
+	}
+	pass, err := o.passphrase()
+	if err != nil {
+		return nil, fmt.Errorf("reading passphrase: %w", err)
+	}
+	return pass, nil
+}
+
+// decodeCredentials reads the certificate and key from a registration or
+// recovery response.
+func decodeCredentials(resp *http.Response) (IssuedCredentials, error) {
+	var creds IssuedCredentials
 	if resp.StatusCode != http.StatusOK {
-		data, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("server error: %s", string(data))
+		return creds, newStatusError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&creds); err != nil {
+		return creds, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return creds, nil
+}
+
+// saveCredentials writes the certificate and key files, see
+// WithCredentialFiles, encrypting the key with pass unless it is empty.
+func (o clientOptions) saveCredentials(creds IssuedCredentials, pass []byte) error {
+	if err := os.WriteFile(o.certFile, []byte(creds.Cert), 0600); err != nil {
+		return fmt.Errorf("failed to save %s: %w", o.certFile, err)
+	}
+	// If encryption fails the key is still saved, since it cannot be fetched again
+	keyPEM := []byte(creds.Key)
+	var encErr error
+	if len(pass) > 0 {
+		if enc, err := EncryptKeyPEM(keyPEM, pass); err != nil {
+			encErr = fmt.Errorf("%s saved unencrypted: %w", o.keyFile, err)
+		} else {
+			keyPEM = enc
+		}
+	}
+	if err := os.WriteFile(o.keyFile, keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to save %s: %w", o.keyFile, err)
+	}
+
+	return encErr
+}
+
+// postJSON sends payload as a JSON POST request to url.
+func postJSON(client *http.Client, url string, payload any) (*http.Response, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return client.Post(url, "application/json", bytes.NewReader(b))
+}
+
+// renewPath is the path of the certificate renewal endpoint of the HTTP
+// API.
+const renewPath = "/api/renew"
+
+// RenewCertificate asks the server, through remote, for a fresh
+// certificate and key replacing the current ones, which the server
+// revokes, and atomically swaps certFile and keyFile for them. If keyFile
+// is encrypted, the new key is encrypted with the same passphrase, which
+// is checked before the server is asked. It returns the new certificate.
+//
+// If the key is held by the OS keystore, the new key is generated in the
+// keystore instead and only its certificate is issued by the server, see
+// MoveKeyToKeystore; opts may set the keystore with WithKeystore.
+//
+// Only a vault that predates master passwords is encrypted with a key
+// derived from the client key; callers migrate it first, see
+// LocalStorage.SetMasterPassword. The client must be rebuilt with the new
+// files to use the new certificate.
+func RenewCertificate(remote Remote, baseURL, certFile, keyFile string, passphrase PassphraseFunc, opts ...ClientOption) (*x509.Certificate, error) {
+	oldKey, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client key: %w", err)
+	}
+	if label, ok := keystoreLabel(oldKey); ok {
+		return renewInKeystore(remote, baseURL, certFile, keyFile, oldKey, label, newClientOptions(opts))
+	}
+	var pass []byte
+	if IsEncryptedKeyPEM(oldKey) {
+		if passphrase == nil {
+			return nil, errors.New("client key is encrypted but no passphrase was provided")
+		}
+		if pass, err = passphrase(); err != nil {
+			return nil, fmt.Errorf("reading passphrase: %w", err)
+		}
+		if _, err := DecryptKeyPEM(oldKey, pass); err != nil {
+			return nil, fmt.Errorf("decrypting client key: %w", err)
+		}
+	}
+
+	creds, err := remote.Renew(baseURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := tls.X509KeyPair([]byte(creds.Cert), []byte(creds.Key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid renewed certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid renewed certificate: %w", err)
 	}
 
-	var certData map[string]string
-	if err := json.NewDecoder(resp.Body).Decode(&certData); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
+	keyPEM := []byte(creds.Key)
+	if len(pass) > 0 {
+		if keyPEM, err = EncryptKeyPEM(keyPEM, pass); err != nil {
+			return nil, fmt.Errorf("encrypting client key: %w", err)
+		}
 	}
-	if err := os.WriteFile("client.crt", []byte(certData["cert"]), 0600); err != nil {
-		return fmt.Errorf("failed to save client.crt: %w", err)
+	if err := WritePrivateFile(keyFile, keyPEM); err != nil {
+		return nil, fmt.Errorf("failed to save %s: %w", keyFile, err)
 	}
-	if err := os.WriteFile("client.key", []byte(certData["key"]), 0600); err != nil {
-		return fmt.Errorf("failed to save client.key: %w", err)
+	if err := WritePrivateFile(certFile, []byte(creds.Cert)); err != nil {
+		// Keep the files a matching pair
+		if restoreErr := WritePrivateFile(keyFile, oldKey); restoreErr != nil {
+			logger.Error("failed to restore client key", zap.Error(restoreErr))
+		}
+		return nil, fmt.Errorf("failed to save %s: %w", certFile, err)
 	}
+	return cert, nil
+}
 
-	fmt.Println("\u2705 Registration successful. Certificate and key saved.")
-	return nil
+// Renew asks the renewal endpoint of the server at baseURL, through the
+// mTLS client, for a new certificate and key, or for a certificate of the
+// key of csr.
+func (h httpRemote) Renew(baseURL string, csr []byte) (IssuedCredentials, error) {
+	var body io.Reader
+	if csr != nil {
+		b, err := json.Marshal(map[string]string{"csr": string(csr)})
+		if err != nil {
+			return IssuedCredentials{}, err
+		}
+		body = bytes.NewReader(b)
+	}
+	resp, err := h.client.Post(baseURL+renewPath, "application/json", body)
+	if err != nil {
+		return IssuedCredentials{}, fmt.Errorf("renewal failed: %w", err)
+	}
+	defer resp.Body.Close()
+	return decodeCredentials(resp)
 }
 
-func LoadClientCertificate(certFile, keyFile, caFile string) (*http.Client, error) {
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+// RequestToken asks the server for a new API bearer token for the
+// certificate holder. The token lets clients without a TLS client
+// certificate, such as the web UI, access the same vault.
+func RequestToken(client *http.Client, baseURL string) (string, error) {
+	resp, err := client.Post(baseURL+"/api/tokens", "application/json", nil)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", newStatusError(resp)
+	}
+
+	var result map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result["token"], nil
+}
+
+// LoadClientCertificate builds an mTLS client from the client certificate
+// and key files. An encrypted key is unlocked with the passphrase given by
+// WithPassphrase; a key file standing for a key held by the OS keystore,
+// see MoveKeyToKeystore, makes the client sign with the keystore.
+func LoadClientCertificate(certFile, keyFile, caFile string, opts ...ClientOption) (*http.Client, error) {
+	o := newClientOptions(opts)
+	rawKey, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client cert/key: %w", err)
+	}
+	if label, ok := keystoreLabel(rawKey); ok {
+		return loadKeystoreClient(certFile, label, caFile, o, opts)
+	}
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client cert/key: %w", err)
+	}
+	keyPEM, err := ReadKeyPEM(keyFile, o.passphrase)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load client cert/key: %w", err)
 	}
-	caCert, err := os.ReadFile(caFile)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read CA cert: %w", err)
+		return nil, fmt.Errorf("failed to load client cert/key: %w", err)
 	}
-	caPool := x509.NewCertPool()
-	caPool.AppendCertsFromPEM(caCert)
+	return newMTLSClient(cert, caFile, o)
+}
 
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			Certificates:       []tls.Certificate{cert},
-			RootCAs:            caPool,
-			InsecureSkipVerify: false,
-		},
+// NewSignerClient builds an mTLS client from the client certificate and a
+// crypto.Signer holding its private key. The signer may be backed by a
+// hardware token or an OS keystore whose keys cannot be exported; only its
+// signatures are used for the TLS handshake.
+func NewSignerClient(certPEM []byte, signer crypto.Signer, caFile string, opts ...ClientOption) (*http.Client, error) {
+	var cert tls.Certificate
+	for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			cert.Certificate = append(cert.Certificate, block.Bytes)
+		}
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, errors.New("failed to load client cert: no certificate found")
 	}
-	return &http.Client{Transport: transport, Timeout: 10 * time.Second}, nil
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client cert: %w", err)
+	}
+	if !samePublicKey(signer, leaf) {
+		return nil, errors.New("failed to load client cert: private key does not match certificate")
+	}
+	cert.PrivateKey = signer
+	cert.Leaf = leaf
+	return newMTLSClient(cert, caFile, newClientOptions(opts))
+}
+
+// NewClient builds a client that presents no client certificate, for the
+// requests that need none, e.g. of the server version.
+func NewClient(caFile string, opts ...ClientOption) (*http.Client, error) {
+	o := newClientOptions(opts)
+	caPool, err := o.rootCAs(caFile)
+	if err != nil {
+		return nil, err
+	}
+	return o.client(&tls.Config{RootCAs: caPool}), nil
+}
+
+// newMTLSClient builds a client presenting cert and trusting caFile.
+func newMTLSClient(cert tls.Certificate, caFile string, o clientOptions) (*http.Client, error) {
+	caPool, err := o.rootCAs(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.client(&tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		RootCAs:            caPool,
+		InsecureSkipVerify: false,
+	}), nil
 }
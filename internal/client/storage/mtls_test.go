@@ -2,13 +2,16 @@ package storage
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
+	"io"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
@@ -17,6 +20,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/pow"
 )
 
 // helper: generate a self-signed CA cert and key
@@ -50,7 +55,7 @@ func generateCACert(t *testing.T) (certPEM, keyPEM []byte, cert *x509.Certificat
 }
 
 func TestRegister_ReadCAError(t *testing.T) {
-	err := Register("http://example.com", "user", "nonexistent.pem")
+	_, err := Register("http://example.com", "user", "nonexistent.pem")
 	if err == nil || !errors.Is(err, os.ErrNotExist) {
 		t.Errorf("expected file not exist error, got %v", err)
 	}
@@ -63,7 +68,7 @@ func TestRegister_InvalidCA(t *testing.T) {
 	if err := os.WriteFile(caPath, []byte("invalid pem"), 0600); err != nil {
 		t.Fatalf("failed to write CA file: %v", err)
 	}
-	err := Register("http://example.com", "user", caPath)
+	_, err := Register("http://example.com", "user", caPath)
 	if err == nil || !strings.Contains(err.Error(), "failed to parse CA cert") {
 		t.Errorf("expected parse CA error, got %v", err)
 	}
@@ -84,7 +89,7 @@ func TestRegister_ServerError(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	err := Register(ts.URL, "user", caPath)
+	_, err := Register(ts.URL, "user", caPath)
 	if err == nil || !strings.Contains(err.Error(), "server error: oops") {
 		t.Errorf("expected server error message, got %v", err)
 	}
@@ -99,7 +104,7 @@ func TestRegister_Success(t *testing.T) {
 		t.Fatalf("failed to write CA file: %v", err)
 	}
 
-	respBody := map[string]string{"cert": "certdata", "key": "keydata"}
+	respBody := map[string]any{"cert": "certdata", "key": "keydata", "recovery_codes": []string{"AAAA-BBBB"}}
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(respBody)
@@ -111,10 +116,13 @@ func TestRegister_Success(t *testing.T) {
 	os.Chdir(tmp)
 	defer os.Chdir(cwd)
 
-	err := Register(ts.URL, "user", caPath)
+	codes, err := Register(ts.URL, "user", caPath)
 	if err != nil {
 		t.Fatalf("expected success, got %v", err)
 	}
+	if len(codes) != 1 || codes[0] != "AAAA-BBBB" {
+		t.Errorf("recovery codes = %v; want [AAAA-BBBB]", codes)
+	}
 	// check files
 	crt, err := os.ReadFile("client.crt")
 	if err != nil || string(crt) != "certdata" {
@@ -126,6 +134,156 @@ func TestRegister_Success(t *testing.T) {
 	}
 }
 
+func TestRegister_SolvesChallenge(t *testing.T) {
+	tmp := t.TempDir()
+	caPEM, _, _, _ := generateCACert(t)
+	caPath := filepath.Join(tmp, "ca.pem")
+	if err := os.WriteFile(caPath, caPEM, 0600); err != nil {
+		t.Fatalf("failed to write CA file: %v", err)
+	}
+
+	const challenge = "puzzle"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		if req["challenge"] == "" {
+			w.WriteHeader(http.StatusPreconditionRequired)
+			_ = json.NewEncoder(w).Encode(pow.Challenge{Challenge: challenge, Difficulty: 8})
+			return
+		}
+		if req["challenge"] != challenge || !pow.Valid(challenge, req["solution"], 8) {
+			http.Error(w, "invalid challenge solution", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"cert": "certdata", "key": "keydata"})
+	}))
+	defer ts.Close()
+
+	cwd, _ := os.Getwd()
+	os.Chdir(tmp)
+	defer os.Chdir(cwd)
+
+	if _, err := Register(ts.URL, "user", caPath); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if crt, err := os.ReadFile("client.crt"); err != nil || string(crt) != "certdata" {
+		t.Errorf("unexpected cert file content: %s, err: %v", crt, err)
+	}
+}
+func TestRecover(t *testing.T) {
+	tmp := t.TempDir()
+	caPEM, _, _, _ := generateCACert(t)
+	caPath := filepath.Join(tmp, "ca.pem")
+	if err := os.WriteFile(caPath, caPEM, 0600); err != nil {
+		t.Fatalf("failed to write CA file: %v", err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req["login"] != "user" || req["code"] != "AAAA-BBBB" {
+			http.Error(w, "invalid recovery code", http.StatusForbidden)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"cert": "newcert", "key": "newkey"})
+	}))
+	defer ts.Close()
+
+	cwd, _ := os.Getwd()
+	os.Chdir(tmp)
+	defer os.Chdir(cwd)
+
+	var statusErr *StatusError
+	if err := Recover(ts.URL, "user", "WRONG", caPath); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("Recover with wrong code = %v; want status 403", err)
+	}
+	if err := Recover(ts.URL, "user", "AAAA-BBBB", caPath); err != nil {
+		t.Fatalf("Recover returned error: %v", err)
+	}
+	if crt, err := os.ReadFile("client.crt"); err != nil || string(crt) != "newcert" {
+		t.Errorf("unexpected cert file content: %s, err: %v", crt, err)
+	}
+	if key, err := os.ReadFile("client.key"); err != nil || string(key) != "newkey" {
+		t.Errorf("unexpected key file content: %s, err: %v", key, err)
+	}
+}
+
+func TestRenewCertificate(t *testing.T) {
+	tmp := t.TempDir()
+	certPath := filepath.Join(tmp, "client.crt")
+	keyPath := filepath.Join(tmp, "client.key")
+	oldCert, oldKey, _, _ := generateCACert(t)
+	encKey, err := EncryptKeyPEM(oldKey, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCert, newKey, want, _ := generateCACert(t)
+
+	asked := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asked++
+		if r.Method != http.MethodPost || r.URL.Path != renewPath {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"cert": string(newCert), "key": string(newKey)})
+	}))
+	defer ts.Close()
+
+	write := func() {
+		t.Helper()
+		if err := os.WriteFile(certPath, oldCert, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(keyPath, encKey, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	passphrase := func(p string) PassphraseFunc {
+		return func() ([]byte, error) { return []byte(p), nil }
+	}
+
+	// A wrong passphrase is refused before the server revokes the certificate
+	write()
+	if _, err := RenewCertificate(NewRemote(ts.Client(), TransportHTTP), ts.URL, certPath, keyPath, passphrase("wrong")); err == nil {
+		t.Fatal("RenewCertificate with a wrong passphrase returned nil error")
+	}
+	if asked != 0 {
+		t.Errorf("server asked %d times with a wrong passphrase; want 0", asked)
+	}
+
+	cert, err := RenewCertificate(NewRemote(ts.Client(), TransportHTTP), ts.URL, certPath, keyPath, passphrase("secret"))
+	if err != nil {
+		t.Fatalf("RenewCertificate returned error: %v", err)
+	}
+	if !cert.Equal(want) {
+		t.Errorf("RenewCertificate returned %v; want the renewed certificate", cert.Subject)
+	}
+	if crt, _ := os.ReadFile(certPath); !bytes.Equal(crt, newCert) {
+		t.Errorf("certificate file was not replaced")
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil || !IsEncryptedKeyPEM(keyPEM) {
+		t.Fatalf("renewed key is not encrypted: %v", err)
+	}
+	if plain, err := DecryptKeyPEM(keyPEM, []byte("secret")); err != nil || !bytes.Equal(plain, newKey) {
+		t.Errorf("renewed key does not decrypt to the issued key: %v", err)
+	}
+
+	// A certificate not matching the key leaves the files as they are
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"cert": string(oldCert), "key": string(newKey)})
+	})
+	write()
+	if _, err := RenewCertificate(NewRemote(ts.Client(), TransportHTTP), ts.URL, certPath, keyPath, passphrase("secret")); err == nil {
+		t.Error("RenewCertificate with a mismatched key returned nil error")
+	}
+	if key, _ := os.ReadFile(keyPath); !bytes.Equal(key, encKey) {
+		t.Errorf("key file was replaced by a mismatched key")
+	}
+}
+
 func TestLoadClientCertificate(t *testing.T) {
 	// generate client cert/key
 	certPEM, keyPEM, _, _ := generateCACert(t)
@@ -169,3 +327,76 @@ func TestLoadClientCertificate(t *testing.T) {
 		t.Error("CA certificate not found in RootCAs")
 	}
 }
+
+func TestRequestToken(t *testing.T) {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() != "http://example.com/api/tokens" {
+			t.Errorf("unexpected URL: %s", req.URL)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"token":"tok123"}`)),
+		}, nil
+	})
+
+	token, err := RequestToken(client, "http://example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token != "tok123" {
+		t.Errorf("token = %q; want %q", token, "tok123")
+	}
+}
+
+func TestRequestToken_ServerError(t *testing.T) {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusUnauthorized,
+			Body:       io.NopCloser(strings.NewReader("no client certificate provided\n")),
+		}, nil
+	})
+
+	if _, err := RequestToken(client, "http://example.com"); err == nil || !strings.Contains(err.Error(), "server error") {
+		t.Errorf("expected server error, got %v", err)
+	}
+}
+
+// opaqueSigner hides the private key behind crypto.Signer, like a key held
+// in an OS keystore.
+type opaqueSigner struct{ crypto.Signer }
+
+func TestNewSignerClient(t *testing.T) {
+	certPEM, _, _, key := generateCACert(t)
+	_, _, _, otherKey := generateCACert(t)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w, "no client certificate", http.StatusUnauthorized)
+		}
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	serverCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(caPath, serverCA, 0600); err != nil {
+		t.Fatalf("failed to write CA file: %v", err)
+	}
+
+	if _, err := NewSignerClient(certPEM, opaqueSigner{otherKey}, caPath); err == nil {
+		t.Error("NewSignerClient with a mismatched key succeeded; want error")
+	}
+
+	client, err := NewSignerClient(certPEM, opaqueSigner{key}, caPath)
+	if err != nil {
+		t.Fatalf("NewSignerClient returned error: %v", err)
+	}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d; want %d", resp.StatusCode, http.StatusOK)
+	}
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Channel is where the server notifies the user of expiring secrets and
+// certificates and of newly enrolled devices.
+type Channel struct {
+	ID     int64    `json:"id"`
+	Kind   string   `json:"kind"`   // "email", "webhook" or "ntfy"
+	Target string   `json:"target"` // email address, webhook URL or ntfy topic URL
+	Events []string `json:"events"` // kinds of events sent, all if empty
+}
+
+// FetchChannels retrieves the user's notification channels from the
+// server's /api/notifications/channels endpoint.
+func FetchChannels(client *http.Client, baseURL string) ([]Channel, error) {
+	resp, err := client.Get(baseURL + "/api/notifications/channels")
+	if err != nil {
+		return nil, fmt.Errorf("channels request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp)
+	}
+
+	var result struct {
+		Channels []Channel `json:"channels"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return result.Channels, nil
+}
+
+// AddChannel registers a notification channel with the server and returns
+// it with its ID.
+func AddChannel(client *http.Client, baseURL string, c Channel) (*Channel, error) {
+	body, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Post(baseURL+"/api/notifications/channels", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("channel request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return nil, newStatusError(resp)
+	}
+
+	var added Channel
+	if err := json.NewDecoder(resp.Body).Decode(&added); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return &added, nil
+}
+
+// DeleteChannel removes the notification channel with the given ID.
+func DeleteChannel(client *http.Client, baseURL string, id int64) error {
+	req, err := http.NewRequest(http.MethodDelete, baseURL+"/api/notifications/channels/"+strconv.FormatInt(id, 10), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("channel request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return newStatusError(resp)
+	}
+	return nil
+}
+
+// PrintChannels writes one line per channel to w: the ID, kind, target and
+// events.
+func PrintChannels(w io.Writer, channels []Channel) {
+	for _, c := range channels {
+		events := "all events"
+		if len(c.Events) > 0 {
+			events = strings.Join(c.Events, ", ")
+		}
+		fmt.Fprintf(w, "%-4d %-8s %s  (%s)\n", c.ID, c.Kind, c.Target, events)
+	}
+}
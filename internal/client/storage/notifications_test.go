@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestChannels(t *testing.T) {
+	var requests []string
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		var body []byte
+		if req.Body != nil {
+			body, _ = io.ReadAll(req.Body)
+		}
+		requests = append(requests, req.Method+" "+req.URL.Path+" "+string(body))
+		switch req.Method {
+		case http.MethodGet:
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(
+				`{"channels":[{"id":1,"kind":"ntfy","target":"https://ntfy.sh/alice","events":[]},{"id":2,"kind":"email","target":"alice@example.com","events":["new-device"]}]}`,
+			))}, nil
+		case http.MethodPost:
+			return &http.Response{StatusCode: http.StatusCreated, Body: io.NopCloser(strings.NewReader(
+				`{"id":3,"kind":"webhook","target":"https://example.com/hook","events":["secret-expiry"]}`,
+			))}, nil
+		default:
+			return &http.Response{StatusCode: http.StatusNoContent, Body: http.NoBody}, nil
+		}
+	})
+
+	channels, err := FetchChannels(client, "http://example.com")
+	if err != nil || len(channels) != 2 || channels[1].Events[0] != "new-device" {
+		t.Fatalf("FetchChannels = %+v, %v", channels, err)
+	}
+	c, err := AddChannel(client, "http://example.com", Channel{Kind: "webhook", Target: "https://example.com/hook", Events: []string{"secret-expiry"}})
+	if err != nil || c.ID != 3 {
+		t.Fatalf("AddChannel = %+v, %v", c, err)
+	}
+	if err := DeleteChannel(client, "http://example.com", 3); err != nil {
+		t.Fatalf("DeleteChannel: %v", err)
+	}
+
+	want := []string{
+		`GET /api/notifications/channels `,
+		`POST /api/notifications/channels {"id":0,"kind":"webhook","target":"https://example.com/hook","events":["secret-expiry"]}`,
+		`DELETE /api/notifications/channels/3 `,
+	}
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests:\n%s\nwant:\n%s", strings.Join(requests, "\n"), strings.Join(want, "\n"))
+	}
+
+	var buf bytes.Buffer
+	PrintChannels(&buf, channels)
+	if out := buf.String(); !strings.Contains(out, "(all events)") || !strings.Contains(out, "alice@example.com  (new-device)") {
+		t.Errorf("output = %q", out)
+	}
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Names of the client certificate and key files, see Paths.
+const (
+	CertFile = "client.crt"
+	KeyFile  = "client.key"
+)
+
+// Environment variables overriding the directories of DefaultPaths.
+const (
+	ConfigDirEnv = "GOPHKEEPER_CONFIG_DIR"
+	DataDirEnv   = "GOPHKEEPER_DATA_DIR"
+)
+
+// appName names the client directories inside the XDG base directories.
+const appName = "gophkeeper"
+
+// Paths are the directories of the client files: the settings, the
+// credentials, server pins and templates are kept in ConfigDir, the local
+// store and the logs in DataDir. Before these directories were introduced,
+// all files were kept in the working directory, see LegacyPaths.
+type Paths struct {
+	ConfigDir string
+	DataDir   string
+}
+
+// DefaultPaths returns the directories named by ConfigDirEnv and
+// DataDirEnv, defaulting to gophkeeper in the XDG base directories:
+// $XDG_CONFIG_HOME, or ~/.config, and $XDG_DATA_HOME, or ~/.local/share.
+// Relative XDG values are ignored, as the XDG specification requires.
+func DefaultPaths() (Paths, error) {
+	config, err := xdgDir(ConfigDirEnv, "XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return Paths{}, err
+	}
+	data, err := xdgDir(DataDirEnv, "XDG_DATA_HOME", filepath.Join(".local", "share"))
+	if err != nil {
+		return Paths{}, err
+	}
+	return Paths{ConfigDir: config, DataDir: data}, nil
+}
+
+// xdgDir returns the directory named by the environment variable env, or
+// else gophkeeper in the base directory named by xdg, or else in home
+// below the home directory.
+func xdgDir(env, xdg, home string) (string, error) {
+	if dir := os.Getenv(env); dir != "" {
+		return dir, nil
+	}
+	if base := os.Getenv(xdg); filepath.IsAbs(base) {
+		return filepath.Join(base, appName), nil
+	}
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, home, appName), nil
+}
+
+// LegacyPaths keeps all files in the working directory, as clients did
+// before Paths.
+func LegacyPaths() Paths {
+	return Paths{ConfigDir: ".", DataDir: "."}
+}
+
+// Legacy reports whether the working directory holds a client set up
+// before Paths, i.e. a client certificate or a local store, while p holds
+// neither, so that the client keeps using the working directory.
+func (p Paths) Legacy() bool {
+	found := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+	legacy := LegacyPaths()
+	return (found(legacy.Config(CertFile)) || found(legacy.Storage())) &&
+		!found(p.Config(CertFile)) && !found(p.Storage())
+}
+
+// Config returns the path of the file name in p.ConfigDir.
+func (p Paths) Config(name string) string {
+	return filepath.Join(p.ConfigDir, name)
+}
+
+// Data returns the path of the file name in p.DataDir.
+func (p Paths) Data(name string) string {
+	return filepath.Join(p.DataDir, name)
+}
+
+// Storage returns the path of the local store in p.DataDir, see SetPath.
+func (p Paths) Storage() string {
+	return p.Data(storageFile)
+}
+
+// Create creates the directories of p, accessible by the user only, if
+// they do not exist.
+func (p Paths) Create() error {
+	return errors.Join(os.MkdirAll(p.ConfigDir, 0700), os.MkdirAll(p.DataDir, 0700))
+}
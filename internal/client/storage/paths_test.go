@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultPaths(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv(ConfigDirEnv, "")
+	t.Setenv(DataDirEnv, "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_DATA_HOME", "relative/ignored")
+
+	p, err := DefaultPaths()
+	if err != nil {
+		t.Fatalf("DefaultPaths returned error: %v", err)
+	}
+	want := Paths{
+		ConfigDir: filepath.Join(home, ".config", "gophkeeper"),
+		DataDir:   filepath.Join(home, ".local", "share", "gophkeeper"),
+	}
+	if p != want {
+		t.Errorf("DefaultPaths = %+v; want %+v", p, want)
+	}
+
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	t.Setenv(DataDirEnv, "/var/lib/vault")
+	if p, _ = DefaultPaths(); p.ConfigDir != filepath.Join(xdg, "gophkeeper") || p.DataDir != "/var/lib/vault" {
+		t.Errorf("DefaultPaths = %+v; want the XDG config home and %s", p, DataDirEnv)
+	}
+}
+
+func TestPaths_Legacy(t *testing.T) {
+	dir := t.TempDir()
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	os.Chdir(dir)
+
+	p := Paths{ConfigDir: filepath.Join(dir, "config"), DataDir: filepath.Join(dir, "data")}
+	if p.Legacy() {
+		t.Error("Legacy = true without any client files")
+	}
+	if err := os.WriteFile(storageFile, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Legacy() {
+		t.Error("Legacy = false with a local store in the working directory")
+	}
+
+	// Once the directories hold the files, the working directory is ignored
+	if err := p.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(p.DataDir); err != nil || fi.Mode().Perm() != 0700 {
+		t.Errorf("data directory mode %v, %v; want 0700", fi.Mode().Perm(), err)
+	}
+	if err := os.WriteFile(p.Storage(), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if p.Legacy() {
+		t.Error("Legacy = true with a local store in the data directory")
+	}
+}
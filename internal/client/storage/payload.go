@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// ErrInvalidPayload matches the errors of payloads that do not fit the
+// schema of their secret type, see ValidatePayload.
+var ErrInvalidPayload = models.ErrInvalidPayload
+
+// ValidatePayload checks plain, the decrypted payload of a secret of type
+// typ, before it is encrypted, see models.ValidatePayload. Wi-Fi payloads
+// must also be readable by ParseWiFi.
+func ValidatePayload(typ string, plain []byte) error {
+	if typ == string(models.WiFiData) {
+		if _, err := ParseWiFi(plain); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+		}
+		return nil
+	}
+	return models.ValidatePayload(models.SecretType(typ), plain)
+}
@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidatePayload(t *testing.T) {
+	if err := ValidatePayload("wifi", []byte(`{"ssid":"home","password":"pw"}`)); err != nil {
+		t.Errorf("ValidatePayload of a wifi = %v; want nil", err)
+	}
+	if err := ValidatePayload("wifi", []byte(`{"ssid":"home","security":"WPA2"}`)); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("ValidatePayload of a wifi without password = %v; want ErrInvalidPayload", err)
+	}
+	if err := ValidatePayload("login_password", []byte(`{"login":"alice"}`)); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("ValidatePayload of a login without password = %v; want ErrInvalidPayload", err)
+	}
+}
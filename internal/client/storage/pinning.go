@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// pinPrefix starts every SPKI pin.
+const pinPrefix = "sha256/"
+
+// ErrPinMismatch is returned when no certificate of a pinned server matches its pins.
+var ErrPinMismatch = errors.New("server certificate does not match the pinned keys")
+
+// SPKIPin returns the pin of cert: "sha256/" followed by the base64-encoded
+// SHA-256 hash of its subject public key info, as printed by
+// "openssl x509 -pubkey | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64".
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ParsePin validates a pin of the form "sha256/<base64>".
+func ParsePin(s string) (string, error) {
+	b64, ok := strings.CutPrefix(s, pinPrefix)
+	if !ok {
+		return "", fmt.Errorf("invalid pin %q: must start with %q", s, pinPrefix)
+	}
+	if raw, err := base64.StdEncoding.DecodeString(b64); err != nil || len(raw) != sha256.Size {
+		return "", fmt.Errorf("invalid pin %q: want a base64-encoded SHA-256 hash", s)
+	}
+	return s, nil
+}
+
+// PinStore holds the pins of servers by host name and persists them in a
+// JSON file.
+type PinStore struct {
+	mu   sync.Mutex
+	path string
+	pins map[string][]string
+}
+
+// LoadPinStore reads the pins stored at path. A missing file is an empty store.
+func LoadPinStore(path string) (*PinStore, error) {
+	s := &PinStore{path: path, pins: map[string][]string{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.pins); err != nil {
+		return nil, fmt.Errorf("invalid pin file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Pins returns the pins of host.
+func (s *PinStore) Pins(host string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.pins[host])
+}
+
+// Pin adds pins for host without saving them, e.g. pins given on the
+// command line.
+func (s *PinStore) Pin(host string, pins ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range pins {
+		if !slices.Contains(s.pins[host], p) {
+			s.pins[host] = append(s.pins[host], p)
+		}
+	}
+}
+
+// Save writes the pins of host to the store file, keeping other hosts.
+func (s *PinStore) Save(host string) error {
+	stored, err := LoadPinStore(s.path)
+	if err != nil {
+		return err
+	}
+	stored.Pin(host, s.Pins(host)...)
+	data, err := json.MarshalIndent(stored.pins, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+// WithPins checks the certificates of servers with pins in store: the
+// connection fails with ErrPinMismatch unless a certificate of the verified
+// chain matches one of the pins, protecting against a compromised or
+// mis-issued CA. Servers without pins are only verified against the CAs;
+// with trustOnFirstUse their leaf certificate is pinned and saved on the
+// first connection.
+func WithPins(store *PinStore, trustOnFirstUse bool) ClientOption {
+	return func(o *clientOptions) {
+		o.pins = store
+		o.trustOnFirstUse = trustOnFirstUse
+	}
+}
+
+// pinningTransport checks server pins. Every host gets its own transport
+// whose TLS verification knows the host name, which tls.ConnectionState
+// lacks for IP addresses.
+type pinningTransport struct {
+	base  *http.Transport
+	o     clientOptions
+	mu    sync.Mutex
+	hosts map[string]*http.Transport
+}
+
+func (t *pinningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	t.mu.Lock()
+	tr, ok := t.hosts[host]
+	if !ok {
+		tr = t.base.Clone()
+		tr.TLSClientConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			return t.o.verifyPins(host, cs)
+		}
+		t.hosts[host] = tr
+	}
+	t.mu.Unlock()
+	return tr.RoundTrip(req)
+}
+
+// verifyPins checks the certificates presented by host against its pins.
+func (o clientOptions) verifyPins(host string, cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return ErrPinMismatch
+	}
+	pins := o.pins.Pins(host)
+	if len(pins) == 0 {
+		if !o.trustOnFirstUse {
+			return nil
+		}
+		o.pins.Pin(host, SPKIPin(cs.PeerCertificates[0]))
+		if err := o.pins.Save(host); err != nil {
+			return fmt.Errorf("failed to save pin of %s: %w", host, err)
+		}
+		return nil
+	}
+
+	certs := cs.PeerCertificates
+	if len(cs.VerifiedChains) > 0 {
+		certs = cs.VerifiedChains[0]
+	}
+	for _, cert := range certs {
+		if slices.Contains(pins, SPKIPin(cert)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s presented %s", ErrPinMismatch, host, SPKIPin(cs.PeerCertificates[0]))
+}
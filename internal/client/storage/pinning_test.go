@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePin(t *testing.T) {
+	valid := "sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+	if _, err := ParsePin(valid); err != nil {
+		t.Errorf("ParsePin(%q) returned error: %v", valid, err)
+	}
+	for _, s := range []string{"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", "sha256/abc", "sha1/x"} {
+		if _, err := ParsePin(s); err == nil {
+			t.Errorf("ParsePin(%q) succeeded; want error", s)
+		}
+	}
+}
+
+func TestWithPins(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	host := "127.0.0.1"
+	path := filepath.Join(t.TempDir(), "pins.json")
+
+	get := func(store *PinStore, tofu bool) error {
+		c := newClientOptions([]ClientOption{WithPins(store, tofu)}).client(&tls.Config{RootCAs: pool})
+		resp, err := c.Get(ts.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// Unpinned servers are accepted without being pinned.
+	store, _ := LoadPinStore(path)
+	if err := get(store, false); err != nil {
+		t.Fatalf("unpinned request failed: %v", err)
+	}
+	if pins := store.Pins(host); len(pins) != 0 {
+		t.Errorf("pins = %v; want none without trust on first use", pins)
+	}
+
+	// Trust on first use pins and saves the server key.
+	if err := get(store, true); err != nil {
+		t.Fatalf("first use request failed: %v", err)
+	}
+	stored, err := LoadPinStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pins := stored.Pins(host); len(pins) != 1 || pins[0] != SPKIPin(ts.Certificate()) {
+		t.Errorf("stored pins = %v; want the server's pin", pins)
+	}
+	if err := get(stored, false); err != nil {
+		t.Errorf("pinned request failed: %v", err)
+	}
+
+	// A different key is rejected.
+	wrong, _ := LoadPinStore(filepath.Join(t.TempDir(), "other.json"))
+	wrong.Pin(host, "sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=")
+	if err := get(wrong, true); !errors.Is(err, ErrPinMismatch) {
+		t.Errorf("error = %v; want ErrPinMismatch", err)
+	}
+}
@@ -3,52 +3,142 @@ package storage
 import (
 	"bufio"
 	"crypto/cipher"
-	"crypto/rand"
-	"encoding/base64"
+	"errors"
 	"fmt"
-	"log"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/atinyakov/GophKeeper/internal/limits"
 )
 
-func PromptForSecret(aead cipher.AEAD) Secret {
-	scanner := bufio.NewScanner(os.Stdin)
-	fmt.Print("Enter type (login_password/text/binary/card): ")
+var (
+	// stdinScanner is shared by all prompts reading os.Stdin.
+	stdinScanner *bufio.Scanner
+	// stdinFile is the file stdinScanner reads from.
+	stdinFile *os.File
+)
+
+// ErrNameRequired is returned by PromptForSecret if no name is entered.
+var ErrNameRequired = errors.New("secret name is required")
+
+// ErrNotTerminal is returned by MakeRaw if the file is not a terminal or
+// raw mode is not supported on the platform.
+var ErrNotTerminal = errors.New("not a terminal")
+
+// StdinScanner returns a scanner over os.Stdin shared by the shell and all
+// prompts, so input buffered by one reader is not lost to the next (e.g.
+// when commands are piped in). It is recreated when os.Stdin is replaced.
+func StdinScanner() *bufio.Scanner {
+	if stdinScanner == nil || stdinFile != os.Stdin {
+		stdinScanner = bufio.NewScanner(os.Stdin)
+		stdinFile = os.Stdin
+	}
+	return stdinScanner
+}
+
+// PromptForSecret asks for a new secret and returns it encrypted with aead.
+// If templates has a template for the entered type, its fields are asked
+// one by one and stored as a JSON object; otherwise the data is free-form.
+// The name is required and encrypted like the data; the comment is an
+// optional note. Data exceeding the size limit of the type is refused with
+// a *limits.SizeError, data not fitting the schema of the type with an
+// ErrInvalidPayload, see ValidatePayload.
+func PromptForSecret(aead cipher.AEAD, templates Templates) (Secret, error) {
+	scanner := StdinScanner()
+	types := []string{"login_password", "text", "binary", "card", "wifi"}
+	for _, t := range templates.Types() {
+		if !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+	}
+	fmt.Printf("Enter type (%s): ", strings.Join(types, "/"))
 	scanner.Scan()
-	typeStr := scanner.Text()
+	typeStr := strings.TrimSpace(scanner.Text())
 
-	fmt.Print("Enter comment: ")
+	fmt.Print("Enter name: ")
 	scanner.Scan()
-	comment := scanner.Text()
+	name := strings.TrimSpace(scanner.Text())
+	if name == "" {
+		return Secret{}, ErrNameRequired
+	}
 
-	fmt.Print("Enter secret data (will be encrypted): ")
+	fmt.Print("Enter comment (optional): ")
 	scanner.Scan()
-	plain := scanner.Text()
+	comment := scanner.Text()
+
+	var plain string
+	if tmpl, ok := templates[typeStr]; ok {
+		payload, err := PromptFields(scanner, tmpl)
+		if err != nil {
+			return Secret{}, fmt.Errorf("failed to read secret fields: %w", err)
+		}
+		plain = string(payload)
+	} else if typeStr == "text" {
+		fmt.Println(multilineHint)
+		plain = ReadMultiline(scanner)
+	} else {
+		fmt.Print("Enter secret data (will be encrypted): ")
+		scanner.Scan()
+		plain = scanner.Text()
+	}
 
-	// Генерируем крипто-стойкий nonce
-	nonce := make([]byte, aead.NonceSize())
-	if _, err := rand.Read(nonce); err != nil {
-		log.Fatalf("failed to generate nonce: %v", err)
+	if err := limits.CheckContent(typeStr, []byte(plain)); err != nil {
+		return Secret{}, err
 	}
+	if err := ValidatePayload(typeStr, []byte(plain)); err != nil {
+		return Secret{}, err
+	}
+
 	// Шифруем: результат = nonce || ciphertext
-	ciphertext := aead.Seal(nonce, nonce, []byte(plain), nil)
-	encoded := base64.StdEncoding.EncodeToString(ciphertext)
+	encoded, err := Encrypt(aead, []byte(plain))
+	if err != nil {
+		return Secret{}, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+	encName, err := EncryptName(aead, name)
+	if err != nil {
+		return Secret{}, fmt.Errorf("failed to encrypt secret name: %w", err)
+	}
 
 	return Secret{
-		ID:      uuid.NewString(),
+		ID:      NewID(),
 		Type:    typeStr,
 		Data:    encoded,
+		Name:    encName,
 		Comment: comment,
 		Version: time.Now().Unix(),
+	}, nil
+}
+
+// multilineHint explains how to finish multi-line input.
+const multilineHint = "Enter text, finish with a line containing only '.' or Ctrl-D:"
+
+// ReadMultiline reads lines until a line containing only "." or the end of
+// input and returns them joined with newlines. Line breaks are preserved.
+func ReadMultiline(scanner *bufio.Scanner) string {
+	text, _ := readMultiline(scanner)
+	return text
+}
+
+// readMultiline implements ReadMultiline and also reports whether the
+// input ended instead of being terminated by ".".
+func readMultiline(scanner *bufio.Scanner) (text string, eof bool) {
+	var lines []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "." {
+			return strings.Join(lines, "\n"), false
+		}
+		lines = append(lines, line)
 	}
+	return strings.Join(lines, "\n"), true
 }
 
-// PromptEditSecret edit secret from shell
-func PromptEditSecret() (data []byte, comment string) {
-	scanner := bufio.NewScanner(os.Stdin)
+// PromptEditSecret edit secret from shell. With multiline set, manual input
+// is read as multiple lines (see ReadMultiline).
+func PromptEditSecret(multiline bool) (data []byte, comment string) {
+	scanner := StdinScanner()
 	fmt.Print("Enter file path to load (leave empty for manual input): ")
 	scanner.Scan()
 	path := strings.TrimSpace(scanner.Text())
@@ -60,6 +150,9 @@ func PromptEditSecret() (data []byte, comment string) {
 			fmt.Printf("Failed to read file %q: %v\n", path, err)
 			return nil, ""
 		}
+	} else if multiline {
+		fmt.Println(multilineHint)
+		data = []byte(ReadMultiline(scanner))
 	} else {
 		fmt.Print("Enter new data: ")
 		scanner.Scan()
@@ -71,3 +164,19 @@ func PromptEditSecret() (data []byte, comment string) {
 
 	return data, comment
 }
+
+// Confirm asks a yes/no question and reports whether it was answered with
+// "y" or "yes". Any other answer, or the end of input, means no.
+func Confirm(question string) bool {
+	scanner := StdinScanner()
+	fmt.Printf("%s [y/N]: ", question)
+	if !scanner.Scan() {
+		fmt.Println()
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(scanner.Text())) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
@@ -1,12 +1,16 @@
 package storage
 
 import (
+	"bufio"
 	"encoding/base64"
+	"errors"
 	"io"
 	"os"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/limits"
 )
 
 type fakeAEADPromt struct{}
@@ -20,7 +24,7 @@ func (fakeAEADPromt) Open(dst, nonce, ciphertext, _ []byte) ([]byte, error) {
 
 func TestPromptForSecret(t *testing.T) {
 
-	input := "login_password\nmycomment\nsecretdata\n"
+	input := "login_password\nGitHub\nmycomment\nalice\nsecretdata\n\n"
 	oldIn := os.Stdin
 	defer func() { os.Stdin = oldIn }()
 
@@ -32,11 +36,17 @@ func TestPromptForSecret(t *testing.T) {
 	w.Close()
 	os.Stdin = r
 
-	sec := PromptForSecret(fakeAEADPromt{})
+	sec, err := PromptForSecret(fakeAEADPromt{}, BuiltinTemplates())
+	if err != nil {
+		t.Fatalf("PromptForSecret returned error: %v", err)
+	}
 
 	if sec.Type != "login_password" {
 		t.Errorf("Type = %q; want %q", sec.Type, "login_password")
 	}
+	if got := DecryptName(fakeAEADPromt{}, &sec); got != "GitHub" {
+		t.Errorf("name = %q; want %q", got, "GitHub")
+	}
 	if sec.Comment != "mycomment" {
 		t.Errorf("Comment = %q; want %q", sec.Comment, "mycomment")
 	}
@@ -51,8 +61,42 @@ func TestPromptForSecret(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to decode Data: %v", err)
 	}
-	if got := string(decoded); got != "secretdata" {
-		t.Errorf("Data = %q; want %q", got, "secretdata")
+	if got := string(decoded); got != `{"login":"alice","password":"secretdata"}` {
+		t.Errorf("Data = %q; want the login and password", got)
+	}
+}
+
+func TestPromptForSecret_InvalidPayload(t *testing.T) {
+	oldIn := os.Stdin
+	defer func() { os.Stdin = oldIn }()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.WriteString("card\nvisa\n\n4111111111111112\nALICE\n12/30\n123\n")
+	w.Close()
+	os.Stdin = r
+
+	if _, err := PromptForSecret(fakeAEADPromt{}, BuiltinTemplates()); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("PromptForSecret = %v; want ErrInvalidPayload for a number failing the Luhn check", err)
+	}
+}
+
+func TestPromptForSecret_NameRequired(t *testing.T) {
+	oldIn := os.Stdin
+	defer func() { os.Stdin = oldIn }()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.WriteString("text\n  \nnote\nhello\n.\n")
+	w.Close()
+	os.Stdin = r
+
+	if _, err := PromptForSecret(fakeAEADPromt{}, nil); !errors.Is(err, ErrNameRequired) {
+		t.Errorf("PromptForSecret = %v; want ErrNameRequired for a blank name", err)
 	}
 }
 
@@ -87,7 +131,7 @@ func TestPromptEditSecret_FilePath(t *testing.T) {
 	_, wOut, _ := os.Pipe()
 	os.Stdout = wOut
 
-	data, comment := PromptEditSecret()
+	data, comment := PromptEditSecret(false)
 
 	wOut.Close()
 	os.Stdout = oldOut
@@ -114,7 +158,7 @@ func TestPromptEditSecret_Manual(t *testing.T) {
 	w.Close()
 	os.Stdin = r
 
-	data, comment := PromptEditSecret()
+	data, comment := PromptEditSecret(false)
 	if string(data) != "manualdata" {
 		t.Errorf("data = %q; want %q", string(data), "manualdata")
 	}
@@ -143,7 +187,7 @@ func TestPromptEditSecret_FileNotFound(t *testing.T) {
 	rOut, wOut, _ := os.Pipe()
 	os.Stdout = wOut
 
-	data, comment := PromptEditSecret()
+	data, comment := PromptEditSecret(false)
 
 	wOut.Close()
 	os.Stdout = oldOut
@@ -159,3 +203,98 @@ func TestPromptEditSecret_FileNotFound(t *testing.T) {
 		t.Errorf("expected error message in output, got %q", outBuf)
 	}
 }
+
+func TestReadMultiline(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"sentinel", "line one\n\nline three\n.\nnext command\n", "line one\n\nline three"},
+		{"EOF", "first\nsecond", "first\nsecond"},
+		{"empty", ".\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ReadMultiline(bufio.NewScanner(strings.NewReader(tt.input)))
+			if got != tt.want {
+				t.Errorf("ReadMultiline = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromptForSecret_TextNote(t *testing.T) {
+	oldIn := os.Stdin
+	defer func() { os.Stdin = oldIn }()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.WriteString("text\nshopping\n\nmilk\n  eggs\n.\n")
+	w.Close()
+	os.Stdin = r
+
+	sec, err := PromptForSecret(fakeAEADPromt{}, nil)
+	if err != nil {
+		t.Fatalf("PromptForSecret returned error: %v", err)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(sec.Data)
+	if err != nil {
+		t.Fatalf("failed to decode Data: %v", err)
+	}
+	if got := string(decoded); got != "milk\n  eggs" {
+		t.Errorf("Data = %q; want %q", got, "milk\n  eggs")
+	}
+}
+
+func TestPromptForSecret_TooLarge(t *testing.T) {
+	oldIn := os.Stdin
+	defer func() { os.Stdin = oldIn }()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_, _ = w.WriteString("card\nvisa\n\n" + strings.Repeat("4", limits.Credentials+1) + "\n")
+		w.Close()
+	}()
+	os.Stdin = r
+
+	_, err = PromptForSecret(fakeAEADPromt{}, nil)
+	var sizeErr *limits.SizeError
+	if !errors.As(err, &sizeErr) || sizeErr.Type != "card" {
+		t.Errorf("PromptForSecret = %v; want a SizeError for the card", err)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		oldIn := os.Stdin
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.WriteString(tt.input)
+		w.Close()
+		os.Stdin = r
+
+		if got := Confirm("Delete?"); got != tt.want {
+			t.Errorf("Confirm with input %q = %v; want %v", tt.input, got, tt.want)
+		}
+		os.Stdin = oldIn
+	}
+}
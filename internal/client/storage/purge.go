@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// purgeBatch is the most IDs sent in one purge request; the server accepts
+// up to 10000.
+const purgeBatch = 1000
+
+// Purge asks the server to permanently delete the tombstones of the
+// secrets with the given IDs through its /api/purge endpoint, instead of
+// keeping them until the soft-delete cleaner removes them. It returns the
+// IDs the server purged; live secrets and unknown IDs are left out.
+func Purge(client *http.Client, baseURL string, ids []string) ([]string, error) {
+	var purged []string
+	for start := 0; start < len(ids); start += purgeBatch {
+		batch := ids[start:min(start+purgeBatch, len(ids))]
+		body, err := json.Marshal(map[string][]string{"ids": batch})
+		if err != nil {
+			return purged, err
+		}
+		done, err := purge(client, baseURL, body)
+		purged = append(purged, done...)
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// purge sends one purge request.
+func purge(client *http.Client, baseURL string, body []byte) ([]string, error) {
+	resp, err := client.Post(baseURL+"/api/purge", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("purge request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp)
+	}
+
+	var result struct {
+		Purged []string `json:"purged"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return result.Purged, nil
+}
+
+// DeletedIDs returns the IDs of the tombstones in the local store,
+// including those of deleted attachment chunks.
+func (ls *LocalStorage) DeletedIDs() []string {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	var ids []string
+	for _, s := range ls.Secrets {
+		if s.Deleted || ls.deleted[s.ID] {
+			ids = append(ids, s.ID)
+		}
+	}
+	return ids
+}
+
+// DropTombstones removes the tombstones with the given IDs from the local
+// store once they were purged on the servers, so that the deletions are not
+// uploaded again. Live secrets are kept. It returns the number removed.
+func (ls *LocalStorage) DropTombstones(ids []string) int {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	drop := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		drop[id] = true
+	}
+	kept := ls.Secrets[:0]
+	n := 0
+	for _, s := range ls.Secrets {
+		if drop[s.ID] && (s.Deleted || ls.deleted[s.ID]) {
+			delete(ls.deleted, s.ID)
+			n++
+			continue
+		}
+		kept = append(kept, s)
+	}
+	ls.Secrets = kept
+	return n
+}
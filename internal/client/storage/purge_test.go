@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPurge(t *testing.T) {
+	var batches []int
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodPost || req.URL.String() != "http://example.com/api/purge" {
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL)
+		}
+		var body struct {
+			IDs []string `json:"ids"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Fatalf("invalid request body: %v", err)
+		}
+		batches = append(batches, len(body.IDs))
+		// The server purges only the first ID of each batch
+		resp, _ := json.Marshal(map[string][]string{"purged": body.IDs[:1]})
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(string(resp))),
+		}, nil
+	})
+
+	ids := make([]string, purgeBatch+1)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("id%d", i)
+	}
+	purged, err := Purge(client, "http://example.com", ids)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []int{purgeBatch, 1}; !reflect.DeepEqual(batches, want) {
+		t.Errorf("batches = %v; want %v", batches, want)
+	}
+	if want := []string{"id0", ids[purgeBatch]}; !reflect.DeepEqual(purged, want) {
+		t.Errorf("purged = %v; want %v", purged, want)
+	}
+}
+
+func TestPurge_ServerError(t *testing.T) {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Body:       io.NopCloser(strings.NewReader("404 page not found\n")),
+		}, nil
+	})
+
+	if _, err := Purge(client, "http://example.com", []string{"a"}); err == nil || !strings.Contains(err.Error(), "404 page not found") {
+		t.Errorf("expected server error, got %v", err)
+	}
+}
+
+func TestDropTombstones(t *testing.T) {
+	ls := &LocalStorage{
+		Secrets: []Secret{
+			{ID: "live"},
+			{ID: "gone", Deleted: true},
+			{ID: "kept", Deleted: true},
+		},
+		deleted: map[string]bool{"gone": true, "kept": true},
+	}
+
+	if got, want := ls.DeletedIDs(), []string{"gone", "kept"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DeletedIDs = %v; want %v", got, want)
+	}
+	if n := ls.DropTombstones([]string{"gone", "live"}); n != 1 {
+		t.Errorf("DropTombstones removed %d; want 1", n)
+	}
+	var left []string
+	for _, s := range ls.Secrets {
+		left = append(left, s.ID)
+	}
+	if want := []string{"live", "kept"}; !reflect.DeepEqual(left, want) {
+		t.Errorf("secrets = %v; want %v", left, want)
+	}
+	if ls.deleted["gone"] {
+		t.Error("purged secret still marked deleted")
+	}
+}
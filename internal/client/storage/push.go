@@ -0,0 +1,102 @@
+package storage
+
+import "slices"
+
+// Push is a change of the vault a server pushed over a watch stream, see
+// WatchServers.
+type Push struct {
+	// BaseURL is the server that pushed the change.
+	BaseURL string
+	// Secrets are the secrets other devices stored, and the tombstones of
+	// those they deleted.
+	Secrets []Secret
+	// ETag identifies the server's secrets after the change, see
+	// RemoteETag; empty if the server did not send one.
+	ETag string
+	// Opened marks the first push of a stream, without secrets: ETag is
+	// the server's as the stream opened, so that a client in step with it
+	// then knows it misses none of its changes.
+	Opened bool
+	// Resync reports that the server only told that the vault changed,
+	// e.g. over the watch stream of the HTTP API; ls needs a sync.
+	Resync bool
+}
+
+// inStep reports whether the etag the server at baseURL sent with the last
+// sync is etag, i.e. ls holds the server's secrets as they are.
+func (ls *LocalStorage) inStep(baseURL, etag string) bool {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	e := ls.ETags[baseURL]
+	return e != nil && etag != "" && e.ETag == etag
+}
+
+// applyPush applies the change p to ls as a sync with its server would, and
+// saves ls. A secret pushed replaces the local copy unless it was changed
+// locally, or is newer than the one pushed, e.g. from another server; a
+// tombstone removes it. The result reports whether ls is in step with the
+// servers afterwards; if not, e.g. as a secret pushed was also changed
+// locally or other servers lack the change, ls needs a sync.
+//
+// If inStep, no change of the server was missed since ls was last in step
+// with it: ls then takes the etag of p if the local secrets were those the
+// server sent last, so that the next sync uploads nothing, see
+// SyncWithServers.
+func (ls *LocalStorage) applyPush(p Push, inStep bool, servers int) (bool, error) {
+	ls.mu.Lock()
+	pending := ls.conflictIDs()
+	e := ls.ETags[p.BaseURL]
+	same := false
+	if inStep && e != nil && p.ETag != "" && len(ls.stale) == 0 {
+		fp, tombstones := livePrint(uploads(ls.Secrets, nil, pending))
+		same = !tombstones && fp == e.Fingerprint
+	}
+	var filter SyncFilter
+	if ls.SyncFilter != nil {
+		filter = *ls.SyncFilter
+	}
+
+	index := make(map[string]int, len(ls.Secrets))
+	for i, sec := range ls.Secrets {
+		index[sec.ID] = i
+	}
+	clean := true
+	drop := make(map[string]bool)
+	for _, sec := range p.Secrets {
+		i, held := index[sec.ID]
+		if held {
+			if local := ls.Secrets[i]; local.BaseVersion != local.Version && !ls.stale[sec.ID] || local.Version > sec.Version {
+				// The sync sorts out which copy wins
+				clean = false
+				continue
+			}
+		}
+		delete(ls.stale, sec.ID)
+		switch {
+		case sec.Deleted || !filter.Match(sec):
+			if held {
+				drop[sec.ID] = true
+			}
+		case held:
+			sec.BaseVersion = sec.Version
+			ls.Secrets[i] = sec
+		default:
+			sec.BaseVersion = sec.Version
+			index[sec.ID] = len(ls.Secrets)
+			ls.Secrets = append(ls.Secrets, sec)
+		}
+	}
+	if len(drop) > 0 {
+		ls.Secrets = slices.DeleteFunc(ls.Secrets, func(sec Secret) bool { return drop[sec.ID] })
+	}
+	if same && clean {
+		fp, _ := livePrint(uploads(ls.Secrets, nil, pending))
+		ls.ETags[p.BaseURL] = &RemoteETag{ETag: p.ETag, Fingerprint: fp, KDF: e.KDF}
+	}
+	ls.mu.Unlock()
+
+	if err := ls.Save(); err != nil {
+		return false, err
+	}
+	return clean && servers == 1, nil
+}
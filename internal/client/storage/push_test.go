@@ -0,0 +1,77 @@
+package storage
+
+import "testing"
+
+func TestApplyPush(t *testing.T) {
+	const u = "https://a.example"
+	ls := newMemoryDevice(t)
+	ls.Secrets = []Secret{
+		{ID: "kept", Data: "old", Version: 1, BaseVersion: 1},
+		{ID: "gone", Data: "old", Version: 2, BaseVersion: 2},
+		{ID: "mine", Data: "local", Version: 5, BaseVersion: 3},
+	}
+	// The server sent mine at version 3
+	fp, _ := livePrint([]Secret{{ID: "kept", Version: 1}, {ID: "gone", Version: 2}, {ID: "mine", Version: 3}})
+	ls.ETags = map[string]*RemoteETag{u: {ETag: `"v3"`, Fingerprint: fp}}
+
+	// An unchanged copy is replaced, a tombstone removes one and a new
+	// secret is added
+	synced, err := ls.applyPush(Push{BaseURL: u, ETag: `"v6"`, Secrets: []Secret{
+		{ID: "kept", Data: "new", Version: 4},
+		{ID: "gone", Version: 5, Deleted: true},
+		{ID: "added", Data: "added", Version: 6},
+	}}, true, 1)
+	if err != nil || !synced {
+		t.Fatalf("applyPush = %v, %v; want in step", synced, err)
+	}
+	if got := ls.Get("kept"); got == nil || got.Data != "new" || got.BaseVersion != 4 {
+		t.Errorf("kept = %+v, want the pushed copy", got)
+	}
+	if got := ls.Get("gone"); got != nil {
+		t.Errorf("gone = %+v, want it removed", got)
+	}
+	if got := ls.Get("added"); got == nil || got.Data != "added" {
+		t.Errorf("added = %+v, want the pushed copy", got)
+	}
+	// mine was changed locally before, so the etag still does not cover it
+	if e := ls.ETags[u]; e.ETag != `"v3"` {
+		t.Errorf("etag = %q, want it kept while a local change is pending", e.ETag)
+	}
+
+	// A secret changed locally is left to the sync
+	synced, err = ls.applyPush(Push{BaseURL: u, ETag: `"v7"`, Secrets: []Secret{
+		{ID: "mine", Data: "remote", Version: 7},
+	}}, true, 1)
+	if err != nil || synced {
+		t.Fatalf("applyPush = %v, %v; want a sync needed", synced, err)
+	}
+	if got := ls.Get("mine"); got == nil || got.Data != "local" {
+		t.Errorf("mine = %+v, want the local copy", got)
+	}
+}
+
+func TestApplyPush_ETag(t *testing.T) {
+	const u = "https://a.example"
+	ls := newMemoryDevice(t)
+	ls.Secrets = []Secret{{ID: "a", Data: "old", Version: 1, BaseVersion: 1}}
+	fp, _ := livePrint(ls.Secrets)
+	ls.ETags = map[string]*RemoteETag{u: {ETag: `"v1"`, Fingerprint: fp, KDF: true}}
+	push := Push{BaseURL: u, ETag: `"v2"`, Secrets: []Secret{{ID: "a", Data: "new", Version: 2}}}
+
+	// A stream that may have missed changes keeps the etag
+	if _, err := ls.applyPush(push, false, 1); err != nil {
+		t.Fatal(err)
+	}
+	if e := ls.ETags[u]; e.ETag != `"v1"` {
+		t.Errorf("etag = %q out of step, want it kept", e.ETag)
+	}
+
+	ls.Secrets = []Secret{{ID: "a", Data: "old", Version: 1, BaseVersion: 1}}
+	if _, err := ls.applyPush(push, true, 1); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := livePrint(ls.Secrets)
+	if e := ls.ETags[u]; e.ETag != `"v2"` || e.Fingerprint != want || !e.KDF {
+		t.Errorf("etag = %+v, want the pushed one over the new secrets", e)
+	}
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateBurst is how long unused transfer allowance is kept, so that a
+// request after an idle period starts at full speed without an unbounded
+// burst.
+const rateBurst = time.Second
+
+// ParseRate parses a transfer rate in bytes per second such as "500K" or
+// "1M". The suffixes K, M and G multiply by 1024, 1024² and 1024³.
+func ParseRate(s string) (int64, error) {
+	num, mult := strings.TrimSpace(s), int64(1)
+	if n := len(num); n > 0 {
+		switch num[n-1] {
+		case 'k', 'K':
+			mult = 1 << 10
+		case 'm', 'M':
+			mult = 1 << 20
+		case 'g', 'G':
+			mult = 1 << 30
+		}
+		if mult > 1 {
+			num = num[:n-1]
+		}
+	}
+	v, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid rate %q, e.g. 500K or 1M", s)
+	}
+	return v * mult, nil
+}
+
+// rateLimiter spreads transfers over time so that they do not exceed rate
+// bytes per second in total.
+type rateLimiter struct {
+	rate int64
+
+	mu sync.Mutex
+	// at is when the bytes transferred so far are paid off.
+	at time.Time
+}
+
+// newRateLimiter returns a limiter for rate bytes per second.
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{rate: rate}
+}
+
+// wait blocks until n more bytes may be transferred.
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.at.Before(now.Add(-rateBurst)) {
+		l.at = now.Add(-rateBurst)
+	}
+	l.at = l.at.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	d := l.at.Sub(now)
+	l.mu.Unlock()
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// limitedBody is a request or response body read at the rate of limiter.
+type limitedBody struct {
+	io.ReadCloser
+	limiter *rateLimiter
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	// Small reads keep the transfer smooth at low rates
+	if limit := max(b.limiter.rate/10, 512); int64(len(p)) > limit {
+		p = p[:limit]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.limiter.wait(n)
+	return n, err
+}
+
+// rateLimitTransport limits the transfer rate of the request and response
+// bodies of base.
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = &limitedBody{ReadCloser: req.Body, limiter: t.limiter}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, limiter: t.limiter}
+	return resp, nil
+}
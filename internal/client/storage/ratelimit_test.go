@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"2048", 2048},
+		{"500K", 500 << 10},
+		{"1M", 1 << 20},
+		{"2g", 2 << 30},
+	}
+	for _, tt := range tests {
+		if got, err := ParseRate(tt.in); err != nil || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "M", "1.5M", "-1K", "fast"} {
+		if _, err := ParseRate(in); err == nil {
+			t.Errorf("ParseRate(%q) succeeded; want error", in)
+		}
+	}
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	const rate = 64 << 10
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		// Upload the request body, then download as much
+		n, _ := io.Copy(io.Discard, req.Body)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(make([]byte, n)))}, nil
+	})
+	client := &http.Client{Transport: &rateLimitTransport{base: base, limiter: newRateLimiter(rate)}}
+
+	// The first second of transfer is covered by the burst allowance
+	body := strings.NewReader(strings.Repeat("x", rate))
+	start := time.Now()
+	resp, err := client.Post("http://example.com/api/sync", "application/json", body)
+	if err != nil {
+		t.Fatalf("Post returned error: %v", err)
+	}
+	n, _ := io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	elapsed := time.Since(start)
+
+	if n != rate {
+		t.Fatalf("downloaded %d bytes; want %d", n, rate)
+	}
+	// 2 s worth of transfer minus 1 s of burst
+	if elapsed < 900*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("transfer of %d bytes at %d B/s took %s; want about 1s", 2*rate, rate, elapsed)
+	}
+}
@@ -0,0 +1,18 @@
+package storage
+
+// Invalidate marks the local copies of the secrets with the given IDs as
+// stale, e.g. after a secret was restored on a server to an older state
+// that the version comparison of syncs would overwrite. The next sync does
+// not upload them and takes the copies the servers hold instead, even if
+// older, or drops the tombstone of a deleted one; a secret no server holds
+// keeps its local copy. The marks are cleared once every server answered.
+func (ls *LocalStorage) Invalidate(ids ...string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.stale == nil {
+		ls.stale = make(map[string]bool, len(ids))
+	}
+	for _, id := range ids {
+		ls.stale[id] = true
+	}
+}
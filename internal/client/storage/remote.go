@@ -0,0 +1,68 @@
+package storage
+
+import "net/http"
+
+// Remote carries the calls of the client to a server: syncs, registrations
+// and certificate renewals. SyncWithRemote, Register and RenewCertificate
+// target it rather than a protocol, so that a new protocol only adds an
+// implementation, and tests can answer the calls in memory, see
+// MemoryRemote.
+type Remote interface {
+	// Sync uploads call.Secrets to the server at baseURL and returns its
+	// answer, passing the secrets it sends to add once the answer is
+	// complete.
+	Sync(baseURL string, call SyncCall, add func(Secret)) (*SyncResult, error)
+	// Register registers login with the server at baseURL, solving a
+	// proof-of-work challenge first if required, and returns the issued
+	// credentials.
+	Register(baseURL, login string) (IssuedCredentials, error)
+	// Renew asks the server at baseURL for a new certificate and key for
+	// the certificate holder. If csr is not nil, it is a PEM certificate
+	// request of a key the client generated, and only its certificate is
+	// issued.
+	Renew(baseURL string, csr []byte) (IssuedCredentials, error)
+}
+
+// SyncCall is a sync request to one server.
+type SyncCall struct {
+	Secrets     []Secret   // local secrets to upload
+	LastVersion int64      // version of the last sync with the server
+	Filter      SyncFilter // part of the vault to request
+	// KDF are the key derivation parameters of the vault, sent until the
+	// server has them, so that other devices derive the same vault key;
+	// nil to send none.
+	KDF *KDFParams
+	// ETag is the etag of the last sync with the server, sent if nothing
+	// is uploaded; if the vault is unchanged since, the result has
+	// NotModified set and no secrets.
+	ETag string
+}
+
+// NewRemote returns the Remote that calls servers with client over
+// transport t. The client must be built WithTransport(TransportGRPC) for
+// gRPC.
+func NewRemote(client *http.Client, t Transport) Remote {
+	if t == TransportGRPC {
+		return grpcRemote{httpRemote{client}}
+	}
+	return httpRemote{client}
+}
+
+// WithRemote makes Register call servers through r, e.g. a MemoryRemote
+// in tests, instead of a client built from the options.
+func WithRemote(r Remote) ClientOption {
+	return func(o *clientOptions) {
+		o.remote = r
+	}
+}
+
+// httpRemote calls the HTTP API with JSON requests.
+type httpRemote struct {
+	client *http.Client
+}
+
+// grpcRemote calls the gRPC API. Renewals, which it lacks, go to the HTTP
+// API served on the same port.
+type grpcRemote struct {
+	httpRemote
+}
@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewRemote(t *testing.T) {
+	client := &http.Client{}
+	if _, ok := NewRemote(client, TransportHTTP).(httpRemote); !ok {
+		t.Error("NewRemote(TransportHTTP) is not the HTTP remote")
+	}
+	if _, ok := NewRemote(client, TransportGRPC).(grpcRemote); !ok {
+		t.Error("NewRemote(TransportGRPC) is not the gRPC remote")
+	}
+}
+
+// newMemoryDevice returns the storage of a device syncing with remote,
+// saved in a directory of its own.
+func newMemoryDevice(t *testing.T) *LocalStorage {
+	t.Helper()
+	ls := &LocalStorage{}
+	ls.SetPath(filepath.Join(t.TempDir(), "storage.json"))
+	return ls
+}
+
+func TestSyncWithRemote_Memory(t *testing.T) {
+	remote := &MemoryRemote{}
+	urls := []string{"https://a.example"}
+	laptop, phone := newMemoryDevice(t), newMemoryDevice(t)
+
+	// The laptop adds two secrets, the phone receives them
+	laptop.Secrets = []Secret{{ID: "s1", Data: "one", Version: 1}, {ID: "s2", Data: "two", Version: 2}}
+	if err := SyncWithRemote(remote, urls, laptop); err != nil {
+		t.Fatalf("laptop sync: %v", err)
+	}
+	if err := SyncWithRemote(remote, urls, phone); err != nil {
+		t.Fatalf("phone sync: %v", err)
+	}
+	if got := phone.Get("s2"); got == nil || got.Data != "two" || phone.Version != 2 {
+		t.Fatalf("phone s2 = %+v at version %d; want the laptop's", got, phone.Version)
+	}
+
+	// The phone deletes s1 and edits s2, the laptop follows
+	phone.Secrets[0] = Secret{ID: "s1", Version: 3, Deleted: true}
+	phone.Secrets[1].Data, phone.Secrets[1].Version = "edited", 4
+	if err := SyncWithRemote(remote, urls, phone); err != nil {
+		t.Fatalf("phone sync: %v", err)
+	}
+	if err := SyncWithRemote(remote, urls, laptop); err != nil {
+		t.Fatalf("laptop sync: %v", err)
+	}
+	if got := laptop.Get("s1"); got != nil && !got.Deleted {
+		t.Errorf("laptop s1 = %+v; want it deleted", got)
+	}
+	if got := laptop.Get("s2"); got == nil || got.Data != "edited" {
+		t.Errorf("laptop s2 = %+v; want the phone's edit", got)
+	}
+	if stored := remote.Secrets(); len(stored) != 2 || !stored[0].Deleted || stored[0].Data != "" {
+		t.Errorf("remote holds %+v; want the tombstone of s1 and s2", stored)
+	}
+
+	// Failing remotes change nothing
+	remote.Err = errors.New("down")
+	laptop.Secrets = append(laptop.Secrets, Secret{ID: "s3", Version: 5})
+	if err := SyncWithRemote(remote, urls, laptop); !errors.Is(err, remote.Err) {
+		t.Errorf("err = %v; want the remote's", err)
+	}
+	if laptop.Get("s3") == nil {
+		t.Error("failed sync dropped the local secret")
+	}
+}
+
+// TestSyncWithRemote_StaleCopies checks that uploading copies older than
+// the server's that were not changed locally reports no conflicts, while
+// edits of them do.
+func TestSyncWithRemote_StaleCopies(t *testing.T) {
+	remote := &conflictRecorder{MemoryRemote: &MemoryRemote{}}
+	urls := []string{"https://a.example"}
+	laptop, phone := newMemoryDevice(t), newMemoryDevice(t)
+
+	laptop.Secrets = []Secret{{ID: "s1", Data: "one", Version: 1}, {ID: "s2", Data: "two", Version: 2}}
+	for _, ls := range []*LocalStorage{laptop, phone} {
+		if err := SyncWithRemote(remote, urls, ls); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+	}
+	if got := phone.Get("s2"); got == nil || got.BaseVersion != 2 {
+		t.Fatalf("phone s2 = %+v; want base version 2", got)
+	}
+
+	// The phone edits s2; the laptop's unchanged copy is replaced quietly
+	phone.Secrets[1].Data, phone.Secrets[1].Version = "edited", 4
+	if err := SyncWithRemote(remote, urls, phone); err != nil {
+		t.Fatalf("phone sync: %v", err)
+	}
+	if err := SyncWithRemote(remote, urls, laptop); err != nil {
+		t.Fatalf("laptop sync: %v", err)
+	}
+	if len(remote.conflicts) != 0 {
+		t.Errorf("conflicts = %+v; want none for the laptop's unchanged copy", remote.conflicts)
+	}
+	if got := laptop.Get("s2"); got == nil || got.Data != "edited" || got.BaseVersion != 4 {
+		t.Errorf("laptop s2 = %+v; want the phone's edit", got)
+	}
+
+	// Both edit s1; the laptop, syncing last, is in conflict
+	phone.Secrets[0].Data, phone.Secrets[0].Version = "phone", 6
+	laptop.Secrets[0].Data, laptop.Secrets[0].Version = "laptop", 5
+	if err := SyncWithRemote(remote, urls, phone); err != nil {
+		t.Fatalf("phone sync: %v", err)
+	}
+	if err := SyncWithRemote(remote, urls, laptop); err != nil {
+		t.Fatalf("laptop sync: %v", err)
+	}
+	if c := remote.conflicts; len(c) != 1 || c[0].ID != "s1" || c[0].ServerVersion != 6 {
+		t.Errorf("conflicts = %+v; want the laptop's s1 against version 6", c)
+	}
+}
+
+// conflictRecorder records the conflicts the remote reports.
+type conflictRecorder struct {
+	*MemoryRemote
+	conflicts []SyncConflict
+}
+
+func (r *conflictRecorder) Sync(baseURL string, call SyncCall, add func(Secret)) (*SyncResult, error) {
+	res, err := r.MemoryRemote.Sync(baseURL, call, add)
+	if res != nil {
+		r.conflicts = append(r.conflicts, res.Conflicts...)
+	}
+	return res, err
+}
+
+// kdfRecorder records the key derivation parameters sent with each sync.
+type kdfRecorder struct {
+	*MemoryRemote
+	sent []*KDFParams
+}
+
+func (r *kdfRecorder) Sync(baseURL string, call SyncCall, add func(Secret)) (*SyncResult, error) {
+	r.sent = append(r.sent, call.KDF)
+	return r.MemoryRemote.Sync(baseURL, call, add)
+}
+
+func TestSyncWithRemote_KDF(t *testing.T) {
+	remote := &kdfRecorder{MemoryRemote: &MemoryRemote{}}
+	urls := []string{"https://a.example"}
+	laptop := newMemoryDevice(t)
+	aead, _, err := laptop.SetMasterPassword([]byte("correct horse"), nil)
+	if err != nil {
+		t.Fatalf("SetMasterPassword returned error: %v", err)
+	}
+	data, _ := Encrypt(aead, []byte("hunter2"))
+	laptop.Secrets = []Secret{{ID: "s1", Data: data, Version: 1}}
+	for range 2 {
+		if err := SyncWithRemote(remote, urls, laptop); err != nil {
+			t.Fatalf("laptop sync: %v", err)
+		}
+	}
+	if len(remote.sent) != 2 || remote.sent[0] == nil || remote.sent[1] != nil {
+		t.Errorf("laptop sent parameters %v; want them with the first sync only", remote.sent)
+	}
+
+	// A new device takes the laptop's parameters, so that the same master
+	// password opens the secrets it receives
+	phone := newMemoryDevice(t)
+	if err := SyncWithRemote(remote, urls, phone); err != nil {
+		t.Fatalf("phone sync: %v", err)
+	}
+	reopened := &LocalStorage{}
+	reopened.SetPath(phone.path)
+	if err := reopened.Load(); err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if _, err := reopened.Unlock([]byte("wrong")); !errors.Is(err, ErrIncorrectMasterPassword) {
+		t.Errorf("Unlock(wrong) = %v; want ErrIncorrectMasterPassword", err)
+	}
+	phoneAEAD, err := reopened.Unlock([]byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Unlock returned error: %v", err)
+	}
+	if plain, err := Decrypt(phoneAEAD, reopened.Get("s1").Data); err != nil || string(plain) != "hunter2" {
+		t.Errorf("phone decrypts s1 to %q, %v; want the laptop's secret", plain, err)
+	}
+
+	// Parameters of a vault started apart do not replace the server's
+	other := newMemoryDevice(t)
+	if _, _, err := other.SetMasterPassword([]byte("correct horse"), nil); err != nil {
+		t.Fatalf("SetMasterPassword returned error: %v", err)
+	}
+	own := other.KDF
+	if err := SyncWithRemote(remote, urls, other); err != nil {
+		t.Fatalf("other sync: %v", err)
+	}
+	if other.KDF != own || !bytes.Equal(remote.kdf.Salt, laptop.KDF.Salt) {
+		t.Error("parameters of a second vault replaced those of the first")
+	}
+}
+
+func TestMemoryRemote_RegisterRenew(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	remote := &MemoryRemote{}
+
+	// No CA file is needed, as no client is built
+	codes, err := Register("https://a.example"+registerPath, "alice", "", WithRemote(remote), WithCredentialFiles(certFile, keyFile))
+	if err != nil {
+		t.Fatalf("Register returned error: %v", err)
+	}
+	if len(codes) != 1 {
+		t.Errorf("recovery codes = %v; want one", codes)
+	}
+	if _, err := Register("https://a.example", "bob", "", WithRemote(remote), WithCredentialFiles(certFile, keyFile)); !errors.Is(err, ErrConflict) {
+		t.Errorf("second Register = %v; want ErrConflict", err)
+	}
+
+	old, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := RenewCertificate(remote, "https://a.example", certFile, keyFile, nil)
+	if err != nil {
+		t.Fatalf("RenewCertificate returned error: %v", err)
+	}
+	if cert.Subject.CommonName != "alice" {
+		t.Errorf("renewed certificate for %q; want alice", cert.Subject.CommonName)
+	}
+	if renewed, _ := os.ReadFile(certFile); string(renewed) == string(old) {
+		t.Error("certificate file not replaced")
+	}
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// SecretLookup returns the value of field of the secret ref, an ID, ID
+// prefix or alias, for RenderTemplate.
+type SecretLookup func(ref, field string) (string, error)
+
+// RenderTemplate executes the text/template text, e.g. a config file with
+// credentials left out, and returns the result. Templates reference
+// secrets with the secret function:
+//
+//	password = {{ secret "prod-db" "password" }}
+//	token = {{ secret "3f2a9c" }}
+//
+// The field is a path as taken by ExtractField and defaults to "data",
+// the whole payload of unstructured secrets. Rendering fails if a secret
+// or field does not exist, so no config is written with gaps.
+func RenderTemplate(name, text string, lookup SecretLookup) ([]byte, error) {
+	tmpl, err := template.New(name).Funcs(template.FuncMap{
+		"secret": func(ref string, field ...string) (string, error) {
+			if len(field) > 1 {
+				return "", fmt.Errorf("secret %s: want at most one field, got %d", ref, len(field))
+			}
+			path := "data"
+			if len(field) == 1 {
+				path = field[0]
+			}
+			return lookup(ref, path)
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WritePrivateFile replaces the file at path with data, readable by the
+// user only. The data is written to a temporary file in the same directory
+// first, so the file never holds partial data or wider permissions.
+func WritePrivateFile(path string, data []byte) error {
+	// CreateTemp creates the file with mode 0600
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	secrets := map[string]string{
+		"prod-db/password": "s3cret",
+		"prod-db/user":     "app",
+		"3f2a/data":        "token",
+	}
+	lookup := func(ref, field string) (string, error) {
+		v, ok := secrets[ref+"/"+field]
+		if !ok {
+			return "", ErrFieldNotFound
+		}
+		return v, nil
+	}
+
+	got, err := RenderTemplate("app.tmpl", `dsn = postgres://{{ secret "prod-db" "user" }}:{{ secret "prod-db" "password" }}@db
+token = {{ secret "3f2a" }}
+`, lookup)
+	want := "dsn = postgres://app:s3cret@db\ntoken = token\n"
+	if err != nil || string(got) != want {
+		t.Errorf("RenderTemplate = %q, %v; want %q", got, err, want)
+	}
+
+	for _, text := range []string{
+		`{{ secret "prod-db" "missing" }}`,
+		`{{ secret "prod-db" "user" "password" }}`,
+		`{{ secret }}`,
+		`{{ unclosed `,
+	} {
+		if _, err := RenderTemplate("bad.tmpl", text, lookup); err == nil {
+			t.Errorf("RenderTemplate(%s): want error", text)
+		}
+	}
+	if _, err := RenderTemplate("bad.tmpl", `{{ secret "prod-db" "missing" }}`, lookup); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("missing field: %v; want ErrFieldNotFound", err)
+	}
+}
+
+func TestWritePrivateFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.conf")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WritePrivateFile(path, []byte("new")); err != nil {
+		t.Fatalf("WritePrivateFile: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new" {
+		t.Errorf("file holds %q, %v; want new", data, err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("file mode %v, %v; want 0600", fi.Mode().Perm(), err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("directory holds %d files; want the temporary file removed", len(entries))
+	}
+}
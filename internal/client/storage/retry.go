@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/jsonstream"
+)
+
+// RetryPolicy controls how failed server requests are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts; values below 1 mean 1.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles with
+	// every further retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts.
+	MaxDelay time.Duration
+
+	// sleep waits between attempts; tests replace it.
+	sleep func(time.Duration)
+}
+
+// DefaultRetryPolicy is the retry policy used by the client by default.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// Backoff returns the delay after the given number of failed attempts:
+// BaseDelay doubled for each earlier failure, capped at MaxDelay, with
+// random jitter of up to half the delay so that clients do not retry in
+// lockstep.
+func (p RetryPolicy) Backoff(failures int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < failures && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, p.MaxDelay)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// Do calls fn until it succeeds, fails with an error that is not
+// transient (see IsTransient) or MaxAttempts is reached, and returns the
+// last error.
+func (p RetryPolicy) Do(fn func() error) error {
+	sleep := p.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || !IsTransient(err) || attempt >= p.MaxAttempts {
+			return err
+		}
+		sleep(p.Backoff(attempt))
+	}
+}
+
+// IsTransient reports whether err is likely to go away when the request is
+// retried: network failures, server errors (5xx or 429 Too Many Requests)
+// and bodies corrupted on the way, as told by their checksums in either
+// direction. Certificate errors and other client errors are permanent.
+func IsTransient(err error) bool {
+	var (
+		statusErr   *StatusError
+		alertErr    tls.AlertError
+		unknownCA   x509.UnknownAuthorityError
+		invalidCert x509.CertificateInvalidError
+		hostErr     x509.HostnameError
+		urlErr      *url.Error
+	)
+	switch {
+	case errors.Is(err, ErrPinMismatch):
+		return false
+	case errors.Is(err, jsonstream.ErrChecksumMismatch):
+		return true
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode >= http.StatusInternalServerError ||
+			statusErr.StatusCode == http.StatusTooManyRequests ||
+			statusErr.Code == jsonstream.ChecksumMismatchCode
+	case errors.As(err, &alertErr), errors.As(err, &unknownCA),
+		errors.As(err, &invalidCert), errors.As(err, &hostErr):
+		return false
+	case errors.As(err, &urlErr):
+		return true
+	}
+	return false
+}
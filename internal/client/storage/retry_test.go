@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/jsonstream"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	tests := []struct {
+		failures int
+		max      time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{10, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		for range 20 {
+			got := p.Backoff(tt.failures)
+			if got < tt.max/2 || got > tt.max {
+				t.Fatalf("Backoff(%d) = %s; want between %s and %s", tt.failures, got, tt.max/2, tt.max)
+			}
+		}
+	}
+}
+
+func TestRetryPolicy_Do(t *testing.T) {
+	netErr := &url.Error{Op: "Post", URL: "https://example.com", Err: errors.New("connection refused")}
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"success", []error{nil}, 1, false},
+		{"recovers", []error{netErr, &StatusError{StatusCode: http.StatusBadGateway}, nil}, 3, false},
+		{"gives up", []error{netErr, netErr, netErr, nil}, 3, true},
+		{"permanent", []error{&StatusError{StatusCode: http.StatusBadRequest}, nil}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var slept []time.Duration
+			p := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second,
+				sleep: func(d time.Duration) { slept = append(slept, d) }}
+
+			calls := 0
+			err := p.Do(func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+			if calls != tt.wantCalls || (err != nil) != tt.wantErr {
+				t.Errorf("calls = %d, err = %v; want %d calls, error %v", calls, err, tt.wantCalls, tt.wantErr)
+			}
+			if len(slept) != calls-1 {
+				t.Errorf("slept %d times; want %d", len(slept), calls-1)
+			}
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&url.Error{Op: "Post", URL: "https://x", Err: errors.New("timeout")}, true},
+		{fmt.Errorf("sync failed: %w", &url.Error{Op: "Post", URL: "https://x", Err: errors.New("reset")}), true},
+		{&StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{&StatusError{StatusCode: http.StatusUnauthorized}, false},
+		{&StatusError{StatusCode: http.StatusBadRequest, Code: jsonstream.ChecksumMismatchCode}, true},
+		{fmt.Errorf("invalid response: %w", jsonstream.ErrChecksumMismatch), true},
+		{errors.New("invalid response"), false},
+	}
+	for _, tt := range tests {
+		if got := IsTransient(tt.err); got != tt.want {
+			t.Errorf("IsTransient(%v) = %v; want %v", tt.err, got, tt.want)
+		}
+	}
+}
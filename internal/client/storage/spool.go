@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+)
+
+// spool stages the secrets of a sync response in a temporary file until the
+// response proved complete, so that memory does not grow with the vault.
+// Each secret is stored as it was received, in one frame like a gRPC
+// message, see writeFrame. The file is only created with the first frame,
+// is readable by the user only and removed by close. The zero value is
+// ready to use.
+type spool struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+// write appends the frame b.
+func (s *spool) write(b []byte) error {
+	if s.f == nil {
+		f, err := os.CreateTemp("", "gophkeeper-sync-*")
+		if err != nil {
+			return err
+		}
+		s.f, s.w = f, bufio.NewWriter(f)
+	}
+	return writeFrame(s.w, b)
+}
+
+// each calls fn with every frame written, in order, stopping at the first
+// error of fn.
+func (s *spool) each(fn func([]byte) error) error {
+	if s.f == nil {
+		return nil
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(s.f)
+	for {
+		b, err := readMessage(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+}
+
+// close removes the file.
+func (s *spool) close() {
+	if s.f != nil {
+		_ = s.f.Close()
+		_ = os.Remove(s.f.Name())
+	}
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestSpool(t *testing.T) {
+	var s spool
+	if err := s.each(func([]byte) error { return errors.New("called") }); err != nil {
+		t.Fatalf("each of an empty spool: %v", err)
+	}
+	if s.f != nil {
+		t.Fatal("empty spool created a file")
+	}
+
+	frames := []string{`{"id":"a"}`, "", `{"id":"b"}`}
+	for _, f := range frames {
+		if err := s.write([]byte(f)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	name := s.f.Name()
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if perm := fi.Mode().Perm(); perm&0o077 != 0 && os.PathSeparator == '/' {
+		t.Errorf("spool file mode = %v, want private", perm)
+	}
+
+	var got []string
+	if err := s.each(func(b []byte) error {
+		got = append(got, string(b))
+		return nil
+	}); err != nil {
+		t.Fatalf("each: %v", err)
+	}
+	if len(got) != len(frames) {
+		t.Fatalf("each returned %q, want %q", got, frames)
+	}
+	for i := range frames {
+		if got[i] != frames[i] {
+			t.Errorf("frame %d = %q, want %q", i, got[i], frames[i])
+		}
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	if err := s.each(func([]byte) error { n++; return stop }); !errors.Is(err, stop) || n != 1 {
+		t.Errorf("each = %v after %d frames, want stop after 1", err, n)
+	}
+
+	s.close()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("spool file left after close: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"cmp"
+	"crypto"
+	"crypto/cipher"
+	"encoding/json"
+	"fmt"
+
+	"github.com/atinyakov/GophKeeper/internal/sshagent"
+)
+
+// SSHKeyType is the type of secrets holding SSH keys, see the ssh-key
+// template.
+const SSHKeyType = "ssh-key"
+
+// SSHKeys decrypts the live ssh-key secrets and parses their private keys
+// for the SSH agent, with the name of each secret (or its ID) as the key
+// comment. ids holds the secret ID of each key. Keys that cannot be
+// decrypted or parsed are skipped and reported in errs.
+func (ls *LocalStorage) SSHKeys(aead cipher.AEAD) (keys []sshagent.Key, ids []string, errs []error) {
+	ls.mu.Lock()
+	var secrets []Secret
+	for _, s := range ls.Secrets {
+		if s.Type == SSHKeyType && !s.Deleted && !ls.deleted[s.ID] {
+			secrets = append(secrets, s)
+		}
+	}
+	ls.mu.Unlock()
+
+	for _, s := range secrets {
+		signer, err := parseSSHKey(aead, s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("secret %s: %w", s.ID, err))
+			continue
+		}
+		keys = append(keys, sshagent.Key{Signer: signer, Comment: cmp.Or(DecryptName(aead, &s), s.ID)})
+		ids = append(ids, s.ID)
+	}
+	return keys, ids, errs
+}
+
+// parseSSHKey decrypts an ssh-key secret and parses its private key,
+// decrypting it with the passphrase field if set.
+func parseSSHKey(aead cipher.AEAD, s Secret) (crypto.Signer, error) {
+	plain, err := Decrypt(aead, s.Data)
+	if err != nil {
+		return nil, err
+	}
+	var payload struct {
+		PrivateKey string `json:"private_key"`
+		Passphrase string `json:"passphrase"`
+	}
+	if err := json.Unmarshal(plain, &payload); err != nil || payload.PrivateKey == "" {
+		return nil, fmt.Errorf("%w: private_key", ErrFieldNotFound)
+	}
+	return sshagent.ParsePrivateKey([]byte(payload.PrivateKey), []byte(payload.Passphrase))
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/fingerprint"
+)
+
+// StaleDeviceAge is how long a device may go without syncing before the
+// shell warns about it.
+const StaleDeviceAge = 30 * 24 * time.Hour
+
+// Device describes a client that has synced with the server.
+type Device struct {
+	ID       string `json:"id"`
+	LastSync int64  `json:"last_sync"` // Unix time of the last successful sync
+	LastSeen int64  `json:"last_seen"` // Unix time of the last request
+}
+
+// Stats summarizes the user's vault as stored on the server.
+type Stats struct {
+	Counts     map[string]int64 `json:"counts"`      // live secrets per type
+	TotalBytes int64            `json:"total_bytes"` // size of encrypted payloads
+	LastSync   int64            `json:"last_sync"`   // Unix time of the latest sync
+	LastSeen   int64            `json:"last_seen"`   // Unix time of the latest request
+	Devices    []Device         `json:"devices"`
+	// Fingerprint hashes the live secrets, see package fingerprint;
+	// empty if the server does not report it.
+	Fingerprint string `json:"fingerprint"`
+}
+
+// VaultSummary is the composition of the vault the server sends with every
+// sync, so that it can be shown without decrypting the secrets or asking
+// the server again.
+type VaultSummary struct {
+	Types      map[string]int64 `json:"types"`       // live secrets per type
+	Folders    map[string]int64 `json:"folders"`     // live secrets per folder
+	Tags       map[string]int64 `json:"tags"`        // live secrets per tag
+	TotalBytes int64            `json:"total_bytes"` // size of encrypted payloads
+	// Time is the Unix time of the sync that reported the summary; set
+	// by the client.
+	Time int64 `json:"time,omitempty"`
+}
+
+// VaultSummary returns the composition of the vault reported by the last
+// sync that changed it, or nil if no server reported one yet.
+func (ls *LocalStorage) VaultSummary() *VaultSummary {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.Summary == nil {
+		return nil
+	}
+	summary := *ls.Summary
+	return &summary
+}
+
+// FetchStats retrieves vault statistics from the server's /api/stats endpoint.
+func FetchStats(client *http.Client, baseURL string) (*Stats, error) {
+	resp, err := client.Get(baseURL + "/api/stats")
+	if err != nil {
+		return nil, fmt.Errorf("stats request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp)
+	}
+
+	var stats Stats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return &stats, nil
+}
+
+// PrintStats writes a human-readable rendering of stats to w.
+func PrintStats(w io.Writer, stats *Stats) {
+	printCounts(w, "Secrets by type:", stats.Counts)
+	fmt.Fprintf(w, "Total encrypted bytes: %d\n", stats.TotalBytes)
+	fmt.Fprintf(w, "Last sync: %s\n", formatUnix(stats.LastSync))
+	fmt.Fprintf(w, "Last seen: %s\n", formatUnix(stats.LastSeen))
+	if stats.Fingerprint != "" {
+		fmt.Fprintf(w, "Fingerprint: %s\n", fingerprint.Short(stats.Fingerprint))
+	}
+	fmt.Fprintln(w, "Devices:")
+	for _, d := range stats.Devices {
+		fmt.Fprintf(w, "  %-34s last sync %-19s  last seen %s\n", d.ID, formatUnix(d.LastSync), formatUnix(d.LastSeen))
+	}
+}
+
+// PrintSummary writes summary to w: the secrets per type, folder and tag,
+// their total size and the time of the sync that reported them.
+func PrintSummary(w io.Writer, summary *VaultSummary) {
+	printCounts(w, "Secrets by type:", summary.Types)
+	PrintGroups(w, summary)
+	fmt.Fprintf(w, "Total encrypted bytes: %d\n", summary.TotalBytes)
+	fmt.Fprintf(w, "As of the sync at: %s\n", formatUnix(summary.Time))
+}
+
+// PrintGroups writes the secrets per folder and tag of summary to w, which
+// Stats lacks.
+func PrintGroups(w io.Writer, summary *VaultSummary) {
+	if len(summary.Folders) > 0 {
+		printCounts(w, "Secrets by folder:", summary.Folders)
+	}
+	if len(summary.Tags) > 0 {
+		printCounts(w, "Secrets by tag:", summary.Tags)
+	}
+}
+
+// printCounts writes title and counts to w, sorted by key.
+func printCounts(w io.Writer, title string, counts map[string]int64) {
+	fmt.Fprintln(w, title)
+	for _, k := range slices.Sorted(maps.Keys(counts)) {
+		fmt.Fprintf(w, "  %-16s %d\n", k, counts[k])
+	}
+}
+
+// StaleDevices returns the devices that synced before but not within age
+// of now, e.g. lost or forgotten devices holding an outdated copy of the
+// vault. Devices that never synced are left out.
+func StaleDevices(stats *Stats, now time.Time, age time.Duration) []Device {
+	cutoff := now.Add(-age).Unix()
+	var stale []Device
+	for _, d := range stats.Devices {
+		if d.LastSync != 0 && d.LastSync < cutoff {
+			stale = append(stale, d)
+		}
+	}
+	return stale
+}
+
+// formatUnix renders a Unix timestamp in local time, or "never" for zero.
+func formatUnix(ts int64) string {
+	if ts == 0 {
+		return "never"
+	}
+	return time.Unix(ts, 0).Format(time.DateTime)
+}
+
+// Fingerprint returns the fingerprint of the live local secrets, see
+// package fingerprint, and their number. Once a sync has converged, it
+// equals the fingerprint reported by the server; devices that sync the
+// whole vault can also compare it with each other.
+func (ls *LocalStorage) Fingerprint() (string, int) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	live := make(map[string]int64, len(ls.Secrets))
+	for _, sec := range ls.Secrets {
+		if !sec.Deleted {
+			live[sec.ID] = sec.Version
+		}
+	}
+	return fingerprint.Versions(live), len(live)
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/fingerprint"
+)
+
+func TestFetchStats(t *testing.T) {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodGet || req.URL.String() != "http://example.com/api/stats" {
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL)
+		}
+		body := `{"counts":{"text":2,"card":1},"total_bytes":140,"last_sync":0,"devices":[{"id":"ff","last_sync":0,"last_seen":0}],"fingerprint":"3f9a07c2e41b5d60aa"}`
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+
+	stats, err := FetchStats(client, "http://example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Counts["text"] != 2 || stats.TotalBytes != 140 || len(stats.Devices) != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	var buf bytes.Buffer
+	PrintStats(&buf, stats)
+	out := buf.String()
+	for _, want := range []string{"card", "text", "Total encrypted bytes: 140", "Last sync: never", "Last seen: never", "ff", "Fingerprint: 3f9a 07c2 e41b 5d60"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q: %q", want, out)
+		}
+	}
+	if strings.Index(out, "card") > strings.Index(out, "text") {
+		t.Errorf("types not sorted: %q", out)
+	}
+}
+
+func TestPrintSummary(t *testing.T) {
+	summary := &VaultSummary{
+		Types:      map[string]int64{"text": 2, "card": 1},
+		Folders:    map[string]int64{"work/db": 2},
+		Tags:       map[string]int64{"prod": 1},
+		TotalBytes: 140,
+	}
+	var buf bytes.Buffer
+	PrintSummary(&buf, summary)
+	out := buf.String()
+	for _, want := range []string{"Secrets by type:", "Secrets by folder:", "work/db", "Secrets by tag:", "prod", "Total encrypted bytes: 140", "As of the sync at: never"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q: %q", want, out)
+		}
+	}
+
+	// Empty groups are left out
+	buf.Reset()
+	PrintGroups(&buf, &VaultSummary{Folders: map[string]int64{"work": 1}})
+	if out := buf.String(); !strings.Contains(out, "work") || strings.Contains(out, "Secrets by tag:") {
+		t.Errorf("PrintGroups = %q; want only the folders", out)
+	}
+}
+
+func TestStaleDevices(t *testing.T) {
+	now := time.Unix(100*86400, 0)
+	stats := &Stats{Devices: []Device{
+		{ID: "recent", LastSync: now.Add(-time.Hour).Unix()},
+		{ID: "old", LastSync: now.Add(-40 * 24 * time.Hour).Unix()},
+		{ID: "never", LastSeen: now.Add(-40 * 24 * time.Hour).Unix()},
+	}}
+
+	stale := StaleDevices(stats, now, StaleDeviceAge)
+	if len(stale) != 1 || stale[0].ID != "old" {
+		t.Errorf("StaleDevices = %+v; want only the old device", stale)
+	}
+}
+
+func TestLocalStorage_Fingerprint(t *testing.T) {
+	ls := &LocalStorage{Secrets: []Secret{
+		{ID: "b", Version: 2},
+		{ID: "a", Version: 1},
+		{ID: "c", Version: 5, Deleted: true},
+	}}
+
+	fp, n := ls.Fingerprint()
+	if n != 2 {
+		t.Errorf("Fingerprint counted %d secrets; want 2", n)
+	}
+	if want := fingerprint.Versions(map[string]int64{"a": 1, "b": 2}); fp != want {
+		t.Errorf("Fingerprint = %s; want %s, without the tombstone", fp, want)
+	}
+}
+
+func TestFetchStats_ServerError(t *testing.T) {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Body:       io.NopCloser(strings.NewReader("db down\n")),
+		}, nil
+	})
+
+	if _, err := FetchStats(client, "http://example.com"); err == nil || !strings.Contains(err.Error(), "server error: db down") {
+		t.Errorf("expected server error, got %v", err)
+	}
+}
@@ -1,32 +1,97 @@
 package storage
 
 import (
+	"cmp"
 	"crypto/cipher"
-	"crypto/rand"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/client/output"
+	"github.com/atinyakov/GophKeeper/internal/clock"
+	"go.uber.org/zap"
 )
 
+// ErrSecretNotFound is returned when no secret matches an ID.
+var ErrSecretNotFound = fmt.Errorf("secret %w", ErrNotFound)
+
 type LocalStorage struct {
 	Secrets []Secret `json:"secrets"`
 	Version int64    `json:"version"`
+	// Remotes holds the sync state per server when syncing with several.
+	Remotes map[string]*RemoteState `json:"remotes,omitempty"`
+	// MaxVersion is the highest version issued to a local change. It is
+	// kept so that versions never decrease, even if the clock goes
+	// backwards, see issueVersion.
+	MaxVersion int64 `json:"max_version,omitempty"`
+	// ETags holds per server what its last full answer to a sync was, so
+	// that unchanged syncs need not upload anything, see SyncWithServers.
+	ETags map[string]*RemoteETag `json:"etags,omitempty"`
+	// SyncFilter limits syncs to part of the vault, see SetFilter.
+	SyncFilter *SyncFilter `json:"filter,omitempty"`
+	// Conflicts holds the concurrent edits reported by the servers and not
+	// resolved yet, see PendingConflicts.
+	Conflicts []SyncConflict `json:"conflicts,omitempty"`
+	// Summary is the composition of the vault reported by the last sync
+	// that changed it, see VaultSummary.
+	Summary *VaultSummary `json:"summary,omitempty"`
+	// KDF holds how the vault key is derived from the master password, see
+	// Unlock. It is nil for vaults created before master passwords.
+	KDF     *KDFParams `json:"kdf,omitempty"`
 	mu      sync.Mutex
 	deleted map[string]bool `json:"-"`
+	syncLog string          // path of the sync log, see SetSyncLog
+	// transfers is the number of servers synced with concurrently, see SetTransfers.
+	transfers int
+	// transport is the protocol of syncs, see SetTransport.
+	transport Transport
+	// clock tells the time versions are issued at, see SetClock.
+	clock clock.Clock
+	// base holds the versions of the secrets as last loaded or saved, to
+	// tell the changes of other processes from those of ls, see merge.
+	base map[string]int64
+	// stale holds the IDs of the local copies to replace with the servers'
+	// copies at the next sync, see Invalidate.
+	stale map[string]bool
+	// path is the file ls is loaded from and saved to, see SetPath.
+	path string
 }
 
+// storageFile is the name of the local store, see SetPath and Paths.
 const storageFile = "storage.json"
 
+// SetPath sets the file ls is loaded from and saved to; it defaults to
+// storageFile in the working directory.
+func (ls *LocalStorage) SetPath(path string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.path = path
+}
+
+// file returns the path of the local store, see SetPath.
+func (ls *LocalStorage) file() string {
+	if ls.path == "" {
+		return storageFile
+	}
+	return ls.path
+}
+
+// Load reads ls from its file, see SetPath. A missing file is an empty
+// store.
 func (ls *LocalStorage) Load() error {
-	f, err := os.Open(storageFile)
+	f, err := os.Open(ls.file())
 	if err != nil {
 		if os.IsNotExist(err) {
 			ls.Secrets = []Secret{}
 			ls.Version = 0
 			ls.deleted = make(map[string]bool)
+			ls.base = make(map[string]int64)
 			return nil
 		}
 		return err
@@ -35,53 +100,417 @@ func (ls *LocalStorage) Load() error {
 	if err := json.NewDecoder(f).Decode(ls); err != nil {
 		return err
 	}
+	ls.indexSecrets()
+	return nil
+}
+
+// Save writes ls to its file, see SetPath. Other processes may have saved the vault
+// since ls was loaded, e.g. the ssh-agent while the shell runs, so the
+// file is read again under the vault lock and merged into ls first, see
+// merge: the changes of both are kept rather than those of the last
+// writer. The file is replaced atomically, so that readers never see it
+// half written.
+func (ls *LocalStorage) Save() error {
+	ls.mu.Lock()
+	path := ls.file()
+	ls.mu.Unlock()
+	lock, err := acquireLock(path + lockSuffix)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	var disk LocalStorage
+	if b, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(b, &disk); err != nil {
+			logger.Warn("overwriting unreadable local store", zap.Error(err))
+		} else {
+			ls.merge(&disk)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	b, err := json.Marshal(ls)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	ls.indexSecrets()
+	return nil
+}
+
+// indexSecrets rebuilds the tombstone index and the base versions of merge
+// from the secrets of ls.
+func (ls *LocalStorage) indexSecrets() {
 	ls.deleted = make(map[string]bool)
+	ls.base = make(map[string]int64, len(ls.Secrets))
 	for _, s := range ls.Secrets {
 		if s.Deleted {
 			ls.deleted[s.ID] = true
 		}
+		ls.base[s.ID] = s.Version
 	}
-	return nil
 }
 
-func (ls *LocalStorage) Save() error {
-	f, err := os.Create(storageFile)
-	if err != nil {
-		return err
+// merge merges disk, the vault as another process saved it, into ls. A
+// secret changed by one of them keeps the change, even if ls replaced it
+// with an older copy from the servers, see Invalidate; one changed by both
+// keeps the newer version, as syncs do. A secret removed by one, e.g.
+// purged, and not changed by the other since, stays removed. Settings are
+// those of ls, except that the newest sync state of each server is kept
+// and a master password set by the other process is adopted. ls.mu must
+// be held.
+func (ls *LocalStorage) merge(disk *LocalStorage) {
+	// removed reports whether a secret present on one side only was
+	// removed by the other side rather than added since the base.
+	removed := func(sec Secret) bool {
+		v, known := ls.base[sec.ID]
+		return known && sec.Version <= v
+	}
+	theirs := make(map[string]Secret, len(disk.Secrets))
+	for _, sec := range disk.Secrets {
+		theirs[sec.ID] = sec
+	}
+	ours := make(map[string]bool, len(ls.Secrets))
+	merged := make([]Secret, 0, len(ls.Secrets))
+	for _, sec := range ls.Secrets {
+		ours[sec.ID] = true
+		if d, ok := theirs[sec.ID]; ok {
+			if v, known := ls.base[sec.ID]; d.Version > sec.Version && (!known || d.Version != v) {
+				sec = d
+			}
+		} else if removed(sec) {
+			continue
+		}
+		merged = append(merged, sec)
+	}
+	for _, sec := range disk.Secrets {
+		if !ours[sec.ID] && !removed(sec) {
+			merged = append(merged, sec)
+		}
+	}
+	ls.Secrets = merged
+
+	ls.Version = max(ls.Version, disk.Version)
+	ls.MaxVersion = max(ls.MaxVersion, disk.MaxVersion)
+	for u, r := range disk.Remotes {
+		if mine := ls.Remotes[u]; mine == nil || r.Version > mine.Version {
+			if ls.Remotes == nil {
+				ls.Remotes = make(map[string]*RemoteState)
+			}
+			ls.Remotes[u] = r
+		}
+	}
+	// ETags hold fingerprints of the secrets, so stale ones only cost a
+	// full sync
+	for u, e := range disk.ETags {
+		if _, ok := ls.ETags[u]; !ok {
+			if ls.ETags == nil {
+				ls.ETags = make(map[string]*RemoteETag)
+			}
+			ls.ETags[u] = e
+		}
+	}
+	if ls.KDF == nil {
+		ls.KDF = disk.KDF
 	}
-	defer f.Close()
-	return json.NewEncoder(f).Encode(ls)
 }
 
+// Add stores the new local secret s. Its version is raised above the
+// versions issued before if needed, see issueVersion.
 func (ls *LocalStorage) Add(s Secret) {
 	ls.mu.Lock()
 	defer ls.mu.Unlock()
+	s.Version = max(s.Version, ls.MaxVersion+1)
+	ls.MaxVersion = s.Version
 	ls.Secrets = append(ls.Secrets, s)
 	ls.Version = s.Version
 }
 
-func (ls *LocalStorage) List(aead cipher.AEAD) {
+// ListOptions selects and orders the secrets printed by List.
+type ListOptions struct {
+	Type    string // only secrets of this type
+	Since   int64  // only secrets modified at or after this Unix time
+	Deleted bool   // show deleted secrets instead of live ones
+	Grep    string // only secrets whose name, comment or decrypted data contain this text (case-insensitive)
+	Sort    string // "name", "comment", "modified" (newest first) or "" for storage order
+	Offset  int    // number of selected secrets to skip
+	Limit   int    // maximum number of secrets to print; 0 means no limit
+	Long    bool   // print every secret in full, including decrypted data
+}
+
+// listEntry is a secret selected by List with its decrypted name and data.
+type listEntry struct {
+	sec   Secret
+	name  string
+	plain []byte
+	err   error
+}
+
+// List writes the secrets selected by opts to w as an aligned table of ID
+// prefix, type, name and age, or in full with opts.Long. Filters are
+// applied after decryption, so Grep also searches the secret data, except
+// that of reprompt secrets, which is never shown by List.
+func (ls *LocalStorage) List(w io.Writer, aead cipher.AEAD, opts ListOptions) {
+	entries := ls.selectEntries(aead, opts)
+
+	if opts.Long {
+		fmt.Fprintln(w, "Stored secrets:")
+		for _, e := range entries {
+			if e.err != nil {
+				fmt.Fprintf(w, "ID: %s %s\n", e.sec.ID, output.Error("(decryption error)"))
+				continue
+			}
+			fmt.Fprintf(w, "ID: %s\nType: %s\nName: %s\nComment: %s\n",
+				e.sec.ID, output.Paint(e.sec.Type, output.TypeStyle(e.sec.Type)), e.name, e.sec.Comment)
+			printMetadata(w, &e.sec)
+			data := FormatData(e.plain)
+			if e.sec.Reprompt {
+				data = output.Paint(hiddenData, output.Dim)
+			}
+			fmt.Fprintf(w, "Data: %s\nVersion: %d\n---\n", data, e.sec.Version)
+		}
+		return
+	}
+
+	now := time.Now()
+	var tbl output.Table
+	tbl.Header("ID", "TYPE", "NAME", "AGE")
+	for _, e := range entries {
+		name := output.Cell{Text: truncate(e.name, maxNameWidth)}
+		if e.err != nil {
+			name = output.Cell{Text: "(decryption error)", Style: output.Red}
+		}
+		tbl.Row(
+			output.Cell{Text: shortID(e.sec.ID), Style: output.Dim},
+			output.Cell{Text: e.sec.Type, Style: output.TypeStyle(e.sec.Type)},
+			name,
+			output.Cell{Text: FormatAge(now, time.Unix(e.sec.Version, 0))},
+		)
+	}
+	_ = tbl.Write(w)
+}
+
+// Select returns the secrets selected by opts, in the order List prints
+// them. opts.Long has no effect.
+func (ls *LocalStorage) Select(aead cipher.AEAD, opts ListOptions) []Secret {
+	entries := ls.selectEntries(aead, opts)
+	secrets := make([]Secret, len(entries))
+	for i, e := range entries {
+		secrets[i] = e.sec
+	}
+	return secrets
+}
+
+// selectEntries returns the secrets selected by opts with their decrypted
+// names and data, see List.
+func (ls *LocalStorage) selectEntries(aead cipher.AEAD, opts ListOptions) []listEntry {
 	ls.mu.Lock()
-	defer ls.mu.Unlock()
-	fmt.Println("Stored secrets:")
+	var entries []listEntry
 	for _, s := range ls.Secrets {
-		if s.Deleted || ls.deleted[s.ID] {
+		deleted := s.Deleted || ls.deleted[s.ID]
+		if deleted != opts.Deleted || isInternalType(s.Type) {
 			continue
 		}
-		cipherData, err := base64.StdEncoding.DecodeString(s.Data)
-		if err != nil || len(cipherData) < aead.NonceSize() {
-			fmt.Printf("ID: %s (decode error)\n", s.ID)
+		if opts.Type != "" && s.Type != opts.Type {
 			continue
 		}
-		nonce := cipherData[:aead.NonceSize()]
-		data := cipherData[aead.NonceSize():]
-		plain, err := aead.Open(nil, nonce, data, nil)
-		if err != nil {
-			fmt.Printf("ID: %s (decryption error)\n", s.ID)
+		if s.Version < opts.Since {
+			continue
+		}
+		name := DecryptName(aead, &s)
+		plain, err := Decrypt(aead, s.Data)
+		// The data of reprompt secrets is neither searched nor shown
+		if s.Reprompt {
+			plain = nil
+		}
+		if opts.Grep != "" && !containsFold(name, opts.Grep) && !containsFold(s.Comment, opts.Grep) && (err != nil || !containsFold(string(plain), opts.Grep)) {
+			continue
+		}
+		entries = append(entries, listEntry{sec: s, name: name, plain: plain, err: err})
+	}
+	ls.mu.Unlock()
+
+	switch opts.Sort {
+	case "name":
+		slices.SortStableFunc(entries, func(a, b listEntry) int {
+			return strings.Compare(strings.ToLower(a.name), strings.ToLower(b.name))
+		})
+	case "comment":
+		slices.SortStableFunc(entries, func(a, b listEntry) int {
+			return strings.Compare(strings.ToLower(a.sec.Comment), strings.ToLower(b.sec.Comment))
+		})
+	case "modified":
+		slices.SortStableFunc(entries, func(a, b listEntry) int {
+			return cmp.Compare(b.sec.Version, a.sec.Version)
+		})
+	}
+
+	entries = entries[min(max(opts.Offset, 0), len(entries)):]
+	if opts.Limit > 0 && len(entries) > opts.Limit {
+		entries = entries[:opts.Limit]
+	}
+	return entries
+}
+
+const (
+	// shortIDLength is the length of the ID prefix shown by List.
+	shortIDLength = 8
+	// maxNameWidth is the maximum name width shown by List.
+	maxNameWidth = 40
+)
+
+// shortID returns the prefix of id shown in tables.
+func shortID(id string) string {
+	if len(id) <= shortIDLength {
+		return id
+	}
+	return id[:shortIDLength]
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// FormatAge renders the time elapsed since t in a compact form such as
+// "45s", "12m", "3h", "5d", "7mo" or "2y".
+func FormatAge(now, t time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", max(int(d.Seconds()), 0))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case d < 30*24*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	case d < 365*24*time.Hour:
+		return fmt.Sprintf("%dmo", int(d.Hours()/(24*30)))
+	default:
+		return fmt.Sprintf("%dy", int(d.Hours()/(24*365)))
+	}
+}
+
+var (
+	// ErrAmbiguousID is returned when an ID prefix matches several secrets.
+	ErrAmbiguousID = errors.New("ambiguous ID prefix")
+	// ErrAmbiguousName is returned when a name matches several secrets.
+	ErrAmbiguousName = errors.New("ambiguous secret name")
+)
+
+// ResolveID returns the full ID of the secret whose ID is prefix or starts
+// with it, so the short IDs printed by List can be used in commands.
+// Deleted secrets, attachment chunks and the alias map are not considered.
+func (ls *LocalStorage) ResolveID(prefix string) (string, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	var match string
+	for _, s := range ls.Secrets {
+		if s.Deleted || ls.deleted[s.ID] || isInternalType(s.Type) {
 			continue
 		}
-		fmt.Printf("ID: %s\nType: %s\nComment: %s\nData: %s\nVersion: %d\n---\n",
-			s.ID, s.Type, s.Comment, string(plain), s.Version)
+		if s.ID == prefix {
+			return s.ID, nil
+		}
+		if prefix != "" && strings.HasPrefix(s.ID, prefix) {
+			if match != "" && match != s.ID {
+				return "", fmt.Errorf("%w: %s", ErrAmbiguousID, prefix)
+			}
+			match = s.ID
+		}
+	}
+	if match == "" {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, prefix)
+	}
+	return match, nil
+}
+
+// containsFold reports whether substr is within s, ignoring case.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// ParseTime parses a date ("2006-01-02", local time) or an RFC 3339
+// timestamp and returns it as Unix time.
+func ParseTime(s string) (int64, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t.Unix(), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: use YYYY-MM-DD or RFC 3339", s)
+	}
+	return t.Unix(), nil
+}
+
+// FormatData renders a decrypted payload for display. Multi-line payloads
+// start on a new line and are indented, so their line breaks stay readable.
+func FormatData(plain []byte) string {
+	text := strings.TrimRight(string(plain), "\n")
+	if !strings.Contains(text, "\n") {
+		return text
+	}
+	return "\n  " + strings.ReplaceAll(text, "\n", "\n  ")
+}
+
+// PrintSecret writes a readable rendering of sec to w, decrypting its data with aead.
+func PrintSecret(w io.Writer, sec *Secret, aead cipher.AEAD) {
+	fmt.Fprintf(w, "ID: %s\nType: %s\nName: %s\nComment: %s\n",
+		sec.ID, output.Paint(sec.Type, output.TypeStyle(sec.Type)), DecryptName(aead, sec), sec.Comment)
+	printMetadata(w, sec)
+	plain, err := Decrypt(aead, sec.Data)
+	if err != nil {
+		fmt.Fprintf(w, "Data: %s\n", output.Error("(decryption error)"))
+	} else {
+		fmt.Fprintf(w, "Data: %s\n", FormatData(plain))
+	}
+	fmt.Fprintf(w, "Version: %d\n", sec.Version)
+}
+
+// PrintSecretHidden writes sec to w like PrintSecret, but with note in
+// place of its data, e.g. for reprompt secrets not revealed yet.
+func PrintSecretHidden(w io.Writer, sec *Secret, aead cipher.AEAD, note string) {
+	fmt.Fprintf(w, "ID: %s\nType: %s\nName: %s\nComment: %s\n",
+		sec.ID, output.Paint(sec.Type, output.TypeStyle(sec.Type)), DecryptName(aead, sec), sec.Comment)
+	printMetadata(w, sec)
+	fmt.Fprintf(w, "Data: %s\n", output.Paint(note, output.Dim))
+	fmt.Fprintf(w, "Version: %d\n", sec.Version)
+}
+
+// hiddenData is shown by List instead of the data of reprompt secrets.
+const hiddenData = "(hidden, reveal with get)"
+
+// printMetadata writes the folder, tags, reprompt flag and expiry of sec to
+// w, if set.
+func printMetadata(w io.Writer, sec *Secret) {
+	if sec.Folder != "" {
+		fmt.Fprintf(w, "Folder: %s\n", sec.Folder)
+	}
+	if len(sec.Tags) > 0 {
+		fmt.Fprintf(w, "Tags: %s\n", strings.Join(sec.Tags, ", "))
+	}
+	if sec.Reprompt {
+		fmt.Fprintln(w, "Reprompt: yes")
+	}
+	if sec.ExpiresAt != 0 {
+		fmt.Fprintf(w, "Expires: %s\n", time.Unix(sec.ExpiresAt, 0).Format(time.DateOnly))
 	}
 }
 
@@ -107,7 +536,7 @@ func (ls *LocalStorage) Delete(id string) bool {
 	for i, s := range ls.Secrets {
 		if s.ID == id && !s.Deleted {
 			ls.Secrets[i].Deleted = true
-			ls.Secrets[i].Version = time.Now().Unix()
+			ls.Secrets[i].Version = ls.issueVersion(s.Version)
 			ls.deleted[id] = true
 			return true
 		}
@@ -124,17 +553,135 @@ func (ls *LocalStorage) Edit(id string, newData []byte, newComment string, aead
 			continue
 		}
 
-		nonce := make([]byte, aead.NonceSize())
-		if _, err := rand.Read(nonce); err != nil {
-			fmt.Println("failed to generate nonce:", err)
+		data, err := Encrypt(aead, newData)
+		if err != nil {
+			logger.Error("failed to encrypt secret", zap.String("id", id), zap.Error(err))
 			return false
 		}
-
-		ct := aead.Seal(nonce, nonce, []byte(newData), nil)
-		ls.Secrets[i].Data = base64.StdEncoding.EncodeToString(ct)
+		ls.Secrets[i].Data = data
 		ls.Secrets[i].Comment = newComment
-		ls.Secrets[i].Version = time.Now().Unix()
+		ls.Secrets[i].Version = ls.issueVersion(sec.Version)
 		return true
 	}
 	return false
 }
+
+// issueVersion returns the version of a secret modified now, whose
+// previous version was prev. It is the current Unix time, but always
+// greater than the previous version, so the server accepts changes made
+// within the same second, and than every version issued before, so that a
+// clock set back does not make the server drop later changes as older.
+// ls.mu must be held.
+func (ls *LocalStorage) issueVersion(prev int64) int64 {
+	v := max(ls.now().Unix(), prev+1, ls.MaxVersion+1)
+	ls.MaxVersion = v
+	return v
+}
+
+// SetClock replaces the system clock versions are issued by, e.g. with a
+// clock.Fake in tests.
+func (ls *LocalStorage) SetClock(c clock.Clock) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.clock = c
+}
+
+// now returns the current time of the clock of ls.
+func (ls *LocalStorage) now() time.Time {
+	return cmp.Or(ls.clock, clock.Real).Now()
+}
+
+// MetadataUpdate describes a change of secret metadata; nil fields are kept.
+type MetadataUpdate struct {
+	Name       *string // encrypted name, see EncryptName
+	Comment    *string
+	Folder     *string
+	AddTags    []string
+	RemoveTags []string
+	Reprompt   *bool
+	ExpiresAt  *int64
+}
+
+// UpdateMetadata changes the name, comment, folder, tags, reprompt flag and expiry
+// of a secret without touching its encrypted data, and bumps its version so the
+// change syncs.
+func (ls *LocalStorage) UpdateMetadata(id string, u MetadataUpdate) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for i, sec := range ls.Secrets {
+		if sec.ID != id || sec.Deleted || ls.deleted[id] {
+			continue
+		}
+		s := &ls.Secrets[i]
+		if u.Name != nil {
+			s.Name = *u.Name
+		}
+		if u.Comment != nil {
+			s.Comment = *u.Comment
+		}
+		if u.Folder != nil {
+			s.Folder = strings.Trim(strings.TrimSpace(*u.Folder), "/")
+		}
+		s.Tags = updateTags(s.Tags, u.AddTags, u.RemoveTags)
+		if u.Reprompt != nil {
+			s.Reprompt = *u.Reprompt
+		}
+		if u.ExpiresAt != nil {
+			s.ExpiresAt = *u.ExpiresAt
+		}
+		s.Version = ls.issueVersion(s.Version)
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrSecretNotFound, id)
+}
+
+// Clone stores a copy of the secret with the given ID under a fresh ID and
+// returns the copy. The payload and name are encrypted anew; attachments
+// share their chunks with the original, which are kept as long as either
+// references them.
+func (ls *LocalStorage) Clone(id string, aead cipher.AEAD) (*Secret, error) {
+	sec := ls.Get(id)
+	if sec == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, id)
+	}
+	plain, err := Decrypt(aead, sec.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	clone := Secret{
+		ID:        NewID(),
+		Type:      sec.Type,
+		Comment:   sec.Comment,
+		Folder:    sec.Folder,
+		Tags:      slices.Clone(sec.Tags),
+		Version:   ls.now().Unix(),
+		Reprompt:  sec.Reprompt,
+		ExpiresAt: sec.ExpiresAt,
+	}
+	if clone.Data, err = Encrypt(aead, plain); err != nil {
+		return nil, err
+	}
+	if sec.Name != "" {
+		if clone.Name, err = EncryptName(aead, DecryptName(aead, sec)); err != nil {
+			return nil, err
+		}
+	}
+	ls.Add(clone)
+	return ls.Get(clone.ID), nil
+}
+
+// updateTags returns tags with add added and remove removed. Tags are
+// trimmed, deduplicated and sorted; empty tags are dropped.
+func updateTags(tags, add, remove []string) []string {
+	var result []string
+	for _, t := range append(slices.Clone(tags), add...) {
+		t = strings.TrimSpace(t)
+		if t != "" && !slices.Contains(remove, t) && !slices.Contains(result, t) {
+			result = append(result, t)
+		}
+	}
+	slices.Sort(result)
+	return result
+}
@@ -3,11 +3,17 @@ package storage
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"io"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/clock"
 )
 
 // fakeAEADStorage is a dummy AEAD that returns plaintext as-is and never errors.
@@ -21,6 +27,7 @@ func (f fakeAEADStorage) Seal(dst, nonce, plaintext, aad []byte) []byte {
 func (f fakeAEADStorage) Open(dst, nonce, ciphertext, aad []byte) ([]byte, error) {
 	return append(dst, ciphertext...), nil
 }
+func (f fakeAEADStorage) chunkKey() []byte { return []byte("fake chunk key") }
 
 func TestLoad_FileNotExist(t *testing.T) {
 	// Use temp dir and chdir
@@ -90,7 +97,95 @@ func TestSave(t *testing.T) {
 		t.Fatalf("Unmarshal failed: %v", err)
 	}
 	if out.Version != 7 || len(out.Secrets) != 1 || out.Secrets[0].ID != "2" {
-		t.Errorf("unexpected saved data: %+v", out)
+		t.Errorf("unexpected saved data: version=%d secrets=%+v", out.Version, out.Secrets)
+	}
+}
+
+func TestSave_SetPath(t *testing.T) {
+	dir := t.TempDir()
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	os.Chdir(dir)
+
+	path := filepath.Join(dir, "data", "vault.json")
+	if err := os.Mkdir(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	ls := &LocalStorage{Secrets: []Secret{{ID: "a", Version: 1}}}
+	ls.SetPath(path)
+	if err := ls.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	if _, err := os.Stat(storageFile); !os.IsNotExist(err) {
+		t.Errorf("Save wrote %s in the working directory", storageFile)
+	}
+	if _, err := os.Stat(path + lockSuffix); err != nil {
+		t.Errorf("lock file is not next to the store: %v", err)
+	}
+
+	got := &LocalStorage{}
+	got.SetPath(path)
+	if err := got.Load(); err != nil || got.Get("a") == nil {
+		t.Errorf("Load from %s = %v, secrets %+v; want secret a", path, err, got.Secrets)
+	}
+}
+
+func TestSave_MergesOtherProcesses(t *testing.T) {
+	dir := t.TempDir()
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	os.Chdir(dir)
+
+	initial := &LocalStorage{Secrets: []Secret{
+		{ID: "edited", Data: "old", Version: 1},
+		{ID: "purged", Data: "p", Deleted: true, Version: 2},
+		{ID: "both", Data: "old", Version: 3},
+	}}
+	if err := initial.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two processes load the vault, e.g. the shell and the ssh-agent
+	shell, agent := &LocalStorage{}, &LocalStorage{}
+	if err := shell.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	shell.Add(Secret{ID: "from-shell", Version: 10})
+	shell.Secrets[0].Data, shell.Secrets[0].Version = "new", 11
+	shell.Secrets[2].Data, shell.Secrets[2].Version = "shell", 12
+	if err := shell.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	agent.Add(Secret{ID: "from-agent", Version: 20})
+	agent.Secrets = slices.DeleteFunc(agent.Secrets, func(s Secret) bool { return s.ID == "purged" })
+	agent.Secrets[1].Data, agent.Secrets[1].Version = "agent", 13
+	if err := agent.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := &LocalStorage{}
+	if err := got.Load(); err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]string{}
+	for _, s := range got.Secrets {
+		data[s.ID] = s.Data
+	}
+	want := map[string]string{"edited": "new", "both": "agent", "from-shell": "", "from-agent": ""}
+	if !maps.Equal(data, want) {
+		t.Errorf("merged secrets = %v, want %v", data, want)
+	}
+	if got.MaxVersion != 20 {
+		t.Errorf("MaxVersion = %d, want 20", got.MaxVersion)
+	}
+	// The saving process sees the changes of the other one
+	if len(agent.Secrets) != len(got.Secrets) {
+		t.Errorf("agent has %d secrets after saving, want %d", len(agent.Secrets), len(got.Secrets))
 	}
 }
 
@@ -143,7 +238,7 @@ func TestEditAndList(t *testing.T) {
 		t.Fatal("Edit failed")
 	}
 
-	ls.List(aead)
+	ls.List(os.Stdout, aead, ListOptions{Long: true})
 
 	w.Close()
 	os.Stdout = orig
@@ -165,3 +260,377 @@ func TestEditAndList(t *testing.T) {
 		t.Errorf("expected Version >= %d, got %d", timeBefore, sec.Version)
 	}
 }
+
+func TestFormatData(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"single", "single"},
+		{"single\n", "single"},
+		{"first\nsecond", "\n  first\n  second"},
+	}
+	for _, tt := range tests {
+		if got := FormatData([]byte(tt.in)); got != tt.want {
+			t.Errorf("FormatData(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPrintSecret(t *testing.T) {
+	aead := fakeAEADPromt{}
+	data, err := Encrypt(aead, []byte("dear diary\ntoday"))
+	if err != nil {
+		t.Fatalf("Encrypt returned error: %v", err)
+	}
+
+	name, _ := EncryptName(aead, "Diary")
+
+	var buf strings.Builder
+	PrintSecret(&buf, &Secret{ID: "1", Type: "text", Data: data, Name: name, Comment: "diary", Version: 7}, aead)
+
+	want := "ID: 1\nType: text\nName: Diary\nComment: diary\nData: \n  dear diary\n  today\nVersion: 7\n"
+	if buf.String() != want {
+		t.Errorf("PrintSecret output = %q; want %q", buf.String(), want)
+	}
+}
+
+func TestIssueVersion_ClockBackwards(t *testing.T) {
+	// A version issued while the clock was an hour ahead
+	ahead := time.Now().Add(time.Hour).Unix()
+	ls := &LocalStorage{deleted: make(map[string]bool), MaxVersion: ahead}
+	data, _ := Encrypt(fakeAEADStorage{}, []byte("x"))
+	ls.Add(Secret{ID: "1", Type: "text", Data: data, Version: time.Now().Unix()})
+	ls.Add(Secret{ID: "2", Type: "text", Data: data, Version: time.Now().Unix()})
+
+	if got := ls.Get("1").Version; got != ahead+1 {
+		t.Errorf("added version = %d; want %d", got, ahead+1)
+	}
+	if !ls.Edit("1", []byte("y"), "", fakeAEADStorage{}) {
+		t.Fatal("Edit failed")
+	}
+	if got := ls.Get("1").Version; got != ahead+3 {
+		t.Errorf("edited version = %d; want %d", got, ahead+3)
+	}
+	ls.Delete("2")
+	if ls.MaxVersion != ahead+4 {
+		t.Errorf("MaxVersion = %d; want %d", ls.MaxVersion, ahead+4)
+	}
+
+	// The highest version survives a restart
+	origDir, _ := os.Getwd()
+	defer func() { _ = os.Chdir(origDir) }()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := ls.Save(); err != nil {
+		t.Fatal(err)
+	}
+	var loaded LocalStorage
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.MaxVersion != ahead+4 {
+		t.Errorf("loaded MaxVersion = %d; want %d", loaded.MaxVersion, ahead+4)
+	}
+}
+
+func TestIssueVersion_FollowsClock(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	ls := &LocalStorage{deleted: make(map[string]bool)}
+	ls.SetClock(clk)
+	data, _ := Encrypt(fakeAEADStorage{}, []byte("x"))
+	ls.Add(Secret{ID: "1", Type: "text", Data: data, Version: 1699999000})
+
+	edit := func() int64 {
+		t.Helper()
+		if !ls.Edit("1", []byte("y"), "", fakeAEADStorage{}) {
+			t.Fatal("Edit failed")
+		}
+		return ls.Get("1").Version
+	}
+	if got := edit(); got != 1700000000 {
+		t.Errorf("version = %d; want the time of the clock", got)
+	}
+	if got := edit(); got != 1700000001 {
+		t.Errorf("version within the same second = %d; want one more", got)
+	}
+	clk.Advance(-time.Hour)
+	if got := edit(); got != 1700000002 {
+		t.Errorf("version after the clock was set back = %d; want one more", got)
+	}
+	clk.Advance(2 * time.Hour)
+	if got := edit(); got != 1700003600 {
+		t.Errorf("version an hour later = %d; want the time of the clock", got)
+	}
+}
+
+func TestUpdateMetadata(t *testing.T) {
+	now := time.Now().Unix()
+	ls := &LocalStorage{deleted: make(map[string]bool)}
+	ls.Add(Secret{ID: "1", Type: "text", Data: "d", Comment: "old", Tags: []string{"b"}, Version: now})
+
+	comment, folder := "new", "/work/db/"
+	err := ls.UpdateMetadata("1", MetadataUpdate{
+		Comment: &comment,
+		Folder:  &folder,
+		AddTags: []string{"a", " c ", "b", ""},
+	})
+	if err != nil {
+		t.Fatalf("UpdateMetadata returned error: %v", err)
+	}
+
+	sec := ls.Get("1")
+	if sec.Comment != "new" || sec.Folder != "work/db" || sec.Data != "d" {
+		t.Errorf("secret = %+v; want comment new, folder work/db and unchanged data", sec)
+	}
+	if got := strings.Join(sec.Tags, ","); got != "a,b,c" {
+		t.Errorf("tags = %q; want %q", got, "a,b,c")
+	}
+	if sec.Version <= now {
+		t.Errorf("version = %d; want greater than %d", sec.Version, now)
+	}
+
+	expires := int64(1900000000)
+	if err := ls.UpdateMetadata("1", MetadataUpdate{RemoveTags: []string{"b"}, ExpiresAt: &expires}); err != nil {
+		t.Fatalf("UpdateMetadata returned error: %v", err)
+	}
+	sec = ls.Get("1")
+	if got := strings.Join(sec.Tags, ","); got != "a,c" || sec.Comment != "new" {
+		t.Errorf("after removal: tags = %q, comment = %q; want a,c and new", got, sec.Comment)
+	}
+	if sec.ExpiresAt != expires {
+		t.Errorf("expires at %d; want %d", sec.ExpiresAt, expires)
+	}
+
+	if err := ls.UpdateMetadata("missing", MetadataUpdate{}); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("UpdateMetadata(missing) error = %v; want ErrSecretNotFound", err)
+	}
+}
+
+func TestPrintSecret_Metadata(t *testing.T) {
+	aead := fakeAEADPromt{}
+	data, _ := Encrypt(aead, []byte("x"))
+
+	var buf strings.Builder
+	PrintSecret(&buf, &Secret{ID: "1", Type: "text", Data: data, Folder: "work", Tags: []string{"a", "b"}, Version: 7}, aead)
+
+	want := "ID: 1\nType: text\nName: \nComment: \nFolder: work\nTags: a, b\nData: x\nVersion: 7\n"
+	if buf.String() != want {
+		t.Errorf("PrintSecret output = %q; want %q", buf.String(), want)
+	}
+}
+
+func TestClone(t *testing.T) {
+	aead := fakeAEADPromt{}
+	data, _ := Encrypt(aead, []byte("free-form data"))
+	ls := &LocalStorage{deleted: make(map[string]bool)}
+	ls.Add(Secret{ID: "1", Type: "text", Data: data, Comment: "c", Folder: "f", Tags: []string{"t"}, Version: 1})
+
+	clone, err := ls.Clone("1", aead)
+	if err != nil {
+		t.Fatalf("Clone returned error: %v", err)
+	}
+	if clone.ID == "1" || clone.Type != "text" || clone.Comment != "c" || clone.Folder != "f" || len(clone.Tags) != 1 {
+		t.Errorf("clone = %+v; want a copy with a new ID", clone)
+	}
+	if plain, _ := Decrypt(aead, ls.Get(clone.ID).Data); string(plain) != "free-form data" {
+		t.Errorf("clone data = %q; want %q", plain, "free-form data")
+	}
+
+	if _, err := ls.Clone("missing", aead); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("Clone(missing) error = %v; want ErrSecretNotFound", err)
+	}
+}
+
+// captureList returns the long output of ls.List with the given options.
+func captureList(t *testing.T, ls *LocalStorage, opts ListOptions) string {
+	t.Helper()
+	var buf strings.Builder
+	opts.Long = true
+	ls.List(&buf, fakeAEADStorage{}, opts)
+	return buf.String()
+}
+
+func TestList_Reprompt(t *testing.T) {
+	ls := &LocalStorage{deleted: make(map[string]bool)}
+	data, _ := Encrypt(fakeAEADStorage{}, []byte("hunter2"))
+	ls.Add(Secret{ID: "1", Type: "text", Comment: "root", Data: data, Version: 1})
+	on := true
+	if err := ls.UpdateMetadata("1", MetadataUpdate{Reprompt: &on}); err != nil {
+		t.Fatalf("UpdateMetadata returned error: %v", err)
+	}
+
+	out := captureList(t, ls, ListOptions{Long: true})
+	if strings.Contains(out, "hunter2") || !strings.Contains(out, hiddenData) || !strings.Contains(out, "Reprompt: yes") {
+		t.Errorf("list of reprompt secret = %q; want data hidden", out)
+	}
+	if out := captureList(t, ls, ListOptions{Grep: "hunter"}); strings.Contains(out, "root") {
+		t.Errorf("grep matched the data of a reprompt secret: %q", out)
+	}
+}
+
+func TestPrintSecretHidden(t *testing.T) {
+	data, _ := Encrypt(fakeAEADStorage{}, []byte("hunter2"))
+	sec := Secret{ID: "1", Type: "text", Comment: "root", Data: data, Version: 7, Reprompt: true}
+
+	var buf strings.Builder
+	PrintSecretHidden(&buf, &sec, fakeAEADStorage{}, "(press Enter to reveal)")
+	out := buf.String()
+	for _, want := range []string{"ID: 1\n", "Name: root\n", "Comment: root\n", "Reprompt: yes\n", "Data: (press Enter to reveal)\n", "Version: 7\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output %q does not contain %q", out, want)
+		}
+	}
+	if strings.Contains(out, "hunter2") {
+		t.Errorf("output %q reveals the data", out)
+	}
+}
+
+func TestListFilters(t *testing.T) {
+	ls := &LocalStorage{deleted: make(map[string]bool)}
+	for _, s := range []struct {
+		id, typ, comment, data string
+		version                int64
+	}{
+		{"1", "card", "Visa", "4111", 100},
+		{"2", "text", "bills", "march invoice", 200},
+		{"3", "card", "amex", "3782", 300},
+		{"4", "text", "old", "gone", 50},
+	} {
+		data, _ := Encrypt(fakeAEADStorage{}, []byte(s.data))
+		ls.Add(Secret{ID: s.id, Type: s.typ, Comment: s.comment, Data: data, Version: s.version})
+	}
+	ls.Delete("4")
+
+	ids := func(out string) []string {
+		var got []string
+		for _, line := range strings.Split(out, "\n") {
+			if id, ok := strings.CutPrefix(line, "ID: "); ok {
+				got = append(got, id)
+			}
+		}
+		return got
+	}
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []string
+	}{
+		{"all live", ListOptions{}, []string{"1", "2", "3"}},
+		{"type", ListOptions{Type: "card"}, []string{"1", "3"}},
+		{"since", ListOptions{Since: 200}, []string{"2", "3"}},
+		{"grep data", ListOptions{Grep: "INVOICE"}, []string{"2"}},
+		{"grep comment", ListOptions{Grep: "visa"}, []string{"1"}},
+		{"deleted", ListOptions{Deleted: true}, []string{"4"}},
+		{"sort comment", ListOptions{Sort: "comment"}, []string{"3", "2", "1"}},
+		{"sort modified", ListOptions{Type: "card", Sort: "modified"}, []string{"3", "1"}},
+		{"offset", ListOptions{Offset: 1}, []string{"2", "3"}},
+		{"limit", ListOptions{Limit: 2}, []string{"1", "2"}},
+		{"offset past end", ListOptions{Offset: 10}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(captureList(t, ls, tt.opts))
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ids = %v; want %v", got, tt.want)
+			}
+			var selected []string
+			for _, sec := range ls.Select(fakeAEADStorage{}, tt.opts) {
+				selected = append(selected, sec.ID)
+			}
+			if strings.Join(selected, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Select ids = %v; want %v", selected, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	got, err := ParseTime("2024-01-02T03:04:05Z")
+	if err != nil || got != 1704164645 {
+		t.Errorf("ParseTime RFC 3339 = %d, %v", got, err)
+	}
+	want := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local).Unix()
+	if got, err := ParseTime("2024-01-01"); err != nil || got != want {
+		t.Errorf("ParseTime date = %d, %v; want %d", got, err, want)
+	}
+	if _, err := ParseTime("yesterday"); err == nil {
+		t.Error("expected error for invalid time")
+	}
+}
+
+func TestListTable(t *testing.T) {
+	ls := &LocalStorage{deleted: make(map[string]bool)}
+	data, _ := Encrypt(fakeAEADStorage{}, []byte("top secret"))
+	ls.Add(Secret{
+		ID:      "0123456789abcdef",
+		Type:    "text",
+		Comment: "a very long comment that certainly does not fit into the table column",
+		Data:    data,
+		Version: time.Now().Add(-3 * time.Hour).Unix(),
+	})
+
+	var buf strings.Builder
+	ls.List(&buf, fakeAEADStorage{}, ListOptions{})
+	out := buf.String()
+
+	for _, want := range []string{"ID", "TYPE", "NAME", "AGE", "01234567 ", "text", "3h", "…"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("table missing %q: %q", want, out)
+		}
+	}
+	for _, unwanted := range []string{"0123456789abcdef", "top secret"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("table must not contain %q: %q", unwanted, out)
+		}
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	now := time.Unix(100000000, 0)
+	tests := []struct {
+		ago  time.Duration
+		want string
+	}{
+		{30 * time.Second, "30s"},
+		{5 * time.Minute, "5m"},
+		{3 * time.Hour, "3h"},
+		{4 * 24 * time.Hour, "4d"},
+		{90 * 24 * time.Hour, "3mo"},
+		{800 * 24 * time.Hour, "2y"},
+		{-time.Hour, "0s"},
+	}
+	for _, tt := range tests {
+		if got := FormatAge(now, now.Add(-tt.ago)); got != tt.want {
+			t.Errorf("FormatAge(-%s) = %q; want %q", tt.ago, got, tt.want)
+		}
+	}
+}
+
+func TestResolveID(t *testing.T) {
+	ls := &LocalStorage{deleted: make(map[string]bool)}
+	ls.Add(Secret{ID: "abc123"})
+	ls.Add(Secret{ID: "abd456"})
+	ls.Add(Secret{ID: "ffe000", Type: ChunkType})
+
+	tests := []struct {
+		prefix  string
+		want    string
+		wantErr error
+	}{
+		{"abc123", "abc123", nil},
+		{"abc", "abc123", nil},
+		{"ab", "", ErrAmbiguousID},
+		{"ffe", "", ErrSecretNotFound},
+		{"zzz", "", ErrSecretNotFound},
+		{"", "", ErrSecretNotFound},
+	}
+	for _, tt := range tests {
+		got, err := ls.ResolveID(tt.prefix)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("ResolveID(%q) = %q, %v; want %q, %v", tt.prefix, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -1,60 +1,755 @@
 package storage
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
-	"strings"
+	"slices"
+	"sync"
 	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/fingerprint"
+	"github.com/atinyakov/GophKeeper/internal/jsonstream"
+	"go.uber.org/zap"
 )
 
-func StartAutoSync(client *http.Client, baseURL string, ls *LocalStorage) {
-	go func() {
+const (
+	// syncInterval is the delay between automatic syncs.
+	syncInterval = 10 * time.Second
+	// maxSyncInterval caps the delay between automatic syncs while the
+	// server keeps failing.
+	maxSyncInterval = 5 * time.Minute
+)
+
+// StartAutoSync syncs ls with the servers at baseURLs in the background
+// every syncInterval until ctx is done, logging failed syncs. See AutoSync.
+func StartAutoSync(ctx context.Context, client *http.Client, baseURLs []string, ls *LocalStorage, policy RetryPolicy) {
+	go AutoSync(ctx, client, baseURLs, ls, policy, nil, func(err error, next time.Duration) {
+		if err != nil {
+			logger.Error("sync failed", zap.Error(err), zap.Duration("next_attempt", next.Round(time.Second)))
+		}
+	})
+}
+
+// AutoSync syncs ls with the servers at baseURLs every syncInterval until
+// ctx is done. Each sync is retried according to policy; while syncs keep
+// failing, the interval grows exponentially up to maxSyncInterval. After
+// every sync, report is called with its error, if any, and the delay until
+// the next one.
+//
+// If pushes is not nil, e.g. fed by WatchServers, the changes the servers
+// push are applied to ls between syncs, see applyPush, and report is
+// called after each as after a sync. A sync starts right away when a push
+// cannot be applied on its own, and the servers are polled only every
+// watchSyncInterval.
+func AutoSync(ctx context.Context, client *http.Client, baseURLs []string, ls *LocalStorage, policy RetryPolicy, pushes <-chan Push, report func(err error, next time.Duration)) {
+	interval := syncInterval
+	if pushes != nil {
+		interval = watchSyncInterval
+	}
+	backoff := RetryPolicy{BaseDelay: syncInterval, MaxDelay: maxSyncInterval}
+	failures := 0
+	// inStep holds per server whether its watch stream pushed every change
+	// since ls was last in step with it, see Push.Opened
+	inStep := make(map[string]bool)
+	for {
+		delay := interval
+		err := policy.Do(func() error {
+			return SyncWithServers(client, baseURLs, ls)
+		})
+		if err != nil {
+			failures++
+			delay = backoff.Backoff(failures + 1)
+		} else {
+			failures = 0
+			// The sync caught up with what the open streams missed
+			for u := range inStep {
+				inStep[u] = true
+			}
+		}
+		report(err, delay)
+
+		next := time.NewTimer(delay)
+		deadline := time.Now().Add(delay)
+	wait:
 		for {
-			err := SyncWithServer(client, baseURL, ls)
-			if err != nil {
-				fmt.Println("sync error:", err)
+			select {
+			case <-ctx.Done():
+				next.Stop()
+				return
+			case <-next.C:
+				break wait
+			case p := <-pushes:
+				if p.Opened {
+					inStep[p.BaseURL] = ls.inStep(p.BaseURL, p.ETag)
+					if !inStep[p.BaseURL] {
+						break wait
+					}
+					continue
+				}
+				if p.Resync {
+					break wait
+				}
+				synced, err := ls.applyPush(p, inStep[p.BaseURL], len(baseURLs))
+				if err != nil {
+					logger.Warn("failed to apply pushed changes", zap.String("server", p.BaseURL), zap.Error(err))
+				}
+				if err != nil || !synced {
+					break wait
+				}
+				report(nil, time.Until(deadline))
 			}
-			time.Sleep(10 * time.Second)
 		}
-	}()
+		next.Stop()
+	}
 }
 
+// SyncWithServer syncs ls with the server at baseURL: local changes are
+// uploaded and the local secrets are replaced by the server's.
 func SyncWithServer(client *http.Client, baseURL string, ls *LocalStorage) error {
+	return SyncWithServers(client, []string{baseURL}, ls)
+}
+
+// RemoteState is the sync state of ls with one server.
+type RemoteState struct {
+	Version  int64 `json:"version"`   // latest version known from the server
+	LastSync int64 `json:"last_sync"` // Unix time of the last successful sync
+}
+
+// RemoteETag is what a server answered to the last sync with it.
+type RemoteETag struct {
+	// ETag identifies the server's secrets; empty if the server did not
+	// send one.
+	ETag string `json:"etag,omitempty"`
+	// Fingerprint hashes the IDs and versions of the secrets the server
+	// sent, see fingerprint.Versions.
+	Fingerprint string `json:"fingerprint"`
+	// KDF reports that the key derivation parameters of the vault were
+	// sent to the server, so that they are not sent again.
+	KDF bool `json:"kdf,omitempty"`
+}
+
+// SyncResult is the answer of a server to a sync. Its secrets are passed
+// on as they are decoded rather than kept; Versions records their IDs and
+// versions.
+type SyncResult struct {
+	Versions map[string]int64 // versions of the secrets the server sent
+	Version  int64            `json:"version"`
+	Updated  []string         `json:"updated"` // uploaded secrets the server accepted
+	Skipped  []string         `json:"skipped"` // uploaded secrets the server has the same or newer versions of
+	// Conflicts describes the skipped secrets the server has newer
+	// versions of; nil if the server does not report them.
+	Conflicts []SyncConflict `json:"conflicts"`
+	// Restored are the uploaded secrets the server did not store as its
+	// vault was rolled back to a backup since the client received them;
+	// the server's copies replace them.
+	Restored []string `json:"restored"`
+	// Summary is the composition of the vault; nil if the server does not
+	// report it or the sync changed nothing.
+	Summary *VaultSummary `json:"summary"`
+	// KDF are the key derivation parameters the server holds for the
+	// vault; nil if it holds none or the sync changed nothing.
+	KDF *KDFParams `json:"kdf"`
+	// ETag identifies the server's secrets, see RemoteETag.
+	ETag string
+	// NotModified reports that the server answered 304 Not Modified: its
+	// secrets are unchanged since the sync that returned ETag.
+	NotModified bool
+	Timings     SyncTimings // timings of the exchange with the server
+}
+
+// SetTransfers sets the number of servers ls is synced with concurrently.
+// n below 1 means one at a time.
+func (ls *LocalStorage) SetTransfers(n int) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.transfers = n
+}
+
+// SyncWithServers syncs ls with every server in baseURLs, e.g. a
+// self-hosted server and a backup, so the vault survives the loss of one.
+// Servers are synced concurrently, up to the limit set by SetTransfers.
+// All servers receive the same local secrets, including deletions, and the
+// local secrets are replaced by the union of their answers, keeping the
+// newest version of each secret. Secrets only known to one server reach the
+// others with the next sync. If a server fails, local deletions are kept so
+// that it receives them next time; the errors of all failed servers are
+// returned.
+//
+// Servers also answer with the tombstones of the secrets deleted on other
+// devices. A tombstone wins over a live copy of the same version, and is
+// kept locally only while another server still sent the secret, so that
+// the deletion reaches that server with the next sync.
+//
+// A server whose vault was rolled back to a backup does not store the
+// unchanged copies from before and lists them in SyncResult.Restored; its
+// older copies replace them, and reach the other servers as local changes
+// unless those hold newer edits.
+//
+// Local copies marked stale with Invalidate are not uploaded, so that the
+// servers' copies replace them even if older. Every secret carries the
+// version the servers sent it at as its BaseVersion, so that a copy not
+// changed since, which is uploaded like the rest, is not reported as a
+// conflict when another device stored a newer version.
+//
+// The key derivation parameters of the vault, see KDFParams, are sent to
+// every server until it got them once. A vault without any, e.g. on a new
+// device, takes those of the first server holding some, so that the same
+// master password opens it, see Unlock.
+//
+// If the local secrets are exactly those a server sent last time, nothing is
+// uploaded to it and the ETag it sent then is passed as If-None-Match; a
+// server with no changes since answers 304 Not Modified with an empty body,
+// and the local secrets stand for its answer.
+func SyncWithServers(client *http.Client, baseURLs []string, ls *LocalStorage) error {
+	ls.mu.Lock()
+	t := ls.transport
+	ls.mu.Unlock()
+	return SyncWithRemote(NewRemote(client, t), baseURLs, ls)
+}
+
+// SyncWithRemote is SyncWithServers calling the servers through remote.
+func SyncWithRemote(remote Remote, baseURLs []string, ls *LocalStorage) error {
 	ls.mu.Lock()
-	payload := map[string]interface{}{
-		"secrets":            ls.Secrets,
-		"last_known_version": ls.Version,
+	local := slices.Clone(ls.Secrets)
+	versions := make(map[string]int64, len(baseURLs))
+	for _, u := range baseURLs {
+		versions[u] = ls.remoteVersion(u, len(baseURLs))
+	}
+	etags := maps.Clone(ls.ETags)
+	stale := maps.Clone(ls.stale)
+	pending := ls.conflictIDs()
+	var filter SyncFilter
+	if ls.SyncFilter != nil {
+		filter = *ls.SyncFilter
 	}
+	transfers := max(ls.transfers, 1)
+	kdf := ls.KDF
 	ls.mu.Unlock()
 
-	b, _ := json.Marshal(payload)
-	resp, err := client.Post(baseURL+"/api/sync", "application/json", bytes.NewReader(b))
+	outgoing := uploads(local, stale, pending)
+	localPrint, tombstones := livePrint(outgoing)
+
+	// Secrets are merged as they arrive, preferring the newest version and,
+	// among equal versions, the server listed first, so the result does not
+	// depend on which server answers first. The secrets of a failing
+	// server are not merged, as its answer may be cut short or mangled.
+	var (
+		mu     sync.Mutex
+		merged = map[string]mergedSecret{}
+		ids    = make([][]string, len(baseURLs)+1)
+		sent   = map[string]bool{} // IDs of the live secrets the servers sent
+		// The copies replaced by newer ones of other servers, by server,
+		// in case a server restored them from a backup
+		lost = make([]map[string]Secret, len(baseURLs))
+	)
+	lose := func(sec Secret, source int) {
+		if len(baseURLs) == 1 || source == len(baseURLs) {
+			return
+		}
+		if lost[source] == nil {
+			lost[source] = make(map[string]Secret)
+		}
+		lost[source][sec.ID] = sec
+	}
+	add := func(source int) func(Secret) {
+		return func(sec Secret) {
+			mu.Lock()
+			defer mu.Unlock()
+			ids[source] = append(ids[source], sec.ID)
+			if !sec.Deleted && source < len(baseURLs) {
+				sent[sec.ID] = true
+			}
+			prev, ok := merged[sec.ID]
+			if !ok || sec.Version > prev.Version || sec.Version == prev.Version && newerThan(sec, source, prev) {
+				merged[sec.ID] = mergedSecret{Secret: sec, source: source}
+				if ok {
+					lose(prev.Secret, prev.source)
+				}
+			} else {
+				lose(sec, source)
+			}
+		}
+	}
+
+	var (
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, transfers)
+		results = make([]*SyncResult, len(baseURLs))
+		errs    = make([]error, len(baseURLs))
+	)
+	for i, u := range baseURLs {
+		wg.Add(1)
+		sem <- struct{}{}
+		upload, etag, params := outgoing, "", kdf
+		if e := etags[u]; e != nil && e.KDF {
+			params = nil
+		}
+		if e := etags[u]; e != nil && params == nil && !tombstones && len(stale) == 0 && e.Fingerprint == localPrint {
+			upload, etag = nil, e.ETag
+		}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			call := SyncCall{Secrets: upload, LastVersion: versions[u], Filter: filter, ETag: etag, KDF: params}
+			results[i], errs[i] = remote.Sync(u, call, add(i))
+			if res := results[i]; res != nil && res.NotModified {
+				for _, sec := range local {
+					res.Versions[sec.ID] = sec.Version
+					add(i)(sec)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	logSyncs := func() {
+		for i, u := range baseURLs {
+			ls.logSync(newSyncLogEntry(u, local, results[i], errs[i]))
+		}
+	}
+	failed := slices.ContainsFunc(errs, func(err error) bool { return err != nil })
+	if !slices.ContainsFunc(results, func(r *SyncResult) bool { return r != nil }) {
+		logSyncs()
+		return errors.Join(wrapServerErrors(baseURLs, errs)...)
+	}
+	mergeStart := time.Now()
+
+	keep := add(len(baseURLs))
+	for _, sec := range local {
+		if _, sent := merged[sec.ID]; stale[sec.ID] && !sent || failed && sec.Deleted && !stale[sec.ID] {
+			keep(sec)
+		}
+	}
+
+	// A server rolled back to a backup holds back the copies from before,
+	// see SyncResult.Restored. Where another server still holds the same
+	// copy, the first server's copy, or tombstone if it has none, is stored
+	// as a local change newer than both, so that it reaches the others
+	// with the next sync; a newer copy of another server, edited since,
+	// stays.
+	if len(baseURLs) > 1 {
+		uploaded := make(map[string]int64, len(local))
+		for _, sec := range local {
+			uploaded[sec.ID] = sec.Version
+		}
+		now := time.Now().Unix()
+		for i, res := range results {
+			if res == nil {
+				continue
+			}
+			for _, id := range res.Restored {
+				m, ok := merged[id]
+				if !ok || m.source == i || m.Version > uploaded[id] {
+					continue
+				}
+				sec, ok := lost[i][id]
+				if ok {
+					sec.BaseVersion = sec.Version
+				} else {
+					sec = Secret{ID: id, Deleted: true}
+				}
+				sec.Version = max(now, m.Version+1)
+				merged[id] = mergedSecret{Secret: sec, source: len(baseURLs)}
+			}
+		}
+	}
+
+	// Secrets keep the order in which the servers, in turn, sent them.
+	// Secrets outside the filter are dropped, even if a server that does
+	// not know filters sent them, and so are the tombstones the servers
+	// sent once no server holds the secret any more.
+	var order []string
+	seen := make(map[string]bool, len(merged))
+	for _, list := range ids {
+		for _, id := range list {
+			m := merged[id]
+			if !m.Deleted && !filter.Match(m.Secret) {
+				continue
+			}
+			if m.Deleted && m.source < len(baseURLs) && !sent[id] {
+				continue
+			}
+			if !seen[id] {
+				seen[id] = true
+				order = append(order, id)
+			}
+		}
+	}
+
+	now := time.Now().Unix()
+	ls.mu.Lock()
+	if !failed {
+		for id := range stale {
+			delete(ls.stale, id)
+		}
+	}
+	ls.Secrets = make([]Secret, 0, len(order))
+	for _, id := range order {
+		m := merged[id]
+		if m.source < len(baseURLs) {
+			m.BaseVersion = m.Version
+		}
+		ls.Secrets = append(ls.Secrets, m.Secret)
+	}
+	for i, res := range results {
+		if res == nil {
+			continue
+		}
+		u := baseURLs[i]
+		ls.addConflicts(res.Conflicts)
+		if res.Summary != nil {
+			res.Summary.Time = now
+			ls.Summary = res.Summary
+		}
+		ls.adoptKDF(u, res.KDF)
+		if ls.ETags == nil {
+			ls.ETags = make(map[string]*RemoteETag)
+		}
+		sentKDF := kdf != nil || etags[u] != nil && etags[u].KDF
+		ls.ETags[u] = &RemoteETag{ETag: res.ETag, Fingerprint: fingerprint.Versions(res.Versions), KDF: sentKDF}
+		if len(baseURLs) == 1 {
+			ls.Version = res.Version
+			continue
+		}
+		if ls.Remotes == nil {
+			ls.Remotes = make(map[string]*RemoteState)
+		}
+		ls.Remotes[u] = &RemoteState{Version: res.Version, LastSync: now}
+		ls.Version = max(ls.Version, res.Version)
+	}
+	ls.mu.Unlock()
+	merge := time.Since(mergeStart)
+
+	persistStart := time.Now()
+	saveErr := ls.Save()
+	persist := time.Since(persistStart)
+	for _, res := range results {
+		if res != nil {
+			res.Timings.Merge, res.Timings.Persist = merge, persist
+		}
+	}
+	logSyncs()
+	return errors.Join(append(wrapServerErrors(baseURLs, errs), saveErr)...)
+}
+
+// uploads returns the secrets of local a sync uploads: stale copies are
+// not uploaded, so that the servers' copies win, and neither are secrets
+// with pending conflicts until they are resolved.
+func uploads(local []Secret, stale, pending map[string]bool) []Secret {
+	if len(stale) == 0 && len(pending) == 0 {
+		return local
+	}
+	return slices.DeleteFunc(slices.Clone(local), func(sec Secret) bool { return stale[sec.ID] || pending[sec.ID] })
+}
+
+// livePrint returns the fingerprint of the live secrets among secrets, as
+// compared with RemoteETag.Fingerprint, and reports whether secrets holds
+// tombstones.
+func livePrint(secrets []Secret) (string, bool) {
+	live := make(map[string]int64, len(secrets))
+	tombstones := false
+	for _, sec := range secrets {
+		if sec.Deleted {
+			tombstones = true
+			continue
+		}
+		live[sec.ID] = sec.Version
+	}
+	return fingerprint.Versions(live), tombstones
+}
+
+// adoptKDF takes the key derivation parameters kdf the server at baseURL
+// holds for the vault if ls has none yet, e.g. on a new device, so that the
+// master password derives the key the other devices encrypted the secrets
+// with. Parameters differing from those of ls are logged: the vault was
+// started on several devices, and the secrets of the others do not
+// decrypt. ls.mu must be held.
+func (ls *LocalStorage) adoptKDF(baseURL string, kdf *KDFParams) {
+	switch {
+	case kdf == nil:
+	case ls.KDF == nil:
+		ls.KDF = kdf
+	case !bytes.Equal(ls.KDF.Salt, kdf.Salt) || ls.KDF.Check != kdf.Check:
+		logger.Warn("the server holds other key derivation parameters; secrets from other devices will not decrypt", zap.String("server", baseURL))
+	}
+}
+
+// wrapServerErrors prefixes the errors of a sync with several servers with
+// the base URL of their server.
+func wrapServerErrors(baseURLs []string, errs []error) []error {
+	if len(baseURLs) == 1 {
+		return errs
+	}
+	wrapped := make([]error, len(errs))
+	for i, err := range errs {
+		if err != nil {
+			wrapped[i] = fmt.Errorf("%s: %w", baseURLs[i], err)
+		}
+	}
+	return wrapped
+}
+
+// mergedSecret is a secret received during a sync with the index of the
+// server it came from; local secrets have the highest index.
+type mergedSecret struct {
+	Secret
+	source int
+}
+
+// newerThan reports whether sec, sent by source, replaces prev of the same
+// version when merging: tombstones replace live secrets, and otherwise
+// the server listed first wins.
+func newerThan(sec Secret, source int, prev mergedSecret) bool {
+	if sec.Deleted != prev.Deleted {
+		return sec.Deleted
+	}
+	return source < prev.source
+}
+
+// newSyncLogEntry describes the outcome of uploading local to the server at
+// baseURL, which answered with res or failed with err.
+func newSyncLogEntry(baseURL string, local []Secret, res *SyncResult, err error) SyncLogEntry {
+	e := SyncLogEntry{Time: time.Now().Unix(), Remote: baseURL}
 	if err != nil {
-		return fmt.Errorf("sync failed: %w", err)
+		e.Error = err.Error()
+		return e
+	}
+	timings := res.Timings
+	e.Timings = &timings
+	e.NotModified = res.NotModified
+
+	known := make(map[string]int64, len(local))
+	changed := make(map[string]bool, len(local))
+	for _, sec := range local {
+		known[sec.ID] = sec.Version
+		changed[sec.ID] = sec.BaseVersion != sec.Version
+		if sec.Deleted {
+			e.Deleted++
+		}
+	}
+	remote := res.Versions
+	for id, version := range remote {
+		if v, ok := known[id]; !ok || version > v {
+			e.Downloaded++
+		}
+	}
+	e.Uploaded = len(res.Updated)
+	if res.Conflicts != nil {
+		e.Conflicts = res.Conflicts
+		return e
+	}
+	// Servers that do not report conflicts skip unchanged secrets too; a
+	// conflict is a local change the server rejected because it has a
+	// newer version.
+	for _, id := range res.Skipped {
+		if remote[id] > known[id] && changed[id] {
+			e.Conflicts = append(e.Conflicts, SyncConflict{ID: id, Version: known[id], ServerVersion: remote[id]})
+		}
+	}
+	return e
+}
+
+// remoteVersion returns the latest version known from the server at
+// baseURL. With a single server it is the version of ls itself.
+func (ls *LocalStorage) remoteVersion(baseURL string, remotes int) int64 {
+	if remotes == 1 {
+		return ls.Version
+	}
+	if r := ls.Remotes[baseURL]; r != nil {
+		return r.Version
+	}
+	return 0
+}
+
+// Sync uploads the secrets of call to the server at baseURL and returns its
+// answer, passing each secret it sends to add. Secrets are encoded one at a
+// time, so the request body is never held in memory as a whole. The secrets
+// received are hashed as they arrive and staged in a temporary file, see
+// spool, and passed to add only once the response is complete and matches
+// its checksum, see jsonstream.Checksum, so that a response truncated or
+// mangled on the way changes nothing. The request carries the checksum of
+// the uploaded secrets likewise. The timings of the exchange are measured
+// along.
+//
+// Only the secrets matching the filter are requested. A non-empty etag is
+// sent as If-None-Match; if the server answers 304 Not Modified, the result
+// has NotModified set and no secrets.
+func (h httpRemote) Sync(baseURL string, call SyncCall, add func(Secret)) (*SyncResult, error) {
+	start := time.Now()
+	body, w := io.Pipe()
+	encoded := make(chan time.Duration, 1)
+	go func() {
+		d, err := encodeSyncRequest(w, call)
+		encoded <- d
+		w.CloseWithError(err)
+	}()
+	// Unblock the encoder if the request body is not read to the end
+	defer body.Close()
+
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/api/sync", body)
+	if err != nil {
+		return nil, fmt.Errorf("sync failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if call.ETag != "" {
+		req.Header.Set("If-None-Match", call.ETag)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sync failed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	result := SyncResult{Versions: map[string]int64{}, ETag: resp.Header.Get("ETag")}
+	if resp.StatusCode == http.StatusNotModified && call.ETag != "" {
+		result.NotModified, result.Version = true, call.LastVersion
+		if result.ETag == "" {
+			result.ETag = call.ETag
+		}
+		_ = body.Close()
+		t := &result.Timings
+		t.Encode = <-encoded
+		t.Server = parseServerTiming(resp.Header.Get(ServerTimingHeader))
+		t.Network = max(time.Since(start)-t.Encode-t.Server, 0)
+		return &result, nil
+	}
 	if resp.StatusCode != http.StatusOK {
-		data, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("server error: %s", strings.TrimSpace(string(data)))
+		return nil, newStatusError(resp)
 	}
 
-	var result struct {
-		Secrets []Secret `json:"secrets"`
-		Version int64    `json:"version"`
+	// decode unmarshals the next value of dec into v, timing the unmarshaling
+	// apart from the reading, which waits for the network.
+	dec := json.NewDecoder(resp.Body)
+	unmarshal := func(raw json.RawMessage, v any) error {
+		t := time.Now()
+		defer func() { result.Timings.Decode += time.Since(t) }()
+		return json.Unmarshal(raw, v)
+	}
+	decode := func(v any) error {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		return unmarshal(raw, v)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return fmt.Errorf("invalid response: %w", err)
+	var (
+		received spool
+		sum      jsonstream.Checksum
+		checksum string
+	)
+	defer received.close()
+	err = jsonstream.Object(dec, func(key string) error {
+		switch key {
+		case "secrets":
+			return jsonstream.Array(dec, func() error {
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return err
+				}
+				if err := sum.Add(raw); err != nil {
+					return err
+				}
+				return received.write(raw)
+			})
+		case "version":
+			return decode(&result.Version)
+		case "updated":
+			return decode(&result.Updated)
+		case "skipped":
+			return decode(&result.Skipped)
+		case "conflicts":
+			return decode(&result.Conflicts)
+		case "restored":
+			return decode(&result.Restored)
+		case "summary":
+			return decode(&result.Summary)
+		case "kdf":
+			return decode(&result.KDF)
+		case "checksum":
+			return decode(&checksum)
+		default:
+			return jsonstream.Skip(dec)
+		}
+	})
+	if err == nil {
+		err = sum.Verify(checksum)
+	}
+	if err == nil {
+		err = received.each(func(raw []byte) error {
+			var sec Secret
+			if err := unmarshal(raw, &sec); err != nil {
+				return err
+			}
+			if !sec.Deleted {
+				result.Versions[sec.ID] = sec.Version
+			}
+			add(sec)
+			return nil
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
 	}
 
-	ls.mu.Lock()
-	ls.Secrets = make([]Secret, len(result.Secrets))
-	copy(ls.Secrets, result.Secrets)
-	ls.Version = result.Version
-	ls.mu.Unlock()
+	_ = body.Close()
+	t := &result.Timings
+	t.Encode = <-encoded
+	t.Server = parseServerTiming(resp.Header.Get(ServerTimingHeader))
+	t.Network = max(time.Since(start)-t.Encode-t.Server-t.Decode, 0)
+	return &result, nil
+}
 
-	return ls.Save()
+// encodeSyncRequest writes the body of the sync request of call to w, with
+// the checksum of the secrets after them, and returns the time spent
+// encoding it, apart from writing, which waits for the network.
+func encodeSyncRequest(w io.Writer, call SyncCall) (time.Duration, error) {
+	var (
+		encoding time.Duration
+		buf      bytes.Buffer
+	)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `{"last_known_version":%d,"include_deleted":true,`, call.LastVersion)
+	if call.KDF != nil {
+		kdf, err := json.Marshal(call.KDF)
+		if err != nil {
+			return 0, err
+		}
+		fmt.Fprintf(bw, `"kdf":%s,`, kdf)
+	}
+	if wire := call.Filter.wire(); wire != nil {
+		f, err := json.Marshal(wire)
+		if err != nil {
+			return 0, err
+		}
+		fmt.Fprintf(bw, `"filter":%s,`, f)
+	}
+	_, _ = bw.WriteString(`"secrets":[`)
+	enc := json.NewEncoder(&buf)
+	var sum jsonstream.Checksum
+	for i, sec := range call.Secrets {
+		buf.Reset()
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		t := time.Now()
+		err := enc.Encode(sec)
+		if err == nil {
+			err = sum.Add(buf.Bytes()[min(i, 1):])
+		}
+		encoding += time.Since(t)
+		if err != nil {
+			return encoding, err
+		}
+		if _, err := bw.Write(buf.Bytes()); err != nil {
+			return encoding, err
+		}
+	}
+	fmt.Fprintf(bw, `],"checksum":%q}`, sum.String())
+	return encoding, bw.Flush()
 }
@@ -2,15 +2,23 @@ package storage
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/jsonstream"
+	"github.com/atinyakov/GophKeeper/internal/limits"
+	"github.com/atinyakov/GophKeeper/internal/problem"
 )
 
 // roundTripperFunc позволяет удобно замокать http.Client.
@@ -35,6 +43,39 @@ func TestSyncWithServer_NetworkError(t *testing.T) {
 	}
 }
 
+func TestAutoSync_StopsWhenCanceled(t *testing.T) {
+	ls := &LocalStorage{}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("network down")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	reports := 0
+	done := make(chan struct{})
+	go func() {
+		AutoSync(ctx, client, []string{"http://example.com"}, ls, RetryPolicy{MaxAttempts: 1}, nil, func(err error, next time.Duration) {
+			reports++
+			if err == nil {
+				t.Error("report got nil error; want the sync error")
+			}
+			if next < syncInterval {
+				t.Errorf("next sync in %s after a failure; want at least %s", next, syncInterval)
+			}
+			cancel()
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("AutoSync did not return after ctx was canceled")
+	}
+	if reports != 1 {
+		t.Errorf("got %d reports; want 1", reports)
+	}
+}
+
 func TestSyncWithServer_ServerError(t *testing.T) {
 	ls := &LocalStorage{}
 	client := newTestClient(func(req *http.Request) (*http.Response, error) {
@@ -49,6 +90,51 @@ func TestSyncWithServer_ServerError(t *testing.T) {
 	}
 }
 
+func TestSyncWithServer_FutureVersion(t *testing.T) {
+	ls := &LocalStorage{}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusUnprocessableEntity,
+			Header:     http.Header{limits.ErrorCodeHeader: {limits.FutureVersionCode}},
+			Body:       io.NopCloser(strings.NewReader("secret s1: version 9999999999 is ahead\n")),
+		}, nil
+	})
+	err := SyncWithServer(client, "http://example.com", ls)
+	if !errors.Is(err, ErrFutureVersion) {
+		t.Errorf("error = %v; want ErrFutureVersion", err)
+	}
+	if IsTransient(err) {
+		t.Error("future version reported as transient")
+	}
+}
+
+func TestSyncWithServer_ProblemDetails(t *testing.T) {
+	ls := &LocalStorage{}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body := `{"type":"about:blank","title":"Unprocessable Entity","status":422,` +
+			`"detail":"secret s1: version 9999999999 is ahead","code":"future-version","request_id":"host/abc-1"}`
+		return &http.Response{
+			StatusCode: http.StatusUnprocessableEntity,
+			Header:     http.Header{"Content-Type": {problem.ContentType}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	err := SyncWithServer(client, "http://example.com", ls)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("error = %v; want a *StatusError", err)
+	}
+	if statusErr.Code != limits.FutureVersionCode || statusErr.RequestID != "host/abc-1" {
+		t.Errorf("error = %+v; want the code and request ID of the problem", statusErr)
+	}
+	if want := "server error: secret s1: version 9999999999 is ahead (request host/abc-1)"; err.Error() != want {
+		t.Errorf("message = %q; want %q", err.Error(), want)
+	}
+	if !errors.Is(err, ErrFutureVersion) {
+		t.Errorf("error = %v; want ErrFutureVersion", err)
+	}
+}
+
 func TestSyncWithServer_InvalidJSON(t *testing.T) {
 	ls := &LocalStorage{}
 	client := newTestClient(func(req *http.Request) (*http.Response, error) {
@@ -63,6 +149,54 @@ func TestSyncWithServer_InvalidJSON(t *testing.T) {
 	}
 }
 
+func TestSyncWithServer_TruncatedResponse(t *testing.T) {
+	ls := &LocalStorage{Secrets: []Secret{{ID: "local", Version: 1}}}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"secrets":[{"id":"s1","version":2}`)),
+		}, nil
+	})
+	err := SyncWithServer(client, "http://example.com", ls)
+	if err == nil || !strings.Contains(err.Error(), "invalid response") {
+		t.Errorf("expected invalid response error, got %v", err)
+	}
+	if len(ls.Secrets) != 1 || ls.Secrets[0].ID != "local" {
+		t.Errorf("secrets = %+v; want the local secrets unchanged", ls.Secrets)
+	}
+}
+
+func TestSyncWithServer_Checksum(t *testing.T) {
+	ls := &LocalStorage{Secrets: []Secret{{ID: "local", Type: "text", Data: "d", Version: 1}}}
+	var sent struct {
+		Secrets  []json.RawMessage `json:"secrets"`
+		Checksum string            `json:"checksum"`
+	}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if err := json.NewDecoder(req.Body).Decode(&sent); err != nil {
+			t.Fatalf("decode request failed: %v", err)
+		}
+		// The checksum of another body, as if the secrets were mangled
+		body := `{"secrets":[{"id":"s1","version":2}],"version":2,"checksum":"crc32c:00000000"}`
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}, nil
+	})
+	err := SyncWithServer(client, "http://example.com", ls)
+	if !errors.Is(err, jsonstream.ErrChecksumMismatch) {
+		t.Errorf("error = %v; want ErrChecksumMismatch", err)
+	}
+	if len(ls.Secrets) != 1 || ls.Secrets[0].ID != "local" {
+		t.Errorf("secrets = %+v; want the local secrets unchanged", ls.Secrets)
+	}
+
+	var sum jsonstream.Checksum
+	for _, raw := range sent.Secrets {
+		_ = sum.Add(raw)
+	}
+	if len(sent.Secrets) != 1 || sent.Checksum != sum.String() {
+		t.Errorf("request checksum = %q of %d secrets; want %q", sent.Checksum, len(sent.Secrets), sum.String())
+	}
+}
+
 func TestSyncWithServer_Success(t *testing.T) {
 	dir := t.TempDir()
 
@@ -106,6 +240,8 @@ func TestSyncWithServer_Success(t *testing.T) {
 		respBody, _ := json.Marshal(map[string]interface{}{
 			"secrets": wantSecrets,
 			"version": nowVersion,
+			"summary": VaultSummary{Types: map[string]int64{"t1": 1}, Folders: map[string]int64{}, Tags: map[string]int64{}, TotalBytes: 2},
+			"kdf":     KDFParams{Salt: []byte("salt"), Time: 1, Memory: 8, Threads: 1, Check: "check"},
 		})
 		return &http.Response{
 			StatusCode: http.StatusOK,
@@ -125,6 +261,12 @@ func TestSyncWithServer_Success(t *testing.T) {
 	if len(ls.Secrets) != 1 || ls.Secrets[0].ID != "s1" {
 		t.Errorf("secrets = %+v; want %+v", ls.Secrets, wantSecrets)
 	}
+	if sum := ls.VaultSummary(); sum == nil || sum.Types["t1"] != 1 || sum.TotalBytes != 2 || sum.Time == 0 {
+		t.Errorf("summary = %+v; want the server's, with the sync time", sum)
+	}
+	if ls.KDF == nil || string(ls.KDF.Salt) != "salt" || ls.KDF.Check != "check" {
+		t.Errorf("kdf = %+v; want the server's", ls.KDF)
+	}
 
 	// Проверим, что файл storage.json действительно записан
 	data, err := os.ReadFile(filepath.Join(dir, "storage.json"))
@@ -136,6 +278,396 @@ func TestSyncWithServer_Success(t *testing.T) {
 		t.Fatalf("unmarshal storage.json failed: %v", err)
 	}
 	if onDisk.Version != nowVersion || len(onDisk.Secrets) != 1 || onDisk.Secrets[0].ID != "s1" {
-		t.Errorf("file content = %+v; want %+v", onDisk, *ls)
+		t.Errorf("file content = %d %+v; want %d %+v", onDisk.Version, onDisk.Secrets, ls.Version, ls.Secrets)
+	}
+}
+
+func TestSyncWithServer_ETag(t *testing.T) {
+	dir := t.TempDir()
+	origDir, _ := os.Getwd()
+	defer func() { _ = os.Chdir(origDir) }()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	const etag = `"1-abc"`
+	server := []Secret{{ID: "s1", Data: "d1", Version: 1}}
+	var uploads []int
+	var matches []string
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		var payload struct {
+			Secrets []Secret `json:"secrets"`
+		}
+		_ = json.NewDecoder(req.Body).Decode(&payload)
+		uploads = append(uploads, len(payload.Secrets))
+		matches = append(matches, req.Header.Get("If-None-Match"))
+
+		// Like the server, only syncs without uploads carry an ETag
+		header := http.Header{}
+		if len(payload.Secrets) == 0 {
+			header.Set("ETag", etag)
+			if req.Header.Get("If-None-Match") == etag {
+				return &http.Response{StatusCode: http.StatusNotModified, Header: header, Body: http.NoBody}, nil
+			}
+		}
+		server = slices.DeleteFunc(server, func(s Secret) bool {
+			return slices.ContainsFunc(payload.Secrets, func(u Secret) bool { return u.ID == s.ID })
+		})
+		server = append(server, payload.Secrets...)
+		body, _ := json.Marshal(map[string]any{"secrets": server, "version": int64(1)})
+		return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(bytes.NewReader(body))}, nil
+	})
+
+	ls := &LocalStorage{Secrets: []Secret{{ID: "s1", Data: "d1", Version: 1}}}
+	for range 3 {
+		if err := SyncWithServer(client, "http://example.com", ls); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// Unchanged secrets are uploaded once; the first sync without uploads
+	// learns the ETag and the next one is answered 304.
+	if want := []int{1, 0, 0}; !slices.Equal(uploads, want) {
+		t.Errorf("uploads = %v; want %v", uploads, want)
+	}
+	if want := []string{"", "", etag}; !slices.Equal(matches, want) {
+		t.Errorf("If-None-Match = %q; want %q", matches, want)
+	}
+	if len(ls.Secrets) != 1 || ls.Secrets[0].ID != "s1" || ls.Version != 1 {
+		t.Errorf("storage = %+v; want s1 kept after 304", ls)
+	}
+
+	// A local change is uploaded in full again
+	ls.Secrets[0].Data, ls.Secrets[0].Version = "d2", 2
+	if err := SyncWithServer(client, "http://example.com", ls); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if uploads[len(uploads)-1] != 1 || matches[len(matches)-1] != "" {
+		t.Errorf("last sync uploaded %d with If-None-Match %q; want a full upload", uploads[len(uploads)-1], matches[len(matches)-1])
+	}
+	if ls.Secrets[0].Data != "d2" {
+		t.Errorf("secrets = %+v; want the edit kept", ls.Secrets)
+	}
+}
+
+func TestSyncWithServer_Filter(t *testing.T) {
+	dir := t.TempDir()
+	origDir, _ := os.Getwd()
+	defer func() { _ = os.Chdir(origDir) }()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	var filter map[string][]string
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		var payload struct {
+			Filter map[string][]string `json:"filter"`
+		}
+		_ = json.NewDecoder(req.Body).Decode(&payload)
+		filter = payload.Filter
+
+		// Like a server that does not know filters, send the whole vault
+		body, _ := json.Marshal(map[string]any{"version": int64(4), "secrets": []Secret{
+			{ID: "w1", Folder: "work/db", Version: 1},
+			{ID: "h1", Folder: "home", Version: 2},
+			{ID: "t1", Tags: []string{"shared"}, Version: 3},
+			{ID: "c1", Type: ChunkType, Version: 4},
+		}})
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body))}, nil
+	})
+
+	ls := &LocalStorage{}
+	ls.SetFilter(SyncFilter{Folders: []string{"work"}, Tags: []string{"shared"}})
+	if err := SyncWithServer(client, "http://example.com", ls); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string][]string{"folders": {"work"}, "tags": {"shared"}, "types": {ChunkType, AliasType}}
+	if !reflect.DeepEqual(filter, want) {
+		t.Errorf("filter sent = %v; want %v", filter, want)
+	}
+	var ids []string
+	for _, sec := range ls.Secrets {
+		ids = append(ids, sec.ID)
+	}
+	if want := []string{"w1", "t1", "c1"}; !slices.Equal(ids, want) {
+		t.Errorf("secrets = %v; want %v", ids, want)
+	}
+
+	// Clearing the filter syncs the whole vault again
+	ls.SetFilter(SyncFilter{})
+	if err := SyncWithServer(client, "http://example.com", ls); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if filter != nil || len(ls.Secrets) != 4 {
+		t.Errorf("filter sent = %v, %d secrets; want no filter and the whole vault", filter, len(ls.Secrets))
+	}
+}
+
+func TestSyncWithServers(t *testing.T) {
+	dir := t.TempDir()
+	origDir, _ := os.Getwd()
+	defer func() { _ = os.Chdir(origDir) }()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	answers := map[string][]Secret{
+		"a.example": {{ID: "s1", Data: "new", Version: 5}},
+		"b.example": {{ID: "s1", Data: "old", Version: 4}, {ID: "s2", Data: "b", Version: 3}},
+	}
+	uploads := map[string]int{}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		var payload struct {
+			Secrets []Secret `json:"secrets"`
+		}
+		_ = json.NewDecoder(req.Body).Decode(&payload)
+		uploads[req.URL.Host] = len(payload.Secrets)
+
+		secrets, ok := answers[req.URL.Host]
+		if !ok {
+			return nil, errors.New("connection refused")
+		}
+		body, _ := json.Marshal(map[string]any{"secrets": secrets, "version": int64(len(secrets))})
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body))}, nil
+	})
+
+	ls := &LocalStorage{Secrets: []Secret{
+		{ID: "s1", Data: "old", Version: 4},
+		{ID: "d1", Version: 2, Deleted: true},
+	}}
+	if err := SyncWithServers(client, []string{"http://a.example", "http://b.example"}, ls); err != nil {
+		t.Fatalf("SyncWithServers returned error: %v", err)
+	}
+
+	if uploads["a.example"] != 2 || uploads["b.example"] != 2 {
+		t.Errorf("uploads = %v; want both servers to receive 2 secrets", uploads)
+	}
+	if len(ls.Secrets) != 2 || ls.Secrets[0].Data != "new" || ls.Secrets[1].ID != "s2" {
+		t.Errorf("secrets = %+v; want the newest s1 and s2", ls.Secrets)
+	}
+	if ls.Remotes["http://a.example"].Version != 1 || ls.Remotes["http://b.example"].Version != 2 {
+		t.Errorf("remotes = %+v; want per-server versions", ls.Remotes)
+	}
+
+	// A failing server keeps local deletions so it receives them later.
+	ls.Secrets = append(ls.Secrets, Secret{ID: "d2", Version: 6, Deleted: true})
+	err := SyncWithServers(client, []string{"http://a.example", "http://down.example"}, ls)
+	if err == nil || !strings.Contains(err.Error(), "down.example") {
+		t.Errorf("error = %v; want the failing server reported", err)
+	}
+	if !slices.ContainsFunc(ls.Secrets, func(s Secret) bool { return s.ID == "d2" && s.Deleted }) {
+		t.Errorf("secrets = %+v; want the deletion of d2 kept", ls.Secrets)
+	}
+}
+
+func TestSyncWithServers_Tombstones(t *testing.T) {
+	dir := t.TempDir()
+	origDir, _ := os.Getwd()
+	defer func() { _ = os.Chdir(origDir) }()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// a knows that d1 was deleted on another device, b does not yet
+	answers := map[string][]Secret{
+		"a.example": {{ID: "s1", Version: 1}, {ID: "d1", Version: 3, Deleted: true}},
+		"b.example": {{ID: "s1", Version: 1}, {ID: "d1", Data: "stale", Version: 3}},
+	}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		var payload struct {
+			Secrets        []Secret `json:"secrets"`
+			IncludeDeleted bool     `json:"include_deleted"`
+		}
+		_ = json.NewDecoder(req.Body).Decode(&payload)
+		if !payload.IncludeDeleted {
+			t.Errorf("request to %s does not ask for tombstones", req.URL.Host)
+		}
+		if req.URL.Host == "b.example" && slices.ContainsFunc(payload.Secrets, func(s Secret) bool { return s.ID == "d1" && s.Deleted }) {
+			answers["b.example"] = answers["a.example"]
+		}
+		body, _ := json.Marshal(map[string]any{"secrets": answers[req.URL.Host], "version": int64(3)})
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body))}, nil
+	})
+	servers := []string{"http://a.example", "http://b.example"}
+
+	ls := &LocalStorage{Secrets: []Secret{{ID: "s1", Version: 1}, {ID: "d1", Data: "stale", Version: 3}}}
+	if err := SyncWithServers(client, servers, ls); err != nil {
+		t.Fatalf("SyncWithServers returned error: %v", err)
+	}
+	// The tombstone wins and is kept for b, which still holds d1
+	if len(ls.Secrets) != 2 || ls.Secrets[1].ID != "d1" || !ls.Secrets[1].Deleted {
+		t.Errorf("secrets = %+v; want s1 and the tombstone of d1", ls.Secrets)
+	}
+	if ls.Get("d1") != nil {
+		t.Errorf("d1 is still readable after its deletion was synced")
+	}
+
+	// Once b received the deletion, the tombstone is dropped
+	if err := SyncWithServers(client, servers, ls); err != nil {
+		t.Fatalf("SyncWithServers returned error: %v", err)
+	}
+	if len(ls.Secrets) != 1 || ls.Secrets[0].ID != "s1" {
+		t.Errorf("secrets = %+v; want only s1", ls.Secrets)
+	}
+}
+
+func TestSyncWithServers_Invalidate(t *testing.T) {
+	dir := t.TempDir()
+	origDir, _ := os.Getwd()
+	defer func() { _ = os.Chdir(origDir) }()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server holds s1 restored to an older state
+	var uploaded []string
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		var payload struct {
+			Secrets []Secret `json:"secrets"`
+		}
+		_ = json.NewDecoder(req.Body).Decode(&payload)
+		uploaded = uploaded[:0]
+		for _, sec := range payload.Secrets {
+			uploaded = append(uploaded, sec.ID)
+		}
+		body, _ := json.Marshal(map[string]any{
+			"secrets": []Secret{{ID: "s1", Data: "restored", Version: 3}, {ID: "s2", Version: 1}},
+			"version": int64(3),
+		})
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body))}, nil
+	})
+
+	ls := &LocalStorage{Secrets: []Secret{
+		{ID: "s1", Data: "edited", Version: 5},
+		{ID: "s2", Version: 1},
+		{ID: "local", Data: "unsynced", Version: 6},
+	}}
+	if err := ls.Save(); err != nil {
+		t.Fatal(err)
+	}
+	ls.Invalidate("s1", "local")
+	if err := SyncWithServer(client, "http://a.example", ls); err != nil {
+		t.Fatalf("SyncWithServer returned error: %v", err)
+	}
+	if !slices.Equal(uploaded, []string{"s2"}) {
+		t.Errorf("uploaded %v; want only s2", uploaded)
+	}
+	if got := ls.Get("s1"); got == nil || got.Data != "restored" || got.Version != 3 {
+		t.Errorf("s1 = %+v; want the server's copy", got)
+	}
+	// A secret no server holds keeps its local copy
+	if got := ls.Get("local"); got == nil || got.Data != "unsynced" {
+		t.Errorf("local = %+v; want the local copy", got)
+	}
+	// The saved vault holds the older copy too
+	saved := &LocalStorage{}
+	if err := saved.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.Get("s1"); got == nil || got.Version != 3 {
+		t.Errorf("saved s1 = %+v; want version 3", got)
+	}
+
+	// The marks are cleared by the sync
+	if err := SyncWithServer(client, "http://a.example", ls); err != nil {
+		t.Fatalf("SyncWithServer returned error: %v", err)
+	}
+	if !slices.Contains(uploaded, "s1") || !slices.Contains(uploaded, "local") {
+		t.Errorf("uploaded %v after the refresh; want s1 and local", uploaded)
+	}
+}
+
+func TestSyncWithServers_Restored(t *testing.T) {
+	dir := t.TempDir()
+	origDir, _ := os.Getwd()
+	defer func() { _ = os.Chdir(origDir) }()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// a was rolled back to a backup with s1 at version 3 and without s2;
+	// b still holds the copies from before and an edit of s3 since
+	answers := map[string]map[string]any{
+		"a.example": {
+			"secrets":  []Secret{{ID: "s1", Data: "restored", Version: 3}, {ID: "s3", Data: "restored", Version: 2}},
+			"restored": []string{"s1", "s2", "s3"},
+		},
+		"b.example": {
+			"secrets": []Secret{{ID: "s1", Data: "lost", Version: 5}, {ID: "s2", Version: 4}, {ID: "s3", Data: "edited", Version: 7}},
+		},
+	}
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body, _ := json.Marshal(answers[req.URL.Host])
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body))}, nil
+	})
+
+	ls := &LocalStorage{Secrets: []Secret{
+		{ID: "s1", Data: "lost", Version: 5, BaseVersion: 5},
+		{ID: "s2", Version: 4, BaseVersion: 4},
+		{ID: "s3", Data: "lost", Version: 5, BaseVersion: 5},
+	}}
+	if err := SyncWithServers(client, []string{"http://a.example", "http://b.example"}, ls); err != nil {
+		t.Fatalf("SyncWithServers returned error: %v", err)
+	}
+
+	// a's copy wins as a local change newer than b's
+	if got := ls.Get("s1"); got == nil || got.Data != "restored" || got.Version <= 5 || got.BaseVersion != 3 {
+		t.Errorf("s1 = %+v; want a's copy as a local change", got)
+	}
+	if !slices.ContainsFunc(ls.Secrets, func(s Secret) bool { return s.ID == "s2" && s.Deleted && s.Version > 4 }) {
+		t.Errorf("secrets = %+v; want a tombstone of s2 newer than b's copy", ls.Secrets)
+	}
+	// b's edit since stays
+	if got := ls.Get("s3"); got == nil || got.Data != "edited" || got.Version != 7 {
+		t.Errorf("s3 = %+v; want b's edit", got)
+	}
+}
+
+func TestSyncWithServers_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	origDir, _ := os.Getwd()
+	defer func() { _ = os.Chdir(origDir) }()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second server answers first with the same version of s1
+	answers := map[string][]Secret{
+		"a.example": {{ID: "s1", Data: "from a", Version: 5}, {ID: "s2", Version: 1}},
+		"b.example": {{ID: "s3", Version: 1}, {ID: "s1", Data: "from b", Version: 5}},
+	}
+	var (
+		mu           sync.Mutex
+		active, peak int
+	)
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		active++
+		peak = max(peak, active)
+		mu.Unlock()
+		defer func() { mu.Lock(); active--; mu.Unlock() }()
+		_, _ = io.Copy(io.Discard, req.Body)
+		if req.URL.Host == "a.example" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		body, _ := json.Marshal(map[string]any{"secrets": answers[req.URL.Host], "version": int64(1)})
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body))}, nil
+	})
+
+	ls := &LocalStorage{}
+	ls.SetTransfers(2)
+	if err := SyncWithServers(client, []string{"http://a.example", "http://b.example"}, ls); err != nil {
+		t.Fatalf("SyncWithServers returned error: %v", err)
+	}
+
+	if peak != 2 {
+		t.Errorf("%d concurrent requests; want 2", peak)
+	}
+	var got []string
+	for _, s := range ls.Secrets {
+		got = append(got, s.ID+"="+s.Data)
+	}
+	if want := []string{"s1=from a", "s2=", "s3="}; !slices.Equal(got, want) {
+		t.Errorf("secrets = %v; want %v, as with sequential syncs", got, want)
 	}
 }
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"slices"
+	"strings"
+)
+
+// SyncFilter subscribes a device to part of the vault: only secrets filed
+// under one of Folders, or a subfolder of it, or carrying one of Tags are
+// synced to it. Attachment chunks and the alias map are always synced, as
+// they carry no folder or tags. The zero filter syncs the whole vault.
+type SyncFilter struct {
+	Folders []string `json:"folders,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// Empty reports whether the filter syncs the whole vault.
+func (f SyncFilter) Empty() bool {
+	return len(f.Folders) == 0 && len(f.Tags) == 0
+}
+
+// Match reports whether sec is part of the synced subset.
+func (f SyncFilter) Match(sec Secret) bool {
+	if f.Empty() || isInternalType(sec.Type) {
+		return true
+	}
+	for _, folder := range f.Folders {
+		if sec.Folder == folder || strings.HasPrefix(sec.Folder, folder+"/") {
+			return true
+		}
+	}
+	return slices.ContainsFunc(sec.Tags, func(tag string) bool { return slices.Contains(f.Tags, tag) })
+}
+
+// String describes the filter for the sync filter command.
+func (f SyncFilter) String() string {
+	if f.Empty() {
+		return "whole vault"
+	}
+	var parts []string
+	for _, folder := range f.Folders {
+		parts = append(parts, "folder "+folder)
+	}
+	for _, tag := range f.Tags {
+		parts = append(parts, "tag "+tag)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// wire returns the filter as sent in sync requests, or nil for the whole
+// vault.
+func (f SyncFilter) wire() map[string][]string {
+	if f.Empty() {
+		return nil
+	}
+	return map[string][]string{"folders": f.Folders, "tags": f.Tags, "types": {ChunkType, AliasType}}
+}
+
+// Filter returns the sync filter of ls.
+func (ls *LocalStorage) Filter() SyncFilter {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.SyncFilter == nil {
+		return SyncFilter{}
+	}
+	return *ls.SyncFilter
+}
+
+// SetFilter subscribes ls to the part of the vault matched by f. Secrets
+// outside it are dropped from the local store with the next sync; the
+// zero filter subscribes to the whole vault again.
+func (ls *LocalStorage) SetFilter(f SyncFilter) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if f.Empty() {
+		ls.SyncFilter = nil
+		return
+	}
+	ls.SyncFilter = &f
+}
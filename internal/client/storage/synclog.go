@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// SyncLogEntry records the outcome of one sync with one server.
+type SyncLogEntry struct {
+	Time       int64          `json:"time"`                // Unix time of the sync
+	Remote     string         `json:"remote"`              // server base URL
+	Uploaded   int            `json:"uploaded"`            // secrets accepted by the server
+	Deleted    int            `json:"deleted"`             // deletions sent to the server
+	Downloaded int            `json:"downloaded"`          // new or changed secrets received
+	Conflicts  []SyncConflict `json:"conflicts,omitempty"` // secrets the server kept a newer version of
+	Error      string         `json:"error,omitempty"`     // error of a failed sync
+	// NotModified reports that the server had no changes and nothing was
+	// uploaded.
+	NotModified bool `json:"not_modified,omitempty"`
+	// Timings breaks down the duration of a successful sync.
+	Timings *SyncTimings `json:"timings,omitempty"`
+}
+
+// SyncConflict describes a local change the server rejected because it
+// holds a newer version of the secret, e.g. one edited on another device,
+// or because the secret was changed on the server too since the last sync.
+type SyncConflict struct {
+	ID             string `json:"id"`
+	Version        int64  `json:"version"`         // local version uploaded
+	ServerVersion  int64  `json:"server_version"`  // version the server kept
+	ServerModified int64  `json:"server_modified"` // Unix time the server stored it, 0 if unknown
+	// Concurrent reports a secret changed both locally and on the server
+	// since the last sync. The server kept its version; both versions are
+	// carried along for resolving the conflict.
+	Concurrent bool     `json:"concurrent,omitempty"`
+	Client     *Secret  `json:"client,omitempty"`  // local version uploaded, if Concurrent
+	Server     *Secret  `json:"server,omitempty"`  // version the server kept, if Concurrent
+	Changed    []string `json:"changed,omitempty"` // metadata fields that differ, if Concurrent
+}
+
+// UnmarshalJSON also accepts a bare secret ID, as logged by earlier
+// versions.
+func (c *SyncConflict) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		*c = SyncConflict{}
+		return json.Unmarshal(b, &c.ID)
+	}
+	type plain SyncConflict
+	return json.Unmarshal(b, (*plain)(c))
+}
+
+// String describes the conflict for the sync log.
+func (c SyncConflict) String() string {
+	if c.ServerVersion == 0 {
+		return c.ID
+	}
+	s := fmt.Sprintf("%s (local v%d, server v%d", c.ID, c.Version, c.ServerVersion)
+	if c.ServerModified != 0 {
+		s += ", stored " + time.Unix(c.ServerModified, 0).Format(time.DateTime)
+	}
+	if c.Concurrent {
+		s += ", edited on both"
+	}
+	return s + ")"
+}
+
+// SetSyncLog makes syncs of ls append their outcome to the log file at path.
+func (ls *LocalStorage) SetSyncLog(path string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.syncLog = path
+}
+
+// logSync appends e to the sync log, if one is set. Failing to write the
+// log does not fail the sync.
+func (ls *LocalStorage) logSync(e SyncLogEntry) {
+	ls.mu.Lock()
+	path := ls.syncLog
+	ls.mu.Unlock()
+	if path == "" {
+		return
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_ = json.NewEncoder(f).Encode(e)
+}
+
+// ReadSyncLog returns the last n entries of the sync log at path, oldest
+// first; n <= 0 returns all. A missing log has no entries.
+func ReadSyncLog(path string, n int) ([]SyncLogEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []SyncLogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e SyncLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("invalid sync log entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if n > 0 && len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	return entries, nil
+}
+
+// PrintSyncLog writes entries to w, one line each.
+func PrintSyncLog(w io.Writer, entries []SyncLogEntry) {
+	for _, e := range entries {
+		ts := time.Unix(e.Time, 0).Format(time.DateTime)
+		if e.Error != "" {
+			fmt.Fprintf(w, "%s  %s  error: %s\n", ts, e.Remote, e.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%s  %s  uploaded %d, deleted %d, downloaded %d",
+			ts, e.Remote, e.Uploaded, e.Deleted, e.Downloaded)
+		if len(e.Conflicts) > 0 {
+			conflicts := make([]string, len(e.Conflicts))
+			for i, c := range e.Conflicts {
+				conflicts[i] = c.String()
+			}
+			fmt.Fprintf(w, ", conflicts: %s", strings.Join(conflicts, ", "))
+		}
+		if e.NotModified {
+			fmt.Fprint(w, ", not modified")
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sync.log")
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "down.example" {
+			return nil, errors.New("connection refused")
+		}
+		body, _ := json.Marshal(map[string]any{
+			"secrets": []Secret{{ID: "s1", Version: 9}, {ID: "s2", Version: 1}, {ID: "s3", Version: 2}},
+			"version": 9,
+			"updated": []string{"s2"},
+			"skipped": []string{"s1", "s3"},
+		})
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body))}, nil
+	})
+
+	ls := &LocalStorage{Secrets: []Secret{
+		{ID: "s1", Version: 5},
+		{ID: "s2", Version: 1},
+		{ID: "s3", Version: 2},
+		{ID: "d1", Version: 3, Deleted: true},
+	}}
+	ls.SetSyncLog(path)
+
+	origDir, _ := os.Getwd()
+	defer func() { _ = os.Chdir(origDir) }()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	_ = SyncWithServers(client, []string{"http://a.example", "http://down.example"}, ls)
+
+	entries, err := ReadSyncLog(path, 0)
+	if err != nil {
+		t.Fatalf("ReadSyncLog returned error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries; want 2", len(entries))
+	}
+	e := entries[0]
+	if e.Remote != "http://a.example" || e.Uploaded != 1 || e.Deleted != 1 || e.Downloaded != 1 ||
+		len(e.Conflicts) != 1 || e.Conflicts[0].ID != "s1" {
+		t.Errorf("entry = %+v; want 1 uploaded, 1 deleted, 1 downloaded and conflict s1", e)
+	}
+	if !strings.Contains(entries[1].Error, "connection refused") {
+		t.Errorf("entry = %+v; want the connection error", entries[1])
+	}
+
+	if last, _ := ReadSyncLog(path, 1); len(last) != 1 || last[0].Remote != "http://down.example" {
+		t.Errorf("ReadSyncLog(1) = %+v; want the last entry", last)
+	}
+
+	var buf strings.Builder
+	PrintSyncLog(&buf, entries)
+	if !strings.Contains(buf.String(), "uploaded 1, deleted 1, downloaded 1, conflicts: s1 (local v5, server v9)") {
+		t.Errorf("PrintSyncLog output = %q", buf.String())
+	}
+}
+
+func TestSyncLog_ServerConflicts(t *testing.T) {
+	conflict := SyncConflict{ID: "s1", Version: 5, ServerVersion: 9, ServerModified: 1700000000}
+	res := &SyncResult{
+		Versions:  map[string]int64{},
+		Skipped:   []string{"s1", "s2"},
+		Conflicts: []SyncConflict{conflict},
+	}
+	e := newSyncLogEntry("http://a.example", []Secret{{ID: "s1", Version: 5}, {ID: "s2", Version: 3}}, res, nil)
+	if len(e.Conflicts) != 1 || !reflect.DeepEqual(e.Conflicts[0], conflict) {
+		t.Errorf("conflicts = %+v; want the ones reported by the server", e.Conflicts)
+	}
+	want := "s1 (local v5, server v9, stored " + time.Unix(1700000000, 0).Format(time.DateTime) + ")"
+	if got := conflict.String(); got != want {
+		t.Errorf("String() = %q; want %q", got, want)
+	}
+
+	concurrent := SyncConflict{ID: "s2", Version: 4, ServerVersion: 3, Concurrent: true}
+	if got, want := concurrent.String(), "s2 (local v4, server v3, edited on both)"; got != want {
+		t.Errorf("String() = %q; want %q", got, want)
+	}
+}
+
+func TestReadSyncLog_OldConflicts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sync.log")
+	if err := os.WriteFile(path, []byte(`{"time":1,"remote":"http://a.example","conflicts":["s1"]}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ReadSyncLog(path, 0)
+	if err != nil {
+		t.Fatalf("ReadSyncLog returned error: %v", err)
+	}
+	if len(entries) != 1 || len(entries[0].Conflicts) != 1 || entries[0].Conflicts[0].String() != "s1" {
+		t.Errorf("entries = %+v; want the conflict s1", entries)
+	}
+}
+
+func TestReadSyncLog_Missing(t *testing.T) {
+	entries, err := ReadSyncLog(filepath.Join(t.TempDir(), "none.log"), 10)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("ReadSyncLog(missing) = %v, %v; want no entries", entries, err)
+	}
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerTimingHeader is the response header in which the server reports
+// how long it took to process a sync, in the Server-Timing format.
+const ServerTimingHeader = "Server-Timing"
+
+// SyncTimings breaks the duration of a sync with one server down by layer,
+// to tell whether a slow sync is due to the client, the network or the
+// server.
+type SyncTimings struct {
+	// Encode is the time spent encoding the request.
+	Encode time.Duration `json:"encode"`
+	// Network is the time spent transferring the request and the response,
+	// i.e. the rest of the exchange with the server.
+	Network time.Duration `json:"network"`
+	// Server is the processing time reported by the server.
+	Server time.Duration `json:"server"`
+	// Decode is the time spent decoding the response.
+	Decode time.Duration `json:"decode"`
+	// Merge is the time spent merging the answers of all servers.
+	Merge time.Duration `json:"merge"`
+	// Persist is the time spent saving the local store.
+	Persist time.Duration `json:"persist"`
+}
+
+// Total returns the sum of all timings.
+func (t SyncTimings) Total() time.Duration {
+	return t.Encode + t.Network + t.Server + t.Decode + t.Merge + t.Persist
+}
+
+// String formats the timings on one line.
+func (t SyncTimings) String() string {
+	ms := func(d time.Duration) string {
+		return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 1, 64) + "ms"
+	}
+	return fmt.Sprintf("total %s: encode %s, network %s, server %s, decode %s, merge %s, persist %s",
+		ms(t.Total()), ms(t.Encode), ms(t.Network), ms(t.Server), ms(t.Decode), ms(t.Merge), ms(t.Persist))
+}
+
+// PrintSyncTimings writes the timings of entries to w, one line each.
+func PrintSyncTimings(w io.Writer, entries []SyncLogEntry) {
+	for _, e := range entries {
+		if e.Timings == nil {
+			continue
+		}
+		ts := time.Unix(e.Time, 0).Format(time.DateTime)
+		fmt.Fprintf(w, "%s  %s  %s\n", ts, e.Remote, e.Timings)
+	}
+}
+
+// parseServerTiming returns the sum of the durations in a Server-Timing
+// header value, ignoring malformed metrics.
+func parseServerTiming(v string) time.Duration {
+	var total time.Duration
+	for _, metric := range strings.Split(v, ",") {
+		for _, param := range strings.Split(metric, ";")[1:] {
+			name, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || name != "dur" {
+				continue
+			}
+			if ms, err := strconv.ParseFloat(strings.Trim(val, `"`), 64); err == nil && ms >= 0 {
+				total += time.Duration(ms * float64(time.Millisecond))
+			}
+		}
+	}
+	return total
+}
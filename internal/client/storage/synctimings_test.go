@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseServerTiming(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 0},
+		{"app;dur=12.5", 12500 * time.Microsecond},
+		{`db;dur=3, app;desc="sync";dur="2"`, 5 * time.Millisecond},
+		{"cache;desc=hit, app;dur=oops", 0},
+	}
+	for _, tt := range tests {
+		if got := parseServerTiming(tt.in); got != tt.want {
+			t.Errorf("parseServerTiming(%q) = %s; want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSyncWithServer_Timings(t *testing.T) {
+	dir := t.TempDir()
+	origDir, _ := os.Getwd()
+	defer func() { _ = os.Chdir(origDir) }()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		_, _ = io.Copy(io.Discard, req.Body)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{ServerTimingHeader: {"app;dur=25"}},
+			Body:       io.NopCloser(strings.NewReader(`{"secrets":[{"id":"s1","version":1}],"version":1}`)),
+		}, nil
+	})
+	ls := &LocalStorage{Secrets: []Secret{{ID: "local", Version: 1}}}
+	ls.SetSyncLog("sync.log")
+	if err := SyncWithServer(client, "http://example.com", ls); err != nil {
+		t.Fatalf("SyncWithServer returned error: %v", err)
+	}
+
+	entries, err := ReadSyncLog("sync.log", 0)
+	if err != nil || len(entries) != 1 || entries[0].Timings == nil {
+		t.Fatalf("sync log = %+v, %v; want one entry with timings", entries, err)
+	}
+	tm := entries[0].Timings
+	if tm.Server != 25*time.Millisecond {
+		t.Errorf("server timing = %s; want 25ms", tm.Server)
+	}
+	if tm.Persist <= 0 || tm.Total() < tm.Server {
+		t.Errorf("timings = %+v; want persist and total measured", tm)
+	}
+	if s := tm.String(); !strings.Contains(s, "server 25.0ms") {
+		t.Errorf("String() = %q", s)
+	}
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/atinyakov/GophKeeper/internal/jsonstream"
+)
+
+// Takeout downloads everything the server stores about the user from the
+// server's /api/export endpoint to w: the secrets as stored, i.e. with
+// encrypted payloads and including the tombstones of deleted secrets, the
+// devices and the audit trail. The export is checked to be complete as it
+// is written, since the server cuts it short if it fails midway, and to
+// match its checksum, see jsonstream.Checksum. It returns the number of
+// secrets exported.
+func Takeout(client *http.Client, baseURL string, w io.Writer) (int, error) {
+	resp, err := client.Get(baseURL + "/api/export")
+	if err != nil {
+		return 0, fmt.Errorf("export request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, newStatusError(resp)
+	}
+
+	var (
+		n        int
+		sum      jsonstream.Checksum
+		checksum string
+	)
+	dec := json.NewDecoder(io.TeeReader(resp.Body, w))
+	err = jsonstream.Object(dec, func(key string) error {
+		switch key {
+		case "secrets":
+			return jsonstream.Array(dec, func() error {
+				n++
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return err
+				}
+				return sum.Add(raw)
+			})
+		case "checksum":
+			return dec.Decode(&checksum)
+		default:
+			return jsonstream.Skip(dec)
+		}
+	})
+	if err == nil {
+		err = sum.Verify(checksum)
+	}
+	if err != nil {
+		return n, fmt.Errorf("incomplete export: %w", err)
+	}
+	// Copy what the decoder has not read yet, i.e. the final newline
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return n, err
+	}
+	return n, nil
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/atinyakov/GophKeeper/internal/jsonstream"
+)
+
+func TestTakeout(t *testing.T) {
+	body := `{"secrets":[{"id":"a","version":1},{"id":"b","version":2,"deleted":true}],"audit":[],"devices":[],"exported_at":1000,"user":"alice"}` + "\n"
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodGet || req.URL.String() != "http://example.com/api/export" {
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL)
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}, nil
+	})
+
+	var buf bytes.Buffer
+	n, err := Takeout(client, "http://example.com", &buf)
+	if err != nil {
+		t.Fatalf("Takeout returned error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("Takeout = %d secrets; want 2", n)
+	}
+	if buf.String() != body {
+		t.Errorf("written %q; want the export as received", buf.String())
+	}
+}
+
+func TestTakeout_Truncated(t *testing.T) {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body := `{"secrets":[{"id":"a","version":1},`
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}, nil
+	})
+
+	if _, err := Takeout(client, "http://example.com", io.Discard); err == nil || !strings.Contains(err.Error(), "incomplete export") {
+		t.Errorf("Takeout = %v; want incomplete export error", err)
+	}
+}
+
+func TestTakeout_ChecksumMismatch(t *testing.T) {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body := `{"secrets":[{"id":"a","version":1}],"checksum":"crc32c:00000000","user":"alice"}`
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}, nil
+	})
+
+	if _, err := Takeout(client, "http://example.com", io.Discard); !errors.Is(err, jsonstream.ErrChecksumMismatch) {
+		t.Errorf("Takeout = %v; want ErrChecksumMismatch", err)
+	}
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// TemplateField describes one field of a structured secret payload.
+type TemplateField struct {
+	Name      string `json:"name"`                // key in the payload
+	Label     string `json:"label"`               // prompt shown to the user
+	Optional  bool   `json:"optional,omitempty"`  // may be left empty
+	Multiline bool   `json:"multiline,omitempty"` // read until a "." line, see ReadMultiline
+}
+
+// Template describes the payload layout of a secret type. Secrets created
+// from a template store their data as a JSON object keyed by field name,
+// so all entries of a kind have consistent fields.
+type Template struct {
+	Type        string          `json:"type"`
+	Description string          `json:"description"`
+	Fields      []TemplateField `json:"fields"`
+}
+
+// Templates maps secret types to their templates.
+type Templates map[string]Template
+
+// builtinTemplates are the templates available without configuration.
+var builtinTemplates = []Template{
+	{
+		Type:        "login_password",
+		Description: "Login and password",
+		Fields: []TemplateField{
+			{Name: "login", Label: "Login", Optional: true},
+			{Name: "password", Label: "Password"},
+			{Name: "url", Label: "URL", Optional: true},
+		},
+	},
+	{
+		Type:        "card",
+		Description: "Bank card",
+		Fields: []TemplateField{
+			{Name: "number", Label: "Card number"},
+			{Name: "holder", Label: "Card holder"},
+			{Name: "expiry", Label: "Expiry (MM/YY)"},
+			{Name: "cvv", Label: "CVV"},
+		},
+	},
+	{
+		Type:        "wifi",
+		Description: "Wi-Fi network",
+		Fields: []TemplateField{
+			{Name: "ssid", Label: "Network name (SSID)"},
+			{Name: "password", Label: "Password", Optional: true},
+			{Name: "security", Label: "Security (WPA2/WPA3/WEP/none)", Optional: true},
+			{Name: "hidden", Label: "Hidden network (yes/no)", Optional: true},
+		},
+	},
+	{
+		Type:        "ssh-key",
+		Description: "SSH key pair",
+		Fields: []TemplateField{
+			{Name: "private_key", Label: "Private key", Multiline: true},
+			{Name: "public_key", Label: "Public key", Optional: true},
+			{Name: "passphrase", Label: "Passphrase", Optional: true},
+		},
+	},
+	{
+		Type:        "api-token",
+		Description: "API token",
+		Fields: []TemplateField{
+			{Name: "service", Label: "Service"},
+			{Name: "token", Label: "Token"},
+			{Name: "url", Label: "URL", Optional: true},
+		},
+	},
+	{
+		Type:        "database",
+		Description: "Database connection",
+		Fields: []TemplateField{
+			{Name: "dsn", Label: "DSN (e.g. postgres://host:5432/db)"},
+			{Name: "user", Label: "User", Optional: true},
+			{Name: "password", Label: "Password", Optional: true},
+		},
+	},
+}
+
+// BuiltinTemplates returns the built-in templates.
+func BuiltinTemplates() Templates {
+	t := make(Templates, len(builtinTemplates))
+	for _, tmpl := range builtinTemplates {
+		t[tmpl.Type] = tmpl
+	}
+	return t
+}
+
+// LoadTemplates returns the built-in templates merged with user-defined
+// templates read from the JSON file at path (an array of Template).
+// User templates replace built-in templates of the same type. A missing
+// file is not an error.
+func LoadTemplates(path string) (Templates, error) {
+	t := BuiltinTemplates()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates: %w", err)
+	}
+
+	var user []Template
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, fmt.Errorf("failed to parse templates: %w", err)
+	}
+	for _, tmpl := range user {
+		if tmpl.Type == "" || len(tmpl.Fields) == 0 {
+			return nil, fmt.Errorf("invalid template %q: type and fields are required", tmpl.Type)
+		}
+		t[tmpl.Type] = tmpl
+	}
+	return t, nil
+}
+
+// Types returns the template types in sorted order.
+func (t Templates) Types() []string {
+	return slices.Sorted(maps.Keys(t))
+}
+
+// Print writes the templates and their fields to w.
+func (t Templates) Print(w io.Writer) {
+	for _, typ := range t.Types() {
+		tmpl := t[typ]
+		fmt.Fprintf(w, "%s: %s\n", typ, tmpl.Description)
+		for _, f := range tmpl.Fields {
+			opt := ""
+			if f.Optional {
+				opt = " (optional)"
+			}
+			fmt.Fprintf(w, "  %s - %s%s\n", f.Name, f.Label, opt)
+		}
+	}
+}
+
+// PromptFields asks for each field of tmpl and returns the JSON-encoded
+// payload. Required fields are asked again until they are non-empty.
+func PromptFields(scanner *bufio.Scanner, tmpl Template) ([]byte, error) {
+	values := make(map[string]string, len(tmpl.Fields))
+	for _, f := range tmpl.Fields {
+		for {
+			var v string
+			if f.Multiline {
+				fmt.Printf("%s. %s\n", f.Label, multilineHint)
+				text, eof := readMultiline(scanner)
+				v = strings.TrimSpace(text)
+				if v == "" && !f.Optional && eof {
+					return nil, fmt.Errorf("input ended before field %q", f.Name)
+				}
+			} else {
+				fmt.Printf("%s: ", f.Label)
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("input ended before field %q", f.Name)
+				}
+				v = strings.TrimSpace(scanner.Text())
+			}
+			if v != "" || f.Optional {
+				if v != "" {
+					values[f.Name] = v
+				}
+				break
+			}
+			fmt.Printf("%s is required\n", f.Label)
+		}
+	}
+	return json.Marshal(values)
+}
+
+// PromptEditFields asks for the new fields of a secret created from tmpl,
+// see PromptFields, and for its new comment.
+func PromptEditFields(tmpl Template) (data []byte, comment string, err error) {
+	scanner := StdinScanner()
+	data, err = PromptFields(scanner, tmpl)
+	if err != nil {
+		return nil, "", err
+	}
+	fmt.Print("Enter new comment: ")
+	scanner.Scan()
+	return data, scanner.Text(), nil
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTemplates(t *testing.T) {
+	tmp := t.TempDir()
+
+	// Missing file: built-in templates only.
+	got, err := LoadTemplates(filepath.Join(tmp, "missing.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, typ := range []string{"card", "wifi", "ssh-key", "api-token", "database"} {
+		if _, ok := got[typ]; !ok {
+			t.Errorf("built-in template %q missing", typ)
+		}
+	}
+
+	// User templates add new types and replace built-in ones.
+	path := filepath.Join(tmp, "templates.json")
+	user := `[
+		{"type":"license","description":"Software license","fields":[{"name":"key","label":"License key"}]},
+		{"type":"card","description":"Custom card","fields":[{"name":"number","label":"Number"}]}
+	]`
+	if err := os.WriteFile(path, []byte(user), 0600); err != nil {
+		t.Fatalf("failed to write templates: %v", err)
+	}
+	got, err = LoadTemplates(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got["license"].Description != "Software license" {
+		t.Errorf("user template not loaded: %+v", got["license"])
+	}
+	if len(got["card"].Fields) != 1 {
+		t.Errorf("card template not replaced: %+v", got["card"])
+	}
+
+	// Templates without fields are rejected.
+	if err := os.WriteFile(path, []byte(`[{"type":"empty"}]`), 0600); err != nil {
+		t.Fatalf("failed to write templates: %v", err)
+	}
+	if _, err := LoadTemplates(path); err == nil {
+		t.Error("expected error for template without fields")
+	}
+}
+
+func TestTemplates_Print(t *testing.T) {
+	var buf bytes.Buffer
+	BuiltinTemplates().Print(&buf)
+	out := buf.String()
+	for _, want := range []string{"wifi: Wi-Fi network", "ssid - Network name (SSID)", "password - Password (optional)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q: %q", want, out)
+		}
+	}
+}
+
+func TestPromptFields(t *testing.T) {
+	tmpl := BuiltinTemplates()["wifi"]
+	// The required SSID is asked again after an empty answer; the optional
+	// security and hidden fields are left empty.
+	scanner := bufio.NewScanner(strings.NewReader("\nhome\nhunter2\n\n\n"))
+
+	payload, err := PromptFields(scanner, tmpl)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(payload, &got); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if len(got) != 2 || got["ssid"] != "home" || got["password"] != "hunter2" {
+		t.Errorf("payload = %v", got)
+	}
+
+	if _, err := PromptFields(bufio.NewScanner(strings.NewReader("")), tmpl); err == nil {
+		t.Error("expected error on premature end of input")
+	}
+}
+
+func TestPromptForSecret_Template(t *testing.T) {
+	oldIn := os.Stdin
+	defer func() { os.Stdin = oldIn }()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.WriteString("card\nsalary card\n\n4111111111111111\nALICE\n12/30\n123\n")
+	w.Close()
+	os.Stdin = r
+
+	sec, err := PromptForSecret(fakeAEADPromt{}, BuiltinTemplates())
+	if err != nil {
+		t.Fatalf("PromptForSecret returned error: %v", err)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(sec.Data)
+	if err != nil {
+		t.Fatalf("failed to decode Data: %v", err)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(decoded, &got); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if got["number"] != "4111111111111111" || got["cvv"] != "123" || sec.Type != "card" {
+		t.Errorf("secret = %+v, payload = %v", sec, got)
+	}
+}
+
+func TestPromptFields_Multiline(t *testing.T) {
+	tmpl := BuiltinTemplates()["ssh-key"]
+	input := "-----BEGIN KEY-----\nabc\n-----END KEY-----\n.\nssh-ed25519 AAA\n\n"
+
+	payload, err := PromptFields(bufio.NewScanner(strings.NewReader(input)), tmpl)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(payload, &got); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if got["private_key"] != "-----BEGIN KEY-----\nabc\n-----END KEY-----" || got["public_key"] != "ssh-ed25519 AAA" {
+		t.Errorf("payload = %v", got)
+	}
+}
@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/atinyakov/GophKeeper/internal/client/keystore"
+)
+
+// SystemCA is the CA file name that selects the operating system's root
+// certificates, for servers with publicly trusted certificates.
+const SystemCA = "system"
+
+// ClientOption customizes the HTTP clients built by LoadClientCertificate
+// and Register.
+type ClientOption func(*clientOptions)
+
+// Timeouts configures the timeouts and connection reuse of the client.
+type Timeouts struct {
+	// Request limits a whole request, including reading the response;
+	// 0 means no limit. Large first syncs on slow links need a generous value.
+	Request time.Duration
+	// TLSHandshake limits the TLS handshake.
+	TLSHandshake time.Duration
+	// IdleConn is how long idle keep-alive connections are kept open.
+	IdleConn time.Duration
+	// MaxIdleConns limits the idle keep-alive connections to the server.
+	MaxIdleConns int
+}
+
+// DefaultTimeouts are the timeouts used unless WithTimeouts is given.
+var DefaultTimeouts = Timeouts{
+	Request:      2 * time.Minute,
+	TLSHandshake: 10 * time.Second,
+	IdleConn:     90 * time.Second,
+	MaxIdleConns: 2,
+}
+
+// clientOptions collects the settings applied by ClientOption values.
+type clientOptions struct {
+	// timeouts configures the timeouts of the client.
+	timeouts Timeouts
+	// proxy is the proxy for all requests; nil uses the HTTP_PROXY,
+	// HTTPS_PROXY and NO_PROXY environment variables.
+	proxy *url.URL
+	// caBundle is a PEM file with additional trusted CA certificates.
+	caBundle string
+	// pins holds the SPKI pins of servers; nil disables pinning.
+	pins *PinStore
+	// trustOnFirstUse pins servers without pins on the first connection.
+	trustOnFirstUse bool
+	// passphrase unlocks an encrypted client key, or protects a new one.
+	passphrase PassphraseFunc
+	// rateLimit caps the transfer rate in bytes per second; 0 means no cap.
+	rateLimit int64
+	// transport is the protocol of registrations, see WithTransport.
+	transport Transport
+	// remote replaces the client built for registrations, see WithRemote.
+	remote Remote
+	// keystore holds the keys that cannot be exported, see WithKeystore.
+	keystore keystore.Store
+	// certFile and keyFile are where Register and Recover save the issued
+	// certificate and key, see WithCredentialFiles.
+	certFile, keyFile string
+}
+
+// newClientOptions applies opts to the default options.
+func newClientOptions(opts []ClientOption) clientOptions {
+	o := clientOptions{timeouts: DefaultTimeouts, certFile: CertFile, keyFile: KeyFile}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithProxy sends all requests through the given HTTP(S) or SOCKS5 proxy
+// instead of the one configured in the environment.
+func WithProxy(u *url.URL) ClientOption {
+	return func(o *clientOptions) {
+		o.proxy = u
+	}
+}
+
+// WithPassphrase sets how the client key passphrase is obtained: to
+// decrypt the key in LoadClientCertificate, and to encrypt the key saved by
+// Register, which stores it unencrypted if the passphrase is empty.
+func WithPassphrase(fn PassphraseFunc) ClientOption {
+	return func(o *clientOptions) {
+		o.passphrase = fn
+	}
+}
+
+// WithCredentialFiles sets where Register and Recover save the issued
+// certificate and key; they default to CertFile and KeyFile in the working
+// directory.
+func WithCredentialFiles(certFile, keyFile string) ClientOption {
+	return func(o *clientOptions) {
+		o.certFile, o.keyFile = certFile, keyFile
+	}
+}
+
+// WithCABundle trusts all CA certificates in the given PEM file, in
+// addition to the CA file passed to LoadClientCertificate or Register.
+func WithCABundle(path string) ClientOption {
+	return func(o *clientOptions) {
+		o.caBundle = path
+	}
+}
+
+// WithTimeouts sets the timeouts and keep-alive settings of the client.
+func WithTimeouts(t Timeouts) ClientOption {
+	return func(o *clientOptions) {
+		o.timeouts = t
+	}
+}
+
+// WithRateLimit caps the combined upload and download rate of all
+// requests at bytesPerSecond, so that large syncs do not saturate the link.
+// 0 means no cap.
+func WithRateLimit(bytesPerSecond int64) ClientOption {
+	return func(o *clientOptions) {
+		o.rateLimit = bytesPerSecond
+	}
+}
+
+// ParseProxy parses a proxy URL such as "http://proxy:3128" or
+// "socks5://127.0.0.1:1080".
+func ParseProxy(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q: scheme must be http, https, socks5 or socks5h", s)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", s)
+	}
+	return u, nil
+}
+
+// ParseServerURL parses a server base URL such as
+// "https://keeper.example.com:8080", returning it without a trailing slash.
+func ParseServerURL(s string) (string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", fmt.Errorf("invalid server URL %q: scheme must be https or http", s)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid server URL %q: missing host", s)
+	}
+	return strings.TrimRight(s, "/"), nil
+}
+
+// client returns an HTTP client using tlsConfig and the options.
+func (o clientOptions) client(tlsConfig *tls.Config) *http.Client {
+	proxy := http.ProxyFromEnvironment
+	if o.proxy != nil {
+		proxy = http.ProxyURL(o.proxy)
+	}
+	transport := &http.Transport{
+		Proxy:               proxy,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: o.timeouts.TLSHandshake,
+		IdleConnTimeout:     o.timeouts.IdleConn,
+		MaxIdleConns:        o.timeouts.MaxIdleConns,
+		MaxIdleConnsPerHost: o.timeouts.MaxIdleConns,
+		ForceAttemptHTTP2:   o.transport == TransportGRPC,
+	}
+	var rt http.RoundTripper = transport
+	if o.pins != nil {
+		rt = &pinningTransport{base: transport, o: o, hosts: map[string]*http.Transport{}}
+	}
+	if o.rateLimit > 0 {
+		rt = &rateLimitTransport{base: rt, limiter: newRateLimiter(o.rateLimit)}
+	}
+	if logger.Core().Enabled(zapcore.DebugLevel) {
+		rt = &logTransport{base: rt}
+	}
+	return &http.Client{Transport: rt, Timeout: o.timeouts.Request}
+}
+
+// rootCAs returns the CA certificates trusted for the server: the system
+// roots if caFile is SystemCA, or the certificates in caFile otherwise
+// (none if it is empty), plus those in the CA bundle.
+func (o clientOptions) rootCAs(caFile string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	var files []string
+	if caFile == SystemCA {
+		sys, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load system CA certs: %w", err)
+		}
+		pool = sys
+	} else if caFile != "" {
+		files = append(files, caFile)
+	}
+	if o.caBundle != "" {
+		files = append(files, o.caBundle)
+	}
+	if caFile != SystemCA && len(files) == 0 {
+		return nil, errors.New("no CA cert configured")
+	}
+
+	for _, f := range files {
+		pem, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA cert: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("failed to parse CA cert %s", f)
+		}
+	}
+	return pool, nil
+}
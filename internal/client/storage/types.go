@@ -3,10 +3,23 @@ package storage
 // Secret represents an encrypted secret with metadata stored locally
 // and sent to/received from the server.
 type Secret struct {
-	ID      string `json:"id"`
-	Type    string `json:"type"`    // "login_password", "text", "binary", "card"
-	Data    string `json:"data"`    // base64-encoded encrypted payload
-	Comment string `json:"comment"` // user-provided note
-	Version int64  `json:"version"` // timestamp or sync version
-	Deleted bool   `json:"deleted,omitempty"`
+	ID      string   `json:"id"`
+	Type    string   `json:"type"`             // "login_password", "text", "binary", "card"
+	Data    string   `json:"data"`             // base64-encoded encrypted payload
+	Name    string   `json:"name,omitempty"`   // encrypted name, see DecryptName
+	Comment string   `json:"comment"`          // user-provided note
+	Folder  string   `json:"folder,omitempty"` // folder path, e.g. "work/db"
+	Tags    []string `json:"tags,omitempty"`   // user-defined labels
+	Version int64    `json:"version"`          // timestamp or sync version
+	Deleted bool     `json:"deleted,omitempty"`
+	// Reprompt asks for the passphrase again before the data is revealed.
+	Reprompt bool `json:"reprompt,omitempty"`
+	// ExpiresAt is the Unix time the secret expires, 0 if it does not. It
+	// is not encrypted, so that the server can warn before it.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+	// BaseVersion is the version of the copy last received from a server,
+	// which local edits, raising Version, start from; 0 for secrets never
+	// synced. Servers only report conflicts for uploads that differ from
+	// it, so that unchanged copies older than theirs are replaced quietly.
+	BaseVersion int64 `json:"base_version,omitempty"`
 }
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// MasterPasswordEnv names the environment variable that, when set,
+// supplies the master password instead of prompting for it.
+const MasterPasswordEnv = "GOPHKEEPER_MASTER_PASSWORD"
+
+// Argon2id parameters of new vaults, the second recommended option of RFC
+// 9106 for environments with less memory.
+const (
+	kdfTime    = 3
+	kdfMemory  = 64 * 1024 // KiB
+	kdfThreads = 4
+	kdfSaltLen = 16
+	kdfKeyLen  = 32
+)
+
+// kdfCheckText is encrypted with the vault key into KDFParams.Check.
+const kdfCheckText = "gophkeeper vault key"
+
+var (
+	// ErrNoMasterPassword is returned by Unlock for vaults that have no
+	// master password yet, see SetMasterPassword.
+	ErrNoMasterPassword = errors.New("vault has no master password")
+	// ErrIncorrectMasterPassword is returned by Unlock when the vault key
+	// derived from the password does not open the vault.
+	ErrIncorrectMasterPassword = errors.New("incorrect master password")
+
+	errEmptyMasterPassword = errors.New("a non-empty master password is required")
+)
+
+// KDFParams are the Argon2id parameters the vault key is derived from the
+// master password with. They are stored with the vault in storage.json,
+// so that the key does not depend on the client certificate: a lost or
+// rotated certificate leaves the secrets readable.
+type KDFParams struct {
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"` // in KiB
+	Threads uint8  `json:"threads"`
+	// Check is a known text encrypted with the vault key, so that a wrong
+	// master password is reported instead of failing every decryption.
+	Check string `json:"check"`
+}
+
+// NewKDFParams returns the parameters of a new vault with a random salt.
+func NewKDFParams() (*KDFParams, error) {
+	salt := make([]byte, kdfSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("storage: generate salt: %w", err)
+	}
+	return &KDFParams{Salt: salt, Time: kdfTime, Memory: kdfMemory, Threads: kdfThreads}, nil
+}
+
+// NewAEADFromPassword derives the vault key from the master password with
+// Argon2id and p, and returns an AES-GCM AEAD with it.
+func NewAEADFromPassword(password []byte, p *KDFParams) (cipher.AEAD, error) {
+	if len(p.Salt) == 0 || p.Time == 0 || p.Memory == 0 || p.Threads == 0 {
+		return nil, fmt.Errorf("storage: invalid key derivation parameters")
+	}
+	return newAEAD(argon2.IDKey(password, p.Salt, p.Time, p.Memory, p.Threads, kdfKeyLen))
+}
+
+// EncryptedWithClientKey reports whether the vault predates master
+// passwords and holds secrets, which are then encrypted with the key
+// derived from the client key, see NewAEADFromKeyPEM.
+func (ls *LocalStorage) EncryptedWithClientKey() bool {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.KDF == nil && len(ls.Secrets) > 0
+}
+
+// Unlock derives the vault key from the master password. It returns
+// ErrNoMasterPassword if the vault has none yet and
+// ErrIncorrectMasterPassword if the password is wrong.
+func (ls *LocalStorage) Unlock(password []byte) (cipher.AEAD, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.KDF == nil {
+		return nil, ErrNoMasterPassword
+	}
+	aead, err := NewAEADFromPassword(password, ls.KDF)
+	if err != nil {
+		return nil, err
+	}
+	if plain, err := Decrypt(aead, ls.KDF.Check); err != nil || string(plain) != kdfCheckText {
+		return nil, ErrIncorrectMasterPassword
+	}
+	return aead, nil
+}
+
+// SetMasterPassword protects the vault with the master password under new
+// parameters with a fresh salt and returns the new vault key. Secrets that
+// legacy, the key the vault was encrypted with before, decrypts are
+// re-encrypted with the new key and get a new version, so that the server
+// keeps them in the new form too; their number is returned. Secrets
+// legacy does not decrypt are kept as they are. legacy may be nil. The
+// caller saves ls.
+func (ls *LocalStorage) SetMasterPassword(password []byte, legacy cipher.AEAD) (cipher.AEAD, int, error) {
+	params, err := NewKDFParams()
+	if err != nil {
+		return nil, 0, err
+	}
+	aead, err := NewAEADFromPassword(password, params)
+	if err != nil {
+		return nil, 0, err
+	}
+	if params.Check, err = Encrypt(aead, []byte(kdfCheckText)); err != nil {
+		return nil, 0, err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	secrets := slices.Clone(ls.Secrets)
+	rekeyed := 0
+	for i, sec := range secrets {
+		if legacy == nil || sec.Data == "" {
+			continue
+		}
+		plain, err := Decrypt(legacy, sec.Data)
+		if err != nil {
+			continue
+		}
+		if secrets[i].Data, err = Encrypt(aead, plain); err != nil {
+			return nil, 0, err
+		}
+		secrets[i].Version = ls.issueVersion(sec.Version)
+		rekeyed++
+	}
+	ls.Secrets = secrets
+	ls.KDF = params
+	return aead, rekeyed, nil
+}
+
+// ReadMasterPassword takes the master password from MasterPasswordEnv or
+// asks for it. For vaults without one yet, confirm is true and it is asked
+// twice; an empty password is refused.
+func ReadMasterPassword(confirm bool) ([]byte, error) {
+	if env, ok := os.LookupEnv(MasterPasswordEnv); ok {
+		if env == "" {
+			return nil, errEmptyMasterPassword
+		}
+		return []byte(env), nil
+	}
+	if !confirm {
+		return ReadPassphrase("Master password: ")
+	}
+	pass, err := ReadPassphrase("New master password: ")
+	if err != nil {
+		return nil, err
+	}
+	if len(pass) == 0 {
+		return nil, errEmptyMasterPassword
+	}
+	again, err := ReadPassphrase("Repeat master password: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(pass, again) {
+		return nil, errors.New("master passwords do not match")
+	}
+	return pass, nil
+}
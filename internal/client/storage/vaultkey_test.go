@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+// testKDFParams returns cheap parameters, as the defaults take a while.
+func testKDFParams(t *testing.T) *KDFParams {
+	t.Helper()
+	p, err := NewKDFParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Time, p.Memory, p.Threads = 1, 64, 1
+	return p
+}
+
+func TestNewAEADFromPassword(t *testing.T) {
+	p := testKDFParams(t)
+	aead1, err := NewAEADFromPassword([]byte("correct horse"), p)
+	if err != nil {
+		t.Fatalf("derive AEAD failed: %v", err)
+	}
+	aead2, err := NewAEADFromPassword([]byte("correct horse"), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Encrypt(aead1, []byte("helloworld"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := Decrypt(aead2, data); err != nil || string(plain) != "helloworld" {
+		t.Errorf("Decrypt with the same password = %q, %v", plain, err)
+	}
+
+	other, err := NewAEADFromPassword([]byte("wrong"), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(other, data); !errors.Is(err, ErrDecryption) {
+		t.Errorf("Decrypt with another password = %v, want ErrDecryption", err)
+	}
+	salted, err := NewAEADFromPassword([]byte("correct horse"), testKDFParams(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(salted, data); !errors.Is(err, ErrDecryption) {
+		t.Errorf("Decrypt with another salt = %v, want ErrDecryption", err)
+	}
+
+	if _, err := NewAEADFromPassword([]byte("x"), &KDFParams{}); err == nil {
+		t.Error("empty parameters accepted")
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	ls := &LocalStorage{}
+	if _, err := ls.Unlock([]byte("secret")); !errors.Is(err, ErrNoMasterPassword) {
+		t.Fatalf("Unlock without a master password = %v, want ErrNoMasterPassword", err)
+	}
+
+	aead, _, err := ls.SetMasterPassword([]byte("secret"), nil)
+	if err != nil {
+		t.Fatalf("SetMasterPassword failed: %v", err)
+	}
+	if ls.KDF == nil || len(ls.KDF.Salt) != kdfSaltLen || ls.KDF.Check == "" {
+		t.Fatalf("KDF = %+v, want parameters with salt and check", ls.KDF)
+	}
+	data, err := Encrypt(aead, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlocked, err := ls.Unlock([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if plain, err := Decrypt(unlocked, data); err != nil || string(plain) != "hello" {
+		t.Errorf("unlocked key decrypts %q, %v", plain, err)
+	}
+	if _, err := ls.Unlock([]byte("wrong")); !errors.Is(err, ErrIncorrectMasterPassword) {
+		t.Errorf("Unlock with a wrong password = %v, want ErrIncorrectMasterPassword", err)
+	}
+}
+
+func TestSetMasterPassword_Migrates(t *testing.T) {
+	legacy, foreign := newTestAEAD(t), newTestAEAD(t)
+	mine, _ := Encrypt(legacy, []byte("mine"))
+	theirs, _ := Encrypt(foreign, []byte("theirs"))
+	ls := &LocalStorage{Secrets: []Secret{
+		{ID: "a", Type: "text", Data: mine, Version: 5},
+		{ID: "b", Type: "text", Data: theirs, Version: 6},
+		{ID: "c", Type: "text", Deleted: true, Version: 7},
+	}}
+
+	if !ls.EncryptedWithClientKey() {
+		t.Error("EncryptedWithClientKey = false before migration")
+	}
+	aead, rekeyed, err := ls.SetMasterPassword([]byte("secret"), legacy)
+	if err != nil {
+		t.Fatalf("SetMasterPassword failed: %v", err)
+	}
+	if rekeyed != 1 {
+		t.Errorf("rekeyed = %d, want 1", rekeyed)
+	}
+	if plain, err := Decrypt(aead, ls.Secrets[0].Data); err != nil || string(plain) != "mine" {
+		t.Errorf("migrated secret decrypts to %q, %v", plain, err)
+	}
+	if ls.Secrets[0].Version <= 5 {
+		t.Errorf("migrated secret kept version %d", ls.Secrets[0].Version)
+	}
+	if ls.Secrets[1].Data != theirs || ls.Secrets[1].Version != 6 {
+		t.Errorf("secret of another key = %+v, want it unchanged", ls.Secrets[1])
+	}
+	if ls.Secrets[2].Version != 7 {
+		t.Errorf("tombstone version = %d, want 7", ls.Secrets[2].Version)
+	}
+	if _, err := ls.Unlock([]byte("secret")); err != nil {
+		t.Errorf("Unlock after migration failed: %v", err)
+	}
+	if ls.EncryptedWithClientKey() {
+		t.Error("EncryptedWithClientKey = true after migration")
+	}
+}
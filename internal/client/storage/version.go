@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ProtocolVersion is the version of the sync protocol spoken by the client.
+const ProtocolVersion = 1
+
+// ErrProtocolTooOld is returned when the server no longer supports the
+// client's sync protocol.
+var ErrProtocolTooOld = errors.New("client protocol is no longer supported by the server, please update the client")
+
+// ServerVersion is the server version reported by /api/version.
+type ServerVersion struct {
+	Version          string `json:"version"`
+	BuildDate        string `json:"build_date"`
+	GoVersion        string `json:"go_version"`
+	Revision         string `json:"revision"` // VCS revision, if known
+	Modified         bool   `json:"modified"` // revision with uncommitted changes
+	Protocol         int    `json:"protocol"`
+	MinProtocol      int    `json:"min_protocol"`       // oldest supported client protocol
+	MinClientVersion string `json:"min_client_version"` // oldest recommended client build
+}
+
+// FetchServerVersion retrieves the server version from /api/version.
+func FetchServerVersion(client *http.Client, baseURL string) (*ServerVersion, error) {
+	resp, err := client.Get(baseURL + "/api/version")
+	if err != nil {
+		return nil, fmt.Errorf("version request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp)
+	}
+
+	var sv ServerVersion
+	if err := json.NewDecoder(resp.Body).Decode(&sv); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return &sv, nil
+}
+
+// CheckCompatibility compares the client with the server version. It returns
+// ErrProtocolTooOld if the client must not sync, and a non-empty warning if
+// the client build is older than the server recommends. Unknown (empty)
+// client versions are not compared.
+func CheckCompatibility(sv *ServerVersion, clientVersion string) (string, error) {
+	if ProtocolVersion < sv.MinProtocol {
+		return "", ErrProtocolTooOld
+	}
+	if sv.MinClientVersion != "" && clientVersion != "" && CompareVersions(clientVersion, sv.MinClientVersion) < 0 {
+		return fmt.Sprintf("client version %s is older than %s recommended by the server, please update",
+			clientVersion, sv.MinClientVersion), nil
+	}
+	return "", nil
+}
+
+// CompareVersions compares two version strings by their numeric components,
+// so "1.10.0" > "1.9.2" and "20250102" > "20250101". A leading "v" and any
+// non-numeric separators are ignored, build metadata ("+...") is dropped and
+// a pre-release ("-rc1") sorts before its release. It returns -1, 0 or +1.
+func CompareVersions(a, b string) int {
+	a, _, _ = strings.Cut(a, "+")
+	b, _, _ = strings.Cut(b, "+")
+	coreA, preA, hasPreA := strings.Cut(a, "-")
+	coreB, preB, hasPreB := strings.Cut(b, "-")
+	if c := compareParts(versionParts(coreA), versionParts(coreB)); c != 0 {
+		return c
+	}
+	switch {
+	case hasPreA && !hasPreB:
+		return -1
+	case !hasPreA && hasPreB:
+		return 1
+	}
+	return compareParts(versionParts(preA), versionParts(preB))
+}
+
+// compareParts compares numeric version components, treating missing ones as 0.
+func compareParts(pa, pb []int) int {
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionParts extracts the numeric components of a version string.
+func versionParts(v string) []int {
+	var parts []int
+	for _, f := range strings.FieldsFunc(v, func(r rune) bool { return !unicode.IsDigit(r) }) {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			continue
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFetchServerVersion(t *testing.T) {
+	client := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodGet || req.URL.String() != "http://example.com/api/version" {
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL)
+		}
+		body := `{"version":"1.4.0","go_version":"go1.23.4","revision":"1b605b7c","modified":true,"protocol":1,"min_protocol":1,"min_client_version":"1.2.0"}`
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+
+	sv, err := FetchServerVersion(client, "http://example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sv.Version != "1.4.0" || sv.MinProtocol != 1 || sv.MinClientVersion != "1.2.0" ||
+		sv.GoVersion != "go1.23.4" || sv.Revision != "1b605b7c" || !sv.Modified {
+		t.Errorf("unexpected version: %+v", sv)
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	tests := []struct {
+		name          string
+		server        ServerVersion
+		clientVersion string
+		wantWarning   bool
+		wantErr       error
+	}{
+		{"compatible", ServerVersion{MinProtocol: 1, MinClientVersion: "1.2.0"}, "1.3.0", false, nil},
+		{"outdated build", ServerVersion{MinProtocol: 1, MinClientVersion: "1.2.0"}, "1.1.9", true, nil},
+		{"unknown client version", ServerVersion{MinProtocol: 1, MinClientVersion: "1.2.0"}, "", false, nil},
+		{"protocol too old", ServerVersion{MinProtocol: ProtocolVersion + 1}, "9.9.9", false, ErrProtocolTooOld},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warning, err := CheckCompatibility(&tt.server, tt.clientVersion)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v; want %v", err, tt.wantErr)
+			}
+			if (warning != "") != tt.wantWarning {
+				t.Errorf("warning = %q; want warning: %v", warning, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.10.0", "1.9.2", 1},
+		{"1.2", "1.2.1", -1},
+		{"20250101", "20250102", -1},
+		{"1.0.0-rc1", "1.0.0", -1},
+		{"1.0.0-rc2", "1.0.0-rc1", 1},
+		{"1.0.0+build5", "1.0.0", 0},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d; want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// watchTimeout is how long a watch stream may stay silent before it is
+	// considered dead. Servers send a heartbeat every 30 seconds.
+	watchTimeout = 75 * time.Second
+	// watchSyncInterval is the delay between automatic syncs while the
+	// servers are watched, as a safety net for missed changes.
+	watchSyncInterval = 5 * time.Minute
+)
+
+// ErrWatchUnsupported is returned by WatchServer and watchGRPC for servers
+// that predate their watch streams.
+var ErrWatchUnsupported = errors.New("server does not support watching for changes")
+
+// WatchServer opens the watch stream of the server at baseURL and calls
+// changed whenever another device changes the vault there. It blocks until
+// ctx is done or the stream fails.
+func WatchServer(ctx context.Context, client *http.Client, baseURL string, changed func()) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/api/sync/watch", nil)
+	if err != nil {
+		return err
+	}
+	// The stream stays open for good, only silence ends it
+	c := *client
+	c.Timeout = 0
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("watch request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed:
+		return ErrWatchUnsupported
+	case resp.StatusCode != http.StatusOK:
+		return newStatusError(resp)
+	}
+
+	var silent atomic.Bool
+	silence := time.AfterFunc(watchTimeout, func() {
+		silent.Store(true)
+		cancel()
+	})
+	defer silence.Stop()
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		silence.Reset(watchTimeout)
+		// Empty lines are heartbeats; every event means a change
+		if len(scanner.Bytes()) > 0 {
+			changed()
+		}
+	}
+	switch {
+	case silent.Load():
+		return errors.New("watch stream timed out")
+	case scanner.Err() != nil:
+		return fmt.Errorf("watch stream failed: %w", scanner.Err())
+	default:
+		return errors.New("watch stream closed")
+	}
+}
+
+// watchGRPC opens the Watch stream of the gRPC API of the server at
+// baseURL for the part of the vault filter selects and passes the changes
+// it pushes to push. It blocks until ctx is done or the stream fails.
+// Servers without the call are reported with ErrWatchUnsupported.
+func watchGRPC(ctx context.Context, client *http.Client, baseURL string, filter SyncFilter, push func(Push)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var body bytes.Buffer
+	req := &pb.WatchRequest{}
+	if wire := filter.wire(); wire != nil {
+		req.Filter = &pb.SyncFilter{Folders: wire["folders"], Tags: wire["tags"], Types: wire["types"]}
+	}
+	if err := writeMessage(&body, req); err != nil {
+		return err
+	}
+	httpReq, err := newGRPCRequest(baseURL, pb.GophKeeper_Watch_FullMethodName, &body)
+	if err != nil {
+		return err
+	}
+	c := *client
+	c.Timeout = 0
+	resp, err := doGRPC(&c, httpReq.WithContext(ctx))
+	if err != nil {
+		return watchError(err)
+	}
+	defer resp.Body.Close()
+
+	var silent atomic.Bool
+	silence := time.AfterFunc(watchTimeout, func() {
+		silent.Store(true)
+		cancel()
+	})
+	defer silence.Stop()
+	r := bufio.NewReader(resp.Body)
+	var secrets []Secret
+	for opened := true; ; {
+		b, err := readMessage(r)
+		if errors.Is(err, io.EOF) {
+			if err := grpcStatusError(resp); err != nil {
+				return watchError(err)
+			}
+			return errors.New("watch stream closed")
+		}
+		if err != nil {
+			if silent.Load() {
+				return errors.New("watch stream timed out")
+			}
+			return fmt.Errorf("watch stream failed: %w", err)
+		}
+		silence.Reset(watchTimeout)
+		var event pb.WatchEvent
+		if err := proto.Unmarshal(b, &event); err != nil {
+			return fmt.Errorf("invalid watch event: %w", err)
+		}
+		// Events with neither are heartbeats
+		if s := event.GetSecret(); s != nil {
+			secrets = append(secrets, secretFromPB(s))
+		}
+		if change := event.GetChange(); change != nil {
+			push(Push{BaseURL: baseURL, Secrets: secrets, ETag: change.GetEtag(), Opened: opened, Resync: change.GetResync()})
+			secrets, opened = nil, false
+		}
+	}
+}
+
+// watchError returns err, a failure to open a watch stream, as
+// ErrWatchUnsupported if the server does not know the call.
+func watchError(err error) error {
+	var se *StatusError
+	if errors.As(err, &se) && (se.StatusCode == http.StatusNotFound || se.StatusCode == http.StatusMethodNotAllowed) {
+		return ErrWatchUnsupported
+	}
+	return err
+}
+
+// WatchServers watches every server in baseURLs until ctx is done and
+// sends the changes made on them to pushes. Over TransportGRPC, see
+// SetTransport, the servers push the secrets changed for the part of the
+// vault ls syncs, see Push; otherwise, and with servers that predate the
+// gRPC call, only the fact that the vault changed is sent, as a Push with
+// Resync set. Failed streams are reopened with exponential backoff;
+// servers that do not support watching are polled every syncInterval
+// instead.
+func WatchServers(ctx context.Context, client *http.Client, baseURLs []string, ls *LocalStorage, pushes chan<- Push) {
+	ls.mu.Lock()
+	t := ls.transport
+	ls.mu.Unlock()
+	backoff := RetryPolicy{BaseDelay: time.Second, MaxDelay: maxSyncInterval}
+	for _, baseURL := range baseURLs {
+		send := func(p Push) {
+			select {
+			case pushes <- p:
+			case <-ctx.Done():
+			}
+		}
+		resync := func() { send(Push{BaseURL: baseURL, Resync: true}) }
+		go func() {
+			grpc := t == TransportGRPC
+			for failures := 1; ; failures++ {
+				opened := time.Now()
+				var err error
+				if grpc {
+					err = watchGRPC(ctx, client, baseURL, ls.Filter(), send)
+				} else {
+					err = WatchServer(ctx, client, baseURL, resync)
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				if errors.Is(err, ErrWatchUnsupported) {
+					if grpc {
+						grpc = false
+						continue
+					}
+					poll(ctx, resync)
+					return
+				}
+				// A stream that was up for a while failed for a new reason
+				if time.Since(opened) > watchTimeout {
+					failures = 1
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff.Backoff(failures)):
+				}
+				// Changes made while disconnected are picked up by a sync
+				resync()
+			}
+		}()
+	}
+}
+
+// poll calls notify every syncInterval until ctx is done.
+func poll(ctx context.Context, notify func()) {
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			notify()
+		}
+	}
+}
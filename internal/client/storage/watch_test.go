@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/pb"
+)
+
+func TestWatchServer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/sync/watch" {
+			http.NotFound(w, r)
+			return
+		}
+		rc := http.NewResponseController(w)
+		// A heartbeat, two changes, then the server goes away
+		for _, line := range []string{"\n", `{"version":3}` + "\n", `{"version":4}` + "\n"} {
+			_, _ = w.Write([]byte(line))
+			_ = rc.Flush()
+		}
+	}))
+	defer srv.Close()
+
+	changes := 0
+	err := WatchServer(context.Background(), srv.Client(), srv.URL, func() { changes++ })
+	if err == nil || changes != 2 {
+		t.Errorf("WatchServer = %v with %d changes; want an error after 2 changes", err, changes)
+	}
+}
+
+func TestWatchServer_Unsupported(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	err := WatchServer(context.Background(), srv.Client(), srv.URL, func() {})
+	if !errors.Is(err, ErrWatchUnsupported) {
+		t.Errorf("WatchServer = %v; want ErrWatchUnsupported", err)
+	}
+}
+
+func TestWatchServers_Resync(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"version":1}` + "\n"))
+		_ = http.NewResponseController(w).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pushes := make(chan Push, 1)
+	WatchServers(ctx, srv.Client(), []string{srv.URL}, newMemoryDevice(t), pushes)
+
+	select {
+	case p := <-pushes:
+		if !p.Resync || p.BaseURL != srv.URL {
+			t.Errorf("push = %+v, want a resync of %s", p, srv.URL)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no push after a change on the server")
+	}
+	cancel()
+}
+
+func TestWatchServers_GRPC(t *testing.T) {
+	var gotFolders []string
+	baseURL, caFile := startGRPCServer(t, &fakeGRPCServer{watch: func(req *pb.WatchRequest, stream pb.GophKeeper_WatchServer) error {
+		gotFolders = req.GetFilter().GetFolders()
+		events := []*pb.WatchEvent{
+			{Message: &pb.WatchEvent_Change{Change: &pb.WatchChange{Etag: `"v1"`}}},
+			{},
+			{Message: &pb.WatchEvent_Secret{Secret: &pb.Secret{Id: "a", Data: "new", Folder: "work", Version: 2}}},
+			{Message: &pb.WatchEvent_Secret{Secret: &pb.Secret{Id: "b", Version: 3, Deleted: true}}},
+			{Message: &pb.WatchEvent_Change{Change: &pb.WatchChange{Etag: `"v3"`}}},
+		}
+		for _, e := range events {
+			if err := stream.Send(e); err != nil {
+				return err
+			}
+		}
+		<-stream.Context().Done()
+		return nil
+	}})
+	client, err := NewClient(caFile, WithTransport(TransportGRPC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls := newMemoryDevice(t)
+	ls.SyncFilter = &SyncFilter{Folders: []string{"work"}}
+	ls.SetTransport(TransportGRPC)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pushes := make(chan Push, 1)
+	WatchServers(ctx, client, []string{baseURL}, ls, pushes)
+
+	var got []Push
+	for len(got) < 2 {
+		select {
+		case p := <-pushes:
+			got = append(got, p)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("pushes = %+v, want 2", got)
+		}
+	}
+	if p := got[0]; !p.Opened || p.ETag != `"v1"` || len(p.Secrets) != 0 {
+		t.Errorf("first push = %+v, want the etag the stream opened with", p)
+	}
+	if p := got[1]; p.Opened || p.Resync || p.ETag != `"v3"` || len(p.Secrets) != 2 ||
+		p.Secrets[0].Data != "new" || !p.Secrets[1].Deleted {
+		t.Errorf("second push = %+v, want a and the tombstone of b", p)
+	}
+	if len(gotFolders) != 1 || gotFolders[0] != "work" {
+		t.Errorf("filter folders = %v, want [work]", gotFolders)
+	}
+}
+
+func TestWatchGRPC_Unsupported(t *testing.T) {
+	baseURL, caFile := startGRPCServer(t, &fakeGRPCServer{})
+	client, err := NewClient(caFile, WithTransport(TransportGRPC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = watchGRPC(context.Background(), client, baseURL, SyncFilter{}, func(Push) {})
+	if !errors.Is(err, ErrWatchUnsupported) {
+		t.Errorf("watchGRPC = %v; want ErrWatchUnsupported", err)
+	}
+}
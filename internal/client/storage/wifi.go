@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// WiFi security modes, see ParseWiFi.
+const (
+	WiFiOpen = "none"
+	WiFiWEP  = "WEP"
+	WiFiWPA  = "WPA" // WPA or WPA2 personal
+	WiFiWPA3 = "WPA3"
+)
+
+// WiFiProfileFormats lists the formats of WiFi.Profile.
+var WiFiProfileFormats = []string{"nm", "mobileconfig", "windows"}
+
+// WiFi is the decrypted payload of a wifi secret.
+type WiFi struct {
+	SSID     string
+	Password string
+	Security string // WiFiOpen, WiFiWEP, WiFiWPA or WiFiWPA3
+	Hidden   bool
+}
+
+// ParseWiFi decodes the payload of a wifi secret. The security mode
+// defaults to WPA with a password and to an open network without one.
+func ParseWiFi(plain []byte) (WiFi, error) {
+	var payload map[string]string
+	if err := json.Unmarshal(plain, &payload); err != nil || payload["ssid"] == "" {
+		return WiFi{}, fmt.Errorf("%w: ssid", ErrFieldNotFound)
+	}
+	w := WiFi{SSID: payload["ssid"], Password: payload["password"]}
+	switch strings.ToLower(strings.ReplaceAll(payload["hidden"], " ", "")) {
+	case "yes", "y", "true", "1":
+		w.Hidden = true
+	}
+	switch sec := strings.ToUpper(strings.TrimSpace(payload["security"])); {
+	case sec == "WEP":
+		w.Security = WiFiWEP
+	case sec == "WPA3" || sec == "SAE":
+		w.Security = WiFiWPA3
+	case sec == "NONE" || sec == "OPEN" || sec == "NOPASS":
+		w.Security = WiFiOpen
+	case sec == "" && w.Password == "":
+		w.Security = WiFiOpen
+	case sec == "" || strings.HasPrefix(sec, "WPA"):
+		w.Security = WiFiWPA
+	default:
+		return WiFi{}, fmt.Errorf("unknown Wi-Fi security %q, use WPA2, WPA3, WEP or none", payload["security"])
+	}
+	if w.Security != WiFiOpen && w.Password == "" {
+		return WiFi{}, fmt.Errorf("%w: password", ErrFieldNotFound)
+	}
+	return w, nil
+}
+
+// QRString returns the network in the WIFI: URI format understood by the
+// cameras of Android and iOS, e.g. "WIFI:T:WPA;S:home;P:secret;;".
+func (w WiFi) QRString() string {
+	esc := strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, `"`, `\"`, `:`, `\:`)
+	t := map[string]string{WiFiOpen: "nopass", WiFiWEP: "WEP", WiFiWPA: "WPA", WiFiWPA3: "SAE"}[w.Security]
+	var b strings.Builder
+	fmt.Fprintf(&b, "WIFI:T:%s;S:%s;", t, esc.Replace(w.SSID))
+	if w.Security != WiFiOpen {
+		fmt.Fprintf(&b, "P:%s;", esc.Replace(w.Password))
+	}
+	if w.Hidden {
+		b.WriteString("H:true;")
+	}
+	b.WriteString(";")
+	return b.String()
+}
+
+// Profile returns the network as a profile importable by an operating
+// system, in one of WiFiProfileFormats:
+//
+//   - "nm": a NetworkManager keyfile, for /etc/NetworkManager/system-connections;
+//   - "mobileconfig": an Apple configuration profile for macOS and iOS;
+//   - "windows": a WLAN profile for "netsh wlan add profile".
+//
+// Profiles hold the password in the clear.
+func (w WiFi) Profile(format string) ([]byte, error) {
+	switch format {
+	case "nm":
+		return w.nmConnection(), nil
+	case "mobileconfig":
+		return w.mobileConfig(), nil
+	case "windows":
+		return w.windowsProfile()
+	}
+	return nil, fmt.Errorf("unknown profile format %q, use %s", format, strings.Join(WiFiProfileFormats, ", "))
+}
+
+// profileUUID returns a UUID identifying the network in profiles, stable
+// across exports so that re-importing replaces the profile.
+func (w WiFi) profileUUID() string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("gophkeeper:wifi:"+w.SSID)).String()
+}
+
+func (w WiFi) nmConnection() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "[connection]\nid=%s\nuuid=%s\ntype=wifi\n\n", keyfileString(w.SSID), w.profileUUID())
+	fmt.Fprintf(&b, "[wifi]\nmode=infrastructure\nssid=%s\n", keyfileSSID(w.SSID))
+	if w.Hidden {
+		b.WriteString("hidden=true\n")
+	}
+	switch w.Security {
+	case WiFiWPA:
+		fmt.Fprintf(&b, "\n[wifi-security]\nkey-mgmt=wpa-psk\npsk=%s\n", keyfileString(w.Password))
+	case WiFiWPA3:
+		fmt.Fprintf(&b, "\n[wifi-security]\nkey-mgmt=sae\npsk=%s\n", keyfileString(w.Password))
+	case WiFiWEP:
+		fmt.Fprintf(&b, "\n[wifi-security]\nkey-mgmt=none\nwep-key-type=2\nwep-key0=%s\n", keyfileString(w.Password))
+	}
+	b.WriteString("\n[ipv4]\nmethod=auto\n\n[ipv6]\nmethod=auto\n")
+	return b.Bytes()
+}
+
+// keyfileString escapes s as a string value of a NetworkManager keyfile,
+// which follows the GLib key file format: backslashes and line breaks are
+// escaped, and so is a leading space, which would be dropped otherwise.
+func keyfileString(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(s)
+	if strings.HasPrefix(s, " ") {
+		s = `\s` + s[1:]
+	}
+	return s
+}
+
+// keyfileSSID returns the value of the ssid key of a NetworkManager
+// keyfile. SSIDs are bytes: printable ASCII ones are written as text,
+// like NetworkManager does, and all others as a list of the byte values,
+// e.g. "104;111;109;101;", so that no byte is altered by escaping.
+func keyfileSSID(ssid string) string {
+	plain := !strings.HasPrefix(ssid, " ") && !strings.HasSuffix(ssid, " ")
+	for i := 0; i < len(ssid) && plain; i++ {
+		plain = ssid[i] >= ' ' && ssid[i] <= '~' && ssid[i] != ';' && ssid[i] != '\\'
+	}
+	if plain {
+		return ssid
+	}
+	var b strings.Builder
+	for i := 0; i < len(ssid); i++ {
+		fmt.Fprintf(&b, "%d;", ssid[i])
+	}
+	return b.String()
+}
+
+func (w WiFi) mobileConfig() []byte {
+	enc := map[string]string{WiFiOpen: "None", WiFiWEP: "WEP", WiFiWPA: "WPA2", WiFiWPA3: "WPA3"}[w.Security]
+	id := w.profileUUID()
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n\t<key>PayloadContent</key>\n\t<array>\n\t\t<dict>\n")
+	plistString(&b, 3, "EncryptionType", enc)
+	fmt.Fprintf(&b, "\t\t\t<key>HIDDEN_NETWORK</key>\n\t\t\t<%t/>\n", w.Hidden)
+	if w.Security != WiFiOpen {
+		plistString(&b, 3, "Password", w.Password)
+	}
+	plistString(&b, 3, "PayloadIdentifier", "com.github.atinyakov.gophkeeper.wifi."+id)
+	plistString(&b, 3, "PayloadType", "com.apple.wifi.managed")
+	plistString(&b, 3, "PayloadUUID", strings.ToUpper(id))
+	b.WriteString("\t\t\t<key>PayloadVersion</key>\n\t\t\t<integer>1</integer>\n")
+	plistString(&b, 3, "SSID_STR", w.SSID)
+	b.WriteString("\t\t</dict>\n\t</array>\n")
+	plistString(&b, 1, "PayloadDisplayName", "Wi-Fi "+w.SSID)
+	plistString(&b, 1, "PayloadIdentifier", "com.github.atinyakov.gophkeeper.profile."+id)
+	plistString(&b, 1, "PayloadType", "Configuration")
+	plistString(&b, 1, "PayloadUUID", strings.ToUpper(uuid.NewSHA1(uuid.NameSpaceURL, []byte(id)).String()))
+	b.WriteString("\t<key>PayloadVersion</key>\n\t<integer>1</integer>\n</dict>\n</plist>\n")
+	return b.Bytes()
+}
+
+// plistString writes a key with a string value to a property list,
+// indented by depth tabs.
+func plistString(b *bytes.Buffer, depth int, key, value string) {
+	indent := strings.Repeat("\t", depth)
+	fmt.Fprintf(b, "%s<key>%s</key>\n%s<string>", indent, key, indent)
+	_ = xml.EscapeText(b, []byte(value))
+	b.WriteString("</string>\n")
+}
+
+// wlanProfile is the WLAN profile schema of Windows, limited to personal
+// networks.
+type wlanProfile struct {
+	XMLName      xml.Name `xml:"http://www.microsoft.com/networking/WLAN/profile/v1 WLANProfile"`
+	Name         string   `xml:"name"`
+	SSID         string   `xml:"SSIDConfig>SSID>name"`
+	NonBroadcast bool     `xml:"SSIDConfig>nonBroadcast"`
+	Type         string   `xml:"connectionType"`
+	Mode         string   `xml:"connectionMode"`
+	Auth         string   `xml:"MSM>security>authEncryption>authentication"`
+	Encryption   string   `xml:"MSM>security>authEncryption>encryption"`
+	UseOneX      bool     `xml:"MSM>security>authEncryption>useOneX"`
+	SharedKey    *wlanKey `xml:"MSM>security>sharedKey,omitempty"`
+}
+
+type wlanKey struct {
+	Type      string `xml:"keyType"`
+	Protected bool   `xml:"protected"`
+	Material  string `xml:"keyMaterial"`
+}
+
+func (w WiFi) windowsProfile() ([]byte, error) {
+	p := wlanProfile{Name: w.SSID, SSID: w.SSID, NonBroadcast: w.Hidden, Type: "ESS", Mode: "auto"}
+	switch w.Security {
+	case WiFiOpen:
+		p.Auth, p.Encryption = "open", "none"
+	case WiFiWEP:
+		p.Auth, p.Encryption = "open", "WEP"
+		p.SharedKey = &wlanKey{Type: "networkKey", Material: w.Password}
+	case WiFiWPA:
+		p.Auth, p.Encryption = "WPA2PSK", "AES"
+		p.SharedKey = &wlanKey{Type: "passPhrase", Material: w.Password}
+	case WiFiWPA3:
+		p.Auth, p.Encryption = "WPA3SAE", "AES"
+		p.SharedKey = &wlanKey{Type: "passPhrase", Material: w.Password}
+	}
+	out, err := xml.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte(xml.Header), out...), '\n'), nil
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseWiFi(t *testing.T) {
+	tests := []struct {
+		name    string
+		plain   string
+		want    WiFi
+		wantErr bool
+	}{
+		{"WPA2", `{"ssid":"home","password":"pw","security":"WPA2"}`, WiFi{SSID: "home", Password: "pw", Security: WiFiWPA}, false},
+		{"default WPA", `{"ssid":"home","password":"pw"}`, WiFi{SSID: "home", Password: "pw", Security: WiFiWPA}, false},
+		{"WPA3 hidden", `{"ssid":"home","password":"pw","security":"wpa3","hidden":"yes"}`, WiFi{SSID: "home", Password: "pw", Security: WiFiWPA3, Hidden: true}, false},
+		{"open", `{"ssid":"cafe"}`, WiFi{SSID: "cafe", Security: WiFiOpen}, false},
+		{"no ssid", `{"password":"pw"}`, WiFi{}, true},
+		{"WEP without password", `{"ssid":"old","security":"WEP"}`, WiFi{}, true},
+		{"unknown security", `{"ssid":"x","password":"pw","security":"802.1X"}`, WiFi{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseWiFi([]byte(tt.plain))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWiFi error = %v; want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseWiFi = %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+	if _, err := ParseWiFi([]byte(`{}`)); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("missing ssid error = %v; want ErrFieldNotFound", err)
+	}
+}
+
+func TestWiFi_QRString(t *testing.T) {
+	tests := []struct {
+		w    WiFi
+		want string
+	}{
+		{WiFi{SSID: "home", Password: "pw", Security: WiFiWPA}, "WIFI:T:WPA;S:home;P:pw;;"},
+		{WiFi{SSID: `a;b`, Password: `p:w\"`, Security: WiFiWPA3, Hidden: true}, `WIFI:T:SAE;S:a\;b;P:p\:w\\\";H:true;;`},
+		{WiFi{SSID: "cafe", Security: WiFiOpen}, "WIFI:T:nopass;S:cafe;;"},
+	}
+	for _, tt := range tests {
+		if got := tt.w.QRString(); got != tt.want {
+			t.Errorf("QRString(%+v) = %s; want %s", tt.w, got, tt.want)
+		}
+	}
+}
+
+func TestWiFi_Profile(t *testing.T) {
+	w := WiFi{SSID: "R&D", Password: "p<w>", Security: WiFiWPA, Hidden: true}
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"nm", []string{"ssid=R&D\n", "hidden=true", "key-mgmt=wpa-psk\npsk=p<w>\n"}},
+		{"mobileconfig", []string{"<string>R&amp;D</string>", "<string>p&lt;w&gt;</string>", "<string>WPA2</string>", "<true/>"}},
+		{"windows", []string{"<name>R&amp;D</name>", "<nonBroadcast>true</nonBroadcast>", "<authentication>WPA2PSK</authentication>", "<keyMaterial>p&lt;w&gt;</keyMaterial>"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			out, err := w.Profile(tt.format)
+			if err != nil {
+				t.Fatalf("Profile: %v", err)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(string(out), s) {
+					t.Errorf("profile lacks %q:\n%s", s, out)
+				}
+			}
+		})
+	}
+	// Keyfile values cannot break out of their line
+	nm, _ := WiFi{SSID: "a;b\n[x]", Password: " p\\w\nkey-mgmt=none", Security: WiFiWPA}.Profile("nm")
+	for _, s := range []string{"id=a;b\\n[x]\n", "ssid=97;59;98;10;91;120;93;\n", "psk=\\sp\\\\w\\nkey-mgmt=none\n"} {
+		if !strings.Contains(string(nm), s) {
+			t.Errorf("nm profile lacks %q:\n%s", s, nm)
+		}
+	}
+	if _, err := w.Profile("plist"); err == nil {
+		t.Error("Profile(plist) succeeded; want error")
+	}
+}
@@ -0,0 +1,64 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRecorder_Send(t *testing.T) {
+	var reports []Report
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rep Report
+		if err := json.NewDecoder(r.Body).Decode(&rep); err != nil {
+			t.Errorf("decode report: %v", err)
+		}
+		reports = append(reports, rep)
+	}))
+	defer ts.Close()
+
+	r := New(ts.URL, "1.2.3")
+	if err := r.Send(); err != nil || len(reports) != 0 {
+		t.Fatalf("Send without records = %v, %d reports; want nothing sent", err, len(reports))
+	}
+
+	r.Record("get", 10*time.Millisecond, "")
+	r.Record("get", 30*time.Millisecond, "not_found")
+	r.Record("sync", 200*time.Millisecond, "network")
+	if err := r.Send(); err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("got %d reports; want 1", len(reports))
+	}
+
+	rep := reports[0]
+	if rep.Version != "1.2.3" || rep.OS == "" || rep.Arch == "" {
+		t.Errorf("report header = %q/%q/%q", rep.Version, rep.OS, rep.Arch)
+	}
+	get := rep.Commands["get"]
+	if get == nil || get.Count != 2 || get.Errors != 1 || get.TotalMS != 40 || get.MaxMS != 30 {
+		t.Errorf("get stats = %+v; want count 2, errors 1, total 40, max 30", get)
+	}
+	if rep.Errors["not_found"] != 1 || rep.Errors["network"] != 1 {
+		t.Errorf("errors = %v", rep.Errors)
+	}
+
+	// Statistics are cleared once sent.
+	if err := r.Send(); err != nil || len(reports) != 1 {
+		t.Errorf("second Send = %v, %d reports; want nothing sent", err, len(reports))
+	}
+}
+
+func TestRecorder_Disabled(t *testing.T) {
+	r := New("", "1.2.3")
+	if r != nil {
+		t.Fatal("New without endpoint returned a recorder")
+	}
+	r.Record("get", time.Second, "")
+	if err := r.Send(); err != nil {
+		t.Errorf("Send on disabled recorder = %v", err)
+	}
+}
@@ -0,0 +1,550 @@
+// Package tui is a full-screen terminal interface to browse the vault: a
+// search bar, the list of secrets and the details of the selected one. It
+// draws with ANSI escape sequences on a terminal in raw mode, so no curses
+// library is needed.
+package tui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/atinyakov/GophKeeper/internal/client/i18n"
+	"github.com/atinyakov/GophKeeper/internal/client/storage"
+)
+
+// Item is a secret in the list.
+type Item struct {
+	ID     string
+	Type   string
+	Name   string
+	Folder string
+	// Hidden is set for reprompt secrets, whose data is shown and copied
+	// only after Vault.Reveal.
+	Hidden bool
+}
+
+// title is the text of i in the list: its folder and name, or its ID
+// prefix if it has no name.
+func (i Item) title() string {
+	t := i.Name
+	if t == "" {
+		t = i.ID[:min(len(i.ID), 8)]
+	}
+	if i.Folder != "" {
+		t = i.Folder + "/" + t
+	}
+	return t
+}
+
+// Vault is the vault browsed by Run. Reveal and Edit are called with the
+// terminal in its normal mode, so they may prompt on stdin.
+type Vault interface {
+	// Items returns the secrets whose name, comment or data contain query, in
+	// the order they are listed.
+	Items(query string) []Item
+	// Detail describes the secret id, with its data only if reveal is set.
+	Detail(id string, reveal bool) string
+	// Reveal asks for the passphrase before the data of a hidden item is
+	// shown or copied.
+	Reveal(id string) error
+	// Credentials returns the login and password of the secret id.
+	Credentials(id string) (login, password string, err error)
+	// Rename changes the name of the secret id and saves the vault.
+	Rename(id, name string) error
+	// Edit asks for the new data and comment of the secret id and saves
+	// the vault.
+	Edit(id string) error
+}
+
+// Keys as decoded by decodeKeys. Other keys are the text they type.
+const (
+	keyUp        = "\x1b[A"
+	keyDown      = "\x1b[B"
+	keyHome      = "\x1b[H"
+	keyEnd       = "\x1b[F"
+	keyPageUp    = "\x1b[5~"
+	keyPageDown  = "\x1b[6~"
+	keyEnter     = "\r"
+	keyEsc       = "\x1b"
+	keyBackspace = "\x7f"
+	keyCtrlC     = "\x03"
+)
+
+// keyAliases maps the sequences sent by some terminals for the same keys.
+var keyAliases = map[string]string{
+	"\x1bOA":  keyUp,
+	"\x1bOB":  keyDown,
+	"\x1bOH":  keyHome,
+	"\x1b[1~": keyHome,
+	"\x1b[7~": keyHome,
+	"\x1bOF":  keyEnd,
+	"\x1b[4~": keyEnd,
+	"\x1b[8~": keyEnd,
+	"\n":      keyEnter,
+	"\b":      keyBackspace,
+}
+
+// decodeKeys splits input read from a raw terminal into keys: escape
+// sequences, e.g. of arrow keys, and UTF-8 encoded characters.
+func decodeKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		n := 1
+		switch {
+		case b[0] == 0x1b && len(b) > 2 && (b[1] == '[' || b[1] == 'O'):
+			// CSI and SS3 sequences end with a byte in 0x40-0x7e
+			n = 2
+			for n < len(b) && (b[n] < 0x40 || b[n] > 0x7e) {
+				n++
+			}
+			n = min(n+1, len(b))
+		case b[0] >= utf8.RuneSelf:
+			_, n = utf8.DecodeRune(b)
+		}
+		k := string(b[:n])
+		if alias, ok := keyAliases[k]; ok {
+			k = alias
+		}
+		keys = append(keys, k)
+		b = b[n:]
+	}
+	return keys
+}
+
+// mode is what keys do: move in the list or edit the text in a bar.
+type mode int
+
+const (
+	browsing mode = iota
+	searching
+	renaming
+)
+
+// app is the state of the interface.
+type app struct {
+	vault Vault
+	copy  func(text string) error
+	items []Item
+	// cursor is the index of the selected item, top that of the first one
+	// on screen.
+	cursor, top int
+	// height is the number of items on screen when last drawn.
+	height int
+	mode   mode
+	query  string
+	// input is the name edited while renaming.
+	input []rune
+	// revealed is the ID of the hidden item whose data is shown.
+	revealed string
+	status   string
+	quit     bool
+}
+
+// newApp returns the interface to v listing all secrets. copy puts text on
+// the clipboard.
+func newApp(v Vault, copy func(text string) error) *app {
+	a := &app{vault: v, copy: copy}
+	a.refresh()
+	return a
+}
+
+// selected returns the selected item, if any.
+func (a *app) selected() (Item, bool) {
+	if a.cursor < 0 || a.cursor >= len(a.items) {
+		return Item{}, false
+	}
+	return a.items[a.cursor], true
+}
+
+// refresh lists the items matching the query again, keeping the selected
+// one selected if it is still listed.
+func (a *app) refresh() {
+	sel, _ := a.selected()
+	a.items = a.vault.Items(a.query)
+	a.cursor = 0
+	for i, it := range a.items {
+		if it.ID == sel.ID {
+			a.cursor = i
+		}
+	}
+}
+
+// move moves the cursor by delta items, within the list.
+func (a *app) move(delta int) {
+	a.cursor = max(min(a.cursor+delta, len(a.items)-1), 0)
+	if sel, _ := a.selected(); sel.ID != a.revealed {
+		a.revealed = ""
+	}
+}
+
+// handle updates a for the key k. Work that needs the terminal in its
+// normal mode is returned as a task, for Run to call after restoring it.
+func (a *app) handle(k string) (task func() error) {
+	a.status = ""
+	if k == keyCtrlC {
+		a.quit = true
+		return nil
+	}
+	switch a.mode {
+	case searching:
+		a.handleSearch(k)
+		return nil
+	case renaming:
+		a.handleRename(k)
+		return nil
+	}
+
+	sel, ok := a.selected()
+	switch k {
+	case keyUp, "k":
+		a.move(-1)
+	case keyDown, "j":
+		a.move(1)
+	case keyPageUp:
+		a.move(-max(a.height, 1))
+	case keyPageDown:
+		a.move(max(a.height, 1))
+	case keyHome, "g":
+		a.move(-len(a.items))
+	case keyEnd, "G":
+		a.move(len(a.items))
+	case "/":
+		a.mode = searching
+	case keyEsc:
+		if a.query != "" {
+			a.query = ""
+			a.refresh()
+		}
+	case "q":
+		a.quit = true
+	case keyEnter:
+		if ok && sel.Hidden && a.revealed != sel.ID {
+			return func() error {
+				if err := a.vault.Reveal(sel.ID); err != nil {
+					return err
+				}
+				a.revealed = sel.ID
+				return nil
+			}
+		}
+	case "c", "u":
+		if !ok {
+			return nil
+		}
+		password := k == "c"
+		if sel.Hidden && a.revealed != sel.ID {
+			return func() error {
+				if err := a.vault.Reveal(sel.ID); err != nil {
+					return err
+				}
+				a.revealed = sel.ID
+				return a.copyCredential(sel, password)
+			}
+		}
+		a.fail(a.copyCredential(sel, password))
+	case "r":
+		if ok {
+			a.mode = renaming
+			a.input = []rune(sel.Name)
+		}
+	case "e":
+		if ok {
+			return func() error {
+				if err := a.vault.Edit(sel.ID); err != nil {
+					return err
+				}
+				a.status = i18n.T("Secret updated")
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// handleSearch handles the key k typed into the search bar. The list is
+// filtered as the query is typed.
+func (a *app) handleSearch(k string) {
+	switch k {
+	case keyEnter:
+		a.mode = browsing
+		return
+	case keyEsc:
+		a.mode = browsing
+		a.query = ""
+	case keyUp:
+		a.move(-1)
+		return
+	case keyDown:
+		a.move(1)
+		return
+	case keyBackspace:
+		if r := []rune(a.query); len(r) > 0 {
+			a.query = string(r[:len(r)-1])
+		}
+	default:
+		if !printable(k) {
+			return
+		}
+		a.query += k
+	}
+	a.refresh()
+}
+
+// handleRename handles the key k typed into the name bar of the
+// selected item. The name is saved with ENTER.
+func (a *app) handleRename(k string) {
+	switch k {
+	case keyEnter:
+		a.mode = browsing
+		if sel, ok := a.selected(); ok && string(a.input) != sel.Name {
+			if a.fail(a.vault.Rename(sel.ID, string(a.input))) {
+				return
+			}
+			a.status = i18n.T("Secret updated")
+			a.refresh()
+		}
+	case keyEsc:
+		a.mode = browsing
+	case keyBackspace:
+		if len(a.input) > 0 {
+			a.input = a.input[:len(a.input)-1]
+		}
+	default:
+		if printable(k) {
+			a.input = append(a.input, []rune(k)...)
+		}
+	}
+}
+
+// copyCredential copies the password, or the login, of it.
+func (a *app) copyCredential(it Item, password bool) error {
+	login, pass, err := a.vault.Credentials(it.ID)
+	if err != nil {
+		return err
+	}
+	value, missing, copied := pass, "%s has no password", "Copied the password of %s"
+	if !password {
+		value, missing, copied = login, "%s has no login", "Copied the login of %s"
+	}
+	if value == "" {
+		return i18n.Errorf(missing, it.title())
+	}
+	if err := a.copy(value); err != nil {
+		return err
+	}
+	a.status = i18n.Sprintf(copied, it.title())
+	return nil
+}
+
+// fail shows err in the status bar, if not nil, and reports whether it was.
+func (a *app) fail(err error) bool {
+	if err != nil {
+		a.status = i18n.Sprintf("Error: %s", err)
+	}
+	return err != nil
+}
+
+// printable reports whether the key k types text.
+func printable(k string) bool {
+	r, _ := utf8.DecodeRuneInString(k)
+	return r >= ' ' && r != utf8.RuneError && k != keyBackspace && !strings.HasPrefix(k, keyEsc)
+}
+
+// Escape sequences used to draw.
+const (
+	enterScreen = "\x1b[?1049h" // switch to the alternate screen
+	leaveScreen = "\x1b[?25h\x1b[?1049l"
+	hideCursor  = "\x1b[?25l"
+	showCursor  = "\x1b[?25h"
+	clearLine   = "\x1b[K"
+	reverse     = "\x1b[7m"
+	dim         = "\x1b[2m"
+	reset       = "\x1b[0m"
+)
+
+// draw writes the screen of cols columns and rows rows to w: the search
+// bar, the list next to the details of the selected item, and the status
+// bar with the keys.
+func (a *app) draw(w io.Writer, cols, rows int) {
+	var b strings.Builder
+	b.WriteString(hideCursor)
+
+	bar := i18n.T("/ to search")
+	if a.mode == searching || a.query != "" {
+		bar = i18n.Sprintf("Search: %s", a.query)
+	}
+	count := i18n.Sprintf("%d secrets", len(a.items))
+	line(&b, 1, fit(bar, cols-len(count)-1)+" "+dim+count+reset)
+
+	a.height = max(rows-2, 0)
+	if a.cursor < a.top {
+		a.top = a.cursor
+	}
+	if a.cursor >= a.top+a.height {
+		a.top = a.cursor - a.height + 1
+	}
+	listWidth := min(max(cols*2/5, 16), 48)
+	detailWidth := max(cols-listWidth-3, 0)
+	var detail []string
+	if sel, ok := a.selected(); ok {
+		text := a.vault.Detail(sel.ID, !sel.Hidden || a.revealed == sel.ID)
+		detail = strings.Split(strings.TrimRight(text, "\n"), "\n")
+	} else {
+		detail = []string{i18n.T("No secrets found")}
+	}
+	for y := range a.height {
+		var entry string
+		if i := a.top + y; i < len(a.items) {
+			it := a.items[i]
+			typeWidth := min(8, listWidth/3)
+			entry = fit(it.title(), listWidth-typeWidth-1) + " " + dim + fit(it.Type, typeWidth) + reset
+			if i == a.cursor {
+				entry = reverse + fit(it.title(), listWidth-typeWidth-1) + " " + fit(it.Type, typeWidth) + reset
+			}
+		} else {
+			entry = strings.Repeat(" ", listWidth)
+		}
+		var d string
+		if y < len(detail) {
+			d = fit(detail[y], detailWidth)
+		}
+		line(&b, y+2, entry+" │ "+d)
+	}
+
+	status := a.status
+	switch {
+	case a.mode == renaming:
+		status = i18n.Sprintf("Name: %s", string(a.input))
+	case status == "":
+		status = dim + i18n.T("↑↓ move  / search  enter reveal  c password  u login  r rename  e edit  q quit") + reset
+	}
+	line(&b, rows, fit(status, cols))
+
+	switch a.mode {
+	case searching:
+		fmt.Fprintf(&b, "\x1b[1;%dH%s", visibleLen(bar)+1, showCursor)
+	case renaming:
+		fmt.Fprintf(&b, "\x1b[%d;%dH%s", rows, visibleLen(status)+1, showCursor)
+	}
+	io.WriteString(w, b.String())
+}
+
+// line writes text as the row y of the screen.
+func line(b *strings.Builder, y int, text string) {
+	fmt.Fprintf(b, "\x1b[%d;1H%s%s", y, text, clearLine)
+}
+
+// fit cuts s, which may contain color escape sequences, to width columns
+// or pads it with spaces to them.
+func fit(s string, width int) string {
+	var b strings.Builder
+	n := 0
+	styled := false
+	for i := 0; i < len(s); {
+		if s[i] == 0x1b {
+			end := strings.IndexByte(s[i:], 'm')
+			if end < 0 {
+				break
+			}
+			b.WriteString(s[i : i+end+1])
+			styled = true
+			i += end + 1
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		if r == '\t' {
+			r = ' '
+		}
+		if r < ' ' {
+			continue
+		}
+		if n == width-1 && i < len(s) && visibleLen(s[i:]) > 0 {
+			b.WriteString("…")
+			n++
+			break
+		}
+		if n >= width {
+			break
+		}
+		b.WriteRune(r)
+		n++
+	}
+	if styled {
+		b.WriteString(reset)
+	}
+	b.WriteString(strings.Repeat(" ", max(width-n, 0)))
+	return b.String()
+}
+
+// visibleLen returns the number of columns s takes, not counting color
+// escape sequences.
+func visibleLen(s string) int {
+	n := 0
+	for i := 0; i < len(s); {
+		if s[i] == 0x1b {
+			end := strings.IndexByte(s[i:], 'm')
+			if end < 0 {
+				break
+			}
+			i += end + 1
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		if r >= ' ' || r == '\t' {
+			n++
+		}
+	}
+	return n
+}
+
+// Run shows the interface to v on the terminal in and out until the user
+// quits. copy puts text on the clipboard. The terminal is restored to its
+// normal mode while tasks prompt, see Vault, and when Run returns.
+func Run(in, out *os.File, v Vault, copy func(text string) error) error {
+	restore, err := storage.MakeRaw(in)
+	if err != nil {
+		return err
+	}
+	io.WriteString(out, enterScreen)
+	defer func() {
+		io.WriteString(out, leaveScreen)
+		if restore != nil {
+			restore()
+		}
+	}()
+
+	a := newApp(v, copy)
+	buf := make([]byte, 64)
+	for !a.quit {
+		cols, rows, ok := storage.TerminalSize(out)
+		if !ok {
+			cols, rows = 80, 24
+		}
+		a.draw(out, cols, rows)
+		n, err := in.Read(buf)
+		if err != nil {
+			return err
+		}
+		for _, k := range decodeKeys(buf[:n]) {
+			task := a.handle(k)
+			if task == nil {
+				continue
+			}
+			io.WriteString(out, leaveScreen)
+			restore()
+			restore = nil
+			a.fail(task())
+			a.refresh()
+			if restore, err = storage.MakeRaw(in); err != nil {
+				return err
+			}
+			io.WriteString(out, enterScreen)
+		}
+	}
+	return nil
+}
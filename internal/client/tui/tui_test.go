@@ -0,0 +1,217 @@
+package tui
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeVault is a vault of items whose password is their ID.
+type fakeVault struct {
+	items    []Item
+	revealed []string
+}
+
+func (v *fakeVault) Items(query string) []Item {
+	var items []Item
+	for _, it := range v.items {
+		if strings.Contains(strings.ToLower(it.Name), strings.ToLower(query)) {
+			items = append(items, it)
+		}
+	}
+	return items
+}
+
+func (v *fakeVault) Detail(id string, reveal bool) string {
+	if !reveal {
+		return "ID: " + id + "\nData: (hidden)"
+	}
+	return "ID: " + id + "\nData: pass-" + id
+}
+
+func (v *fakeVault) Reveal(id string) error {
+	v.revealed = append(v.revealed, id)
+	return nil
+}
+
+func (v *fakeVault) Credentials(id string) (string, string, error) {
+	return "", "pass-" + id, nil
+}
+
+func (v *fakeVault) Rename(id, name string) error {
+	for i := range v.items {
+		if v.items[i].ID == id {
+			v.items[i].Name = name
+			return nil
+		}
+	}
+	return errors.New("not found")
+}
+
+func (v *fakeVault) Edit(id string) error { return nil }
+
+func newTestApp() (*app, *fakeVault, *[]string) {
+	v := &fakeVault{items: []Item{
+		{ID: "1", Type: "login_password", Name: "github"},
+		{ID: "2", Type: "card", Name: "visa"},
+		{ID: "3", Type: "text", Name: "root", Hidden: true},
+	}}
+	var copied []string
+	a := newApp(v, func(text string) error {
+		copied = append(copied, text)
+		return nil
+	})
+	return a, v, &copied
+}
+
+// press handles the keys of input as if typed, running the tasks.
+func press(t *testing.T, a *app, input string) {
+	t.Helper()
+	for _, k := range decodeKeys([]byte(input)) {
+		if task := a.handle(k); task != nil {
+			a.fail(task())
+			a.refresh()
+		}
+	}
+}
+
+func TestDecodeKeys(t *testing.T) {
+	got := decodeKeys([]byte("j\x1b[A\x1bOB\x1b[5~é\r\n\x1b\x7f"))
+	want := []string{"j", keyUp, keyDown, keyPageUp, "é", keyEnter, keyEnter, keyEsc, keyBackspace}
+	if !slices.Equal(got, want) {
+		t.Errorf("decodeKeys = %q; want %q", got, want)
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"abc", 5, "abc  "},
+		{"abcdef", 4, "abc…"},
+		{"abcd", 4, "abcd"},
+		{"\x1b[31mred\x1b[0m", 4, "\x1b[31mred\x1b[0m\x1b[0m "},
+		{"a\tb", 3, "a b"},
+	}
+	for _, tt := range tests {
+		if got := fit(tt.s, tt.width); got != tt.want {
+			t.Errorf("fit(%q, %d) = %q; want %q", tt.s, tt.width, got, tt.want)
+		}
+		if got := visibleLen(fit(tt.s, tt.width)); got != tt.width {
+			t.Errorf("visibleLen(fit(%q, %d)) = %d", tt.s, tt.width, got)
+		}
+	}
+}
+
+func TestApp_Navigate(t *testing.T) {
+	a, _, _ := newTestApp()
+	press(t, a, "jj")
+	if a.cursor != 2 {
+		t.Errorf("cursor after jj = %d; want 2", a.cursor)
+	}
+	press(t, a, "j")
+	if a.cursor != 2 {
+		t.Errorf("cursor moved past the end: %d", a.cursor)
+	}
+	press(t, a, "\x1b[A")
+	if a.cursor != 1 {
+		t.Errorf("cursor after up = %d; want 1", a.cursor)
+	}
+	press(t, a, "g")
+	if a.cursor != 0 {
+		t.Errorf("cursor after g = %d; want 0", a.cursor)
+	}
+	press(t, a, "q")
+	if !a.quit {
+		t.Error("q did not quit")
+	}
+}
+
+func TestApp_Search(t *testing.T) {
+	a, _, _ := newTestApp()
+	press(t, a, "/VI")
+	if len(a.items) != 1 || a.items[0].ID != "2" {
+		t.Fatalf("items after search = %v; want visa", a.items)
+	}
+	// Keys are typed into the bar until ENTER
+	press(t, a, "s\x7f\rq")
+	if a.query != "VI" || !a.quit {
+		t.Errorf("query = %q, quit = %v; want VI, true", a.query, a.quit)
+	}
+	a.quit = false
+	press(t, a, "\x1b")
+	if a.query != "" || len(a.items) != 3 {
+		t.Errorf("ESC left query %q with %d items", a.query, len(a.items))
+	}
+	if a.cursor != 1 {
+		t.Errorf("cursor = %d; want the searched item still selected", a.cursor)
+	}
+}
+
+func TestApp_Copy(t *testing.T) {
+	a, v, copied := newTestApp()
+	press(t, a, "c")
+	if !slices.Equal(*copied, []string{"pass-1"}) {
+		t.Errorf("copied = %q; want pass-1", *copied)
+	}
+	if !strings.Contains(a.status, "github") {
+		t.Errorf("status = %q", a.status)
+	}
+	press(t, a, "u")
+	if !strings.Contains(a.status, "Error") || len(*copied) != 1 {
+		t.Errorf("copying a missing login: status %q, copied %q", a.status, *copied)
+	}
+
+	// Hidden items are revealed first
+	press(t, a, "G")
+	if task := a.handle("c"); task == nil {
+		t.Fatal("copying a hidden item did not return a task")
+	} else if err := task(); err != nil {
+		t.Fatalf("task: %v", err)
+	}
+	if !slices.Equal(v.revealed, []string{"3"}) || (*copied)[1] != "pass-3" {
+		t.Errorf("revealed = %v, copied = %q", v.revealed, *copied)
+	}
+	press(t, a, "c")
+	if len(v.revealed) != 1 {
+		t.Errorf("revealed again: %v", v.revealed)
+	}
+	press(t, a, "k")
+	if a.revealed != "" {
+		t.Errorf("moving away kept %s revealed", a.revealed)
+	}
+}
+
+func TestApp_Rename(t *testing.T) {
+	a, v, _ := newTestApp()
+	press(t, a, "rX\x7fhub\r")
+	if v.items[0].Name != "githubhub" {
+		t.Errorf("name = %q; want githubhub", v.items[0].Name)
+	}
+	press(t, a, "rnope\x1b")
+	if v.items[0].Name != "githubhub" || a.mode != browsing {
+		t.Errorf("ESC saved the name %q", v.items[0].Name)
+	}
+}
+
+func TestApp_Draw(t *testing.T) {
+	a, _, _ := newTestApp()
+	press(t, a, "G")
+	var screen strings.Builder
+	a.draw(&screen, 80, 10)
+	out := screen.String()
+	for _, want := range []string{"github", "visa", "3 secrets", "Data: (hidden)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("screen does not contain %q", want)
+		}
+	}
+	press(t, a, "\r")
+	screen.Reset()
+	a.draw(&screen, 80, 10)
+	if !strings.Contains(screen.String(), "Data: pass-3") {
+		t.Error("revealed item is not shown")
+	}
+}
@@ -0,0 +1,64 @@
+// Package clock abstracts the current time, timers and tickers, so that
+// code depending on the passage of time can be tested by advancing a Fake
+// clock instead of sleeping.
+package clock
+
+import "time"
+
+// Clock tells the time and creates timers and tickers.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Since returns the time elapsed since t.
+	Since(t time.Time) time.Duration
+	// NewTimer creates a Timer firing once after d.
+	NewTimer(d time.Duration) Timer
+	// NewTicker creates a Ticker firing every d; d must be positive.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a single event, see time.Timer.
+type Timer interface {
+	// C returns the channel the time is delivered on.
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing and reports whether it was
+	// still pending.
+	Stop() bool
+}
+
+// Ticker delivers ticks at intervals, see time.Ticker.
+type Ticker interface {
+	// C returns the channel the ticks are delivered on.
+	C() <-chan time.Time
+	// Stop turns off the Ticker.
+	Stop()
+}
+
+// Real is the Clock of the system, backed by the time package.
+var Real Clock = realClock{}
+
+// realClock implements Clock with the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time                  { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration { return time.Since(t) }
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+// realTimer adapts a time.Timer to Timer.
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+func (t realTimer) Stop() bool          { return t.t.Stop() }
+
+// realTicker adapts a time.Ticker to Ticker.
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+func (t realTicker) Stop()               { t.t.Stop() }
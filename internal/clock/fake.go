@@ -0,0 +1,145 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a Clock whose time only moves when advanced, firing the timers
+// and tickers that fall due. Like their real counterparts, they deliver on
+// channels with a buffer of one and drop ticks not received in time. It is
+// safe for concurrent use.
+type Fake struct {
+	mu      sync.Mutex
+	changed *sync.Cond // signaled when waiters are added or removed
+	now     time.Time
+	waiters []*waiter // pending timers and running tickers
+}
+
+// waiter is a pending timer or a running ticker of a Fake.
+type waiter struct {
+	at     time.Time
+	period time.Duration // 0 for timers
+	c      chan time.Time
+}
+
+// NewFake returns a Fake clock set to now.
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.changed = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now returns the time of the clock.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since returns the time elapsed on the clock since t.
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Advance moves the clock forward by d, firing the timers and ticks due on
+// the way in order, each at its time. A negative d sets the clock back, as
+// when the system clock is corrected, and fires nothing.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	end := f.now.Add(d)
+	for {
+		next := -1
+		for i, w := range f.waiters {
+			if !w.at.After(end) && (next < 0 || w.at.Before(f.waiters[next].at)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		w := f.waiters[next]
+		f.now = w.at
+		select {
+		case w.c <- w.at:
+		default:
+		}
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+		} else {
+			f.removeLocked(w)
+		}
+	}
+	f.now = end
+}
+
+// BlockUntil waits until exactly n timers and tickers are pending on the
+// clock, e.g. until a goroutine under test has created or stopped one.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) != n {
+		f.changed.Wait()
+	}
+}
+
+// NewTimer creates a Timer firing once the clock has advanced by d.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return fakeTimer{f, f.add(d, 0)}
+}
+
+// NewTicker creates a Ticker firing every time the clock has advanced by d.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return fakeTicker{f, f.add(d, d)}
+}
+
+// add registers a waiter due after d.
+func (f *Fake) add(d, period time.Duration) *waiter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &waiter{at: f.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	f.waiters = append(f.waiters, w)
+	f.changed.Broadcast()
+	return w
+}
+
+// remove unregisters w and reports whether it was pending.
+func (f *Fake) remove(w *waiter) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.removeLocked(w)
+}
+
+// removeLocked is remove with f.mu held.
+func (f *Fake) removeLocked(w *waiter) bool {
+	for i, x := range f.waiters {
+		if x == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			f.changed.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+// fakeTimer is a Timer of a Fake.
+type fakeTimer struct {
+	f *Fake
+	w *waiter
+}
+
+func (t fakeTimer) C() <-chan time.Time { return t.w.c }
+func (t fakeTimer) Stop() bool          { return t.f.remove(t.w) }
+
+// fakeTicker is a Ticker of a Fake.
+type fakeTicker struct {
+	f *Fake
+	w *waiter
+}
+
+func (t fakeTicker) C() <-chan time.Time { return t.w.c }
+func (t fakeTicker) Stop()               { t.f.remove(t.w) }
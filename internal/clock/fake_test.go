@@ -0,0 +1,72 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake_Timer(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	f := NewFake(start)
+	timer := f.NewTimer(time.Minute)
+
+	f.Advance(59 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+
+	f.Advance(time.Minute)
+	select {
+	case at := <-timer.C():
+		if want := start.Add(time.Minute); !at.Equal(want) {
+			t.Errorf("fired at %v; want %v", at, want)
+		}
+	default:
+		t.Fatal("timer did not fire")
+	}
+	if got := f.Since(start); got != 119*time.Second {
+		t.Errorf("Since(start) = %v; want 1m59s", got)
+	}
+	if timer.Stop() {
+		t.Error("Stop reported a fired timer as pending")
+	}
+}
+
+func TestFake_Ticker(t *testing.T) {
+	f := NewFake(time.Unix(0, 0))
+	ticker := f.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	// Ticks not received in time are dropped
+	f.Advance(35 * time.Second)
+	if at := <-ticker.C(); at.Unix() != 10 {
+		t.Errorf("first tick at %d; want 10", at.Unix())
+	}
+	select {
+	case at := <-ticker.C():
+		t.Fatalf("unexpected tick at %d", at.Unix())
+	default:
+	}
+
+	f.Advance(5 * time.Second)
+	if at := <-ticker.C(); at.Unix() != 40 {
+		t.Errorf("next tick at %d; want 40", at.Unix())
+	}
+}
+
+func TestFake_BlockUntil(t *testing.T) {
+	f := NewFake(time.Unix(0, 0))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		timer := f.NewTimer(time.Hour)
+		<-timer.C()
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Hour)
+	<-done
+	f.BlockUntil(0)
+}
@@ -4,9 +4,14 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"net"
 	"os"
+	"strings"
+	"time"
 )
 
 // Options holds the configuration values for the application.
@@ -19,6 +24,193 @@ type Options struct {
 
 	// Config is the path to the Config file.
 	Config string
+
+	// Check validates the configuration, the database and the TLS files,
+	// reports the outcome and exits instead of starting the server.
+	Check bool `json:"-"`
+
+	// RequireClientCert makes the main listener reject TLS handshakes that do
+	// not present a valid client certificate. Registration is then served by
+	// a separate listener on RegisterAddr.
+	RequireClientCert bool
+
+	// RegisterAddr is the listening address (ip:port) of the registration-only
+	// listener used when RequireClientCert is enabled.
+	RegisterAddr string
+
+	// CORSAllowedOrigins lists origins allowed to call the API from a browser.
+	// CORS is disabled when empty.
+	CORSAllowedOrigins []string
+
+	// CORSAllowedMethods lists HTTP methods allowed in cross-origin requests.
+	CORSAllowedMethods []string
+
+	// CORSAllowedHeaders lists request headers allowed in cross-origin requests.
+	CORSAllowedHeaders []string
+
+	// WebUI enables the embedded web interface served under /ui,
+	// together with cookie-based browser sessions.
+	WebUI bool
+
+	// SessionTTL is the lifetime of a browser session.
+	SessionTTL time.Duration
+
+	// RegisterMaxFailures is the number of failed registration attempts from
+	// one IP address that triggers a temporary ban. Zero disables the protection.
+	RegisterMaxFailures int
+
+	// RegisterBan is the duration of the first registration ban. Each further
+	// failure doubles it, up to RegisterBanMax.
+	RegisterBan time.Duration
+
+	// RegisterBanMax caps the duration of a registration ban.
+	RegisterBanMax time.Duration
+
+	// RegisterPoWBits is the difficulty, in leading zero bits, of the
+	// proof-of-work challenge required for registration. Zero disables it.
+	RegisterPoWBits int
+
+	// MinClientVersion is the oldest client build version the server
+	// recommends; older clients warn their users. Empty disables the check.
+	MinClientVersion string
+
+	// S3Endpoint is the base URL of the S3-compatible object storage large
+	// secret payloads are stored in. Payloads stay in the database when empty.
+	S3Endpoint string
+
+	// S3Bucket is the bucket holding the payloads.
+	S3Bucket string
+
+	// S3Region is the region requests to S3Endpoint are signed for.
+	S3Region string
+
+	// S3AccessKey and S3SecretKey are the object storage credentials.
+	S3AccessKey string
+	S3SecretKey string
+
+	// BlobThreshold is the compressed payload size in bytes from which
+	// payloads are stored in object storage.
+	BlobThreshold int
+
+	// RedisURL is the Redis server caching the sync state of users, e.g.
+	// redis://:password@localhost:6379/0. Caching is disabled when empty.
+	RedisURL string
+
+	// RedisTTL is how long cached sync state is kept.
+	RedisTTL time.Duration
+
+	// KMS selects the key encryption key service of at-rest encryption of
+	// secret metadata: "local", "vault" or "awskms". Encryption is disabled
+	// when empty.
+	KMS string
+
+	// MasterKeys are the local key encryption keys as name:base64key, the
+	// current one first, separated by commas.
+	MasterKeys string
+
+	// VaultAddr and VaultToken locate and authenticate to HashiCorp Vault.
+	VaultAddr  string
+	VaultToken string
+
+	// VaultTransitMount and VaultTransitKey name the Vault transit key.
+	VaultTransitMount string
+	VaultTransitKey   string
+
+	// KMSKey and KMSRegion name the AWS KMS key.
+	KMSKey    string
+	KMSRegion string
+
+	// KMSAccessKey and KMSSecretKey are the AWS credentials KMS requests
+	// are signed with. They default to AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY, never to object storage credentials from
+	// elsewhere, as the object storage may be another provider's.
+	KMSAccessKey string
+	KMSSecretKey string
+
+	// RotateKeys rewraps the data keys with the current key encryption key
+	// and starts a new data key at startup.
+	RotateKeys bool
+
+	// Retention is how long soft-deleted secrets are kept before they are
+	// purged.
+	Retention time.Duration
+
+	// CleanerInterval is the time between purges of soft-deleted secrets.
+	CleanerInterval time.Duration
+
+	// CleanerBatchSize is the number of secrets purged per statement.
+	CleanerBatchSize int
+
+	// CleanerDryRun only logs how many secrets would be purged.
+	CleanerDryRun bool
+
+	// SyncConcurrency is the most sync and purge requests of a user served
+	// at a time. Zero disables the limit.
+	SyncConcurrency int
+
+	// IntegrityInterval is the time between scans of the stored secrets
+	// for violated invariants. Zero disables the scans.
+	IntegrityInterval time.Duration
+
+	// SlowQuery is the duration from which database queries are logged as
+	// slow. Zero disables the logging.
+	SlowQuery time.Duration
+
+	// AdminAddr is the listening address (ip:port) of the operator
+	// endpoints. They are disabled when empty.
+	AdminAddr string
+
+	// NotifyInterval is the time between checks for secrets and client
+	// certificates nearing expiry. Zero disables expiry notifications.
+	NotifyInterval time.Duration
+
+	// NotifyHorizon is how long before an expiry users are notified.
+	NotifyHorizon time.Duration
+
+	// NotifyAllowPrivate lets webhook and ntfy channels target private
+	// addresses, e.g. a self-hosted ntfy server on the internal network.
+	NotifyAllowPrivate bool
+
+	// SMTPAddr is the host:port of the SMTP relay email notifications are
+	// sent through. Email channels are disabled when empty.
+	SMTPAddr string
+
+	// SMTPFrom is the sender address of email notifications.
+	SMTPFrom string
+
+	// SMTPUsername and SMTPPassword authenticate to the SMTP relay.
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// listFlag adapts a string slice to flag.Value, accepting a comma-separated list.
+type listFlag struct {
+	values *[]string
+}
+
+// String returns the comma-separated representation of the list.
+func (f listFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return strings.Join(*f.values, ",")
+}
+
+// Set replaces the list with the comma-separated items of s.
+func (f listFlag) Set(s string) error {
+	*f.values = splitList(s)
+	return nil
+}
+
+// splitList splits a comma-separated string, trimming spaces and dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 // options holds the current configuration values.
@@ -30,6 +222,47 @@ func init() {
 	flag.StringVar(&options.DatabaseDSN, "d", "", "db address")
 	flag.StringVar(&options.Config, "config", "config.json", "path to config file")
 	flag.StringVar(&options.Config, "c", "config.json", "path to config file (shorthand)")
+	flag.BoolVar(&options.Check, "check", false, "validate the configuration, database and TLS files, then exit")
+	flag.BoolVar(&options.RequireClientCert, "require-client-cert", false, "reject TLS handshakes without a client certificate")
+	flag.StringVar(&options.RegisterAddr, "register-addr", "localhost:8081", "registration listener ip:port when client certificates are required")
+	flag.Var(listFlag{&options.CORSAllowedOrigins}, "cors-origins", "comma-separated origins allowed for CORS (disabled when empty)")
+	flag.Var(listFlag{&options.CORSAllowedMethods}, "cors-methods", "comma-separated methods allowed for CORS")
+	flag.Var(listFlag{&options.CORSAllowedHeaders}, "cors-headers", "comma-separated headers allowed for CORS")
+	flag.BoolVar(&options.WebUI, "web-ui", false, "serve the embedded web UI under /ui")
+	flag.DurationVar(&options.SessionTTL, "session-ttl", 30*time.Minute, "browser session lifetime")
+	flag.IntVar(&options.RegisterMaxFailures, "register-max-failures", 5, "failed registrations per IP before a temporary ban (0 disables)")
+	flag.DurationVar(&options.RegisterBan, "register-ban", time.Minute, "duration of the first registration ban")
+	flag.DurationVar(&options.RegisterBanMax, "register-ban-max", 24*time.Hour, "maximum duration of a registration ban")
+	flag.IntVar(&options.RegisterPoWBits, "register-pow-bits", 0, "proof-of-work difficulty for registration in bits (0 disables)")
+	flag.StringVar(&options.S3Endpoint, "s3-endpoint", "", "S3-compatible object storage URL for large payloads (disabled when empty)")
+	flag.StringVar(&options.S3Bucket, "s3-bucket", "gophkeeper", "object storage bucket for large payloads")
+	flag.StringVar(&options.S3Region, "s3-region", "us-east-1", "object storage signing region")
+	flag.IntVar(&options.BlobThreshold, "blob-threshold", 1<<20, "payload size in bytes from which payloads are stored in object storage")
+	flag.StringVar(&options.RedisURL, "redis", "", "Redis URL caching the sync state of users (disabled when empty)")
+	flag.DurationVar(&options.RedisTTL, "redis-ttl", time.Minute, "lifetime of cached sync state")
+	flag.StringVar(&options.KMS, "kms", "", "key service for at-rest encryption of secret metadata: local, vault or awskms (disabled when empty)")
+	flag.StringVar(&options.VaultAddr, "vault-addr", "", "HashiCorp Vault address for -kms vault")
+	flag.StringVar(&options.VaultTransitMount, "vault-transit-mount", "transit", "mount path of the Vault transit engine")
+	flag.StringVar(&options.VaultTransitKey, "vault-transit-key", "gophkeeper", "Vault transit key wrapping the data keys")
+	flag.StringVar(&options.KMSKey, "kms-key", "", "AWS KMS key ID, ARN or alias for -kms awskms")
+	flag.StringVar(&options.KMSRegion, "kms-region", "us-east-1", "AWS KMS region")
+	flag.StringVar(&options.KMSAccessKey, "kms-access-key", "", "AWS access key ID for -kms awskms (default AWS_ACCESS_KEY_ID)")
+	flag.StringVar(&options.KMSSecretKey, "kms-secret-key", "", "AWS secret access key for -kms awskms, prefer KMS_SECRET_ACCESS_KEY as flags are visible to other local users (default AWS_SECRET_ACCESS_KEY)")
+	flag.BoolVar(&options.RotateKeys, "rotate-keys", false, "rewrap data keys with the current key encryption key and start a new data key")
+	flag.DurationVar(&options.Retention, "retention", 30*24*time.Hour, "how long soft-deleted secrets are kept")
+	flag.DurationVar(&options.CleanerInterval, "cleaner-interval", time.Hour, "time between purges of soft-deleted secrets")
+	flag.IntVar(&options.CleanerBatchSize, "cleaner-batch", 1000, "soft-deleted secrets purged per statement")
+	flag.BoolVar(&options.CleanerDryRun, "cleaner-dry-run", false, "only log how many soft-deleted secrets would be purged")
+	flag.IntVar(&options.SyncConcurrency, "sync-concurrency", 4, "most concurrent sync and purge requests per user (0 disables)")
+	flag.DurationVar(&options.IntegrityInterval, "integrity-interval", 24*time.Hour, "time between integrity scans of the stored secrets (0 disables)")
+	flag.DurationVar(&options.SlowQuery, "slow-query", 200*time.Millisecond, "duration from which database queries are logged as slow (0 disables)")
+	flag.StringVar(&options.AdminAddr, "admin-addr", "", "plain-HTTP listener ip:port of the operator endpoints, keep it private (disabled when empty)")
+	flag.DurationVar(&options.NotifyInterval, "notify-interval", time.Hour, "time between checks for expiring secrets and certificates (0 disables)")
+	flag.DurationVar(&options.NotifyHorizon, "notify-horizon", 14*24*time.Hour, "how long before an expiry users are notified")
+	flag.BoolVar(&options.NotifyAllowPrivate, "notify-allow-private", false, "allow webhook and ntfy channels to target private addresses")
+	flag.StringVar(&options.SMTPAddr, "smtp-addr", "", "SMTP relay host:port for email notifications (disabled when empty)")
+	flag.StringVar(&options.SMTPFrom, "smtp-from", "gophkeeper@localhost", "sender address of email notifications")
+	flag.StringVar(&options.MinClientVersion, "min-client-version", "", "oldest recommended client version reported by /api/version")
 }
 
 // Parse parses the command-line flags and environment variables to set
@@ -59,5 +292,124 @@ func Parse() *Options {
 		options.Port = serverAddress
 	}
 
+	if registerAddress := os.Getenv("REGISTER_ADDRESS"); registerAddress != "" {
+		options.RegisterAddr = registerAddress
+	}
+
+	if corsOrigins := os.Getenv("CORS_ALLOWED_ORIGINS"); corsOrigins != "" {
+		options.CORSAllowedOrigins = splitList(corsOrigins)
+	}
+
+	if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
+		options.RedisURL = redisURL
+	}
+
+	if accessKey := os.Getenv("AWS_ACCESS_KEY_ID"); accessKey != "" {
+		options.S3AccessKey = accessKey
+	}
+
+	if secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY"); secretKey != "" {
+		options.S3SecretKey = secretKey
+	}
+
+	if accessKey := os.Getenv("KMS_ACCESS_KEY_ID"); accessKey != "" {
+		options.KMSAccessKey = accessKey
+	}
+
+	if secretKey := os.Getenv("KMS_SECRET_ACCESS_KEY"); secretKey != "" {
+		options.KMSSecretKey = secretKey
+	}
+
+	// Without KMS credentials of their own, those of the AWS environment
+	// apply
+	if options.KMSAccessKey == "" && options.KMSSecretKey == "" {
+		options.KMSAccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		options.KMSSecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+
+	if masterKeys := os.Getenv("GOPHKEEPER_MASTER_KEYS"); masterKeys != "" {
+		options.MasterKeys = masterKeys
+	}
+
+	if vaultAddr := os.Getenv("VAULT_ADDR"); vaultAddr != "" {
+		options.VaultAddr = vaultAddr
+	}
+
+	if vaultToken := os.Getenv("VAULT_TOKEN"); vaultToken != "" {
+		options.VaultToken = vaultToken
+	}
+
+	if smtpUsername := os.Getenv("SMTP_USERNAME"); smtpUsername != "" {
+		options.SMTPUsername = smtpUsername
+	}
+
+	if smtpPassword := os.Getenv("SMTP_PASSWORD"); smtpPassword != "" {
+		options.SMTPPassword = smtpPassword
+	}
+
 	return options
 }
+
+// Validate reports the mistakes in the options that would make the server
+// fail at startup or misbehave later, e.g. a missing database DSN,
+// listeners sharing an address or a key service without keys. All
+// mistakes found are joined into the error.
+func (o *Options) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	addr := func(name, value string) {
+		if _, _, err := net.SplitHostPort(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid address %q, want host:port", name, value))
+		}
+	}
+
+	check(o.DatabaseDSN != "", "no database DSN, set -d")
+	addr("-a", o.Port)
+	if o.RequireClientCert {
+		addr("-register-addr", o.RegisterAddr)
+		check(o.RegisterAddr != o.Port, "-register-addr must differ from -a")
+	}
+	if o.AdminAddr != "" {
+		addr("-admin-addr", o.AdminAddr)
+		check(o.AdminAddr != o.Port, "-admin-addr must differ from -a")
+	}
+
+	check(o.Retention > 0, "-retention must be positive")
+	check(o.CleanerInterval > 0, "-cleaner-interval must be positive")
+	check(o.CleanerBatchSize > 0, "-cleaner-batch must be positive")
+	check(o.SessionTTL > 0 || !o.WebUI, "-session-ttl must be positive")
+	check(o.RegisterPoWBits >= 0 && o.RegisterPoWBits <= 32, "-register-pow-bits must be between 0 and 32")
+	check(o.SyncConcurrency >= 0, "-sync-concurrency must not be negative")
+	check(o.IntegrityInterval >= 0, "-integrity-interval must not be negative")
+	check(o.NotifyInterval >= 0, "-notify-interval must not be negative")
+
+	if o.S3Endpoint != "" {
+		check(o.S3Bucket != "", "-s3-bucket is required with -s3-endpoint")
+		check(o.S3AccessKey != "" && o.S3SecretKey != "", "object storage needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		check(o.BlobThreshold > 0, "-blob-threshold must be positive")
+	}
+	if o.RedisURL != "" {
+		check(o.RedisTTL > 0, "-redis-ttl must be positive")
+	}
+	switch o.KMS {
+	case "":
+	case "local":
+		check(o.MasterKeys != "", "-kms local needs GOPHKEEPER_MASTER_KEYS")
+	case "vault":
+		check(o.VaultAddr != "" && o.VaultToken != "", "-kms vault needs VAULT_ADDR and VAULT_TOKEN")
+	case "awskms":
+		check(o.KMSKey != "", "-kms awskms needs -kms-key")
+		check(o.KMSAccessKey != "" && o.KMSSecretKey != "", "-kms awskms needs KMS_ACCESS_KEY_ID and KMS_SECRET_ACCESS_KEY, or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	default:
+		errs = append(errs, fmt.Errorf("unknown key service %q, want local, vault or awskms", o.KMS))
+	}
+	if o.SMTPAddr != "" {
+		addr("-smtp-addr", o.SMTPAddr)
+		check(o.SMTPFrom != "", "-smtp-from is required with -smtp-addr")
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// validOptions returns options that pass Validate.
+func validOptions() *Options {
+	return &Options{
+		Port:             "localhost:8080",
+		DatabaseDSN:      "host=localhost dbname=gophkeeper",
+		RegisterAddr:     "localhost:8081",
+		SessionTTL:       30 * time.Minute,
+		Retention:        30 * 24 * time.Hour,
+		CleanerInterval:  time.Hour,
+		CleanerBatchSize: 1000,
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	if err := validOptions().Validate(); err != nil {
+		t.Fatalf("Validate() = %v; want nil", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(o *Options)
+		want   string
+	}{
+		{"no DSN", func(o *Options) { o.DatabaseDSN = "" }, "no database DSN"},
+		{"bad address", func(o *Options) { o.Port = "8080" }, `-a: invalid address "8080"`},
+		{"shared register address", func(o *Options) {
+			o.RequireClientCert = true
+			o.RegisterAddr = o.Port
+		}, "-register-addr must differ"},
+		{"shared admin address", func(o *Options) { o.AdminAddr = o.Port }, "-admin-addr must differ"},
+		{"no retention", func(o *Options) { o.Retention = 0 }, "-retention must be positive"},
+		{"pow bits", func(o *Options) { o.RegisterPoWBits = 64 }, "-register-pow-bits"},
+		{"object storage without keys", func(o *Options) { o.S3Endpoint = "https://s3.example.com" }, "AWS_ACCESS_KEY_ID"},
+		{"local kms without keys", func(o *Options) { o.KMS = "local" }, "GOPHKEEPER_MASTER_KEYS"},
+		{"aws kms with object storage keys", func(o *Options) {
+			o.KMS, o.KMSKey = "awskms", "alias/gophkeeper"
+			o.S3AccessKey, o.S3SecretKey = "s3-id", "s3-secret"
+		}, "KMS_ACCESS_KEY_ID"},
+		{"unknown kms", func(o *Options) { o.KMS = "hsm" }, `unknown key service "hsm"`},
+		{"smtp without sender", func(o *Options) { o.SMTPAddr = "mail:25" }, "-smtp-from"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			o := validOptions()
+			tc.modify(o)
+			err := o.Validate()
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Validate() = %v; want error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestOptions_ValidateJoinsErrors(t *testing.T) {
+	o := validOptions()
+	o.DatabaseDSN = ""
+	o.CleanerBatchSize = 0
+
+	err := o.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil; want errors")
+	}
+	if lines := strings.Split(err.Error(), "\n"); len(lines) != 2 {
+		t.Errorf("Validate() reported %d mistakes; want 2: %v", len(lines), err)
+	}
+}
@@ -0,0 +1,519 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// A backup is a logical dump in JSON lines: a header, one line per row, in
+// an order that satisfies the foreign keys, and a trailer with the number
+// of rows and the SHA-256 of all preceding lines:
+//
+//	{"format":"gophkeeper-backup","version":1,"created_at":1700000000,"user":"alice"}
+//	{"table":"users","row":["alice"]}
+//	{"table":"secrets","row":["id1","alice","text","ZGF0YQ==","note",3,false,"",[],false,1700000000,0]}
+//	{"rows":2,"sha256":"..."}
+//
+// Rows are arrays of column values in the order of backupTables. Sessions
+// and registration attempts are short-lived and not backed up, neither are
+// payloads in object storage.
+
+// BackupFormat and BackupVersion identify the backup format.
+const (
+	BackupFormat  = "gophkeeper-backup"
+	BackupVersion = 1
+)
+
+// columnKind selects how a column is scanned and encoded.
+type columnKind int
+
+const (
+	kindText      columnKind = iota // TEXT, possibly NULL; JSON string or null
+	kindBytes                       // BYTEA; JSON base64 string
+	kindInt                         // BIGINT; JSON number
+	kindBool                        // BOOLEAN
+	kindTextArray                   // TEXT[]; JSON array of strings
+)
+
+// backupTable describes a backed up table.
+type backupTable struct {
+	name    string
+	columns []string
+	kinds   []columnKind
+	// userColumn holds the login of the owner, for backups of one user.
+	// Tables without one are backed up in full.
+	userColumn string
+	// ownerID is set if the table references its owner by user ID: the
+	// backup holds the login in place of userColumn, and the ID is looked
+	// up again on restore, so backups do not depend on user IDs.
+	ownerID bool
+	// orderBy keeps dumps stable.
+	orderBy string
+	// conflict is appended to inserts of rows that may already exist when
+	// restoring one user.
+	conflict string
+}
+
+// backupTables lists the backed up tables, parents first.
+var backupTables = []backupTable{
+	{
+		name: "users", columns: []string{"login"}, kinds: []columnKind{kindText},
+		userColumn: "login", orderBy: "login",
+	},
+	{
+		name:       "secrets",
+		columns:    []string{"id", "user_login", "type", "data", "comment", "version", "deleted", "folder", "tags", "reprompt", "modified_at", "expires_at", "name"},
+		kinds:      []columnKind{kindText, kindText, kindText, kindBytes, kindText, kindInt, kindBool, kindText, kindTextArray, kindBool, kindInt, kindInt, kindText},
+		userColumn: "user_login", ownerID: true, orderBy: "u.login, x.id",
+	},
+	{
+		name: "api_tokens", columns: []string{"token_hash", "user_login", "created_at", "ttl", "expires_at", "lease_id"},
+		kinds:      []columnKind{kindText, kindText, kindInt, kindInt, kindInt, kindText},
+		userColumn: "user_login", ownerID: true, orderBy: "x.token_hash",
+	},
+	{
+		name: "recovery_codes", columns: []string{"code_hash", "user_login", "created_at"},
+		kinds:      []columnKind{kindText, kindText, kindInt},
+		userColumn: "user_login", ownerID: true, orderBy: "x.code_hash",
+	},
+	{
+		name: "certificates", columns: []string{"serial", "user_login", "fingerprint", "issued_at", "revoked_at"},
+		kinds:      []columnKind{kindText, kindText, kindText, kindInt, kindInt},
+		userColumn: "user_login", ownerID: true, orderBy: "x.serial",
+	},
+	{
+		name: "devices", columns: []string{"user_login", "device_id", "last_sync", "last_seen"},
+		kinds:      []columnKind{kindText, kindText, kindInt, kindInt},
+		userColumn: "user_login", ownerID: true, orderBy: "u.login, x.device_id",
+	},
+	{
+		// IDs are assigned again on restore, keeping the order
+		name: "audit_log", columns: []string{"created_at", "user_login", "ip", "action", "detail"},
+		kinds:      []columnKind{kindInt, kindText, kindText, kindText, kindText},
+		userColumn: "user_login", orderBy: "id",
+	},
+	{
+		// IDs are assigned again on restore, keeping the order
+		name: "secret_access", columns: []string{"user_login", "secret_id", "device_id", "accessed_at"},
+		kinds:      []columnKind{kindText, kindText, kindText, kindInt},
+		userColumn: "user_login", ownerID: true, orderBy: "x.id",
+	},
+	{
+		// IDs are assigned again on restore, keeping the order
+		name: "notification_channels", columns: []string{"user_login", "kind", "target", "events"},
+		kinds:      []columnKind{kindText, kindText, kindText, kindTextArray},
+		userColumn: "user_login", ownerID: true, orderBy: "x.id",
+	},
+	{
+		name: "notifications_sent", columns: []string{"user_login", "event_key", "sent_at"},
+		kinds:      []columnKind{kindText, kindText, kindInt},
+		userColumn: "user_login", ownerID: true, orderBy: "u.login, x.event_key",
+	},
+	{
+		// Data keys are needed to read the metadata of any user
+		name: "data_keys", columns: []string{"id", "wrapped", "kek", "created_at"},
+		kinds:   []columnKind{kindText, kindBytes, kindText, kindInt},
+		orderBy: "id", conflict: "ON CONFLICT (id) DO NOTHING",
+	},
+}
+
+// BackupHeader is the first line of a backup.
+type BackupHeader struct {
+	Format    string `json:"format"`
+	Version   int    `json:"version"`
+	CreatedAt int64  `json:"created_at"`
+	// User is the login of the backed up user, empty for full backups.
+	User string `json:"user,omitempty"`
+}
+
+// backupLine is any line of a backup.
+type backupLine struct {
+	BackupHeader
+	Table  string            `json:"table,omitempty"`
+	Row    []json.RawMessage `json:"row,omitempty"`
+	Rows   *int64            `json:"rows,omitempty"`
+	SHA256 string            `json:"sha256,omitempty"`
+}
+
+// Backup writes a backup of all data, or of the data of user if not empty,
+// to w. It reads within one repeatable-read transaction, so the backup is
+// consistent while the server keeps running. It returns the number of rows
+// written.
+func Backup(ctx context.Context, db *sql.DB, w io.Writer, user string) (int64, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	bw := &backupWriter{w: w, sum: sha256.New()}
+	bw.line(BackupHeader{Format: BackupFormat, Version: BackupVersion, CreatedAt: time.Now().Unix(), User: user})
+	for _, t := range backupTables {
+		if err := dumpTable(ctx, tx, bw, t, user); err != nil {
+			return 0, fmt.Errorf("backup %s: %w", t.name, err)
+		}
+	}
+	rows := bw.rows
+	bw.line(backupLine{Rows: &rows, SHA256: hex.EncodeToString(bw.sum.Sum(nil))})
+	if bw.err != nil {
+		return 0, bw.err
+	}
+	return rows, nil
+}
+
+// dumpTable writes the rows of t, or of user if not empty.
+func dumpTable(ctx context.Context, tx *sql.Tx, bw *backupWriter, t backupTable, user string) error {
+	query := "SELECT " + strings.Join(t.columns, ", ") + " FROM " + t.name
+	owner := t.userColumn
+	if t.ownerID {
+		columns := make([]string, len(t.columns))
+		for i, c := range t.columns {
+			columns[i] = "x." + c
+		}
+		columns[slices.Index(t.columns, t.userColumn)] = "u.login"
+		query = "SELECT " + strings.Join(columns, ", ") + " FROM " + t.name + " x JOIN users u ON u.id = x.user_id"
+		owner = "u.login"
+	}
+	var args []any
+	if user != "" && t.userColumn != "" {
+		query += " WHERE " + owner + " = $1"
+		args = append(args, user)
+	}
+	rows, err := tx.QueryContext(ctx, query+" ORDER BY "+t.orderBy, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		dest := make([]any, len(t.kinds))
+		for i, kind := range t.kinds {
+			switch kind {
+			case kindText:
+				dest[i] = new(sql.NullString)
+			case kindBytes:
+				dest[i] = new([]byte)
+			case kindInt:
+				dest[i] = new(int64)
+			case kindBool:
+				dest[i] = new(bool)
+			case kindTextArray:
+				dest[i] = new(pq.StringArray)
+			}
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("scan: %w", err)
+		}
+		row := make([]any, len(dest))
+		for i, d := range dest {
+			switch d := d.(type) {
+			case *sql.NullString:
+				if d.Valid {
+					row[i] = d.String
+				}
+			case *pq.StringArray:
+				row[i] = []string(*d)
+				if *d == nil {
+					row[i] = []string{}
+				}
+			default:
+				row[i] = d
+			}
+		}
+		bw.line(struct {
+			Table string `json:"table"`
+			Row   []any  `json:"row"`
+		}{t.name, row})
+		bw.rows++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return bw.err
+}
+
+// backupWriter writes lines of a backup and hashes them.
+type backupWriter struct {
+	w    io.Writer
+	sum  hash.Hash
+	rows int64
+	err  error
+}
+
+// line writes v as one JSON line, remembering the first error.
+func (bw *backupWriter) line(v any) {
+	if bw.err != nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		bw.err = err
+		return
+	}
+	data = append(data, '\n')
+	bw.sum.Write(data)
+	_, bw.err = bw.w.Write(data)
+}
+
+// backupReader reads and checks the lines of a backup.
+type backupReader struct {
+	r      *bufio.Reader
+	sum    hash.Hash
+	header BackupHeader
+	rows   int64
+}
+
+// newBackupReader reads the header of a backup.
+func newBackupReader(r io.Reader) (*backupReader, error) {
+	br := &backupReader{r: bufio.NewReader(r), sum: sha256.New()}
+	line, err := br.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line.Format != BackupFormat {
+		return nil, errors.New("not a GophKeeper backup")
+	}
+	if line.Version != BackupVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", line.Version)
+	}
+	br.header = line.BackupHeader
+	return br, nil
+}
+
+// readLine reads and decodes one line, adding it to the checksum.
+func (br *backupReader) readLine() (*backupLine, error) {
+	data, err := br.r.ReadBytes('\n')
+	if err == io.EOF {
+		return nil, errors.New("backup is truncated")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var line backupLine
+	if err := json.Unmarshal(data, &line); err != nil {
+		return nil, fmt.Errorf("invalid backup line: %w", err)
+	}
+	if line.SHA256 == "" {
+		br.sum.Write(data)
+	}
+	return &line, nil
+}
+
+// next returns the table and values of the next row, or an empty table
+// name after the trailer was read and checked.
+func (br *backupReader) next() (*backupTable, []any, error) {
+	line, err := br.readLine()
+	if err != nil {
+		return nil, nil, err
+	}
+	if line.SHA256 != "" {
+		if line.Rows == nil || *line.Rows != br.rows {
+			return nil, nil, fmt.Errorf("backup has %d rows, trailer says %v", br.rows, line.Rows)
+		}
+		if hex.EncodeToString(br.sum.Sum(nil)) != line.SHA256 {
+			return nil, nil, errors.New("backup checksum mismatch")
+		}
+		if extra, _ := br.r.Peek(1); len(bytes.TrimSpace(extra)) > 0 {
+			return nil, nil, errors.New("data after backup trailer")
+		}
+		return nil, nil, nil
+	}
+
+	var t *backupTable
+	for i := range backupTables {
+		if backupTables[i].name == line.Table {
+			t = &backupTables[i]
+		}
+	}
+	if t == nil {
+		return nil, nil, fmt.Errorf("unknown table %q in backup", line.Table)
+	}
+	if len(line.Row) != len(t.columns) {
+		return nil, nil, fmt.Errorf("%s row has %d columns, want %d", t.name, len(line.Row), len(t.columns))
+	}
+	values := make([]any, len(line.Row))
+	for i, raw := range line.Row {
+		if values[i], err = decodeValue(raw, t.kinds[i]); err != nil {
+			return nil, nil, fmt.Errorf("%s.%s: %w", t.name, t.columns[i], err)
+		}
+	}
+	br.rows++
+	return t, values, nil
+}
+
+// decodeValue decodes a column value for use as a query argument.
+func decodeValue(raw json.RawMessage, kind columnKind) (any, error) {
+	switch kind {
+	case kindText:
+		var v *string
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case kindBytes:
+		var v []byte
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case kindInt:
+		var v int64
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case kindBool:
+		var v bool
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	default:
+		var v []string
+		err := json.Unmarshal(raw, &v)
+		if v == nil {
+			v = []string{}
+		}
+		return pq.Array(v), err
+	}
+}
+
+// VerifyBackup reads a backup and checks its structure and checksum
+// without touching a database. It returns the header and number of rows.
+func VerifyBackup(r io.Reader) (*BackupHeader, int64, error) {
+	br, err := newBackupReader(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	for {
+		t, _, err := br.next()
+		if err != nil {
+			return nil, 0, err
+		}
+		if t == nil {
+			return &br.header, br.rows, nil
+		}
+	}
+}
+
+// ErrRestoreConflict is returned by Restore when the data to be restored
+// already exists and replacing it was not requested.
+var ErrRestoreConflict = errors.New("database already holds the data to restore")
+
+// Restore restores a backup written by Backup within one transaction, which
+// is committed only if the whole backup was read and its checksum matches.
+// A full backup restores all data, a backup of one user only that user's.
+// If the database already holds data in that scope, Restore fails with
+// ErrRestoreConflict unless replace is set, in which case the existing data
+// is deleted first. Such a restore rolls the vaults back: the users record
+// the time of the backup and of the restore, so that syncs tell the
+// clients to drop the copies they hold from in between, see
+// service.SyncService.Upload. The schema must exist, see InitPostgres.
+func Restore(ctx context.Context, db *sql.DB, r io.Reader, replace bool) (*BackupHeader, int64, error) {
+	br, err := newBackupReader(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	user := br.header.User
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if user == "" {
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users)`).Scan(&exists)
+	} else {
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE login = $1)`, user).Scan(&exists)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("check existing data: %w", err)
+	}
+	if exists && !replace {
+		return nil, 0, ErrRestoreConflict
+	}
+	if replace {
+		if err := deleteScope(ctx, tx, user); err != nil {
+			return nil, 0, fmt.Errorf("delete existing data: %w", err)
+		}
+	}
+
+	for {
+		t, values, err := br.next()
+		if err != nil {
+			return nil, 0, err
+		}
+		if t == nil {
+			break
+		}
+		if user != "" && t.userColumn != "" {
+			owner, _ := values[slices.Index(t.columns, t.userColumn)].(*string)
+			if owner == nil || *owner != user {
+				return nil, 0, fmt.Errorf("backup of %s holds a %s row of another user", user, t.name)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, insertQuery(t), values...); err != nil {
+			return nil, 0, fmt.Errorf("restore %s: %w", t.name, err)
+		}
+	}
+
+	if exists {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE users SET rolled_back_from = $1, rolled_back_at = $2 WHERE $3 = '' OR login = $3`,
+			br.header.CreatedAt, time.Now().Unix(), user,
+		); err != nil {
+			return nil, 0, fmt.Errorf("record rollback: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, fmt.Errorf("commit: %w", err)
+	}
+	return &br.header, br.rows, nil
+}
+
+// deleteScope deletes all data, or the data of user if not empty. Deleting
+// users cascades to their secrets, tokens, codes, sessions and devices.
+func deleteScope(ctx context.Context, tx *sql.Tx, user string) error {
+	if user == "" {
+		for _, q := range []string{`DELETE FROM users`, `DELETE FROM audit_log`, `DELETE FROM data_keys`} {
+			if _, err := tx.ExecContext(ctx, q); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE login = $1`, user); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM audit_log WHERE user_login = $1`, user)
+	return err
+}
+
+// insertQuery returns the statement inserting a row of t.
+func insertQuery(t *backupTable) string {
+	columns := slices.Clone(t.columns)
+	params := make([]string, len(t.columns))
+	for i := range params {
+		params[i] = "$" + strconv.Itoa(i+1)
+	}
+	if t.ownerID {
+		i := slices.Index(t.columns, t.userColumn)
+		columns[i] = "user_id"
+		params[i] = "(SELECT id FROM users WHERE login = " + params[i] + ")"
+	}
+	q := "INSERT INTO " + t.name + " (" + strings.Join(columns, ", ") + ") VALUES (" + strings.Join(params, ", ") + ")"
+	if t.conflict != "" {
+		q += " " + t.conflict
+	}
+	return q
+}
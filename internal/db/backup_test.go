@@ -0,0 +1,140 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+// expectDump expects the backup queries of alice's data, with one secret,
+// one device and one data key.
+func expectDump(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT login FROM users WHERE login = $1 ORDER BY login`)).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"login"}).AddRow("alice"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT x.id, u.login, x.type, x.data, x.comment, x.version, x.deleted, x.folder, x.tags, x.reprompt, x.modified_at, x.expires_at, x.name FROM secrets x JOIN users u ON u.id = x.user_id WHERE u.login = $1 ORDER BY u.login, x.id`)).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_login", "type", "data", "comment", "version", "deleted", "folder", "tags", "reprompt", "modified_at", "expires_at", "name"}).
+			AddRow("s1", "alice", "text", []byte{0, 1, 2}, nil, int64(3), false, "work", "{a,b}", true, int64(1700000000), int64(1800000000), "enc-name"))
+	mock.ExpectQuery(`FROM api_tokens`).WillReturnRows(sqlmock.NewRows([]string{"token_hash", "user_login", "created_at", "ttl", "expires_at", "lease_id"}))
+	mock.ExpectQuery(`FROM recovery_codes`).WillReturnRows(sqlmock.NewRows([]string{"code_hash", "user_login", "created_at"}))
+	mock.ExpectQuery(`FROM certificates`).WillReturnRows(sqlmock.NewRows([]string{"serial", "user_login", "fingerprint", "issued_at", "revoked_at"}))
+	mock.ExpectQuery(`FROM devices`).
+		WillReturnRows(sqlmock.NewRows([]string{"user_login", "device_id", "last_sync", "last_seen"}).AddRow("alice", "ff", int64(100), int64(120)))
+	mock.ExpectQuery(`FROM audit_log`).WillReturnRows(sqlmock.NewRows([]string{"created_at", "user_login", "ip", "action", "detail"}))
+	mock.ExpectQuery(`FROM secret_access`).WillReturnRows(sqlmock.NewRows([]string{"user_login", "secret_id", "device_id", "accessed_at"}))
+	mock.ExpectQuery(`FROM notification_channels`).WillReturnRows(sqlmock.NewRows([]string{"user_login", "kind", "target", "events"}))
+	mock.ExpectQuery(`FROM notifications_sent`).WillReturnRows(sqlmock.NewRows([]string{"user_login", "event_key", "sent_at"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, wrapped, kek, created_at FROM data_keys ORDER BY id`)).
+		WithoutArgs().
+		WillReturnRows(sqlmock.NewRows([]string{"id", "wrapped", "kek", "created_at"}).AddRow("k1", []byte("wrapped"), "local:k1", int64(5)))
+	mock.ExpectRollback()
+}
+
+func TestBackupRestore(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer dbMock.Close()
+	ctx := context.Background()
+
+	expectDump(mock)
+	var buf bytes.Buffer
+	n, err := Backup(ctx, dbMock, &buf, "alice")
+	if err != nil {
+		t.Fatalf("Backup returned error: %v", err)
+	}
+	if n != 4 {
+		t.Errorf("Backup wrote %d rows; want 4", n)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unfulfilled expectations: %v", err)
+	}
+
+	header, rows, err := VerifyBackup(bytes.NewReader(buf.Bytes()))
+	if err != nil || header.User != "alice" || rows != 4 {
+		t.Fatalf("VerifyBackup = %+v, %d, %v; want alice's 4 rows", header, rows, err)
+	}
+
+	// Restoring replaces alice's data
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM users WHERE login = $1)`)).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM users WHERE login = $1`)).WithArgs("alice").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM audit_log WHERE user_login = $1`)).WithArgs("alice").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users (login) VALUES ($1)`)).
+		WithArgs("alice").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO secrets (id, user_id, type, data, comment, version, deleted, folder, tags, reprompt, modified_at, expires_at, name) VALUES ($1, (SELECT id FROM users WHERE login = $2), $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`)).
+		WithArgs("s1", "alice", "text", []byte{0, 1, 2}, nil, int64(3), false, "work", pq.Array([]string{"a", "b"}), true, int64(1700000000), int64(1800000000), "enc-name").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO devices (user_id, device_id, last_sync, last_seen) VALUES ((SELECT id FROM users WHERE login = $1), $2, $3, $4)`)).
+		WithArgs("alice", "ff", int64(100), int64(120)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO data_keys (id, wrapped, kek, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT (id) DO NOTHING`)).
+		WithArgs("k1", []byte("wrapped"), "local:k1", int64(5)).WillReturnResult(sqlmock.NewResult(0, 1))
+	// The replaced vault was rolled back to the backup
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET rolled_back_from = $1, rolled_back_at = $2 WHERE $3 = '' OR login = $3`)).
+		WithArgs(header.CreatedAt, sqlmock.AnyArg(), "alice").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if _, rows, err := Restore(ctx, dbMock, bytes.NewReader(buf.Bytes()), true); err != nil || rows != 4 {
+		t.Fatalf("Restore = %d, %v; want 4 rows", rows, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRestore_ExistingData(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer dbMock.Close()
+
+	backup := `{"format":"gophkeeper-backup","version":1,"created_at":1}` + "\n" + `{"rows":0,"sha256":"x"}` + "\n"
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM users)`)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	if _, _, err := Restore(context.Background(), dbMock, strings.NewReader(backup), false); !errors.Is(err, ErrRestoreConflict) {
+		t.Errorf("Restore = %v; want ErrRestoreConflict", err)
+	}
+}
+
+func TestVerifyBackup_Corrupted(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer dbMock.Close()
+	expectDump(mock)
+	var buf bytes.Buffer
+	if _, err := Backup(context.Background(), dbMock, &buf, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	backup := buf.String()
+	lines := strings.SplitAfter(backup, "\n")
+
+	cases := map[string]string{
+		"changed row":   strings.Replace(backup, `"ff"`, `"fe"`, 1),
+		"missing row":   strings.Replace(backup, lines[2], "", 1),
+		"truncated":     strings.Join(lines[:3], ""),
+		"not a backup":  "{}\n",
+		"unknown table": strings.Replace(backup, `"devices"`, `"sessions"`, 1),
+	}
+	for name, data := range cases {
+		if _, _, err := VerifyBackup(strings.NewReader(data)); err == nil {
+			t.Errorf("%s: VerifyBackup succeeded; want error", name)
+		}
+	}
+}
@@ -1,41 +1,243 @@
 package db
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
+	"math/rand/v2"
+	"sync"
 	"time"
 
+	"github.com/atinyakov/GophKeeper/internal/clock"
 	"go.uber.org/zap"
 )
 
-// StartSoftDeleteCleaner deleted old secrets with interval
+// DefaultCleanerBatchSize is the number of secrets a SoftDeleteCleaner
+// deletes per statement unless BatchSize is set.
+const DefaultCleanerBatchSize = 1000
+
+// CleanerRun reports one run of a SoftDeleteCleaner.
+type CleanerRun struct {
+	// Started is when the run started.
+	Started time.Time `json:"started"`
+	// Duration is how long the run took.
+	Duration time.Duration `json:"duration_ns"`
+	// Removed is the number of secrets deleted, or that would have been
+	// deleted in a dry run.
+	Removed int64 `json:"removed"`
+	// Batches is the number of delete statements executed.
+	Batches int `json:"batches"`
+	// DryRun is set if nothing was deleted.
+	DryRun bool `json:"dry_run"`
+	// Error describes why the run failed, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// CleanerStats summarizes the runs of a SoftDeleteCleaner since it was
+// created.
+type CleanerStats struct {
+	// Runs is the number of runs, including failed ones.
+	Runs int64 `json:"runs"`
+	// Failures is the number of failed runs.
+	Failures int64 `json:"failures"`
+	// Removed is the number of secrets deleted by all runs.
+	Removed int64 `json:"removed"`
+	// Last is the most recent run, nil before the first one.
+	Last *CleanerRun `json:"last,omitempty"`
+}
+
+// SoftDeleteCleaner purges secrets soft-deleted longer than Retention ago.
+// It deletes in batches of BatchSize rows, each in its own statement, so
+// that a large backlog does not hold locks on the table for long. Runs are
+// serialized; it is safe for concurrent use.
+type SoftDeleteCleaner struct {
+	// DB is the database the secrets are stored in.
+	DB *sql.DB
+	// Retention is how long tombstones are kept for clients to sync them.
+	Retention time.Duration
+	// BatchSize is the number of rows deleted per statement;
+	// DefaultCleanerBatchSize when zero.
+	BatchSize int
+	// DryRun only counts the secrets that would be deleted.
+	DryRun bool
+	// Log receives a line per run that removed rows or failed.
+	Log *zap.Logger
+	// Clock schedules the runs and tells their time; clock.Real when nil.
+	Clock clock.Clock
+
+	run   sync.Mutex // held during a run
+	mu    sync.Mutex // guards stats
+	stats CleanerStats
+}
+
+// NewSoftDeleteCleaner constructs a SoftDeleteCleaner with the default
+// batch size.
+func NewSoftDeleteCleaner(db *sql.DB, retention time.Duration, log *zap.Logger) *SoftDeleteCleaner {
+	return &SoftDeleteCleaner{DB: db, Retention: retention, Log: log}
+}
+
+// StartSoftDeleteCleaner deletes old soft-deleted secrets every interval
+// until ctx is done, see SoftDeleteCleaner.
 func StartSoftDeleteCleaner(
 	ctx context.Context,
 	db *sql.DB,
 	interval time.Duration,
 	retention time.Duration,
 	log *zap.Logger,
+) *SoftDeleteCleaner {
+	c := NewSoftDeleteCleaner(db, retention, log)
+	c.Start(ctx, interval)
+	return c
+}
+
+// Start runs the cleaner every interval until ctx is done. The first run
+// is delayed by a random fraction of the interval, so that server
+// instances started together do not clean at the same time.
+func (c *SoftDeleteCleaner) Start(ctx context.Context, interval time.Duration) {
+	clk := c.clock()
+	go func() {
+		jitter := clk.NewTimer(rand.N(interval))
+		defer jitter.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-jitter.C():
+		}
+
+		ticker := clk.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			_, _ = c.Run(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	}()
+}
+
+// Run deletes the secrets soft-deleted before the retention period, or
+// counts them in a dry run. A run started while another is in progress
+// waits for it.
+func (c *SoftDeleteCleaner) Run(ctx context.Context) (CleanerRun, error) {
+	c.run.Lock()
+	defer c.run.Unlock()
+
+	run := CleanerRun{Started: c.clock().Now(), DryRun: c.DryRun}
+	err := c.clean(ctx, &run)
+	run.Duration = c.clock().Since(run.Started)
+	if err != nil {
+		run.Error = err.Error()
+		c.Log.Error("failed to clean soft-deleted secrets", zap.Error(err),
+			zap.Int64("removed", run.Removed), zap.Duration("duration", run.Duration))
+	} else if run.Removed > 0 {
+		msg := "cleaned soft-deleted secrets"
+		if run.DryRun {
+			msg = "dry run: soft-deleted secrets to clean"
+		}
+		c.Log.Info(msg, zap.Int64("removed", run.Removed),
+			zap.Int("batches", run.Batches), zap.Duration("duration", run.Duration))
+	}
+
+	c.mu.Lock()
+	c.stats.Runs++
+	c.stats.Removed += run.Removed
+	if err != nil {
+		c.stats.Failures++
+	}
+	last := run
+	c.stats.Last = &last
+	c.mu.Unlock()
+	return run, err
+}
+
+// clean executes one run, recording its progress in run.
+func (c *SoftDeleteCleaner) clean(ctx context.Context, run *CleanerRun) error {
+	cutoff := run.Started.Add(-c.Retention).Unix()
+	if c.DryRun {
+		return c.DB.QueryRowContext(ctx,
+			`SELECT count(*) FROM secrets WHERE deleted = true AND version < $1`, cutoff,
+		).Scan(&run.Removed)
+	}
+
+	batch := c.BatchSize
+	if batch <= 0 {
+		batch = DefaultCleanerBatchSize
+	}
+	for {
+		res, err := c.DB.ExecContext(ctx, `
+            DELETE FROM secrets
+             WHERE ctid IN (
+                   SELECT ctid FROM secrets
+                    WHERE deleted = true
+                      AND version < $1
+                    LIMIT $2)
+        `, cutoff, batch)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		run.Batches++
+		run.Removed += rows
+		if rows < int64(batch) {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// clock returns the Clock of the cleaner.
+func (c *SoftDeleteCleaner) clock() clock.Clock {
+	return cmp.Or(c.Clock, clock.Real)
+}
+
+// Stats returns a summary of the runs so far.
+func (c *SoftDeleteCleaner) Stats() CleanerStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// StartExpiredSessionCleaner periodically removes expired browser sessions.
+func StartExpiredSessionCleaner(
+	ctx context.Context,
+	db *sql.DB,
+	interval time.Duration,
+	log *zap.Logger,
+) {
+	startExpiredSessionCleaner(ctx, db, interval, clock.Real, log)
+}
+
+// startExpiredSessionCleaner is StartExpiredSessionCleaner on clk.
+func startExpiredSessionCleaner(
+	ctx context.Context,
+	db *sql.DB,
+	interval time.Duration,
+	clk clock.Clock,
+	log *zap.Logger,
 ) {
-	ticker := time.NewTicker(interval)
+	ticker := clk.NewTicker(interval)
 	go func() {
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case <-ticker.C:
-				cutoff := time.Now().Add(-retention).Unix()
-				res, err := db.ExecContext(ctx, `
-                    DELETE FROM secrets
-                     WHERE deleted = true
-                       AND version < $1
-                `, cutoff)
+			case <-ticker.C():
+				res, err := db.ExecContext(ctx,
+					`DELETE FROM sessions WHERE expires_at < $1`, clk.Now().Unix())
 				if err != nil {
-					log.Error("failed to clean soft-deleted secrets", zap.Error(err))
+					log.Error("failed to clean expired sessions", zap.Error(err))
 					continue
 				}
 				if rows, _ := res.RowsAffected(); rows > 0 {
-					log.Info("cleaned soft-deleted secrets", zap.Int64("removed", rows))
+					log.Info("cleaned expired sessions", zap.Int64("removed", rows))
 				}
 			}
 		}
@@ -9,36 +9,64 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/atinyakov/GophKeeper/internal/clock"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-func TestStartSoftDeleteCleaner_Success(t *testing.T) {
+// waitFor waits for cond, which goroutines under test make true after
+// the clock has advanced, failing the test if it takes seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSoftDeleteCleaner_Start(t *testing.T) {
 	dbMock, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("failed to open sqlmock database: %v", err)
 	}
 	defer dbMock.Close()
 
+	clk := clock.NewFake(time.Unix(1700000000, 0))
 	mock.ExpectExec("DELETE FROM secrets").
-		WithArgs(sqlmock.AnyArg()).
+		WithArgs(sqlmock.AnyArg(), DefaultCleanerBatchSize).
 		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("DELETE FROM secrets").
+		WithArgs(sqlmock.AnyArg(), DefaultCleanerBatchSize).
+		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	logger := zap.NewNop()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	c := NewSoftDeleteCleaner(dbMock, time.Hour, zap.NewNop())
+	c.Clock = clk
+	c.Start(ctx, time.Minute)
+
+	// The first run waits for the jitter, which is less than the interval
+	clk.BlockUntil(1)
+	if runs := c.Stats().Runs; runs != 0 {
+		t.Fatalf("%d runs before the jitter; want none", runs)
+	}
+	clk.Advance(time.Minute)
+	waitFor(t, "the first run", func() bool { return c.Stats().Runs == 1 })
+	if last := c.Stats().Last; last.Started.Before(time.Unix(1700000000, 0)) || last.Removed != 3 {
+		t.Errorf("first run = %+v; want 3 rows removed at the clock's time", last)
+	}
 
-	StartSoftDeleteCleaner(ctx, dbMock, 10*time.Millisecond, time.Hour, logger)
-
-	time.Sleep(200 * time.Millisecond)
-	cancel()
-
+	clk.Advance(time.Minute)
+	waitFor(t, "the second run", func() bool { return c.Stats().Runs == 2 })
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("unfulfilled expectations: %v", err)
 	}
 }
 
-func TestStartSoftDeleteCleaner_ErrorLogged(t *testing.T) {
+func TestSoftDeleteCleaner_StartErrorLogged(t *testing.T) {
 	dbMock, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("failed to open sqlmock database: %v", err)
@@ -46,7 +74,7 @@ func TestStartSoftDeleteCleaner_ErrorLogged(t *testing.T) {
 	defer dbMock.Close()
 
 	mock.ExpectExec("DELETE FROM secrets").
-		WithArgs(sqlmock.AnyArg()).
+		WithArgs(sqlmock.AnyArg(), DefaultCleanerBatchSize).
 		WillReturnError(fmt.Errorf("db fail"))
 
 	var buf bytes.Buffer
@@ -60,11 +88,14 @@ func TestStartSoftDeleteCleaner_ErrorLogged(t *testing.T) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	c := NewSoftDeleteCleaner(dbMock, time.Hour, logger)
+	c.Clock = clk
+	c.Start(ctx, time.Minute)
 
-	StartSoftDeleteCleaner(ctx, dbMock, 10*time.Millisecond, time.Hour, logger)
-
-	time.Sleep(200 * time.Millisecond)
-	cancel()
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	waitFor(t, "the failed run", func() bool { return c.Stats().Failures == 1 })
 
 	out := buf.String()
 	if !strings.Contains(out, "failed to clean soft-deleted secrets") {
@@ -76,22 +107,103 @@ func TestStartSoftDeleteCleaner_ErrorLogged(t *testing.T) {
 	}
 }
 
-func TestStartSoftDeleteCleaner_CancelBeforeTicker(t *testing.T) {
+func TestSoftDeleteCleaner_StartCancelBeforeJitter(t *testing.T) {
 	dbMock, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("failed to open sqlmock database: %v", err)
 	}
 	defer dbMock.Close()
 
-	logger := zap.NewNop()
 	ctx, cancel := context.WithCancel(context.Background())
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	c := NewSoftDeleteCleaner(dbMock, time.Hour, zap.NewNop())
+	c.Clock = clk
+	c.Start(ctx, time.Minute)
 
-	StartSoftDeleteCleaner(ctx, dbMock, 100*time.Millisecond, time.Hour, logger)
+	// The goroutine stops its jitter timer on the way out
+	clk.BlockUntil(1)
 	cancel()
-
-	time.Sleep(50 * time.Millisecond)
+	clk.BlockUntil(0)
+	clk.Advance(time.Hour)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("unexpected sql calls: %v", err)
 	}
+	if runs := c.Stats().Runs; runs != 0 {
+		t.Errorf("%d runs after cancellation; want none", runs)
+	}
+}
+
+func TestSoftDeleteCleaner_Batches(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer dbMock.Close()
+
+	// Full batches are followed by another until one comes back short
+	mock.ExpectExec("DELETE FROM secrets").WithArgs(sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("DELETE FROM secrets").WithArgs(sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("DELETE FROM secrets").WithArgs(sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM secrets").WithArgs(sqlmock.AnyArg(), 2).WillReturnError(fmt.Errorf("db fail"))
+
+	c := NewSoftDeleteCleaner(dbMock, time.Hour, zap.NewNop())
+	c.BatchSize = 2
+	run, err := c.Run(context.Background())
+	if err != nil || run.Removed != 5 || run.Batches != 3 {
+		t.Errorf("Run = %+v, %v; want 5 rows in 3 batches", run, err)
+	}
+	if _, err := c.Run(context.Background()); err == nil {
+		t.Error("Run succeeded; want the database error")
+	}
+
+	stats := c.Stats()
+	if stats.Runs != 2 || stats.Failures != 1 || stats.Removed != 5 || stats.Last == nil || stats.Last.Error != "db fail" {
+		t.Errorf("Stats = %+v; want 2 runs, 1 failure and 5 rows", stats)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestSoftDeleteCleaner_DryRun(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer dbMock.Close()
+
+	mock.ExpectQuery("SELECT count").WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(int64(7)))
+
+	c := NewSoftDeleteCleaner(dbMock, time.Hour, zap.NewNop())
+	c.DryRun = true
+	run, err := c.Run(context.Background())
+	if err != nil || run.Removed != 7 || !run.DryRun || run.Batches != 0 {
+		t.Errorf("Run = %+v, %v; want a dry run counting 7 rows", run, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestStartExpiredSessionCleaner(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer dbMock.Close()
+
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	mock.ExpectExec("DELETE FROM sessions").
+		WithArgs(int64(1700000060)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	startExpiredSessionCleaner(ctx, dbMock, time.Minute, clk, zap.NewNop())
+
+	clk.Advance(time.Minute)
+	waitFor(t, "the sessions to be cleaned", func() bool { return mock.ExpectationsWereMet() == nil })
 }
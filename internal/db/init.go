@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -12,25 +13,200 @@ CREATE TABLE IF NOT EXISTS users (
     login TEXT PRIMARY KEY
 );
 
+-- Other tables reference users by this immutable ID, so that logins can be
+-- renamed
+ALTER TABLE users ADD COLUMN IF NOT EXISTS id UUID NOT NULL DEFAULT gen_random_uuid() UNIQUE;
+
+-- Logins are unique regardless of case. Databases created before may hold
+-- logins differing only by case: these belong to different users, with
+-- certificates of their own, so rather than merging them the migration
+-- stops until an operator renames them.
+DO $$
+DECLARE
+    dups TEXT;
+BEGIN
+    IF to_regclass('users_login_lower_idx') IS NULL THEN
+        SELECT string_agg(logins, '; ') INTO dups FROM (
+            SELECT string_agg(login, ', ' ORDER BY login) AS logins
+              FROM users GROUP BY lower(login) HAVING count(*) > 1
+        ) d;
+        IF dups IS NOT NULL THEN
+            RAISE EXCEPTION 'logins differing only by case: %', dups
+                USING HINT = 'rename all but one of each, e.g. UPDATE users SET login = ''alice2'' WHERE login = ''Alice'', then restart';
+        END IF;
+    END IF;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_login_lower_idx ON users (lower(login));
+
+-- The parameters the clients derive the vault key from the master password
+-- with, as JSON. They are stored for the user's other devices and never
+-- interpreted by the server.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS kdf TEXT NOT NULL DEFAULT '';
+
+-- A restore over live data rolls the vault back to the backup: copies of
+-- its secrets with versions after rolled_back_from, when the backup was
+-- made, up to rolled_back_at, when it was restored, are no longer the
+-- server's, see Restore.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS rolled_back_from BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS rolled_back_at BIGINT NOT NULL DEFAULT 0;
+
 CREATE TABLE IF NOT EXISTS secrets (
-    id TEXT PRIMARY KEY,
-    user_login TEXT REFERENCES users(login) ON DELETE CASCADE,
+    id TEXT NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     type TEXT NOT NULL,
     data BYTEA NOT NULL,
     comment TEXT,
     version BIGINT NOT NULL,
-    deleted BOOLEAN NOT NULL DEFAULT FALSE
+    deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (user_id, id)
+);
+
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS folder TEXT NOT NULL DEFAULT '';
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS reprompt BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS modified_at BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS expires_at BIGINT NOT NULL DEFAULT 0;
+-- Names are encrypted by the clients, like data
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS name TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS secrets_expires_idx ON secrets (expires_at) WHERE expires_at > 0;
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at BIGINT NOT NULL
+);
+
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS ttl BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS expires_at BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS lease_id TEXT NOT NULL DEFAULT '';
+UPDATE api_tokens SET lease_id = left(token_hash, 16) WHERE lease_id = '';
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    code_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    csrf_token TEXT NOT NULL,
+    expires_at BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS devices (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id TEXT NOT NULL,
+    last_sync BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, device_id)
+);
+
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS last_seen BIGINT NOT NULL DEFAULT 0;
+
+-- The audit trail is keyed by login so that it outlives its user; renames
+-- move it along with the user
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    created_at BIGINT NOT NULL,
+    user_login TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    detail TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS notification_channels (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    target TEXT NOT NULL,
+    events TEXT[] NOT NULL DEFAULT '{}'
+);
+
+CREATE TABLE IF NOT EXISTS notifications_sent (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_key TEXT NOT NULL,
+    sent_at BIGINT NOT NULL,
+    PRIMARY KEY (user_id, event_key)
+);
+
+CREATE TABLE IF NOT EXISTS certificates (
+    serial TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    fingerprint TEXT NOT NULL,
+    issued_at BIGINT NOT NULL,
+    revoked_at BIGINT NOT NULL DEFAULT 0
+);
+
+-- Move databases from references to users by login, and secrets keyed by
+-- ID alone, to references by user ID. Rows without an owner were never
+-- reachable and are dropped.
+DO $$
+DECLARE
+    t TEXT;
+    moved TEXT[] := '{}';
+BEGIN
+    FOREACH t IN ARRAY ARRAY['secrets', 'api_tokens', 'recovery_codes', 'sessions', 'devices',
+                             'secret_access', 'notification_channels', 'notifications_sent', 'certificates'] LOOP
+        IF EXISTS (SELECT 1 FROM information_schema.columns
+                    WHERE table_schema = current_schema() AND table_name = t AND column_name = 'user_login') THEN
+            EXECUTE format('ALTER TABLE %I ADD COLUMN IF NOT EXISTS user_id UUID', t);
+            EXECUTE format('UPDATE %I x SET user_id = u.id FROM users u WHERE u.login = x.user_login', t);
+            EXECUTE format('DELETE FROM %I WHERE user_id IS NULL', t);
+            EXECUTE format('ALTER TABLE %I ALTER COLUMN user_id SET NOT NULL', t);
+            EXECUTE format('ALTER TABLE %I DROP COLUMN user_login CASCADE', t);
+            EXECUTE format('ALTER TABLE %I ADD FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE', t);
+            moved := moved || t;
+        END IF;
+    END LOOP;
+
+    IF 'secrets' = ANY(moved) THEN
+        ALTER TABLE secrets DROP CONSTRAINT IF EXISTS secrets_pkey CASCADE;
+        ALTER TABLE secrets ADD PRIMARY KEY (user_id, id);
+    END IF;
+    IF 'devices' = ANY(moved) THEN
+        ALTER TABLE devices ADD PRIMARY KEY (user_id, device_id);
+    END IF;
+    IF 'notifications_sent' = ANY(moved) THEN
+        ALTER TABLE notifications_sent ADD PRIMARY KEY (user_id, event_key);
+    END IF;
+    IF 'secret_access' = ANY(moved) THEN
+        ALTER TABLE secret_access ADD FOREIGN KEY (user_id, secret_id)
+            REFERENCES secrets (user_id, id) ON DELETE CASCADE;
+    END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS secret_access (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    secret_id TEXT NOT NULL,
+    device_id TEXT NOT NULL,
+    accessed_at BIGINT NOT NULL,
+    FOREIGN KEY (user_id, secret_id) REFERENCES secrets (user_id, id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS secret_access_secret_idx ON secret_access (user_id, secret_id, accessed_at);
+
+CREATE TABLE IF NOT EXISTS data_keys (
+    id TEXT PRIMARY KEY,
+    wrapped BYTEA NOT NULL,
+    kek TEXT NOT NULL,
+    created_at BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS registration_attempts (
+    ip TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_attempt BIGINT NOT NULL,
+    banned_until BIGINT NOT NULL DEFAULT 0
 );
 `
 
 func InitPostgres(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("postgres", dsn)
+	db, err := Connect(context.Background(), dsn)
 	if err != nil {
-		return nil, fmt.Errorf("open postgres: %w", err)
-	}
-
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("ping postgres: %w", err)
+		return nil, err
 	}
 
 	if _, err := db.Exec(schema); err != nil {
@@ -39,3 +215,18 @@ func InitPostgres(dsn string) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// Connect opens the PostgreSQL database at dsn and checks that it can be
+// reached, without creating or migrating the schema, see InitPostgres.
+func Connect(ctx context.Context, dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open postgres: %w", err)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("ping postgres: %w", err)
+	}
+	return db, nil
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// schemaTableRe and schemaColumnRe find the tables and added columns in
+// schema, see schemaColumns.
+var (
+	schemaTableRe  = regexp.MustCompile(`(?s)CREATE TABLE IF NOT EXISTS (\w+) \((.*?)\n\);`)
+	schemaColumnRe = regexp.MustCompile(`ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS (\w+)`)
+)
+
+// schemaColumns returns the columns schema creates as "table.column",
+// sorted. Table constraints are not columns and are left out.
+func schemaColumns(schema string) []string {
+	var columns []string
+	for _, m := range schemaTableRe.FindAllStringSubmatch(schema, -1) {
+		for _, line := range strings.Split(m[2], "\n") {
+			name, _, _ := strings.Cut(strings.TrimSpace(line), " ")
+			switch name {
+			case "", "PRIMARY", "FOREIGN", "UNIQUE", "CONSTRAINT", "CHECK":
+				continue
+			}
+			columns = append(columns, m[1]+"."+name)
+		}
+	}
+	for _, m := range schemaColumnRe.FindAllStringSubmatch(schema, -1) {
+		columns = append(columns, m[1]+"."+m[2])
+	}
+	slices.Sort(columns)
+	return slices.Compact(columns)
+}
+
+// CheckSchema reports whether the schema InitPostgres creates has been
+// applied to db: it fails, naming them, if tables or columns are missing,
+// e.g. because the server was upgraded but not yet started against the
+// database. It only reads the catalog and changes nothing.
+func CheckSchema(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx,
+		`SELECT table_name, column_name FROM information_schema.columns WHERE table_schema = current_schema()`)
+	if err != nil {
+		return fmt.Errorf("read schema: %w", err)
+	}
+	defer rows.Close()
+
+	have := make(map[string]bool)
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return fmt.Errorf("read schema: %w", err)
+		}
+		have[table] = true
+		have[table+"."+column] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read schema: %w", err)
+	}
+
+	var missing []string
+	for _, column := range schemaColumns(schema) {
+		table, _, _ := strings.Cut(column, ".")
+		switch {
+		case !have[table]:
+			if !slices.Contains(missing, "table "+table) {
+				missing = append(missing, "table "+table)
+			}
+		case !have[column]:
+			missing = append(missing, "column "+column)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("schema not up to date, missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
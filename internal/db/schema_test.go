@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestSchemaColumns(t *testing.T) {
+	columns := schemaColumns(schema)
+	for _, want := range []string{"users.id", "secrets.user_id", "secrets.folder", "api_tokens.lease_id", "audit_log.user_login"} {
+		if !slices.Contains(columns, want) {
+			t.Errorf("schemaColumns is missing %s", want)
+		}
+	}
+	for _, c := range columns {
+		if strings.HasSuffix(c, ".PRIMARY") || strings.HasSuffix(c, ".FOREIGN") {
+			t.Errorf("schemaColumns includes constraint %s", c)
+		}
+	}
+}
+
+// catalogRows returns the rows of information_schema.columns listing
+// columns.
+func catalogRows(columns []string) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"table_name", "column_name"})
+	for _, c := range columns {
+		table, column, _ := strings.Cut(c, ".")
+		rows.AddRow(table, column)
+	}
+	return rows
+}
+
+func TestCheckSchema(t *testing.T) {
+	columns := schemaColumns(schema)
+
+	tests := []struct {
+		name    string
+		columns []string
+		want    string
+	}{
+		{"up to date", columns, ""},
+		{"missing column", slices.DeleteFunc(slices.Clone(columns), func(c string) bool { return c == "secrets.expires_at" }),
+			"missing column secrets.expires_at"},
+		{"missing table", slices.DeleteFunc(slices.Clone(columns), func(c string) bool { return strings.HasPrefix(c, "data_keys.") }),
+			"missing table data_keys"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			mock.ExpectQuery(`SELECT table_name, column_name FROM information_schema.columns`).
+				WillReturnRows(catalogRows(tc.columns))
+
+			err = CheckSchema(context.Background(), db)
+			switch {
+			case tc.want == "" && err != nil:
+				t.Errorf("CheckSchema() = %v; want nil", err)
+			case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+				t.Errorf("CheckSchema() = %v; want error containing %q", err, tc.want)
+			}
+			if tc.want == "missing table data_keys" && strings.Contains(err.Error(), "column data_keys") {
+				t.Errorf("CheckSchema() lists the columns of a missing table: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/awssig"
+)
+
+// AWSKMS wraps data keys with an AWS KMS key. KMS keeps previous versions
+// of rotated keys, so wrapped data keys stay readable after rotation;
+// restarting the server with key rotation rewraps them with the latest one.
+type AWSKMS struct {
+	// Key is the ID, ARN or alias of the KMS key.
+	Key    string
+	Region string
+	// Endpoint overrides https://kms.<Region>.amazonaws.com, e.g. for
+	// LocalStack.
+	Endpoint    string
+	Credentials awssig.Credentials
+
+	Client *http.Client
+}
+
+// KeyID returns "awskms:" and the KMS key.
+func (k *AWSKMS) KeyID() string { return "awskms:" + k.Key }
+
+// Wrap encrypts key with the KMS key.
+func (k *AWSKMS) Wrap(ctx context.Context, key []byte) ([]byte, error) {
+	var resp struct {
+		CiphertextBlob []byte
+	}
+	req := struct {
+		KeyId     string
+		Plaintext []byte
+	}{k.Key, key}
+	if err := k.call(ctx, "Encrypt", req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.CiphertextBlob, nil
+}
+
+// Unwrap decrypts a key wrapped with the KMS key.
+func (k *AWSKMS) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Plaintext []byte
+	}
+	req := struct {
+		KeyId          string
+		CiphertextBlob []byte
+	}{k.Key, wrapped}
+	if err := k.call(ctx, "Decrypt", req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Plaintext, nil
+}
+
+// call invokes a KMS action with the JSON protocol; []byte fields travel as
+// base64 as KMS expects.
+func (k *AWSKMS) call(ctx context.Context, action string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	endpoint := k.Endpoint
+	if endpoint == "" {
+		endpoint = "https://kms." + k.Region + ".amazonaws.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	awssig.Sign(req, data, k.Credentials, k.Region, "kms", time.Now())
+	return doJSON(k.Client, req, "kms "+action, out)
+}
@@ -0,0 +1,174 @@
+// Package envelope encrypts values at rest with envelope encryption: values
+// are sealed with data keys, and the data keys are stored wrapped by a key
+// encryption key held by a KeyWrapper, e.g. a KMS. Only the wrapper can
+// unwrap the data keys, so a copy of the database alone reveals nothing.
+package envelope
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sealPrefix marks sealed values. A sealed value is
+//
+//	sealPrefix || dataKeyID || "$" || base64(nonce || ciphertext)
+const sealPrefix = "$env1$"
+
+// KeyWrapper wraps and unwraps data keys with a key encryption key.
+type KeyWrapper interface {
+	// KeyID identifies the key encryption key new data keys are wrapped
+	// with.
+	KeyID() string
+	// Wrap encrypts a data key.
+	Wrap(ctx context.Context, key []byte) ([]byte, error)
+	// Unwrap decrypts a data key wrapped by Wrap, also with a previous key
+	// encryption key.
+	Unwrap(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// DataKey is a data key as stored, wrapped by a KeyWrapper.
+type DataKey struct {
+	ID        string
+	Wrapped   []byte
+	KEK       string // KeyWrapper.KeyID at the time of wrapping
+	CreatedAt int64
+}
+
+// KeyStore persists the wrapped data keys.
+type KeyStore interface {
+	ListDataKeys(ctx context.Context) ([]DataKey, error)
+	InsertDataKey(ctx context.Context, key DataKey) error
+	UpdateDataKey(ctx context.Context, key DataKey) error
+}
+
+// Sealer seals values with the current data key and opens values sealed
+// with any known data key. It is safe for concurrent use.
+type Sealer struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// Open loads and unwraps the data keys in store. It creates the first data
+// key if there is none. If rotate is set, it also rewraps every data key
+// with the current key encryption key of wrapper and creates a new data key
+// for new values; values sealed with older data keys remain readable and
+// move to the new key as they are rewritten.
+func Open(ctx context.Context, wrapper KeyWrapper, store KeyStore, rotate bool) (*Sealer, error) {
+	stored, err := store.ListDataKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list data keys: %w", err)
+	}
+	s := &Sealer{keys: make(map[string]cipher.AEAD, len(stored)+1)}
+	var newest int64
+	for _, dk := range stored {
+		key, err := wrapper.Unwrap(ctx, dk.Wrapped)
+		if err != nil {
+			return nil, fmt.Errorf("unwrap data key %s: %w", dk.ID, err)
+		}
+		if s.keys[dk.ID], err = newAEAD(key); err != nil {
+			return nil, fmt.Errorf("data key %s: %w", dk.ID, err)
+		}
+		if rotate {
+			if dk.Wrapped, err = wrapper.Wrap(ctx, key); err != nil {
+				return nil, fmt.Errorf("rewrap data key %s: %w", dk.ID, err)
+			}
+			dk.KEK = wrapper.KeyID()
+			if err := store.UpdateDataKey(ctx, dk); err != nil {
+				return nil, fmt.Errorf("rewrap data key %s: %w", dk.ID, err)
+			}
+		}
+		if s.current == "" || dk.CreatedAt > newest {
+			s.current, newest = dk.ID, dk.CreatedAt
+		}
+	}
+	if len(stored) == 0 || rotate {
+		if err := s.addKey(ctx, wrapper, store); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// addKey creates, stores and selects a new data key.
+func (s *Sealer) addKey(ctx context.Context, wrapper KeyWrapper, store KeyStore) error {
+	key := make([]byte, 32)
+	id := make([]byte, 8)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	wrapped, err := wrapper.Wrap(ctx, key)
+	if err != nil {
+		return fmt.Errorf("wrap data key: %w", err)
+	}
+	dk := DataKey{ID: hex.EncodeToString(id), Wrapped: wrapped, KEK: wrapper.KeyID(), CreatedAt: time.Now().Unix()}
+	if err := store.InsertDataKey(ctx, dk); err != nil {
+		return fmt.Errorf("store data key: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	s.keys[dk.ID] = aead
+	s.current = dk.ID
+	return nil
+}
+
+// Seal encrypts value with the current data key. The additional data aad
+// binds the sealed value to its place, e.g. its row and column; Open must be
+// given the same aad.
+func (s *Sealer) Seal(value, aad string) (string, error) {
+	aead := s.keys[s.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(aad))
+	return sealPrefix + s.current + "$" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value sealed by Seal. Values that are not sealed, such as
+// those stored before encryption was enabled, are returned as they are.
+func (s *Sealer) Open(value, aad string) (string, error) {
+	rest, ok := strings.CutPrefix(value, sealPrefix)
+	if !ok {
+		return value, nil
+	}
+	id, enc, ok := strings.Cut(rest, "$")
+	if !ok {
+		return "", errors.New("malformed sealed value")
+	}
+	aead, ok := s.keys[id]
+	if !ok {
+		return "", fmt.Errorf("unknown data key %s", id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(enc)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed sealed value")
+	}
+	n := aead.NonceSize()
+	plain, err := aead.Open(nil, sealed[:n], sealed[n:], []byte(aad))
+	if err != nil {
+		return "", fmt.Errorf("open sealed value: %w", err)
+	}
+	return string(plain), nil
+}
+
+// newAEAD returns AES-256-GCM with key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,128 @@
+package envelope
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// memStore is an in-memory KeyStore.
+type memStore struct {
+	keys []DataKey
+}
+
+func (m *memStore) ListDataKeys(ctx context.Context) ([]DataKey, error) {
+	return append([]DataKey(nil), m.keys...), nil
+}
+
+func (m *memStore) InsertDataKey(ctx context.Context, key DataKey) error {
+	m.keys = append(m.keys, key)
+	return nil
+}
+
+func (m *memStore) UpdateDataKey(ctx context.Context, key DataKey) error {
+	for i := range m.keys {
+		if m.keys[i].ID == key.ID {
+			m.keys[i] = key
+		}
+	}
+	return nil
+}
+
+func masterKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func TestSealer(t *testing.T) {
+	ctx := context.Background()
+	wrapper, err := ParseLocalKeys("k1:" + masterKey('a'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &memStore{}
+	s, err := Open(ctx, wrapper, store, false)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	if len(store.keys) != 1 || store.keys[0].KEK != "local:k1" {
+		t.Fatalf("data keys = %+v; want one wrapped with local:k1", store.keys)
+	}
+
+	sealed, err := s.Seal("my bank", "alice/s1/comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, sealPrefix) || strings.Contains(sealed, "bank") {
+		t.Errorf("Seal = %q; want an opaque sealed value", sealed)
+	}
+	if got, err := s.Open(sealed, "alice/s1/comment"); err != nil || got != "my bank" {
+		t.Errorf("Open = %q, %v; want my bank", got, err)
+	}
+	if _, err := s.Open(sealed, "alice/s2/comment"); err == nil {
+		t.Error("Open with other additional data succeeded; want error")
+	}
+	if got, err := s.Open("plain", "alice/s1/comment"); err != nil || got != "plain" {
+		t.Errorf("Open of unsealed value = %q, %v; want it unchanged", got, err)
+	}
+
+	// Reopening uses the stored data key
+	s2, err := Open(ctx, wrapper, store, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s2.Open(sealed, "alice/s1/comment"); err != nil || got != "my bank" {
+		t.Errorf("Open after reopening = %q, %v; want my bank", got, err)
+	}
+	if len(store.keys) != 1 {
+		t.Errorf("reopening created a data key")
+	}
+}
+
+func TestSealer_Rotate(t *testing.T) {
+	ctx := context.Background()
+	old, _ := ParseLocalKeys("k1:" + masterKey('a'))
+	store := &memStore{}
+	s, _ := Open(ctx, old, store, false)
+	sealed, _ := s.Seal("v", "aad")
+
+	// A new master key is added in front of the old one
+	rotated, _ := ParseLocalKeys("k2:" + masterKey('b') + ",k1:" + masterKey('a'))
+	s2, err := Open(ctx, rotated, store, true)
+	if err != nil {
+		t.Fatalf("Open with rotation returned error: %v", err)
+	}
+	if len(store.keys) != 2 {
+		t.Fatalf("data keys = %d; want a new one", len(store.keys))
+	}
+	for _, dk := range store.keys {
+		if dk.KEK != "local:k2" {
+			t.Errorf("data key %s wrapped with %s; want local:k2", dk.ID, dk.KEK)
+		}
+	}
+	if got, err := s2.Open(sealed, "aad"); err != nil || got != "v" {
+		t.Errorf("Open of value sealed before rotation = %q, %v; want v", got, err)
+	}
+	resealed, _ := s2.Seal("v", "aad")
+	if strings.Split(resealed, "$")[2] == strings.Split(sealed, "$")[2] {
+		t.Error("new values are sealed with the old data key")
+	}
+
+	// The old master key is no longer needed
+	current, _ := ParseLocalKeys("k2:" + masterKey('b'))
+	s3, err := Open(ctx, current, store, false)
+	if err != nil {
+		t.Fatalf("Open without the old master key returned error: %v", err)
+	}
+	if got, err := s3.Open(sealed, "aad"); err != nil || got != "v" {
+		t.Errorf("Open = %q, %v; want v", got, err)
+	}
+}
+
+func TestParseLocalKeys_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "k1", "k1:short", ":" + masterKey('a'), "k1:" + masterKey('a') + ",k1:" + masterKey('b')} {
+		if _, err := ParseLocalKeys(spec); err == nil {
+			t.Errorf("ParseLocalKeys(%q) succeeded; want error", spec)
+		}
+	}
+}
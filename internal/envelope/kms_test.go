@@ -0,0 +1,89 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atinyakov/GophKeeper/internal/awssig"
+)
+
+func TestVaultTransit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "tok" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/gk":
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"ciphertext": "vault:v1:" + req["plaintext"]}})
+		case "/v1/transit/decrypt/gk":
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"plaintext": strings.TrimPrefix(req["ciphertext"], "vault:v1:")}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	v := &VaultTransit{Addr: srv.URL, Token: "tok", Key: "gk"}
+	wrapped, err := v.Wrap(ctx, []byte("data key"))
+	if err != nil || !strings.HasPrefix(string(wrapped), "vault:v1:") {
+		t.Fatalf("Wrap = %q, %v; want a transit ciphertext", wrapped, err)
+	}
+	if key, err := v.Unwrap(ctx, wrapped); err != nil || string(key) != "data key" {
+		t.Errorf("Unwrap = %q, %v; want data key", key, err)
+	}
+	if v.KeyID() != "vault:transit/gk" {
+		t.Errorf("KeyID = %s; want vault:transit/gk", v.KeyID())
+	}
+
+	v.Token = "wrong"
+	if _, err := v.Wrap(ctx, []byte("k")); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Wrap with wrong token = %v; want permission denied", err)
+	}
+}
+
+func TestAWSKMS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/kms/aws4_request") {
+			http.Error(w, `{"__type":"UnrecognizedClientException"}`, http.StatusBadRequest)
+			return
+		}
+		var req struct {
+			KeyId          string
+			Plaintext      []byte
+			CiphertextBlob []byte
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.Encrypt":
+			json.NewEncoder(w).Encode(map[string]any{"CiphertextBlob": append([]byte(req.KeyId+":"), req.Plaintext...)})
+		case "TrentService.Decrypt":
+			_, plain, _ := bytes.Cut(req.CiphertextBlob, []byte(":"))
+			json.NewEncoder(w).Encode(map[string]any{"Plaintext": plain})
+		default:
+			http.Error(w, `{"__type":"UnknownOperationException"}`, http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	k := &AWSKMS{Key: "alias/gk", Region: "eu-west-1", Endpoint: srv.URL,
+		Credentials: awssig.Credentials{AccessKey: "AKID", SecretKey: "secret"}}
+	wrapped, err := k.Wrap(ctx, []byte("data key"))
+	if err != nil || string(wrapped) != "alias/gk:data key" {
+		t.Fatalf("Wrap = %q, %v; want the KMS ciphertext", wrapped, err)
+	}
+	if key, err := k.Unwrap(ctx, wrapped); err != nil || string(key) != "data key" {
+		t.Errorf("Unwrap = %q, %v; want data key", key, err)
+	}
+
+}
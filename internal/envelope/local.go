@@ -0,0 +1,77 @@
+package envelope
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LocalKeys wraps data keys with AES-256-GCM master keys held by the
+// server, e.g. from the environment. The first key wraps new data keys; the
+// others are previous keys kept to unwrap data keys until they are
+// rewrapped.
+type LocalKeys struct {
+	names []string
+	keys  map[string]cipher.AEAD
+}
+
+// ParseLocalKeys parses a comma-separated list of name:base64key master
+// keys, the current one first, e.g. "k2:...,k1:...". Keys are 32 bytes.
+func ParseLocalKeys(spec string) (*LocalKeys, error) {
+	l := &LocalKeys{keys: make(map[string]cipher.AEAD)}
+	for _, item := range strings.Split(spec, ",") {
+		name, enc, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid master key %q, want name:base64key", item)
+		}
+		key, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("master key %s must be 32 bytes in base64", name)
+		}
+		if _, dup := l.keys[name]; dup {
+			return nil, fmt.Errorf("duplicate master key %s", name)
+		}
+		if l.keys[name], err = newAEAD(key); err != nil {
+			return nil, err
+		}
+		l.names = append(l.names, name)
+	}
+	return l, nil
+}
+
+// KeyID returns "local:" and the name of the current master key.
+func (l *LocalKeys) KeyID() string { return "local:" + l.names[0] }
+
+// Wrap encrypts key with the current master key. The result is the name of
+// the master key, a colon, the nonce and the ciphertext.
+func (l *LocalKeys) Wrap(ctx context.Context, key []byte) ([]byte, error) {
+	name := l.names[0]
+	aead := l.keys[name]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte(name+":"), nonce...)
+	return aead.Seal(out, nonce, key, []byte(name)), nil
+}
+
+// Unwrap decrypts a key wrapped with any of the master keys.
+func (l *LocalKeys) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	name, rest, ok := strings.Cut(string(wrapped), ":")
+	if !ok {
+		return nil, errors.New("malformed wrapped key")
+	}
+	aead, ok := l.keys[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key %s", name)
+	}
+	n := aead.NonceSize()
+	if len(rest) < n {
+		return nil, errors.New("malformed wrapped key")
+	}
+	return aead.Open(nil, []byte(rest[:n]), []byte(rest[n:]), []byte(name))
+}
@@ -0,0 +1,102 @@
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultTransit wraps data keys with a key of the HashiCorp Vault transit
+// secrets engine. Rotating the transit key in Vault and restarting the
+// server with key rotation rewraps the data keys with its latest version.
+type VaultTransit struct {
+	// Addr is the address of Vault, e.g. https://vault:8200.
+	Addr string
+	// Token authenticates to Vault.
+	Token string
+	// Mount is the mount path of the transit engine, "transit" by default.
+	Mount string
+	// Key is the name of the transit key.
+	Key string
+
+	Client *http.Client
+}
+
+// KeyID returns "vault:" and the path of the transit key.
+func (v *VaultTransit) KeyID() string { return "vault:" + v.mount() + "/" + v.Key }
+
+// Wrap encrypts key with the transit key.
+func (v *VaultTransit) Wrap(ctx context.Context, key []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	req := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(key)}
+	if err := v.call(ctx, "encrypt", req, &resp); err != nil {
+		return nil, err
+	}
+	return []byte(resp.Data.Ciphertext), nil
+}
+
+// Unwrap decrypts a key wrapped with any version of the transit key.
+func (v *VaultTransit) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := v.call(ctx, "decrypt", map[string]string{"ciphertext": string(wrapped)}, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
+
+func (v *VaultTransit) mount() string {
+	if v.Mount == "" {
+		return "transit"
+	}
+	return strings.Trim(v.Mount, "/")
+}
+
+// call posts body to the transit endpoint op and decodes the response into out.
+func (v *VaultTransit) call(ctx context.Context, op string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimRight(v.Addr, "/") + "/v1/" + v.mount() + "/" + op + "/" + v.Key
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", v.Token)
+	return doJSON(v.Client, req, "vault "+op, out)
+}
+
+// doJSON sends req and decodes a successful JSON response into out.
+func doJSON(client *http.Client, req *http.Request, what string, out any) error {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s: %s", what, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", what, err)
+	}
+	return nil
+}
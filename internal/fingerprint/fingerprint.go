@@ -0,0 +1,40 @@
+// Package fingerprint hashes the state of a vault, so that its replicas,
+// on the server and on every device, can be compared after a sync.
+//
+// A fingerprint is the SHA-256 digest of the ID and version of every live
+// secret, taken in ID order. It does not depend on the order in which the
+// secrets are stored or on their contents, which are encrypted with keys
+// the server never sees, so replicas that hold the same versions of the
+// same secrets have the same fingerprint.
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Versions returns the hex-encoded fingerprint of the secrets with the
+// given versions by ID.
+func Versions(versions map[string]int64) string {
+	h := sha256.New()
+	for _, id := range slices.Sorted(maps.Keys(versions)) {
+		fmt.Fprintf(h, "%s\x00%d\x00", id, versions[id])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Short returns the first 16 digits of the fingerprint fp in groups of
+// four, e.g. "3f9a 07c2 e41b 5d60", for people to compare by eye.
+func Short(fp string) string {
+	fp = fp[:min(len(fp), 16)]
+	var groups []string
+	for len(fp) > 4 {
+		groups = append(groups, fp[:4])
+		fp = fp[4:]
+	}
+	return strings.Join(append(groups, fp), " ")
+}
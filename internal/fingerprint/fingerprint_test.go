@@ -0,0 +1,41 @@
+package fingerprint
+
+import "testing"
+
+func TestVersions(t *testing.T) {
+	a := Versions(map[string]int64{"a": 1, "b": 2})
+	if b := Versions(map[string]int64{"b": 2, "a": 1}); a != b {
+		t.Errorf("fingerprint depends on map order: %s != %s", a, b)
+	}
+	if len(a) != 64 {
+		t.Errorf("len(Versions) = %d; want 64", len(a))
+	}
+	for name, versions := range map[string]map[string]int64{
+		"newer version":  {"a": 1, "b": 3},
+		"missing secret": {"a": 1},
+		"extra secret":   {"a": 1, "b": 2, "c": 1},
+		"swapped":        {"a": 2, "b": 1},
+	} {
+		if Versions(versions) == a {
+			t.Errorf("%s: fingerprint unchanged", name)
+		}
+	}
+
+	// The empty vault has the digest of no input
+	if got, want := Versions(nil), "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"; got != want {
+		t.Errorf("Versions(nil) = %s; want %s", got, want)
+	}
+}
+
+func TestShort(t *testing.T) {
+	tests := map[string]string{
+		"e3b0c44298fc1c149afbf4c8996fb924": "e3b0 c442 98fc 1c14",
+		"e3b0c4":                           "e3b0 c4",
+		"":                                 "",
+	}
+	for fp, want := range tests {
+		if got := Short(fp); got != want {
+			t.Errorf("Short(%q) = %q; want %q", fp, got, want)
+		}
+	}
+}
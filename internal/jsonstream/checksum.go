@@ -0,0 +1,61 @@
+package jsonstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+// ChecksumMismatchCode is the problem code of a request rejected as its
+// checksum does not match its content, see Checksum.
+const ChecksumMismatchCode = "checksum-mismatch"
+
+// ErrChecksumMismatch is returned by Checksum.Verify for content that does
+// not match its checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// checksumPrefix names the algorithm of the checksums.
+const checksumPrefix = "crc32c:"
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Checksum is the checksum of the elements of a JSON array, such as the
+// secrets of a sync, taken as they are encoded or decoded one at a time,
+// so that bodies truncated or mangled on the way are detected before they
+// are used. It is the CRC-32C of the compact encoding of each element
+// followed by a newline: whitespace does not change it, any other change
+// does. The zero value is the checksum of no elements.
+type Checksum struct {
+	crc uint32
+	buf bytes.Buffer
+}
+
+// Add adds the encoded JSON value raw to the checksum.
+func (c *Checksum) Add(raw []byte) error {
+	c.buf.Reset()
+	if err := json.Compact(&c.buf, raw); err != nil {
+		return err
+	}
+	c.buf.WriteByte('\n')
+	c.crc = crc32.Update(c.crc, castagnoli, c.buf.Bytes())
+	return nil
+}
+
+// String returns the checksum as sent along with the elements, e.g.
+// "crc32c:0a1b2c3d".
+func (c *Checksum) String() string {
+	return fmt.Sprintf("%s%08x", checksumPrefix, c.crc)
+}
+
+// Verify checks the checksum sum sent along with the elements. Empty sums,
+// from peers that do not send them, and those of other algorithms are not
+// checked. Errors match ErrChecksumMismatch.
+func (c *Checksum) Verify(sum string) error {
+	if !strings.HasPrefix(sum, checksumPrefix) || sum == c.String() {
+		return nil
+	}
+	return fmt.Errorf("%w: sent %s, received %s", ErrChecksumMismatch, sum, c.String())
+}
@@ -0,0 +1,70 @@
+// Package jsonstream decodes large JSON documents, such as the secrets of a
+// sync, one value at a time instead of materializing them as a whole.
+package jsonstream
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Object reads a JSON object from dec and calls field with each of its
+// keys. field must consume the value of the key, e.g. with dec.Decode,
+// Skip or Array.
+func Object(dec *json.Decoder, field func(key string) error) error {
+	if err := expect(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("jsonstream: unexpected %v, want object key", tok)
+		}
+		if err := field(key); err != nil {
+			return err
+		}
+	}
+	return expect(dec, '}')
+}
+
+// Array reads a JSON array from dec and calls elem once for each of its
+// elements, which elem must consume. A null array has no elements.
+func Array(dec *json.Decoder, elem func() error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("jsonstream: unexpected %v, want [", tok)
+	}
+	for dec.More() {
+		if err := elem(); err != nil {
+			return err
+		}
+	}
+	return expect(dec, ']')
+}
+
+// Skip consumes the next value from dec.
+func Skip(dec *json.Decoder) error {
+	var v json.RawMessage
+	return dec.Decode(&v)
+}
+
+// expect reads the delimiter d from dec.
+func expect(dec *json.Decoder, d json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != d {
+		return fmt.Errorf("jsonstream: unexpected %v, want %v", tok, d)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package jsonstream
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestObjectArray(t *testing.T) {
+	dec := json.NewDecoder(strings.NewReader(`{"version": 3, "extra": {"a": [1, 2]}, "items": [{"n": 1}, {"n": 2}], "none": null}`))
+
+	var (
+		version int
+		items   []int
+		keys    []string
+	)
+	err := Object(dec, func(key string) error {
+		keys = append(keys, key)
+		switch key {
+		case "version":
+			return dec.Decode(&version)
+		case "items", "none":
+			return Array(dec, func() error {
+				var it struct{ N int }
+				if err := dec.Decode(&it); err != nil {
+					return err
+				}
+				items = append(items, it.N)
+				return nil
+			})
+		default:
+			return Skip(dec)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Object returned error: %v", err)
+	}
+	if version != 3 || !slices.Equal(items, []int{1, 2}) {
+		t.Errorf("version = %d, items = %v; want 3, [1 2]", version, items)
+	}
+	if want := []string{"version", "extra", "items", "none"}; !slices.Equal(keys, want) {
+		t.Errorf("keys = %v; want %v", keys, want)
+	}
+}
+
+func TestObject_Invalid(t *testing.T) {
+	for _, in := range []string{`[]`, `{"items": {}}`, `{"items": [1,`, `not-json`} {
+		dec := json.NewDecoder(strings.NewReader(in))
+		err := Object(dec, func(key string) error {
+			return Array(dec, func() error { return Skip(dec) })
+		})
+		if err == nil {
+			t.Errorf("Object(%s) succeeded; want error", in)
+		}
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	var a, b Checksum
+	for _, raw := range []string{`{"id":"1","data":"x"}`, `{"id":"2"}`} {
+		if err := a.Add([]byte(raw)); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	// Whitespace does not matter
+	for _, raw := range []string{"{\"id\": \"1\",\n \"data\": \"x\"}", ` {"id":"2"} `} {
+		if err := b.Add([]byte(raw)); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	if err := b.Verify(a.String()); err != nil {
+		t.Errorf("Verify of reformatted elements: %v", err)
+	}
+
+	var truncated, changed Checksum
+	_ = truncated.Add([]byte(`{"id":"1","data":"x"}`))
+	_ = changed.Add([]byte(`{"id":"1","data":"y"}`))
+	_ = changed.Add([]byte(`{"id":"2"}`))
+	for name, c := range map[string]*Checksum{"truncated": &truncated, "changed": &changed} {
+		if err := c.Verify(a.String()); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("%s: Verify = %v; want ErrChecksumMismatch", name, err)
+		}
+	}
+
+	var none Checksum
+	if got, want := none.String(), "crc32c:00000000"; got != want {
+		t.Errorf("checksum of no elements = %s; want %s", got, want)
+	}
+	if err := changed.Verify(""); err != nil {
+		t.Errorf("Verify without a checksum: %v", err)
+	}
+	if err := a.Add([]byte(`{"id":`)); err == nil {
+		t.Error("Add of invalid JSON succeeded")
+	}
+}
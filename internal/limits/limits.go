@@ -0,0 +1,120 @@
+// Package limits defines the payload size limits of secrets. Clients check
+// the content entered by users against them and servers reject uploads
+// exceeding them, so that oversized payloads fail early with a clear error
+// instead of straining the JSON sync path. It also bounds how far secret
+// versions may run ahead of the server clock.
+package limits
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Credentials bounds login/password and card secrets.
+	Credentials = 4 << 10
+	// Text bounds text and binary secrets. Larger files are attached to a
+	// secret instead, which splits them into chunks.
+	Text = 1 << 20
+	// Chunk bounds the chunks attachments are split into.
+	Chunk = 256 << 10
+	// Other bounds secrets of other types, e.g. ones defined by templates.
+	Other = 64 << 10
+
+	// Manifest is the room every payload has beyond its content for the
+	// list of its attachments, about 10,000 chunks or 1 GiB of files.
+	Manifest = 1 << 20
+	// Attachment bounds a single attached file.
+	Attachment = 1 << 30
+
+	// overhead is the size the encryption adds to a payload: a 12-byte
+	// nonce and a 16-byte tag.
+	overhead = 28
+)
+
+// Content returns the maximum size in bytes of the content of a secret of
+// the given type, before encryption.
+func Content(typ string) int {
+	switch typ {
+	case "login_password", "card":
+		return Credentials
+	case "text", "binary":
+		return Text
+	case "chunk":
+		return Chunk
+	default:
+		return Other
+	}
+}
+
+// Encoded returns the maximum length of the encrypted, base64-encoded
+// payload of a secret of the given type: its content, the attachment
+// list for types that can have one, and the encryption overhead.
+func Encoded(typ string) int {
+	size := Content(typ) + overhead
+	if typ != "chunk" {
+		size += Manifest
+	}
+	return base64.StdEncoding.EncodedLen(size)
+}
+
+// SizeError reports a payload exceeding the limit of its type.
+type SizeError struct {
+	// ID is the secret, if known.
+	ID string
+	// Type is the type of the secret.
+	Type string
+	// Size and Limit are the size of the payload and its limit in bytes.
+	Size, Limit int
+}
+
+func (e *SizeError) Error() string {
+	size, limit := FormatSize(e.Size), FormatSize(e.Limit)
+	if size == limit {
+		// Rounded to the same unit, the sizes would read alike
+		size, limit = fmt.Sprintf("%d B", e.Size), fmt.Sprintf("%d B", e.Limit)
+	}
+	msg := fmt.Sprintf("%s payload of %s exceeds the limit of %s", e.Type, size, limit)
+	if e.ID != "" {
+		msg = fmt.Sprintf("secret %s: %s", e.ID, msg)
+	}
+	if e.Type == "text" || e.Type == "binary" {
+		msg += "; attach larger files to a secret instead"
+	}
+	return msg
+}
+
+// CheckContent returns a *SizeError if plain is too large for a secret of
+// the given type.
+func CheckContent(typ string, plain []byte) error {
+	if limit := Content(typ); len(plain) > limit {
+		return &SizeError{Type: typ, Size: len(plain), Limit: limit}
+	}
+	return nil
+}
+
+// CheckEncoded returns a *SizeError if the encrypted payload data of the
+// secret id is too large for its type.
+func CheckEncoded(id, typ, data string) error {
+	if limit := Encoded(typ); len(data) > limit {
+		return &SizeError{ID: id, Type: typ, Size: len(data), Limit: limit}
+	}
+	return nil
+}
+
+// FormatSize renders a size in bytes with a binary unit, e.g. "4 KiB".
+func FormatSize(n int) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := unit, 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	s := fmt.Sprintf("%.1f", float64(n)/float64(div))
+	s = strings.TrimSuffix(s, ".0")
+	return s + " " + "KMGT"[exp:exp+1] + "iB"
+}
@@ -0,0 +1,59 @@
+package limits
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckContent(t *testing.T) {
+	if err := CheckContent("login_password", bytes.Repeat([]byte("x"), Credentials)); err != nil {
+		t.Errorf("payload at the limit rejected: %v", err)
+	}
+	err := CheckContent("text", bytes.Repeat([]byte("x"), Text+1))
+	var sizeErr *SizeError
+	if !errors.As(err, &sizeErr) || sizeErr.Limit != Text {
+		t.Fatalf("CheckContent = %v; want a SizeError with the text limit", err)
+	}
+	if want := "text payload of 1048577 B exceeds the limit of 1048576 B; attach larger files to a secret instead"; err.Error() != want {
+		t.Errorf("error = %q; want %q", err, want)
+	}
+	if err := CheckContent("wifi", make([]byte, Other+1)); err == nil {
+		t.Error("oversized payload of a template type accepted")
+	}
+}
+
+func TestCheckEncoded(t *testing.T) {
+	if err := CheckEncoded("s1", "chunk", strings.Repeat("A", Encoded("chunk"))); err != nil {
+		t.Errorf("chunk at the limit rejected: %v", err)
+	}
+	err := CheckEncoded("s1", "card", strings.Repeat("A", Encoded("card")+1))
+	if err == nil || !strings.HasPrefix(err.Error(), "secret s1: card payload of") {
+		t.Errorf("CheckEncoded = %v; want a size error naming the secret", err)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for n, want := range map[int]string{512: "512 B", 4 << 10: "4 KiB", 1536: "1.5 KiB", 1 << 30: "1 GiB"} {
+		if got := FormatSize(n); got != want {
+			t.Errorf("FormatSize(%d) = %q; want %q", n, got, want)
+		}
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	if err := CheckVersion("s1", now.Add(MaxVersionSkew).Unix(), now); err != nil {
+		t.Errorf("version at the limit rejected: %v", err)
+	}
+	err := CheckVersion("s1", now.Add(48*time.Hour).Unix(), now)
+	var versionErr *VersionError
+	if !errors.As(err, &versionErr) || versionErr.ID != "s1" || versionErr.Ahead != 48*time.Hour {
+		t.Fatalf("CheckVersion = %v; want a *VersionError 48h ahead", err)
+	}
+	if !strings.Contains(err.Error(), "48h0m0s ahead of the server clock") {
+		t.Errorf("message = %q", err.Error())
+	}
+}
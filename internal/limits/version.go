@@ -0,0 +1,43 @@
+package limits
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxVersionSkew is how far ahead of the server clock the version of an
+// uploaded secret, the Unix time of its last change, may be. Versions
+// further ahead come from clients with a wrong clock; stored, they would
+// make the server drop every later change of the secret as older.
+const MaxVersionSkew = 24 * time.Hour
+
+// ErrorCodeHeader is the response header naming the kind of error of a
+// rejected request, e.g. FutureVersionCode.
+const ErrorCodeHeader = "X-Gophkeeper-Error"
+
+// FutureVersionCode identifies a *VersionError in ErrorCodeHeader.
+const FutureVersionCode = "future-version"
+
+// VersionError reports a secret version too far in the future.
+type VersionError struct {
+	// ID is the secret.
+	ID string
+	// Version is the version of the secret.
+	Version int64
+	// Ahead is how far the version is ahead of the server clock.
+	Ahead time.Duration
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("secret %s: version %d is %s ahead of the server clock, check the clock of this device",
+		e.ID, e.Version, e.Ahead.Round(time.Second))
+}
+
+// CheckVersion returns a *VersionError if version, a Unix time, is more
+// than MaxVersionSkew ahead of now.
+func CheckVersion(id string, version int64, now time.Time) error {
+	if ahead := time.Unix(version, 0).Sub(now); ahead > MaxVersionSkew {
+		return &VersionError{ID: id, Version: version, Ahead: ahead}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package logger
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// Console configures a logger of a command-line tool, see NewConsole.
+type Console struct {
+	// Level is the lowest level logged, e.g. "info" or "debug".
+	Level string
+	// JSON writes entries as JSON objects, one per line, for log
+	// collectors; otherwise they are written for people.
+	JSON bool
+	// Time prefixes human-readable entries with the time, e.g. when they
+	// are written to a file. JSON entries always carry it.
+	Time bool
+	// Decorate, if set, rewrites each human-readable entry of the given
+	// level, e.g. to prefix it with a translated level or color it. By
+	// default entries above info are prefixed with their level.
+	Decorate func(level zapcore.Level, line string) string
+}
+
+// NewConsole returns a Logger writing the entries of at least c.Level to w.
+// Human-readable entries are one line each: the message followed by the
+// fields as key=value, sorted by key.
+func NewConsole(w io.Writer, c Console) (*Logger, error) {
+	lvl, err := zap.ParseAtomicLevel(cmp.Or(c.Level, "info"))
+	if err != nil {
+		return nil, err
+	}
+
+	var enc zapcore.Encoder
+	if c.JSON {
+		cfg := zap.NewProductionEncoderConfig()
+		cfg.EncodeTime = zapcore.ISO8601TimeEncoder
+		enc = zapcore.NewJSONEncoder(cfg)
+	} else {
+		enc = humanEncoder{MapObjectEncoder: zapcore.NewMapObjectEncoder(), c: c}
+	}
+	return &Logger{Log: zap.New(zapcore.NewCore(enc, zapcore.AddSync(w), lvl))}, nil
+}
+
+// humanPool holds the buffers of human-readable entries.
+var humanPool = buffer.NewPool()
+
+// humanEncoder writes entries for people, see NewConsole. The fields added
+// with Logger.With are kept in the embedded map.
+type humanEncoder struct {
+	*zapcore.MapObjectEncoder
+	c Console
+}
+
+// Clone copies the encoder along with its fields.
+func (e humanEncoder) Clone() zapcore.Encoder {
+	m := zapcore.NewMapObjectEncoder()
+	maps.Copy(m.Fields, e.Fields)
+	return humanEncoder{MapObjectEncoder: m, c: e.c}
+}
+
+// EncodeEntry renders ent with the encoder's and the given fields.
+func (e humanEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	m := e.Clone().(humanEncoder).MapObjectEncoder
+	for _, f := range fields {
+		f.AddTo(m)
+	}
+
+	var line strings.Builder
+	line.WriteString(ent.Message)
+	for _, k := range slices.Sorted(maps.Keys(m.Fields)) {
+		fmt.Fprintf(&line, " %s=%v", k, m.Fields[k])
+	}
+	text := line.String()
+	switch {
+	case e.c.Decorate != nil:
+		text = e.c.Decorate(ent.Level, text)
+	case ent.Level > zapcore.InfoLevel:
+		text = ent.Level.CapitalString() + ": " + text
+	}
+
+	buf := humanPool.Get()
+	if e.c.Time {
+		buf.AppendString(ent.Time.Format(time.DateTime))
+		buf.AppendByte(' ')
+	}
+	buf.AppendString(text)
+	buf.AppendByte('\n')
+	return buf, nil
+}
@@ -0,0 +1,70 @@
+package logger_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/logger"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNewConsole_Human(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := logger.NewConsole(&buf, logger.Console{})
+	require.NoError(t, err)
+
+	l.Log.Debug("hidden")
+	l.Log.Info("Synced")
+	l.Log.With(zap.String("url", "https://a")).Warn("slow server", zap.Duration("took", 2*time.Second))
+	l.Log.Error("sync failed", zap.Error(errors.New("refused")))
+
+	want := "Synced\n" +
+		"WARN: slow server took=2s url=https://a\n" +
+		"ERROR: sync failed error=refused\n"
+	require.Equal(t, want, buf.String())
+}
+
+func TestNewConsole_Decorate(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := logger.NewConsole(&buf, logger.Console{
+		Level: "debug",
+		Time:  true,
+		Decorate: func(level zapcore.Level, line string) string {
+			return "<" + level.String() + "> " + line
+		},
+	})
+	require.NoError(t, err)
+
+	l.Log.Debug("request", zap.Int("status", 200))
+	line := buf.String()
+	require.True(t, strings.HasSuffix(line, " <debug> request status=200\n"), line)
+	_, err = time.Parse(time.DateTime, line[:len(time.DateTime)])
+	require.NoError(t, err, "entry does not start with the time: %q", line)
+}
+
+func TestNewConsole_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := logger.NewConsole(&buf, logger.Console{Level: "warn", JSON: true})
+	require.NoError(t, err)
+
+	l.Log.Info("hidden")
+	l.Log.Warn("slow server", zap.String("url", "https://a"))
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, "warn", entry["level"])
+	require.Equal(t, "slow server", entry["msg"])
+	require.Equal(t, "https://a", entry["url"])
+	require.Contains(t, entry, "ts")
+}
+
+func TestNewConsole_InvalidLevel(t *testing.T) {
+	_, err := logger.NewConsole(&bytes.Buffer{}, logger.Console{Level: "loud"})
+	require.Error(t, err)
+}
@@ -3,39 +3,111 @@ package middleware
 
 import (
 	"context"
+	"crypto/x509"
 	"net/http"
+
+	"github.com/atinyakov/GophKeeper/internal/problem"
 )
 
 type ctxKey string
 
-const userKey ctxKey = "user"
+const (
+	userKey   ctxKey = "user"
+	deviceKey ctxKey = "device"
+	leaseKey  ctxKey = "lease"
+)
+
+const (
+	// TokenDeviceID identifies requests authenticated with an API bearer token.
+	TokenDeviceID = "api-token"
+	// SessionDeviceID identifies requests authenticated with a browser session.
+	SessionDeviceID = "web-session"
+)
 
 // CertAuth is a middleware that enforces mutual TLS authentication.
 //
 // It checks whether the incoming HTTP request has a valid client certificate.
-// The /api/register endpoint is excluded from certificate validation to allow
-// new users to register and obtain a certificate.
+// The /api/register and /api/recover endpoints are excluded from certificate
+// validation to allow new users to register and obtain a certificate, and
+// users who lost theirs to obtain a replacement.
 //
 // On successful validation, it extracts the Common Name (CN) from the client's
 // certificate and stores it in the request context, so it can be used
-// downstream as the authenticated user ID.
+// downstream as the authenticated user ID. The certificate serial number is
+// stored as the device ID. Requests already authenticated by TokenAuth or
+// SessionAuth are passed through unchanged.
 func CertAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/api/register" {
-			// Allow registration without certificate
+		if r.URL.Path == "/api/register" || r.URL.Path == "/api/recover" {
+			// Allow registration and recovery without certificate
+			next.ServeHTTP(w, r)
+			return
+		}
+		if GetUserIDFromContext(r.Context()) != "" {
+			// Already authenticated by a bearer token
 			next.ServeHTTP(w, r)
 			return
 		}
 		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
-			http.Error(w, "no client certificate provided", http.StatusUnauthorized)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeCertificateRequired, "no client certificate provided")
 			return
 		}
 		cert := r.TLS.PeerCertificates[0]
 		ctx := context.WithValue(r.Context(), userKey, cert.Subject.CommonName)
+		if cert.SerialNumber != nil {
+			ctx = context.WithValue(ctx, deviceKey, cert.SerialNumber.Text(16))
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// CertificateValidator checks that a client certificate was issued to the
+// user it names.
+type CertificateValidator interface {
+	// CheckCertificate returns an error unless cert, naming login, is a
+	// known and active certificate of the user.
+	CheckCertificate(ctx context.Context, login string, cert *x509.Certificate) error
+}
+
+// CertBinding returns a middleware that rejects requests authenticated by
+// CertAuth whose certificate is not on record for the user, so that a
+// CA-signed certificate with a matching Common Name is not enough. It runs
+// after CertAuth; requests authenticated otherwise, or not at all, are
+// passed through unchanged.
+func CertBinding(v CertificateValidator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			login := GetUserIDFromContext(r.Context())
+			device := GetDeviceIDFromContext(r.Context())
+			if login == "" || device == TokenDeviceID || device == SessionDeviceID ||
+				r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err := v.CheckCertificate(r.Context(), login, r.TLS.PeerCertificates[0]); err != nil {
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "client certificate not accepted")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WithIdentity returns a copy of ctx authenticated as the given device of
+// the user, like the authentication middlewares do for HTTP requests. It
+// lets other transports, such as the gRPC API, share the handlers. leaseID
+// is the lease of the API token used, if any.
+func WithIdentity(ctx context.Context, login, deviceID, leaseID string) context.Context {
+	ctx = context.WithValue(ctx, userKey, login)
+	if deviceID != "" {
+		ctx = context.WithValue(ctx, deviceKey, deviceID)
+	}
+	if leaseID != "" {
+		ctx = context.WithValue(ctx, leaseKey, leaseID)
+	}
+	return ctx
+}
+
 // GetUserIDFromContext extracts the user ID (Common Name from client certificate)
 // from the request context. Returns an empty string if not found.
 func GetUserIDFromContext(ctx context.Context) string {
@@ -45,3 +117,14 @@ func GetUserIDFromContext(ctx context.Context) string {
 	}
 	return ""
 }
+
+// GetDeviceIDFromContext extracts the ID of the authenticated device (client
+// certificate serial number, TokenDeviceID or SessionDeviceID) from the
+// request context. Returns an empty string if not found.
+func GetDeviceIDFromContext(ctx context.Context) string {
+	val := ctx.Value(deviceKey)
+	if s, ok := val.(string); ok {
+		return s
+	}
+	return ""
+}
@@ -5,6 +5,8 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"errors"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -55,7 +57,7 @@ func TestCertAuth_NoCertificate(t *testing.T) {
 
 func TestCertAuth_ValidCertificate(t *testing.T) {
 	// create fake certificate chain
-	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}, SerialNumber: big.NewInt(0xabc)}
 	ts := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
 
 	dummy := &dummyHandler{}
@@ -76,6 +78,57 @@ func TestCertAuth_ValidCertificate(t *testing.T) {
 	if user != "alice" {
 		t.Errorf("expected context user 'alice', got '%s'", user)
 	}
+	if device := GetDeviceIDFromContext(dummy.ctx); device != "abc" {
+		t.Errorf("expected context device 'abc', got '%s'", device)
+	}
+}
+
+// fakeCertValidator accepts only the certificate with serial 0xabc.
+type fakeCertValidator struct{}
+
+func (fakeCertValidator) CheckCertificate(ctx context.Context, login string, cert *x509.Certificate) error {
+	if cert.SerialNumber.Int64() != 0xabc {
+		return errors.New("unknown certificate")
+	}
+	return nil
+}
+
+func TestCertBinding(t *testing.T) {
+	for _, tc := range []struct {
+		serial int64
+		want   int
+	}{
+		{0xabc, http.StatusOK},
+		{0xdef, http.StatusUnauthorized},
+	} {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}, SerialNumber: big.NewInt(tc.serial)}
+		dummy := &dummyHandler{}
+		h := CertAuth(CertBinding(fakeCertValidator{})(dummy))
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/data", nil)
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != tc.want || dummy.called != (tc.want == http.StatusOK) {
+			t.Errorf("serial %x: status %d, handler called %v; want %d", tc.serial, rec.Code, dummy.called, tc.want)
+		}
+	}
+}
+
+func TestCertBinding_TokenAuthenticated(t *testing.T) {
+	// Requests authenticated by a token are not checked, even with a certificate
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}, SerialNumber: big.NewInt(0xdef)}
+	dummy := &dummyHandler{}
+	h := TokenAuth(fakeTokenValidator{token: "good", login: "bob"})(CertAuth(CertBinding(fakeCertValidator{})(dummy)))
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/data", nil)
+	req.Header.Set("Authorization", "Bearer good")
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	h.ServeHTTP(rec, req)
+
+	if !dummy.called {
+		t.Errorf("status %d; want the token-authenticated request passed through", rec.Code)
+	}
 }
 
 func TestGetUserIDFromContext(t *testing.T) {
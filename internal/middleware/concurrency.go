@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/atinyakov/GophKeeper/internal/problem"
+)
+
+// ConcurrencyLimit returns a middleware that serves at most n requests of
+// each user at a time, so that a client stuck in a loop cannot hold many
+// database transactions at once. Excess requests are refused with 429 Too
+// Many Requests and a Retry-After header; clients retry them. It runs after
+// the authentication middlewares; unauthenticated requests are not limited.
+func ConcurrencyLimit(n int) func(http.Handler) http.Handler {
+	l := NewLimiter(n)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			login := GetUserIDFromContext(r.Context())
+			if login == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			release, ok := l.Acquire(login)
+			if !ok {
+				w.Header().Set("Retry-After", "1")
+				problem.Write(w, r, http.StatusTooManyRequests, problem.CodeTooManyRequests, "too many concurrent requests")
+				return
+			}
+			defer release()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Limiter counts the requests each user has in flight, see
+// ConcurrencyLimit. It is safe for concurrent use.
+type Limiter struct {
+	n        int
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+// NewLimiter returns a Limiter allowing n requests of each user at a time.
+func NewLimiter(n int) *Limiter {
+	return &Limiter{n: n, inFlight: make(map[string]int)}
+}
+
+// Acquire counts a request of login and returns the function to call when
+// it is done. It reports false, counting nothing, if login already has the
+// maximum number of requests in flight.
+func (l *Limiter) Acquire(login string) (release func(), ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[login] >= l.n {
+		return nil, false
+	}
+	l.inFlight[login]++
+	return func() {
+		l.mu.Lock()
+		// Forget idle users so the map does not grow with them
+		if l.inFlight[login]--; l.inFlight[login] == 0 {
+			delete(l.inFlight, login)
+		}
+		l.mu.Unlock()
+	}, true
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	h := ConcurrencyLimit(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if GetUserIDFromContext(r.Context()) == "alice" {
+			entered <- struct{}{}
+			<-release
+		}
+	}))
+	serve := func(login string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/sync", nil)
+		if login != "" {
+			req = req.WithContext(context.WithValue(req.Context(), userKey, login))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serve("alice")
+	}()
+	<-entered
+
+	if rec := serve("alice"); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("second request of alice: status %d, Retry-After %q; want 429 and 1", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := serve("bob"); rec.Code != http.StatusOK {
+		t.Errorf("request of bob: status %d; want 200", rec.Code)
+	}
+	if rec := serve(""); rec.Code != http.StatusOK {
+		t.Errorf("unauthenticated request: status %d; want 200", rec.Code)
+	}
+
+	close(release)
+	wg.Wait()
+	go func() { <-entered }()
+	if rec := serve("alice"); rec.Code != http.StatusOK {
+		t.Errorf("alice after the first request finished: status %d; want 200", rec.Code)
+	}
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig describes which cross-origin requests are allowed.
+type CORSConfig struct {
+	// AllowedOrigins lists origins permitted to call the API. "*" allows any origin.
+	AllowedOrigins []string
+	// AllowedMethods lists methods permitted in cross-origin requests.
+	// Defaults to GET and POST when empty.
+	AllowedMethods []string
+	// AllowedHeaders lists request headers permitted in cross-origin requests.
+	// Defaults to Content-Type when empty.
+	AllowedHeaders []string
+	// AllowCredentials permits cookies and other credentials on cross-origin requests.
+	AllowCredentials bool
+	// MaxAge is the number of seconds a preflight response may be cached; 0 omits the header.
+	MaxAge int
+}
+
+// allowsOrigin reports whether origin is listed in AllowedOrigins.
+func (c CORSConfig) allowsOrigin(origin string) bool {
+	return slices.Contains(c.AllowedOrigins, "*") || slices.Contains(c.AllowedOrigins, origin)
+}
+
+// CORS returns a middleware that adds CORS headers to responses for allowed
+// origins and answers preflight (OPTIONS) requests directly.
+//
+// Requests without an Origin header, or from an origin that is not allowed,
+// are passed through unchanged; the browser then blocks the response.
+// The request origin is echoed back instead of "*" so that credentialed
+// requests keep working.
+func CORS(cfg CORSConfig) func(http.Handler) http.Handler {
+	methods := cfg.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodPost}
+	}
+	headers := cfg.AllowedHeaders
+	if len(headers) == 0 {
+		headers = []string{"Content-Type"}
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(headers, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+			if origin == "" || !cfg.allowsOrigin(origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			// Preflight request: answer without reaching the API handlers.
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+				w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+				if cfg.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS_NoOrigin(t *testing.T) {
+	dummy := &dummyHandler{}
+	h := CORS(CORSConfig{AllowedOrigins: []string{"https://app.example"}})(dummy)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/data", nil)
+	h.ServeHTTP(rec, req)
+
+	if !dummy.called {
+		t.Error("expected next handler to be called")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected no Allow-Origin header, got %q", got)
+	}
+}
+
+func TestCORS_DisallowedOrigin(t *testing.T) {
+	dummy := &dummyHandler{}
+	h := CORS(CORSConfig{AllowedOrigins: []string{"https://app.example"}})(dummy)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/data", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	h.ServeHTTP(rec, req)
+
+	if !dummy.called {
+		t.Error("expected next handler to be called")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected no Allow-Origin header, got %q", got)
+	}
+}
+
+func TestCORS_AllowedOrigin(t *testing.T) {
+	dummy := &dummyHandler{}
+	h := CORS(CORSConfig{
+		AllowedOrigins:   []string{"https://app.example"},
+		AllowCredentials: true,
+	})(dummy)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/sync", nil)
+	req.Header.Set("Origin", "https://app.example")
+	h.ServeHTTP(rec, req)
+
+	if !dummy.called {
+		t.Error("expected next handler to be called")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example" {
+		t.Errorf("Allow-Origin = %q; want %q", got, "https://app.example")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Allow-Credentials = %q; want %q", got, "true")
+	}
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	dummy := &dummyHandler{}
+	h := CORS(CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		MaxAge:         600,
+	})(dummy)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("OPTIONS", "/api/sync", nil)
+	req.Header.Set("Origin", "https://any.example")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	h.ServeHTTP(rec, req)
+
+	if dummy.called {
+		t.Error("did not expect next handler to be called for preflight")
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204 No Content, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST" {
+		t.Errorf("Allow-Methods = %q; want %q", got, "GET, POST")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, Authorization" {
+		t.Errorf("Allow-Headers = %q; want %q", got, "Content-Type, Authorization")
+	}
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Errorf("Max-Age = %q; want %q", got, "600")
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// SeenRecorder records the authenticated requests of devices.
+type SeenRecorder interface {
+	// RecordSeen records a request of the device of the user.
+	RecordSeen(ctx context.Context, userID, deviceID string) error
+}
+
+// LastSeen returns a middleware that records every authenticated request
+// with rec before serving it. It runs after the authentication middlewares;
+// unauthenticated requests are not recorded. Failing to record a request
+// does not fail it.
+func LastSeen(rec SeenRecorder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			login := GetUserIDFromContext(r.Context())
+			device := GetDeviceIDFromContext(r.Context())
+			if login != "" && device != "" {
+				_ = rec.RecordSeen(r.Context(), login, device)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+// seenRecorder collects the recorded requests and fails each of them.
+type seenRecorder struct {
+	seen []string
+}
+
+func (s *seenRecorder) RecordSeen(ctx context.Context, userID, deviceID string) error {
+	s.seen = append(s.seen, userID+"/"+deviceID)
+	return errors.New("not stored")
+}
+
+func TestLastSeen(t *testing.T) {
+	rec := &seenRecorder{}
+	dummy := &dummyHandler{}
+	h := TokenAuth(fakeTokenValidator{token: "good", login: "bob"})(LastSeen(rec)(dummy))
+
+	req := httptest.NewRequest("GET", "/api/stats", nil)
+	req.Header.Set("Authorization", "Bearer good")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	// Unauthenticated requests are not recorded
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/register", nil))
+
+	if len(rec.seen) != 1 || rec.seen[0] != "bob/"+TokenDeviceID {
+		t.Errorf("recorded %v; want bob's token request only", rec.seen)
+	}
+	if !dummy.called {
+		t.Error("handler not called after a failed record")
+	}
+}
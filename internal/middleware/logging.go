@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 	"go.uber.org/zap"
 )
 
@@ -40,6 +41,12 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode // Capture the status code
 }
 
+// Unwrap returns the original http.ResponseWriter, so that
+// http.ResponseController can flush streamed responses.
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 // WithRequestLogging is an HTTP middleware that logs the details of each request.
 // It logs the HTTP method, URL, response status, response size, and request duration.
 func WithRequestLogging(log *zap.Logger) func(http.Handler) http.Handler {
@@ -74,6 +81,7 @@ func WithRequestLogging(log *zap.Logger) func(http.Handler) http.Handler {
 				zap.Duration("duration", duration),
 				zap.Int("status", responseData.status),
 				zap.Int("size", responseData.size),
+				zap.String("request_id", chiMiddleware.GetReqID(r.Context())),
 			)
 		})
 	}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/atinyakov/GophKeeper/internal/problem"
+)
+
+const (
+	// SessionCookie is the name of the cookie carrying the browser session ID.
+	SessionCookie = "gk_session"
+	// CSRFHeader is the request header that must carry the session's CSRF
+	// token on state-changing requests.
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// SessionValidator resolves a session ID to a valid session.
+type SessionValidator interface {
+	// Authenticate returns the session for id, or an error if it is unknown or expired.
+	Authenticate(ctx context.Context, id string) (*models.Session, error)
+}
+
+// SessionAuth returns a middleware that authenticates browser requests by
+// the session cookie.
+//
+// Requests carrying an Authorization header or no session cookie are passed
+// through unchanged for TokenAuth and CertAuth. For every method other than
+// GET, HEAD and OPTIONS the CSRFHeader must match the session's CSRF token.
+// On success the session owner's login is stored in the request context.
+func SessionAuth(v SessionValidator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie(SessionCookie)
+			if err != nil || cookie.Value == "" || r.Header.Get("Authorization") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			session, err := v.Authenticate(r.Context(), cookie.Value)
+			if err != nil || session == nil {
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidSession, "invalid session")
+				return
+			}
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				csrf := r.Header.Get(CSRFHeader)
+				if subtle.ConstantTimeCompare([]byte(csrf), []byte(session.CSRFToken)) != 1 {
+					problem.Write(w, r, http.StatusForbidden, problem.CodeInvalidCSRFToken, "invalid CSRF token")
+					return
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), userKey, session.UserLogin)
+			ctx = context.WithValue(ctx, deviceKey, SessionDeviceID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// fakeSessionValidator knows a single session.
+type fakeSessionValidator struct {
+	id      string
+	session models.Session
+}
+
+func (f fakeSessionValidator) Authenticate(ctx context.Context, id string) (*models.Session, error) {
+	if id != f.id {
+		return nil, errors.New("invalid session")
+	}
+	return &f.session, nil
+}
+
+func TestSessionAuth(t *testing.T) {
+	v := fakeSessionValidator{
+		id:      "sid",
+		session: models.Session{UserLogin: "alice", CSRFToken: "csrf"},
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		cookie     string
+		csrf       string
+		auth       string
+		wantCalled bool
+		wantCode   int
+		wantUser   string
+	}{
+		{"no cookie", "POST", "", "", "", true, http.StatusOK, ""},
+		{"bearer token takes precedence", "POST", "sid", "", "Bearer t", true, http.StatusOK, ""},
+		{"unknown session", "GET", "bogus", "", "", false, http.StatusUnauthorized, ""},
+		{"safe method without CSRF", "GET", "sid", "", "", true, http.StatusOK, "alice"},
+		{"unsafe method without CSRF", "POST", "sid", "", "", false, http.StatusForbidden, ""},
+		{"unsafe method wrong CSRF", "POST", "sid", "nope", "", false, http.StatusForbidden, ""},
+		{"unsafe method valid CSRF", "POST", "sid", "csrf", "", true, http.StatusOK, "alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dummy := &dummyHandler{}
+			h := SessionAuth(v)(dummy)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, "/api/sync", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: SessionCookie, Value: tt.cookie})
+			}
+			if tt.csrf != "" {
+				req.Header.Set(CSRFHeader, tt.csrf)
+			}
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			h.ServeHTTP(rec, req)
+
+			if dummy.called != tt.wantCalled {
+				t.Errorf("next called = %v; want %v", dummy.called, tt.wantCalled)
+			}
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d; want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantCalled {
+				if user := GetUserIDFromContext(dummy.ctx); user != tt.wantUser {
+					t.Errorf("context user = %q; want %q", user, tt.wantUser)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/atinyakov/GophKeeper/internal/problem"
+)
+
+// TokenValidator resolves an API bearer token to the login of its owner.
+type TokenValidator interface {
+	// AuthenticateToken returns the login owning token and the ID of its
+	// lease, or an error if the token is unknown, expired or cannot be
+	// checked.
+	AuthenticateToken(ctx context.Context, token string) (string, string, error)
+}
+
+// TokenAuth returns a middleware that authenticates requests carrying an
+// "Authorization: Bearer <token>" header, for clients such as the web UI that
+// cannot present a TLS client certificate.
+//
+// Requests without an Authorization header are passed through unchanged so
+// that CertAuth can authenticate them. On success the token owner's login is
+// stored in the request context the same way CertAuth stores the certificate CN,
+// along with the lease ID of the token, see GetLeaseIDFromContext.
+func TokenAuth(v TokenValidator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok || token == "" {
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "invalid authorization header")
+				return
+			}
+
+			login, leaseID, err := v.AuthenticateToken(r.Context(), token)
+			if err != nil || login == "" {
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "invalid token")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userKey, login)
+			ctx = context.WithValue(ctx, deviceKey, TokenDeviceID)
+			ctx = context.WithValue(ctx, leaseKey, leaseID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetLeaseIDFromContext extracts the lease ID of the API token the request
+// was authenticated with from the request context. Returns an empty string
+// for requests authenticated otherwise.
+func GetLeaseIDFromContext(ctx context.Context) string {
+	val := ctx.Value(leaseKey)
+	if s, ok := val.(string); ok {
+		return s
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeTokenValidator accepts a single known token.
+type fakeTokenValidator struct {
+	token string
+	login string
+}
+
+func (f fakeTokenValidator) AuthenticateToken(ctx context.Context, token string) (string, string, error) {
+	if token != f.token {
+		return "", "", errors.New("invalid token")
+	}
+	return f.login, "lease-" + f.login, nil
+}
+
+func TestTokenAuth(t *testing.T) {
+	v := fakeTokenValidator{token: "good", login: "alice"}
+
+	tests := []struct {
+		name       string
+		header     string
+		wantCalled bool
+		wantCode   int
+		wantUser   string
+	}{
+		{"no header", "", true, http.StatusOK, ""},
+		{"valid token", "Bearer good", true, http.StatusOK, "alice"},
+		{"invalid token", "Bearer bad", false, http.StatusUnauthorized, ""},
+		{"wrong scheme", "Basic Zm9vOmJhcg==", false, http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dummy := &dummyHandler{}
+			h := TokenAuth(v)(dummy)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/api/sync", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			h.ServeHTTP(rec, req)
+
+			if dummy.called != tt.wantCalled {
+				t.Errorf("next called = %v; want %v", dummy.called, tt.wantCalled)
+			}
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d; want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantCalled {
+				if user := GetUserIDFromContext(dummy.ctx); user != tt.wantUser {
+					t.Errorf("context user = %q; want %q", user, tt.wantUser)
+				}
+				if lease := GetLeaseIDFromContext(dummy.ctx); tt.wantUser != "" && lease != "lease-"+tt.wantUser {
+					t.Errorf("context lease = %q; want %q", lease, "lease-"+tt.wantUser)
+				}
+			}
+		})
+	}
+}
+
+func TestCertAuth_TokenAuthenticated(t *testing.T) {
+	dummy := &dummyHandler{}
+	h := TokenAuth(fakeTokenValidator{token: "good", login: "bob"})(CertAuth(dummy))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/sync", nil)
+	req.Header.Set("Authorization", "Bearer good")
+	h.ServeHTTP(rec, req)
+
+	if !dummy.called {
+		t.Error("expected next handler to be called for token-authenticated request")
+	}
+	if user := GetUserIDFromContext(dummy.ctx); user != "bob" {
+		t.Errorf("context user = %q; want %q", user, "bob")
+	}
+}
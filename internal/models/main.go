@@ -1,6 +1,12 @@
 // Package models defines the core data structures for users and secrets.
 package models
 
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
 // User represents an application user with credentials.
 type User struct {
 	// ID is the unique identifier for the user.
@@ -19,12 +25,300 @@ type Secret struct {
 	Type string `json:"type"`
 	// Data contains the encrypted payload of the secret.
 	Data string `json:"data"`
+	// Name is the human-readable name of the secret, encrypted by the
+	// client like Data. Clients show and search it; it is empty for
+	// secrets stored before names were introduced.
+	Name string `json:"name,omitempty"`
 	// Comment holds user-provided metadata or notes about the secret.
 	Comment string `json:"comment"`
+	// Folder is the folder the secret is filed under, e.g. "work/db".
+	Folder string `json:"folder,omitempty"`
+	// Tags are user-defined labels of the secret.
+	Tags []string `json:"tags,omitempty"`
 	// Version is the sync version number for concurrency control.
 	Version int64 `json:"version"`
 	// Deleted
 	Deleted bool `json:"deleted"`
+	// Reprompt marks a high-sensitivity secret whose data clients reveal
+	// only after the passphrase has been entered again.
+	Reprompt bool `json:"reprompt,omitempty"`
+	// ExpiresAt is the Unix time the secret expires, e.g. a card or a
+	// certificate, 0 if it does not. It is stored in the clear, so that
+	// the owner can be notified ahead of it.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+	// BaseVersion is the version of the server's copy an uploaded secret
+	// was edited from, equal to Version if the client did not change it
+	// since it received it; 0 if unknown, e.g. from older clients. It is
+	// not stored, see Unchanged.
+	BaseVersion int64 `json:"base_version,omitempty"`
+}
+
+// Unchanged reports whether the uploaded secret s is a copy the client
+// received from the server and did not change, so that a newer version on
+// the server is not in conflict with it.
+func (s Secret) Unchanged() bool {
+	return s.BaseVersion != 0 && s.BaseVersion == s.Version
+}
+
+// Conflict describes an uploaded secret the server rejected because it
+// holds a newer version of it, e.g. one edited on another device, or
+// because both the client and the server changed it since the client's
+// last sync.
+type Conflict struct {
+	// ID is the ID of the secret.
+	ID string `json:"id"`
+	// Version is the version the client uploaded.
+	Version int64 `json:"version"`
+	// ServerVersion is the version the server kept.
+	ServerVersion int64 `json:"server_version"`
+	// ServerModified is the Unix time the server stored its version, 0 if
+	// it was stored before the time was recorded or is not reported.
+	ServerModified int64 `json:"server_modified"`
+	// Concurrent reports that both versions are newer than the client's
+	// last sync, so that neither replaces the other: the server keeps its
+	// version until the client resolves the conflict with the two below.
+	Concurrent bool `json:"concurrent,omitempty"`
+	// Client is the version the client uploaded, if Concurrent.
+	Client *Secret `json:"client,omitempty"`
+	// Server is the version the server kept, if Concurrent.
+	Server *Secret `json:"server,omitempty"`
+	// Changed names the metadata fields stored in the clear that differ
+	// between Client and Server, as a hint for merging them; the
+	// encrypted name and data can only be compared by the client.
+	Changed []string `json:"changed,omitempty"`
+}
+
+// UploadResult is the outcome of the secrets uploaded by a sync, added up
+// batch by batch as they are stored.
+type UploadResult struct {
+	// Updated are the IDs of the secrets stored.
+	Updated []string
+	// Skipped are the IDs of the secrets not stored, as the server holds
+	// the same or a newer version or they were changed concurrently.
+	Skipped []string
+	// Conflicts describe the secrets skipped in conflict, see Conflict.
+	Conflicts []Conflict
+	// Deleted are the IDs of the tombstones uploaded.
+	Deleted []string
+	// Restored are the IDs of the secrets not stored, as the client's copy
+	// is newer than the server's only because the vault was rolled back
+	// to a backup since the client received it.
+	Restored []string
+}
+
+// Empty reports whether nothing was uploaded.
+func (r UploadResult) Empty() bool {
+	return len(r.Updated) == 0 && len(r.Skipped) == 0 && len(r.Deleted) == 0 && len(r.Restored) == 0
+}
+
+// ImportResult reports a bulk import of secrets.
+type ImportResult struct {
+	// Imported is the number of secrets stored.
+	Imported int `json:"imported"`
+	// Skipped is the number of secrets not stored because the server
+	// holds the same or a newer version of them.
+	Skipped int `json:"skipped"`
+	// Version is the highest version of the user's secrets afterwards.
+	Version int64 `json:"version"`
+}
+
+// SyncFilter restricts a sync to part of the vault, so that a device only
+// receives the secrets it subscribed to. A secret matches if it is filed
+// under one of Folders or a subfolder of it, carries one of Tags, or has
+// one of Types. The zero filter matches every secret.
+type SyncFilter struct {
+	// Folders are folders to sync, e.g. "work".
+	Folders []string `json:"folders,omitempty"`
+	// Tags are tags to sync.
+	Tags []string `json:"tags,omitempty"`
+	// Types are secret types always synced, e.g. the attachment chunks
+	// clients store as secrets of their own.
+	Types []string `json:"types,omitempty"`
+}
+
+// Empty reports whether the filter matches every secret.
+func (f SyncFilter) Empty() bool {
+	return len(f.Folders) == 0 && len(f.Tags) == 0 && len(f.Types) == 0
+}
+
+// Match reports whether sec is part of the synced subset.
+func (f SyncFilter) Match(sec Secret) bool {
+	if f.Empty() || slices.Contains(f.Types, sec.Type) {
+		return true
+	}
+	for _, folder := range f.Folders {
+		if sec.Folder == folder || strings.HasPrefix(sec.Folder, folder+"/") {
+			return true
+		}
+	}
+	return slices.ContainsFunc(sec.Tags, func(tag string) bool { return slices.Contains(f.Tags, tag) })
+}
+
+// Certificate is a client certificate issued to a user. Its serial number
+// identifies the device holding it.
+type Certificate struct {
+	// Serial is the serial number in hexadecimal.
+	Serial string `json:"serial"`
+	// Login is the user the certificate was issued to.
+	Login string `json:"login"`
+	// Fingerprint is the hex-encoded SHA-256 digest of the certificate.
+	Fingerprint string `json:"fingerprint"`
+	// IssuedAt is the Unix time the certificate was issued or bound.
+	IssuedAt int64 `json:"issued_at"`
+	// RevokedAt is the Unix time the certificate was revoked, 0 if active.
+	RevokedAt int64 `json:"revoked_at,omitempty"`
+}
+
+// Session is a server-side browser session created for an authenticated user.
+type Session struct {
+	// IDHash is the SHA-256 hash of the session ID stored in the cookie.
+	IDHash string
+	// UserLogin is the login of the session owner.
+	UserLogin string
+	// CSRFToken must accompany every state-changing request of the session.
+	CSRFToken string
+	// ExpiresAt is the Unix time after which the session is invalid.
+	ExpiresAt int64
+}
+
+// Device is a client of a user, identified by the credential it authenticates with.
+type Device struct {
+	// ID identifies the device, e.g. the serial number of its client certificate.
+	ID string `json:"id"`
+	// LastSync is the Unix time of the device's last successful sync.
+	LastSync int64 `json:"last_sync"`
+	// LastSeen is the Unix time of the device's last authenticated request.
+	LastSeen int64 `json:"last_seen"`
+}
+
+// SecretAccess records that a device of the owner fetched a secret.
+type SecretAccess struct {
+	// DeviceID identifies the device, see Device.
+	DeviceID string `json:"device_id"`
+	// Time is the Unix time of the sync that sent the secret.
+	Time int64 `json:"time"`
+}
+
+// Lease is the lifetime of an API token, e.g. one handed to a CI job to
+// fetch secrets. Tokens issued without a TTL never expire.
+type Lease struct {
+	// ID identifies the lease: the first hex digits of the token hash.
+	ID string `json:"id"`
+	// IssuedAt is the Unix time the token was issued.
+	IssuedAt int64 `json:"issued_at"`
+	// TTL is the lifetime in seconds granted by renewals, 0 for tokens that
+	// never expire.
+	TTL int64 `json:"ttl"`
+	// ExpiresAt is the Unix time from which the token is rejected, 0 for
+	// never.
+	ExpiresAt int64 `json:"expires_at"`
+	// LastFetch is the Unix time the token was last sent a secret, 0 if
+	// never.
+	LastFetch int64 `json:"last_fetch"`
+	// Fetched is the number of distinct secrets the token was sent.
+	Fetched int64 `json:"fetched"`
+}
+
+// Errors of lease operations.
+var (
+	// ErrLeaseNotFound is returned for unknown lease IDs.
+	ErrLeaseNotFound = errors.New("lease not found")
+	// ErrLeaseExpired is returned when renewing an expired lease.
+	ErrLeaseExpired = errors.New("lease expired")
+	// ErrInvalidTTL is returned for lease TTLs out of range.
+	ErrInvalidTTL = errors.New("invalid ttl")
+)
+
+// NotificationChannel is where a user is notified of events, see package
+// notify.
+type NotificationChannel struct {
+	// ID identifies the channel among those of the user.
+	ID int64 `json:"id"`
+	// Kind is the delivery method: "email", "webhook" or "ntfy".
+	Kind string `json:"kind"`
+	// Target is the email address, webhook URL or ntfy topic URL.
+	Target string `json:"target"`
+	// Events lists the kinds of events sent to the channel; all if empty.
+	Events []string `json:"events"`
+}
+
+// Expiring names something of a user that expires, e.g. a secret or a
+// certificate.
+type Expiring struct {
+	// Login is the owner.
+	Login string
+	// ID is the secret ID or certificate serial number.
+	ID string
+	// ExpiresAt is the Unix time it expires.
+	ExpiresAt int64
+}
+
+// Errors of notification channel operations.
+var (
+	// ErrChannelNotFound is returned for unknown channel IDs.
+	ErrChannelNotFound = errors.New("notification channel not found")
+	// ErrInvalidChannel is returned for channels with an unsupported kind,
+	// a malformed target or unknown events.
+	ErrInvalidChannel = errors.New("invalid notification channel")
+)
+
+// Stats summarizes the stored vault of a user.
+type Stats struct {
+	// Counts holds the number of live secrets per secret type.
+	Counts map[string]int64 `json:"counts"`
+	// TotalBytes is the total size of the stored encrypted payloads.
+	TotalBytes int64 `json:"total_bytes"`
+	// LastSync is the Unix time of the most recent sync from any device.
+	LastSync int64 `json:"last_sync"`
+	// LastSeen is the Unix time of the most recent request from any device.
+	LastSeen int64 `json:"last_seen"`
+	// Devices lists the devices that have synced with the server.
+	Devices []Device `json:"devices"`
+	// Fingerprint hashes the ID and version of every live secret, see
+	// package fingerprint. Devices compare it with their own to verify
+	// that they hold the same secrets as the server.
+	Fingerprint string `json:"fingerprint"`
+}
+
+// VaultSummary is the composition of the stored vault of a user, sent
+// along with every sync so that clients can show it without decrypting
+// the secrets. Unlike Stats it holds no device information.
+type VaultSummary struct {
+	// Types holds the number of live secrets per secret type.
+	Types map[string]int64 `json:"types"`
+	// Folders holds the number of live secrets per folder; secrets outside
+	// folders are not counted.
+	Folders map[string]int64 `json:"folders"`
+	// Tags holds the number of live secrets per tag.
+	Tags map[string]int64 `json:"tags"`
+	// TotalBytes is the total size of the stored encrypted payloads.
+	TotalBytes int64 `json:"total_bytes"`
+}
+
+// AuditEvent is a security-relevant event recorded in the audit trail.
+type AuditEvent struct {
+	// Time is the Unix time of the event.
+	Time int64 `json:"time"`
+	// Login is the user the event relates to, if any.
+	Login string `json:"login,omitempty"`
+	// IP is the remote address of the client, if known.
+	IP string `json:"ip,omitempty"`
+	// Action names the event, e.g. "register" or "register_banned".
+	Action string `json:"action"`
+	// Detail holds additional free-form information.
+	Detail string `json:"detail,omitempty"`
+}
+
+// RegistrationAttempts tracks failed registration attempts from one IP address.
+type RegistrationAttempts struct {
+	// IP is the remote address of the client.
+	IP string
+	// Failures is the number of failed attempts since the counter was last reset.
+	Failures int
+	// LastAttempt is the Unix time of the most recent failed attempt.
+	LastAttempt int64
+	// BannedUntil is the Unix time until which registration is refused; 0 if not banned.
+	BannedUntil int64
 }
 
 // SecretType defines the set of valid secret type identifiers.
@@ -39,4 +333,14 @@ const (
 	BinaryData SecretType = "binary"
 	// CardData represents a secret containing card information (e.g., credit card).
 	CardData SecretType = "card"
+	// WiFiData represents a secret containing Wi-Fi network credentials.
+	WiFiData SecretType = "wifi"
+)
+
+// Errors of login renames.
+var (
+	// ErrUserNotFound is returned when renaming an unknown user.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrLoginTaken is returned when renaming a user to a login in use.
+	ErrLoginTaken = errors.New("login taken")
 )
@@ -0,0 +1,29 @@
+package models
+
+import "testing"
+
+func TestSyncFilter_Match(t *testing.T) {
+	filter := SyncFilter{Folders: []string{"work"}, Tags: []string{"shared"}, Types: []string{"chunk"}}
+	tests := []struct {
+		name string
+		sec  Secret
+		want bool
+	}{
+		{"folder", Secret{Folder: "work"}, true},
+		{"subfolder", Secret{Folder: "work/db"}, true},
+		{"folder with the same prefix", Secret{Folder: "workshop"}, false},
+		{"tag", Secret{Folder: "home", Tags: []string{"bank", "shared"}}, true},
+		{"type", Secret{Type: "chunk"}, true},
+		{"unfiled", Secret{Type: "text"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filter.Match(tt.sec); got != tt.want {
+				t.Errorf("Match = %v; want %v", got, tt.want)
+			}
+		})
+	}
+	if !(SyncFilter{}).Match(Secret{Folder: "home"}) {
+		t.Error("the zero filter does not match every secret")
+	}
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidPayload matches the errors of decrypted payloads that do not
+// fit the schema of their secret type, see ValidatePayload.
+var ErrInvalidPayload = errors.New("invalid payload")
+
+// LoginPasswordPayload is the decrypted payload of a LoginPassword secret,
+// stored as a JSON object.
+type LoginPasswordPayload struct {
+	// Login is the user name or e-mail address, if the site needs one.
+	Login string `json:"login,omitempty"`
+	// Password is the password; it is required.
+	Password string `json:"password"`
+	// URL is the address of the site the login is for, if known.
+	URL string `json:"url,omitempty"`
+}
+
+// Validate checks that p has a password and that its URL, if any, parses.
+func (p LoginPasswordPayload) Validate() error {
+	if p.Password == "" {
+		return fmt.Errorf("%w: password is required", ErrInvalidPayload)
+	}
+	if p.URL != "" {
+		if _, err := url.Parse(p.URL); err != nil {
+			return fmt.Errorf("%w: url: %w", ErrInvalidPayload, err)
+		}
+	}
+	return nil
+}
+
+// CardPayload is the decrypted payload of a CardData secret, stored as a
+// JSON object.
+type CardPayload struct {
+	// Number is the card number (PAN); spaces and dashes are allowed.
+	Number string `json:"number"`
+	// Holder is the name of the card holder as printed on the card.
+	Holder string `json:"holder"`
+	// Expiry is the expiry date as MM/YY or MM/YYYY.
+	Expiry string `json:"expiry"`
+	// CVV is the 3 or 4 digit security code.
+	CVV string `json:"cvv"`
+}
+
+// Validate checks that p has a holder, a number of 12 to 19 digits that
+// passes the Luhn check, a valid expiry month and a 3 or 4 digit CVV.
+func (p CardPayload) Validate() error {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(p.Number)
+	if len(digits) < 12 || len(digits) > 19 || !isDigits(digits) || !luhn(digits) {
+		return fmt.Errorf("%w: invalid card number", ErrInvalidPayload)
+	}
+	if strings.TrimSpace(p.Holder) == "" {
+		return fmt.Errorf("%w: card holder is required", ErrInvalidPayload)
+	}
+	if _, _, err := p.ExpiryDate(); err != nil {
+		return err
+	}
+	if (len(p.CVV) != 3 && len(p.CVV) != 4) || !isDigits(p.CVV) {
+		return fmt.Errorf("%w: CVV must have 3 or 4 digits", ErrInvalidPayload)
+	}
+	return nil
+}
+
+// ExpiryDate returns the month and four-digit year of p.Expiry.
+func (p CardPayload) ExpiryDate() (month, year int, err error) {
+	mm, yy, ok := strings.Cut(strings.TrimSpace(p.Expiry), "/")
+	month, errMonth := strconv.Atoi(mm)
+	year, errYear := strconv.Atoi(yy)
+	if !ok || errMonth != nil || errYear != nil || month < 1 || month > 12 || (len(yy) != 2 && len(yy) != 4) {
+		return 0, 0, fmt.Errorf("%w: expiry must be MM/YY", ErrInvalidPayload)
+	}
+	if len(yy) == 2 {
+		year += 2000
+	}
+	return month, year, nil
+}
+
+// ValidatePayload checks plain, the decrypted payload of a secret of type
+// typ, against the schema of the type before it is encrypted:
+// LoginPassword and CardData payloads must be JSON objects of
+// LoginPasswordPayload and CardPayload, and TextData must be UTF-8.
+// BinaryData and other types hold any bytes. Errors match
+// ErrInvalidPayload.
+func ValidatePayload(typ SecretType, plain []byte) error {
+	switch typ {
+	case LoginPassword:
+		_, err := ParseLoginPassword(plain)
+		return err
+	case CardData:
+		_, err := ParseCard(plain)
+		return err
+	case TextData:
+		if !utf8.Valid(plain) {
+			return fmt.Errorf("%w: text is not valid UTF-8", ErrInvalidPayload)
+		}
+	}
+	return nil
+}
+
+// ParseLoginPassword decodes and validates the payload of a LoginPassword
+// secret.
+func ParseLoginPassword(plain []byte) (LoginPasswordPayload, error) {
+	var p LoginPasswordPayload
+	if err := json.Unmarshal(plain, &p); err != nil {
+		return p, fmt.Errorf("%w: login_password payload is not a JSON object: %w", ErrInvalidPayload, err)
+	}
+	return p, p.Validate()
+}
+
+// ParseCard decodes and validates the payload of a CardData secret.
+func ParseCard(plain []byte) (CardPayload, error) {
+	var p CardPayload
+	if err := json.Unmarshal(plain, &p); err != nil {
+		return p, fmt.Errorf("%w: card payload is not a JSON object: %w", ErrInvalidPayload, err)
+	}
+	return p, p.Validate()
+}
+
+// isDigits reports whether s consists of ASCII digits only.
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// luhn reports whether the digits pass the Luhn checksum of card numbers.
+func luhn(digits string) bool {
+	sum := 0
+	for i := range len(digits) {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidatePayload(t *testing.T) {
+	tests := []struct {
+		name  string
+		typ   SecretType
+		plain string
+		ok    bool
+	}{
+		{"login", LoginPassword, `{"login":"alice","password":"pw","url":"https://example.com"}`, true},
+		{"login without user name", LoginPassword, `{"password":"pw"}`, true},
+		{"login without password", LoginPassword, `{"login":"alice"}`, false},
+		{"free-form login", LoginPassword, `pw`, false},
+		{"login with bad url", LoginPassword, `{"password":"pw","url":"http://[::1"}`, false},
+		{"card", CardData, `{"number":"4111 1111 1111 1111","holder":"ALICE","expiry":"12/30","cvv":"123"}`, true},
+		{"card with long expiry", CardData, `{"number":"378282246310005","holder":"ALICE","expiry":"01/2031","cvv":"1234"}`, true},
+		{"card failing luhn", CardData, `{"number":"4111111111111112","holder":"ALICE","expiry":"12/30","cvv":"123"}`, false},
+		{"card with short number", CardData, `{"number":"4111","holder":"ALICE","expiry":"12/30","cvv":"123"}`, false},
+		{"card without holder", CardData, `{"number":"4111111111111111","expiry":"12/30","cvv":"123"}`, false},
+		{"card with month 13", CardData, `{"number":"4111111111111111","holder":"ALICE","expiry":"13/30","cvv":"123"}`, false},
+		{"card with letter cvv", CardData, `{"number":"4111111111111111","holder":"ALICE","expiry":"12/30","cvv":"12a"}`, false},
+		{"text", TextData, "line 1\nline 2", true},
+		{"text not utf-8", TextData, "\xff\xfe", false},
+		{"binary", BinaryData, "\xff\xfe", true},
+		{"other type", SecretType("api-token"), "anything", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePayload(tt.typ, []byte(tt.plain))
+			if tt.ok && err != nil {
+				t.Errorf("ValidatePayload = %v; want nil", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidPayload) {
+				t.Errorf("ValidatePayload = %v; want ErrInvalidPayload", err)
+			}
+		})
+	}
+}
+
+func TestCardPayload_ExpiryDate(t *testing.T) {
+	month, year, err := CardPayload{Expiry: "03/29"}.ExpiryDate()
+	if err != nil || month != 3 || year != 2029 {
+		t.Errorf("ExpiryDate = %d, %d, %v; want 3, 2029", month, year, err)
+	}
+}
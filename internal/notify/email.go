@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// sendMail sends a message over SMTP; replaced in tests.
+var sendMail = smtp.SendMail
+
+// Email delivers events by email through an SMTP relay.
+type Email struct {
+	// Addr is the host:port of the relay.
+	Addr string
+	// From is the sender address.
+	From string
+	// Username and Password authenticate to the relay, if set. PLAIN
+	// authentication requires TLS unless the relay is on localhost.
+	Username string
+	Password string
+}
+
+// Send mails ev to the address target.
+func (e *Email) Send(_ context.Context, target string, ev Event) error {
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, err := net.SplitHostPort(e.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+	return sendMail(e.Addr, auth, e.From, []string{target}, message(e.From, target, ev))
+}
+
+// message returns the email of ev from from to to.
+func message(from, to string, ev Event) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", oneLine(from))
+	fmt.Fprintf(&b, "To: %s\r\n", oneLine(to))
+	fmt.Fprintf(&b, "Subject: %s\r\n", oneLine(ev.Title()))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Unix(ev.Time, 0).UTC().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(ev.Message, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// oneLine drops line breaks from a header value.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned when a webhook or ntfy target resolves to
+// a loopback, private or link-local address, which users must not be able
+// to reach through the server.
+var ErrPrivateAddress = errors.New("target resolves to a private address")
+
+// timeout bounds each delivery over HTTP.
+const timeout = 10 * time.Second
+
+// NewHTTPClient returns the client webhook and ntfy deliveries are made
+// with. Unless allowPrivate is set, e.g. for a self-hosted ntfy server on
+// the internal network, it refuses to connect to private addresses.
+// Redirects are not followed.
+func NewHTTPClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = refusePrivate
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// refusePrivate is a net.Dialer Control function rejecting connections to
+// private addresses. It runs after name resolution, so host names
+// resolving to such addresses are rejected too.
+func refusePrivate(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	ip := addrPort.Addr().Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+	}
+	return nil
+}
+
+// Webhook delivers events as JSON POST requests to the target URL.
+type Webhook struct {
+	Client *http.Client
+}
+
+// Send posts ev as JSON to target.
+func (wh Webhook) Send(ctx context.Context, target string, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return post(ctx, wh.Client, target, body, map[string]string{"Content-Type": "application/json"})
+}
+
+// Ntfy publishes events to ntfy topics, e.g. https://ntfy.sh/mytopic, which
+// push them to the phones subscribed to the topic.
+type Ntfy struct {
+	Client *http.Client
+}
+
+// Send publishes the message of ev to the topic URL target.
+func (n Ntfy) Send(ctx context.Context, target string, ev Event) error {
+	return post(ctx, n.Client, target, []byte(ev.Message), map[string]string{
+		"Content-Type": "text/plain; charset=utf-8",
+		"Title":        ev.Title(),
+		"Tags":         ev.Kind,
+	})
+}
+
+// post sends body to target with the given headers and checks that it was
+// accepted. Errors do not name target, which may embed credentials.
+func post(ctx context.Context, client *http.Client, target string, body []byte, header map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("invalid target")
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Package notify delivers events to the notification channels of users:
+// secrets and client certificates nearing expiry, found by a Scheduler, and
+// devices enrolled for their login. Channels send email, call a webhook or
+// publish to an ntfy topic.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"slices"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"go.uber.org/zap"
+)
+
+// Kinds of events.
+const (
+	// EventSecretExpiry is sent when a secret nears its expiry date.
+	EventSecretExpiry = "secret-expiry"
+	// EventCertificateExpiry is sent when a client certificate nears the
+	// end of its validity.
+	EventCertificateExpiry = "certificate-expiry"
+	// EventNewDevice is sent when a further device is enrolled for a login.
+	EventNewDevice = "new-device"
+)
+
+// Events lists the kinds of events channels can subscribe to.
+var Events = []string{EventSecretExpiry, EventCertificateExpiry, EventNewDevice}
+
+// Kinds of channels.
+const (
+	KindEmail   = "email"
+	KindWebhook = "webhook"
+	KindNtfy    = "ntfy"
+)
+
+// Event is something a user is notified of. Events never carry secret
+// data or metadata beyond IDs.
+type Event struct {
+	// Kind is one of Events.
+	Kind string `json:"event"`
+	// Login is the user notified.
+	Login string `json:"login"`
+	// Subject identifies what the event is about: a secret ID, a
+	// certificate serial number or the address a device enrolled from.
+	Subject string `json:"subject"`
+	// Message describes the event to people.
+	Message string `json:"message"`
+	// Time is the Unix time of the event.
+	Time int64 `json:"time"`
+}
+
+// Title returns a one-line summary of the kind of event, e.g. for email
+// subjects.
+func (e Event) Title() string {
+	switch e.Kind {
+	case EventSecretExpiry:
+		return "GophKeeper: secret expiring"
+	case EventCertificateExpiry:
+		return "GophKeeper: client certificate expiring"
+	case EventNewDevice:
+		return "GophKeeper: new device enrolled"
+	default:
+		return "GophKeeper: " + e.Kind
+	}
+}
+
+// Sender delivers events through one kind of channel.
+type Sender interface {
+	// Send delivers ev to target, an address whose form depends on the
+	// kind of channel.
+	Send(ctx context.Context, target string, ev Event) error
+}
+
+// ChannelStore reads the notification channels of users.
+type ChannelStore interface {
+	// GetChannels returns the notification channels of the user.
+	GetChannels(ctx context.Context, login string) ([]models.NotificationChannel, error)
+}
+
+// Notifier delivers events to the channels the user subscribed to them.
+type Notifier struct {
+	// Channels holds the channels of the users.
+	Channels ChannelStore
+	// Senders deliver events by kind of channel; channels of other kinds
+	// are skipped.
+	Senders map[string]Sender
+	// Log receives a line per failed delivery.
+	Log *zap.Logger
+}
+
+// Kinds returns the kinds of channels the Notifier can deliver to.
+func (n *Notifier) Kinds() []string {
+	var kinds []string
+	for kind := range n.Senders {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	return kinds
+}
+
+// Notify delivers ev to every channel of ev.Login subscribed to its kind
+// and returns the number of channels it was delivered to. Failed
+// deliveries are logged and joined into the error; they do not stop the
+// delivery to other channels.
+func (n *Notifier) Notify(ctx context.Context, ev Event) (int, error) {
+	channels, err := n.Channels.GetChannels(ctx, ev.Login)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var errs []error
+	for _, c := range channels {
+		if len(c.Events) > 0 && !slices.Contains(c.Events, ev.Kind) {
+			continue
+		}
+		sender, ok := n.Senders[c.Kind]
+		if !ok {
+			continue
+		}
+		if err := sender.Send(ctx, c.Target, ev); err != nil {
+			err = fmt.Errorf("%s channel %d: %w", c.Kind, c.ID, err)
+			if n.Log != nil {
+				n.Log.Warn("failed to deliver notification", zap.String("login", ev.Login),
+					zap.String("event", ev.Kind), zap.Error(err))
+			}
+			errs = append(errs, err)
+			continue
+		}
+		sent++
+	}
+	return sent, errors.Join(errs...)
+}
+
+// ValidateChannel checks that c has a known kind, a well-formed target for
+// it and only known events. Webhook and ntfy targets must be https URLs.
+func ValidateChannel(c models.NotificationChannel) error {
+	for _, e := range c.Events {
+		if !slices.Contains(Events, e) {
+			return fmt.Errorf("%w: unknown event %q", models.ErrInvalidChannel, e)
+		}
+	}
+
+	switch c.Kind {
+	case KindEmail:
+		addr, err := mail.ParseAddress(c.Target)
+		if err != nil || addr.Address != c.Target {
+			return fmt.Errorf("%w: invalid email address %q", models.ErrInvalidChannel, c.Target)
+		}
+	case KindWebhook, KindNtfy:
+		u, err := url.Parse(c.Target)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("%w: %s target must be an https URL", models.ErrInvalidChannel, c.Kind)
+		}
+	default:
+		return fmt.Errorf("%w: unknown kind %q, want email, webhook or ntfy", models.ErrInvalidChannel, c.Kind)
+	}
+	return nil
+}
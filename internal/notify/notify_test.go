@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// channelMap is a ChannelStore holding the channels by login.
+type channelMap map[string][]models.NotificationChannel
+
+func (m channelMap) GetChannels(_ context.Context, login string) ([]models.NotificationChannel, error) {
+	return m[login], nil
+}
+
+// recordingSender records the targets it sends to and fails for "down".
+type recordingSender struct {
+	targets []string
+}
+
+func (s *recordingSender) Send(_ context.Context, target string, _ Event) error {
+	if target == "down" {
+		return errors.New("connection refused")
+	}
+	s.targets = append(s.targets, target)
+	return nil
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	webhooks := &recordingSender{}
+	n := &Notifier{
+		Channels: channelMap{"alice": {
+			{ID: 1, Kind: KindWebhook, Target: "all"},
+			{ID: 2, Kind: KindWebhook, Target: "expiry", Events: []string{EventSecretExpiry}},
+			{ID: 3, Kind: KindWebhook, Target: "devices", Events: []string{EventNewDevice}},
+			{ID: 4, Kind: KindWebhook, Target: "down"},
+			{ID: 5, Kind: KindEmail, Target: "alice@example.com"},
+		}},
+		Senders: map[string]Sender{KindWebhook: webhooks},
+	}
+
+	sent, err := n.Notify(context.Background(), Event{Kind: EventNewDevice, Login: "alice"})
+	if sent != 2 || err == nil || !strings.Contains(err.Error(), "webhook channel 4") {
+		t.Errorf("Notify = %d, %v; want 2 and the failure of channel 4", sent, err)
+	}
+	if got := strings.Join(webhooks.targets, ","); got != "all,devices" {
+		t.Errorf("sent to %s; want all,devices", got)
+	}
+	if got := n.Kinds(); len(got) != 1 || got[0] != KindWebhook {
+		t.Errorf("Kinds = %v; want [webhook]", got)
+	}
+}
+
+func TestValidateChannel(t *testing.T) {
+	cases := []struct {
+		channel models.NotificationChannel
+		valid   bool
+	}{
+		{models.NotificationChannel{Kind: KindEmail, Target: "alice@example.com"}, true},
+		{models.NotificationChannel{Kind: KindEmail, Target: "Alice <alice@example.com>"}, false},
+		{models.NotificationChannel{Kind: KindEmail, Target: "alice@example.com\r\nBcc: eve@example.com"}, false},
+		{models.NotificationChannel{Kind: KindWebhook, Target: "https://hooks.example.com/x", Events: []string{EventNewDevice}}, true},
+		{models.NotificationChannel{Kind: KindWebhook, Target: "http://hooks.example.com/x"}, false},
+		{models.NotificationChannel{Kind: KindNtfy, Target: "https://ntfy.sh/alice"}, true},
+		{models.NotificationChannel{Kind: KindNtfy, Target: "https://ntfy.sh/alice", Events: []string{"reboot"}}, false},
+		{models.NotificationChannel{Kind: "sms", Target: "+100"}, false},
+	}
+	for _, tc := range cases {
+		err := ValidateChannel(tc.channel)
+		if (err == nil) != tc.valid {
+			t.Errorf("ValidateChannel(%+v) = %v; want valid %v", tc.channel, err, tc.valid)
+		}
+		if err != nil && !errors.Is(err, models.ErrInvalidChannel) {
+			t.Errorf("ValidateChannel(%+v) = %v; want ErrInvalidChannel", tc.channel, err)
+		}
+	}
+}
+
+func TestWebhookAndNtfy(t *testing.T) {
+	var requests []*http.Request
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+	}))
+	defer srv.Close()
+
+	client := NewHTTPClient(true)
+	ev := Event{Kind: EventSecretExpiry, Login: "alice", Subject: "s1", Message: "Secret s1 expires on 2026-01-02.", Time: 10}
+	if err := (Webhook{Client: client}).Send(context.Background(), srv.URL+"/hook", ev); err != nil {
+		t.Fatalf("Webhook.Send returned error: %v", err)
+	}
+	if err := (Ntfy{Client: client}).Send(context.Background(), srv.URL+"/topic", ev); err != nil {
+		t.Fatalf("Ntfy.Send returned error: %v", err)
+	}
+
+	var got Event
+	if err := json.Unmarshal([]byte(bodies[0]), &got); err != nil || got != ev {
+		t.Errorf("webhook body = %s (%v); want the event as JSON", bodies[0], err)
+	}
+	if r := requests[1]; r.Header.Get("Title") != "GophKeeper: secret expiring" || r.Header.Get("Tags") != EventSecretExpiry || bodies[1] != ev.Message {
+		t.Errorf("ntfy request: title %q, tags %q, body %q", r.Header.Get("Title"), r.Header.Get("Tags"), bodies[1])
+	}
+}
+
+func TestNewHTTPClient_RefusesPrivate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("request reached a loopback server")
+	}))
+	defer srv.Close()
+
+	err := (Webhook{Client: NewHTTPClient(false)}).Send(context.Background(), srv.URL, Event{})
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Send = %v; want ErrPrivateAddress", err)
+	}
+}
+
+func TestEmail_Send(t *testing.T) {
+	var gotAddr, gotFrom string
+	var gotTo []string
+	var gotMsg []byte
+	sendMail = func(addr string, _ smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotFrom, gotTo, gotMsg = addr, from, to, msg
+		return nil
+	}
+	defer func() { sendMail = smtp.SendMail }()
+
+	e := &Email{Addr: "smtp.example.com:587", From: "keeper@example.com", Username: "u", Password: "p"}
+	ev := Event{Kind: EventNewDevice, Login: "alice", Subject: "203.0.113.5", Message: "A device was enrolled from 203.0.113.5.", Time: 0}
+	if err := e.Send(context.Background(), "alice@example.com", ev); err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	if gotAddr != e.Addr || gotFrom != e.From || len(gotTo) != 1 || gotTo[0] != "alice@example.com" {
+		t.Errorf("sent via %s from %s to %v", gotAddr, gotFrom, gotTo)
+	}
+	msg := string(gotMsg)
+	for _, want := range []string{"To: alice@example.com\r\n", "Subject: GophKeeper: new device enrolled\r\n", "\r\n\r\nA device was enrolled from 203.0.113.5.\r\n"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message %q does not contain %q", msg, want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/clock"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"go.uber.org/zap"
+)
+
+// Store finds what expires and remembers the notifications sent, so that
+// each is sent once.
+type Store interface {
+	// ExpiringSecrets returns the live secrets expiring before the Unix
+	// time before, of users with notification channels.
+	ExpiringSecrets(ctx context.Context, before int64) ([]models.Expiring, error)
+	// ExpiringCertificates returns the active certificates issued before
+	// the Unix time issuedBefore, of users with notification channels,
+	// with an expiry validity seconds after issuance.
+	ExpiringCertificates(ctx context.Context, issuedBefore, validity int64) ([]models.Expiring, error)
+	// MarkSent records the notification with the given key and reports
+	// false if it was already recorded.
+	MarkSent(ctx context.Context, login, key string, at int64) (bool, error)
+	// UnmarkSent forgets the notification with the given key.
+	UnmarkSent(ctx context.Context, login, key string) error
+}
+
+// Dispatcher delivers events, see Notifier.
+type Dispatcher interface {
+	// Notify delivers ev and returns the number of channels reached.
+	Notify(ctx context.Context, ev Event) (int, error)
+}
+
+// Scheduler notifies users of secrets and client certificates expiring
+// within Horizon. Each expiry is notified once; a secret whose expiry date
+// changes is notified again. Notifications are claimed in the Store before
+// they are sent, so that server instances sharing the database do not
+// send them twice, and released again if no channel was reached. Runs are
+// serialized; it is safe for concurrent use.
+type Scheduler struct {
+	// Store finds what expires.
+	Store Store
+	// Notifier delivers the events.
+	Notifier Dispatcher
+	// Horizon is how long before an expiry users are notified.
+	Horizon time.Duration
+	// CertValidity is how long client certificates are valid after
+	// issuance.
+	CertValidity time.Duration
+	// Log receives a line per run that sent notifications or failed.
+	Log *zap.Logger
+	// Clock schedules the runs and tells their time; clock.Real when nil.
+	Clock clock.Clock
+
+	run sync.Mutex // held during a run
+}
+
+// NewScheduler constructs a Scheduler notifying of the expiries in store
+// within horizon through notifier.
+func NewScheduler(store Store, notifier Dispatcher, horizon, certValidity time.Duration, log *zap.Logger) *Scheduler {
+	return &Scheduler{Store: store, Notifier: notifier, Horizon: horizon, CertValidity: certValidity, Log: log}
+}
+
+// Start runs the scheduler every interval until ctx is done. The first run
+// is delayed by a random fraction of the interval, so that server
+// instances started together do not run at the same time.
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) {
+	clk := s.clock()
+	go func() {
+		jitter := clk.NewTimer(rand.N(interval))
+		defer jitter.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-jitter.C():
+		}
+
+		ticker := clk.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			_, _ = s.Run(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	}()
+}
+
+// clock returns the Clock of the scheduler.
+func (s *Scheduler) clock() clock.Clock {
+	return cmp.Or(s.Clock, clock.Real)
+}
+
+// Run notifies of the expiries within the horizon not notified yet and
+// returns the number of events sent. Failed deliveries are retried by the
+// next run.
+func (s *Scheduler) Run(ctx context.Context) (int, error) {
+	s.run.Lock()
+	defer s.run.Unlock()
+
+	now := s.clock().Now()
+	before := now.Add(s.Horizon)
+	secrets, err := s.Store.ExpiringSecrets(ctx, before.Unix())
+	if err != nil {
+		s.Log.Error("failed to find expiring secrets", zap.Error(err))
+		return 0, err
+	}
+	validity := int64(s.CertValidity / time.Second)
+	certs, err := s.Store.ExpiringCertificates(ctx, before.Unix()-validity, validity)
+	if err != nil {
+		s.Log.Error("failed to find expiring certificates", zap.Error(err))
+		return 0, err
+	}
+
+	sent := 0
+	for _, e := range secrets {
+		key := fmt.Sprintf("%s:%s:%d", EventSecretExpiry, e.ID, e.ExpiresAt)
+		ev := expiryEvent(EventSecretExpiry, e, now, "Secret %s %s on %s.")
+		if s.send(ctx, key, ev) {
+			sent++
+		}
+	}
+	for _, e := range certs {
+		if e.ExpiresAt <= now.Unix() {
+			continue
+		}
+		key := fmt.Sprintf("%s:%s", EventCertificateExpiry, e.ID)
+		ev := expiryEvent(EventCertificateExpiry, e, now, "Client certificate %s %s on %s. Enroll the device again before then.")
+		if s.send(ctx, key, ev) {
+			sent++
+		}
+	}
+	if sent > 0 {
+		s.Log.Info("sent expiry notifications", zap.Int("sent", sent))
+	}
+	return sent, ctx.Err()
+}
+
+// send claims the notification with the given key and delivers ev, and
+// reports whether it reached a channel.
+func (s *Scheduler) send(ctx context.Context, key string, ev Event) bool {
+	claimed, err := s.Store.MarkSent(ctx, ev.Login, key, ev.Time)
+	if err != nil {
+		s.Log.Error("failed to record notification", zap.Error(err))
+		return false
+	}
+	if !claimed {
+		return false
+	}
+	n, err := s.Notifier.Notify(ctx, ev)
+	if n == 0 && err != nil {
+		if err := s.Store.UnmarkSent(ctx, ev.Login, key); err != nil {
+			s.Log.Error("failed to release notification", zap.Error(err))
+		}
+	}
+	return n > 0
+}
+
+// expiryEvent returns the event of kind announcing e, formatting the
+// message from the ID, "expires" or "expired" and the date.
+func expiryEvent(kind string, e models.Expiring, now time.Time, format string) Event {
+	verb := "expires"
+	if e.ExpiresAt <= now.Unix() {
+		verb = "expired"
+	}
+	date := time.Unix(e.ExpiresAt, 0).UTC().Format(time.DateOnly)
+	return Event{
+		Kind:    kind,
+		Login:   e.Login,
+		Subject: e.ID,
+		Message: fmt.Sprintf(format, e.ID, verb, date),
+		Time:    now.Unix(),
+	}
+}
@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/clock"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"go.uber.org/zap"
+)
+
+// memStore is an in-memory Store.
+type memStore struct {
+	secrets []models.Expiring
+	certs   []models.Expiring
+	sent    map[string]bool
+	// issuedBefore and validity are the arguments of the last
+	// ExpiringCertificates call.
+	issuedBefore, validity int64
+}
+
+func (m *memStore) ExpiringSecrets(_ context.Context, before int64) ([]models.Expiring, error) {
+	var due []models.Expiring
+	for _, e := range m.secrets {
+		if e.ExpiresAt < before {
+			due = append(due, e)
+		}
+	}
+	return due, nil
+}
+
+func (m *memStore) ExpiringCertificates(_ context.Context, issuedBefore, validity int64) ([]models.Expiring, error) {
+	m.issuedBefore, m.validity = issuedBefore, validity
+	return m.certs, nil
+}
+
+func (m *memStore) MarkSent(_ context.Context, login, key string, _ int64) (bool, error) {
+	if m.sent[login+"/"+key] {
+		return false, nil
+	}
+	m.sent[login+"/"+key] = true
+	return true, nil
+}
+
+func (m *memStore) UnmarkSent(_ context.Context, login, key string) error {
+	delete(m.sent, login+"/"+key)
+	return nil
+}
+
+// fakeDispatcher records the events and fails while err is set.
+type fakeDispatcher struct {
+	events []Event
+	err    error
+}
+
+func (d *fakeDispatcher) Notify(_ context.Context, ev Event) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	d.events = append(d.events, ev)
+	return 1, nil
+}
+
+func TestScheduler_Run(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	day := int64(24 * 60 * 60)
+	store := &memStore{
+		secrets: []models.Expiring{
+			{Login: "alice", ID: "soon", ExpiresAt: now.Unix() + day},
+			{Login: "alice", ID: "past", ExpiresAt: now.Unix() - day},
+			{Login: "alice", ID: "later", ExpiresAt: now.Unix() + 30*day},
+		},
+		certs: []models.Expiring{
+			{Login: "bob", ID: "c1", ExpiresAt: now.Unix() + 2*day},
+			{Login: "bob", ID: "c0", ExpiresAt: now.Unix() - day},
+		},
+		sent: make(map[string]bool),
+	}
+	notifier := &fakeDispatcher{}
+	s := NewScheduler(store, notifier, 7*24*time.Hour, 365*24*time.Hour, zap.NewNop())
+	s.Clock = clock.NewFake(now)
+
+	sent, err := s.Run(context.Background())
+	if err != nil || sent != 3 {
+		t.Fatalf("Run = %d, %v; want 3 events", sent, err)
+	}
+	want := []string{"Secret soon expires on 1970-01-13.", "Secret past expired on 1970-01-11.", "Client certificate c1 expires on 1970-01-14. Enroll the device again before then."}
+	for i, ev := range notifier.events {
+		if ev.Message != want[i] || ev.Time != now.Unix() {
+			t.Errorf("event %d = %+v; want message %q", i, ev, want[i])
+		}
+	}
+	if store.validity != 365*day || store.issuedBefore != now.Unix()+7*day-365*day {
+		t.Errorf("certificates queried with issuedBefore %d, validity %d", store.issuedBefore, store.validity)
+	}
+
+	// Each expiry is notified once, unless it changes
+	store.secrets[0].ExpiresAt += day
+	if sent, err := s.Run(context.Background()); err != nil || sent != 1 {
+		t.Errorf("second Run = %d, %v; want only the changed expiry", sent, err)
+	}
+}
+
+func TestScheduler_RetriesFailedDelivery(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	store := &memStore{
+		secrets: []models.Expiring{{Login: "alice", ID: "s1", ExpiresAt: now.Unix() + 60}},
+		sent:    make(map[string]bool),
+	}
+	notifier := &fakeDispatcher{err: errors.New("webhook down")}
+	s := NewScheduler(store, notifier, time.Hour, 365*24*time.Hour, zap.NewNop())
+	s.Clock = clock.NewFake(now)
+
+	if sent, _ := s.Run(context.Background()); sent != 0 {
+		t.Fatalf("Run sent %d events while delivery fails", sent)
+	}
+	notifier.err = nil
+	if sent, err := s.Run(context.Background()); err != nil || sent != 1 {
+		t.Errorf("Run after recovery = %d, %v; want the event sent", sent, err)
+	}
+}
@@ -0,0 +1,1533 @@
+// The gRPC API of the GophKeeper server, served alongside the HTTP API on
+// the same listeners. Run "go generate ./internal/pb" after changing it.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: gophkeeper.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Problem is attached to the status of failed calls, so that clients can
+// react to errors as to the problem details of the HTTP API.
+type Problem struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Status is the HTTP status the error is answered with by the HTTP API.
+	Status int32 `protobuf:"varint,1,opt,name=status,proto3" json:"status,omitempty"`
+	// Code names the kind of error; see the problem package for the codes.
+	Code          string `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Problem) Reset() {
+	*x = Problem{}
+	mi := &file_gophkeeper_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Problem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Problem) ProtoMessage() {}
+
+func (x *Problem) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Problem.ProtoReflect.Descriptor instead.
+func (*Problem) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Problem) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
+func (x *Problem) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+type RegisterRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Login is the username to register.
+	Login string `protobuf:"bytes,1,opt,name=login,proto3" json:"login,omitempty"`
+	// Challenge is the proof-of-work challenge issued by the server, if
+	// required, and solution the client's solution of it.
+	Challenge     string `protobuf:"bytes,2,opt,name=challenge,proto3" json:"challenge,omitempty"`
+	Solution      string `protobuf:"bytes,3,opt,name=solution,proto3" json:"solution,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegisterRequest) Reset() {
+	*x = RegisterRequest{}
+	mi := &file_gophkeeper_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterRequest) ProtoMessage() {}
+
+func (x *RegisterRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterRequest.ProtoReflect.Descriptor instead.
+func (*RegisterRequest) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RegisterRequest) GetLogin() string {
+	if x != nil {
+		return x.Login
+	}
+	return ""
+}
+
+func (x *RegisterRequest) GetChallenge() string {
+	if x != nil {
+		return x.Challenge
+	}
+	return ""
+}
+
+func (x *RegisterRequest) GetSolution() string {
+	if x != nil {
+		return x.Solution
+	}
+	return ""
+}
+
+// Challenge is a proof-of-work challenge to solve before registering.
+type Challenge struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Challenge string                 `protobuf:"bytes,1,opt,name=challenge,proto3" json:"challenge,omitempty"`
+	// Difficulty is the required number of leading zero bits.
+	Difficulty    int32 `protobuf:"varint,2,opt,name=difficulty,proto3" json:"difficulty,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Challenge) Reset() {
+	*x = Challenge{}
+	mi := &file_gophkeeper_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Challenge) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Challenge) ProtoMessage() {}
+
+func (x *Challenge) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Challenge.ProtoReflect.Descriptor instead.
+func (*Challenge) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Challenge) GetChallenge() string {
+	if x != nil {
+		return x.Challenge
+	}
+	return ""
+}
+
+func (x *Challenge) GetDifficulty() int32 {
+	if x != nil {
+		return x.Difficulty
+	}
+	return 0
+}
+
+type RegisterResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Challenge is set, and the other fields are empty, if the request must
+	// be repeated with the solution of the challenge.
+	Challenge *Challenge `protobuf:"bytes,1,opt,name=challenge,proto3" json:"challenge,omitempty"`
+	// Cert and key are the PEM-encoded client certificate and key.
+	Cert string `protobuf:"bytes,2,opt,name=cert,proto3" json:"cert,omitempty"`
+	Key  string `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	// Token is an API bearer token of the user.
+	Token string `protobuf:"bytes,4,opt,name=token,proto3" json:"token,omitempty"`
+	// RecoveryCodes replace a lost certificate, each once; only issued to
+	// new users.
+	RecoveryCodes []string `protobuf:"bytes,5,rep,name=recovery_codes,json=recoveryCodes,proto3" json:"recovery_codes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegisterResponse) Reset() {
+	*x = RegisterResponse{}
+	mi := &file_gophkeeper_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterResponse) ProtoMessage() {}
+
+func (x *RegisterResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterResponse.ProtoReflect.Descriptor instead.
+func (*RegisterResponse) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RegisterResponse) GetChallenge() *Challenge {
+	if x != nil {
+		return x.Challenge
+	}
+	return nil
+}
+
+func (x *RegisterResponse) GetCert() string {
+	if x != nil {
+		return x.Cert
+	}
+	return ""
+}
+
+func (x *RegisterResponse) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *RegisterResponse) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *RegisterResponse) GetRecoveryCodes() []string {
+	if x != nil {
+		return x.RecoveryCodes
+	}
+	return nil
+}
+
+type LoginRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LoginRequest) Reset() {
+	*x = LoginRequest{}
+	mi := &file_gophkeeper_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LoginRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoginRequest) ProtoMessage() {}
+
+func (x *LoginRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoginRequest.ProtoReflect.Descriptor instead.
+func (*LoginRequest) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{4}
+}
+
+type LoginResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// User is the login the client is authenticated as.
+	User          string `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LoginResponse) Reset() {
+	*x = LoginResponse{}
+	mi := &file_gophkeeper_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LoginResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoginResponse) ProtoMessage() {}
+
+func (x *LoginResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoginResponse.ProtoReflect.Descriptor instead.
+func (*LoginResponse) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *LoginResponse) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+// Secret is a secret as stored by the server; see models.Secret.
+type Secret struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type  string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	// Data is the encrypted payload, as encoded by the client.
+	Data      string   `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	Comment   string   `protobuf:"bytes,4,opt,name=comment,proto3" json:"comment,omitempty"`
+	Folder    string   `protobuf:"bytes,5,opt,name=folder,proto3" json:"folder,omitempty"`
+	Tags      []string `protobuf:"bytes,6,rep,name=tags,proto3" json:"tags,omitempty"`
+	Version   int64    `protobuf:"varint,7,opt,name=version,proto3" json:"version,omitempty"`
+	Deleted   bool     `protobuf:"varint,8,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	Reprompt  bool     `protobuf:"varint,9,opt,name=reprompt,proto3" json:"reprompt,omitempty"`
+	ExpiresAt int64    `protobuf:"varint,10,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	// Name is the name of the secret, encrypted by the client like data.
+	Name string `protobuf:"bytes,11,opt,name=name,proto3" json:"name,omitempty"`
+	// BaseVersion is the version of the server's copy an uploaded secret
+	// was edited from, equal to version if the client did not change it;
+	// 0 if unknown.
+	BaseVersion   int64 `protobuf:"varint,12,opt,name=base_version,json=baseVersion,proto3" json:"base_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Secret) Reset() {
+	*x = Secret{}
+	mi := &file_gophkeeper_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Secret) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Secret) ProtoMessage() {}
+
+func (x *Secret) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Secret.ProtoReflect.Descriptor instead.
+func (*Secret) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Secret) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Secret) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Secret) GetData() string {
+	if x != nil {
+		return x.Data
+	}
+	return ""
+}
+
+func (x *Secret) GetComment() string {
+	if x != nil {
+		return x.Comment
+	}
+	return ""
+}
+
+func (x *Secret) GetFolder() string {
+	if x != nil {
+		return x.Folder
+	}
+	return ""
+}
+
+func (x *Secret) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *Secret) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Secret) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+func (x *Secret) GetReprompt() bool {
+	if x != nil {
+		return x.Reprompt
+	}
+	return false
+}
+
+func (x *Secret) GetExpiresAt() int64 {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return 0
+}
+
+func (x *Secret) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Secret) GetBaseVersion() int64 {
+	if x != nil {
+		return x.BaseVersion
+	}
+	return 0
+}
+
+// SyncFilter restricts a sync to part of the vault; see models.SyncFilter.
+type SyncFilter struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Folders       []string               `protobuf:"bytes,1,rep,name=folders,proto3" json:"folders,omitempty"`
+	Tags          []string               `protobuf:"bytes,2,rep,name=tags,proto3" json:"tags,omitempty"`
+	Types         []string               `protobuf:"bytes,3,rep,name=types,proto3" json:"types,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SyncFilter) Reset() {
+	*x = SyncFilter{}
+	mi := &file_gophkeeper_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncFilter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncFilter) ProtoMessage() {}
+
+func (x *SyncFilter) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncFilter.ProtoReflect.Descriptor instead.
+func (*SyncFilter) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SyncFilter) GetFolders() []string {
+	if x != nil {
+		return x.Folders
+	}
+	return nil
+}
+
+func (x *SyncFilter) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *SyncFilter) GetTypes() []string {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+// SyncOptions opens a sync.
+type SyncOptions struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Versions maps the IDs of the secrets the client holds to their
+	// versions.
+	Versions map[string]int64 `protobuf:"bytes,1,rep,name=versions,proto3" json:"versions,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	Filter   *SyncFilter      `protobuf:"bytes,2,opt,name=filter,proto3" json:"filter,omitempty"`
+	// IfNoneMatch is the etag of the client's last sync; if the vault is
+	// unchanged since, the result only has not_modified set.
+	IfNoneMatch string `protobuf:"bytes,3,opt,name=if_none_match,json=ifNoneMatch,proto3" json:"if_none_match,omitempty"`
+	// IncludeDeleted asks for the tombstones of deleted secrets after the
+	// secrets, so that the client drops its copies.
+	IncludeDeleted bool `protobuf:"varint,4,opt,name=include_deleted,json=includeDeleted,proto3" json:"include_deleted,omitempty"`
+	// LastKnownVersion is the version of the client's last sync, 0 if it
+	// never synced; uploads changed concurrently on the server since are
+	// reported as conflicts rather than stored.
+	LastKnownVersion int64 `protobuf:"varint,5,opt,name=last_known_version,json=lastKnownVersion,proto3" json:"last_known_version,omitempty"`
+	// Kdf is the JSON of the parameters the client derives the vault key
+	// with, stored for the user's other devices unless the server holds
+	// some already.
+	Kdf           string `protobuf:"bytes,6,opt,name=kdf,proto3" json:"kdf,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SyncOptions) Reset() {
+	*x = SyncOptions{}
+	mi := &file_gophkeeper_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncOptions) ProtoMessage() {}
+
+func (x *SyncOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncOptions.ProtoReflect.Descriptor instead.
+func (*SyncOptions) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SyncOptions) GetVersions() map[string]int64 {
+	if x != nil {
+		return x.Versions
+	}
+	return nil
+}
+
+func (x *SyncOptions) GetFilter() *SyncFilter {
+	if x != nil {
+		return x.Filter
+	}
+	return nil
+}
+
+func (x *SyncOptions) GetIfNoneMatch() string {
+	if x != nil {
+		return x.IfNoneMatch
+	}
+	return ""
+}
+
+func (x *SyncOptions) GetIncludeDeleted() bool {
+	if x != nil {
+		return x.IncludeDeleted
+	}
+	return false
+}
+
+func (x *SyncOptions) GetLastKnownVersion() int64 {
+	if x != nil {
+		return x.LastKnownVersion
+	}
+	return 0
+}
+
+func (x *SyncOptions) GetKdf() string {
+	if x != nil {
+		return x.Kdf
+	}
+	return ""
+}
+
+type SyncRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Message:
+	//
+	//	*SyncRequest_Options
+	//	*SyncRequest_Secret
+	Message       isSyncRequest_Message `protobuf_oneof:"message"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SyncRequest) Reset() {
+	*x = SyncRequest{}
+	mi := &file_gophkeeper_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncRequest) ProtoMessage() {}
+
+func (x *SyncRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncRequest.ProtoReflect.Descriptor instead.
+func (*SyncRequest) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SyncRequest) GetMessage() isSyncRequest_Message {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *SyncRequest) GetOptions() *SyncOptions {
+	if x != nil {
+		if x, ok := x.Message.(*SyncRequest_Options); ok {
+			return x.Options
+		}
+	}
+	return nil
+}
+
+func (x *SyncRequest) GetSecret() *Secret {
+	if x != nil {
+		if x, ok := x.Message.(*SyncRequest_Secret); ok {
+			return x.Secret
+		}
+	}
+	return nil
+}
+
+type isSyncRequest_Message interface {
+	isSyncRequest_Message()
+}
+
+type SyncRequest_Options struct {
+	Options *SyncOptions `protobuf:"bytes,1,opt,name=options,proto3,oneof"`
+}
+
+type SyncRequest_Secret struct {
+	Secret *Secret `protobuf:"bytes,2,opt,name=secret,proto3,oneof"`
+}
+
+func (*SyncRequest_Options) isSyncRequest_Message() {}
+
+func (*SyncRequest_Secret) isSyncRequest_Message() {}
+
+// Conflict is an uploaded secret the server kept a newer or a concurrently
+// changed version of; see models.Conflict.
+type Conflict struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Id             string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Version        int64                  `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	ServerVersion  int64                  `protobuf:"varint,3,opt,name=server_version,json=serverVersion,proto3" json:"server_version,omitempty"`
+	ServerModified int64                  `protobuf:"varint,4,opt,name=server_modified,json=serverModified,proto3" json:"server_modified,omitempty"`
+	// Concurrent conflicts carry both versions of the secret and the
+	// metadata fields that differ between them.
+	Concurrent    bool     `protobuf:"varint,5,opt,name=concurrent,proto3" json:"concurrent,omitempty"`
+	Client        *Secret  `protobuf:"bytes,6,opt,name=client,proto3" json:"client,omitempty"`
+	Server        *Secret  `protobuf:"bytes,7,opt,name=server,proto3" json:"server,omitempty"`
+	Changed       []string `protobuf:"bytes,8,rep,name=changed,proto3" json:"changed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Conflict) Reset() {
+	*x = Conflict{}
+	mi := &file_gophkeeper_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Conflict) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Conflict) ProtoMessage() {}
+
+func (x *Conflict) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Conflict.ProtoReflect.Descriptor instead.
+func (*Conflict) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Conflict) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Conflict) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Conflict) GetServerVersion() int64 {
+	if x != nil {
+		return x.ServerVersion
+	}
+	return 0
+}
+
+func (x *Conflict) GetServerModified() int64 {
+	if x != nil {
+		return x.ServerModified
+	}
+	return 0
+}
+
+func (x *Conflict) GetConcurrent() bool {
+	if x != nil {
+		return x.Concurrent
+	}
+	return false
+}
+
+func (x *Conflict) GetClient() *Secret {
+	if x != nil {
+		return x.Client
+	}
+	return nil
+}
+
+func (x *Conflict) GetServer() *Secret {
+	if x != nil {
+		return x.Server
+	}
+	return nil
+}
+
+func (x *Conflict) GetChanged() []string {
+	if x != nil {
+		return x.Changed
+	}
+	return nil
+}
+
+// SyncResult ends the response of a sync.
+type SyncResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Version is the latest version of the user's secrets.
+	Version int64 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	// Updated and skipped are the IDs of the uploaded secrets the server
+	// stored and did not, as it has the same or a newer version.
+	Updated   []string    `protobuf:"bytes,2,rep,name=updated,proto3" json:"updated,omitempty"`
+	Skipped   []string    `protobuf:"bytes,3,rep,name=skipped,proto3" json:"skipped,omitempty"`
+	Conflicts []*Conflict `protobuf:"bytes,4,rep,name=conflicts,proto3" json:"conflicts,omitempty"`
+	// Etag identifies the user's secrets for syncs that upload nothing.
+	Etag string `protobuf:"bytes,5,opt,name=etag,proto3" json:"etag,omitempty"`
+	// NotModified reports that the vault is unchanged since the sync that
+	// returned if_none_match; no secrets were sent.
+	NotModified bool `protobuf:"varint,6,opt,name=not_modified,json=notModified,proto3" json:"not_modified,omitempty"`
+	// Summary describes the whole vault after the sync; unset if the sync
+	// changed nothing.
+	Summary *VaultSummary `protobuf:"bytes,7,opt,name=summary,proto3" json:"summary,omitempty"`
+	// Kdf is the JSON of the key derivation parameters of the vault, empty
+	// if no client sent them yet.
+	Kdf string `protobuf:"bytes,8,opt,name=kdf,proto3" json:"kdf,omitempty"`
+	// Restored are the IDs of the uploaded copies the server did not store
+	// as the vault was rolled back to a backup since the client received
+	// them; the client takes the server's versions instead.
+	Restored      []string `protobuf:"bytes,9,rep,name=restored,proto3" json:"restored,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SyncResult) Reset() {
+	*x = SyncResult{}
+	mi := &file_gophkeeper_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncResult) ProtoMessage() {}
+
+func (x *SyncResult) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncResult.ProtoReflect.Descriptor instead.
+func (*SyncResult) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *SyncResult) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *SyncResult) GetUpdated() []string {
+	if x != nil {
+		return x.Updated
+	}
+	return nil
+}
+
+func (x *SyncResult) GetSkipped() []string {
+	if x != nil {
+		return x.Skipped
+	}
+	return nil
+}
+
+func (x *SyncResult) GetConflicts() []*Conflict {
+	if x != nil {
+		return x.Conflicts
+	}
+	return nil
+}
+
+func (x *SyncResult) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+func (x *SyncResult) GetNotModified() bool {
+	if x != nil {
+		return x.NotModified
+	}
+	return false
+}
+
+func (x *SyncResult) GetSummary() *VaultSummary {
+	if x != nil {
+		return x.Summary
+	}
+	return nil
+}
+
+func (x *SyncResult) GetKdf() string {
+	if x != nil {
+		return x.Kdf
+	}
+	return ""
+}
+
+func (x *SyncResult) GetRestored() []string {
+	if x != nil {
+		return x.Restored
+	}
+	return nil
+}
+
+type SyncResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Message:
+	//
+	//	*SyncResponse_Secret
+	//	*SyncResponse_Result
+	Message       isSyncResponse_Message `protobuf_oneof:"message"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SyncResponse) Reset() {
+	*x = SyncResponse{}
+	mi := &file_gophkeeper_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncResponse) ProtoMessage() {}
+
+func (x *SyncResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncResponse.ProtoReflect.Descriptor instead.
+func (*SyncResponse) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *SyncResponse) GetMessage() isSyncResponse_Message {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *SyncResponse) GetSecret() *Secret {
+	if x != nil {
+		if x, ok := x.Message.(*SyncResponse_Secret); ok {
+			return x.Secret
+		}
+	}
+	return nil
+}
+
+func (x *SyncResponse) GetResult() *SyncResult {
+	if x != nil {
+		if x, ok := x.Message.(*SyncResponse_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+type isSyncResponse_Message interface {
+	isSyncResponse_Message()
+}
+
+type SyncResponse_Secret struct {
+	Secret *Secret `protobuf:"bytes,1,opt,name=secret,proto3,oneof"`
+}
+
+type SyncResponse_Result struct {
+	Result *SyncResult `protobuf:"bytes,2,opt,name=result,proto3,oneof"`
+}
+
+func (*SyncResponse_Secret) isSyncResponse_Message() {}
+
+func (*SyncResponse_Result) isSyncResponse_Message() {}
+
+// VaultSummary is the composition of the user's vault; see
+// models.VaultSummary.
+type VaultSummary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Types         map[string]int64       `protobuf:"bytes,1,rep,name=types,proto3" json:"types,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	Folders       map[string]int64       `protobuf:"bytes,2,rep,name=folders,proto3" json:"folders,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	Tags          map[string]int64       `protobuf:"bytes,3,rep,name=tags,proto3" json:"tags,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	TotalBytes    int64                  `protobuf:"varint,4,opt,name=total_bytes,json=totalBytes,proto3" json:"total_bytes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VaultSummary) Reset() {
+	*x = VaultSummary{}
+	mi := &file_gophkeeper_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VaultSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VaultSummary) ProtoMessage() {}
+
+func (x *VaultSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VaultSummary.ProtoReflect.Descriptor instead.
+func (*VaultSummary) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *VaultSummary) GetTypes() map[string]int64 {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+func (x *VaultSummary) GetFolders() map[string]int64 {
+	if x != nil {
+		return x.Folders
+	}
+	return nil
+}
+
+func (x *VaultSummary) GetTags() map[string]int64 {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *VaultSummary) GetTotalBytes() int64 {
+	if x != nil {
+		return x.TotalBytes
+	}
+	return 0
+}
+
+// WatchRequest opens a watch stream.
+type WatchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Filter restricts the secrets pushed to part of the vault, as the
+	// filter of a sync; the tombstones of deleted secrets are pushed
+	// regardless.
+	Filter        *SyncFilter `protobuf:"bytes,1,opt,name=filter,proto3" json:"filter,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_gophkeeper_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *WatchRequest) GetFilter() *SyncFilter {
+	if x != nil {
+		return x.Filter
+	}
+	return nil
+}
+
+// WatchEvent is a message of a watch stream; a message with neither
+// field set is a heartbeat.
+type WatchEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Message:
+	//
+	//	*WatchEvent_Secret
+	//	*WatchEvent_Change
+	Message       isWatchEvent_Message `protobuf_oneof:"message"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEvent) Reset() {
+	*x = WatchEvent{}
+	mi := &file_gophkeeper_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEvent) ProtoMessage() {}
+
+func (x *WatchEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEvent.ProtoReflect.Descriptor instead.
+func (*WatchEvent) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *WatchEvent) GetMessage() isWatchEvent_Message {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *WatchEvent) GetSecret() *Secret {
+	if x != nil {
+		if x, ok := x.Message.(*WatchEvent_Secret); ok {
+			return x.Secret
+		}
+	}
+	return nil
+}
+
+func (x *WatchEvent) GetChange() *WatchChange {
+	if x != nil {
+		if x, ok := x.Message.(*WatchEvent_Change); ok {
+			return x.Change
+		}
+	}
+	return nil
+}
+
+type isWatchEvent_Message interface {
+	isWatchEvent_Message()
+}
+
+type WatchEvent_Secret struct {
+	Secret *Secret `protobuf:"bytes,1,opt,name=secret,proto3,oneof"`
+}
+
+type WatchEvent_Change struct {
+	Change *WatchChange `protobuf:"bytes,2,opt,name=change,proto3,oneof"`
+}
+
+func (*WatchEvent_Secret) isWatchEvent_Message() {}
+
+func (*WatchEvent_Change) isWatchEvent_Message() {}
+
+// WatchChange ends the secrets of a change pushed by Watch. The first
+// message of a stream is a WatchChange too, of the vault as the stream
+// opened, so that clients can tell whether they missed changes before.
+type WatchChange struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Etag identifies the user's secrets after the change, as the etag of
+	// a SyncResult for the filter of the stream; it is taken before the
+	// secrets are read, so that it never covers a change not pushed yet.
+	Etag string `protobuf:"bytes,1,opt,name=etag,proto3" json:"etag,omitempty"`
+	// Resync reports that the change was not pushed, as it is too large or
+	// not known secret by secret; the client should sync instead.
+	Resync        bool `protobuf:"varint,2,opt,name=resync,proto3" json:"resync,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchChange) Reset() {
+	*x = WatchChange{}
+	mi := &file_gophkeeper_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchChange) ProtoMessage() {}
+
+func (x *WatchChange) ProtoReflect() protoreflect.Message {
+	mi := &file_gophkeeper_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchChange.ProtoReflect.Descriptor instead.
+func (*WatchChange) Descriptor() ([]byte, []int) {
+	return file_gophkeeper_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *WatchChange) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+func (x *WatchChange) GetResync() bool {
+	if x != nil {
+		return x.Resync
+	}
+	return false
+}
+
+var File_gophkeeper_proto protoreflect.FileDescriptor
+
+const file_gophkeeper_proto_rawDesc = "" +
+	"\n" +
+	"\x10gophkeeper.proto\x12\rgophkeeper.v1\"5\n" +
+	"\aProblem\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\x05R\x06status\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\tR\x04code\"a\n" +
+	"\x0fRegisterRequest\x12\x14\n" +
+	"\x05login\x18\x01 \x01(\tR\x05login\x12\x1c\n" +
+	"\tchallenge\x18\x02 \x01(\tR\tchallenge\x12\x1a\n" +
+	"\bsolution\x18\x03 \x01(\tR\bsolution\"I\n" +
+	"\tChallenge\x12\x1c\n" +
+	"\tchallenge\x18\x01 \x01(\tR\tchallenge\x12\x1e\n" +
+	"\n" +
+	"difficulty\x18\x02 \x01(\x05R\n" +
+	"difficulty\"\xad\x01\n" +
+	"\x10RegisterResponse\x126\n" +
+	"\tchallenge\x18\x01 \x01(\v2\x18.gophkeeper.v1.ChallengeR\tchallenge\x12\x12\n" +
+	"\x04cert\x18\x02 \x01(\tR\x04cert\x12\x10\n" +
+	"\x03key\x18\x03 \x01(\tR\x03key\x12\x14\n" +
+	"\x05token\x18\x04 \x01(\tR\x05token\x12%\n" +
+	"\x0erecovery_codes\x18\x05 \x03(\tR\rrecoveryCodes\"\x0e\n" +
+	"\fLoginRequest\"#\n" +
+	"\rLoginResponse\x12\x12\n" +
+	"\x04user\x18\x01 \x01(\tR\x04user\"\xac\x02\n" +
+	"\x06Secret\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\tR\x04data\x12\x18\n" +
+	"\acomment\x18\x04 \x01(\tR\acomment\x12\x16\n" +
+	"\x06folder\x18\x05 \x01(\tR\x06folder\x12\x12\n" +
+	"\x04tags\x18\x06 \x03(\tR\x04tags\x12\x18\n" +
+	"\aversion\x18\a \x01(\x03R\aversion\x12\x18\n" +
+	"\adeleted\x18\b \x01(\bR\adeleted\x12\x1a\n" +
+	"\breprompt\x18\t \x01(\bR\breprompt\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\n" +
+	" \x01(\x03R\texpiresAt\x12\x12\n" +
+	"\x04name\x18\v \x01(\tR\x04name\x12!\n" +
+	"\fbase_version\x18\f \x01(\x03R\vbaseVersion\"P\n" +
+	"\n" +
+	"SyncFilter\x12\x18\n" +
+	"\afolders\x18\x01 \x03(\tR\afolders\x12\x12\n" +
+	"\x04tags\x18\x02 \x03(\tR\x04tags\x12\x14\n" +
+	"\x05types\x18\x03 \x03(\tR\x05types\"\xd0\x02\n" +
+	"\vSyncOptions\x12D\n" +
+	"\bversions\x18\x01 \x03(\v2(.gophkeeper.v1.SyncOptions.VersionsEntryR\bversions\x121\n" +
+	"\x06filter\x18\x02 \x01(\v2\x19.gophkeeper.v1.SyncFilterR\x06filter\x12\"\n" +
+	"\rif_none_match\x18\x03 \x01(\tR\vifNoneMatch\x12'\n" +
+	"\x0finclude_deleted\x18\x04 \x01(\bR\x0eincludeDeleted\x12,\n" +
+	"\x12last_known_version\x18\x05 \x01(\x03R\x10lastKnownVersion\x12\x10\n" +
+	"\x03kdf\x18\x06 \x01(\tR\x03kdf\x1a;\n" +
+	"\rVersionsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\"\x81\x01\n" +
+	"\vSyncRequest\x126\n" +
+	"\aoptions\x18\x01 \x01(\v2\x1a.gophkeeper.v1.SyncOptionsH\x00R\aoptions\x12/\n" +
+	"\x06secret\x18\x02 \x01(\v2\x15.gophkeeper.v1.SecretH\x00R\x06secretB\t\n" +
+	"\amessage\"\x9c\x02\n" +
+	"\bConflict\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x03R\aversion\x12%\n" +
+	"\x0eserver_version\x18\x03 \x01(\x03R\rserverVersion\x12'\n" +
+	"\x0fserver_modified\x18\x04 \x01(\x03R\x0eserverModified\x12\x1e\n" +
+	"\n" +
+	"concurrent\x18\x05 \x01(\bR\n" +
+	"concurrent\x12-\n" +
+	"\x06client\x18\x06 \x01(\v2\x15.gophkeeper.v1.SecretR\x06client\x12-\n" +
+	"\x06server\x18\a \x01(\v2\x15.gophkeeper.v1.SecretR\x06server\x12\x18\n" +
+	"\achanged\x18\b \x03(\tR\achanged\"\xad\x02\n" +
+	"\n" +
+	"SyncResult\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\x03R\aversion\x12\x18\n" +
+	"\aupdated\x18\x02 \x03(\tR\aupdated\x12\x18\n" +
+	"\askipped\x18\x03 \x03(\tR\askipped\x125\n" +
+	"\tconflicts\x18\x04 \x03(\v2\x17.gophkeeper.v1.ConflictR\tconflicts\x12\x12\n" +
+	"\x04etag\x18\x05 \x01(\tR\x04etag\x12!\n" +
+	"\fnot_modified\x18\x06 \x01(\bR\vnotModified\x125\n" +
+	"\asummary\x18\a \x01(\v2\x1b.gophkeeper.v1.VaultSummaryR\asummary\x12\x10\n" +
+	"\x03kdf\x18\b \x01(\tR\x03kdf\x12\x1a\n" +
+	"\brestored\x18\t \x03(\tR\brestored\"\x7f\n" +
+	"\fSyncResponse\x12/\n" +
+	"\x06secret\x18\x01 \x01(\v2\x15.gophkeeper.v1.SecretH\x00R\x06secret\x123\n" +
+	"\x06result\x18\x02 \x01(\v2\x19.gophkeeper.v1.SyncResultH\x00R\x06resultB\t\n" +
+	"\amessage\"\x9b\x03\n" +
+	"\fVaultSummary\x12<\n" +
+	"\x05types\x18\x01 \x03(\v2&.gophkeeper.v1.VaultSummary.TypesEntryR\x05types\x12B\n" +
+	"\afolders\x18\x02 \x03(\v2(.gophkeeper.v1.VaultSummary.FoldersEntryR\afolders\x129\n" +
+	"\x04tags\x18\x03 \x03(\v2%.gophkeeper.v1.VaultSummary.TagsEntryR\x04tags\x12\x1f\n" +
+	"\vtotal_bytes\x18\x04 \x01(\x03R\n" +
+	"totalBytes\x1a8\n" +
+	"\n" +
+	"TypesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\x1a:\n" +
+	"\fFoldersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\x1a7\n" +
+	"\tTagsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\"A\n" +
+	"\fWatchRequest\x121\n" +
+	"\x06filter\x18\x01 \x01(\v2\x19.gophkeeper.v1.SyncFilterR\x06filter\"~\n" +
+	"\n" +
+	"WatchEvent\x12/\n" +
+	"\x06secret\x18\x01 \x01(\v2\x15.gophkeeper.v1.SecretH\x00R\x06secret\x124\n" +
+	"\x06change\x18\x02 \x01(\v2\x1a.gophkeeper.v1.WatchChangeH\x00R\x06changeB\t\n" +
+	"\amessage\"9\n" +
+	"\vWatchChange\x12\x12\n" +
+	"\x04etag\x18\x01 \x01(\tR\x04etag\x12\x16\n" +
+	"\x06resync\x18\x02 \x01(\bR\x06resync2\xa5\x02\n" +
+	"\n" +
+	"GophKeeper\x12K\n" +
+	"\bRegister\x12\x1e.gophkeeper.v1.RegisterRequest\x1a\x1f.gophkeeper.v1.RegisterResponse\x12B\n" +
+	"\x05Login\x12\x1b.gophkeeper.v1.LoginRequest\x1a\x1c.gophkeeper.v1.LoginResponse\x12C\n" +
+	"\x04Sync\x12\x1a.gophkeeper.v1.SyncRequest\x1a\x1b.gophkeeper.v1.SyncResponse(\x010\x01\x12A\n" +
+	"\x05Watch\x12\x1b.gophkeeper.v1.WatchRequest\x1a\x19.gophkeeper.v1.WatchEvent0\x01B-Z+github.com/atinyakov/GophKeeper/internal/pbb\x06proto3"
+
+var (
+	file_gophkeeper_proto_rawDescOnce sync.Once
+	file_gophkeeper_proto_rawDescData []byte
+)
+
+func file_gophkeeper_proto_rawDescGZIP() []byte {
+	file_gophkeeper_proto_rawDescOnce.Do(func() {
+		file_gophkeeper_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_gophkeeper_proto_rawDesc), len(file_gophkeeper_proto_rawDesc)))
+	})
+	return file_gophkeeper_proto_rawDescData
+}
+
+var file_gophkeeper_proto_msgTypes = make([]protoimpl.MessageInfo, 21)
+var file_gophkeeper_proto_goTypes = []any{
+	(*Problem)(nil),          // 0: gophkeeper.v1.Problem
+	(*RegisterRequest)(nil),  // 1: gophkeeper.v1.RegisterRequest
+	(*Challenge)(nil),        // 2: gophkeeper.v1.Challenge
+	(*RegisterResponse)(nil), // 3: gophkeeper.v1.RegisterResponse
+	(*LoginRequest)(nil),     // 4: gophkeeper.v1.LoginRequest
+	(*LoginResponse)(nil),    // 5: gophkeeper.v1.LoginResponse
+	(*Secret)(nil),           // 6: gophkeeper.v1.Secret
+	(*SyncFilter)(nil),       // 7: gophkeeper.v1.SyncFilter
+	(*SyncOptions)(nil),      // 8: gophkeeper.v1.SyncOptions
+	(*SyncRequest)(nil),      // 9: gophkeeper.v1.SyncRequest
+	(*Conflict)(nil),         // 10: gophkeeper.v1.Conflict
+	(*SyncResult)(nil),       // 11: gophkeeper.v1.SyncResult
+	(*SyncResponse)(nil),     // 12: gophkeeper.v1.SyncResponse
+	(*VaultSummary)(nil),     // 13: gophkeeper.v1.VaultSummary
+	(*WatchRequest)(nil),     // 14: gophkeeper.v1.WatchRequest
+	(*WatchEvent)(nil),       // 15: gophkeeper.v1.WatchEvent
+	(*WatchChange)(nil),      // 16: gophkeeper.v1.WatchChange
+	nil,                      // 17: gophkeeper.v1.SyncOptions.VersionsEntry
+	nil,                      // 18: gophkeeper.v1.VaultSummary.TypesEntry
+	nil,                      // 19: gophkeeper.v1.VaultSummary.FoldersEntry
+	nil,                      // 20: gophkeeper.v1.VaultSummary.TagsEntry
+}
+var file_gophkeeper_proto_depIdxs = []int32{
+	2,  // 0: gophkeeper.v1.RegisterResponse.challenge:type_name -> gophkeeper.v1.Challenge
+	17, // 1: gophkeeper.v1.SyncOptions.versions:type_name -> gophkeeper.v1.SyncOptions.VersionsEntry
+	7,  // 2: gophkeeper.v1.SyncOptions.filter:type_name -> gophkeeper.v1.SyncFilter
+	8,  // 3: gophkeeper.v1.SyncRequest.options:type_name -> gophkeeper.v1.SyncOptions
+	6,  // 4: gophkeeper.v1.SyncRequest.secret:type_name -> gophkeeper.v1.Secret
+	6,  // 5: gophkeeper.v1.Conflict.client:type_name -> gophkeeper.v1.Secret
+	6,  // 6: gophkeeper.v1.Conflict.server:type_name -> gophkeeper.v1.Secret
+	10, // 7: gophkeeper.v1.SyncResult.conflicts:type_name -> gophkeeper.v1.Conflict
+	13, // 8: gophkeeper.v1.SyncResult.summary:type_name -> gophkeeper.v1.VaultSummary
+	6,  // 9: gophkeeper.v1.SyncResponse.secret:type_name -> gophkeeper.v1.Secret
+	11, // 10: gophkeeper.v1.SyncResponse.result:type_name -> gophkeeper.v1.SyncResult
+	18, // 11: gophkeeper.v1.VaultSummary.types:type_name -> gophkeeper.v1.VaultSummary.TypesEntry
+	19, // 12: gophkeeper.v1.VaultSummary.folders:type_name -> gophkeeper.v1.VaultSummary.FoldersEntry
+	20, // 13: gophkeeper.v1.VaultSummary.tags:type_name -> gophkeeper.v1.VaultSummary.TagsEntry
+	7,  // 14: gophkeeper.v1.WatchRequest.filter:type_name -> gophkeeper.v1.SyncFilter
+	6,  // 15: gophkeeper.v1.WatchEvent.secret:type_name -> gophkeeper.v1.Secret
+	16, // 16: gophkeeper.v1.WatchEvent.change:type_name -> gophkeeper.v1.WatchChange
+	1,  // 17: gophkeeper.v1.GophKeeper.Register:input_type -> gophkeeper.v1.RegisterRequest
+	4,  // 18: gophkeeper.v1.GophKeeper.Login:input_type -> gophkeeper.v1.LoginRequest
+	9,  // 19: gophkeeper.v1.GophKeeper.Sync:input_type -> gophkeeper.v1.SyncRequest
+	14, // 20: gophkeeper.v1.GophKeeper.Watch:input_type -> gophkeeper.v1.WatchRequest
+	3,  // 21: gophkeeper.v1.GophKeeper.Register:output_type -> gophkeeper.v1.RegisterResponse
+	5,  // 22: gophkeeper.v1.GophKeeper.Login:output_type -> gophkeeper.v1.LoginResponse
+	12, // 23: gophkeeper.v1.GophKeeper.Sync:output_type -> gophkeeper.v1.SyncResponse
+	15, // 24: gophkeeper.v1.GophKeeper.Watch:output_type -> gophkeeper.v1.WatchEvent
+	21, // [21:25] is the sub-list for method output_type
+	17, // [17:21] is the sub-list for method input_type
+	17, // [17:17] is the sub-list for extension type_name
+	17, // [17:17] is the sub-list for extension extendee
+	0,  // [0:17] is the sub-list for field type_name
+}
+
+func init() { file_gophkeeper_proto_init() }
+func file_gophkeeper_proto_init() {
+	if File_gophkeeper_proto != nil {
+		return
+	}
+	file_gophkeeper_proto_msgTypes[9].OneofWrappers = []any{
+		(*SyncRequest_Options)(nil),
+		(*SyncRequest_Secret)(nil),
+	}
+	file_gophkeeper_proto_msgTypes[12].OneofWrappers = []any{
+		(*SyncResponse_Secret)(nil),
+		(*SyncResponse_Result)(nil),
+	}
+	file_gophkeeper_proto_msgTypes[15].OneofWrappers = []any{
+		(*WatchEvent_Secret)(nil),
+		(*WatchEvent_Change)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_gophkeeper_proto_rawDesc), len(file_gophkeeper_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   21,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_gophkeeper_proto_goTypes,
+		DependencyIndexes: file_gophkeeper_proto_depIdxs,
+		MessageInfos:      file_gophkeeper_proto_msgTypes,
+	}.Build()
+	File_gophkeeper_proto = out.File
+	file_gophkeeper_proto_goTypes = nil
+	file_gophkeeper_proto_depIdxs = nil
+}
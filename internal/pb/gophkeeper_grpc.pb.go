@@ -0,0 +1,272 @@
+// The gRPC API of the GophKeeper server, served alongside the HTTP API on
+// the same listeners. Run "go generate ./internal/pb" after changing it.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: gophkeeper.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	GophKeeper_Register_FullMethodName = "/gophkeeper.v1.GophKeeper/Register"
+	GophKeeper_Login_FullMethodName    = "/gophkeeper.v1.GophKeeper/Login"
+	GophKeeper_Sync_FullMethodName     = "/gophkeeper.v1.GophKeeper/Sync"
+	GophKeeper_Watch_FullMethodName    = "/gophkeeper.v1.GophKeeper/Watch"
+)
+
+// GophKeeperClient is the client API for GophKeeper service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// GophKeeper registers users and syncs their vaults. Requests are
+// authenticated like those of the HTTP API: by the TLS client certificate
+// or an "authorization: Bearer <token>" metadata entry.
+type GophKeeperClient interface {
+	// Register creates a user and returns the credentials of its first
+	// device, like POST /api/register. A request with the certificate of an
+	// existing user enrolls a further device of the user.
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
+	// Login reports the user the client is authenticated as, like
+	// POST /api/login.
+	Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error)
+	// Sync uploads the client's changes and returns the secrets it lacks,
+	// like POST /api/sync. The client sends SyncOptions first, followed by
+	// its secrets, and closes its side of the stream; the server answers
+	// with the secrets, one message each, followed by the SyncResult.
+	Sync(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SyncRequest, SyncResponse], error)
+	// Watch keeps the stream open and pushes the changes the user's other
+	// devices make to the vault: the secrets stored and the tombstones of
+	// those deleted, one message each, followed by a WatchChange. Idle
+	// streams carry an empty WatchEvent every 30 seconds. Local changes are
+	// still uploaded through Sync.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error)
+}
+
+type gophKeeperClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGophKeeperClient(cc grpc.ClientConnInterface) GophKeeperClient {
+	return &gophKeeperClient{cc}
+}
+
+func (c *gophKeeperClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RegisterResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_Register_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophKeeperClient) Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LoginResponse)
+	err := c.cc.Invoke(ctx, GophKeeper_Login_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gophKeeperClient) Sync(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SyncRequest, SyncResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &GophKeeper_ServiceDesc.Streams[0], GophKeeper_Sync_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SyncRequest, SyncResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GophKeeper_SyncClient = grpc.BidiStreamingClient[SyncRequest, SyncResponse]
+
+func (c *gophKeeperClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &GophKeeper_ServiceDesc.Streams[1], GophKeeper_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, WatchEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GophKeeper_WatchClient = grpc.ServerStreamingClient[WatchEvent]
+
+// GophKeeperServer is the server API for GophKeeper service.
+// All implementations must embed UnimplementedGophKeeperServer
+// for forward compatibility.
+//
+// GophKeeper registers users and syncs their vaults. Requests are
+// authenticated like those of the HTTP API: by the TLS client certificate
+// or an "authorization: Bearer <token>" metadata entry.
+type GophKeeperServer interface {
+	// Register creates a user and returns the credentials of its first
+	// device, like POST /api/register. A request with the certificate of an
+	// existing user enrolls a further device of the user.
+	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
+	// Login reports the user the client is authenticated as, like
+	// POST /api/login.
+	Login(context.Context, *LoginRequest) (*LoginResponse, error)
+	// Sync uploads the client's changes and returns the secrets it lacks,
+	// like POST /api/sync. The client sends SyncOptions first, followed by
+	// its secrets, and closes its side of the stream; the server answers
+	// with the secrets, one message each, followed by the SyncResult.
+	Sync(grpc.BidiStreamingServer[SyncRequest, SyncResponse]) error
+	// Watch keeps the stream open and pushes the changes the user's other
+	// devices make to the vault: the secrets stored and the tombstones of
+	// those deleted, one message each, followed by a WatchChange. Idle
+	// streams carry an empty WatchEvent every 30 seconds. Local changes are
+	// still uploaded through Sync.
+	Watch(*WatchRequest, grpc.ServerStreamingServer[WatchEvent]) error
+	mustEmbedUnimplementedGophKeeperServer()
+}
+
+// UnimplementedGophKeeperServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGophKeeperServer struct{}
+
+func (UnimplementedGophKeeperServer) Register(context.Context, *RegisterRequest) (*RegisterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedGophKeeperServer) Login(context.Context, *LoginRequest) (*LoginResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
+}
+func (UnimplementedGophKeeperServer) Sync(grpc.BidiStreamingServer[SyncRequest, SyncResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Sync not implemented")
+}
+func (UnimplementedGophKeeperServer) Watch(*WatchRequest, grpc.ServerStreamingServer[WatchEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedGophKeeperServer) mustEmbedUnimplementedGophKeeperServer() {}
+func (UnimplementedGophKeeperServer) testEmbeddedByValue()                    {}
+
+// UnsafeGophKeeperServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GophKeeperServer will
+// result in compilation errors.
+type UnsafeGophKeeperServer interface {
+	mustEmbedUnimplementedGophKeeperServer()
+}
+
+func RegisterGophKeeperServer(s grpc.ServiceRegistrar, srv GophKeeperServer) {
+	// If the following call pancis, it indicates UnimplementedGophKeeperServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&GophKeeper_ServiceDesc, srv)
+}
+
+func _GophKeeper_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_Register_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GophKeeper_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GophKeeperServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GophKeeper_Login_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GophKeeperServer).Login(ctx, req.(*LoginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GophKeeper_Sync_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GophKeeperServer).Sync(&grpc.GenericServerStream[SyncRequest, SyncResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GophKeeper_SyncServer = grpc.BidiStreamingServer[SyncRequest, SyncResponse]
+
+func _GophKeeper_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GophKeeperServer).Watch(m, &grpc.GenericServerStream[WatchRequest, WatchEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GophKeeper_WatchServer = grpc.ServerStreamingServer[WatchEvent]
+
+// GophKeeper_ServiceDesc is the grpc.ServiceDesc for GophKeeper service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GophKeeper_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gophkeeper.v1.GophKeeper",
+	HandlerType: (*GophKeeperServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Register",
+			Handler:    _GophKeeper_Register_Handler,
+		},
+		{
+			MethodName: "Login",
+			Handler:    _GophKeeper_Login_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Sync",
+			Handler:       _GophKeeper_Sync_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _GophKeeper_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "gophkeeper.proto",
+}
@@ -0,0 +1,211 @@
+// Package pkcs8 encrypts and decrypts private keys in the PKCS#8
+// EncryptedPrivateKeyInfo format (RFC 5958) using PBES2 with scrypt as the
+// key derivation function (RFC 7914) and AES-256-CBC as the cipher.
+//
+// The output is compatible with "openssl pkcs8 -topk8 -scrypt" and can be
+// read back with "openssl pkey".
+package pkcs8
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// PEMType is the PEM block type of encrypted PKCS#8 private keys.
+const PEMType = "ENCRYPTED PRIVATE KEY"
+
+// ErrIncorrectPassphrase is returned by Decrypt when the key cannot be
+// decrypted with the given passphrase.
+var ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+
+// Scrypt parameters used by Encrypt. They match the OpenSSL defaults and
+// take 16 MiB of memory per derivation; larger costs exceed the memory
+// limit OpenSSL applies when reading keys.
+const (
+	scryptN      = 1 << 14
+	scryptR      = 8
+	scryptP      = 1
+	saltLen      = 16
+	aes256KeyLen = 32
+	// maxScryptN bounds the cost accepted by Decrypt, so a crafted key
+	// file cannot make it allocate gigabytes of memory.
+	maxScryptN = 1 << 20
+)
+
+var (
+	oidPBES2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidScrypt    = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algo          pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+// Encrypt marshals key (as accepted by x509.MarshalPKCS8PrivateKey) and
+// encrypts it with passphrase, returning an "ENCRYPTED PRIVATE KEY" block.
+func Encrypt(key any, passphrase []byte) (*pem.Block, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs8: %w", err)
+	}
+
+	salt := make([]byte, saltLen)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("pkcs8: generate salt: %w", err)
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, fmt.Errorf("pkcs8: generate IV: %w", err)
+	}
+
+	kdfParams, err := asn1.Marshal(scryptParams{
+		Salt:                     salt,
+		CostParameter:            scryptN,
+		BlockSize:                scryptR,
+		ParallelizationParameter: scryptP,
+		KeyLength:                aes256KeyLen,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pkcs8: %w", err)
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs8: %w", err)
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidScrypt, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pkcs8: %w", err)
+	}
+
+	k, err := Scrypt(passphrase, salt, scryptN, scryptR, scryptP, aes256KeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs8: %w", err)
+	}
+	padLen := aes.BlockSize - len(der)%aes.BlockSize
+	data := append(der, bytes.Repeat([]byte{byte(padLen)}, padLen)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	out, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algo:          pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pkcs8: %w", err)
+	}
+	return &pem.Block{Type: PEMType, Bytes: out}, nil
+}
+
+// Decrypt decrypts an "ENCRYPTED PRIVATE KEY" block with passphrase and
+// returns the parsed private key. Only PBES2 with scrypt and AES-256-CBC is
+// supported.
+func Decrypt(block *pem.Block, passphrase []byte) (any, error) {
+	if block.Type != PEMType {
+		return nil, fmt.Errorf("pkcs8: unexpected PEM block type %q", block.Type)
+	}
+
+	var info encryptedPrivateKeyInfo
+	if err := unmarshal(block.Bytes, &info); err != nil {
+		return nil, err
+	}
+	if !info.Algo.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("pkcs8: unsupported encryption algorithm %v", info.Algo.Algorithm)
+	}
+	var params pbes2Params
+	if err := unmarshal(info.Algo.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidScrypt) {
+		return nil, fmt.Errorf("pkcs8: unsupported key derivation function %v", params.KeyDerivationFunc.Algorithm)
+	}
+	if !params.EncryptionScheme.Algorithm.Equal(oidAES256CBC) {
+		return nil, fmt.Errorf("pkcs8: unsupported cipher %v", params.EncryptionScheme.Algorithm)
+	}
+	var kdf scryptParams
+	if err := unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, err
+	}
+	if kdf.CostParameter > maxScryptN {
+		return nil, fmt.Errorf("pkcs8: scrypt cost %d too large", kdf.CostParameter)
+	}
+	if kdf.KeyLength != 0 && kdf.KeyLength != aes256KeyLen {
+		return nil, fmt.Errorf("pkcs8: unexpected key length %d", kdf.KeyLength)
+	}
+	var iv []byte
+	if err := unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, errors.New("pkcs8: invalid IV")
+	}
+	data := info.EncryptedData
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("pkcs8: invalid encrypted data length")
+	}
+
+	k, err := Scrypt(passphrase, kdf.Salt, kdf.CostParameter, kdf.BlockSize, kdf.ParallelizationParameter, aes256KeyLen)
+	if err != nil {
+		return nil, err
+	}
+	c, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs8: %w", err)
+	}
+	der := make([]byte, len(data))
+	cipher.NewCBCDecrypter(c, iv).CryptBlocks(der, data)
+
+	// A wrong passphrase almost always yields invalid padding; the rare
+	// case where it does not is caught when parsing the key.
+	padLen := int(der[len(der)-1])
+	if padLen == 0 || padLen > aes.BlockSize ||
+		subtle.ConstantTimeCompare(der[len(der)-padLen:], bytes.Repeat([]byte{byte(padLen)}, padLen)) != 1 {
+		return nil, ErrIncorrectPassphrase
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der[:len(der)-padLen])
+	if err != nil {
+		return nil, ErrIncorrectPassphrase
+	}
+	return key, nil
+}
+
+// unmarshal parses DER-encoded data into v, rejecting trailing bytes.
+func unmarshal(data []byte, v any) error {
+	rest, err := asn1.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("pkcs8: %w", err)
+	}
+	if len(rest) > 0 {
+		return errors.New("pkcs8: trailing data")
+	}
+	return nil
+}
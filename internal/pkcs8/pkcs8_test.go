@@ -0,0 +1,71 @@
+package pkcs8
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestScrypt(t *testing.T) {
+	// Test vectors from RFC 7914, section 12.
+	tests := []struct {
+		password, salt string
+		n, r, p        int
+		want           string
+	}{
+		{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+	}
+	for _, tt := range tests {
+		got, err := Scrypt([]byte(tt.password), []byte(tt.salt), tt.n, tt.r, tt.p, 64)
+		if err != nil {
+			t.Fatalf("Scrypt(%q, %q) returned error: %v", tt.password, tt.salt, err)
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("Scrypt(%q, %q) = %x; want %s", tt.password, tt.salt, got, tt.want)
+		}
+	}
+
+	if _, err := Scrypt(nil, nil, 1000, 8, 1, 32); err == nil {
+		t.Error("Scrypt with a cost that is not a power of two succeeded; want error")
+	}
+}
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// Test vector from RFC 7914, section 11.
+	got := pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64)
+	want := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if hex.EncodeToString(got) != want {
+		t.Errorf("pbkdf2SHA256 = %x; want %s", got, want)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey returned error: %v", err)
+	}
+
+	block, err := Encrypt(key, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Encrypt returned error: %v", err)
+	}
+	if block.Type != PEMType {
+		t.Errorf("block.Type = %q; want %q", block.Type, PEMType)
+	}
+
+	got, err := Decrypt(block, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("Decrypt returned error: %v", err)
+	}
+	if !key.Equal(got) {
+		t.Error("decrypted key does not match the original")
+	}
+
+	if _, err := Decrypt(block, []byte("wrong")); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Errorf("Decrypt with wrong passphrase = %v; want %v", err, ErrIncorrectPassphrase)
+	}
+}
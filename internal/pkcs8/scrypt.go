@@ -0,0 +1,149 @@
+package pkcs8
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// Scrypt derives a keyLen-byte key from password and salt using the scrypt
+// function of RFC 7914 with CPU/memory cost n, block size r and
+// parallelization p. n must be a power of two greater than 1.
+func Scrypt(password, salt []byte, n, r, p, keyLen int) ([]byte, error) {
+	if n <= 1 || n&(n-1) != 0 {
+		return nil, errors.New("pkcs8: scrypt cost must be a power of two greater than 1")
+	}
+	if r <= 0 || p <= 0 || keyLen <= 0 ||
+		uint64(r)*uint64(p) >= 1<<30 || r > math.MaxInt32/128/p || r > math.MaxInt32/256 || n > math.MaxInt32/128/r {
+		return nil, errors.New("pkcs8: scrypt parameters out of range")
+	}
+
+	b := pbkdf2SHA256(password, salt, 1, p*128*r)
+	v := make([]uint32, 32*n*r)
+	xy := make([]uint32, 64*r)
+	for i := 0; i < p; i++ {
+		smix(b[i*128*r:], r, n, v, xy)
+	}
+	return pbkdf2SHA256(password, b, 1, keyLen), nil
+}
+
+// pbkdf2SHA256 implements PBKDF2 (RFC 8018) with HMAC-SHA256 as the PRF.
+func pbkdf2SHA256(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var counter [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for i := 2; i <= iter; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range u {
+				t[j] ^= u[j]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
+
+// smix runs scryptROMix over the 128*r bytes at the start of b in place,
+// using v (32*n*r words) and xy (64*r words) as scratch space.
+func smix(b []byte, r, n int, v, xy []uint32) {
+	size := 32 * r
+	x, y := xy[:size], xy[size:]
+	for i := range x {
+		x[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+
+	for i := 0; i < n; i++ {
+		copy(v[i*size:], x)
+		blockMix(x, y, r)
+		x, y = y, x
+	}
+	for i := 0; i < n; i++ {
+		j := int(x[(2*r-1)*16] & uint32(n-1))
+		for k, w := range v[j*size : (j+1)*size] {
+			x[k] ^= w
+		}
+		blockMix(x, y, r)
+		x, y = y, x
+	}
+
+	for i, w := range x {
+		binary.LittleEndian.PutUint32(b[4*i:], w)
+	}
+}
+
+// blockMix implements scryptBlockMix: it reads 2*r 64-byte blocks from in
+// and writes the shuffled result to out.
+func blockMix(in, out []uint32, r int) {
+	var x [16]uint32
+	copy(x[:], in[(2*r-1)*16:])
+	for i := 0; i < 2*r; i++ {
+		for j := range x {
+			x[j] ^= in[i*16+j]
+		}
+		salsa208(&x)
+		// Even blocks go to the first half of out, odd ones to the second.
+		copy(out[((i&1)*r+i/2)*16:], x[:])
+	}
+}
+
+// salsa208 applies the Salsa20/8 core to b.
+func salsa208(b *[16]uint32) {
+	x := *b
+	rotl := bits.RotateLeft32
+	for i := 0; i < 8; i += 2 {
+		// Columns.
+		x[4] ^= rotl(x[0]+x[12], 7)
+		x[8] ^= rotl(x[4]+x[0], 9)
+		x[12] ^= rotl(x[8]+x[4], 13)
+		x[0] ^= rotl(x[12]+x[8], 18)
+		x[9] ^= rotl(x[5]+x[1], 7)
+		x[13] ^= rotl(x[9]+x[5], 9)
+		x[1] ^= rotl(x[13]+x[9], 13)
+		x[5] ^= rotl(x[1]+x[13], 18)
+		x[14] ^= rotl(x[10]+x[6], 7)
+		x[2] ^= rotl(x[14]+x[10], 9)
+		x[6] ^= rotl(x[2]+x[14], 13)
+		x[10] ^= rotl(x[6]+x[2], 18)
+		x[3] ^= rotl(x[15]+x[11], 7)
+		x[7] ^= rotl(x[3]+x[15], 9)
+		x[11] ^= rotl(x[7]+x[3], 13)
+		x[15] ^= rotl(x[11]+x[7], 18)
+		// Rows.
+		x[1] ^= rotl(x[0]+x[3], 7)
+		x[2] ^= rotl(x[1]+x[0], 9)
+		x[3] ^= rotl(x[2]+x[1], 13)
+		x[0] ^= rotl(x[3]+x[2], 18)
+		x[6] ^= rotl(x[5]+x[4], 7)
+		x[7] ^= rotl(x[6]+x[5], 9)
+		x[4] ^= rotl(x[7]+x[6], 13)
+		x[5] ^= rotl(x[4]+x[7], 18)
+		x[11] ^= rotl(x[10]+x[9], 7)
+		x[8] ^= rotl(x[11]+x[10], 9)
+		x[9] ^= rotl(x[8]+x[11], 13)
+		x[10] ^= rotl(x[9]+x[8], 18)
+		x[12] ^= rotl(x[15]+x[14], 7)
+		x[13] ^= rotl(x[12]+x[15], 9)
+		x[14] ^= rotl(x[13]+x[12], 13)
+		x[15] ^= rotl(x[14]+x[13], 18)
+	}
+	for i := range b {
+		b[i] += x[i]
+	}
+}
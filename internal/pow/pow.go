@@ -0,0 +1,171 @@
+// Package pow implements hashcash-style proof-of-work challenges used to
+// throttle automated registration.
+//
+// A challenge is a self-contained, HMAC-signed string carrying a random
+// nonce, an expiry time and the difficulty. A solution is a decimal counter
+// such that SHA-256(challenge + ":" + solution) starts with at least
+// difficulty zero bits.
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidChallenge is returned for malformed or forged challenges.
+	ErrInvalidChallenge = errors.New("invalid challenge")
+	// ErrExpiredChallenge is returned for challenges past their expiry time.
+	ErrExpiredChallenge = errors.New("challenge expired")
+	// ErrReusedChallenge is returned when a challenge has already been redeemed.
+	ErrReusedChallenge = errors.New("challenge already used")
+	// ErrInvalidSolution is returned when the solution does not satisfy the difficulty.
+	ErrInvalidSolution = errors.New("invalid challenge solution")
+)
+
+// Challenge is a puzzle issued to a client.
+type Challenge struct {
+	// Challenge is the signed challenge string.
+	Challenge string `json:"challenge"`
+	// Difficulty is the required number of leading zero bits.
+	Difficulty int `json:"difficulty"`
+}
+
+// Issuer creates and verifies challenges. Challenges are stateless; only
+// redeemed challenges are remembered, until they expire, to prevent reuse.
+type Issuer struct {
+	// secret signs challenges.
+	secret []byte
+	// difficulty is the number of leading zero bits required.
+	difficulty int
+	// ttl is the validity period of a challenge.
+	ttl time.Duration
+	// now returns the current time; replaced in tests.
+	now func() time.Time
+
+	mu sync.Mutex
+	// used maps redeemed challenges to their expiry time.
+	used map[string]int64
+}
+
+// NewIssuer creates an Issuer with a random signing key.
+func NewIssuer(difficulty int, ttl time.Duration) (*Issuer, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generate challenge secret: %w", err)
+	}
+	return &Issuer{
+		secret:     secret,
+		difficulty: difficulty,
+		ttl:        ttl,
+		now:        time.Now,
+		used:       make(map[string]int64),
+	}, nil
+}
+
+// Issue creates a new challenge.
+func (i *Issuer) Issue() Challenge {
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	payload := fmt.Sprintf("%s.%d.%d",
+		base64.RawURLEncoding.EncodeToString(nonce), i.now().Add(i.ttl).Unix(), i.difficulty)
+	return Challenge{
+		Challenge:  payload + "." + i.sign(payload),
+		Difficulty: i.difficulty,
+	}
+}
+
+// Verify checks that solution solves challenge and that the challenge was
+// issued by i, has not expired and has not been redeemed before.
+func (i *Issuer) Verify(challenge, solution string) error {
+	payload, sig, ok := cutLast(challenge, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(i.sign(payload))) {
+		return ErrInvalidChallenge
+	}
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return ErrInvalidChallenge
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return ErrInvalidChallenge
+	}
+	difficulty, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return ErrInvalidChallenge
+	}
+
+	now := i.now().Unix()
+	if now > expires {
+		return ErrExpiredChallenge
+	}
+	if !Valid(challenge, solution, difficulty) {
+		return ErrInvalidSolution
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for c, exp := range i.used {
+		if now > exp {
+			delete(i.used, c)
+		}
+	}
+	if _, ok := i.used[challenge]; ok {
+		return ErrReusedChallenge
+	}
+	i.used[challenge] = expires
+	return nil
+}
+
+// sign returns the hex-encoded HMAC of payload.
+func (i *Issuer) sign(payload string) string {
+	mac := hmac.New(sha256.New, i.secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Solve finds a solution for challenge with the given difficulty.
+func Solve(challenge string, difficulty int) string {
+	for n := uint64(0); ; n++ {
+		solution := strconv.FormatUint(n, 10)
+		if Valid(challenge, solution, difficulty) {
+			return solution
+		}
+	}
+}
+
+// Valid reports whether solution solves challenge with the given difficulty.
+func Valid(challenge, solution string, difficulty int) bool {
+	sum := sha256.Sum256([]byte(challenge + ":" + solution))
+	return leadingZeroBits(sum[:]) >= difficulty
+}
+
+// leadingZeroBits counts the leading zero bits of b.
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, x := range b {
+		if x != 0 {
+			return n + bits.LeadingZeros8(x)
+		}
+		n += 8
+	}
+	return n
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
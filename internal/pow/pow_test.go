@@ -0,0 +1,93 @@
+package pow
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIssuer_VerifySolved(t *testing.T) {
+	i, err := NewIssuer(8, time.Minute)
+	if err != nil {
+		t.Fatalf("NewIssuer returned error: %v", err)
+	}
+	c := i.Issue()
+	if c.Difficulty != 8 {
+		t.Errorf("Difficulty = %d; want 8", c.Difficulty)
+	}
+
+	solution := Solve(c.Challenge, c.Difficulty)
+	if err := i.Verify(c.Challenge, solution); err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if err := i.Verify(c.Challenge, solution); !errors.Is(err, ErrReusedChallenge) {
+		t.Errorf("second Verify = %v; want %v", err, ErrReusedChallenge)
+	}
+}
+
+func TestIssuer_VerifyErrors(t *testing.T) {
+	i, err := NewIssuer(8, time.Minute)
+	if err != nil {
+		t.Fatalf("NewIssuer returned error: %v", err)
+	}
+	other, _ := NewIssuer(8, time.Minute)
+
+	c := i.Issue()
+	forged := other.Issue()
+
+	// Find a wrong solution.
+	wrong := "0"
+	for n := 0; Valid(c.Challenge, wrong, c.Difficulty); n++ {
+		wrong = string(rune('a' + n))
+	}
+
+	tests := []struct {
+		name      string
+		challenge string
+		solution  string
+		want      error
+	}{
+		{"malformed", "garbage", "0", ErrInvalidChallenge},
+		{"forged", forged.Challenge, Solve(forged.Challenge, forged.Difficulty), ErrInvalidChallenge},
+		{"wrong solution", c.Challenge, wrong, ErrInvalidSolution},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := i.Verify(tt.challenge, tt.solution); !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIssuer_VerifyExpired(t *testing.T) {
+	i, err := NewIssuer(4, time.Minute)
+	if err != nil {
+		t.Fatalf("NewIssuer returned error: %v", err)
+	}
+	now := time.Unix(1000, 0)
+	i.now = func() time.Time { return now }
+
+	c := i.Issue()
+	now = now.Add(2 * time.Minute)
+	if err := i.Verify(c.Challenge, Solve(c.Challenge, c.Difficulty)); !errors.Is(err, ErrExpiredChallenge) {
+		t.Errorf("Verify = %v; want %v", err, ErrExpiredChallenge)
+	}
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		want int
+	}{
+		{[]byte{0xff}, 0},
+		{[]byte{0x01}, 7},
+		{[]byte{0x00, 0x40}, 9},
+		{[]byte{0x00, 0x00}, 16},
+	}
+	for _, tt := range tests {
+		if got := leadingZeroBits(tt.in); got != tt.want {
+			t.Errorf("leadingZeroBits(%x) = %d; want %d", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package problem
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error is a problem found by code shared by the HTTP and gRPC APIs. The
+// HTTP API answers it with WriteError; the gRPC API returns it as is, see
+// GRPCStatus.
+type Error struct {
+	// Status is the HTTP status of the problem.
+	Status int
+	// Code names the kind of error, e.g. CodeUserExists.
+	Code string
+	// Detail explains the problem.
+	Detail string
+	// RetryAfter tells the client when to retry, if set.
+	RetryAfter time.Duration
+}
+
+// New returns the problem of the given status and code explained by detail.
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// Internal returns a 500 Internal Server Error problem explained by detail.
+func Internal(detail string) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, detail)
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+// WriteError answers r with err: the problem details of an *Error, with a
+// Retry-After header if it is set, and of an internal error otherwise.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var p *Error
+	if !errors.As(err, &p) {
+		p = Internal("internal error")
+	}
+	if p.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int((p.RetryAfter+time.Second-1)/time.Second)))
+	}
+	Write(w, r, p.Status, p.Code, p.Detail)
+}
+
+// grpcCodes maps the HTTP statuses of problems to gRPC status codes.
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.Unauthenticated,
+	http.StatusForbidden:             codes.PermissionDenied,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusConflict:              codes.AlreadyExists,
+	http.StatusPreconditionFailed:    codes.FailedPrecondition,
+	http.StatusRequestEntityTooLarge: codes.ResourceExhausted,
+	http.StatusUnprocessableEntity:   codes.InvalidArgument,
+	http.StatusTooManyRequests:       codes.ResourceExhausted,
+	http.StatusServiceUnavailable:    codes.Unavailable,
+}
+
+// GRPCStatus returns the gRPC status of the problem, carrying its HTTP
+// status and code in a pb.Problem detail. It lets the gRPC server return
+// an *Error like any error of the status package.
+func (e *Error) GRPCStatus() *status.Status {
+	code, ok := grpcCodes[e.Status]
+	if !ok {
+		code = codes.Unknown
+		if e.Status >= http.StatusInternalServerError {
+			code = codes.Internal
+		}
+	}
+	s := status.New(code, e.Detail)
+	if detailed, err := s.WithDetails(&pb.Problem{Status: int32(e.Status), Code: e.Code}); err == nil {
+		return detailed
+	}
+	return s
+}
@@ -0,0 +1,83 @@
+// Package problem implements the error responses of the server, RFC 7807
+// problem details, so that clients and SDKs can react to errors by their
+// code rather than by parsing messages meant for people.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+// ContentType is the media type of problem details.
+const ContentType = "application/problem+json"
+
+// Codes of the errors clients can react to. Errors specific to one
+// endpoint, such as limits.FutureVersionCode, are defined next to it.
+const (
+	CodeInvalidRequest      = "invalid-request"
+	CodeInvalidLogin        = "invalid-login"
+	CodeChallengeFailed     = "challenge-failed"
+	CodeUserExists          = "user-exists"
+	CodeUserNotFound        = "user-not-found"
+	CodeInvalidRecoveryCode = "invalid-recovery-code"
+	CodeUnauthorized        = "unauthorized"
+	CodeCertificateRequired = "certificate-required"
+	CodeInvalidToken        = "invalid-token"
+	CodeLeaseExpired        = "lease-expired"
+	CodeInvalidSession      = "invalid-session"
+	CodeInvalidCSRFToken    = "invalid-csrf-token"
+	CodeNotFound            = "not-found"
+	CodeMethodNotAllowed    = "method-not-allowed"
+	CodeTooLarge            = "too-large"
+	CodeTooManyRequests     = "too-many-requests"
+	CodeInternal            = "internal"
+)
+
+// Details is the body of an error response.
+type Details struct {
+	// Type is a URI identifying the kind of problem; "about:blank" as the
+	// kinds are told apart by Code.
+	Type string `json:"type"`
+	// Title is the text of the HTTP status.
+	Title string `json:"title"`
+	// Status is the HTTP status code.
+	Status int `json:"status"`
+	// Detail explains this occurrence of the problem.
+	Detail string `json:"detail,omitempty"`
+	// Code names the kind of error, e.g. CodeUserExists.
+	Code string `json:"code"`
+	// RequestID identifies the request in the server log.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Write answers r with status and problem details naming the error code
+// and explaining it in detail. It replaces http.Error, so the caller must
+// not have written to w yet; headers set before, e.g. Retry-After, are kept.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", ContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(Details{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Code:      code,
+		RequestID: chiMiddleware.GetReqID(r.Context()),
+	})
+}
+
+// NotFound answers requests for unknown routes.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, http.StatusNotFound, CodeNotFound, "no such endpoint")
+}
+
+// MethodNotAllowed answers requests with a method the route does not
+// serve.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not allowed here")
+}
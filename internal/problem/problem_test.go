@@ -0,0 +1,32 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Retry-After", "5")
+	Write(w, httptest.NewRequest(http.MethodPost, "/api/register", nil), http.StatusTooManyRequests, CodeTooManyRequests, "slow down")
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q; want %q", ct, ContentType)
+	}
+	if ra := w.Header().Get("Retry-After"); ra != "5" {
+		t.Errorf("Retry-After = %q; want it kept", ra)
+	}
+	var got Details
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	want := Details{Type: "about:blank", Title: "Too Many Requests", Status: http.StatusTooManyRequests, Detail: "slow down", Code: CodeTooManyRequests}
+	if got != want {
+		t.Errorf("details = %+v; want %+v", got, want)
+	}
+}
@@ -0,0 +1,188 @@
+package rediscache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis serves GET, SET, DEL, AUTH and SELECT from memory.
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu   sync.Mutex
+	data map[string]string
+	cmds []string
+}
+
+func startFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{ln: ln, password: password, data: make(map[string]string)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(c)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	authed := f.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.cmds = append(f.cmds, args[0])
+		var reply string
+		switch {
+		case args[0] == "AUTH":
+			authed = args[1] == f.password
+			reply = "+OK\r\n"
+			if !authed {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "SELECT":
+			reply = "+OK\r\n"
+		case args[0] == "GET":
+			if v, ok := f.data[args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case args[0] == "SET":
+			f.data[args[1]] = args[2]
+			reply = "+OK\r\n"
+		case args[0] == "DEL":
+			_, ok := f.data[args[1]]
+			delete(f.data, args[1])
+			reply = ":0\r\n"
+			if ok {
+				reply = ":1\r\n"
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+		if _, err := io.WriteString(c, reply); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		args[i] = string(arg[:size])
+	}
+	return args, nil
+}
+
+func TestClient(t *testing.T) {
+	srv := startFakeRedis(t, "s3cret")
+	c, err := New("redis://:s3cret@" + srv.ln.Addr().String() + "/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if _, ok, err := c.Get(ctx, "k"); ok || err != nil {
+		t.Errorf("Get of missing key = %v, %v; want not ok", ok, err)
+	}
+	if err := c.Set(ctx, "k", []byte("v\r\n1"), time.Minute); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+	if v, ok, err := c.Get(ctx, "k"); !ok || err != nil || string(v) != "v\r\n1" {
+		t.Errorf("Get = %q, %v, %v; want v\\r\\n1", v, ok, err)
+	}
+	if err := c.Del(ctx, "k"); err != nil {
+		t.Fatalf("Del returned error: %v", err)
+	}
+	if _, ok, _ := c.Get(ctx, "k"); ok {
+		t.Error("key survived Del")
+	}
+
+	// The connection is authenticated and selects the database once
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if got := strings.Join(srv.cmds, " "); got != "AUTH SELECT GET SET GET DEL GET" {
+		t.Errorf("commands = %s; want one AUTH and SELECT, then the operations", got)
+	}
+}
+
+func TestClient_WrongPassword(t *testing.T) {
+	srv := startFakeRedis(t, "s3cret")
+	c, _ := New("redis://:wrong@" + srv.ln.Addr().String())
+	if _, _, err := c.Get(context.Background(), "k"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Get = %v; want WRONGPASS error", err)
+	}
+}
+
+func TestNew_InvalidURL(t *testing.T) {
+	for _, u := range []string{"localhost:6379", "http://localhost", "redis://localhost/db"} {
+		if _, err := New(u); err == nil {
+			t.Errorf("New(%q) succeeded; want error", u)
+		}
+	}
+}
+
+func TestSyncCache(t *testing.T) {
+	srv := startFakeRedis(t, "")
+	c, _ := New("redis://" + srv.ln.Addr().String())
+	cache := &SyncCache{Client: c, TTL: time.Minute}
+	ctx := context.Background()
+
+	if _, ok, err := cache.Headers(ctx, "alice"); ok || err != nil {
+		t.Fatalf("Headers = %v, %v; want a miss", ok, err)
+	}
+	if err := cache.SetHeaders(ctx, "alice", map[string]int64{"s1": 4}); err != nil {
+		t.Fatal(err)
+	}
+	if h, ok, err := cache.Headers(ctx, "alice"); !ok || err != nil || h["s1"] != 4 {
+		t.Errorf("Headers = %v, %v, %v; want s1:4", h, ok, err)
+	}
+	if err := cache.Invalidate(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := cache.Headers(ctx, "alice"); ok {
+		t.Error("headers survived Invalidate")
+	}
+}
@@ -0,0 +1,49 @@
+package rediscache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// SyncCache caches the secret headers of users in Redis; it implements
+// service.SyncCache. Entries expire after TTL, which bounds how long a
+// cache entry can lag behind the database if an invalidation is lost.
+type SyncCache struct {
+	Client *Client
+	TTL    time.Duration
+}
+
+// key returns the Redis key of the user's headers.
+func key(userID string) string {
+	return "gophkeeper:sync:" + url.PathEscape(userID)
+}
+
+// Headers returns the cached secret headers of the user.
+func (c *SyncCache) Headers(ctx context.Context, userID string) (map[string]int64, bool, error) {
+	data, ok, err := c.Client.Get(ctx, key(userID))
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	var headers map[string]int64
+	if err := json.Unmarshal(data, &headers); err != nil {
+		return nil, false, fmt.Errorf("invalid cached headers: %w", err)
+	}
+	return headers, true, nil
+}
+
+// SetHeaders caches the secret headers of the user.
+func (c *SyncCache) SetHeaders(ctx context.Context, userID string, headers map[string]int64) error {
+	data, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+	return c.Client.Set(ctx, key(userID), data, c.TTL)
+}
+
+// Invalidate drops the cached headers of the user.
+func (c *SyncCache) Invalidate(ctx context.Context, userID string) error {
+	return c.Client.Del(ctx, key(userID))
+}
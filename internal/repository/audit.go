@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// PostgresAuditRepository stores the audit trail and registration attempts in PostgreSQL.
+type PostgresAuditRepository struct {
+	// DB is the database handle for executing queries.
+	DB *sql.DB
+	// Hook observes the queries of the repository; optional.
+	Hook QueryHook
+}
+
+// NewPostgresAuditRepository creates a new PostgresAuditRepository with the given database connection.
+func NewPostgresAuditRepository(db *sql.DB) *PostgresAuditRepository {
+	return &PostgresAuditRepository{DB: db}
+}
+
+// db returns the database handle of the repository, observed by Hook.
+func (s *PostgresAuditRepository) db() querier {
+	return traced(s.DB, s.Hook)
+}
+
+// RecordEvent appends an event to the audit trail.
+func (s *PostgresAuditRepository) RecordEvent(ctx context.Context, e models.AuditEvent) error {
+	_, err := s.db().ExecContext(ctx,
+		`INSERT INTO audit_log (created_at, user_login, ip, action, detail) VALUES ($1, $2, $3, $4, $5)`,
+		e.Time, e.Login, e.IP, e.Action, e.Detail,
+	)
+	if err != nil {
+		return fmt.Errorf("insert audit event: %w", err)
+	}
+	return nil
+}
+
+// GetEvents returns the audit events of the given user, oldest first.
+func (s *PostgresAuditRepository) GetEvents(ctx context.Context, login string) ([]models.AuditEvent, error) {
+	rows, err := s.db().QueryContext(ctx,
+		`SELECT created_at, user_login, ip, action, detail FROM audit_log WHERE user_login = $1 ORDER BY id`,
+		login,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		var e models.AuditEvent
+		if err := rows.Scan(&e.Time, &e.Login, &e.IP, &e.Action, &e.Detail); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// GetAttempts returns the registration attempts recorded for ip, or nil if there are none.
+func (s *PostgresAuditRepository) GetAttempts(ctx context.Context, ip string) (*models.RegistrationAttempts, error) {
+	a := models.RegistrationAttempts{IP: ip}
+	err := s.db().QueryRowContext(ctx,
+		`SELECT failures, last_attempt, banned_until FROM registration_attempts WHERE ip = $1`,
+		ip,
+	).Scan(&a.Failures, &a.LastAttempt, &a.BannedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select registration attempts: %w", err)
+	}
+	return &a, nil
+}
+
+// SaveAttempts inserts or replaces the registration attempts of an IP address.
+func (s *PostgresAuditRepository) SaveAttempts(ctx context.Context, a models.RegistrationAttempts) error {
+	_, err := s.db().ExecContext(ctx, `
+		INSERT INTO registration_attempts (ip, failures, last_attempt, banned_until) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (ip) DO UPDATE SET
+			failures = EXCLUDED.failures,
+			last_attempt = EXCLUDED.last_attempt,
+			banned_until = EXCLUDED.banned_until
+	`, a.IP, a.Failures, a.LastAttempt, a.BannedUntil)
+	if err != nil {
+		return fmt.Errorf("upsert registration attempts: %w", err)
+	}
+	return nil
+}
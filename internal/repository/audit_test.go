@@ -0,0 +1,110 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	repo "github.com/atinyakov/GophKeeper/internal/repository"
+)
+
+func setupAuditMock(t *testing.T) (*repo.PostgresAuditRepository, sqlmock.Sqlmock, func()) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	return repo.NewPostgresAuditRepository(db), mock, func() { db.Close() }
+}
+
+func TestRecordEvent(t *testing.T) {
+	service, mock, cleanup := setupAuditMock(t)
+	defer cleanup()
+
+	e := models.AuditEvent{Time: 10, Login: "alice", IP: "10.0.0.1", Action: "register"}
+	mock.ExpectExec(regexp.QuoteMeta(
+		`INSERT INTO audit_log (created_at, user_login, ip, action, detail) VALUES ($1, $2, $3, $4, $5)`,
+	)).
+		WithArgs(e.Time, e.Login, e.IP, e.Action, e.Detail).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := service.RecordEvent(context.Background(), e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetEvents(t *testing.T) {
+	service, mock, cleanup := setupAuditMock(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT created_at, user_login, ip, action, detail FROM audit_log WHERE user_login = $1`)).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "user_login", "ip", "action", "detail"}).
+			AddRow(int64(10), "alice", "10.0.0.1", "register", "").
+			AddRow(int64(20), "alice", "10.0.0.1", "recover", "code used"))
+
+	events, err := service.GetEvents(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 2 || events[0].Action != "register" || events[1].Detail != "code used" {
+		t.Errorf("GetEvents = %+v; want both events in order", events)
+	}
+}
+
+func TestGetAttempts(t *testing.T) {
+	service, mock, cleanup := setupAuditMock(t)
+	defer cleanup()
+
+	query := regexp.QuoteMeta(`SELECT failures, last_attempt, banned_until FROM registration_attempts WHERE ip = $1`)
+	mock.ExpectQuery(query).
+		WithArgs("10.0.0.1").
+		WillReturnRows(sqlmock.NewRows([]string{"failures", "last_attempt", "banned_until"}).AddRow(3, int64(50), int64(0)))
+	mock.ExpectQuery(query).
+		WithArgs("10.0.0.2").
+		WillReturnError(sql.ErrNoRows)
+
+	a, err := service.GetAttempts(context.Background(), "10.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a == nil || a.Failures != 3 || a.LastAttempt != 50 || a.IP != "10.0.0.1" {
+		t.Errorf("unexpected attempts: %+v", a)
+	}
+
+	a, err = service.GetAttempts(context.Background(), "10.0.0.2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a != nil {
+		t.Errorf("expected nil attempts, got %+v", a)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestSaveAttempts(t *testing.T) {
+	service, mock, cleanup := setupAuditMock(t)
+	defer cleanup()
+
+	a := models.RegistrationAttempts{IP: "10.0.0.1", Failures: 5, LastAttempt: 60, BannedUntil: 120}
+	mock.ExpectExec(regexp.QuoteMeta(
+		`INSERT INTO registration_attempts (ip, failures, last_attempt, banned_until) VALUES ($1, $2, $3, $4)`,
+	)).
+		WithArgs(a.IP, a.Failures, a.LastAttempt, a.BannedUntil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := service.SaveAttempts(context.Background(), a); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
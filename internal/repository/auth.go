@@ -4,8 +4,11 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/atinyakov/GophKeeper/internal/models"
 	"github.com/lib/pq"
 )
 
@@ -13,6 +16,8 @@ import (
 type PostgresAuthRepository struct {
 	// DB is the database handle for executing queries.
 	DB *sql.DB
+	// Hook observes the queries of the repository; optional.
+	Hook QueryHook
 }
 
 // NewPostgresAuthRepository creates a new PostgresAuthService with the given database connection.
@@ -21,14 +26,20 @@ func NewPostgresAuthRepository(db *sql.DB) *PostgresAuthRepository {
 	return &PostgresAuthRepository{DB: db}
 }
 
+// db returns the database handle of the repository, observed by Hook.
+func (s *PostgresAuthRepository) db() querier {
+	return traced(s.DB, s.Hook)
+}
+
 // UserExists checks whether a user with the specified login exists in the database.
+// Logins are compared case-insensitively.
 // It returns true if the user exists, false otherwise.
 // If an error occurs during the query, it is returned.
 func (s *PostgresAuthRepository) UserExists(ctx context.Context, login string) (bool, error) {
 	var exists bool
-	err := s.DB.QueryRowContext(
+	err := s.db().QueryRowContext(
 		ctx,
-		`SELECT EXISTS(SELECT 1 FROM users WHERE login = $1)`,
+		`SELECT EXISTS(SELECT 1 FROM users WHERE lower(login) = lower($1))`,
 		login,
 	).Scan(&exists)
 	return exists, err
@@ -38,7 +49,7 @@ func (s *PostgresAuthRepository) UserExists(ctx context.Context, login string) (
 // If a user with the same login already exists, the ON CONFLICT DO NOTHING clause prevents an error.
 // Returns any error encountered while executing the insertion.
 func (s *PostgresAuthRepository) RegisterUser(ctx context.Context, login string) error {
-	_, err := s.DB.ExecContext(
+	_, err := s.db().ExecContext(
 		ctx,
 		`INSERT INTO users (login) VALUES ($1)`,
 		login,
@@ -52,3 +63,173 @@ func (s *PostgresAuthRepository) RegisterUser(ctx context.Context, login string)
 	}
 	return nil
 }
+
+// SaveToken stores the hash of an API token issued to the given user with
+// its lease. Only the hash is persisted so a database leak does not expose
+// usable tokens.
+func (s *PostgresAuthRepository) SaveToken(ctx context.Context, login, tokenHash string, lease models.Lease) error {
+	_, err := s.db().ExecContext(
+		ctx,
+		`INSERT INTO api_tokens (token_hash, user_id, lease_id, created_at, ttl, expires_at) VALUES ($1, (SELECT id FROM users WHERE login = $2), $3, $4, $5, $6)`,
+		tokenHash, login, lease.ID, lease.IssuedAt, lease.TTL, lease.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert token: %w", err)
+	}
+	return nil
+}
+
+// GetUserByToken returns the login owning the given token hash and the
+// lease of the token. It returns an empty string and no error if the token
+// is unknown.
+func (s *PostgresAuthRepository) GetUserByToken(ctx context.Context, tokenHash string) (string, models.Lease, error) {
+	var (
+		login string
+		lease models.Lease
+	)
+	err := s.db().QueryRowContext(
+		ctx,
+		`SELECT u.login, t.lease_id, t.created_at, t.ttl, t.expires_at FROM api_tokens t JOIN users u ON u.id = t.user_id WHERE t.token_hash = $1`,
+		tokenHash,
+	).Scan(&login, &lease.ID, &lease.IssuedAt, &lease.TTL, &lease.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", models.Lease{}, nil
+	}
+	if err != nil {
+		return "", models.Lease{}, fmt.Errorf("select token: %w", err)
+	}
+	return login, lease, nil
+}
+
+// GetLeases returns the leases of the user's API tokens, oldest first,
+// with the secrets sent to each token according to the access log, where
+// tokens are recorded as "api-token:<lease ID>".
+func (s *PostgresAuthRepository) GetLeases(ctx context.Context, login string) ([]models.Lease, error) {
+	rows, err := s.db().QueryContext(ctx, `
+		SELECT t.lease_id, t.created_at, t.ttl, t.expires_at,
+			COALESCE(MAX(a.accessed_at), 0), COUNT(DISTINCT a.secret_id)
+		FROM api_tokens t
+		LEFT JOIN secret_access a ON a.user_id = t.user_id AND a.device_id = 'api-token:' || t.lease_id
+		WHERE t.user_id = (SELECT id FROM users WHERE login = $1)
+		GROUP BY t.token_hash
+		ORDER BY t.created_at, t.lease_id
+	`, login)
+	if err != nil {
+		return nil, fmt.Errorf("select leases: %w", err)
+	}
+	defer rows.Close()
+
+	var leases []models.Lease
+	for rows.Next() {
+		var l models.Lease
+		if err := rows.Scan(&l.ID, &l.IssuedAt, &l.TTL, &l.ExpiresAt, &l.LastFetch, &l.Fetched); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		leases = append(leases, l)
+	}
+	return leases, rows.Err()
+}
+
+// UpdateLease sets the TTL and expiry of the user's lease with the given
+// ID and reports whether it exists.
+func (s *PostgresAuthRepository) UpdateLease(ctx context.Context, login, id string, ttl, expiresAt int64) (bool, error) {
+	res, err := s.db().ExecContext(ctx,
+		`UPDATE api_tokens SET ttl = $3, expires_at = $4 WHERE user_id = (SELECT id FROM users WHERE login = $1) AND lease_id = $2`,
+		login, id, ttl, expiresAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("update lease: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected: %w", err)
+	}
+	return n > 0, nil
+}
+
+// DeleteLease deletes the user's API token with the given lease ID and
+// reports whether it existed.
+func (s *PostgresAuthRepository) DeleteLease(ctx context.Context, login, id string) (bool, error) {
+	res, err := s.db().ExecContext(ctx,
+		`DELETE FROM api_tokens WHERE user_id = (SELECT id FROM users WHERE login = $1) AND lease_id = $2`,
+		login, id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("delete lease: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected: %w", err)
+	}
+	return n > 0, nil
+}
+
+// RevokeAccess deletes all API tokens and browser sessions of the user in
+// a single transaction and returns their number.
+func (s *PostgresAuthRepository) RevokeAccess(ctx context.Context, login string) (int64, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	q := traced(tx, s.Hook)
+
+	var total int64
+	for _, table := range []string{"api_tokens", "sessions"} {
+		res, err := q.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = (SELECT id FROM users WHERE login = $1)`, login)
+		if err != nil {
+			return 0, fmt.Errorf("delete %s: %w", table, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("rows affected: %w", err)
+		}
+		total += n
+	}
+	return total, tx.Commit()
+}
+
+// SaveRecoveryCodes replaces the recovery codes of the user with the given
+// code hashes in a single transaction.
+func (s *PostgresAuthRepository) SaveRecoveryCodes(ctx context.Context, login string, codeHashes []string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	q := traced(tx, s.Hook)
+
+	if _, err := q.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = (SELECT id FROM users WHERE login = $1)`, login); err != nil {
+		return fmt.Errorf("delete recovery codes: %w", err)
+	}
+	now := time.Now().Unix()
+	for _, h := range codeHashes {
+		if _, err := q.ExecContext(
+			ctx,
+			`INSERT INTO recovery_codes (code_hash, user_id, created_at) VALUES ($1, (SELECT id FROM users WHERE login = $2), $3)`,
+			h, login, now,
+		); err != nil {
+			return fmt.Errorf("insert recovery code: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode deletes the recovery code with the given hash of the
+// user and reports whether it existed. Deleting makes the check and the
+// invalidation atomic, so a code cannot be used twice concurrently.
+func (s *PostgresAuthRepository) UseRecoveryCode(ctx context.Context, login, codeHash string) (bool, error) {
+	res, err := s.db().ExecContext(
+		ctx,
+		`DELETE FROM recovery_codes WHERE user_id = (SELECT id FROM users WHERE login = $1) AND code_hash = $2`,
+		login, codeHash,
+	)
+	if err != nil {
+		return false, fmt.Errorf("delete recovery code: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("delete recovery code: %w", err)
+	}
+	return n > 0, nil
+}
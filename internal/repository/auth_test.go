@@ -2,11 +2,14 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"reflect"
 	"regexp"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/atinyakov/GophKeeper/internal/models"
 )
 
 func setupAuthMock(t *testing.T) (*PostgresAuthRepository, sqlmock.Sqlmock, func()) {
@@ -24,7 +27,7 @@ func TestUserExists_True(t *testing.T) {
 	defer cleanup()
 
 	login := "user1"
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS(SELECT 1 FROM users WHERE login = $1)`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS(SELECT 1 FROM users WHERE lower(login) = lower($1))`)).
 		WithArgs(login).
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
 
@@ -45,7 +48,7 @@ func TestUserExists_False(t *testing.T) {
 	defer cleanup()
 
 	login := "user2"
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS(SELECT 1 FROM users WHERE login = $1)`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS(SELECT 1 FROM users WHERE lower(login) = lower($1))`)).
 		WithArgs(login).
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 
@@ -66,7 +69,7 @@ func TestUserExists_Error(t *testing.T) {
 	defer cleanup()
 
 	login := "user3"
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS(SELECT 1 FROM users WHERE login = $1)`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS(SELECT 1 FROM users WHERE lower(login) = lower($1))`)).
 		WithArgs(login).
 		WillReturnError(errors.New("query failed"))
 
@@ -114,3 +117,131 @@ func TestRegisterUser_Error(t *testing.T) {
 		t.Errorf("unfulfilled expectations: %v", err)
 	}
 }
+
+func TestSaveToken_Success(t *testing.T) {
+	service, mock, cleanup := setupAuthMock(t)
+	defer cleanup()
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO api_tokens (token_hash, user_id, lease_id, created_at, ttl, expires_at) VALUES ($1, (SELECT id FROM users WHERE login = $2), $3, $4, $5, $6)`)).
+		WithArgs("hash1", "alice", "hash", int64(100), int64(60), int64(160)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	lease := models.Lease{ID: "hash", IssuedAt: 100, TTL: 60, ExpiresAt: 160}
+	if err := service.SaveToken(context.Background(), "alice", "hash1", lease); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetUserByToken(t *testing.T) {
+	service, mock, cleanup := setupAuthMock(t)
+	defer cleanup()
+
+	query := regexp.QuoteMeta(`SELECT u.login, t.lease_id, t.created_at, t.ttl, t.expires_at FROM api_tokens t JOIN users u ON u.id = t.user_id WHERE t.token_hash = $1`)
+	mock.ExpectQuery(query).
+		WithArgs("known").
+		WillReturnRows(sqlmock.NewRows([]string{"user_login", "lease_id", "created_at", "ttl", "expires_at"}).
+			AddRow("alice", "kn", int64(100), int64(60), int64(160)))
+	mock.ExpectQuery(query).
+		WithArgs("unknown").
+		WillReturnError(sql.ErrNoRows)
+
+	login, lease, err := service.GetUserByToken(context.Background(), "known")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if login != "alice" || lease != (models.Lease{ID: "kn", IssuedAt: 100, TTL: 60, ExpiresAt: 160}) {
+		t.Errorf("GetUserByToken = %q, %+v", login, lease)
+	}
+
+	login, _, err = service.GetUserByToken(context.Background(), "unknown")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if login != "" {
+		t.Errorf("login = %q; want empty", login)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestLeases(t *testing.T) {
+	service, mock, cleanup := setupAuthMock(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT t.lease_id, t.created_at, t.ttl, t.expires_at,`)).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"lease_id", "created_at", "ttl", "expires_at", "last_fetch", "fetched"}).
+			AddRow("l1", int64(100), int64(0), int64(0), int64(0), int64(0)).
+			AddRow("l2", int64(200), int64(60), int64(260), int64(230), int64(3)))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE api_tokens SET ttl = $3, expires_at = $4 WHERE user_id = (SELECT id FROM users WHERE login = $1) AND lease_id = $2`)).
+		WithArgs("alice", "l2", int64(120), int64(350)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM api_tokens WHERE user_id = (SELECT id FROM users WHERE login = $1) AND lease_id = $2`)).
+		WithArgs("alice", "gone").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	leases, err := service.GetLeases(ctx, "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []models.Lease{{ID: "l1", IssuedAt: 100}, {ID: "l2", IssuedAt: 200, TTL: 60, ExpiresAt: 260, LastFetch: 230, Fetched: 3}}
+	if !reflect.DeepEqual(leases, want) {
+		t.Errorf("leases = %+v; want %+v", leases, want)
+	}
+	if ok, err := service.UpdateLease(ctx, "alice", "l2", 120, 350); err != nil || !ok {
+		t.Errorf("UpdateLease = %v, %v; want true", ok, err)
+	}
+	if ok, err := service.DeleteLease(ctx, "alice", "gone"); err != nil || ok {
+		t.Errorf("DeleteLease = %v, %v; want false", ok, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestSaveRecoveryCodes(t *testing.T) {
+	service, mock, cleanup := setupAuthMock(t)
+	defer cleanup()
+
+	insert := regexp.QuoteMeta(`INSERT INTO recovery_codes (code_hash, user_id, created_at) VALUES ($1, (SELECT id FROM users WHERE login = $2), $3)`)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM recovery_codes WHERE user_id = (SELECT id FROM users WHERE login = $1)`)).
+		WithArgs("alice").
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec(insert).WithArgs("h1", "alice", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insert).WithArgs("h2", "alice", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := service.SaveRecoveryCodes(context.Background(), "alice", []string{"h1", "h2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	service, mock, cleanup := setupAuthMock(t)
+	defer cleanup()
+
+	query := regexp.QuoteMeta(`DELETE FROM recovery_codes WHERE user_id = (SELECT id FROM users WHERE login = $1) AND code_hash = $2`)
+	mock.ExpectExec(query).WithArgs("alice", "known").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).WithArgs("alice", "used").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if ok, err := service.UseRecoveryCode(context.Background(), "alice", "known"); err != nil || !ok {
+		t.Errorf("UseRecoveryCode(known) = %v, %v; want true, nil", ok, err)
+	}
+	if ok, err := service.UseRecoveryCode(context.Background(), "alice", "used"); err != nil || ok {
+		t.Errorf("UseRecoveryCode(used) = %v, %v; want false, nil", ok, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
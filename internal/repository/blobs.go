@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// Payloads of at least BlobThreshold bytes, after compression, are stored
+// in the blob store when one is configured. The data column then holds
+//
+//	payloadMagic || codecBlob || key
+//
+// where key names the blob of the secret version, see blobKey. The blob
+// holds the packed payload, i.e. it is compressed like the column.
+
+// blobKey returns the key of the blob holding the payload of the given
+// version of a secret.
+func blobKey(userID, secretID string, version int64) string {
+	return url.PathEscape(userID) + "/" + url.PathEscape(secretID) + "/" + strconv.FormatInt(version, 10)
+}
+
+// blobRef returns the blob key referenced by a data column value.
+func blobRef(b []byte) (string, bool) {
+	prefix := payloadMagic + string(codecBlob)
+	if !bytes.HasPrefix(b, []byte(prefix)) {
+		return "", false
+	}
+	return string(b[len(prefix):]), true
+}
+
+// storeData returns the data column value for a secret version, moving the
+// payload to the blob store if it is large. It returns the key of the
+// stored blob, if any.
+func (s *PostgresSyncRepository) storeData(ctx context.Context, userID, secretID string, version int64, data string) ([]byte, string, error) {
+	packed := packData(data)
+	if s.Blobs == nil || len(packed) < s.BlobThreshold {
+		return packed, "", nil
+	}
+	key := blobKey(userID, secretID, version)
+	if err := s.Blobs.Put(ctx, key, packed); err != nil {
+		return nil, "", fmt.Errorf("store payload: %w", err)
+	}
+	return append([]byte(payloadMagic+string(codecBlob)), key...), key, nil
+}
+
+// loadData decodes a data column value, fetching the payload from the blob
+// store if it was moved there.
+func (s *PostgresSyncRepository) loadData(ctx context.Context, b []byte) (string, error) {
+	key, ok := blobRef(b)
+	if !ok {
+		return unpackData(b)
+	}
+	if s.Blobs == nil {
+		return "", fmt.Errorf("load payload %s: no blob store configured", key)
+	}
+	packed, err := s.Blobs.Get(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("load payload: %w", err)
+	}
+	return unpackData(packed)
+}
+
+// deleteBlobs removes blobs that are no longer referenced. Failures leave
+// orphaned blobs behind but do not fail the operation that released them.
+func (s *PostgresSyncRepository) deleteBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		_ = s.Blobs.Delete(ctx, key)
+	}
+}
+
+// blobRefs returns the blob keys referenced by the live secrets with the
+// given IDs.
+func (s *PostgresSyncRepository) blobRefs(ctx context.Context, userID string, ids []string) ([]string, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT data FROM secrets
+		WHERE user_id = (SELECT id FROM users WHERE login = $1) AND id = ANY($2) AND deleted = false AND substring(data from 1 for $3) = $4
+	`, userID, pq.Array(ids), len(payloadMagic)+1, []byte(payloadMagic+string(codecBlob)))
+	if err != nil {
+		return nil, fmt.Errorf("blobRefs: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		if key, ok := blobRef(data); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,137 @@
+package repository_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/atinyakov/GophKeeper/internal/blobstore"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/lib/pq"
+)
+
+// memBlobs is an in-memory blobstore.Store.
+type memBlobs map[string][]byte
+
+func (m memBlobs) Put(ctx context.Context, key string, data []byte) error {
+	m[key] = data
+	return nil
+}
+
+func (m memBlobs) Get(ctx context.Context, key string) ([]byte, error) {
+	data, ok := m[key]
+	if !ok {
+		return nil, blobstore.ErrNotFound
+	}
+	return data, nil
+}
+
+func (m memBlobs) Delete(ctx context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+// blobColumn matches a data column value referencing the blob with key.
+type blobColumn string
+
+func (key blobColumn) Match(v driver.Value) bool {
+	b, ok := v.([]byte)
+	return ok && bytes.HasPrefix(b, []byte("\x00GK\x02")) && string(b[4:]) == string(key)
+}
+
+func TestUpsertIfNewer_StoresLargePayloadInBlobs(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+	blobs := memBlobs{"u1/s1/4": []byte("old")}
+	service.Blobs = blobs
+	service.BlobThreshold = 100
+
+	large := models.Secret{ID: "s1", Type: "binary", Data: strings.Repeat("QUJD", 100), Version: 5}
+	small := models.Secret{ID: "s2", Type: "text", Data: "short", Version: 5}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT version, modified_at, deleted, CASE WHEN`)).
+		WithArgs("s1", "u1", 4, []byte("\x00GK\x02")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "modified_at", "deleted", "data"}).AddRow(int64(4), int64(0), false, []byte("\x00GK\x02u1/s1/4")))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO secrets`)).
+		WithArgs("s1", "u1", "binary", blobColumn("u1/s1/5"), "", "", pq.Array([]string{}), int64(5), false, sqlmock.AnyArg(), int64(0), "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT version, modified_at, deleted, CASE WHEN`)).
+		WithArgs("s2", "u1", 4, []byte("\x00GK\x02")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "modified_at", "deleted", "data"}))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO secrets`)).
+		WithArgs("s2", "u1", "text", []byte("short"), "", "", pq.Array([]string{}), int64(5), false, sqlmock.AnyArg(), int64(0), "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if _, _, _, err := service.UpsertIfNewer(context.Background(), "u1", []models.Secret{large, small}); err != nil {
+		t.Fatalf("UpsertIfNewer returned error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+	if _, ok := blobs["u1/s1/5"]; !ok || len(blobs) != 1 {
+		t.Errorf("blobs = %v; want only the new version of s1", blobs)
+	}
+
+	// Reads fetch the payload from the blob store
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, type, data`)).
+		WithArgs("u1", "s1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "data", "comment", "folder", "tags", "version", "deleted", "reprompt", "expires_at", "name"}).
+			AddRow("s1", "binary", []byte("\x00GK\x02u1/s1/5"), "", "", "{}", int64(5), false, false, int64(0), ""))
+	sec, err := service.GetSecretByID(context.Background(), "u1", "s1")
+	if err != nil || sec.Data != large.Data {
+		t.Errorf("GetSecretByID = %v; want the payload from the blob store", err)
+	}
+}
+
+func TestUpsertIfNewer_RemovesBlobsOnFailure(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+	blobs := memBlobs{}
+	service.Blobs = blobs
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT version, modified_at, deleted, CASE WHEN`)).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "modified_at", "deleted", "data"}))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO secrets`)).WillReturnError(errors.New("disk full"))
+	mock.ExpectRollback()
+
+	_, _, _, err := service.UpsertIfNewer(context.Background(), "u1", []models.Secret{{ID: "s1", Data: "x", Version: 1}})
+	if err == nil {
+		t.Fatal("UpsertIfNewer succeeded; want error")
+	}
+	if len(blobs) != 0 {
+		t.Errorf("blobs = %v; want none left behind", blobs)
+	}
+}
+
+func TestDeleteSecrets_RemovesBlobs(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+	blobs := memBlobs{"bob/id1/3": []byte("payload")}
+	service.Blobs = blobs
+
+	ids := []string{"id1", "id2"}
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT data FROM secrets`)).
+		WithArgs("bob", pq.Array(ids), 4, []byte("\x00GK\x02")).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow([]byte("\x00GK\x02bob/id1/3")))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE secrets SET deleted = true`)).
+		WithArgs("bob", pq.Array(ids)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	if err := service.DeleteSecrets(context.Background(), "bob", ids); err != nil {
+		t.Fatalf("DeleteSecrets returned error: %v", err)
+	}
+	if len(blobs) != 0 {
+		t.Errorf("blobs = %v; want the blob of id1 removed", blobs)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/lib/pq"
+)
+
+// BulkUpsert stores a batch of secrets like UpsertIfNewer, but with one
+// query for the stored versions of the whole batch and one multi-row
+// insert instead of two statements per secret, so that imports of
+// thousands of secrets take a few round trips per batch. Secrets are
+// stored only if newer than the stored version, tombstones included;
+// conflicts are not reported. Of several secrets with the same ID in the
+// batch, the newest is stored.
+//
+// Returns the IDs of the secrets stored and of those skipped.
+func (s *PostgresSyncRepository) BulkUpsert(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, error) {
+	if len(secrets) == 0 {
+		return nil, nil, nil
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	q := traced(tx, s.Hook)
+
+	// The newest secret of each ID in the batch, in the order of the batch
+	newest := make(map[string]int, len(secrets))
+	var batch []models.Secret
+	var skipped []string
+	for _, sec := range secrets {
+		i, seen := newest[sec.ID]
+		switch {
+		case !seen:
+			newest[sec.ID] = len(batch)
+			batch = append(batch, sec)
+		case sec.Version > batch[i].Version:
+			skipped = append(skipped, sec.ID)
+			batch[i] = sec
+		default:
+			skipped = append(skipped, sec.ID)
+		}
+	}
+
+	ids := make([]string, len(batch))
+	for i, sec := range batch {
+		ids[i] = sec.ID
+	}
+	type storedRow struct {
+		version int64
+		deleted bool
+		ref     []byte // data column, if it references a blob
+	}
+	existing := make(map[string]storedRow, len(batch))
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, version, deleted, CASE WHEN substring(data from 1 for $3) = $4 THEN data END
+		FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND id = ANY($2)
+	`, userID, pq.Array(ids), len(payloadMagic)+1, []byte(payloadMagic+string(codecBlob)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("check versions: %w", err)
+	}
+	for rows.Next() {
+		var (
+			id  string
+			row storedRow
+		)
+		if err := rows.Scan(&id, &row.version, &row.deleted, &row.ref); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("scan: %w", err)
+		}
+		existing[id] = row
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("check versions: %w", err)
+	}
+
+	// Blobs stored for the new versions by key, removed again unless
+	// their row is stored, and blobs of the versions they replace by ID
+	storedBlobs := make(map[string]string)
+	replaced := make(map[string]string)
+	var stored []string
+	defer func() {
+		var orphans []string
+		for id, key := range storedBlobs {
+			if !slices.Contains(stored, id) {
+				orphans = append(orphans, key)
+			}
+		}
+		s.deleteBlobs(ctx, orphans)
+	}()
+
+	now := s.clock().Now().Unix()
+	var (
+		values  []string
+		args    = []any{userID}
+		written []string // IDs of the rows inserted
+	)
+	for _, sec := range batch {
+		row, ok := existing[sec.ID]
+		if ok && row.version >= sec.Version {
+			skipped = append(skipped, sec.ID)
+			continue
+		}
+		if key, isBlob := blobRef(row.ref); isBlob && s.Blobs != nil && !row.deleted {
+			replaced[sec.ID] = key
+		}
+
+		data, key, err := s.storeData(ctx, userID, sec.ID, sec.Version, sec.Data)
+		if err != nil {
+			return nil, nil, err
+		}
+		if key != "" {
+			storedBlobs[sec.ID] = key
+		}
+		meta, err := s.sealMeta(userID, sec)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		n := len(args)
+		values = append(values, fmt.Sprintf(
+			"($%d, (SELECT id FROM users WHERE login = $1), $%d, $%d, $%d, $%d, $%d, $%d, false, $%d, $%d, $%d, $%d)",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11))
+		written = append(written, sec.ID)
+		args = append(args, sec.ID, sec.Type, data, meta.Comment, meta.Folder, pq.Array(nonNil(meta.Tags)), sec.Version, sec.Reprompt, now, sec.ExpiresAt, sec.Name)
+	}
+	if len(values) == 0 {
+		return nil, skipped, nil
+	}
+
+	// A version stored concurrently since the check is kept if newer
+	rows, err = q.QueryContext(ctx, `
+		INSERT INTO secrets (id, user_id, type, data, comment, folder, tags, version, deleted, reprompt, modified_at, expires_at, name)
+		VALUES `+strings.Join(values, ", ")+`
+		ON CONFLICT (user_id, id) DO UPDATE SET
+			type = EXCLUDED.type,
+			data = EXCLUDED.data,
+			comment = EXCLUDED.comment,
+			folder = EXCLUDED.folder,
+			tags = EXCLUDED.tags,
+			version = EXCLUDED.version,
+			deleted = false,
+			reprompt = EXCLUDED.reprompt,
+			modified_at = EXCLUDED.modified_at,
+			expires_at = EXCLUDED.expires_at,
+			name = EXCLUDED.name
+		WHERE secrets.version < EXCLUDED.version
+		RETURNING id
+	`, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("upsert: %w", err)
+	}
+	var returned []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("scan: %w", err)
+		}
+		returned = append(returned, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("upsert: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("commit: %w", err)
+	}
+	stored = returned
+	var released []string
+	for _, id := range written {
+		if !slices.Contains(stored, id) {
+			skipped = append(skipped, id)
+		} else if key, ok := replaced[id]; ok {
+			released = append(released, key)
+		}
+	}
+	if s.Blobs != nil {
+		s.deleteBlobs(ctx, released)
+	}
+	return stored, skipped, nil
+}
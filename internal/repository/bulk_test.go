@@ -0,0 +1,79 @@
+package repository_test
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/atinyakov/GophKeeper/internal/clock"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/lib/pq"
+)
+
+func TestBulkUpsert(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+	service.Clock = clock.NewFake(time.Unix(1700000000, 0))
+
+	secrets := []models.Secret{
+		{ID: "a", Type: "text", Data: "old a", Version: 1},
+		{ID: "b", Type: "text", Data: "b", Version: 2},
+		{ID: "a", Type: "text", Data: "new a", Name: "n", Version: 3},
+		{ID: "c", Type: "text", Data: "c", Version: 4},
+		{ID: "d", Type: "text", Data: "d", Version: 5},
+	}
+
+	mock.ExpectBegin()
+	// b is stored at a newer version; d was stored by another sync since
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, version, deleted, CASE WHEN`)+".*"+regexp.QuoteMeta(`AND id = ANY($2)`)).
+		WithArgs("alice", pq.Array([]string{"a", "b", "c", "d"}), 4, []byte("\x00GK\x02")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version", "deleted", "data"}).
+			AddRow("b", int64(7), false, nil))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO secrets (id, user_id, type, data, comment, folder, tags, version, deleted, reprompt, modified_at, expires_at, name)
+		VALUES ($2, (SELECT id FROM users WHERE login = $1), $3, $4, $5, $6, $7, $8, false, $9, $10, $11, $12), ($13, (SELECT id FROM users WHERE login = $1), $14,`)+
+		".*"+regexp.QuoteMeta(`WHERE secrets.version < EXCLUDED.version
+		RETURNING id`)).
+		WithArgs("alice",
+			"a", "text", []byte("new a"), "", "", pq.Array([]string{}), int64(3), false, int64(1700000000), int64(0), "n",
+			"c", "text", []byte("c"), "", "", pq.Array([]string{}), int64(4), false, int64(1700000000), int64(0), "",
+			"d", "text", []byte("d"), "", "", pq.Array([]string{}), int64(5), false, int64(1700000000), int64(0), "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("a").AddRow("c"))
+	mock.ExpectCommit()
+
+	stored, skipped, err := service.BulkUpsert(context.Background(), "alice", secrets)
+	if err != nil {
+		t.Fatalf("BulkUpsert returned error: %v", err)
+	}
+	if !slices.Equal(stored, []string{"a", "c"}) {
+		t.Errorf("stored = %v; want [a c]", stored)
+	}
+	slices.Sort(skipped)
+	if !slices.Equal(skipped, []string{"a", "b", "d"}) {
+		t.Errorf("skipped = %v; want the older a, b and d", skipped)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestBulkUpsert_NothingNewer(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, version, deleted, CASE WHEN`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version", "deleted", "data"}).
+			AddRow("a", int64(5), true, nil))
+	mock.ExpectRollback()
+
+	stored, skipped, err := service.BulkUpsert(context.Background(), "alice", []models.Secret{{ID: "a", Type: "text", Data: "x", Version: 5}})
+	if err != nil || len(stored) != 0 || !slices.Equal(skipped, []string{"a"}) {
+		t.Errorf("BulkUpsert = %v, %v, %v; want a skipped against its tombstone", stored, skipped, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
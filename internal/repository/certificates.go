@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// SaveCertificate records a certificate issued to a user.
+func (s *PostgresAuthRepository) SaveCertificate(ctx context.Context, c models.Certificate) error {
+	_, err := s.DB.ExecContext(
+		ctx,
+		`INSERT INTO certificates (serial, user_id, fingerprint, issued_at) VALUES ($1, (SELECT id FROM users WHERE login = $2), $3, $4)`,
+		c.Serial, c.Login, c.Fingerprint, c.IssuedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert certificate: %w", err)
+	}
+	return nil
+}
+
+// GetCertificate returns the certificate with the given serial number, or
+// nil if it is unknown.
+func (s *PostgresAuthRepository) GetCertificate(ctx context.Context, serial string) (*models.Certificate, error) {
+	c := models.Certificate{Serial: serial}
+	err := s.DB.QueryRowContext(
+		ctx,
+		`SELECT u.login, c.fingerprint, c.issued_at, c.revoked_at FROM certificates c JOIN users u ON u.id = c.user_id WHERE c.serial = $1`,
+		serial,
+	).Scan(&c.Login, &c.Fingerprint, &c.IssuedAt, &c.RevokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select certificate: %w", err)
+	}
+	return &c, nil
+}
+
+// GetCertificates returns the certificates of the user, oldest first.
+func (s *PostgresAuthRepository) GetCertificates(ctx context.Context, login string) ([]models.Certificate, error) {
+	rows, err := s.DB.QueryContext(
+		ctx,
+		`SELECT serial, fingerprint, issued_at, revoked_at FROM certificates WHERE user_id = (SELECT id FROM users WHERE login = $1) ORDER BY issued_at, serial`,
+		login,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select certificates: %w", err)
+	}
+	defer rows.Close()
+
+	var certs []models.Certificate
+	for rows.Next() {
+		c := models.Certificate{Login: login}
+		if err := rows.Scan(&c.Serial, &c.Fingerprint, &c.IssuedAt, &c.RevokedAt); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		certs = append(certs, c)
+	}
+	return certs, rows.Err()
+}
+
+// RevokeCertificates revokes the active certificates of the user at the
+// given Unix time; if serial is not empty, only that one.
+func (s *PostgresAuthRepository) RevokeCertificates(ctx context.Context, login, serial string, at int64) (int64, error) {
+	res, err := s.DB.ExecContext(
+		ctx,
+		`UPDATE certificates SET revoked_at = $3 WHERE user_id = (SELECT id FROM users WHERE login = $1) AND ($2 = '' OR serial = $2) AND revoked_at = 0`,
+		login, serial, at,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("revoke certificates: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+func TestGetCertificate(t *testing.T) {
+	repo, mock, cleanup := setupAuthMock(t)
+	defer cleanup()
+	query := regexp.QuoteMeta(`SELECT u.login, c.fingerprint, c.issued_at, c.revoked_at FROM certificates c JOIN users u ON u.id = c.user_id WHERE c.serial = $1`)
+
+	mock.ExpectQuery(query).WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows([]string{"user_login", "fingerprint", "issued_at", "revoked_at"}).AddRow("alice", "ff", int64(10), int64(0)))
+	mock.ExpectQuery(query).WithArgs("def").
+		WillReturnRows(sqlmock.NewRows([]string{"user_login", "fingerprint", "issued_at", "revoked_at"}))
+
+	c, err := repo.GetCertificate(context.Background(), "abc")
+	want := models.Certificate{Serial: "abc", Login: "alice", Fingerprint: "ff", IssuedAt: 10}
+	if err != nil || c == nil || *c != want {
+		t.Errorf("GetCertificate = %+v, %v; want %+v", c, err, want)
+	}
+	if c, err := repo.GetCertificate(context.Background(), "def"); c != nil || err != nil {
+		t.Errorf("GetCertificate of unknown serial = %+v, %v; want nil", c, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRevokeCertificates(t *testing.T) {
+	repo, mock, cleanup := setupAuthMock(t)
+	defer cleanup()
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE certificates SET revoked_at = $3 WHERE user_id = (SELECT id FROM users WHERE login = $1) AND ($2 = '' OR serial = $2) AND revoked_at = 0`)).
+		WithArgs("alice", "", int64(20)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	n, err := repo.RevokeCertificates(context.Background(), "alice", "", 20)
+	if err != nil || n != 2 {
+		t.Errorf("RevokeCertificates = %d, %v; want 2", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRevokeAccess(t *testing.T) {
+	repo, mock, cleanup := setupAuthMock(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM api_tokens WHERE user_id = (SELECT id FROM users WHERE login = $1)`)).
+		WithArgs("alice").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM sessions WHERE user_id = (SELECT id FROM users WHERE login = $1)`)).
+		WithArgs("alice").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	n, err := repo.RevokeAccess(context.Background(), "alice")
+	if err != nil || n != 3 {
+		t.Errorf("RevokeAccess = %d, %v; want 3", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
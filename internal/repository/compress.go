@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Stored secret payloads are compressed transparently: clients send and
+// receive the same data, while the data column holds
+//
+//	payloadMagic || codec || payload
+//
+// for payloads written since compression was introduced. Rows without the
+// magic prefix predate it and are stored as is. Payloads are base64 of
+// ciphertext, which has no repetitions to find: zstd at its fastest level
+// shrinks it by a quarter by entropy coding the literals, which it skips
+// for short inputs unless told otherwise. Rows
+// compressed with DEFLATE by earlier versions stay readable.
+const (
+	// payloadMagic starts every packed payload. Base64 never contains a
+	// NUL byte, so legacy rows are not mistaken for packed ones.
+	payloadMagic = "\x00GK"
+
+	codecRaw     byte = 0 // payload stored uncompressed
+	codecDeflate byte = 1 // payload compressed with DEFLATE, no longer written
+	codecBlob    byte = 2 // payload in the blob store, see blobs.go
+	codecZstd    byte = 3 // payload compressed with zstd
+
+	// minCompressSize is the payload size below which compression is not
+	// worth the CPU time.
+	minCompressSize = 512
+)
+
+// errUnknownCodec is returned for payloads packed with an unknown codec,
+// e.g. by a newer server version.
+var errUnknownCodec = errors.New("unknown payload codec")
+
+// zstdEncoder and zstdDecoder compress and decompress whole payloads; both
+// are safe for concurrent use.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil,
+		zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithAllLitEntropyCompression(true), zstd.WithEncoderConcurrency(1))
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+)
+
+// packData encodes a secret payload for the data column, compressing it
+// when that makes it smaller.
+func packData(data string) []byte {
+	if len(data) >= minCompressSize {
+		packed := zstdEncoder.EncodeAll([]byte(data), []byte(payloadMagic+string(codecZstd)))
+		if len(packed) < len(data) {
+			return packed
+		}
+	}
+	// Legacy format, unless the payload could be taken for a packed one
+	if len(data) < len(payloadMagic) || data[:len(payloadMagic)] != payloadMagic {
+		return []byte(data)
+	}
+	return append([]byte(payloadMagic+string(codecRaw)), data...)
+}
+
+// unpackData decodes a payload read from the data column.
+func unpackData(b []byte) (string, error) {
+	if !bytes.HasPrefix(b, []byte(payloadMagic)) {
+		return string(b), nil
+	}
+	b = b[len(payloadMagic):]
+	if len(b) == 0 {
+		return "", fmt.Errorf("unpack payload: %w", io.ErrUnexpectedEOF)
+	}
+	switch codec, payload := b[0], b[1:]; codec {
+	case codecRaw:
+		return string(payload), nil
+	case codecZstd:
+		data, err := zstdDecoder.DecodeAll(payload, nil)
+		if err != nil {
+			return "", fmt.Errorf("unpack payload: %w", err)
+		}
+		return string(data), nil
+	case codecDeflate:
+		r := flate.NewReader(bytes.NewReader(payload))
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return "", fmt.Errorf("unpack payload: %w", err)
+		}
+		return string(data), nil
+	default:
+		return "", fmt.Errorf("unpack payload: %w %d", errUnknownCodec, codec)
+	}
+}
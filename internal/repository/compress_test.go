@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPackData(t *testing.T) {
+	random := make([]byte, 4096)
+	_, _ = rand.Read(random)
+	large := base64.StdEncoding.EncodeToString(random)
+
+	tests := []struct {
+		name       string
+		data       string
+		compressed bool
+	}{
+		{"empty", "", false},
+		{"small", "c2VjcmV0", false},
+		{"large base64", large, true},
+		{"looks packed", payloadMagic + "\x03not zstd", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packed := packData(tt.data)
+			if compressed := len(packed) < len(tt.data); compressed != tt.compressed {
+				t.Errorf("packed %d bytes to %d; compressed = %v, want %v", len(tt.data), len(packed), compressed, tt.compressed)
+			}
+			got, err := unpackData(packed)
+			if err != nil {
+				t.Fatalf("unpackData returned error: %v", err)
+			}
+			if got != tt.data {
+				t.Errorf("round trip changed the payload")
+			}
+		})
+	}
+}
+
+func TestUnpackData(t *testing.T) {
+	// Rows written before compression are returned as is
+	if got, err := unpackData([]byte("bGVnYWN5")); err != nil || got != "bGVnYWN5" {
+		t.Errorf("unpackData(legacy) = %q, %v", got, err)
+	}
+
+	// Rows compressed with DEFLATE by earlier versions stay readable
+	var deflated bytes.Buffer
+	deflated.WriteString(payloadMagic)
+	deflated.WriteByte(codecDeflate)
+	w, _ := flate.NewWriter(&deflated, flate.HuffmanOnly)
+	_, _ = io.WriteString(w, strings.Repeat("a", 1024))
+	_ = w.Close()
+	if got, err := unpackData(deflated.Bytes()); err != nil || got != strings.Repeat("a", 1024) {
+		t.Errorf("unpackData(deflate) = %d bytes, %v; want the payload", len(got), err)
+	}
+
+	if _, err := unpackData([]byte(payloadMagic + "\x07data")); !errors.Is(err, errUnknownCodec) {
+		t.Errorf("unknown codec: got %v; want %v", err, errUnknownCodec)
+	}
+	corrupt := packData(strings.Repeat("a", 1024))
+	corrupt = bytes.Clone(corrupt[:len(corrupt)/2])
+	if _, err := unpackData(corrupt); err == nil {
+		t.Error("truncated payload unpacked without error")
+	}
+}
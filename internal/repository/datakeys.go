@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/atinyakov/GophKeeper/internal/envelope"
+)
+
+// PostgresDataKeyRepository stores the wrapped data keys of envelope
+// encryption in PostgreSQL; it implements envelope.KeyStore.
+type PostgresDataKeyRepository struct {
+	// DB is the database handle for executing queries.
+	DB *sql.DB
+	// Hook observes the queries of the repository; optional.
+	Hook QueryHook
+}
+
+// NewPostgresDataKeyRepository creates a new PostgresDataKeyRepository with the given database connection.
+func NewPostgresDataKeyRepository(db *sql.DB) *PostgresDataKeyRepository {
+	return &PostgresDataKeyRepository{DB: db}
+}
+
+// db returns the database handle of the repository, observed by Hook.
+func (s *PostgresDataKeyRepository) db() querier {
+	return traced(s.DB, s.Hook)
+}
+
+// ListDataKeys returns all data keys, oldest first.
+func (s *PostgresDataKeyRepository) ListDataKeys(ctx context.Context) ([]envelope.DataKey, error) {
+	rows, err := s.db().QueryContext(ctx, `SELECT id, wrapped, kek, created_at FROM data_keys ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("select data keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []envelope.DataKey
+	for rows.Next() {
+		var k envelope.DataKey
+		if err := rows.Scan(&k.ID, &k.Wrapped, &k.KEK, &k.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// InsertDataKey stores a new data key.
+func (s *PostgresDataKeyRepository) InsertDataKey(ctx context.Context, k envelope.DataKey) error {
+	_, err := s.db().ExecContext(ctx,
+		`INSERT INTO data_keys (id, wrapped, kek, created_at) VALUES ($1, $2, $3, $4)`,
+		k.ID, k.Wrapped, k.KEK, k.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert data key: %w", err)
+	}
+	return nil
+}
+
+// UpdateDataKey replaces the wrapped form of a data key after rewrapping.
+func (s *PostgresDataKeyRepository) UpdateDataKey(ctx context.Context, k envelope.DataKey) error {
+	_, err := s.db().ExecContext(ctx,
+		`UPDATE data_keys SET wrapped = $2, kek = $3 WHERE id = $1`,
+		k.ID, k.Wrapped, k.KEK,
+	)
+	if err != nil {
+		return fmt.Errorf("update data key: %w", err)
+	}
+	return nil
+}
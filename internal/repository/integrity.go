@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/clock"
+	"github.com/atinyakov/GophKeeper/internal/limits"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"go.uber.org/zap"
+)
+
+// AuditIntegrityAnomaly is the audit action recording an anomaly found by
+// the IntegrityScanner.
+const AuditIntegrityAnomaly = "integrity-anomaly"
+
+// Kinds of anomalies found by the IntegrityScanner.
+const (
+	// AnomalyOwner is a secret of a user that does not exist.
+	AnomalyOwner = "owner"
+	// AnomalyPayload is a payload that cannot be unpacked, is not base64,
+	// or references the blob of another version.
+	AnomalyPayload = "payload"
+	// AnomalySize is a payload larger than the limit of its type.
+	AnomalySize = "size"
+	// AnomalyVersion is a version that is not positive or was further
+	// ahead of the server clock when stored than limits.MaxVersionSkew.
+	AnomalyVersion = "version"
+)
+
+// integrityBatch is the number of secrets an IntegrityScanner reads per
+// query.
+const integrityBatch = 500
+
+// Anomaly is a stored secret violating an invariant.
+type Anomaly struct {
+	// Login is the owner of the secret, or its user ID if the owner does
+	// not exist.
+	Login string `json:"login"`
+	// ID is the secret.
+	ID string `json:"id"`
+	// Kind is one of the Anomaly kinds, e.g. AnomalyPayload.
+	Kind string `json:"kind"`
+	// Detail describes the violation.
+	Detail string `json:"detail"`
+}
+
+// IntegrityRun reports one run of an IntegrityScanner.
+type IntegrityRun struct {
+	// Started is when the run started.
+	Started time.Time `json:"started"`
+	// Duration is how long the run took.
+	Duration time.Duration `json:"duration_ns"`
+	// Scanned is the number of secrets checked.
+	Scanned int64 `json:"scanned"`
+	// Anomalies counts the anomalies found by kind.
+	Anomalies map[string]int64 `json:"anomalies"`
+	// New is the number of anomalies not found by the previous run.
+	New int64 `json:"new"`
+	// Error describes why the run failed, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// IntegrityStats summarizes the runs of an IntegrityScanner since it was
+// created.
+type IntegrityStats struct {
+	// Runs is the number of runs, including failed ones.
+	Runs int64 `json:"runs"`
+	// Failures is the number of failed runs.
+	Failures int64 `json:"failures"`
+	// Last is the most recent run, nil before the first one.
+	Last *IntegrityRun `json:"last,omitempty"`
+}
+
+// AuditRecorder appends events to the audit trail.
+type AuditRecorder interface {
+	// RecordEvent appends an event to the audit trail.
+	RecordEvent(ctx context.Context, e models.AuditEvent) error
+}
+
+// IntegrityScanner checks that the stored secrets satisfy the invariants
+// the server relies on, as an early warning of corruption or misbehaving
+// clients: the owner exists, the payload unpacks to base64 within the size
+// limit of the secret type, and the version is sane. Tombstones are only
+// checked for their owner. Payloads moved to object storage are not
+// fetched; their reference must name the stored ID and version.
+//
+// Anomalies are logged and counted in the run; those not found by the
+// previous run are also recorded in the audit trail of the owner, so that
+// a persisting anomaly is recorded once per server start. Runs are
+// serialized; it is safe for concurrent use.
+type IntegrityScanner struct {
+	// Repo is the repository of the secrets.
+	Repo *PostgresSyncRepository
+	// Audit receives an event per new anomaly; optional.
+	Audit AuditRecorder
+	// Log receives a line per anomaly and per failed run.
+	Log *zap.Logger
+	// Clock schedules the runs and tells their time; clock.Real when nil.
+	Clock clock.Clock
+
+	run   sync.Mutex       // held during a run
+	known map[Anomaly]bool // anomalies found by the previous run, guarded by run
+	mu    sync.Mutex       // guards stats
+	stats IntegrityStats
+}
+
+// NewIntegrityScanner constructs an IntegrityScanner of the secrets in repo.
+func NewIntegrityScanner(repo *PostgresSyncRepository, audit AuditRecorder, log *zap.Logger) *IntegrityScanner {
+	return &IntegrityScanner{Repo: repo, Audit: audit, Log: log}
+}
+
+// Start runs the scanner every interval until ctx is done. The first run
+// is delayed by a random fraction of the interval, so that server
+// instances started together do not scan at the same time.
+func (c *IntegrityScanner) Start(ctx context.Context, interval time.Duration) {
+	clk := c.clock()
+	go func() {
+		jitter := clk.NewTimer(rand.N(interval))
+		defer jitter.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-jitter.C():
+		}
+
+		ticker := clk.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			_, _ = c.Run(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	}()
+}
+
+// clock returns the Clock of the scanner.
+func (c *IntegrityScanner) clock() clock.Clock {
+	return cmp.Or(c.Clock, clock.Real)
+}
+
+// Run checks every stored secret. A run started while another is in
+// progress waits for it.
+func (c *IntegrityScanner) Run(ctx context.Context) (IntegrityRun, error) {
+	c.run.Lock()
+	defer c.run.Unlock()
+
+	run := IntegrityRun{Started: c.clock().Now(), Anomalies: make(map[string]int64)}
+	found := make(map[Anomaly]bool)
+	err := c.scan(ctx, &run, func(a Anomaly) {
+		run.Anomalies[a.Kind]++
+		found[a] = true
+		if c.known[a] {
+			return
+		}
+		run.New++
+		c.Log.Warn("integrity anomaly", zap.String("login", a.Login), zap.String("id", a.ID),
+			zap.String("kind", a.Kind), zap.String("detail", a.Detail))
+		if c.Audit != nil {
+			_ = c.Audit.RecordEvent(ctx, models.AuditEvent{
+				Time:   run.Started.Unix(),
+				Login:  a.Login,
+				Action: AuditIntegrityAnomaly,
+				Detail: fmt.Sprintf("secret %s: %s: %s", a.ID, a.Kind, a.Detail),
+			})
+		}
+	})
+	run.Duration = c.clock().Since(run.Started)
+	if err != nil {
+		run.Error = err.Error()
+		c.Log.Error("integrity scan failed", zap.Error(err), zap.Int64("scanned", run.Scanned))
+	} else {
+		// A partial scan says nothing about the anomalies it did not reach
+		c.known = found
+	}
+
+	c.mu.Lock()
+	c.stats.Runs++
+	if err != nil {
+		c.stats.Failures++
+	}
+	last := run
+	c.stats.Last = &last
+	c.mu.Unlock()
+	return run, err
+}
+
+// scan reads the secrets in batches in key order, checking each and
+// reporting its anomalies.
+func (c *IntegrityScanner) scan(ctx context.Context, run *IntegrityRun, report func(Anomaly)) error {
+	// Keyset pagination over the primary key, starting below every UUID
+	afterUser, afterID := "00000000-0000-0000-0000-000000000000", ""
+	for {
+		rows, err := c.Repo.db().QueryContext(ctx, `
+			SELECT s.user_id, s.id, COALESCE(u.login, ''), s.type, s.data, s.version, s.modified_at, s.deleted, u.login IS NOT NULL
+			  FROM secrets s LEFT JOIN users u ON u.id = s.user_id
+			 WHERE (s.user_id, s.id) > ($1, $2)
+			 ORDER BY s.user_id, s.id
+			 LIMIT $3`, afterUser, afterID, integrityBatch)
+		if err != nil {
+			return fmt.Errorf("select secrets: %w", err)
+		}
+		n := 0
+		for rows.Next() {
+			var (
+				login, typ        string
+				raw               []byte
+				version, storedAt int64
+				deleted, owned    bool
+			)
+			if err := rows.Scan(&afterUser, &afterID, &login, &typ, &raw, &version, &storedAt, &deleted, &owned); err != nil {
+				rows.Close()
+				return fmt.Errorf("scan: %w", err)
+			}
+			if !owned {
+				login = afterUser
+			}
+			n++
+			run.Scanned++
+			for _, a := range checkSecret(afterID, login, typ, raw, version, storedAt, deleted, owned) {
+				report(a)
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		if n < integrityBatch {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// checkSecret returns the anomalies of a stored secret. storedAt is the
+// Unix time it was last written, 0 for rows predating its recording.
+func checkSecret(id, login, typ string, raw []byte, version, storedAt int64, deleted, owned bool) []Anomaly {
+	var found []Anomaly
+	add := func(kind, format string, args ...any) {
+		found = append(found, Anomaly{Login: login, ID: id, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	if !owned {
+		add(AnomalyOwner, "user %s does not exist", login)
+	}
+	if deleted {
+		return found
+	}
+
+	if version <= 0 {
+		add(AnomalyVersion, "version %d is not positive", version)
+	} else if storedAt > 0 {
+		if err := limits.CheckVersion(id, version, time.Unix(storedAt, 0)); err != nil {
+			add(AnomalyVersion, "version %d was %s ahead of the server clock when stored",
+				version, time.Unix(version, 0).Sub(time.Unix(storedAt, 0)))
+		}
+	}
+
+	if key, ok := blobRef(raw); ok {
+		// The key starts with the login of the owner when the blob was
+		// stored, which may have been renamed since
+		if !strings.HasSuffix(key, blobKey("", id, version)) {
+			add(AnomalyPayload, "references blob %s instead of one of version %d", key, version)
+		}
+		return found
+	}
+	data, err := unpackData(raw)
+	if err != nil {
+		add(AnomalyPayload, "%v", err)
+		return found
+	}
+	if _, err := base64.StdEncoding.DecodeString(data); err != nil {
+		add(AnomalyPayload, "payload is not base64: %v", err)
+	}
+	if err := limits.CheckEncoded("", typ, data); err != nil {
+		add(AnomalySize, "%v", err)
+	}
+	return found
+}
+
+// Stats returns a summary of the runs so far.
+func (c *IntegrityScanner) Stats() IntegrityStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
@@ -0,0 +1,73 @@
+package repository_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	repo "github.com/atinyakov/GophKeeper/internal/repository"
+	"go.uber.org/zap"
+)
+
+// auditEvents is an AuditRecorder collecting the events.
+type auditEvents []models.AuditEvent
+
+func (a *auditEvents) RecordEvent(_ context.Context, e models.AuditEvent) error {
+	*a = append(*a, e)
+	return nil
+}
+
+func TestIntegrityScanner(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	const alice = "6f1c2a9e-3b4d-4e5f-8a6b-7c8d9e0f1a2b"
+	columns := []string{"user_id", "id", "login", "type", "data", "version", "modified_at", "deleted", "owned"}
+	query := regexp.QuoteMeta(`SELECT s.user_id, s.id, COALESCE(u.login, ''), s.type, s.data, s.version, s.modified_at, s.deleted, u.login IS NOT NULL`)
+	expectScan := func() {
+		mock.ExpectQuery(query).
+			WithArgs("00000000-0000-0000-0000-000000000000", "", 500).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(alice, "a", "alice", "text", []byte("ZGF0YQ=="), int64(1700000000), int64(1700000000), false, true).
+				AddRow(alice, "b", "alice", "text", []byte("not base64!"), int64(1700000000), int64(0), false, true).
+				AddRow(alice, "c", "alice", "card", []byte("ZGF0YQ=="), int64(1900000000), int64(1700000000), false, true).
+				AddRow(alice, "e", "alice", "text", []byte("\x00GK\x02alice/e/3"), int64(4), int64(0), false, true).
+				AddRow(alice, "f", "alice", "text", []byte("\x00GK\x09"), int64(4), int64(0), false, true).
+				AddRow("9a8b7c6d-5e4f-4a3b-2c1d-0e9f8a7b6c5d", "d", "", "text", []byte(""), int64(5), int64(0), true, false))
+	}
+	expectScan()
+	expectScan()
+
+	var audit auditEvents
+	scanner := repo.NewIntegrityScanner(service, &audit, zap.NewNop())
+	run, err := scanner.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	want := map[string]int64{repo.AnomalyPayload: 3, repo.AnomalyVersion: 1, repo.AnomalyOwner: 1}
+	if run.Scanned != 6 || run.New != 5 || len(run.Anomalies) != len(want) {
+		t.Errorf("run = %+v; want 6 scanned and anomalies %v", run, want)
+	}
+	for kind, n := range want {
+		if run.Anomalies[kind] != n {
+			t.Errorf("%s anomalies = %d; want %d", kind, run.Anomalies[kind], n)
+		}
+	}
+	if len(audit) != 5 || audit[0].Action != repo.AuditIntegrityAnomaly || audit[0].Login != "alice" {
+		t.Errorf("audit = %+v; want an event per anomaly", audit)
+	}
+
+	// Anomalies persisting are not recorded again
+	run, err = scanner.Run(context.Background())
+	if err != nil || run.New != 0 || len(audit) != 5 {
+		t.Errorf("second run = %+v, %v with %d audit events; want no new anomalies", run, err, len(audit))
+	}
+	if stats := scanner.Stats(); stats.Runs != 2 || stats.Failures != 0 || stats.Last == nil {
+		t.Errorf("stats = %+v", stats)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/lib/pq"
+)
+
+// PostgresNotificationRepository stores notification channels and the
+// notifications already sent in PostgreSQL.
+type PostgresNotificationRepository struct {
+	// DB is the database handle for executing queries.
+	DB *sql.DB
+	// Hook observes the queries of the repository; optional.
+	Hook QueryHook
+}
+
+// NewPostgresNotificationRepository creates a new
+// PostgresNotificationRepository with the given database connection.
+func NewPostgresNotificationRepository(db *sql.DB) *PostgresNotificationRepository {
+	return &PostgresNotificationRepository{DB: db}
+}
+
+// db returns the database handle of the repository, observed by Hook.
+func (s *PostgresNotificationRepository) db() querier {
+	return traced(s.DB, s.Hook)
+}
+
+// GetChannels returns the notification channels of the user, oldest first.
+func (s *PostgresNotificationRepository) GetChannels(ctx context.Context, login string) ([]models.NotificationChannel, error) {
+	rows, err := s.db().QueryContext(ctx,
+		`SELECT id, kind, target, events FROM notification_channels WHERE user_id = (SELECT id FROM users WHERE login = $1) ORDER BY id`,
+		login,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select notification channels: %w", err)
+	}
+	defer rows.Close()
+
+	var channels []models.NotificationChannel
+	for rows.Next() {
+		var c models.NotificationChannel
+		if err := rows.Scan(&c.ID, &c.Kind, &c.Target, pq.Array(&c.Events)); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		channels = append(channels, c)
+	}
+	return channels, rows.Err()
+}
+
+// AddChannel stores a notification channel of the user and returns its ID.
+func (s *PostgresNotificationRepository) AddChannel(ctx context.Context, login string, c models.NotificationChannel) (int64, error) {
+	var id int64
+	err := s.db().QueryRowContext(ctx,
+		`INSERT INTO notification_channels (user_id, kind, target, events) VALUES ((SELECT id FROM users WHERE login = $1), $2, $3, $4) RETURNING id`,
+		login, c.Kind, c.Target, pq.Array(nonNil(c.Events)),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("insert notification channel: %w", err)
+	}
+	return id, nil
+}
+
+// DeleteChannel removes the user's notification channel with the given ID
+// and reports whether it existed.
+func (s *PostgresNotificationRepository) DeleteChannel(ctx context.Context, login string, id int64) (bool, error) {
+	res, err := s.db().ExecContext(ctx,
+		`DELETE FROM notification_channels WHERE user_id = (SELECT id FROM users WHERE login = $1) AND id = $2`,
+		login, id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("delete notification channel: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ExpiringSecrets returns the live secrets expiring before the Unix time
+// before, of users with at least one notification channel.
+func (s *PostgresNotificationRepository) ExpiringSecrets(ctx context.Context, before int64) ([]models.Expiring, error) {
+	return s.expiring(ctx, `
+		SELECT u.login, s.id, s.expires_at FROM secrets s JOIN users u ON u.id = s.user_id
+		 WHERE s.expires_at > 0 AND s.expires_at < $1 AND s.deleted = false
+		   AND EXISTS (SELECT 1 FROM notification_channels c WHERE c.user_id = s.user_id)
+		 ORDER BY s.expires_at`, before)
+}
+
+// ExpiringCertificates returns the active certificates issued before the
+// Unix time issuedBefore, of users with at least one notification channel.
+// Their expiry is issued_at plus validity seconds.
+func (s *PostgresNotificationRepository) ExpiringCertificates(ctx context.Context, issuedBefore, validity int64) ([]models.Expiring, error) {
+	return s.expiring(ctx, `
+		SELECT u.login, t.serial, t.issued_at + $2 FROM certificates t JOIN users u ON u.id = t.user_id
+		 WHERE t.issued_at < $1 AND t.revoked_at = 0
+		   AND EXISTS (SELECT 1 FROM notification_channels c WHERE c.user_id = t.user_id)
+		 ORDER BY t.issued_at`, issuedBefore, validity)
+}
+
+// expiring runs query selecting the login, ID and expiry of things expiring.
+func (s *PostgresNotificationRepository) expiring(ctx context.Context, query string, args ...any) ([]models.Expiring, error) {
+	rows, err := s.db().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select expiring: %w", err)
+	}
+	defer rows.Close()
+
+	var due []models.Expiring
+	for rows.Next() {
+		var e models.Expiring
+		if err := rows.Scan(&e.Login, &e.ID, &e.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		due = append(due, e)
+	}
+	return due, rows.Err()
+}
+
+// MarkSent records that the user was notified of the event with the given
+// key at the Unix time at, and reports false if that was already recorded.
+func (s *PostgresNotificationRepository) MarkSent(ctx context.Context, login, key string, at int64) (bool, error) {
+	res, err := s.db().ExecContext(ctx,
+		`INSERT INTO notifications_sent (user_id, event_key, sent_at) VALUES ((SELECT id FROM users WHERE login = $1), $2, $3) ON CONFLICT DO NOTHING`,
+		login, key, at,
+	)
+	if err != nil {
+		return false, fmt.Errorf("insert sent notification: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// UnmarkSent forgets that the user was notified of the event with the given
+// key, so that a failed delivery is retried.
+func (s *PostgresNotificationRepository) UnmarkSent(ctx context.Context, login, key string) error {
+	_, err := s.db().ExecContext(ctx,
+		`DELETE FROM notifications_sent WHERE user_id = (SELECT id FROM users WHERE login = $1) AND event_key = $2`,
+		login, key,
+	)
+	if err != nil {
+		return fmt.Errorf("delete sent notification: %w", err)
+	}
+	return nil
+}
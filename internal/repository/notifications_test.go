@@ -0,0 +1,90 @@
+package repository_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	repo "github.com/atinyakov/GophKeeper/internal/repository"
+	"github.com/lib/pq"
+)
+
+func setupNotificationMock(t *testing.T) (*repo.PostgresNotificationRepository, sqlmock.Sqlmock, func()) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	return repo.NewPostgresNotificationRepository(db), mock, func() { db.Close() }
+}
+
+func TestNotificationChannels(t *testing.T) {
+	service, mock, cleanup := setupNotificationMock(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`INSERT INTO notification_channels (user_id, kind, target, events) VALUES ((SELECT id FROM users WHERE login = $1), $2, $3, $4) RETURNING id`,
+	)).
+		WithArgs("alice", "ntfy", "https://ntfy.sh/alice", pq.Array([]string{})).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(7)))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, kind, target, events FROM notification_channels WHERE user_id = (SELECT id FROM users WHERE login = $1) ORDER BY id`)).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "target", "events"}).
+			AddRow(int64(7), "ntfy", "https://ntfy.sh/alice", "{new-device,secret-expiry}"))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM notification_channels WHERE user_id = (SELECT id FROM users WHERE login = $1) AND id = $2`)).
+		WithArgs("alice", int64(8)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	id, err := service.AddChannel(ctx, "alice", models.NotificationChannel{Kind: "ntfy", Target: "https://ntfy.sh/alice"})
+	if err != nil || id != 7 {
+		t.Fatalf("AddChannel = %d, %v; want 7", id, err)
+	}
+	channels, err := service.GetChannels(ctx, "alice")
+	if err != nil {
+		t.Fatalf("GetChannels returned error: %v", err)
+	}
+	if len(channels) != 1 || len(channels[0].Events) != 2 || channels[0].Events[1] != "secret-expiry" {
+		t.Errorf("channels = %+v", channels)
+	}
+	if ok, err := service.DeleteChannel(ctx, "alice", 8); err != nil || ok {
+		t.Errorf("DeleteChannel(unknown) = %v, %v; want false", ok, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestExpiringAndMarkSent(t *testing.T) {
+	service, mock, cleanup := setupNotificationMock(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	mock.ExpectQuery(`SELECT u.login, s.id, s.expires_at FROM secrets s JOIN users u ON u.id = s.user_id`).
+		WithArgs(int64(1000)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_login", "id", "expires_at"}).AddRow("alice", "s1", int64(900)))
+	mock.ExpectQuery(`SELECT u.login, t.serial, t.issued_at \+ \$2 FROM certificates t JOIN users u ON u.id = t.user_id`).
+		WithArgs(int64(500), int64(100)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_login", "serial", "expires_at"}).AddRow("bob", "c1", int64(550)))
+	mock.ExpectExec(regexp.QuoteMeta(
+		`INSERT INTO notifications_sent (user_id, event_key, sent_at) VALUES ((SELECT id FROM users WHERE login = $1), $2, $3) ON CONFLICT DO NOTHING`,
+	)).
+		WithArgs("alice", "secret-expiry:s1:900", int64(10)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	secrets, err := service.ExpiringSecrets(ctx, 1000)
+	if err != nil || len(secrets) != 1 || secrets[0] != (models.Expiring{Login: "alice", ID: "s1", ExpiresAt: 900}) {
+		t.Errorf("ExpiringSecrets = %+v, %v", secrets, err)
+	}
+	certs, err := service.ExpiringCertificates(ctx, 500, 100)
+	if err != nil || len(certs) != 1 || certs[0].ExpiresAt != 550 {
+		t.Errorf("ExpiringCertificates = %+v, %v", certs, err)
+	}
+	if ok, err := service.MarkSent(ctx, "alice", "secret-expiry:s1:900", 10); err != nil || ok {
+		t.Errorf("MarkSent of a sent notification = %v, %v; want false", ok, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/lib/pq"
+)
+
+// AuditRename is the audit action recording a login rename.
+const AuditRename = "rename"
+
+// RenameUser changes the login of a user from from to to within one
+// transaction. Other tables reference users by ID and follow, the audit
+// trail is moved to the new login and gains a rename event, and metadata
+// sealed for the old login is sealed again for the new one. The
+// certificates of the user name the old login and no longer authenticate
+// it; if cert is not nil, they are revoked at cert.IssuedAt and cert,
+// issued for the new login, is recorded in their place. It returns the
+// number of certificates revoked, those of all devices of the user.
+//
+// It returns models.ErrUserNotFound if from does not exist and
+// models.ErrLoginTaken if to does, in any case.
+func (s *PostgresSyncRepository) RenameUser(ctx context.Context, from, to string, cert *models.Certificate) (int64, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	q := traced(tx, s.Hook)
+
+	res, err := q.ExecContext(ctx, `UPDATE users SET login = $2 WHERE login = $1`, from, to)
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return 0, fmt.Errorf("%w: %s", models.ErrLoginTaken, to)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("rename user: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return 0, fmt.Errorf("rows affected: %w", err)
+	} else if n == 0 {
+		return 0, fmt.Errorf("%w: %s", models.ErrUserNotFound, from)
+	}
+
+	if err := s.resealMeta(ctx, q, from, to); err != nil {
+		return 0, err
+	}
+
+	var revoked int64
+	if cert != nil {
+		res, err := q.ExecContext(ctx,
+			`UPDATE certificates SET revoked_at = $2 WHERE user_id = (SELECT id FROM users WHERE login = $1) AND revoked_at = 0`,
+			to, cert.IssuedAt,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("revoke certificates: %w", err)
+		}
+		if revoked, err = res.RowsAffected(); err != nil {
+			return 0, fmt.Errorf("rows affected: %w", err)
+		}
+		if _, err := q.ExecContext(ctx,
+			`INSERT INTO certificates (serial, user_id, fingerprint, issued_at) VALUES ($1, (SELECT id FROM users WHERE login = $2), $3, $4)`,
+			cert.Serial, to, cert.Fingerprint, cert.IssuedAt,
+		); err != nil {
+			return 0, fmt.Errorf("insert certificate: %w", err)
+		}
+	}
+
+	if _, err := q.ExecContext(ctx, `UPDATE audit_log SET user_login = $2 WHERE user_login = $1`, from, to); err != nil {
+		return 0, fmt.Errorf("rename audit trail: %w", err)
+	}
+	if _, err := q.ExecContext(ctx,
+		`INSERT INTO audit_log (created_at, user_login, ip, action, detail) VALUES ($1, $2, '', $3, $4)`,
+		s.clock().Now().Unix(), to, AuditRename, "renamed from "+from,
+	); err != nil {
+		return 0, fmt.Errorf("record rename: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return revoked, nil
+}
+
+// resealMeta seals the metadata of the secrets of the user renamed from
+// from to to again, as sealed values are bound to the login.
+func (s *PostgresSyncRepository) resealMeta(ctx context.Context, q querier, from, to string) error {
+	if s.Sealer == nil {
+		return nil
+	}
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, COALESCE(comment, ''), folder, tags FROM secrets
+		WHERE user_id = (SELECT id FROM users WHERE login = $1)
+		FOR UPDATE
+	`, to)
+	if err != nil {
+		return fmt.Errorf("select metadata: %w", err)
+	}
+	var secrets []models.Secret
+	for rows.Next() {
+		var sec models.Secret
+		if err := rows.Scan(&sec.ID, &sec.Comment, &sec.Folder, pq.Array(&sec.Tags)); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan: %w", err)
+		}
+		secrets = append(secrets, sec)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, sec := range secrets {
+		if err := s.openMeta(from, &sec); err != nil {
+			return err
+		}
+		if sec, err = s.sealMeta(to, sec); err != nil {
+			return err
+		}
+		if _, err := q.ExecContext(ctx, `
+			UPDATE secrets SET comment = $3, folder = $4, tags = $5
+			WHERE user_id = (SELECT id FROM users WHERE login = $1) AND id = $2
+		`, to, sec.ID, sec.Comment, sec.Folder, pq.Array(nonNil(sec.Tags))); err != nil {
+			return fmt.Errorf("update metadata: %w", err)
+		}
+	}
+	return nil
+}
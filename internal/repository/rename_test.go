@@ -0,0 +1,107 @@
+package repository_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/atinyakov/GophKeeper/internal/envelope"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	repo "github.com/atinyakov/GophKeeper/internal/repository"
+	"github.com/lib/pq"
+)
+
+func TestRenameUser(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+	ctx := context.Background()
+	rename := regexp.QuoteMeta(`UPDATE users SET login = $2 WHERE login = $1`)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(rename).WithArgs("dave", "erin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	if _, err := service.RenameUser(ctx, "dave", "erin", nil); !errors.Is(err, models.ErrUserNotFound) {
+		t.Errorf("renaming an unknown user = %v; want ErrUserNotFound", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(rename).WithArgs("alice", "bob").WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectRollback()
+	if _, err := service.RenameUser(ctx, "alice", "bob", nil); !errors.Is(err, models.ErrLoginTaken) {
+		t.Errorf("renaming to a taken login = %v; want ErrLoginTaken", err)
+	}
+
+	cert := &models.Certificate{Serial: "1f", Login: "carol", Fingerprint: "ab", IssuedAt: 1700000000}
+	mock.ExpectBegin()
+	mock.ExpectExec(rename).WithArgs("alice", "carol").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE certificates SET revoked_at = $2`)).
+		WithArgs("carol", int64(1700000000)).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO certificates`)).
+		WithArgs("1f", "carol", "ab", int64(1700000000)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE audit_log SET user_login = $2 WHERE user_login = $1`)).
+		WithArgs("alice", "carol").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+		WithArgs(sqlmock.AnyArg(), "carol", repo.AuditRename, "renamed from alice").WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectCommit()
+	if revoked, err := service.RenameUser(ctx, "alice", "carol", cert); err != nil || revoked != 2 {
+		t.Errorf("RenameUser = %d, %v; want 2 certificates revoked", revoked, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRenameUser_ResealsMetadata(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	wrapper, err := envelope.ParseLocalKeys("k1:" + base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, wrapped, kek, created_at FROM data_keys`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "wrapped", "kek", "created_at"}))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO data_keys`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "local:k1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	service.Sealer, err = envelope.Open(ctx, wrapper, repo.NewPostgresDataKeyRepository(service.DB), false)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	folder, err := service.Sealer.Seal("work", "alice/s1/folder")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resealed := &captured{}
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET login = $2 WHERE login = $1`)).
+		WithArgs("alice", "carol").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, COALESCE(comment, ''), folder, tags FROM secrets`)).
+		WithArgs("carol").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "comment", "folder", "tags"}).AddRow("s1", "", folder, "{}"))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE secrets SET comment = $3, folder = $4, tags = $5`)).
+		WithArgs("carol", "s1", sqlmock.AnyArg(), resealed, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE audit_log`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log`)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if _, err := service.RenameUser(ctx, "alice", "carol", nil); err != nil {
+		t.Fatalf("RenameUser returned error: %v", err)
+	}
+	value, _ := resealed.value.(string)
+	if got, err := service.Sealer.Open(value, "carol/s1/folder"); err != nil || got != "work" {
+		t.Errorf("resealed folder opens for carol as %q, %v; want work", got, err)
+	}
+	if _, err := service.Sealer.Open(value, "alice/s1/folder"); err == nil {
+		t.Error("resealed folder still opens for alice")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
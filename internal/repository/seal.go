@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// Payloads are encrypted by the clients, but the comment, folder and tags of
+// secrets are not. When a Sealer is configured they are sealed before they
+// are written, each bound to its user, secret and column so that sealed
+// values cannot be moved between rows. The type stays in the clear, as the
+// statistics group by it.
+
+// metaAAD returns the additional data sealed values of a column are bound to.
+func metaAAD(userID, secretID, column string) string {
+	return userID + "/" + secretID + "/" + column
+}
+
+// sealMeta returns sec with its comment, folder and tags sealed.
+func (s *PostgresSyncRepository) sealMeta(userID string, sec models.Secret) (models.Secret, error) {
+	if s.Sealer == nil {
+		return sec, nil
+	}
+	var err error
+	if sec.Comment, err = s.Sealer.Seal(sec.Comment, metaAAD(userID, sec.ID, "comment")); err != nil {
+		return sec, fmt.Errorf("seal comment: %w", err)
+	}
+	if sec.Folder, err = s.Sealer.Seal(sec.Folder, metaAAD(userID, sec.ID, "folder")); err != nil {
+		return sec, fmt.Errorf("seal folder: %w", err)
+	}
+	tags := make([]string, len(sec.Tags))
+	for i, tag := range sec.Tags {
+		if tags[i], err = s.Sealer.Seal(tag, metaAAD(userID, sec.ID, "tags")); err != nil {
+			return sec, fmt.Errorf("seal tags: %w", err)
+		}
+	}
+	sec.Tags = tags
+	return sec, nil
+}
+
+// openMeta opens the sealed comment, folder and tags of sec in place.
+// Values written before sealing was enabled are left as they are.
+func (s *PostgresSyncRepository) openMeta(userID string, sec *models.Secret) error {
+	if s.Sealer == nil {
+		return nil
+	}
+	var err error
+	if sec.Comment, err = s.Sealer.Open(sec.Comment, metaAAD(userID, sec.ID, "comment")); err != nil {
+		return fmt.Errorf("secret %s: comment: %w", sec.ID, err)
+	}
+	if sec.Folder, err = s.Sealer.Open(sec.Folder, metaAAD(userID, sec.ID, "folder")); err != nil {
+		return fmt.Errorf("secret %s: folder: %w", sec.ID, err)
+	}
+	for i, tag := range sec.Tags {
+		if sec.Tags[i], err = s.Sealer.Open(tag, metaAAD(userID, sec.ID, "tags")); err != nil {
+			return fmt.Errorf("secret %s: tags: %w", sec.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/atinyakov/GophKeeper/internal/envelope"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	repo "github.com/atinyakov/GophKeeper/internal/repository"
+)
+
+// captured matches any value and records it.
+type captured struct {
+	value driver.Value
+}
+
+func (c *captured) Match(v driver.Value) bool {
+	c.value = v
+	return true
+}
+
+func TestUpsertIfNewer_SealsMetadata(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// The first start creates a data key
+	wrapper, err := envelope.ParseLocalKeys("k1:" + base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, wrapped, kek, created_at FROM data_keys`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "wrapped", "kek", "created_at"}))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO data_keys`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "local:k1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	service.Sealer, err = envelope.Open(ctx, wrapper, repo.NewPostgresDataKeyRepository(service.DB), false)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+
+	comment, folder, tags := &captured{}, &captured{}, &captured{}
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT version, modified_at, deleted, CASE WHEN`)).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "modified_at", "deleted", "data"}))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO secrets`)).
+		WithArgs("s1", "u1", "text", sqlmock.AnyArg(), comment, folder, tags, int64(1), false, sqlmock.AnyArg(), int64(0), "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	sec := models.Secret{ID: "s1", Type: "text", Data: "x", Comment: "bank", Folder: "work", Tags: []string{"money"}, Version: 1}
+	if _, _, _, err := service.UpsertIfNewer(ctx, "u1", []models.Secret{sec}); err != nil {
+		t.Fatalf("UpsertIfNewer returned error: %v", err)
+	}
+	for _, c := range []*captured{comment, folder, tags} {
+		v, _ := c.value.(string)
+		if !strings.HasPrefix(v, "$env1$") && !strings.HasPrefix(v, `{"$env1$`) {
+			t.Errorf("stored %v; want a sealed value", c.value)
+		}
+	}
+
+	// Reads open them again
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, type, data`)).
+		WithArgs("u1", "s1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "data", "comment", "folder", "tags", "version", "deleted", "reprompt", "expires_at", "name"}).
+			AddRow("s1", "text", []byte("x"), comment.value, folder.value, tags.value, int64(1), false, false, int64(0), ""))
+	got, err := service.GetSecretByID(ctx, "u1", "s1")
+	if err != nil {
+		t.Fatalf("GetSecretByID returned error: %v", err)
+	}
+	if got.Comment != "bank" || got.Folder != "work" || len(got.Tags) != 1 || got.Tags[0] != "money" {
+		t.Errorf("GetSecretByID = %+v; want the original metadata", got)
+	}
+
+	// A sealed value does not open in another row
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, type, data`)).
+		WithArgs("u1", "s2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "data", "comment", "folder", "tags", "version", "deleted", "reprompt", "expires_at", "name"}).
+			AddRow("s2", "text", []byte("x"), comment.value, "", "{}", int64(1), false, false, int64(0), ""))
+	if _, err := service.GetSecretByID(ctx, "u1", "s2"); err == nil {
+		t.Error("GetSecretByID of a moved comment succeeded; want error")
+	}
+}
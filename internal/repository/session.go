@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// PostgresSessionRepository implements session storage using a PostgreSQL database.
+type PostgresSessionRepository struct {
+	// DB is the database handle for executing queries.
+	DB *sql.DB
+	// Hook observes the queries of the repository; optional.
+	Hook QueryHook
+}
+
+// NewPostgresSessionRepository creates a new PostgresSessionRepository with the given database connection.
+func NewPostgresSessionRepository(db *sql.DB) *PostgresSessionRepository {
+	return &PostgresSessionRepository{DB: db}
+}
+
+// db returns the database handle of the repository, observed by Hook.
+func (s *PostgresSessionRepository) db() querier {
+	return traced(s.DB, s.Hook)
+}
+
+// CreateSession stores a new session.
+func (s *PostgresSessionRepository) CreateSession(ctx context.Context, session models.Session) error {
+	_, err := s.db().ExecContext(ctx,
+		`INSERT INTO sessions (id_hash, user_id, csrf_token, expires_at) VALUES ($1, (SELECT id FROM users WHERE login = $2), $3, $4)`,
+		session.IDHash, session.UserLogin, session.CSRFToken, session.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert session: %w", err)
+	}
+	return nil
+}
+
+// GetSession returns the session with the given ID hash, or nil if it does not exist.
+func (s *PostgresSessionRepository) GetSession(ctx context.Context, idHash string) (*models.Session, error) {
+	var session models.Session
+	err := s.db().QueryRowContext(ctx,
+		`SELECT s.id_hash, u.login, s.csrf_token, s.expires_at FROM sessions s JOIN users u ON u.id = s.user_id WHERE s.id_hash = $1`,
+		idHash,
+	).Scan(&session.IDHash, &session.UserLogin, &session.CSRFToken, &session.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select session: %w", err)
+	}
+	return &session, nil
+}
+
+// DeleteSession removes the session with the given ID hash, if present.
+func (s *PostgresSessionRepository) DeleteSession(ctx context.Context, idHash string) error {
+	if _, err := s.db().ExecContext(ctx, `DELETE FROM sessions WHERE id_hash = $1`, idHash); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
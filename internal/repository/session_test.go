@@ -0,0 +1,90 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	repo "github.com/atinyakov/GophKeeper/internal/repository"
+)
+
+func setupSessionMock(t *testing.T) (*repo.PostgresSessionRepository, sqlmock.Sqlmock, func()) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	return repo.NewPostgresSessionRepository(db), mock, func() { db.Close() }
+}
+
+func TestCreateSession(t *testing.T) {
+	service, mock, cleanup := setupSessionMock(t)
+	defer cleanup()
+
+	session := models.Session{IDHash: "h1", UserLogin: "alice", CSRFToken: "csrf", ExpiresAt: 100}
+	mock.ExpectExec(regexp.QuoteMeta(
+		`INSERT INTO sessions (id_hash, user_id, csrf_token, expires_at) VALUES ($1, (SELECT id FROM users WHERE login = $2), $3, $4)`,
+	)).
+		WithArgs("h1", "alice", "csrf", int64(100)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := service.CreateSession(context.Background(), session); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetSession(t *testing.T) {
+	service, mock, cleanup := setupSessionMock(t)
+	defer cleanup()
+
+	query := regexp.QuoteMeta(`SELECT s.id_hash, u.login, s.csrf_token, s.expires_at FROM sessions s JOIN users u ON u.id = s.user_id WHERE s.id_hash = $1`)
+	mock.ExpectQuery(query).
+		WithArgs("h1").
+		WillReturnRows(sqlmock.NewRows([]string{"id_hash", "user_login", "csrf_token", "expires_at"}).
+			AddRow("h1", "alice", "csrf", int64(100)))
+	mock.ExpectQuery(query).
+		WithArgs("missing").
+		WillReturnError(sql.ErrNoRows)
+
+	session, err := service.GetSession(context.Background(), "h1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if session == nil || session.UserLogin != "alice" || session.CSRFToken != "csrf" {
+		t.Errorf("unexpected session: %+v", session)
+	}
+
+	session, err = service.GetSession(context.Background(), "missing")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if session != nil {
+		t.Errorf("expected nil session, got %+v", session)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDeleteSession(t *testing.T) {
+	service, mock, cleanup := setupSessionMock(t)
+	defer cleanup()
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM sessions WHERE id_hash = $1`)).
+		WithArgs("h1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := service.DeleteSession(context.Background(), "h1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
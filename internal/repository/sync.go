@@ -3,10 +3,14 @@
 package repository
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"fmt"
 
+	"github.com/atinyakov/GophKeeper/internal/blobstore"
+	"github.com/atinyakov/GophKeeper/internal/clock"
+	"github.com/atinyakov/GophKeeper/internal/envelope"
 	"github.com/atinyakov/GophKeeper/internal/models"
 	"github.com/lib/pq"
 )
@@ -15,6 +19,18 @@ import (
 type PostgresSyncRepository struct {
 	// DB is the database handle for executing queries and transactions.
 	DB *sql.DB
+	// Blobs stores large payloads outside the database when non-nil.
+	Blobs blobstore.Store
+	// BlobThreshold is the packed payload size from which payloads are
+	// stored in Blobs.
+	BlobThreshold int
+	// Sealer encrypts the comment, folder and tags of secrets at rest
+	// when non-nil.
+	Sealer *envelope.Sealer
+	// Clock tells the time secrets are stored at; clock.Real when nil.
+	Clock clock.Clock
+	// Hook observes the queries of the repository; optional.
+	Hook QueryHook
 }
 
 // NewPostgresSyncRepostitory creates a new PostgresSyncService using the provided *sql.DB.
@@ -23,6 +39,16 @@ func NewPostgresSyncRepostitory(db *sql.DB) *PostgresSyncRepository {
 	return &PostgresSyncRepository{DB: db}
 }
 
+// db returns the database handle of the repository, observed by Hook.
+func (s *PostgresSyncRepository) db() querier {
+	return traced(s.DB, s.Hook)
+}
+
+// clock returns the Clock of the repository.
+func (s *PostgresSyncRepository) clock() clock.Clock {
+	return cmp.Or(s.Clock, clock.Real)
+}
+
 // GetMaxVersion retrieves the highest version number of all secrets belonging to the given user.
 // If no secrets exist, it returns 0.
 //
@@ -32,8 +58,8 @@ func NewPostgresSyncRepostitory(db *sql.DB) *PostgresSyncRepository {
 // Returns the maximum version (int64) or an error if the query fails.
 func (s *PostgresSyncRepository) GetMaxVersion(ctx context.Context, userID string) (int64, error) {
 	var version int64
-	err := s.DB.QueryRowContext(ctx, `
-		SELECT COALESCE(MAX(version), 0) FROM secrets WHERE user_login = $1 AND deleted = false
+	err := s.db().QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(version), 0) FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND deleted = false
 	`, userID).Scan(&version)
 	if err != nil {
 		return 0, fmt.Errorf("GetMaxVersion failed: %w", err)
@@ -48,8 +74,8 @@ func (s *PostgresSyncRepository) GetMaxVersion(ctx context.Context, userID strin
 //
 // Returns a slice of models.Secret or an error if the query or scanning fails.
 func (s *PostgresSyncRepository) GetSecretsByUser(ctx context.Context, userID string) ([]models.Secret, error) {
-	rows, err := s.DB.QueryContext(ctx, `
-		SELECT id, type, data, comment, version, deleted FROM secrets WHERE user_login = $1 AND deleted = false
+	rows, err := s.db().QueryContext(ctx, `
+		SELECT id, type, data, comment, folder, tags, version, deleted, reprompt, expires_at, name FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND deleted = false
 	`, userID)
 	if err != nil {
 		return nil, fmt.Errorf("GetSecretsByUser: %w", err)
@@ -58,15 +84,47 @@ func (s *PostgresSyncRepository) GetSecretsByUser(ctx context.Context, userID st
 
 	var secrets []models.Secret
 	for rows.Next() {
-		var sec models.Secret
-		if err := rows.Scan(&sec.ID, &sec.Type, &sec.Data, &sec.Comment, &sec.Version, &sec.Deleted); err != nil {
+		var (
+			sec  models.Secret
+			data []byte
+		)
+		if err := rows.Scan(&sec.ID, &sec.Type, &data, &sec.Comment, &sec.Folder, pq.Array(&sec.Tags), &sec.Version, &sec.Deleted, &sec.Reprompt, &sec.ExpiresAt, &sec.Name); err != nil {
 			return nil, fmt.Errorf("scan: %w", err)
 		}
+		if sec.Data, err = s.loadData(ctx, data); err != nil {
+			return nil, err
+		}
+		if err := s.openMeta(userID, &sec); err != nil {
+			return nil, err
+		}
 		secrets = append(secrets, sec)
 	}
 	return secrets, nil
 }
 
+// GetDeletedSecretsByUser fetches the tombstones of the deleted secrets of
+// the specified user, with their ID and version only, so that devices
+// still holding the secrets learn about the deletions.
+func (s *PostgresSyncRepository) GetDeletedSecretsByUser(ctx context.Context, userID string) ([]models.Secret, error) {
+	rows, err := s.db().QueryContext(ctx, `
+		SELECT id, version FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND deleted = true ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("GetDeletedSecretsByUser: %w", err)
+	}
+	defer rows.Close()
+
+	var tombstones []models.Secret
+	for rows.Next() {
+		sec := models.Secret{Deleted: true}
+		if err := rows.Scan(&sec.ID, &sec.Version); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		tombstones = append(tombstones, sec)
+	}
+	return tombstones, rows.Err()
+}
+
 // UpsertSecrets inserts or updates multiple secrets for a given user within a transaction.
 // Each secret is inserted if new, or updated on conflict by ID.
 //
@@ -112,9 +170,48 @@ func (s *PostgresSyncRepository) GetSecretsByUser(ctx context.Context, userID st
 //
 // Returns an error if the delete operation fails.
 func (s *PostgresSyncRepository) DeleteSecrets(ctx context.Context, userID string, ids []string) error {
-	query := `UPDATE secrets SET deleted = true WHERE user_login = $1 AND id = ANY($2)`
-	_, err := s.DB.ExecContext(ctx, query, userID, pq.Array(ids))
-	return err
+	// Deleted secrets are served without their payload
+	var blobs []string
+	if s.Blobs != nil {
+		var err error
+		if blobs, err = s.blobRefs(ctx, userID, ids); err != nil {
+			return err
+		}
+	}
+
+	query := `UPDATE secrets SET deleted = true WHERE user_id = (SELECT id FROM users WHERE login = $1) AND id = ANY($2)`
+	if _, err := s.db().ExecContext(ctx, query, userID, pq.Array(ids)); err != nil {
+		return err
+	}
+	s.deleteBlobs(ctx, blobs)
+	return nil
+}
+
+// PurgeSecrets permanently removes the tombstones with the given IDs of the
+// specified user, without waiting for the soft-delete cleaner. Live secrets
+// are left alone; their payload blobs were released when they were deleted.
+//
+// Returns the IDs of the removed tombstones.
+func (s *PostgresSyncRepository) PurgeSecrets(ctx context.Context, userID string, ids []string) ([]string, error) {
+	rows, err := s.db().QueryContext(ctx, `
+		DELETE FROM secrets
+		WHERE user_id = (SELECT id FROM users WHERE login = $1) AND id = ANY($2) AND deleted = true
+		RETURNING id
+	`, userID, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("PurgeSecrets: %w", err)
+	}
+	defer rows.Close()
+
+	var purged []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		purged = append(purged, id)
+	}
+	return purged, rows.Err()
 }
 
 // GetSecretByID retrieves a single secret by ID for the given user.
@@ -125,82 +222,451 @@ func (s *PostgresSyncRepository) DeleteSecrets(ctx context.Context, userID strin
 //
 // Returns a pointer to models.Secret or an error if not found or on failure.
 func (s *PostgresSyncRepository) GetSecretByID(ctx context.Context, userID string, id string) (*models.Secret, error) {
-	var secret models.Secret
-	err := s.DB.QueryRowContext(ctx, `
-		SELECT id, type, data, comment, version, deleted FROM secrets
-		WHERE user_login = $1 AND id = $2 AND deleted = false
-	`, userID, id).Scan(&secret.ID, &secret.Type, &secret.Data, &secret.Comment, &secret.Version, &secret.Deleted)
+	var (
+		secret models.Secret
+		data   []byte
+	)
+	err := s.db().QueryRowContext(ctx, `
+		SELECT id, type, data, comment, folder, tags, version, deleted, reprompt, expires_at, name FROM secrets
+		WHERE user_id = (SELECT id FROM users WHERE login = $1) AND id = $2 AND deleted = false
+	`, userID, id).Scan(&secret.ID, &secret.Type, &data, &secret.Comment, &secret.Folder, pq.Array(&secret.Tags), &secret.Version, &secret.Deleted, &secret.Reprompt, &secret.ExpiresAt, &secret.Name)
 	if err != nil {
 		return nil, err
 	}
+	if secret.Data, err = s.loadData(ctx, data); err != nil {
+		return nil, err
+	}
+	if err := s.openMeta(userID, &secret); err != nil {
+		return nil, err
+	}
 	return &secret, nil
 }
 
 // UpsertIfNewer updates only those secrets which have a higher version.
-func (s *PostgresSyncRepository) UpsertIfNewer(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, error) {
+// It returns the IDs of the secrets stored and of those skipped, and a
+// conflict for every skipped secret the client changed of which the server
+// holds a newer version. Secrets skipped as the same version, and copies
+// the client did not change since it received them (see
+// models.Secret.Unchanged), which it uploads to every server alike, have
+// none.
+//
+// Tombstones count as stored versions too: a device that missed a deletion
+// uploads its copy unchanged, which is skipped without a conflict rather
+// than bringing the secret back. Only versions newer than the tombstone,
+// i.e. edits, restore the secret.
+func (s *PostgresSyncRepository) UpsertIfNewer(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, []models.Conflict, error) {
 	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, nil, fmt.Errorf("begin tx: %w", err)
+		return nil, nil, nil, fmt.Errorf("begin tx: %w", err)
 	}
 	defer tx.Rollback()
+	q := traced(tx, s.Hook)
 
+	now := s.clock().Now().Unix()
 	updated := make([]string, 0, len(secrets))
 	skipped := make([]string, 0, len(secrets))
+	var conflicts []models.Conflict
+	// Blobs stored for the new versions, removed again if the transaction
+	// fails, and blobs of the versions they replace
+	var stored, replaced []string
+	committed := false
+	defer func() {
+		if !committed {
+			s.deleteBlobs(ctx, stored)
+		}
+	}()
 
 	for _, sec := range secrets {
-		var existingVersion int64
-		err := tx.QueryRowContext(ctx, `
-			SELECT version FROM secrets WHERE id = $1 AND user_login = $2 AND deleted = false
-		`, sec.ID, userID).Scan(&existingVersion)
+		var (
+			existingVersion, modifiedAt int64
+			existingDeleted             bool
+			existingRef                 []byte // data column, if it references a blob
+		)
+		err := q.QueryRowContext(ctx, `
+			SELECT version, modified_at, deleted, CASE WHEN substring(data from 1 for $3) = $4 THEN data END
+			FROM secrets WHERE id = $1 AND user_id = (SELECT id FROM users WHERE login = $2)
+		`, sec.ID, userID, len(payloadMagic)+1, []byte(payloadMagic+string(codecBlob))).Scan(&existingVersion, &modifiedAt, &existingDeleted, &existingRef)
 		if err != nil && err != sql.ErrNoRows {
-			return nil, nil, fmt.Errorf("check version: %w", err)
+			return nil, nil, nil, fmt.Errorf("check version: %w", err)
 		}
 		if err == nil && existingVersion >= sec.Version {
 			skipped = append(skipped, sec.ID)
+			if existingVersion > sec.Version && !existingDeleted && !sec.Unchanged() {
+				conflicts = append(conflicts, models.Conflict{
+					ID:             sec.ID,
+					Version:        sec.Version,
+					ServerVersion:  existingVersion,
+					ServerModified: modifiedAt,
+				})
+			}
 			continue
 		}
+		// The stored reference is used rather than the key of the version,
+		// as the blob may have been stored under a login since renamed.
+		// The blobs of tombstones were released when they were deleted.
+		if key, ok := blobRef(existingRef); ok && s.Blobs != nil && !existingDeleted {
+			replaced = append(replaced, key)
+		}
 
-		_, err = tx.ExecContext(ctx, `
-			INSERT INTO secrets (id, user_login, type, data, comment, version, deleted)
-			VALUES ($1, $2, $3, $4, $5, $6, false)
-			ON CONFLICT (id) DO UPDATE SET
+		data, key, err := s.storeData(ctx, userID, sec.ID, sec.Version, sec.Data)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if key != "" {
+			stored = append(stored, key)
+		}
+		meta, err := s.sealMeta(userID, sec)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		_, err = q.ExecContext(ctx, `
+			INSERT INTO secrets (id, user_id, type, data, comment, folder, tags, version, deleted, reprompt, modified_at, expires_at, name)
+			VALUES ($1, (SELECT id FROM users WHERE login = $2), $3, $4, $5, $6, $7, $8, false, $9, $10, $11, $12)
+			ON CONFLICT (user_id, id) DO UPDATE SET
 				type = EXCLUDED.type,
 				data = EXCLUDED.data,
 				comment = EXCLUDED.comment,
+				folder = EXCLUDED.folder,
+				tags = EXCLUDED.tags,
 				version = EXCLUDED.version,
-				deleted = false
-		`, sec.ID, userID, sec.Type, sec.Data, sec.Comment, sec.Version)
+				deleted = false,
+				reprompt = EXCLUDED.reprompt,
+				modified_at = EXCLUDED.modified_at,
+				expires_at = EXCLUDED.expires_at,
+				name = EXCLUDED.name
+		`, sec.ID, userID, sec.Type, data, meta.Comment, meta.Folder, pq.Array(nonNil(meta.Tags)), sec.Version, sec.Reprompt, now, sec.ExpiresAt, sec.Name)
 		if err != nil {
-			return nil, nil, fmt.Errorf("upsert: %w", err)
+			return nil, nil, nil, fmt.Errorf("upsert: %w", err)
 		}
 		updated = append(updated, sec.ID)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return nil, nil, fmt.Errorf("commit: %w", err)
+		return nil, nil, nil, fmt.Errorf("commit: %w", err)
+	}
+	committed = true
+	if s.Blobs != nil {
+		s.deleteBlobs(ctx, replaced)
+	}
+	return updated, skipped, conflicts, nil
+}
+
+// GetNewerSecrets returns all secrets matching filter with versions newer
+// than those the client knows.
+func (s *PostgresSyncRepository) GetNewerSecrets(ctx context.Context, userID string, versions map[string]int64, filter models.SyncFilter) ([]models.Secret, error) {
+	var newer []models.Secret
+	err := s.EachNewerSecret(ctx, userID, versions, filter, func(sec models.Secret) error {
+		newer = append(newer, sec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return updated, skipped, nil
+	return newer, nil
 }
 
-// GetNewerSecrets returns all secrets with versions newer than those the client knows.
-func (s *PostgresSyncRepository) GetNewerSecrets(ctx context.Context, userID string, versions map[string]int64) ([]models.Secret, error) {
-	rows, err := s.DB.QueryContext(ctx, `
-		SELECT id, type, data, comment, version, deleted FROM secrets WHERE user_login = $1 AND deleted = false
+// EachNewerSecret calls fn with each secret matching filter whose version is
+// newer than the one the client knows, as rows are read, so that the vault
+// is never held in memory as a whole. It stops at and returns the first
+// error of fn.
+//
+// The filter is applied by the query, so that secrets outside it are never
+// read, unless the metadata is sealed: then it is applied to the opened
+// folder and tags, still before the payload is loaded.
+func (s *PostgresSyncRepository) EachNewerSecret(ctx context.Context, userID string, versions map[string]int64, filter models.SyncFilter, fn func(models.Secret) error) error {
+	query := `
+		SELECT id, type, data, comment, folder, tags, version, deleted, reprompt, expires_at, name FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND deleted = false
+	`
+	args := []any{userID}
+	if !filter.Empty() && s.Sealer == nil {
+		query += `AND (type = ANY($2) OR tags && $3 OR EXISTS (
+			SELECT 1 FROM unnest($4::text[]) f WHERE folder = f OR starts_with(folder, f || '/')
+		))
+	`
+		args = append(args, pq.Array(filter.Types), pq.Array(filter.Tags), pq.Array(filter.Folders))
+	}
+	rows, err := s.db().QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("GetNewerSecrets: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			sec  models.Secret
+			data []byte
+		)
+		if err := rows.Scan(&sec.ID, &sec.Type, &data, &sec.Comment, &sec.Folder, pq.Array(&sec.Tags), &sec.Version, &sec.Deleted, &sec.Reprompt, &sec.ExpiresAt, &sec.Name); err != nil {
+			return fmt.Errorf("scan: %w", err)
+		}
+		if clientVer, ok := versions[sec.ID]; ok && sec.Version <= clientVer {
+			continue
+		}
+		if err := s.openMeta(userID, &sec); err != nil {
+			return err
+		}
+		if !filter.Match(sec) {
+			continue
+		}
+		if sec.Data, err = s.loadData(ctx, data); err != nil {
+			return err
+		}
+		if err := fn(sec); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// EachSecret calls fn with every secret of the user, including the
+// tombstones of deleted secrets, which are passed without their payload.
+// Secrets are passed in ID order as rows are read.
+func (s *PostgresSyncRepository) EachSecret(ctx context.Context, userID string, fn func(models.Secret) error) error {
+	rows, err := s.db().QueryContext(ctx, `
+		SELECT id, type, data, comment, folder, tags, version, deleted, reprompt, expires_at, name FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) ORDER BY id
 	`, userID)
 	if err != nil {
-		return nil, fmt.Errorf("GetNewerSecrets: %w", err)
+		return fmt.Errorf("EachSecret: %w", err)
 	}
 	defer rows.Close()
 
-	var newer []models.Secret
 	for rows.Next() {
-		var sec models.Secret
-		if err := rows.Scan(&sec.ID, &sec.Type, &sec.Data, &sec.Comment, &sec.Version, &sec.Deleted); err != nil {
+		var (
+			sec  models.Secret
+			data []byte
+		)
+		if err := rows.Scan(&sec.ID, &sec.Type, &data, &sec.Comment, &sec.Folder, pq.Array(&sec.Tags), &sec.Version, &sec.Deleted, &sec.Reprompt, &sec.ExpiresAt, &sec.Name); err != nil {
+			return fmt.Errorf("scan: %w", err)
+		}
+		if !sec.Deleted {
+			if sec.Data, err = s.loadData(ctx, data); err != nil {
+				return err
+			}
+		}
+		if err := s.openMeta(userID, &sec); err != nil {
+			return err
+		}
+		if err := fn(sec); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetSecretHeaders returns the version of every live secret of the given
+// user by ID, without reading the payloads.
+func (s *PostgresSyncRepository) GetSecretHeaders(ctx context.Context, userID string) (map[string]int64, error) {
+	rows, err := s.db().QueryContext(ctx, `
+		SELECT id, version FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND deleted = false
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("GetSecretHeaders: %w", err)
+	}
+	defer rows.Close()
+
+	headers := make(map[string]int64)
+	for rows.Next() {
+		var (
+			id      string
+			version int64
+		)
+		if err := rows.Scan(&id, &version); err != nil {
 			return nil, fmt.Errorf("scan: %w", err)
 		}
-		if clientVer, ok := versions[sec.ID]; !ok || sec.Version > clientVer {
-			newer = append(newer, sec)
+		headers[id] = version
+	}
+	return headers, rows.Err()
+}
+
+// GetTypeStats returns the number of live secrets and the total size of their
+// encrypted payloads, grouped by secret type, for the given user.
+func (s *PostgresSyncRepository) GetTypeStats(ctx context.Context, userID string) (map[string]int64, map[string]int64, error) {
+	rows, err := s.db().QueryContext(ctx, `
+		SELECT type, COUNT(*), COALESCE(SUM(LENGTH(data)), 0) FROM secrets
+		WHERE user_id = (SELECT id FROM users WHERE login = $1) AND deleted = false GROUP BY type
+	`, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GetTypeStats: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	sizes := make(map[string]int64)
+	for rows.Next() {
+		var typ string
+		var count, size int64
+		if err := rows.Scan(&typ, &count, &size); err != nil {
+			return nil, nil, fmt.Errorf("scan: %w", err)
 		}
+		counts[typ] = count
+		sizes[typ] = size
 	}
-	return newer, nil
+	return counts, sizes, rows.Err()
+}
+
+// GetVaultSummary returns the number of live secrets of the given user per
+// type, folder and tag, and the total size of their encrypted payloads.
+// Only the metadata is read, opened if sealed, not the payloads.
+func (s *PostgresSyncRepository) GetVaultSummary(ctx context.Context, userID string) (models.VaultSummary, error) {
+	summary := models.VaultSummary{Types: map[string]int64{}, Folders: map[string]int64{}, Tags: map[string]int64{}}
+	rows, err := s.db().QueryContext(ctx, `
+		SELECT id, type, comment, folder, tags, LENGTH(data) FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND deleted = false
+	`, userID)
+	if err != nil {
+		return summary, fmt.Errorf("GetVaultSummary: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			sec  models.Secret
+			size int64
+		)
+		if err := rows.Scan(&sec.ID, &sec.Type, &sec.Comment, &sec.Folder, pq.Array(&sec.Tags), &size); err != nil {
+			return summary, fmt.Errorf("scan: %w", err)
+		}
+		if err := s.openMeta(userID, &sec); err != nil {
+			return summary, err
+		}
+		summary.Types[sec.Type]++
+		if sec.Folder != "" {
+			summary.Folders[sec.Folder]++
+		}
+		for _, tag := range sec.Tags {
+			summary.Tags[tag]++
+		}
+		summary.TotalBytes += size
+	}
+	return summary, rows.Err()
+}
+
+// TouchDevice records a successful sync of the given device at the given Unix time.
+func (s *PostgresSyncRepository) TouchDevice(ctx context.Context, userID, deviceID string, at int64) error {
+	_, err := s.db().ExecContext(ctx, `
+		INSERT INTO devices (user_id, device_id, last_sync) VALUES ((SELECT id FROM users WHERE login = $1), $2, $3)
+		ON CONFLICT (user_id, device_id) DO UPDATE SET last_sync = EXCLUDED.last_sync
+	`, userID, deviceID, at)
+	if err != nil {
+		return fmt.Errorf("TouchDevice: %w", err)
+	}
+	return nil
+}
+
+// GetRollback returns the times of the backup the user's vault was last
+// rolled back to and of the restore, see db.Restore; both 0 if it never
+// was.
+func (s *PostgresSyncRepository) GetRollback(ctx context.Context, userID string) (int64, int64, error) {
+	var from, at int64
+	err := s.db().QueryRowContext(ctx, `SELECT rolled_back_from, rolled_back_at FROM users WHERE login = $1`, userID).Scan(&from, &at)
+	if err != nil {
+		return 0, 0, fmt.Errorf("GetRollback: %w", err)
+	}
+	return from, at, nil
+}
+
+// GetKDF returns the key derivation parameters of the user's vault as
+// stored by SetKDF, or "" if none were stored yet.
+func (s *PostgresSyncRepository) GetKDF(ctx context.Context, userID string) (string, error) {
+	var kdf string
+	err := s.db().QueryRowContext(ctx, `SELECT kdf FROM users WHERE login = $1`, userID).Scan(&kdf)
+	if err != nil {
+		return "", fmt.Errorf("GetKDF: %w", err)
+	}
+	return kdf, nil
+}
+
+// SetKDF stores the key derivation parameters of the user's vault unless
+// some are stored already, so that the first device to send them sets
+// them for all, and returns the parameters stored.
+func (s *PostgresSyncRepository) SetKDF(ctx context.Context, userID, kdf string) (string, error) {
+	var stored string
+	err := s.db().QueryRowContext(ctx, `
+		UPDATE users SET kdf = CASE WHEN kdf = '' THEN $2 ELSE kdf END WHERE login = $1 RETURNING kdf
+	`, userID, kdf).Scan(&stored)
+	if err != nil {
+		return "", fmt.Errorf("SetKDF: %w", err)
+	}
+	return stored, nil
+}
+
+// TouchSeen records an authenticated request of the given device at the
+// given Unix time. The time never moves backwards, so concurrent requests
+// may record it in any order.
+func (s *PostgresSyncRepository) TouchSeen(ctx context.Context, userID, deviceID string, at int64) error {
+	_, err := s.db().ExecContext(ctx, `
+		INSERT INTO devices (user_id, device_id, last_seen) VALUES ((SELECT id FROM users WHERE login = $1), $2, $3)
+		ON CONFLICT (user_id, device_id) DO UPDATE SET last_seen = GREATEST(devices.last_seen, EXCLUDED.last_seen)
+	`, userID, deviceID, at)
+	if err != nil {
+		return fmt.Errorf("TouchSeen: %w", err)
+	}
+	return nil
+}
+
+// GetDevices returns the devices of the given user, most recently synced first.
+func (s *PostgresSyncRepository) GetDevices(ctx context.Context, userID string) ([]models.Device, error) {
+	rows, err := s.db().QueryContext(ctx, `
+		SELECT device_id, last_sync, last_seen FROM devices WHERE user_id = (SELECT id FROM users WHERE login = $1) ORDER BY last_sync DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("GetDevices: %w", err)
+	}
+	defer rows.Close()
+
+	var devices []models.Device
+	for rows.Next() {
+		var d models.Device
+		if err := rows.Scan(&d.ID, &d.LastSync, &d.LastSeen); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// RecordAccess records that the given device fetched the secrets with the
+// given IDs at the given Unix time.
+func (s *PostgresSyncRepository) RecordAccess(ctx context.Context, userID, deviceID string, ids []string, at int64) error {
+	_, err := s.db().ExecContext(ctx, `
+		INSERT INTO secret_access (user_id, secret_id, device_id, accessed_at)
+		SELECT (SELECT id FROM users WHERE login = $1), id, $3, $4 FROM unnest($2::text[]) AS id
+	`, userID, pq.Array(ids), deviceID, at)
+	if err != nil {
+		return fmt.Errorf("RecordAccess: %w", err)
+	}
+	return nil
+}
+
+// GetAccessLog returns up to limit accesses of the given secret of the
+// user, newest first.
+func (s *PostgresSyncRepository) GetAccessLog(ctx context.Context, userID, secretID string, limit int) ([]models.SecretAccess, error) {
+	rows, err := s.db().QueryContext(ctx, `
+		SELECT device_id, accessed_at FROM secret_access
+		WHERE user_id = (SELECT id FROM users WHERE login = $1) AND secret_id = $2
+		ORDER BY accessed_at DESC, id DESC LIMIT $3
+	`, userID, secretID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("GetAccessLog: %w", err)
+	}
+	defer rows.Close()
+
+	var log []models.SecretAccess
+	for rows.Next() {
+		var a models.SecretAccess
+		if err := rows.Scan(&a.DeviceID, &a.Time); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		log = append(log, a)
+	}
+	return log, rows.Err()
+}
+
+// nonNil returns tags, or an empty slice if tags is nil, so that the NOT NULL
+// tags column receives an empty array instead of NULL.
+func nonNil(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
 }
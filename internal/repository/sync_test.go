@@ -3,10 +3,14 @@ package repository_test
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"reflect"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/atinyakov/GophKeeper/internal/clock"
 	"github.com/atinyakov/GophKeeper/internal/models"
 	repo "github.com/atinyakov/GophKeeper/internal/repository"
 	"github.com/lib/pq"
@@ -27,7 +31,7 @@ func TestGetMaxVersion(t *testing.T) {
 
 	userID := "user1"
 	mock.ExpectQuery(regexp.QuoteMeta(
-		`SELECT COALESCE(MAX(version), 0) FROM secrets WHERE user_login = $1 AND deleted = false`,
+		`SELECT COALESCE(MAX(version), 0) FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND deleted = false`,
 	)).
 		WithArgs(userID).
 		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(int64(7)))
@@ -51,11 +55,11 @@ func TestGetSecretsByUser(t *testing.T) {
 
 	userID := "alice"
 	mock.ExpectQuery(regexp.QuoteMeta(
-		`SELECT id, type, data, comment, version, deleted FROM secrets WHERE user_login = $1 AND deleted = false`,
+		`SELECT id, type, data, comment, folder, tags, version, deleted, reprompt, expires_at, name FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND deleted = false`,
 	)).
 		WithArgs(userID).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "data", "comment", "version", "deleted"}).
-			AddRow("id1", "pass", "data1", "comment1", int64(1), false),
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "data", "comment", "folder", "tags", "version", "deleted", "reprompt", "expires_at", "name"}).
+			AddRow("id1", "pass", "data1", "comment1", "work", "{db,prod}", int64(1), false, false, int64(0), "name1"),
 		)
 
 	list, err := service.GetSecretsByUser(context.Background(), userID)
@@ -65,6 +69,12 @@ func TestGetSecretsByUser(t *testing.T) {
 	if len(list) != 1 || list[0].ID != "id1" {
 		t.Errorf("unexpected result: %+v", list)
 	}
+	if list[0].Folder != "work" || len(list[0].Tags) != 2 || list[0].Tags[1] != "prod" {
+		t.Errorf("folder/tags = %q/%q; want work/[db prod]", list[0].Folder, list[0].Tags)
+	}
+	if list[0].Name != "name1" {
+		t.Errorf("name = %q; want name1", list[0].Name)
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("unfulfilled expectations: %v", err)
@@ -78,7 +88,7 @@ func TestDeleteSecrets(t *testing.T) {
 	userID := "bob"
 	ids := []string{"id1", "id2"}
 	mock.ExpectExec(regexp.QuoteMeta(
-		`UPDATE secrets SET deleted = true WHERE user_login = $1 AND id = ANY($2)`,
+		`UPDATE secrets SET deleted = true WHERE user_id = (SELECT id FROM users WHERE login = $1) AND id = ANY($2)`,
 	)).
 		WithArgs(userID, pq.Array(ids)).
 		WillReturnResult(sqlmock.NewResult(0, 2))
@@ -92,6 +102,55 @@ func TestDeleteSecrets(t *testing.T) {
 	}
 }
 
+func TestGetDeletedSecretsByUser(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT id, version FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND deleted = true ORDER BY id`,
+	)).
+		WithArgs("bob").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow("id1", int64(3)).AddRow("id2", int64(7)))
+
+	tombstones, err := service.GetDeletedSecretsByUser(context.Background(), "bob")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []models.Secret{{ID: "id1", Version: 3, Deleted: true}, {ID: "id2", Version: 7, Deleted: true}}
+	if !reflect.DeepEqual(tombstones, want) {
+		t.Errorf("tombstones = %+v; want %+v", tombstones, want)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPurgeSecrets(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	userID := "bob"
+	ids := []string{"id1", "id2"}
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`DELETE FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND id = ANY($2) AND deleted = true RETURNING id`,
+	)).
+		WithArgs(userID, pq.Array(ids)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("id2"))
+
+	purged, err := service.PurgeSecrets(context.Background(), userID, ids)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(purged) != 1 || purged[0] != "id2" {
+		t.Errorf("purged = %v; want [id2]", purged)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
 func TestGetSecretByID(t *testing.T) {
 	service, mock, cleanup := setupMock(t)
 	defer cleanup()
@@ -99,11 +158,11 @@ func TestGetSecretByID(t *testing.T) {
 	userID := "user1"
 	id := "sec1"
 	mock.ExpectQuery(regexp.QuoteMeta(
-		`SELECT id, type, data, comment, version, deleted FROM secrets WHERE user_login = $1 AND id = $2 AND deleted = false`,
+		`SELECT id, type, data, comment, folder, tags, version, deleted, reprompt, expires_at, name FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND id = $2 AND deleted = false`,
 	)).
 		WithArgs(userID, id).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "data", "comment", "version", "deleted"}).
-			AddRow(id, "t", "d", "c", int64(3), false),
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "data", "comment", "folder", "tags", "version", "deleted", "reprompt", "expires_at", "name"}).
+			AddRow(id, "t", "d", "c", "", "{}", int64(3), false, false, int64(0), ""),
 		)
 
 	sec, err := service.GetSecretByID(context.Background(), userID, id)
@@ -128,53 +187,153 @@ func TestUpsertIfNewer_SkipsOlder(t *testing.T) {
 
 	mock.ExpectBegin()
 	mock.ExpectQuery(regexp.QuoteMeta(
-		`SELECT version FROM secrets WHERE id = $1 AND user_login = $2 AND deleted = false`,
+		`SELECT version, modified_at, deleted, CASE WHEN substring(data from 1 for $3) = $4 THEN data END
+			FROM secrets WHERE id = $1 AND user_id = (SELECT id FROM users WHERE login = $2)`,
 	)).
-		WithArgs(secret.ID, userID).
-		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(6)))
+		WithArgs(secret.ID, userID, 4, []byte("\x00GK\x02")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "modified_at", "deleted", "data"}).AddRow(int64(6), int64(1700000000), false, nil))
 	mock.ExpectCommit()
 
-	updated, skipped, err := service.UpsertIfNewer(context.Background(), userID, []models.Secret{secret})
+	updated, skipped, conflicts, err := service.UpsertIfNewer(context.Background(), userID, []models.Secret{secret})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if len(updated) != 0 || len(skipped) != 1 || skipped[0] != "s1" {
 		t.Errorf("expected skip, got updated=%v skipped=%v", updated, skipped)
 	}
+	want := []models.Conflict{{ID: "s1", Version: 5, ServerVersion: 6, ServerModified: 1700000000}}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("conflicts = %+v; want %+v", conflicts, want)
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("unfulfilled expectations: %v", err)
 	}
 }
 
+// TestUpsertIfNewer_SkipsUnchanged checks that a copy the client did not
+// change since it received it is skipped without a conflict when the
+// server holds a newer version, while an edit of it is in conflict.
+func TestUpsertIfNewer_SkipsUnchanged(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	unchanged := models.Secret{ID: "s1", Type: "t", Data: "d", Version: 5, BaseVersion: 5}
+	edited := models.Secret{ID: "s2", Type: "t", Data: "e", Version: 7, BaseVersion: 5}
+	mock.ExpectBegin()
+	for _, sec := range []models.Secret{unchanged, edited} {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT version, modified_at, deleted, CASE WHEN`)).
+			WithArgs(sec.ID, "u1", 4, []byte("\x00GK\x02")).
+			WillReturnRows(sqlmock.NewRows([]string{"version", "modified_at", "deleted", "data"}).AddRow(int64(8), int64(1700000000), false, nil))
+	}
+	mock.ExpectCommit()
+
+	updated, skipped, conflicts, err := service.UpsertIfNewer(context.Background(), "u1", []models.Secret{unchanged, edited})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(updated) != 0 || !reflect.DeepEqual(skipped, []string{"s1", "s2"}) {
+		t.Errorf("updated=%v skipped=%v; want both skipped", updated, skipped)
+	}
+	want := []models.Conflict{{ID: "s2", Version: 7, ServerVersion: 8, ServerModified: 1700000000}}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("conflicts = %+v; want %+v", conflicts, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestUpsertIfNewer_SkipsDeleted checks that a device that missed a
+// deletion does not bring the secret back by uploading its unchanged copy.
+func TestUpsertIfNewer_SkipsDeleted(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	secret := models.Secret{ID: "s1", Type: "t", Data: "d", Version: 5}
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT version, modified_at, deleted, CASE WHEN`)).
+		WithArgs(secret.ID, "u1", 4, []byte("\x00GK\x02")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "modified_at", "deleted", "data"}).AddRow(int64(6), int64(1700000000), true, nil))
+	mock.ExpectCommit()
+
+	updated, skipped, conflicts, err := service.UpsertIfNewer(context.Background(), "u1", []models.Secret{secret})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(updated) != 0 || len(skipped) != 1 || len(conflicts) != 0 {
+		t.Errorf("updated=%v skipped=%v conflicts=%v; want s1 skipped without a conflict", updated, skipped, conflicts)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
 func TestUpsertIfNewer_UpdatesNewer(t *testing.T) {
 	service, mock, cleanup := setupMock(t)
 	defer cleanup()
+	service.Clock = clock.NewFake(time.Unix(1700000000, 0))
 
 	userID := "u2"
-	secret := models.Secret{ID: "s1", Type: "t", Data: "d", Comment: "c", Version: 10}
+	secret := models.Secret{ID: "s1", Type: "t", Data: "d", Name: "n", Comment: "c", Folder: "work", Tags: []string{"db"}, Version: 10}
 
 	mock.ExpectBegin()
 	mock.ExpectQuery(regexp.QuoteMeta(
-		`SELECT version FROM secrets WHERE id = $1 AND user_login = $2 AND deleted = false`,
+		`SELECT version, modified_at, deleted, CASE WHEN substring(data from 1 for $3) = $4 THEN data END
+			FROM secrets WHERE id = $1 AND user_id = (SELECT id FROM users WHERE login = $2)`,
 	)).
-		WithArgs(secret.ID, userID).
+		WithArgs(secret.ID, userID, 4, []byte("\x00GK\x02")).
 		WillReturnError(sql.ErrNoRows)
 	mock.ExpectExec(
-		regexp.QuoteMeta(`INSERT INTO secrets (id, user_login, type, data, comment, version, deleted)`)+".*",
+		regexp.QuoteMeta(`INSERT INTO secrets (id, user_id, type, data, comment, folder, tags, version, deleted, reprompt, modified_at, expires_at, name)`)+".*",
 	).
-		WithArgs(secret.ID, userID, secret.Type, secret.Data, secret.Comment, secret.Version).
+		WithArgs(secret.ID, userID, secret.Type, []byte(secret.Data), secret.Comment, secret.Folder, pq.Array(secret.Tags), secret.Version, secret.Reprompt, int64(1700000000), secret.ExpiresAt, secret.Name).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
-	updated, skipped, err := service.UpsertIfNewer(context.Background(), userID, []models.Secret{secret})
+	updated, skipped, conflicts, err := service.UpsertIfNewer(context.Background(), userID, []models.Secret{secret})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(updated) != 1 || updated[0] != "s1" {
-		t.Errorf("expected update, got updated=%v skipped=%v", updated, skipped)
+	if len(updated) != 1 || updated[0] != "s1" || len(conflicts) != 0 {
+		t.Errorf("expected update, got updated=%v skipped=%v conflicts=%v", updated, skipped, conflicts)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
 	}
+}
 
+// TestUpsertIfNewer_SameIDOtherUser checks that a secret ID already used by
+// another user is stored as a secret of its own, keyed by owner and ID,
+// instead of updating the other user's row.
+func TestUpsertIfNewer_SameIDOtherUser(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	// alice holds s1 already; bob's s1 is not found among his secrets
+	secret := models.Secret{ID: "s1", Type: "text", Data: "bob's", Version: 3}
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT version, modified_at, deleted, CASE WHEN substring(data from 1 for $3) = $4 THEN data END
+			FROM secrets WHERE id = $1 AND user_id = (SELECT id FROM users WHERE login = $2)`,
+	)).
+		WithArgs("s1", "bob", 4, []byte("\x00GK\x02")).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(
+		regexp.QuoteMeta(`INSERT INTO secrets (id, user_id,`)+".*"+regexp.QuoteMeta(`ON CONFLICT (user_id, id) DO UPDATE SET`),
+	).
+		WithArgs("s1", "bob", "text", []byte("bob's"), "", "", pq.Array([]string{}), int64(3), false, sqlmock.AnyArg(), int64(0), "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	updated, _, _, err := service.UpsertIfNewer(context.Background(), "bob", []models.Secret{secret})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(updated) != 1 || updated[0] != "s1" {
+		t.Errorf("updated = %v; want [s1]", updated)
+	}
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("unfulfilled expectations: %v", err)
 	}
@@ -186,14 +345,14 @@ func TestGetNewerSecrets(t *testing.T) {
 
 	userID := "userN"
 	mock.ExpectQuery(regexp.QuoteMeta(
-		`SELECT id, type, data, comment, version, deleted FROM secrets WHERE user_login = $1 AND deleted = false`,
+		`SELECT id, type, data, comment, folder, tags, version, deleted, reprompt, expires_at, name FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND deleted = false`,
 	)).
 		WithArgs(userID).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "data", "comment", "version", "deleted"}).
-			AddRow("id1", "t", "d", "c", int64(5), false),
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "data", "comment", "folder", "tags", "version", "deleted", "reprompt", "expires_at", "name"}).
+			AddRow("id1", "t", "d", "c", "", "{}", int64(5), false, false, int64(0), ""),
 		)
 
-	list, err := service.GetNewerSecrets(context.Background(), userID, map[string]int64{"id1": 2})
+	list, err := service.GetNewerSecrets(context.Background(), userID, map[string]int64{"id1": 2}, models.SyncFilter{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -205,3 +364,280 @@ func TestGetNewerSecrets(t *testing.T) {
 		t.Errorf("unfulfilled expectations: %v", err)
 	}
 }
+
+func TestEachNewerSecret_Filter(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	filter := models.SyncFilter{Folders: []string{"work"}, Tags: []string{"shared"}, Types: []string{"chunk"}}
+	mock.ExpectQuery(regexp.QuoteMeta(`AND (type = ANY($2) OR tags && $3 OR EXISTS (`)).
+		WithArgs("u1", pq.Array(filter.Types), pq.Array(filter.Tags), pq.Array(filter.Folders)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "data", "comment", "folder", "tags", "version", "deleted", "reprompt", "expires_at", "name"}).
+			AddRow("w1", "text", "d", "c", "work/db", "{}", int64(2), false, false, int64(0), ""))
+
+	list, err := service.GetNewerSecrets(context.Background(), "u1", nil, filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != "w1" {
+		t.Errorf("unexpected result: %+v", list)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestEachNewerSecret_StopsOnError(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT id, type, data, comment, folder, tags, version, deleted, reprompt, expires_at, name FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND deleted = false`,
+	)).
+		WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "data", "comment", "folder", "tags", "version", "deleted", "reprompt", "expires_at", "name"}).
+			AddRow("id1", "t", "d", "c", "", "{}", int64(1), false, false, int64(0), "").
+			AddRow("id2", "t", "d", "c", "", "{}", int64(5), false, false, int64(0), "").
+			AddRow("id3", "t", "d", "c", "", "{}", int64(6), false, false, int64(0), ""),
+		)
+
+	errStop := errors.New("stop")
+	var got []string
+	err := service.EachNewerSecret(context.Background(), "u1", map[string]int64{"id1": 1}, models.SyncFilter{}, func(sec models.Secret) error {
+		got = append(got, sec.ID)
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("EachNewerSecret error = %v; want %v", err, errStop)
+	}
+	if len(got) != 1 || got[0] != "id2" {
+		t.Errorf("fn called with %v; want [id2]", got)
+	}
+}
+
+func TestEachSecret_IncludesTombstones(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, type, data, comment, folder, tags, version, deleted, reprompt, expires_at, name FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) ORDER BY id`)).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "data", "comment", "folder", "tags", "version", "deleted", "reprompt", "expires_at", "name"}).
+			AddRow("a", "text", []byte("payload"), "note", "", "{}", int64(2), false, false, int64(0), "").
+			AddRow("b", "text", []byte("\x00GK\x02gone"), "old", "", "{}", int64(5), true, false, int64(0), ""))
+
+	var got []models.Secret
+	err := service.EachSecret(context.Background(), "alice", func(sec models.Secret) error {
+		got = append(got, sec)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EachSecret returned error: %v", err)
+	}
+	if len(got) != 2 || got[0].Data != "payload" || !got[1].Deleted || got[1].Data != "" {
+		t.Errorf("EachSecret passed %+v; want the live secret and the tombstone without payload", got)
+	}
+}
+
+func TestGetSecretHeaders(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT id, version FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND deleted = false`,
+	)).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow("id1", int64(3)).AddRow("id2", int64(7)))
+
+	headers, err := service.GetSecretHeaders(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(headers) != 2 || headers["id1"] != 3 || headers["id2"] != 7 {
+		t.Errorf("headers = %v; want id1:3 id2:7", headers)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetTypeStats(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT type, COUNT(*), COALESCE(SUM(LENGTH(data)), 0) FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND deleted = false GROUP BY type`,
+	)).
+		WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"type", "count", "sum"}).
+			AddRow("text", int64(2), int64(100)).
+			AddRow("card", int64(1), int64(40)),
+		)
+
+	counts, sizes, err := service.GetTypeStats(context.Background(), "u1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if counts["text"] != 2 || counts["card"] != 1 {
+		t.Errorf("unexpected counts: %+v", counts)
+	}
+	if sizes["text"] != 100 || sizes["card"] != 40 {
+		t.Errorf("unexpected sizes: %+v", sizes)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetVaultSummary(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT id, type, comment, folder, tags, LENGTH(data) FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND deleted = false`,
+	)).
+		WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "comment", "folder", "tags", "length"}).
+			AddRow("s1", "text", "", "work", "{db,prod}", int64(100)).
+			AddRow("s2", "card", "", "work", "{prod}", int64(40)).
+			AddRow("s3", "text", "", "", "{}", int64(10)),
+		)
+
+	summary, err := service.GetVaultSummary(context.Background(), "u1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := models.VaultSummary{
+		Types:      map[string]int64{"text": 2, "card": 1},
+		Folders:    map[string]int64{"work": 2},
+		Tags:       map[string]int64{"db": 1, "prod": 2},
+		TotalBytes: 150,
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("summary = %+v; want %+v", summary, want)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTouchDeviceAndGetDevices(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO devices (user_id, device_id, last_sync) VALUES ((SELECT id FROM users WHERE login = $1), $2, $3)`)).
+		WithArgs("u1", "dev1", int64(99)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT device_id, last_sync, last_seen FROM devices WHERE user_id = (SELECT id FROM users WHERE login = $1) ORDER BY last_sync DESC`,
+	)).
+		WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"device_id", "last_sync", "last_seen"}).AddRow("dev1", int64(99), int64(120)))
+
+	if err := service.TouchDevice(context.Background(), "u1", "dev1", 99); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	devices, err := service.GetDevices(context.Background(), "u1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(devices) != 1 || devices[0].ID != "dev1" || devices[0].LastSync != 99 || devices[0].LastSeen != 120 {
+		t.Errorf("unexpected devices: %+v", devices)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRecordAccessAndGetAccessLog(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO secret_access (user_id, secret_id, device_id, accessed_at)`)).
+		WithArgs("u1", pq.Array([]string{"s1", "s2"}), "dev1", int64(99)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT device_id, accessed_at FROM secret_access`)).
+		WithArgs("u1", "s1", 10).
+		WillReturnRows(sqlmock.NewRows([]string{"device_id", "accessed_at"}).
+			AddRow("dev1", int64(99)).
+			AddRow("dev2", int64(50)))
+
+	if err := service.RecordAccess(context.Background(), "u1", "dev1", []string{"s1", "s2"}, 99); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	log, err := service.GetAccessLog(context.Background(), "u1", "s1", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []models.SecretAccess{{DeviceID: "dev1", Time: 99}, {DeviceID: "dev2", Time: 50}}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("access log = %+v; want %+v", log, want)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTouchSeen(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO devices (user_id, device_id, last_seen) VALUES ((SELECT id FROM users WHERE login = $1), $2, $3)
+		ON CONFLICT (user_id, device_id) DO UPDATE SET last_seen = GREATEST(devices.last_seen, EXCLUDED.last_seen)`)).
+		WithArgs("u1", "dev1", int64(120)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := service.TouchSeen(context.Background(), "u1", "dev1", 120); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestSetKDFAndGetKDF(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE users SET kdf = CASE WHEN kdf = '' THEN $2 ELSE kdf END WHERE login = $1 RETURNING kdf`)).
+		WithArgs("u1", `{"salt":"bmV3"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"kdf"}).AddRow(`{"salt":"Zmlyc3Q="}`))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT kdf FROM users WHERE login = $1`)).
+		WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"kdf"}).AddRow(`{"salt":"Zmlyc3Q="}`))
+
+	// The parameters stored first win
+	stored, err := service.SetKDF(context.Background(), "u1", `{"salt":"bmV3"}`)
+	if err != nil || stored != `{"salt":"Zmlyc3Q="}` {
+		t.Fatalf("SetKDF = %q, %v; want the parameters stored first", stored, err)
+	}
+	kdf, err := service.GetKDF(context.Background(), "u1")
+	if err != nil || kdf != stored {
+		t.Errorf("GetKDF = %q, %v; want %q", kdf, err, stored)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetRollback(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT rolled_back_from, rolled_back_at FROM users WHERE login = $1`)).
+		WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"rolled_back_from", "rolled_back_at"}).AddRow(int64(100), int64(200)))
+
+	from, at, err := service.GetRollback(context.Background(), "u1")
+	if err != nil || from != 100 || at != 200 {
+		t.Errorf("GetRollback = %d, %d, %v; want 100, 200", from, at, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// QueryHook observes the SQL statements the repositories send, e.g. to
+// log slow queries or count them. It must be safe for concurrent use.
+type QueryHook interface {
+	// BeforeQuery is called before query is sent. The returned context is
+	// used for the query and passed to AfterQuery, e.g. to carry a span.
+	BeforeQuery(ctx context.Context, query string) context.Context
+	// AfterQuery is called once the database answered query, d after it
+	// was sent, with the error if it failed. For queries returning rows,
+	// d does not include reading the rows.
+	AfterQuery(ctx context.Context, query string, d time.Duration, err error)
+}
+
+// querier is the query interface shared by *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// traced returns q with its queries observed by hook, or q itself if hook
+// is nil.
+func traced(q querier, hook QueryHook) querier {
+	if hook == nil {
+		return q
+	}
+	return tracedQuerier{q: q, hook: hook}
+}
+
+// tracedQuerier reports the queries sent through q to hook.
+type tracedQuerier struct {
+	q    querier
+	hook QueryHook
+}
+
+func (t tracedQuerier) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx = t.hook.BeforeQuery(ctx, query)
+	start := time.Now()
+	res, err := t.q.ExecContext(ctx, query, args...)
+	t.hook.AfterQuery(ctx, query, time.Since(start), err)
+	return res, err
+}
+
+func (t tracedQuerier) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx = t.hook.BeforeQuery(ctx, query)
+	start := time.Now()
+	rows, err := t.q.QueryContext(ctx, query, args...)
+	t.hook.AfterQuery(ctx, query, time.Since(start), err)
+	return rows, err
+}
+
+func (t tracedQuerier) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx = t.hook.BeforeQuery(ctx, query)
+	start := time.Now()
+	row := t.q.QueryRowContext(ctx, query, args...)
+	// sql.ErrNoRows is an answer, not a failure
+	err := row.Err()
+	t.hook.AfterQuery(ctx, query, time.Since(start), err)
+	return row
+}
+
+// QueryStats summarizes the queries observed by a QueryMetrics since it
+// was created.
+type QueryStats struct {
+	// Queries is the number of queries, including failed ones.
+	Queries int64 `json:"queries"`
+	// Errors is the number of failed queries.
+	Errors int64 `json:"errors"`
+	// Slow is the number of queries that took at least the threshold.
+	Slow int64 `json:"slow"`
+	// Total is the time spent in all queries.
+	Total time.Duration `json:"total_ns"`
+	// Max is the time spent in the slowest query.
+	Max time.Duration `json:"max_ns"`
+	// MaxQuery is the slowest query.
+	MaxQuery string `json:"max_query,omitempty"`
+}
+
+// QueryMetrics is a QueryHook counting the queries and logging the slow
+// ones. It is safe for concurrent use.
+type QueryMetrics struct {
+	// Log receives a line per slow query.
+	Log *zap.Logger
+	// SlowThreshold is the duration from which a query is slow. Zero
+	// disables the logging of slow queries.
+	SlowThreshold time.Duration
+
+	mu    sync.Mutex // guards stats
+	stats QueryStats
+}
+
+// BeforeQuery returns ctx.
+func (m *QueryMetrics) BeforeQuery(ctx context.Context, query string) context.Context {
+	return ctx
+}
+
+// AfterQuery counts the query and logs it if it was slow.
+func (m *QueryMetrics) AfterQuery(ctx context.Context, query string, d time.Duration, err error) {
+	slow := m.SlowThreshold > 0 && d >= m.SlowThreshold
+
+	m.mu.Lock()
+	m.stats.Queries++
+	if err != nil {
+		m.stats.Errors++
+	}
+	if slow {
+		m.stats.Slow++
+	}
+	m.stats.Total += d
+	if d > m.stats.Max {
+		m.stats.Max = d
+		m.stats.MaxQuery = compactQuery(query)
+	}
+	m.mu.Unlock()
+
+	if slow {
+		fields := []zap.Field{zap.String("query", compactQuery(query)), zap.Duration("duration", d)}
+		if err != nil {
+			fields = append(fields, zap.Error(err))
+		}
+		m.Log.Warn("slow query", fields...)
+	}
+}
+
+// Stats returns a summary of the queries so far.
+func (m *QueryMetrics) Stats() QueryStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// compactQuery joins the lines of query, which span several indented lines
+// in the source, for logging.
+func compactQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
@@ -0,0 +1,115 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	repo "github.com/atinyakov/GophKeeper/internal/repository"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// recordingHook records the queries it observes.
+type recordingHook struct {
+	mu      sync.Mutex
+	queries []string
+	errs    []error
+}
+
+type hookKey struct{}
+
+func (h *recordingHook) BeforeQuery(ctx context.Context, query string) context.Context {
+	return context.WithValue(ctx, hookKey{}, query)
+}
+
+func (h *recordingHook) AfterQuery(ctx context.Context, query string, d time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ctx.Value(hookKey{}) != query {
+		panic("AfterQuery without the context of BeforeQuery")
+	}
+	h.queries = append(h.queries, strings.Join(strings.Fields(query), " "))
+	h.errs = append(h.errs, err)
+}
+
+func TestQueryHook(t *testing.T) {
+	service, mock, cleanup := setupMock(t)
+	defer cleanup()
+	hook := &recordingHook{}
+	service.Hook = hook
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(MAX(version), 0) FROM secrets`)).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(int64(7)))
+	if _, err := service.GetMaxVersion(ctx, "alice"); err != nil {
+		t.Fatalf("GetMaxVersion: %v", err)
+	}
+
+	fail := errors.New("db fail")
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO devices`)).WillReturnError(fail)
+	if err := service.TouchDevice(ctx, "alice", "laptop", 100); err == nil {
+		t.Fatal("TouchDevice: want error")
+	}
+
+	// Queries in transactions are observed as well
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET login = $2 WHERE login = $1`)).
+		WithArgs("dave", "erin").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	if _, err := service.RenameUser(ctx, "dave", "erin", nil); err == nil {
+		t.Fatal("RenameUser: want error")
+	}
+
+	want := []string{
+		"SELECT COALESCE(MAX(version), 0) FROM secrets WHERE user_id = (SELECT id FROM users WHERE login = $1) AND deleted = false",
+		"INSERT INTO devices (user_id, device_id, last_sync) VALUES ((SELECT id FROM users WHERE login = $1), $2, $3) ON CONFLICT (user_id, device_id) DO UPDATE SET last_sync = EXCLUDED.last_sync",
+		"UPDATE users SET login = $2 WHERE login = $1",
+	}
+	if len(hook.queries) != len(want) {
+		t.Fatalf("observed %q; want %q", hook.queries, want)
+	}
+	for i := range want {
+		if hook.queries[i] != want[i] {
+			t.Errorf("query %d = %q; want %q", i, hook.queries[i], want[i])
+		}
+	}
+	if hook.errs[0] != nil || !errors.Is(hook.errs[1], fail) || hook.errs[2] != nil {
+		t.Errorf("errors = %v; want only the second query failed", hook.errs)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestQueryMetrics(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	m := &repo.QueryMetrics{Log: zap.New(core), SlowThreshold: 100 * time.Millisecond}
+	ctx := context.Background()
+
+	m.AfterQuery(ctx, "SELECT 1", 10*time.Millisecond, nil)
+	m.AfterQuery(ctx, "SELECT 2", 20*time.Millisecond, errors.New("db fail"))
+	m.AfterQuery(ctx, "\n\t\tSELECT *\n\t\tFROM secrets\n\t", 300*time.Millisecond, nil)
+
+	want := repo.QueryStats{
+		Queries:  3,
+		Errors:   1,
+		Slow:     1,
+		Total:    330 * time.Millisecond,
+		Max:      300 * time.Millisecond,
+		MaxQuery: "SELECT * FROM secrets",
+	}
+	if got := m.Stats(); got != want {
+		t.Errorf("Stats() = %+v; want %+v", got, want)
+	}
+	if logs.Len() != 1 || logs.All()[0].ContextMap()["query"] != "SELECT * FROM secrets" {
+		t.Errorf("logged %v; want the slow query", logs.All())
+	}
+}
@@ -0,0 +1,90 @@
+package grpc
+
+import (
+	"encoding/json"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/atinyakov/GophKeeper/internal/pb"
+)
+
+// secretFromPB converts a secret received from a client.
+func secretFromPB(s *pb.Secret) models.Secret {
+	return models.Secret{
+		ID:          s.GetId(),
+		Type:        s.GetType(),
+		Data:        s.GetData(),
+		Name:        s.GetName(),
+		Comment:     s.GetComment(),
+		Folder:      s.GetFolder(),
+		Tags:        s.GetTags(),
+		Version:     s.GetVersion(),
+		Deleted:     s.GetDeleted(),
+		Reprompt:    s.GetReprompt(),
+		ExpiresAt:   s.GetExpiresAt(),
+		BaseVersion: s.GetBaseVersion(),
+	}
+}
+
+// secretToPB converts a secret sent to a client.
+func secretToPB(s models.Secret) *pb.Secret {
+	return &pb.Secret{
+		Id:        s.ID,
+		Type:      s.Type,
+		Data:      s.Data,
+		Name:      s.Name,
+		Comment:   s.Comment,
+		Folder:    s.Folder,
+		Tags:      s.Tags,
+		Version:   s.Version,
+		Deleted:   s.Deleted,
+		Reprompt:  s.Reprompt,
+		ExpiresAt: s.ExpiresAt,
+	}
+}
+
+// filterFromPB converts the filter of a sync; nil syncs the whole vault.
+func filterFromPB(f *pb.SyncFilter) models.SyncFilter {
+	return models.SyncFilter{
+		Folders: f.GetFolders(),
+		Tags:    f.GetTags(),
+		Types:   f.GetTypes(),
+	}
+}
+
+// resultToPB converts the result of http.SyncHandler.Apply, see
+// SyncService.Respond. etag is the vault's ETag, if known.
+func resultToPB(result map[string]any, etag string) *pb.SyncResult {
+	version, _ := result["version"].(int64)
+	updated, _ := result["updated"].([]string)
+	skipped, _ := result["skipped"].([]string)
+	restored, _ := result["restored"].([]string)
+	conflicts, _ := result["conflicts"].([]models.Conflict)
+	kdf, _ := result["kdf"].(json.RawMessage)
+	r := &pb.SyncResult{Version: version, Updated: updated, Skipped: skipped, Restored: restored, Etag: etag, Kdf: string(kdf)}
+	for _, c := range conflicts {
+		pc := &pb.Conflict{
+			Id:             c.ID,
+			Version:        c.Version,
+			ServerVersion:  c.ServerVersion,
+			ServerModified: c.ServerModified,
+			Concurrent:     c.Concurrent,
+			Changed:        c.Changed,
+		}
+		if c.Client != nil {
+			pc.Client = secretToPB(*c.Client)
+		}
+		if c.Server != nil {
+			pc.Server = secretToPB(*c.Server)
+		}
+		r.Conflicts = append(r.Conflicts, pc)
+	}
+	if summary, ok := result["summary"].(models.VaultSummary); ok {
+		r.Summary = &pb.VaultSummary{
+			Types:      summary.Types,
+			Folders:    summary.Folders,
+			Tags:       summary.Tags,
+			TotalBytes: summary.TotalBytes,
+		}
+	}
+	return r
+}
@@ -0,0 +1,395 @@
+// Package grpc serves the gRPC API of GophKeeper, see pb.GophKeeperServer.
+// It is served on the listeners of the HTTP API, see Handler, and shares
+// its handlers, so that both APIs behave the same: the same guards,
+// limits, access log and watch events apply.
+package grpc
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	nethttp "net/http"
+
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/atinyakov/GophKeeper/internal/pb"
+	"github.com/atinyakov/GophKeeper/internal/problem"
+	"github.com/atinyakov/GophKeeper/internal/server/handler/http"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Option customizes the server built by NewServer.
+type Option func(*service)
+
+// WithCertBinding accepts client certificates only if v has them on record
+// for the user they name, see middleware.CertBinding.
+func WithCertBinding(v middleware.CertificateValidator) Option {
+	return func(s *service) {
+		s.certs = v
+	}
+}
+
+// WithLastSeen records every authenticated sync with rec, see
+// middleware.LastSeen.
+func WithLastSeen(rec middleware.SeenRecorder) Option {
+	return func(s *service) {
+		s.seen = rec
+	}
+}
+
+// WithSyncConcurrency serves at most n syncs of each user at a time, see
+// middleware.ConcurrencyLimit. They are counted apart from the syncs of
+// the HTTP API.
+func WithSyncConcurrency(n int) Option {
+	return func(s *service) {
+		if n > 0 {
+			s.syncs = middleware.NewLimiter(n)
+		}
+	}
+}
+
+// service implements pb.GophKeeperServer on top of the HTTP handlers.
+type service struct {
+	pb.UnimplementedGophKeeperServer
+
+	auth *http.AuthHandler
+	sync *http.SyncHandler // nil on registration-only servers
+
+	certs middleware.CertificateValidator
+	seen  middleware.SeenRecorder
+	syncs *middleware.Limiter
+}
+
+// NewServer returns a gRPC server of the GophKeeper API, serving Register
+// like POST /api/register, Login like POST /api/login, Sync like POST
+// /api/sync and Watch like GET /api/sync/watch, pushing the secrets along.
+// Calls are logged with logger.
+//
+// Syncs are authenticated like requests of the HTTP API: by an
+// "authorization: Bearer <token>" metadata entry or the TLS client
+// certificate.
+func NewServer(authHandler *http.AuthHandler, syncHandler *http.SyncHandler, logger *zap.Logger, opts ...Option) *grpc.Server {
+	s := &service{auth: authHandler, sync: syncHandler}
+	for _, opt := range opts {
+		opt(s)
+	}
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryLogging(logger)),
+		grpc.ChainStreamInterceptor(streamLogging(logger)),
+	)
+	pb.RegisterGophKeeperServer(srv, s)
+	return srv
+}
+
+// NewRegisterServer returns a gRPC server that serves only Register, for
+// the listener of NewRegisterRouter. Other calls fail with Unimplemented.
+func NewRegisterServer(authHandler *http.AuthHandler, logger *zap.Logger) *grpc.Server {
+	return NewServer(authHandler, nil, logger)
+}
+
+// Handler returns a handler serving gRPC requests, i.e. HTTP/2 requests
+// of the content type application/grpc, with srv and other requests with
+// next. It lets the gRPC and the HTTP API share a listener.
+func Handler(srv *grpc.Server, next nethttp.Handler) nethttp.Handler {
+	return nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			srv.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Register enrolls a device, see http.AuthHandler.Enroll.
+func (s *service) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	var cert *x509.Certificate
+	if tlsInfo, ok := peerTLS(ctx); ok && len(tlsInfo.State.VerifiedChains) > 0 && len(tlsInfo.State.PeerCertificates) > 0 {
+		cert = tlsInfo.State.PeerCertificates[0]
+	}
+	enrollment, challenge, err := s.auth.Enroll(ctx, peerIP(ctx), http.RegisterRequest{
+		Login:     req.GetLogin(),
+		Challenge: req.GetChallenge(),
+		Solution:  req.GetSolution(),
+	}, cert)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		return &pb.RegisterResponse{Challenge: &pb.Challenge{
+			Challenge:  challenge.Challenge,
+			Difficulty: int32(challenge.Difficulty),
+		}}, nil
+	}
+	return &pb.RegisterResponse{
+		Cert:          enrollment.Cert,
+		Key:           enrollment.Key,
+		Token:         enrollment.Token,
+		RecoveryCodes: enrollment.RecoveryCodes,
+	}, nil
+}
+
+// Login reports the user of the client certificate, see
+// http.AuthHandler.CertificateLogin.
+func (s *service) Login(ctx context.Context, _ *pb.LoginRequest) (*pb.LoginResponse, error) {
+	if s.sync == nil {
+		return s.UnimplementedGophKeeperServer.Login(ctx, nil)
+	}
+	login, err := s.auth.CertificateLogin(ctx, peerCertificate(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.LoginResponse{User: login}, nil
+}
+
+// Sync syncs the vault of the authenticated user, see
+// http.SyncHandler.Apply. Uploaded secrets are applied in batches as they
+// arrive, see http.SyncHandler.Upload, and a rejected one ends the call
+// before the rest is read.
+func (s *service) Sync(stream pb.GophKeeper_SyncServer) error {
+	if s.sync == nil {
+		return s.UnimplementedGophKeeperServer.Sync(stream)
+	}
+	ctx, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	if s.syncs != nil {
+		release, ok := s.syncs.Acquire(middleware.GetUserIDFromContext(ctx))
+		if !ok {
+			p := problem.New(nethttp.StatusTooManyRequests, problem.CodeTooManyRequests, "too many concurrent requests")
+			p.RetryAfter = time.Second
+			return p
+		}
+		defer release()
+	}
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	opts := first.GetOptions()
+	if opts == nil {
+		return problem.New(nethttp.StatusBadRequest, problem.CodeInvalidRequest, "sync must start with its options")
+	}
+	req := http.SyncRequest{
+		Versions:         opts.GetVersions(),
+		LastKnownVersion: opts.GetLastKnownVersion(),
+		Filter:           filterFromPB(opts.GetFilter()),
+		IncludeDeleted:   opts.GetIncludeDeleted(),
+		KDF:              opts.GetKdf(),
+	}
+	if req.KDF != "" {
+		if err := http.CheckKDF(req.KDF); err != nil {
+			return err
+		}
+	}
+	batch := make([]models.Secret, 0, http.UploadBatchSize)
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		sec := msg.GetSecret()
+		if sec == nil {
+			return problem.New(nethttp.StatusBadRequest, problem.CodeInvalidRequest, "options sent twice")
+		}
+		if batch = append(batch, secretFromPB(sec)); len(batch) == http.UploadBatchSize {
+			if err := s.sync.Upload(ctx, &req, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := s.sync.Upload(ctx, &req, batch); err != nil {
+		return err
+	}
+
+	// Answer polls of clients that are up to date without secrets
+	etag, unchanged := s.sync.Unchanged(ctx, req, opts.GetIfNoneMatch())
+	if unchanged {
+		return stream.Send(&pb.SyncResponse{Message: &pb.SyncResponse_Result{
+			Result: &pb.SyncResult{Etag: etag, NotModified: true},
+		}})
+	}
+
+	result, err := s.sync.Apply(ctx, req, func(sec models.Secret) error {
+		return stream.Send(&pb.SyncResponse{Message: &pb.SyncResponse_Secret{Secret: secretToPB(sec)}})
+	})
+	if err != nil {
+		return problem.Internal(err.Error())
+	}
+	return stream.Send(&pb.SyncResponse{Message: &pb.SyncResponse_Result{Result: resultToPB(result, etag)}})
+}
+
+// Watch pushes the changes the user's other devices make to the vault,
+// see http.SyncHandler.Subscribe and Push. The stream starts with the etag
+// of the vault and is not counted against the sync concurrency limit.
+func (s *service) Watch(req *pb.WatchRequest, stream pb.GophKeeper_WatchServer) error {
+	if s.sync == nil {
+		return s.UnimplementedGophKeeperServer.Watch(req, stream)
+	}
+	ctx, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	userID := middleware.GetUserIDFromContext(ctx)
+	filter := filterFromPB(req.GetFilter())
+	sub, unsubscribe := s.sync.Subscribe(ctx)
+	defer unsubscribe()
+
+	// The etag is taken before the changes, so that a change it covers is
+	// always pushed after it
+	etag, err := s.sync.SyncService.ETag(ctx, userID, filter)
+	if err != nil {
+		return problem.Internal(err.Error())
+	}
+	if err := stream.Send(&pb.WatchEvent{Message: &pb.WatchEvent_Change{Change: &pb.WatchChange{Etag: etag}}}); err != nil {
+		return err
+	}
+	heartbeat := time.NewTicker(http.WatchHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-heartbeat.C:
+			if err := stream.Send(&pb.WatchEvent{}); err != nil {
+				return err
+			}
+			continue
+		case <-sub.Ready():
+		}
+		if etag, err = s.sync.SyncService.ETag(ctx, userID, filter); err != nil {
+			return problem.Internal(err.Error())
+		}
+		c := sub.Take()
+		if len(c.IDs) == 0 && !c.Resync {
+			continue
+		}
+		if !c.Resync {
+			err = s.sync.Push(ctx, c.IDs, filter, func(sec models.Secret) error {
+				return stream.Send(&pb.WatchEvent{Message: &pb.WatchEvent_Secret{Secret: secretToPB(sec)}})
+			})
+			if err != nil {
+				return problem.Internal(err.Error())
+			}
+		}
+		change := &pb.WatchChange{Etag: etag, Resync: c.Resync}
+		if err := stream.Send(&pb.WatchEvent{Message: &pb.WatchEvent_Change{Change: change}}); err != nil {
+			return err
+		}
+	}
+}
+
+// authenticate returns ctx authenticated like the HTTP API authenticates
+// requests with middleware.TokenAuth, CertAuth, CertBinding and LastSeen.
+// Errors are *problem.Error.
+func (s *service) authenticate(ctx context.Context) (context.Context, error) {
+	var login, device, lease string
+	if header := metadata.ValueFromIncomingContext(ctx, "authorization"); len(header) > 0 {
+		token, ok := strings.CutPrefix(header[0], "Bearer ")
+		if !ok || token == "" {
+			return nil, problem.New(nethttp.StatusUnauthorized, problem.CodeInvalidToken, "invalid authorization header")
+		}
+		var err error
+		login, lease, err = s.auth.AuthService.AuthenticateToken(ctx, token)
+		if err != nil || login == "" {
+			return nil, problem.New(nethttp.StatusUnauthorized, problem.CodeInvalidToken, "invalid token")
+		}
+		device = middleware.TokenDeviceID
+	} else {
+		cert := peerCertificate(ctx)
+		if cert == nil {
+			return nil, problem.New(nethttp.StatusUnauthorized, problem.CodeCertificateRequired, "no client certificate provided")
+		}
+		login = cert.Subject.CommonName
+		if cert.SerialNumber != nil {
+			device = cert.SerialNumber.Text(16)
+		}
+		if s.certs != nil {
+			if err := s.certs.CheckCertificate(ctx, login, cert); err != nil {
+				return nil, problem.New(nethttp.StatusUnauthorized, problem.CodeUnauthorized, "client certificate not accepted")
+			}
+		}
+	}
+	if s.seen != nil && device != "" {
+		_ = s.seen.RecordSeen(ctx, login, device)
+	}
+	return middleware.WithIdentity(ctx, login, device, lease), nil
+}
+
+// peerTLS returns the TLS connection state of the client of ctx.
+func peerTLS(ctx context.Context) (credentials.TLSInfo, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return credentials.TLSInfo{}, false
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	return tlsInfo, ok
+}
+
+// peerCertificate returns the client certificate of ctx, or nil if the
+// client presented none.
+func peerCertificate(ctx context.Context) *x509.Certificate {
+	tlsInfo, ok := peerTLS(ctx)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return nil
+	}
+	return tlsInfo.State.PeerCertificates[0]
+}
+
+// peerIP returns the IP address of the client of ctx.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// unaryLogging logs each unary call with logger, like
+// middleware.WithRequestLogging logs HTTP requests.
+func unaryLogging(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(logger, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// streamLogging logs each streaming call with logger.
+func streamLogging(logger *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(logger, info.FullMethod, start, err)
+		return err
+	}
+}
+
+// logCall logs a call of method started at start that ended with err.
+func logCall(logger *zap.Logger, method string, start time.Time, err error) {
+	logger.Info("gRPC Request",
+		zap.String("method", method),
+		zap.String("code", status.Code(err).String()),
+		zap.Duration("duration", time.Since(start)),
+	)
+}
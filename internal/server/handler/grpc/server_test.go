@@ -0,0 +1,448 @@
+package grpc_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/limits"
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/atinyakov/GophKeeper/internal/pb"
+	"github.com/atinyakov/GophKeeper/internal/pow"
+	"github.com/atinyakov/GophKeeper/internal/problem"
+	handler "github.com/atinyakov/GophKeeper/internal/server/handler/grpc"
+	httphandler "github.com/atinyakov/GophKeeper/internal/server/handler/http"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeAuthService implements http.AuthService, accepting the bearer token
+// "good" of the user "alice".
+type fakeAuthService struct{}
+
+func (fakeAuthService) UserExists(context.Context, string) (bool, error) { return false, nil }
+func (fakeAuthService) NormalizeLogin(login string) (string, error)      { return login, nil }
+func (fakeAuthService) RegisterUser(context.Context, string) error       { return nil }
+func (fakeAuthService) IssueToken(context.Context, string) (string, error) {
+	return "good", nil
+}
+func (fakeAuthService) AuthenticateToken(_ context.Context, token string) (string, string, error) {
+	if token != "good" {
+		return "", "", errors.New("invalid token")
+	}
+	return "alice", "lease1", nil
+}
+func (fakeAuthService) IssueLease(context.Context, string, time.Duration) (string, *models.Lease, error) {
+	return "", nil, errors.New("not implemented")
+}
+func (fakeAuthService) Leases(context.Context, string) ([]models.Lease, error) { return nil, nil }
+func (fakeAuthService) RenewLease(context.Context, string, string, time.Duration) (*models.Lease, error) {
+	return nil, errors.New("not implemented")
+}
+func (fakeAuthService) RevokeLease(context.Context, string, string) error { return nil }
+func (fakeAuthService) IssueRecoveryCodes(context.Context, string) ([]string, error) {
+	return nil, nil
+}
+func (fakeAuthService) RedeemRecoveryCode(context.Context, string, string) (bool, error) {
+	return false, nil
+}
+func (fakeAuthService) BindCertificate(context.Context, string, []byte, bool) error { return nil }
+func (fakeAuthService) ReplaceCertificate(context.Context, string, *x509.Certificate, []byte) error {
+	return nil
+}
+func (fakeAuthService) CheckCertificate(context.Context, string, *x509.Certificate) error {
+	return nil
+}
+
+// fakeSyncService implements http.SyncService, returning secrets and
+// recording the sync it was asked for.
+type fakeSyncService struct {
+	secrets    []models.Secret
+	tombstones []models.Secret
+
+	userID    string
+	device    string
+	lease     string
+	uploaded  []models.Secret
+	versions  map[string]int64
+	lastKnown int64
+	filter    models.SyncFilter
+	etag      string
+	kdf       string
+}
+
+func (f *fakeSyncService) Upload(ctx context.Context, userID string, secrets []models.Secret, lastKnown int64, res *models.UploadResult) error {
+	f.uploaded, f.lastKnown = append(f.uploaded, secrets...), lastKnown
+	for _, s := range secrets {
+		res.Updated = append(res.Updated, s.ID)
+	}
+	return nil
+}
+
+func (f *fakeSyncService) Respond(ctx context.Context, userID string, uploaded models.UploadResult, versions map[string]int64, filter models.SyncFilter, emit func(models.Secret) error) (map[string]any, error) {
+	f.userID = userID
+	f.device = middleware.GetDeviceIDFromContext(ctx)
+	f.lease = middleware.GetLeaseIDFromContext(ctx)
+	f.versions, f.filter = versions, filter
+	for _, s := range f.secrets {
+		if err := emit(s); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]any{
+		"version": int64(7),
+		"updated": uploaded.Updated,
+		"skipped": []string(nil),
+		"conflicts": []models.Conflict{
+			{ID: "c", Version: 2, ServerVersion: 3},
+			{ID: "d", Version: 5, ServerVersion: 6, Concurrent: true,
+				Client:  &models.Secret{ID: "d", Data: "mine", Version: 5},
+				Server:  &models.Secret{ID: "d", Data: "theirs", Version: 6},
+				Changed: []string{"folder"}},
+		},
+		"summary": models.VaultSummary{Types: map[string]int64{"text": 3}, Folders: map[string]int64{"work": 1}, TotalBytes: 90},
+	}, nil
+}
+
+func (f *fakeSyncService) RecordSync(context.Context, string, string) error { return nil }
+func (f *fakeSyncService) Changes(_ context.Context, _ string, ids []string, _ models.SyncFilter, emit func(models.Secret) error) error {
+	for _, s := range f.secrets {
+		if !slices.Contains(ids, s.ID) {
+			continue
+		}
+		if err := emit(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (f *fakeSyncService) Stats(context.Context, string) (*models.Stats, error) {
+	return &models.Stats{}, nil
+}
+func (f *fakeSyncService) ETag(context.Context, string, models.SyncFilter) (string, error) {
+	if f.etag == "" {
+		return "", errors.New("no etag")
+	}
+	return f.etag, nil
+}
+func (f *fakeSyncService) Tombstones(context.Context, string, map[string]int64) ([]models.Secret, error) {
+	return f.tombstones, nil
+}
+func (f *fakeSyncService) Purge(context.Context, string, []string) ([]string, error) {
+	return nil, nil
+}
+func (f *fakeSyncService) RecordAccess(context.Context, string, string, []string) error { return nil }
+func (f *fakeSyncService) AccessLog(context.Context, string, string) ([]models.SecretAccess, error) {
+	return nil, nil
+}
+func (f *fakeSyncService) Import(context.Context, string, func() (models.Secret, error)) (models.ImportResult, error) {
+	return models.ImportResult{}, nil
+}
+func (f *fakeSyncService) VaultKDF(_ context.Context, _ string, kdf string) (string, error) {
+	if f.kdf == "" {
+		f.kdf = kdf
+	}
+	return f.kdf, nil
+}
+
+// fakeChallenges implements http.ChallengeIssuer.
+type fakeChallenges struct{}
+
+func (fakeChallenges) Issue() pow.Challenge {
+	return pow.Challenge{Challenge: "c1", Difficulty: 8}
+}
+func (fakeChallenges) Verify(challenge, solution string) error {
+	return errors.New("wrong solution")
+}
+
+// dial serves srv over HTTP/2 with TLS like the server does, see
+// handler.Handler, and returns a client of it.
+func dial(t *testing.T, srv *grpc.Server) pb.GophKeeperClient {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(handler.Handler(srv, http.NotFoundHandler()))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	conn, err := grpc.NewClient("passthrough:///"+ts.Listener.Addr().String(),
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: roots, ServerName: "example.com"})))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return pb.NewGophKeeperClient(conn)
+}
+
+// requireProblem checks that err is a gRPC status of the given code
+// carrying the HTTP status and problem code of the HTTP API.
+func requireProblem(t *testing.T, err error, code codes.Code, httpStatus int, problemCode string) {
+	t.Helper()
+	s, ok := status.FromError(err)
+	require.True(t, ok, "not a status: %v", err)
+	require.Equal(t, code, s.Code(), s.Message())
+	require.Len(t, s.Details(), 1)
+	p, ok := s.Details()[0].(*pb.Problem)
+	require.True(t, ok, "detail %T", s.Details()[0])
+	require.EqualValues(t, httpStatus, p.GetStatus())
+	require.Equal(t, problemCode, p.GetCode())
+}
+
+func TestServer_Sync(t *testing.T) {
+	sync := &fakeSyncService{
+		secrets: []models.Secret{
+			{ID: "a", Type: "text", Data: "x", Version: 5, Tags: []string{"t"}},
+			{ID: "b", Version: 6, Deleted: true},
+		},
+		tombstones: []models.Secret{{ID: "c", Version: 1, Deleted: true}},
+	}
+	client := dial(t, handler.NewServer(
+		&httphandler.AuthHandler{AuthService: fakeAuthService{}},
+		&httphandler.SyncHandler{SyncService: sync},
+		zap.NewNop(),
+	))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer good")
+	stream, err := client.Sync(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.SyncRequest{Message: &pb.SyncRequest_Options{Options: &pb.SyncOptions{
+		Versions:         map[string]int64{"a": 1},
+		Filter:           &pb.SyncFilter{Folders: []string{"work"}},
+		IncludeDeleted:   true,
+		LastKnownVersion: 4,
+		Kdf:              `{"salt":"c2FsdA=="}`,
+	}}}))
+	require.NoError(t, stream.Send(&pb.SyncRequest{Message: &pb.SyncRequest_Secret{Secret: &pb.Secret{
+		Id: "up", Type: "text", Data: "y", Version: 2,
+	}}}))
+	require.NoError(t, stream.CloseSend())
+
+	var (
+		got    []string
+		result *pb.SyncResult
+	)
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		if sec := msg.GetSecret(); sec != nil {
+			got = append(got, sec.GetId())
+		} else {
+			result = msg.GetResult()
+		}
+	}
+
+	require.Equal(t, []string{"a", "b", "c"}, got)
+	require.NotNil(t, result)
+	require.EqualValues(t, 7, result.GetVersion())
+	require.Equal(t, []string{"up"}, result.GetUpdated())
+	require.Len(t, result.GetConflicts(), 2)
+	require.EqualValues(t, 3, result.GetConflicts()[0].GetServerVersion())
+	concurrent := result.GetConflicts()[1]
+	require.True(t, concurrent.GetConcurrent())
+	require.Equal(t, "mine", concurrent.GetClient().GetData())
+	require.Equal(t, "theirs", concurrent.GetServer().GetData())
+	require.Equal(t, []string{"folder"}, concurrent.GetChanged())
+	require.Equal(t, map[string]int64{"text": 3}, result.GetSummary().GetTypes())
+	require.Equal(t, map[string]int64{"work": 1}, result.GetSummary().GetFolders())
+	require.EqualValues(t, 90, result.GetSummary().GetTotalBytes())
+	require.Equal(t, `{"salt":"c2FsdA=="}`, result.GetKdf())
+
+	require.Equal(t, "alice", sync.userID)
+	require.Equal(t, middleware.TokenDeviceID, sync.device)
+	require.Equal(t, "lease1", sync.lease)
+	require.Equal(t, map[string]int64{"a": 1}, sync.versions)
+	require.EqualValues(t, 4, sync.lastKnown)
+	require.Equal(t, []string{"work"}, sync.filter.Folders)
+	require.Len(t, sync.uploaded, 1)
+	require.Equal(t, "y", sync.uploaded[0].Data)
+}
+
+func TestServer_SyncNotModified(t *testing.T) {
+	sync := &fakeSyncService{etag: `"v7"`}
+	client := dial(t, handler.NewServer(
+		&httphandler.AuthHandler{AuthService: fakeAuthService{}},
+		&httphandler.SyncHandler{SyncService: sync},
+		zap.NewNop(),
+	))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer good")
+	stream, err := client.Sync(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.SyncRequest{Message: &pb.SyncRequest_Options{Options: &pb.SyncOptions{IfNoneMatch: `"v7"`}}}))
+	require.NoError(t, stream.CloseSend())
+
+	msg, err := stream.Recv()
+	require.NoError(t, err)
+	require.True(t, msg.GetResult().GetNotModified())
+	require.Equal(t, `"v7"`, msg.GetResult().GetEtag())
+	_, err = stream.Recv()
+	require.ErrorIs(t, err, io.EOF)
+	require.Empty(t, sync.userID, "sync performed")
+}
+
+func TestServer_Watch(t *testing.T) {
+	sync := &fakeSyncService{
+		secrets: []models.Secret{
+			{ID: "a", Type: "text", Data: "x", Version: 5},
+			{ID: "b", Version: 6, Deleted: true},
+			{ID: "c", Type: "text", Data: "z", Version: 2},
+		},
+		etag: `"v7"`,
+	}
+	syncHandler := &httphandler.SyncHandler{SyncService: sync}
+	client := dial(t, handler.NewServer(
+		&httphandler.AuthHandler{AuthService: fakeAuthService{}},
+		syncHandler,
+		zap.NewNop(),
+	))
+
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer good"))
+	defer cancel()
+	stream, err := client.Watch(ctx, &pb.WatchRequest{})
+	require.NoError(t, err)
+	// The stream starts with the etag of the vault as it is
+	msg, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, `"v7"`, msg.GetChange().GetEtag())
+
+	// Another device of alice uploads two secrets
+	phone := middleware.WithIdentity(context.Background(), "alice", "phone", "")
+	req := &httphandler.SyncRequest{}
+	require.NoError(t, syncHandler.Upload(phone, req, []models.Secret{
+		{ID: "a", Type: "text", Data: "x", Version: 5},
+		{ID: "b", Version: 6, Deleted: true},
+	}))
+
+	var got []string
+	for {
+		msg, err := stream.Recv()
+		require.NoError(t, err)
+		if sec := msg.GetSecret(); sec != nil {
+			got = append(got, sec.GetId())
+			continue
+		}
+		require.NotNil(t, msg.GetChange(), "heartbeat before the change")
+		require.Equal(t, `"v7"`, msg.GetChange().GetEtag())
+		require.False(t, msg.GetChange().GetResync())
+		break
+	}
+	require.Equal(t, []string{"a", "b"}, got)
+}
+
+func TestServer_SyncErrors(t *testing.T) {
+	client := dial(t, handler.NewServer(
+		&httphandler.AuthHandler{AuthService: fakeAuthService{}},
+		&httphandler.SyncHandler{SyncService: &fakeSyncService{}},
+		zap.NewNop(),
+	))
+
+	sync := func(ctx context.Context, msgs ...*pb.SyncRequest) error {
+		stream, err := client.Sync(ctx)
+		require.NoError(t, err)
+		for _, m := range msgs {
+			require.NoError(t, stream.Send(m))
+		}
+		require.NoError(t, stream.CloseSend())
+		_, err = stream.Recv()
+		return err
+	}
+	options := &pb.SyncRequest{Message: &pb.SyncRequest_Options{Options: &pb.SyncOptions{}}}
+	authorized := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer good")
+
+	t.Run("no credentials", func(t *testing.T) {
+		err := sync(context.Background(), options)
+		requireProblem(t, err, codes.Unauthenticated, http.StatusUnauthorized, problem.CodeCertificateRequired)
+	})
+	t.Run("invalid token", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer bad")
+		err := sync(ctx, options)
+		requireProblem(t, err, codes.Unauthenticated, http.StatusUnauthorized, problem.CodeInvalidToken)
+	})
+	t.Run("no options", func(t *testing.T) {
+		err := sync(authorized, &pb.SyncRequest{Message: &pb.SyncRequest_Secret{Secret: &pb.Secret{Id: "a"}}})
+		requireProblem(t, err, codes.InvalidArgument, http.StatusBadRequest, problem.CodeInvalidRequest)
+	})
+	t.Run("future version", func(t *testing.T) {
+		err := sync(authorized, options, &pb.SyncRequest{Message: &pb.SyncRequest_Secret{Secret: &pb.Secret{
+			Id: "a", Type: "text", Version: time.Now().Add(2 * limits.MaxVersionSkew).Unix(),
+		}}})
+		requireProblem(t, err, codes.InvalidArgument, http.StatusUnprocessableEntity, limits.FutureVersionCode)
+	})
+	t.Run("rejected after a batch", func(t *testing.T) {
+		fake := &fakeSyncService{}
+		client := dial(t, handler.NewServer(
+			&httphandler.AuthHandler{AuthService: fakeAuthService{}},
+			&httphandler.SyncHandler{SyncService: fake},
+			zap.NewNop(),
+		))
+		stream, err := client.Sync(authorized)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(options))
+		for i := range httphandler.UploadBatchSize {
+			require.NoError(t, stream.Send(&pb.SyncRequest{Message: &pb.SyncRequest_Secret{Secret: &pb.Secret{
+				Id: fmt.Sprintf("s%d", i), Type: "text", Version: 1,
+			}}}))
+		}
+		require.NoError(t, stream.Send(&pb.SyncRequest{Message: &pb.SyncRequest_Secret{Secret: &pb.Secret{
+			Id: "late", Type: "text", Version: time.Now().Add(2 * limits.MaxVersionSkew).Unix(),
+		}}}))
+		require.NoError(t, stream.CloseSend())
+		_, err = stream.Recv()
+		requireProblem(t, err, codes.InvalidArgument, http.StatusUnprocessableEntity, limits.FutureVersionCode)
+		// The first batch was applied as it arrived
+		require.Len(t, fake.uploaded, httphandler.UploadBatchSize)
+		require.Empty(t, fake.userID, "sync answered")
+	})
+	t.Run("invalid kdf", func(t *testing.T) {
+		err := sync(authorized, &pb.SyncRequest{Message: &pb.SyncRequest_Options{Options: &pb.SyncOptions{Kdf: "salt"}}})
+		requireProblem(t, err, codes.InvalidArgument, http.StatusBadRequest, problem.CodeInvalidRequest)
+	})
+}
+
+func TestServer_Register(t *testing.T) {
+	auth := &httphandler.AuthHandler{AuthService: fakeAuthService{}, Challenges: fakeChallenges{}}
+	client := dial(t, handler.NewRegisterServer(auth, zap.NewNop()))
+
+	resp, err := client.Register(context.Background(), &pb.RegisterRequest{Login: "alice"})
+	require.NoError(t, err)
+	require.Equal(t, "c1", resp.GetChallenge().GetChallenge())
+	require.EqualValues(t, 8, resp.GetChallenge().GetDifficulty())
+	require.Empty(t, resp.GetCert())
+
+	_, err = client.Register(context.Background(), &pb.RegisterRequest{Login: "alice", Challenge: "c1", Solution: "s"})
+	requireProblem(t, err, codes.InvalidArgument, http.StatusBadRequest, problem.CodeChallengeFailed)
+
+	_, err = client.Register(context.Background(), &pb.RegisterRequest{})
+	requireProblem(t, err, codes.InvalidArgument, http.StatusBadRequest, problem.CodeInvalidRequest)
+
+	// Registration-only servers serve nothing else
+	_, err = client.Login(context.Background(), &pb.LoginRequest{})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestServer_LoginWithoutCertificate(t *testing.T) {
+	client := dial(t, handler.NewServer(
+		&httphandler.AuthHandler{AuthService: fakeAuthService{}},
+		&httphandler.SyncHandler{SyncService: &fakeSyncService{}},
+		zap.NewNop(),
+	))
+
+	_, err := client.Login(context.Background(), &pb.LoginRequest{})
+	requireProblem(t, err, codes.Unauthenticated, http.StatusUnauthorized, problem.CodeCertificateRequired)
+}
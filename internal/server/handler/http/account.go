@@ -0,0 +1,111 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/atinyakov/GophKeeper/internal/certgen"
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/atinyakov/GophKeeper/internal/problem"
+)
+
+// AccountService manages the accounts of users, see
+// service.AccountService.
+type AccountService interface {
+	// NormalizeLogin validates a login against the login policy and
+	// returns its canonical form.
+	NormalizeLogin(string) (string, error)
+	// RenameUser changes the login of a user, replacing its certificates
+	// with certPEM issued for the new login, and returns the new login and
+	// the number of certificates revoked.
+	RenameUser(ctx context.Context, from, to string, certPEM []byte) (string, int64, error)
+}
+
+// AccountHandler serves the account of the authenticated user.
+type AccountHandler struct {
+	AccountService AccountService
+}
+
+// Rename handles POST /api/account/rename requests.
+// It expects {"login": "<new login>"} and renames the authenticated user.
+// A certificate naming the new login is issued for the public key of the
+// presented client certificate, so the client keeps its key. In the same
+// transaction as the rename it replaces the certificates of the user,
+// which name the old login: those of the user's other devices are revoked
+// as well, and the devices must be enrolled again with the new
+// certificate. API tokens and sessions keep working. The response carries
+// the new login in canonical form, the certificate and the number of
+// certificates revoked, the presented one included, as
+// {"login", "cert", "revoked"}.
+//
+// Requests authenticated with an API token or a browser session have no
+// key to certify and are refused with 403 Forbidden.
+//
+// Responses: 422 for a new login violating the login policy and 409 for a
+// new login in use, including the current one.
+func (h *AccountHandler) Rename(w http.ResponseWriter, r *http.Request) {
+	login := middleware.GetUserIDFromContext(r.Context())
+	if login == "" {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "unauthorized")
+		return
+	}
+	device := middleware.GetDeviceIDFromContext(r.Context())
+	if device == middleware.TokenDeviceID || device == middleware.SessionDeviceID ||
+		r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		problem.Write(w, r, http.StatusForbidden, problem.CodeCertificateRequired, "renaming requires a client certificate")
+		return
+	}
+	var req struct {
+		Login string `json:"login"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "invalid request body")
+		return
+	}
+	renameUser(w, r, h.AccountService, login, req.Login, r.TLS.PeerCertificates[0].PublicKey)
+}
+
+// renameUser renames the user from to to, certifying pub for the new
+// login, and writes the response, see AccountHandler.Rename. Unknown users
+// are answered with 404 Not Found.
+func renameUser(w http.ResponseWriter, r *http.Request, accounts AccountService, from, to string, pub any) {
+	to, err := accounts.NormalizeLogin(to)
+	if err != nil {
+		problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeInvalidLogin, err.Error())
+		return
+	}
+
+	caCert, caKey, err := certgen.LoadCACredentials("certs/ca.crt", "certs/ca.key")
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "failed to load CA")
+		return
+	}
+	certPEM, err := certgen.IssueUserCertificate(to, pub, caCert, caKey)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "failed to issue certificate")
+		return
+	}
+
+	to, revoked, err := accounts.RenameUser(r.Context(), from, to, certPEM)
+	switch {
+	case errors.Is(err, models.ErrUserNotFound):
+		problem.Write(w, r, http.StatusNotFound, problem.CodeUserNotFound, "user not found")
+		return
+	case errors.Is(err, models.ErrLoginTaken):
+		problem.Write(w, r, http.StatusConflict, problem.CodeUserExists, "login is taken")
+		return
+	case err != nil:
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "internal error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"login":   to,
+		"cert":    string(certPEM),
+		"revoked": revoked,
+	})
+}
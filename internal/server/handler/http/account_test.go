@@ -0,0 +1,177 @@
+package http_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	handler "github.com/atinyakov/GophKeeper/internal/server/handler/http"
+)
+
+// fakeAccounts knows the users alice and bob and lowercases new logins.
+type fakeAccounts struct{}
+
+func (fakeAccounts) NormalizeLogin(login string) (string, error) {
+	if login == "" {
+		return "", errors.New("login is empty")
+	}
+	return strings.ToLower(login), nil
+}
+
+// Each user has two certificates, so renames revoke 2.
+func (f fakeAccounts) RenameUser(_ context.Context, from, to string, _ []byte) (string, int64, error) {
+	to, _ = f.NormalizeLogin(to)
+	switch {
+	case from != "alice" && from != "bob":
+		return "", 0, models.ErrUserNotFound
+	case to == "alice" || to == "bob":
+		return "", 0, models.ErrLoginTaken
+	}
+	return to, 2, nil
+}
+
+// userCert returns a self-signed certificate naming login and its PEM
+// encoding.
+func userCert(t *testing.T, login string) (*x509.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(7), Subject: pkix.Name{CommonName: login}}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// withTestCA runs the test in a temporary directory holding a CA in
+// certs/, where the handlers issue certificates from.
+func withTestCA(t *testing.T) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "certs"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for name, block := range map[string]*pem.Block{
+		"ca.crt": {Type: "CERTIFICATE", Bytes: der},
+		"ca.key": {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(filepath.Join(dir, "certs", name), pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+// renamed decodes a rename response into the new login and the issued
+// certificate.
+func renamed(t *testing.T, rec *httptest.ResponseRecorder) (string, *x509.Certificate) {
+	t.Helper()
+	var resp struct {
+		Login, Cert string
+		Revoked     int64
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	block, _ := pem.Decode([]byte(resp.Cert))
+	if block == nil {
+		t.Fatalf("response %+v lacks a certificate", resp)
+	}
+	if resp.Revoked != 2 {
+		t.Errorf("revoked = %d; want the 2 certificates of the user", resp.Revoked)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Login, cert
+}
+
+func TestAccountHandler_Rename(t *testing.T) {
+	withTestCA(t)
+	h := &handler.AccountHandler{AccountService: fakeAccounts{}}
+	alice, _ := userCert(t, "alice")
+	serve := func(next http.Handler, body string, prepare func(*http.Request)) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/account/rename", strings.NewReader(body))
+		prepare(req)
+		next.ServeHTTP(rec, req)
+		return rec
+	}
+	asAlice := func(req *http.Request) {
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{alice}}
+	}
+
+	rec := serve(middleware.CertAuth(http.HandlerFunc(h.Rename)), `{"login":"Carol"}`, asAlice)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s; want 200", rec.Code, rec.Body)
+	}
+	login, cert := renamed(t, rec)
+	if login != "carol" || cert.Subject.CommonName != "carol" {
+		t.Errorf("renamed to %q with a certificate for %q; want carol", login, cert.Subject.CommonName)
+	}
+	if !alice.PublicKey.(*ecdsa.PublicKey).Equal(cert.PublicKey) {
+		t.Error("the new certificate is not issued for the key of the old one")
+	}
+
+	if rec := serve(middleware.CertAuth(http.HandlerFunc(h.Rename)), `{"login":"bob"}`, asAlice); rec.Code != http.StatusConflict {
+		t.Errorf("renaming to a taken login: status %d; want 409", rec.Code)
+	}
+
+	// A token holder has no key to certify
+	withToken := func(req *http.Request) { req.Header.Set("Authorization", "Bearer tok") }
+	if rec := serve(middleware.TokenAuth(leaseValidator{})(http.HandlerFunc(h.Rename)), `{"login":"carol"}`, withToken); rec.Code != http.StatusForbidden {
+		t.Errorf("renaming with a token: status %d; want 403", rec.Code)
+	}
+}
@@ -0,0 +1,155 @@
+package http
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+
+	"github.com/atinyakov/GophKeeper/internal/db"
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/problem"
+	"github.com/atinyakov/GophKeeper/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// Cleaner purges soft-deleted secrets, see db.SoftDeleteCleaner.
+type Cleaner interface {
+	// Run runs the cleaner once.
+	Run(ctx context.Context) (db.CleanerRun, error)
+	// Stats summarizes the runs so far.
+	Stats() db.CleanerStats
+}
+
+// IntegrityScanner checks the stored secrets, see
+// repository.IntegrityScanner.
+type IntegrityScanner interface {
+	// Run runs the scanner once.
+	Run(ctx context.Context) (repository.IntegrityRun, error)
+	// Stats summarizes the runs so far.
+	Stats() repository.IntegrityStats
+}
+
+// QueryMetrics counts the database queries, see repository.QueryMetrics.
+type QueryMetrics interface {
+	// Stats summarizes the queries so far.
+	Stats() repository.QueryStats
+}
+
+// AdminHandler serves operator endpoints. They carry no authentication of
+// their own and must only be reachable by operators, see NewAdminRouter.
+type AdminHandler struct {
+	Cleaner Cleaner
+	// Integrity serves the integrity scan endpoints; optional.
+	Integrity IntegrityScanner
+	// Accounts serves the account endpoints; optional.
+	Accounts AccountService
+	// Queries serves the query statistics endpoint; optional.
+	Queries QueryMetrics
+}
+
+// CleanerStats handles GET /admin/cleaner, reporting the runs of the
+// cleaner so far.
+func (h *AdminHandler) CleanerStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.Cleaner.Stats())
+}
+
+// RunCleaner handles POST /admin/cleaner/run, running the cleaner now and
+// reporting the run. A failed run is answered with 500 Internal Server Error.
+func (h *AdminHandler) RunCleaner(w http.ResponseWriter, r *http.Request) {
+	run, err := h.Cleaner.Run(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	_ = json.NewEncoder(w).Encode(run)
+}
+
+// IntegrityStats handles GET /admin/integrity, reporting the runs of the
+// integrity scanner so far.
+func (h *AdminHandler) IntegrityStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.Integrity.Stats())
+}
+
+// RunIntegrity handles POST /admin/integrity/run, scanning the secrets now
+// and reporting the run. A failed run is answered with 500 Internal Server
+// Error.
+func (h *AdminHandler) RunIntegrity(w http.ResponseWriter, r *http.Request) {
+	run, err := h.Integrity.Run(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	_ = json.NewEncoder(w).Encode(run)
+}
+
+// QueryStats handles GET /admin/queries, reporting the database queries so
+// far.
+func (h *AdminHandler) QueryStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.Queries.Stats())
+}
+
+// RenameUser handles POST /admin/users/{login}/rename, renaming the user
+// like AccountHandler.Rename renames the authenticated one. The body is
+// {"login": "<new login>", "cert": "<PEM>"}, where cert is the current
+// certificate of the user, e.g. its client.crt: the new certificate in the
+// response is issued for the same key, and the operator hands it over to
+// the user. An invalid cert is answered with 400 Bad Request.
+func (h *AdminHandler) RenameUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Login string `json:"login"`
+		Cert  string `json:"cert"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "invalid request body")
+		return
+	}
+	block, _ := pem.Decode([]byte(req.Cert))
+	if block == nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "cert must be the PEM-encoded certificate of the user")
+		return
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "invalid certificate: "+err.Error())
+		return
+	}
+	renameUser(w, r, h.Accounts, chi.URLParam(r, "login"), req.Login, cert.PublicKey)
+}
+
+// NewAdminRouter constructs an HTTP handler serving the operator endpoints.
+// It is mounted on a separate listener, which should be bound to a
+// loopback or otherwise private address.
+//
+// Routes:
+//
+//	GET  /admin/cleaner     → h.CleanerStats
+//	POST /admin/cleaner/run → h.RunCleaner
+//	GET  /admin/integrity     → h.IntegrityStats (only with h.Integrity)
+//	POST /admin/integrity/run → h.RunIntegrity (only with h.Integrity)
+//	POST /admin/users/{login}/rename → h.RenameUser (only with h.Accounts)
+//	GET  /admin/queries → h.QueryStats (only with h.Queries)
+func NewAdminRouter(h *AdminHandler, logger *zap.Logger) http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.WithRequestLogging(logger))
+
+	r.Get("/admin/cleaner", h.CleanerStats)
+	r.Post("/admin/cleaner/run", h.RunCleaner)
+	if h.Integrity != nil {
+		r.Get("/admin/integrity", h.IntegrityStats)
+		r.Post("/admin/integrity/run", h.RunIntegrity)
+	}
+	if h.Accounts != nil {
+		r.Post("/admin/users/{login}/rename", h.RenameUser)
+	}
+	if h.Queries != nil {
+		r.Get("/admin/queries", h.QueryStats)
+	}
+
+	return r
+}
@@ -0,0 +1,166 @@
+package http_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/db"
+	"github.com/atinyakov/GophKeeper/internal/repository"
+	handler "github.com/atinyakov/GophKeeper/internal/server/handler/http"
+	"go.uber.org/zap"
+)
+
+// fakeCleaner counts its runs, failing while err is set.
+type fakeCleaner struct {
+	stats db.CleanerStats
+	err   error
+}
+
+func (f *fakeCleaner) Run(ctx context.Context) (db.CleanerRun, error) {
+	f.stats.Runs++
+	run := db.CleanerRun{Removed: 3, Batches: 1}
+	if f.err != nil {
+		run.Error = f.err.Error()
+	}
+	f.stats.Last = &run
+	return run, f.err
+}
+
+func (f *fakeCleaner) Stats() db.CleanerStats { return f.stats }
+
+func TestAdminRouter_Cleaner(t *testing.T) {
+	cleaner := &fakeCleaner{}
+	router := handler.NewAdminRouter(&handler.AdminHandler{Cleaner: cleaner}, zap.NewNop())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/cleaner/run", nil))
+	var run db.CleanerRun
+	if err := json.NewDecoder(rec.Body).Decode(&run); err != nil || rec.Code != http.StatusOK || run.Removed != 3 {
+		t.Errorf("run: status %d, %+v, %v; want 3 rows removed", rec.Code, run, err)
+	}
+
+	cleaner.err = errors.New("db fail")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/cleaner/run", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("failed run: status %d; want 500", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/cleaner", nil))
+	var stats db.CleanerStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil || stats.Runs != 2 || stats.Last == nil || stats.Last.Error != "db fail" {
+		t.Errorf("stats: %+v, %v; want 2 runs, the last failed", stats, err)
+	}
+}
+
+// fakeIntegrity reports one anomaly per run.
+type fakeIntegrity struct {
+	stats repository.IntegrityStats
+}
+
+func (f *fakeIntegrity) Run(ctx context.Context) (repository.IntegrityRun, error) {
+	f.stats.Runs++
+	run := repository.IntegrityRun{Scanned: 10, Anomalies: map[string]int64{repository.AnomalyPayload: 1}, New: 1}
+	f.stats.Last = &run
+	return run, nil
+}
+
+func (f *fakeIntegrity) Stats() repository.IntegrityStats { return f.stats }
+
+func TestAdminRouter_Integrity(t *testing.T) {
+	router := handler.NewAdminRouter(&handler.AdminHandler{Cleaner: &fakeCleaner{}}, zap.NewNop())
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/integrity", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without scanner: status %d; want 404", rec.Code)
+	}
+
+	router = handler.NewAdminRouter(&handler.AdminHandler{Cleaner: &fakeCleaner{}, Integrity: &fakeIntegrity{}}, zap.NewNop())
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/integrity/run", nil))
+	var run repository.IntegrityRun
+	if err := json.NewDecoder(rec.Body).Decode(&run); err != nil || rec.Code != http.StatusOK || run.Anomalies[repository.AnomalyPayload] != 1 {
+		t.Errorf("run: status %d, %+v, %v; want a payload anomaly", rec.Code, run, err)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/integrity", nil))
+	var stats repository.IntegrityStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil || stats.Runs != 1 || stats.Last == nil || stats.Last.Scanned != 10 {
+		t.Errorf("stats: %+v, %v; want the run", stats, err)
+	}
+}
+
+func TestAdminRouter_RenameUser(t *testing.T) {
+	router := handler.NewAdminRouter(&handler.AdminHandler{Cleaner: &fakeCleaner{}}, zap.NewNop())
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/users/alice/rename", strings.NewReader(`{"login":"carol"}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without accounts: status %d; want 404", rec.Code)
+	}
+
+	withTestCA(t)
+	alice, certPEM := userCert(t, "alice")
+	router = handler.NewAdminRouter(&handler.AdminHandler{Cleaner: &fakeCleaner{}, Accounts: fakeAccounts{}}, zap.NewNop())
+	body := func(login string) string {
+		b, _ := json.Marshal(map[string]string{"login": login, "cert": certPEM})
+		return string(b)
+	}
+	tests := []struct {
+		name, from, body string
+		want             int
+	}{
+		{"renamed", "alice", body("Carol"), http.StatusOK},
+		{"bad body", "alice", `{`, http.StatusBadRequest},
+		{"no certificate", "alice", `{"login":"carol"}`, http.StatusBadRequest},
+		{"invalid login", "alice", body(""), http.StatusUnprocessableEntity},
+		{"unknown user", "mallory", body("carol"), http.StatusNotFound},
+		{"taken", "alice", body("bob"), http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/users/"+tt.from+"/rename", strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Fatalf("status %d; want %d", rec.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			login, cert := renamed(t, rec)
+			if login != "carol" || cert.Subject.CommonName != "carol" {
+				t.Errorf("renamed to %q with a certificate for %q; want carol", login, cert.Subject.CommonName)
+			}
+			if !alice.PublicKey.(*ecdsa.PublicKey).Equal(cert.PublicKey) {
+				t.Error("the new certificate is not issued for the key of the user")
+			}
+		})
+	}
+}
+
+func TestAdminRouter_Queries(t *testing.T) {
+	router := handler.NewAdminRouter(&handler.AdminHandler{Cleaner: &fakeCleaner{}}, zap.NewNop())
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/queries", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without metrics: status %d; want 404", rec.Code)
+	}
+
+	queries := &repository.QueryMetrics{Log: zap.NewNop(), SlowThreshold: time.Second}
+	queries.AfterQuery(context.Background(), "SELECT 1", 2*time.Second, nil)
+	router = handler.NewAdminRouter(&handler.AdminHandler{Cleaner: &fakeCleaner{}, Queries: queries}, zap.NewNop())
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/queries", nil))
+	var stats repository.QueryStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil || stats.Queries != 1 || stats.Slow != 1 || stats.MaxQuery != "SELECT 1" {
+		t.Errorf("stats: %+v, %v; want the slow query", stats, err)
+	}
+}
@@ -4,10 +4,21 @@ package http
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/atinyakov/GophKeeper/internal/certgen"
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/atinyakov/GophKeeper/internal/notify"
+	"github.com/atinyakov/GophKeeper/internal/pow"
+	"github.com/atinyakov/GophKeeper/internal/problem"
 )
 
 // AuthService defines the interface for authentication operations
@@ -16,72 +27,486 @@ type AuthService interface {
 	// UserExists checks whether a user with the given login exists.
 	// Returns true if the user exists, false otherwise.
 	UserExists(context.Context, string) (bool, error)
+	// NormalizeLogin validates a login against the login policy and
+	// returns its canonical form.
+	NormalizeLogin(string) (string, error)
 	// RegisterUser registers a new user with the given login.
 	RegisterUser(context.Context, string) error
+	// IssueToken creates a new API bearer token for the given login.
+	IssueToken(context.Context, string) (string, error)
+	// AuthenticateToken resolves an API bearer token to its owner's login
+	// and the ID of its lease.
+	AuthenticateToken(context.Context, string) (string, string, error)
+	// IssueLease creates a new API bearer token for the login expiring
+	// after ttl, or never if ttl is 0, and returns it with its lease.
+	IssueLease(ctx context.Context, login string, ttl time.Duration) (string, *models.Lease, error)
+	// Leases returns the leases of the login's API tokens.
+	Leases(ctx context.Context, login string) ([]models.Lease, error)
+	// RenewLease extends the login's lease with the given ID by ttl, or by
+	// its TTL if ttl is 0.
+	RenewLease(ctx context.Context, login, id string, ttl time.Duration) (*models.Lease, error)
+	// RevokeLease revokes the login's API token with the given lease ID.
+	RevokeLease(ctx context.Context, login, id string) error
+	// IssueRecoveryCodes creates a new set of one-time recovery codes for the login.
+	IssueRecoveryCodes(context.Context, string) ([]string, error)
+	// RedeemRecoveryCode checks and invalidates a recovery code of the login.
+	RedeemRecoveryCode(ctx context.Context, login, code string) (bool, error)
+	// BindCertificate records a PEM-encoded certificate issued to the
+	// login; with revokeOthers, the other certificates of the login are
+	// revoked and its API tokens and browser sessions deleted.
+	BindCertificate(ctx context.Context, login string, certPEM []byte, revokeOthers bool) error
+	// ReplaceCertificate records a PEM-encoded certificate issued to the
+	// login in place of old, which is revoked.
+	ReplaceCertificate(ctx context.Context, login string, old *x509.Certificate, certPEM []byte) error
+	// CheckCertificate returns an error unless cert, naming login, is a
+	// known and active certificate of the user.
+	CheckCertificate(ctx context.Context, login string, cert *x509.Certificate) error
+}
+
+// RegistrationGuard defines the abuse protection applied to registration.
+type RegistrationGuard interface {
+	// Check returns the remaining ban time of the IP address, or 0 if
+	// it may register.
+	Check(ctx context.Context, ip string) (time.Duration, error)
+	// Failure records a failed registration attempt.
+	Failure(ctx context.Context, ip, login, reason string) error
+	// Success records a successful registration.
+	Success(ctx context.Context, ip, login string) error
+	// Reenrolled records that a further device of an existing user was
+	// registered.
+	Reenrolled(ctx context.Context, ip, login string) error
+}
+
+// EventNotifier delivers security events to the notification channels of
+// users, see notify.Notifier.
+type EventNotifier interface {
+	// Notify delivers ev and returns the number of channels reached.
+	Notify(ctx context.Context, ev notify.Event) (int, error)
+}
+
+// ChallengeIssuer defines the proof-of-work challenge required before registration.
+type ChallengeIssuer interface {
+	// Issue creates a new challenge.
+	Issue() pow.Challenge
+	// Verify checks the solution of a previously issued challenge.
+	Verify(challenge, solution string) error
 }
 
 // AuthHandler handles HTTP requests for user registration and login.
 type AuthHandler struct {
 	// AuthService performs the underlying authentication operations.
 	AuthService AuthService
+	// Guard protects registration against abuse; optional.
+	Guard RegistrationGuard
+	// Challenges requires a solved proof-of-work challenge for registration; optional.
+	Challenges ChallengeIssuer
+	// Notifier tells users of devices enrolled for their login; optional.
+	Notifier EventNotifier
 }
 
 // RegisterRequest represents the JSON payload for user registration.
 type RegisterRequest struct {
 	// Login is the username to register.
 	Login string `json:"login"`
+	// Challenge is the proof-of-work challenge issued by the server, if required.
+	Challenge string `json:"challenge,omitempty"`
+	// Solution is the client's solution of Challenge.
+	Solution string `json:"solution,omitempty"`
+}
+
+// Enrollment holds the credentials issued to a device by Enroll.
+type Enrollment struct {
+	// Cert and Key are the PEM-encoded client certificate and key.
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+	// Token is an API bearer token of the user.
+	Token string `json:"token"`
+	// RecoveryCodes replace a lost certificate; only issued to new users.
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
 }
 
 // Register handles user registration requests.
 // It expects a JSON body with a non-empty "login" field.
+// Logins violating the login policy are rejected with
+// 422 Unprocessable Entity and a message naming the violated rule.
 // If the user does not already exist, it registers the user,
 // generates a client certificate signed by the CA, stores
 // the user in the database, and returns the PEM-encoded
-// certificate and private key.
+// certificate and private key together with an API token
+// for clients that authenticate with a bearer token (web UI)
+// and one-time recovery codes (see Recover).
+//
+// An existing login is answered with 409 Conflict, unless the request
+// presents a verified client certificate naming it: that is re-enrollment
+// of a further device of the user, see reenroll.
+//
+// When a Guard is configured, addresses with too many failed attempts
+// are refused with 429 Too Many Requests and a Retry-After header.
+//
+// When Challenges is configured, a request without a challenge solution is
+// answered with 428 Precondition Required and a JSON challenge; the client
+// solves it and repeats the request with "challenge" and "solution" set.
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req RegisterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Login == "" {
-		http.Error(w, "invalid request", http.StatusBadRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		// Rejected, and counted as a failed attempt, by Enroll
+		req = RegisterRequest{}
+	}
+
+	var peer *x509.Certificate
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.PeerCertificates) > 0 {
+		peer = r.TLS.PeerCertificates[0]
+	}
+	enrollment, challenge, err := h.Enroll(r.Context(), clientIP(r), req, peer)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if challenge != nil {
+		w.WriteHeader(http.StatusPreconditionRequired)
+		_ = json.NewEncoder(w).Encode(challenge)
 		return
 	}
+	_ = json.NewEncoder(w).Encode(enrollment)
+}
+
+// Enroll registers the login of req for a client at the address ip, see
+// Register, which answers its outcome over HTTP; the gRPC API shares it.
+// peer is the client certificate presented and verified by the TLS layer,
+// if any. If a proof-of-work challenge must be solved first, it is
+// returned instead of the credentials. Errors are *problem.Error.
+func (h *AuthHandler) Enroll(ctx context.Context, ip string, req RegisterRequest, peer *x509.Certificate) (*Enrollment, *pow.Challenge, error) {
+	if err := h.refused(ctx, ip); err != nil {
+		return nil, nil, err
+	}
+	if req.Login == "" {
+		h.registrationFailed(ctx, ip, req.Login, "invalid request")
+		return nil, nil, problem.New(http.StatusBadRequest, problem.CodeInvalidRequest, "invalid request")
+	}
+
+	if h.Challenges != nil {
+		if req.Challenge == "" || req.Solution == "" {
+			c := h.Challenges.Issue()
+			return nil, &c, nil
+		}
+		if err := h.Challenges.Verify(req.Challenge, req.Solution); err != nil {
+			h.registrationFailed(ctx, ip, req.Login, err.Error())
+			return nil, nil, problem.New(http.StatusBadRequest, problem.CodeChallengeFailed, err.Error())
+		}
+	}
+
+	// Validate the login and bring it to canonical form
+	login, err := h.AuthService.NormalizeLogin(req.Login)
+	if err != nil {
+		h.registrationFailed(ctx, ip, req.Login, err.Error())
+		return nil, nil, problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidLogin, err.Error())
+	}
 
 	// Check if user already exists
-	exists, err := h.AuthService.UserExists(r.Context(), req.Login)
+	exists, err := h.AuthService.UserExists(ctx, login)
 	if err != nil {
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
+		return nil, nil, problem.Internal("internal error")
 	}
 	if exists {
-		http.Error(w, "user already exists", http.StatusConflict)
+		if peer != nil && peer.Subject.CommonName == login {
+			e, err := h.reenroll(ctx, ip, login, peer)
+			return e, nil, err
+		}
+		h.registrationFailed(ctx, ip, login, "user already exists")
+		return nil, nil, problem.New(http.StatusConflict, problem.CodeUserExists, "user already exists")
+	}
+
+	// Generate user certificate signed by the CA
+	certPEM, keyPEM, err := generateCertificate(login)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Save the new user in the database
+	if err := h.AuthService.RegisterUser(ctx, login); err != nil {
+		return nil, nil, problem.Internal("failed to save user")
+	}
+
+	// Record the certificate, so that only it authenticates the user
+	if err := h.AuthService.BindCertificate(ctx, login, certPEM, false); err != nil {
+		return nil, nil, problem.Internal("failed to save certificate")
+	}
+
+	// Issue an API token for bearer-token clients
+	token, err := h.AuthService.IssueToken(ctx, login)
+	if err != nil {
+		return nil, nil, problem.Internal("failed to issue token")
+	}
+
+	// Issue recovery codes for replacing lost certificates
+	codes, err := h.AuthService.IssueRecoveryCodes(ctx, login)
+	if err != nil {
+		return nil, nil, problem.Internal("failed to issue recovery codes")
+	}
+	if h.Guard != nil {
+		_ = h.Guard.Success(ctx, ip, login)
+	}
+
+	return &Enrollment{Cert: string(certPEM), Key: string(keyPEM), Token: token, RecoveryCodes: codes}, nil, nil
+}
+
+// RecoverRequest represents the JSON payload for account recovery.
+type RecoverRequest struct {
+	// Login is the user whose devices were lost.
+	Login string `json:"login"`
+	// Code is one of the recovery codes issued at registration.
+	Code string `json:"code"`
+}
+
+// Recover handles account recovery requests for users who lost all
+// devices holding their client certificate. It expects a JSON body with
+// "login" and one of the user's recovery codes in "code". A valid code is
+// invalidated and a replacement certificate and key are returned together
+// with a new API token, like on registration. All previous certificates,
+// API tokens and browser sessions of the user are revoked, as the lost
+// devices may have been stolen.
+//
+// Wrong codes are answered with 403 Forbidden and count as failed attempts
+// for the Guard, which bans addresses guessing codes.
+func (h *AuthHandler) Recover(w http.ResponseWriter, r *http.Request) {
+	ctx, ip := r.Context(), clientIP(r)
+	if err := h.refused(ctx, ip); err != nil {
+		problem.WriteError(w, r, err)
 		return
 	}
 
-	// Load CA credentials for signing
-	caCert, caKey, err := certgen.LoadCACredentials("certs/ca.crt", "certs/ca.key")
+	var req RecoverRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Login == "" || req.Code == "" {
+		h.registrationFailed(ctx, ip, req.Login, "invalid recovery request")
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "invalid request")
+		return
+	}
+	login, err := h.AuthService.NormalizeLogin(req.Login)
+	if err != nil {
+		login = req.Login
+	}
+
+	ok, err := h.AuthService.RedeemRecoveryCode(ctx, login, req.Code)
 	if err != nil {
-		http.Error(w, "failed to load CA", http.StatusInternalServerError)
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "internal error")
+		return
+	}
+	if !ok {
+		h.registrationFailed(ctx, ip, login, "invalid recovery code")
+		problem.Write(w, r, http.StatusForbidden, problem.CodeInvalidRecoveryCode, "invalid recovery code")
 		return
 	}
 
-	// Generate user certificate signed by the CA
-	certPEM, keyPEM, err := certgen.GenerateUserCertificate(req.Login, caCert, caKey)
+	certPEM, keyPEM, err := generateCertificate(login)
 	if err != nil {
-		http.Error(w, "failed to generate certificate", http.StatusInternalServerError)
+		problem.WriteError(w, r, err)
+		return
+	}
+	// The lost devices may have been stolen: only the new certificate and
+	// the token issued below remain valid
+	if err := h.AuthService.BindCertificate(ctx, login, certPEM, true); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "failed to save certificate")
+		return
+	}
+	token, err := h.AuthService.IssueToken(ctx, login)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "failed to issue token")
 		return
 	}
 
-	// Save the new user in the database
-	if err := h.AuthService.RegisterUser(r.Context(), req.Login); err != nil {
-		http.Error(w, "failed to save user", http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(Enrollment{Cert: string(certPEM), Key: string(keyPEM), Token: token})
+}
+
+// Renew handles POST /api/renew requests.
+// It issues a fresh certificate and key for the user of the presented
+// client certificate, e.g. before it expires after
+// certgen.UserCertValidity, and revokes the presented certificate in
+// favor of the new one; the other devices of the user keep theirs. The
+// response carries the PEM-encoded certificate and key as {"cert", "key"}.
+// As devices are identified by the serial number of their certificate,
+// the renewed device is listed as a new one.
+//
+// Clients whose key cannot leave the device, e.g. held by the OS keystore,
+// send {"csr": PEM} with a certificate request signed by their new key
+// instead: the certificate is issued for that key, and the response has
+// no "key". Requests that do not verify are answered with 400 Bad Request.
+//
+// Requests authenticated with an API token or a browser session have no
+// certificate to renew and are refused with 403 Forbidden.
+func (h *AuthHandler) Renew(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	login := middleware.GetUserIDFromContext(ctx)
+	if login == "" {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "unauthorized")
+		return
+	}
+	device := middleware.GetDeviceIDFromContext(ctx)
+	if device == middleware.TokenDeviceID || device == middleware.SessionDeviceID ||
+		r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		problem.Write(w, r, http.StatusForbidden, problem.CodeCertificateRequired, "renewal requires a client certificate")
 		return
 	}
 
-	// Respond with the generated certificate and key
+	var req struct {
+		CSR string `json:"csr"`
+	}
+	if err := decodeOptional(r.Body, &req); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "invalid request body")
+		return
+	}
+
+	var certPEM, keyPEM []byte
+	var err error
+	if req.CSR != "" {
+		pub, csrErr := parseCSR(req.CSR)
+		if csrErr != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, csrErr.Error())
+			return
+		}
+		certPEM, err = issueCertificate(login, pub)
+	} else {
+		certPEM, keyPEM, err = generateCertificate(login)
+	}
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	if err := h.AuthService.ReplaceCertificate(ctx, login, r.TLS.PeerCertificates[0], certPEM); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "failed to save certificate")
+		return
+	}
+
+	resp := map[string]string{"cert": string(certPEM)}
+	if keyPEM != nil {
+		resp["key"] = string(keyPEM)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{
-		"cert": string(certPEM),
-		"key":  string(keyPEM),
-	})
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// parseCSR returns the public key of the PEM-encoded certificate request
+// csrPEM after checking its signature, which proves the client holds the
+// private key. The subject of the request is ignored.
+func parseCSR(csrPEM string) (any, error) {
+	block, _ := pem.Decode([]byte(csrPEM))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("invalid certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, errors.New("invalid certificate request")
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, errors.New("certificate request signature does not verify")
+	}
+	return csr.PublicKey, nil
+}
+
+// reenroll issues a certificate and key for a further device of the
+// existing login presenting cert, together with an API token, like on
+// registration but without recovery codes. The certificates of the other
+// devices stay valid, and the user is notified of the new device through
+// the Notifier. cert must be an active certificate of the user; a revoked
+// or unknown one is rejected with 401 and counts as a failed attempt for
+// the Guard.
+func (h *AuthHandler) reenroll(ctx context.Context, ip, login string, cert *x509.Certificate) (*Enrollment, error) {
+	if err := h.AuthService.CheckCertificate(ctx, login, cert); err != nil {
+		h.registrationFailed(ctx, ip, login, "re-enrollment with rejected certificate")
+		return nil, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "client certificate not accepted")
+	}
+
+	certPEM, keyPEM, err := generateCertificate(login)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.AuthService.BindCertificate(ctx, login, certPEM, false); err != nil {
+		return nil, problem.Internal("failed to save certificate")
+	}
+	token, err := h.AuthService.IssueToken(ctx, login)
+	if err != nil {
+		return nil, problem.Internal("failed to issue token")
+	}
+	if h.Guard != nil {
+		_ = h.Guard.Reenrolled(ctx, ip, login)
+	}
+	if h.Notifier != nil {
+		ev := notify.Event{
+			Kind:    notify.EventNewDevice,
+			Login:   login,
+			Subject: ip,
+			Message: fmt.Sprintf("A new device was enrolled for %s from %s. If it was not you, revoke its certificate.", login, ip),
+			Time:    time.Now().Unix(),
+		}
+		// Deliver without holding up the response; failures are logged
+		go func() { _, _ = h.Notifier.Notify(context.WithoutCancel(ctx), ev) }()
+	}
+
+	return &Enrollment{Cert: string(certPEM), Key: string(keyPEM), Token: token}, nil
+}
+
+// refused returns a 429 Too Many Requests problem telling when to retry if
+// the Guard has banned ip.
+func (h *AuthHandler) refused(ctx context.Context, ip string) error {
+	if h.Guard == nil {
+		return nil
+	}
+	wait, err := h.Guard.Check(ctx, ip)
+	if err != nil {
+		return problem.Internal("internal error")
+	}
+	if wait > 0 {
+		p := problem.New(http.StatusTooManyRequests, problem.CodeTooManyRequests, "too many failed registration attempts")
+		p.RetryAfter = wait
+		return p
+	}
+	return nil
+}
+
+// generateCertificate creates a client certificate for login signed by the
+// CA. Errors are *problem.Error.
+func generateCertificate(login string) (certPEM, keyPEM []byte, err error) {
+	caCert, caKey, err := certgen.LoadCACredentials("certs/ca.crt", "certs/ca.key")
+	if err != nil {
+		return nil, nil, problem.Internal("failed to load CA")
+	}
+	certPEM, keyPEM, err = certgen.GenerateUserCertificate(login, caCert, caKey)
+	if err != nil {
+		return nil, nil, problem.Internal("failed to generate certificate")
+	}
+	return certPEM, keyPEM, nil
+}
+
+// issueCertificate issues a certificate for login certifying pub, a key
+// the client generated.
+func issueCertificate(login string, pub any) ([]byte, error) {
+	caCert, caKey, err := certgen.LoadCACredentials("certs/ca.crt", "certs/ca.key")
+	if err != nil {
+		return nil, problem.Internal("failed to load CA")
+	}
+	certPEM, err := certgen.IssueUserCertificate(login, pub, caCert, caKey)
+	if err != nil {
+		return nil, problem.Internal("failed to issue certificate")
+	}
+	return certPEM, nil
+}
+
+// registrationFailed reports a failed registration attempt to the guard, if any.
+func (h *AuthHandler) registrationFailed(ctx context.Context, ip, login, reason string) {
+	if h.Guard != nil {
+		_ = h.Guard.Failure(ctx, ip, login, reason)
+	}
+}
+
+// clientIP returns the IP address of the client connection. Forwarding
+// headers are ignored because they are controlled by the client.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
 // Login handles certificate-based login requests.
@@ -89,27 +514,77 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 // The CommonName from the client certificate is used as the login.
 // If the user exists, it returns a JSON status "ok" and the username.
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
-	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
-		http.Error(w, "client certificate required", http.StatusUnauthorized)
+	var cert *x509.Certificate
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		cert = r.TLS.PeerCertificates[0]
+	}
+	login, err := h.CertificateLogin(r.Context(), cert)
+	if err != nil {
+		problem.WriteError(w, r, err)
 		return
 	}
 
-	cert := r.TLS.PeerCertificates[0]
-	login := cert.Subject.CommonName
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"status": "ok",
+		"user":   login,
+	})
+}
 
-	exists, err := h.AuthService.UserExists(r.Context(), login)
+// CertificateLogin returns the login of the user the client certificate
+// cert was issued to, see Login. Errors are *problem.Error.
+func (h *AuthHandler) CertificateLogin(ctx context.Context, cert *x509.Certificate) (string, error) {
+	if cert == nil {
+		return "", problem.New(http.StatusUnauthorized, problem.CodeCertificateRequired, "client certificate required")
+	}
+	login := cert.Subject.CommonName
+	exists, err := h.AuthService.UserExists(ctx, login)
 	if err != nil {
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
+		return "", problem.Internal("internal error")
 	}
 	if !exists {
-		http.Error(w, "user not found", http.StatusForbidden)
+		return "", problem.New(http.StatusForbidden, problem.CodeUserNotFound, "user not found")
+	}
+	return login, nil
+}
+
+// IssueToken handles POST /api/tokens requests.
+// It issues a new API bearer token for the authenticated user, so a
+// certificate holder can grant access to a client that cannot present
+// a TLS client certificate, such as the web UI. An optional body of
+// {"ttl": seconds} makes the token expire, e.g. for a CI job; the response
+// carries the token, its "lease_id" and "expires_at" (Unix time, 0 for
+// never). Requests authenticated with an API token are refused with 403
+// Forbidden, so that a token cannot issue one outliving its lease.
+func (h *AuthHandler) IssueToken(w http.ResponseWriter, r *http.Request) {
+	login := middleware.GetUserIDFromContext(r.Context())
+	if login == "" {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "unauthorized")
+		return
+	}
+	if viaToken(w, r) {
+		return
+	}
+	var req leaseRequest
+	if err := decodeOptional(r.Body, &req); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "invalid body")
+		return
+	}
+
+	token, lease, err := h.AuthService.IssueLease(r.Context(), login, time.Duration(req.TTL)*time.Second)
+	if errors.Is(err, models.ErrInvalidTTL) {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, err.Error())
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "failed to issue token")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{
-		"status": "ok",
-		"user":   login,
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"token":      token,
+		"lease_id":   lease.ID,
+		"expires_at": lease.ExpiresAt,
 	})
 }
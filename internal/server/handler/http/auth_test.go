@@ -3,31 +3,128 @@ package http
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/atinyakov/GophKeeper/internal/pow"
 )
 
 // fakeAuthService implements AuthService for testing.
 type fakeAuthService struct {
 	existsReturn bool
 	existsErr    error
+	normalizeErr error
 	registerErr  error
+	token        string
+	tokenErr     error
+	codes        []string
+	codesErr     error
+	redeemed     []string
+	certErr      error
+	checked      string // login whose certificate was checked
+	ttl          time.Duration
+	leases       []models.Lease
+	leaseErr     error
+	revoked      string
 }
 
 func (f *fakeAuthService) UserExists(ctx context.Context, login string) (bool, error) {
 	return f.existsReturn, f.existsErr
 }
 
+func (f *fakeAuthService) NormalizeLogin(login string) (string, error) {
+	if f.normalizeErr != nil {
+		return "", f.normalizeErr
+	}
+	return login, nil
+}
+
 func (f *fakeAuthService) RegisterUser(ctx context.Context, login string) error {
 	return f.registerErr
 }
 
+func (f *fakeAuthService) IssueToken(ctx context.Context, login string) (string, error) {
+	return f.token, f.tokenErr
+}
+
+func (f *fakeAuthService) AuthenticateToken(ctx context.Context, token string) (string, string, error) {
+	if f.token == "" || token != f.token {
+		return "", "", errors.New("invalid token")
+	}
+	return "token-user", "lease1", nil
+}
+
+func (f *fakeAuthService) IssueLease(ctx context.Context, login string, ttl time.Duration) (string, *models.Lease, error) {
+	f.ttl = ttl
+	if f.tokenErr != nil {
+		return "", nil, f.tokenErr
+	}
+	lease := &models.Lease{ID: "lease1"}
+	if ttl != 0 {
+		lease.TTL, lease.ExpiresAt = int64(ttl/time.Second), 1000+int64(ttl/time.Second)
+	}
+	return f.token, lease, nil
+}
+
+func (f *fakeAuthService) Leases(ctx context.Context, login string) ([]models.Lease, error) {
+	return f.leases, f.leaseErr
+}
+
+func (f *fakeAuthService) RenewLease(ctx context.Context, login, id string, ttl time.Duration) (*models.Lease, error) {
+	f.ttl = ttl
+	if f.leaseErr != nil {
+		return nil, f.leaseErr
+	}
+	return &models.Lease{ID: id, TTL: int64(ttl / time.Second)}, nil
+}
+
+func (f *fakeAuthService) RevokeLease(ctx context.Context, login, id string) error {
+	f.revoked = id
+	return f.leaseErr
+}
+
+func (f *fakeAuthService) IssueRecoveryCodes(ctx context.Context, login string) ([]string, error) {
+	return f.codes, f.codesErr
+}
+
+func (f *fakeAuthService) BindCertificate(ctx context.Context, login string, certPEM []byte, revokeOthers bool) error {
+	return nil
+}
+
+func (f *fakeAuthService) ReplaceCertificate(ctx context.Context, login string, old *x509.Certificate, certPEM []byte) error {
+	return nil
+}
+
+func (f *fakeAuthService) CheckCertificate(ctx context.Context, login string, cert *x509.Certificate) error {
+	f.checked = login
+	return f.certErr
+}
+
+func (f *fakeAuthService) RedeemRecoveryCode(ctx context.Context, login, code string) (bool, error) {
+	for i, c := range f.codes {
+		if c == code {
+			f.codes = append(f.codes[:i], f.codes[i+1:]...)
+			f.redeemed = append(f.redeemed, code)
+			return true, nil
+		}
+	}
+	return false, f.codesErr
+}
+
 func TestAuthHandler_Register(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -50,6 +147,13 @@ func TestAuthHandler_Register(t *testing.T) {
 			expectedCode:   http.StatusBadRequest,
 			expectedSubstr: "invalid request",
 		},
+		{
+			name:           "login policy violation",
+			body:           `{"login":"admin"}`,
+			service:        &fakeAuthService{normalizeErr: errors.New(`invalid login: "admin" is reserved`)},
+			expectedCode:   http.StatusUnprocessableEntity,
+			expectedSubstr: "is reserved",
+		},
 		{
 			name:           "UserExists error",
 			body:           `{"login":"alice"}`,
@@ -97,6 +201,340 @@ func TestAuthHandler_Register(t *testing.T) {
 	}
 }
 
+// fakeGuard implements RegistrationGuard for testing.
+type fakeGuard struct {
+	wait     time.Duration
+	checkErr error
+	failures []string
+	ip       string
+}
+
+func (f *fakeGuard) Check(ctx context.Context, ip string) (time.Duration, error) {
+	f.ip = ip
+	return f.wait, f.checkErr
+}
+
+func (f *fakeGuard) Failure(ctx context.Context, ip, login, reason string) error {
+	f.failures = append(f.failures, reason)
+	return nil
+}
+
+func (f *fakeGuard) Success(ctx context.Context, ip, login string) error {
+	return nil
+}
+
+func (f *fakeGuard) Reenrolled(ctx context.Context, ip, login string) error {
+	return nil
+}
+
+func TestAuthHandler_RegisterGuard(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		service      *fakeAuthService
+		guard        *fakeGuard
+		expectedCode int
+		retryAfter   string
+		failures     int
+	}{
+		{
+			name:         "banned",
+			body:         `{"login":"alice"}`,
+			service:      &fakeAuthService{},
+			guard:        &fakeGuard{wait: 90*time.Second + time.Millisecond},
+			expectedCode: http.StatusTooManyRequests,
+			retryAfter:   "91",
+		},
+		{
+			name:         "guard error",
+			body:         `{"login":"alice"}`,
+			service:      &fakeAuthService{},
+			guard:        &fakeGuard{checkErr: errors.New("db error")},
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "invalid request counted",
+			body:         `{"login":""}`,
+			service:      &fakeAuthService{},
+			guard:        &fakeGuard{},
+			expectedCode: http.StatusBadRequest,
+			failures:     1,
+		},
+		{
+			name:         "existing user counted",
+			body:         `{"login":"bob"}`,
+			service:      &fakeAuthService{existsReturn: true},
+			guard:        &fakeGuard{},
+			expectedCode: http.StatusConflict,
+			failures:     1,
+		},
+		{
+			name:         "internal error not counted",
+			body:         `{"login":"bob"}`,
+			service:      &fakeAuthService{existsErr: errors.New("db error")},
+			guard:        &fakeGuard{},
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/register", bytes.NewBufferString(tt.body))
+			req.RemoteAddr = "10.0.0.1:4321"
+			h := &AuthHandler{AuthService: tt.service, Guard: tt.guard}
+			h.Register(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.expectedCode)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.retryAfter {
+				t.Errorf("Retry-After = %q; want %q", got, tt.retryAfter)
+			}
+			if len(tt.guard.failures) != tt.failures {
+				t.Errorf("failures = %v; want %d", tt.guard.failures, tt.failures)
+			}
+			if tt.guard.ip != "10.0.0.1" {
+				t.Errorf("ip = %q; want %q", tt.guard.ip, "10.0.0.1")
+			}
+		})
+	}
+}
+
+// fakeChallenges implements ChallengeIssuer for testing.
+type fakeChallenges struct {
+	verifyErr error
+}
+
+func (f *fakeChallenges) Issue() pow.Challenge {
+	return pow.Challenge{Challenge: "puzzle", Difficulty: 4}
+}
+
+func (f *fakeChallenges) Verify(challenge, solution string) error {
+	return f.verifyErr
+}
+
+func TestAuthHandler_RegisterChallenge(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		challenges   *fakeChallenges
+		expectedCode int
+		failures     int
+	}{
+		{
+			name:         "challenge issued",
+			body:         `{"login":"alice"}`,
+			challenges:   &fakeChallenges{},
+			expectedCode: http.StatusPreconditionRequired,
+		},
+		{
+			name:         "invalid solution",
+			body:         `{"login":"alice","challenge":"puzzle","solution":"1"}`,
+			challenges:   &fakeChallenges{verifyErr: pow.ErrInvalidSolution},
+			expectedCode: http.StatusBadRequest,
+			failures:     1,
+		},
+		{
+			name:         "solved",
+			body:         `{"login":"alice","challenge":"puzzle","solution":"1"}`,
+			challenges:   &fakeChallenges{},
+			expectedCode: http.StatusInternalServerError, // CA is not available in tests
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard := &fakeGuard{}
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/register", bytes.NewBufferString(tt.body))
+			h := &AuthHandler{AuthService: &fakeAuthService{}, Guard: guard, Challenges: tt.challenges}
+			h.Register(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.expectedCode)
+			}
+			if len(guard.failures) != tt.failures {
+				t.Errorf("failures = %v; want %d", guard.failures, tt.failures)
+			}
+			if tt.expectedCode == http.StatusPreconditionRequired {
+				var c pow.Challenge
+				if err := json.NewDecoder(rec.Body).Decode(&c); err != nil {
+					t.Fatalf("decode challenge: %v", err)
+				}
+				if c.Challenge != "puzzle" || c.Difficulty != 4 {
+					t.Errorf("challenge = %+v", c)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthHandler_Recover(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+		failures     int
+		redeemed     int
+	}{
+		{
+			name:         "missing code",
+			body:         `{"login":"alice"}`,
+			expectedCode: http.StatusBadRequest,
+			failures:     1,
+		},
+		{
+			name:         "wrong code",
+			body:         `{"login":"alice","code":"WRONG"}`,
+			expectedCode: http.StatusForbidden,
+			failures:     1,
+		},
+		{
+			name:         "valid code",
+			body:         `{"login":"alice","code":"ABCD-EFGH"}`,
+			expectedCode: http.StatusInternalServerError, // CA is not available in tests
+			redeemed:     1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard := &fakeGuard{}
+			svc := &fakeAuthService{codes: []string{"ABCD-EFGH"}}
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/recover", bytes.NewBufferString(tt.body))
+			h := &AuthHandler{AuthService: svc, Guard: guard}
+			h.Recover(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.expectedCode)
+			}
+			if len(guard.failures) != tt.failures {
+				t.Errorf("failures = %v; want %d", guard.failures, tt.failures)
+			}
+			if len(svc.redeemed) != tt.redeemed {
+				t.Errorf("redeemed = %v; want %d codes", svc.redeemed, tt.redeemed)
+			}
+		})
+	}
+
+	// Banned addresses cannot guess codes.
+	guard := &fakeGuard{wait: time.Minute}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/recover", bytes.NewBufferString(`{"login":"alice","code":"ABCD-EFGH"}`))
+	svc := &fakeAuthService{codes: []string{"ABCD-EFGH"}}
+	(&AuthHandler{AuthService: svc, Guard: guard}).Recover(rec, req)
+	if rec.Code != http.StatusTooManyRequests || len(svc.redeemed) != 0 {
+		t.Errorf("banned recover: status = %d, redeemed = %v; want %d and none", rec.Code, svc.redeemed, http.StatusTooManyRequests)
+	}
+}
+
+func TestAuthHandler_RegisterReenroll(t *testing.T) {
+	verified := func(cn string) *tls.ConnectionState {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	tests := []struct {
+		name         string
+		tlsState     *tls.ConnectionState
+		certErr      error
+		expectedCode int
+		checked      bool
+	}{
+		{"no certificate", nil, nil, http.StatusConflict, false},
+		{"certificate of another user", verified("mallory"), nil, http.StatusConflict, false},
+		{
+			name:         "unverified certificate",
+			tlsState:     &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "bob"}}}},
+			expectedCode: http.StatusConflict,
+		},
+		{"revoked certificate", verified("bob"), errors.New("client certificate revoked"), http.StatusUnauthorized, true},
+		// The CA is not available in tests, so issuing the certificate fails
+		{"active certificate", verified("bob"), nil, http.StatusInternalServerError, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeAuthService{existsReturn: true, certErr: tt.certErr}
+			guard := &fakeGuard{}
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBufferString(`{"login":"bob"}`))
+			req.TLS = tt.tlsState
+
+			h := &AuthHandler{AuthService: svc, Guard: guard}
+			h.Register(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Fatalf("status = %d; want %d (%s)", rec.Code, tt.expectedCode, rec.Body)
+			}
+			if got := svc.checked != ""; got != tt.checked {
+				t.Errorf("certificate checked = %v; want %v", got, tt.checked)
+			}
+			if tt.expectedCode == http.StatusInternalServerError && !bytes.Contains(rec.Body.Bytes(), []byte("failed to load CA")) {
+				t.Errorf("body = %q; want the certificate issued", rec.Body)
+			}
+			if wantFailure := tt.expectedCode != http.StatusInternalServerError; (len(guard.failures) == 1) != wantFailure {
+				t.Errorf("failures = %v; want a failed attempt: %v", guard.failures, wantFailure)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_Renew(t *testing.T) {
+	cert := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "bob"}}}}
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "bob"}}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, _ := json.Marshal(map[string]string{"csr": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}))})
+	// A request whose signature was made by another key
+	csrDER[len(csrDER)-5] ^= 1
+	forged, _ := json.Marshal(map[string]string{"csr": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}))})
+
+	tests := []struct {
+		name         string
+		device       string
+		tlsState     *tls.ConnectionState
+		body         string
+		expectedCode int
+	}{
+		{"api token", middleware.TokenDeviceID, nil, "", http.StatusForbidden},
+		{"browser session", middleware.SessionDeviceID, cert, "", http.StatusForbidden},
+		// The CA is not available in tests, so issuing the certificate fails
+		{"client certificate", "ff", cert, "", http.StatusInternalServerError},
+		{"certificate request", "ff", cert, string(csr), http.StatusInternalServerError},
+		{"bad signature", "ff", cert, string(forged), http.StatusBadRequest},
+		{"not a request", "ff", cert, `{"csr":"cert"}`, http.StatusBadRequest},
+		{"bad body", "ff", cert, `{`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/renew", strings.NewReader(tt.body))
+			req = req.WithContext(middleware.WithIdentity(req.Context(), "bob", tt.device, ""))
+			req.TLS = tt.tlsState
+
+			(&AuthHandler{AuthService: &fakeAuthService{}}).Renew(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Fatalf("status = %d; want %d (%s)", rec.Code, tt.expectedCode, rec.Body)
+			}
+			if tt.expectedCode == http.StatusInternalServerError && !bytes.Contains(rec.Body.Bytes(), []byte("failed to load CA")) {
+				t.Errorf("body = %q; want the certificate issued", rec.Body)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	(&AuthHandler{AuthService: &fakeAuthService{}}).Renew(rec, httptest.NewRequest(http.MethodPost, "/api/renew", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated status = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
 func TestAuthHandler_Login(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -167,3 +605,56 @@ func TestAuthHandler_Login(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthHandler_IssueToken(t *testing.T) {
+	tests := []struct {
+		name         string
+		user         string
+		service      *fakeAuthService
+		expectedCode int
+	}{
+		{
+			name:         "unauthenticated",
+			user:         "",
+			service:      &fakeAuthService{token: "t1"},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "service error",
+			user:         "alice",
+			service:      &fakeAuthService{tokenErr: errors.New("db fail")},
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "success",
+			user:         "alice",
+			service:      &fakeAuthService{token: "t1"},
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/api/tokens", nil)
+			if tt.user != "" {
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: tt.user}}}}
+			}
+			h := &AuthHandler{AuthService: tt.service}
+			middleware.CertAuth(http.HandlerFunc(h.IssueToken)).ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rec.Code)
+			}
+			if tt.expectedCode == http.StatusOK {
+				var payload map[string]any
+				if err := json.NewDecoder(rec.Body).Decode(&payload); err != nil {
+					t.Fatalf("failed to decode JSON: %v", err)
+				}
+				if payload["token"] != "t1" || payload["lease_id"] != "lease1" {
+					t.Errorf("expected token=%q and lease_id=%q, got %v", "t1", "lease1", payload)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/atinyakov/GophKeeper/internal/problem"
+)
+
+// ExportService defines the interface for exporting the data of a user
+// required by the ExportHandler.
+type ExportService interface {
+	// Export passes every secret of the user, including tombstones, to
+	// emit and returns the rest of the user's data by JSON field name.
+	Export(ctx context.Context, userID string, emit func(models.Secret) error) (map[string]any, error)
+}
+
+// ExportHandler serves a takeout of everything the server stores about the
+// authenticated user.
+type ExportHandler struct {
+	ExportService ExportService
+}
+
+// Export handles GET /api/export requests. The response is a JSON object
+// with the "secrets" of the user, including the tombstones of deleted ones,
+// followed by "audit", "checksum", "devices", "exported_at" and "user". Secrets are
+// streamed like sync responses; a failure after the response was started
+// cuts it short.
+func (h *ExportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := middleware.GetUserIDFromContext(ctx)
+
+	w.Header().Set("Content-Disposition", `attachment; filename="gophkeeper-export.json"`)
+	resp := &syncResponse{w: w, begin: time.Now()}
+	result, err := h.ExportService.Export(ctx, userID, resp.secret)
+	if err != nil {
+		if !resp.started {
+			w.Header().Del("Content-Disposition")
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, err.Error())
+		}
+		return
+	}
+	_ = resp.finish(result)
+}
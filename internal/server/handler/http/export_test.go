@@ -0,0 +1,82 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+	handler "github.com/atinyakov/GophKeeper/internal/server/handler/http"
+)
+
+// fakeExportService emits secrets and returns a preconfigured result.
+type fakeExportService struct {
+	secrets []models.Secret
+	result  map[string]any
+	err     error
+}
+
+func (f *fakeExportService) Export(ctx context.Context, userID string, emit func(models.Secret) error) (map[string]any, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	for _, sec := range f.secrets {
+		if err := emit(sec); err != nil {
+			return nil, err
+		}
+	}
+	return f.result, nil
+}
+
+func TestExportHandler(t *testing.T) {
+	fake := &fakeExportService{
+		secrets: []models.Secret{{ID: "a", Version: 1}, {ID: "b", Version: 2, Deleted: true}},
+		result: map[string]any{
+			"user":        "alice",
+			"exported_at": int64(1000),
+			"devices":     []models.Device{{ID: "ff", LastSync: 900}},
+			"audit":       []models.AuditEvent{},
+		},
+	}
+	h := &handler.ExportHandler{ExportService: fake}
+
+	w := httptest.NewRecorder()
+	h.Export(w, httptest.NewRequest(http.MethodGet, "/api/export", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", w.Code, http.StatusOK)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd == "" {
+		t.Error("missing Content-Disposition header")
+	}
+	var got struct {
+		User       string           `json:"user"`
+		ExportedAt int64            `json:"exported_at"`
+		Secrets    []models.Secret  `json:"secrets"`
+		Devices    []models.Device  `json:"devices"`
+		Audit      []map[string]any `json:"audit"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode response JSON: %v", err)
+	}
+	if got.User != "alice" || got.ExportedAt != 1000 || len(got.Secrets) != 2 || !got.Secrets[1].Deleted || len(got.Devices) != 1 {
+		t.Errorf("export = %+v; want both secrets, the device and the user", got)
+	}
+}
+
+func TestExportHandler_Error(t *testing.T) {
+	h := &handler.ExportHandler{ExportService: &fakeExportService{err: errors.New("db down")}}
+
+	w := httptest.NewRecorder()
+	h.Export(w, httptest.NewRequest(http.MethodGet, "/api/export", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusInternalServerError)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != "" {
+		t.Errorf("Content-Disposition = %q on error; want none", cd)
+	}
+}
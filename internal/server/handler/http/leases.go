@@ -0,0 +1,116 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/atinyakov/GophKeeper/internal/problem"
+	"github.com/go-chi/chi/v5"
+)
+
+// leaseRequest is the optional body of POST /api/tokens and
+// POST /api/leases/{id}/renew.
+type leaseRequest struct {
+	// TTL is the lifetime of the token in seconds.
+	TTL int64 `json:"ttl"`
+}
+
+// decodeOptional decodes the JSON body r into v, leaving v alone if the
+// body is empty.
+func decodeOptional(r io.Reader, v any) error {
+	if err := json.NewDecoder(r).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// viaToken answers r with 403 Forbidden and reports true if it was
+// authenticated with an API token: its holder may neither issue tokens nor
+// renew leases, so that no token outlives the lease it was granted with.
+func viaToken(w http.ResponseWriter, r *http.Request) bool {
+	if middleware.GetDeviceIDFromContext(r.Context()) != middleware.TokenDeviceID {
+		return false
+	}
+	problem.Write(w, r, http.StatusForbidden, problem.CodeUnauthorized, "not allowed with an API token")
+	return true
+}
+
+// Leases handles GET /api/leases requests.
+// It responds with the leases of the user's API tokens as {"leases": [...]},
+// oldest first, including expired ones, each with the last time a secret
+// was sent to the token and the number of secrets sent.
+func (h *AuthHandler) Leases(w http.ResponseWriter, r *http.Request) {
+	login := middleware.GetUserIDFromContext(r.Context())
+
+	leases, err := h.AuthService.Leases(r.Context(), login)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, err.Error())
+		return
+	}
+	if leases == nil {
+		leases = []models.Lease{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"leases": leases})
+}
+
+// RenewLease handles POST /api/leases/{id}/renew requests.
+// It extends the lease to expire {"ttl": seconds} from now, or its own TTL
+// if the body is empty, and responds with the renewed lease. Expired
+// leases cannot be renewed, so that a leaked token stays dead, and
+// requests authenticated with an API token are refused with 403
+// Forbidden, so that a token cannot keep itself alive.
+func (h *AuthHandler) RenewLease(w http.ResponseWriter, r *http.Request) {
+	if viaToken(w, r) {
+		return
+	}
+	login := middleware.GetUserIDFromContext(r.Context())
+	var req leaseRequest
+	if err := decodeOptional(r.Body, &req); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "invalid body")
+		return
+	}
+
+	lease, err := h.AuthService.RenewLease(r.Context(), login, chi.URLParam(r, "id"), time.Duration(req.TTL)*time.Second)
+	if err != nil {
+		writeLeaseError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(lease)
+}
+
+// RevokeLease handles DELETE /api/leases/{id} requests.
+// It revokes the API token of the lease, which is rejected from then on,
+// and responds with 204 No Content.
+func (h *AuthHandler) RevokeLease(w http.ResponseWriter, r *http.Request) {
+	login := middleware.GetUserIDFromContext(r.Context())
+
+	if err := h.AuthService.RevokeLease(r.Context(), login, chi.URLParam(r, "id")); err != nil {
+		writeLeaseError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeLeaseError answers r with the problem details of a failed lease
+// operation.
+func writeLeaseError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, models.ErrLeaseNotFound):
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, err.Error())
+	case errors.Is(err, models.ErrLeaseExpired):
+		problem.Write(w, r, http.StatusGone, problem.CodeLeaseExpired, err.Error())
+	case errors.Is(err, models.ErrInvalidTTL):
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, err.Error())
+	default:
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, err.Error())
+	}
+}
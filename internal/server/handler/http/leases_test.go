@@ -0,0 +1,161 @@
+package http
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// leaseRouter serves the lease endpoints of h to alice.
+func leaseRouter(h *AuthHandler) http.Handler {
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "alice"}}}}
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Use(middleware.CertAuth)
+	r.Post("/api/tokens", h.IssueToken)
+	r.Get("/api/leases", h.Leases)
+	r.Post("/api/leases/{id}/renew", h.RenewLease)
+	r.Delete("/api/leases/{id}", h.RevokeLease)
+	return r
+}
+
+func TestAuthHandler_IssueTokenWithTTL(t *testing.T) {
+	svc := &fakeAuthService{token: "t1"}
+	router := leaseRouter(&AuthHandler{AuthService: svc})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/tokens", strings.NewReader(`{"ttl":3600}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	if svc.ttl != time.Hour {
+		t.Errorf("ttl = %s; want 1h", svc.ttl)
+	}
+	var payload struct {
+		Token     string `json:"token"`
+		LeaseID   string `json:"lease_id"`
+		ExpiresAt int64  `json:"expires_at"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&payload); err != nil {
+		t.Fatalf("failed to decode JSON: %v", err)
+	}
+	if payload.Token != "t1" || payload.LeaseID != "lease1" || payload.ExpiresAt != 4600 {
+		t.Errorf("response = %+v", payload)
+	}
+
+	svc.tokenErr = models.ErrInvalidTTL
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/tokens", strings.NewReader(`{"ttl":-1}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid ttl: status = %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAuthHandler_Leases(t *testing.T) {
+	svc := &fakeAuthService{leases: []models.Lease{{ID: "l1", IssuedAt: 10, TTL: 60, ExpiresAt: 70, LastFetch: 20, Fetched: 2}}}
+	router := leaseRouter(&AuthHandler{AuthService: svc})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/leases", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	var payload struct {
+		Leases []models.Lease `json:"leases"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&payload); err != nil {
+		t.Fatalf("failed to decode JSON: %v", err)
+	}
+	if !reflect.DeepEqual(payload.Leases, svc.leases) {
+		t.Errorf("leases = %+v; want %+v", payload.Leases, svc.leases)
+	}
+}
+
+func TestAuthHandler_RenewAndRevokeLease(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		err      error
+		wantCode int
+		wantTTL  time.Duration
+	}{
+		{"renew", http.MethodPost, "/api/leases/l1/renew", "", nil, http.StatusOK, 0},
+		{"renew with ttl", http.MethodPost, "/api/leases/l1/renew", `{"ttl":60}`, nil, http.StatusOK, time.Minute},
+		{"renew bad body", http.MethodPost, "/api/leases/l1/renew", `{`, nil, http.StatusBadRequest, 0},
+		{"renew unknown", http.MethodPost, "/api/leases/l1/renew", "", models.ErrLeaseNotFound, http.StatusNotFound, 0},
+		{"renew expired", http.MethodPost, "/api/leases/l1/renew", "", models.ErrLeaseExpired, http.StatusGone, 0},
+		{"revoke", http.MethodDelete, "/api/leases/l1", "", nil, http.StatusNoContent, 0},
+		{"revoke unknown", http.MethodDelete, "/api/leases/l1", "", models.ErrLeaseNotFound, http.StatusNotFound, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeAuthService{leaseErr: tt.err}
+			router := leaseRouter(&AuthHandler{AuthService: svc})
+
+			var body io.Reader = http.NoBody
+			if tt.body != "" {
+				body = bytes.NewBufferString(tt.body)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, body))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d; want %d", rec.Code, tt.wantCode)
+			}
+			if svc.ttl != tt.wantTTL {
+				t.Errorf("ttl = %s; want %s", svc.ttl, tt.wantTTL)
+			}
+			if tt.method == http.MethodDelete && svc.revoked != "l1" {
+				t.Errorf("revoked = %q; want l1", svc.revoked)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_LeasesRefuseTokens(t *testing.T) {
+	svc := &fakeAuthService{token: "t1"}
+	h := &AuthHandler{AuthService: svc}
+	r := chi.NewRouter()
+	r.Use(middleware.TokenAuth(svc))
+	r.Post("/api/tokens", h.IssueToken)
+	r.Post("/api/leases/{id}/renew", h.RenewLease)
+	r.Delete("/api/leases/{id}", h.RevokeLease)
+
+	for _, tt := range []struct {
+		method, path string
+		wantCode     int
+	}{
+		{http.MethodPost, "/api/tokens", http.StatusForbidden},
+		{http.MethodPost, "/api/leases/lease1/renew", http.StatusForbidden},
+		{http.MethodDelete, "/api/leases/lease1", http.StatusNoContent},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"ttl":60}`))
+		req.Header.Set("Authorization", "Bearer t1")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s %s: status = %d; want %d", tt.method, tt.path, rec.Code, tt.wantCode)
+		}
+	}
+	if svc.ttl != 0 {
+		t.Errorf("ttl = %s; want no token issued nor lease renewed", svc.ttl)
+	}
+}
@@ -0,0 +1,101 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/atinyakov/GophKeeper/internal/problem"
+	"github.com/go-chi/chi/v5"
+)
+
+// NotificationService defines the interface for managing notification
+// channels required by the NotificationHandler.
+type NotificationService interface {
+	// Channels returns the notification channels of the user.
+	Channels(ctx context.Context, login string) ([]models.NotificationChannel, error)
+	// AddChannel validates and stores a notification channel of the user.
+	AddChannel(ctx context.Context, login string, c models.NotificationChannel) (*models.NotificationChannel, error)
+	// DeleteChannel removes the user's notification channel with the given ID.
+	DeleteChannel(ctx context.Context, login string, id int64) error
+}
+
+// NotificationHandler serves the notification channels of the
+// authenticated user.
+type NotificationHandler struct {
+	NotificationService NotificationService
+}
+
+// Channels handles GET /api/notifications/channels requests.
+// It responds with the user's channels as {"channels": [...]}.
+func (h *NotificationHandler) Channels(w http.ResponseWriter, r *http.Request) {
+	login := middleware.GetUserIDFromContext(r.Context())
+
+	channels, err := h.NotificationService.Channels(r.Context(), login)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, err.Error())
+		return
+	}
+	if channels == nil {
+		channels = []models.NotificationChannel{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"channels": channels})
+}
+
+// AddChannel handles POST /api/notifications/channels requests.
+// It expects {"kind", "target", "events"} and responds with 201 Created and
+// the stored channel. Invalid channels are rejected with 400 Bad Request.
+func (h *NotificationHandler) AddChannel(w http.ResponseWriter, r *http.Request) {
+	login := middleware.GetUserIDFromContext(r.Context())
+	var req models.NotificationChannel
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "invalid body")
+		return
+	}
+
+	c, err := h.NotificationService.AddChannel(r.Context(), login, req)
+	if err != nil {
+		writeChannelError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(c)
+}
+
+// DeleteChannel handles DELETE /api/notifications/channels/{id} requests
+// and responds with 204 No Content.
+func (h *NotificationHandler) DeleteChannel(w http.ResponseWriter, r *http.Request) {
+	login := middleware.GetUserIDFromContext(r.Context())
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, models.ErrChannelNotFound.Error())
+		return
+	}
+
+	if err := h.NotificationService.DeleteChannel(r.Context(), login, id); err != nil {
+		writeChannelError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeChannelError answers r with the problem details of a failed channel
+// operation.
+func writeChannelError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, models.ErrChannelNotFound):
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, err.Error())
+	case errors.Is(err, models.ErrInvalidChannel):
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, err.Error())
+	default:
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, err.Error())
+	}
+}
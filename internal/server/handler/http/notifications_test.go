@@ -0,0 +1,102 @@
+package http_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	handler "github.com/atinyakov/GophKeeper/internal/server/handler/http"
+	"github.com/go-chi/chi/v5"
+)
+
+// fakeNotificationService keeps the channels of one user and rejects
+// email channels.
+type fakeNotificationService struct {
+	login    string
+	channels []models.NotificationChannel
+}
+
+func (f *fakeNotificationService) Channels(_ context.Context, login string) ([]models.NotificationChannel, error) {
+	f.login = login
+	return f.channels, nil
+}
+
+func (f *fakeNotificationService) AddChannel(_ context.Context, login string, c models.NotificationChannel) (*models.NotificationChannel, error) {
+	if c.Kind == "email" {
+		return nil, fmt.Errorf("%w: email notifications are not enabled on this server", models.ErrInvalidChannel)
+	}
+	f.login = login
+	c.ID = int64(len(f.channels) + 1)
+	f.channels = append(f.channels, c)
+	return &c, nil
+}
+
+func (f *fakeNotificationService) DeleteChannel(_ context.Context, login string, id int64) error {
+	if id != 1 {
+		return fmt.Errorf("%w: %d", models.ErrChannelNotFound, id)
+	}
+	f.channels = nil
+	return nil
+}
+
+// notificationRouter serves the endpoints of h to alice.
+func notificationRouter(h *handler.NotificationHandler) http.Handler {
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "alice"}}}}
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Use(middleware.CertAuth)
+	r.Get("/api/notifications/channels", h.Channels)
+	r.Post("/api/notifications/channels", h.AddChannel)
+	r.Delete("/api/notifications/channels/{id}", h.DeleteChannel)
+	return r
+}
+
+func TestNotificationHandler(t *testing.T) {
+	svc := &fakeNotificationService{}
+	router := notificationRouter(&handler.NotificationHandler{NotificationService: svc})
+	serve := func(method, body string, path ...string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, "/api/notifications/channels"+strings.Join(path, ""), strings.NewReader(body)))
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "")
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"channels":[]}` {
+		t.Errorf("empty list: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(http.MethodPost, `{"kind":"ntfy","target":"https://ntfy.sh/alice","events":["new-device"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("add: status = %d; want %d (%s)", rec.Code, http.StatusCreated, rec.Body)
+	}
+	var c models.NotificationChannel
+	if err := json.NewDecoder(rec.Body).Decode(&c); err != nil || c.ID != 1 || svc.login != "alice" {
+		t.Errorf("added %+v (%v) for %q; want channel 1 of alice", c, err, svc.login)
+	}
+
+	if rec := serve(http.MethodPost, `{"kind":"email","target":"alice@example.com"}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "not enabled") {
+		t.Errorf("add email: %d %s; want 400", rec.Code, rec.Body)
+	}
+	if rec := serve(http.MethodPost, `{`); rec.Code != http.StatusBadRequest {
+		t.Errorf("add malformed: status = %d; want 400", rec.Code)
+	}
+
+	for path, want := range map[string]int{"/2": http.StatusNotFound, "/x": http.StatusNotFound, "/1": http.StatusNoContent} {
+		if rec := serve(http.MethodDelete, "", path); rec.Code != want {
+			t.Errorf("DELETE %s: status = %d; want %d", path, rec.Code, want)
+		}
+	}
+}
@@ -6,59 +6,323 @@ import (
 	"net/http"
 
 	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/problem"
 	"go.uber.org/zap"
 
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 )
 
+// RouterOption customizes the router built by NewRouter.
+type RouterOption func(*routerOptions)
+
+// routerOptions collects the settings applied by RouterOption values.
+type routerOptions struct {
+	// withoutRegister omits the public registration endpoint.
+	withoutRegister bool
+	// cors enables the CORS middleware when non-nil.
+	cors *middleware.CORSConfig
+	// webUI serves the embedded web interface under /ui when non-nil.
+	webUI http.Handler
+	// sessions enables cookie-based browser sessions when non-nil.
+	sessions *SessionHandler
+	// version serves GET /api/version when non-nil.
+	version *VersionHandler
+	// export serves GET /api/export when non-nil.
+	export *ExportHandler
+	// notifications serves /api/notifications/channels when non-nil.
+	notifications *NotificationHandler
+	// accounts serves /api/account/rename when non-nil.
+	accounts *AccountHandler
+	// certs binds client certificates to users when non-nil.
+	certs middleware.CertificateValidator
+	// seen records the authenticated requests of devices when non-nil.
+	seen middleware.SeenRecorder
+	// syncLimit caps the concurrent syncs and purges of a user when
+	// positive.
+	syncLimit int
+}
+
+// WithoutRegister omits POST /api/register and POST /api/recover from the
+// router. It is used when the main listener requires client certificates at
+// the TLS layer and registration is served by a dedicated listener (see
+// NewRegisterRouter).
+func WithoutRegister() RouterOption {
+	return func(o *routerOptions) {
+		o.withoutRegister = true
+	}
+}
+
+// WithCORS enables the CORS middleware with the given configuration. It runs
+// before all other middleware so that preflight requests are answered without
+// a client certificate.
+func WithCORS(cfg middleware.CORSConfig) RouterOption {
+	return func(o *routerOptions) {
+		o.cors = &cfg
+	}
+}
+
+// WithWebUI serves the given handler under /ui/ outside of API
+// authentication. The handler receives paths with the /ui prefix stripped.
+func WithWebUI(h http.Handler) RouterOption {
+	return func(o *routerOptions) {
+		o.webUI = h
+	}
+}
+
+// WithSessions enables cookie-based browser sessions: the SessionAuth
+// middleware and the /api/session endpoints served by h.
+func WithSessions(h *SessionHandler) RouterOption {
+	return func(o *routerOptions) {
+		o.sessions = h
+	}
+}
+
+// WithVersion serves GET /api/version from h without authentication.
+func WithVersion(h *VersionHandler) RouterOption {
+	return func(o *routerOptions) {
+		o.version = h
+	}
+}
+
+// WithExport serves GET /api/export from h, behind API authentication.
+func WithExport(h *ExportHandler) RouterOption {
+	return func(o *routerOptions) {
+		o.export = h
+	}
+}
+
+// WithNotifications serves the /api/notifications/channels endpoints from
+// h, behind API authentication.
+func WithNotifications(h *NotificationHandler) RouterOption {
+	return func(o *routerOptions) {
+		o.notifications = h
+	}
+}
+
+// WithAccounts serves POST /api/account/rename from h, behind API
+// authentication.
+func WithAccounts(h *AccountHandler) RouterOption {
+	return func(o *routerOptions) {
+		o.accounts = h
+	}
+}
+
+// WithCertBinding accepts client certificates only if v has them on record
+// for the user they name, see middleware.CertBinding.
+func WithCertBinding(v middleware.CertificateValidator) RouterOption {
+	return func(o *routerOptions) {
+		o.certs = v
+	}
+}
+
+// WithLastSeen records every authenticated API request with rec, see
+// middleware.LastSeen.
+func WithLastSeen(rec middleware.SeenRecorder) RouterOption {
+	return func(o *routerOptions) {
+		o.seen = rec
+	}
+}
+
+// WithSyncConcurrency serves at most n sync, purge and import requests of each user
+// at a time, see middleware.ConcurrencyLimit.
+func WithSyncConcurrency(n int) RouterOption {
+	return func(o *routerOptions) {
+		o.syncLimit = n
+	}
+}
+
+// newRouterOptions applies opts to a zero routerOptions value.
+func newRouterOptions(opts []RouterOption) routerOptions {
+	var o routerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
 // NewRouter constructs and returns an HTTP handler that serves
 // the GophKeeper API. It applies JSON content-type enforcement,
-// request logging, and certificate-based authentication, and
-// mounts the registration, login, and sync endpoints under /api.
+// request logging, and certificate- or token-based authentication,
+// and mounts the registration, login, token and sync endpoints under /api.
 //
 // Parameters:
 //
 //	authHandler  - handler for registration and login endpoints
 //	syncHandler  - handler for secret synchronization endpoint
 //	logger       - structured logger for request logging middleware
+//	opts         - optional RouterOption values
 //
 // Routes:
 //
 //	POST /api/register   → authHandler.Register
+//	POST /api/recover    → authHandler.Recover
 //	POST /api/login      → authHandler.Login
-//	POST /api/sync       → syncHandler.Sync (protected by CertAuth)
+//	POST /api/renew      → authHandler.Renew (protected)
+//	POST /api/tokens     → authHandler.IssueToken (protected)
+//	GET  /api/leases     → authHandler.Leases (protected)
+//	POST /api/leases/{id}/renew → authHandler.RenewLease (protected)
+//	DELETE /api/leases/{id}     → authHandler.RevokeLease (protected)
+//	POST /api/sync       → syncHandler.Sync (protected)
+//	GET  /api/sync/watch → syncHandler.Watch (protected)
+//	GET  /api/stats      → syncHandler.Stats (protected)
+//	POST /api/purge      → syncHandler.Purge (protected)
+//	POST /api/secrets/import → syncHandler.Import (protected)
+//	GET  /api/secrets/{id}/access-log → syncHandler.AccessLog (protected)
+//	GET  /api/export     → ExportHandler.Export (protected, only with WithExport)
+//	GET  /api/notifications/channels         → NotificationHandler.Channels (protected, only with WithNotifications)
+//	POST /api/notifications/channels         → NotificationHandler.AddChannel (protected, only with WithNotifications)
+//	DELETE /api/notifications/channels/{id}  → NotificationHandler.DeleteChannel (protected, only with WithNotifications)
+//	POST /api/account/rename → AccountHandler.Rename (protected, only with WithAccounts)
+//	POST /api/session         → SessionHandler.Create (only with WithSessions)
+//	POST /api/session/refresh → SessionHandler.Refresh (only with WithSessions)
+//	POST /api/session/logout  → SessionHandler.Logout (only with WithSessions)
+//	GET  /api/version    → VersionHandler.Get (only with WithVersion)
+//	GET  /ui/*           → embedded web UI (only with WithWebUI)
 //
 // Middleware chain (applied in order):
-//  1. AllowContentType("application/json") — rejects non-JSON requests
+//  0. CORS (only with WithCORS)          — answers cross-origin requests
+//  1. AllowContentType("application/json", "application/x-ndjson") — rejects
+//     non-JSON requests
 //  2. WithRequestLogging(logger)         — logs incoming requests
-//  3. CertAuth                          — enforces TLS client certificate auth
+//  3. SessionAuth (/api, WithSessions)   — accepts browser session cookies
+//  4. TokenAuth (/api only)              — accepts API bearer tokens
+//  5. CertAuth (/api only)               — enforces TLS client certificate auth
+//  6. CertBinding (/api, WithCertBinding) — rejects certificates not on record
+//  7. LastSeen (/api, WithLastSeen)       — records when devices were last seen
+//  8. ConcurrencyLimit (/api/sync, /api/purge and /api/secrets/import,
+//     WithSyncConcurrency) — caps the concurrent requests of a user
 func NewRouter(
 	authHandler *AuthHandler,
 	syncHandler *SyncHandler,
 	logger *zap.Logger,
+	opts ...RouterOption,
 ) http.Handler {
+	o := newRouterOptions(opts)
+
 	r := chi.NewRouter()
 
-	// Only allow requests with Content-Type: application/json
-	r.Use(chiMiddleware.AllowContentType("application/json"))
+	// Tag each request with an ID for the logs and error responses, and
+	// answer unknown routes with problem details too
+	r.Use(chiMiddleware.RequestID)
+	r.NotFound(problem.NotFound)
+	r.MethodNotAllowed(problem.MethodNotAllowed)
+
+	// Answer cross-origin requests from allowed browser clients
+	if o.cors != nil {
+		r.Use(middleware.CORS(*o.cors))
+	}
+
+	// Only allow JSON requests, or NDJSON for imports
+	r.Use(chiMiddleware.AllowContentType("application/json", "application/x-ndjson"))
 
 	// Log each request and its metadata
 	r.Use(middleware.WithRequestLogging(logger))
-	// Enforce certificate-based authentication
-	r.Use(middleware.CertAuth)
+
+	// Serve the embedded web UI without API authentication
+	if o.webUI != nil {
+		r.Get("/ui", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/ui/", http.StatusMovedPermanently)
+		})
+		r.Handle("/ui/*", http.StripPrefix("/ui", o.webUI))
+	}
+
+	// Serve the version without API authentication
+	if o.version != nil {
+		r.Get("/api/version", o.version.Get)
+	}
 
 	// Mount API routes
 	r.Route("/api", func(r chi.Router) {
+		// Accept browser sessions and API bearer tokens, then enforce
+		// certificate-based authentication
+		if o.sessions != nil {
+			r.Use(middleware.SessionAuth(o.sessions.SessionService))
+		}
+		r.Use(middleware.TokenAuth(authHandler.AuthService))
+		r.Use(middleware.CertAuth)
+		if o.certs != nil {
+			r.Use(middleware.CertBinding(o.certs))
+		}
+		if o.seen != nil {
+			r.Use(middleware.LastSeen(o.seen))
+		}
+
 		// Public endpoints
-		r.Post("/register", authHandler.Register)
+		if !o.withoutRegister {
+			r.Post("/register", authHandler.Register)
+			r.Post("/recover", authHandler.Recover)
+		}
 		r.Post("/login", authHandler.Login)
 
-		// Protected group: requires valid client certificate
+		// Protected group: requires valid client certificate or token
 		r.Group(func(r chi.Router) {
-			r.Post("/sync", syncHandler.Sync)
+			r.Post("/renew", authHandler.Renew)
+			r.Post("/tokens", authHandler.IssueToken)
+			r.Get("/leases", authHandler.Leases)
+			r.Post("/leases/{id}/renew", authHandler.RenewLease)
+			r.Delete("/leases/{id}", authHandler.RevokeLease)
+			heavy := r
+			if o.syncLimit > 0 {
+				heavy = r.With(middleware.ConcurrencyLimit(o.syncLimit))
+			}
+			heavy.Post("/sync", syncHandler.Sync)
+			r.Get("/sync/watch", syncHandler.Watch)
+			r.Get("/stats", syncHandler.Stats)
+			heavy.Post("/purge", syncHandler.Purge)
+			heavy.Post("/secrets/import", syncHandler.Import)
+			r.Get("/secrets/{id}/access-log", syncHandler.AccessLog)
+			if o.export != nil {
+				r.Get("/export", o.export.Export)
+			}
+			if o.notifications != nil {
+				r.Get("/notifications/channels", o.notifications.Channels)
+				r.Post("/notifications/channels", o.notifications.AddChannel)
+				r.Delete("/notifications/channels/{id}", o.notifications.DeleteChannel)
+			}
+			if o.accounts != nil {
+				r.Post("/account/rename", o.accounts.Rename)
+			}
+
+			if o.sessions != nil {
+				r.Post("/session", o.sessions.Create)
+				r.Post("/session/refresh", o.sessions.Refresh)
+				r.Post("/session/logout", o.sessions.Logout)
+			}
 		})
 	})
 
 	return r
 }
+
+// NewRegisterRouter constructs an HTTP handler that serves only the public
+// registration and recovery endpoints. It is mounted on a separate listener that does not
+// demand client certificates, so the main API listener can reject
+// unauthenticated clients during the TLS handshake.
+//
+// Routes:
+//
+//	POST /api/register   → authHandler.Register
+//	POST /api/recover    → authHandler.Recover
+//
+// Only the WithCORS option is honored.
+func NewRegisterRouter(authHandler *AuthHandler, logger *zap.Logger, opts ...RouterOption) http.Handler {
+	o := newRouterOptions(opts)
+
+	r := chi.NewRouter()
+	r.Use(chiMiddleware.RequestID)
+	r.NotFound(problem.NotFound)
+	r.MethodNotAllowed(problem.MethodNotAllowed)
+
+	if o.cors != nil {
+		r.Use(middleware.CORS(*o.cors))
+	}
+
+	r.Use(chiMiddleware.AllowContentType("application/json"))
+	r.Use(middleware.WithRequestLogging(logger))
+
+	r.Post("/api/register", authHandler.Register)
+	r.Post("/api/recover", authHandler.Recover)
+
+	return r
+}
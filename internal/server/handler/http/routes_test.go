@@ -0,0 +1,196 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/problem"
+	"go.uber.org/zap"
+)
+
+func TestNewRouter_WithoutRegister(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []RouterOption
+		expectedCode int
+	}{
+		{
+			name:         "register mounted by default",
+			opts:         nil,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "register omitted",
+			opts:         []RouterOption{WithoutRegister()},
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := &AuthHandler{AuthService: &fakeAuthService{}}
+			r := NewRouter(auth, &SyncHandler{}, zap.NewNop(), tt.opts...)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/register", bytes.NewBufferString(`{"login":""}`))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Errorf("status = %d; want %d", rec.Code, tt.expectedCode)
+			}
+		})
+	}
+}
+
+func TestNewRouter_ProblemDetails(t *testing.T) {
+	auth := &AuthHandler{AuthService: &fakeAuthService{}}
+	r := NewRouter(auth, &SyncHandler{}, zap.NewNop())
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode string
+	}{
+		{"handler error", "/api/register", problem.CodeInvalidRequest},
+		{"unknown route", "/nope", problem.CodeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(`{"login":""}`))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(rec, req)
+
+			if ct := rec.Header().Get("Content-Type"); ct != problem.ContentType {
+				t.Errorf("Content-Type = %q; want %q", ct, problem.ContentType)
+			}
+			var p problem.Details
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+				t.Fatalf("invalid problem details: %v", err)
+			}
+			if p.Code != tt.wantCode || p.Status != rec.Code || p.Title != http.StatusText(rec.Code) {
+				t.Errorf("problem = %+v; want code %q and status %d", p, tt.wantCode, rec.Code)
+			}
+			if p.RequestID == "" {
+				t.Error("problem without request ID")
+			}
+		})
+	}
+}
+
+func TestNewRegisterRouter(t *testing.T) {
+	auth := &AuthHandler{AuthService: &fakeAuthService{}}
+	r := NewRegisterRouter(auth, zap.NewNop())
+
+	tests := []struct {
+		name         string
+		path         string
+		expectedCode int
+	}{
+		{"register served", "/api/register", http.StatusBadRequest},
+		{"recover served", "/api/recover", http.StatusBadRequest},
+		{"sync not served", "/api/sync", http.StatusNotFound},
+		{"login not served", "/api/login", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(`{"login":""}`))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Errorf("status = %d; want %d", rec.Code, tt.expectedCode)
+			}
+		})
+	}
+}
+
+func TestNewRouter_WithCORSPreflight(t *testing.T) {
+	auth := &AuthHandler{AuthService: &fakeAuthService{}}
+	r := NewRouter(auth, &SyncHandler{}, zap.NewNop(), WithCORS(middleware.CORSConfig{
+		AllowedOrigins: []string{"https://app.example"},
+	}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodOptions, "/api/sync", nil)
+	req.Header.Set("Origin", "https://app.example")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	r.ServeHTTP(rec, req)
+
+	// Preflight must not be rejected by CertAuth.
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d; want %d", rec.Code, http.StatusNoContent)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example" {
+		t.Errorf("Allow-Origin = %q; want %q", got, "https://app.example")
+	}
+}
+
+func TestNewRouter_WithWebUI(t *testing.T) {
+	ui := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ui:" + r.URL.Path))
+	})
+	auth := &AuthHandler{AuthService: &fakeAuthService{}}
+	r := NewRouter(auth, &SyncHandler{}, zap.NewNop(), WithWebUI(ui))
+
+	// UI assets are served without a client certificate.
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/app.js", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "ui:/app.js" {
+		t.Errorf("GET /ui/app.js = %d %q; want 200 %q", rec.Code, rec.Body.String(), "ui:/app.js")
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui", nil))
+	if rec.Code != http.StatusMovedPermanently {
+		t.Errorf("GET /ui status = %d; want %d", rec.Code, http.StatusMovedPermanently)
+	}
+
+	// API routes still require authentication.
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/sync", bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST /api/sync status = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestNewRouter_WithVersion(t *testing.T) {
+	auth := &AuthHandler{AuthService: &fakeAuthService{}}
+	r := NewRouter(auth, &SyncHandler{}, zap.NewNop(), WithVersion(&VersionHandler{
+		Version:          "1.2.0",
+		GoVersion:        "go1.23.4",
+		Revision:         "1b605b7c0ffee",
+		MinClientVersion: "1.1.0",
+	}))
+
+	// The version is served without a client certificate.
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/version status = %d; want %d", rec.Code, http.StatusOK)
+	}
+	var info VersionInfo
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatalf("decode version: %v", err)
+	}
+	want := VersionInfo{Version: "1.2.0", GoVersion: "go1.23.4", Revision: "1b605b7c0ffee", Protocol: ProtocolVersion, MinProtocol: MinClientProtocol, MinClientVersion: "1.1.0"}
+	if info != want {
+		t.Errorf("version = %+v; want %+v", info, want)
+	}
+
+	// Other API routes still require authentication.
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /api/stats status = %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,111 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/atinyakov/GophKeeper/internal/problem"
+)
+
+// SessionService defines the session operations required by the SessionHandler.
+type SessionService interface {
+	// Create starts a session for the login and returns its ID and record.
+	Create(ctx context.Context, login string) (string, *models.Session, error)
+	// Refresh rotates a valid session and returns the new ID and record.
+	Refresh(ctx context.Context, id string) (string, *models.Session, error)
+	// Logout ends the session with the given ID.
+	Logout(ctx context.Context, id string) error
+	// Authenticate returns the session for id, or an error if it is invalid.
+	Authenticate(ctx context.Context, id string) (*models.Session, error)
+}
+
+// SessionHandler handles HTTP requests that issue, refresh and end
+// cookie-based browser sessions.
+type SessionHandler struct {
+	// SessionService performs the underlying session operations.
+	SessionService SessionService
+}
+
+// Create handles POST /api/session requests.
+// The caller must already be authenticated (API token or client certificate).
+// It sets the session cookie and returns the CSRF token the browser must send
+// in the X-CSRF-Token header of subsequent state-changing requests.
+func (h *SessionHandler) Create(w http.ResponseWriter, r *http.Request) {
+	login := middleware.GetUserIDFromContext(r.Context())
+	if login == "" {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	id, session, err := h.SessionService.Create(r.Context(), login)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "failed to create session")
+		return
+	}
+	writeSession(w, id, session)
+}
+
+// Refresh handles POST /api/session/refresh requests.
+// It rotates the session ID and CSRF token and extends the session lifetime.
+func (h *SessionHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(middleware.SessionCookie)
+	if err != nil {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "no session")
+		return
+	}
+
+	id, session, err := h.SessionService.Refresh(r.Context(), cookie.Value)
+	if err != nil {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidSession, "invalid session")
+		return
+	}
+	writeSession(w, id, session)
+}
+
+// Logout handles POST /api/session/logout requests.
+// It deletes the server-side session and clears the cookie.
+func (h *SessionHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(middleware.SessionCookie)
+	if err != nil {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "no session")
+		return
+	}
+
+	if err := h.SessionService.Logout(r.Context(), cookie.Value); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "failed to end session")
+		return
+	}
+
+	http.SetCookie(w, sessionCookie("", -1, time.Unix(0, 0)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeSession sets the session cookie and writes the CSRF token and expiry as JSON.
+func writeSession(w http.ResponseWriter, id string, session *models.Session) {
+	expires := time.Unix(session.ExpiresAt, 0)
+	http.SetCookie(w, sessionCookie(id, 0, expires))
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"csrf_token": session.CSRFToken,
+		"expires_at": session.ExpiresAt,
+	})
+}
+
+// sessionCookie builds a secure, HTTP-only, same-site session cookie scoped to the API.
+func sessionCookie(value string, maxAge int, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     middleware.SessionCookie,
+		Value:    value,
+		Path:     "/api",
+		Expires:  expires,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// fakeSessionService implements SessionService for testing.
+type fakeSessionService struct {
+	id         string
+	session    *models.Session
+	err        error
+	loggedOut  string
+	refreshed  string
+	createdFor string
+}
+
+func (f *fakeSessionService) Create(ctx context.Context, login string) (string, *models.Session, error) {
+	f.createdFor = login
+	return f.id, f.session, f.err
+}
+
+func (f *fakeSessionService) Refresh(ctx context.Context, id string) (string, *models.Session, error) {
+	f.refreshed = id
+	return f.id, f.session, f.err
+}
+
+func (f *fakeSessionService) Logout(ctx context.Context, id string) error {
+	f.loggedOut = id
+	return f.err
+}
+
+func (f *fakeSessionService) Authenticate(ctx context.Context, id string) (*models.Session, error) {
+	return f.session, f.err
+}
+
+func TestSessionHandler_Create(t *testing.T) {
+	svc := &fakeSessionService{id: "sid", session: &models.Session{CSRFToken: "csrf", ExpiresAt: 4102444800}}
+	h := &SessionHandler{SessionService: svc}
+
+	// Unauthenticated request
+	rec := httptest.NewRecorder()
+	h.Create(rec, httptest.NewRequest("POST", "/api/session", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	// Token-authenticated request
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/session", nil)
+	req.Header.Set("Authorization", "Bearer tok")
+	auth := &fakeAuthService{token: "tok"}
+	middleware.TokenAuth(auth)(http.HandlerFunc(h.Create)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if svc.createdFor != "token-user" {
+		t.Errorf("session created for %q; want %q", svc.createdFor, "token-user")
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != middleware.SessionCookie || cookies[0].Value != "sid" {
+		t.Fatalf("unexpected cookies: %+v", cookies)
+	}
+	if !cookies[0].HttpOnly || !cookies[0].Secure || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Errorf("session cookie is not secure: %+v", cookies[0])
+	}
+	var payload map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&payload); err != nil {
+		t.Fatalf("failed to decode JSON: %v", err)
+	}
+	if payload["csrf_token"] != "csrf" {
+		t.Errorf("expected csrf_token=%q, got %v", "csrf", payload["csrf_token"])
+	}
+}
+
+func TestSessionHandler_Refresh(t *testing.T) {
+	tests := []struct {
+		name         string
+		cookie       string
+		service      *fakeSessionService
+		expectedCode int
+	}{
+		{"no cookie", "", &fakeSessionService{}, http.StatusUnauthorized},
+		{"invalid session", "old", &fakeSessionService{err: errors.New("invalid session")}, http.StatusUnauthorized},
+		{"success", "old", &fakeSessionService{id: "new", session: &models.Session{CSRFToken: "c2"}}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/api/session/refresh", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: middleware.SessionCookie, Value: tt.cookie})
+			}
+			h := &SessionHandler{SessionService: tt.service}
+			h.Refresh(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rec.Code)
+			}
+			if tt.expectedCode == http.StatusOK {
+				if tt.service.refreshed != "old" {
+					t.Errorf("refreshed session %q; want %q", tt.service.refreshed, "old")
+				}
+				cookies := rec.Result().Cookies()
+				if len(cookies) != 1 || cookies[0].Value != "new" {
+					t.Errorf("unexpected cookies: %+v", cookies)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionHandler_Logout(t *testing.T) {
+	svc := &fakeSessionService{}
+	h := &SessionHandler{SessionService: svc}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/session/logout", nil)
+	req.AddCookie(&http.Cookie{Name: middleware.SessionCookie, Value: "sid"})
+	h.Logout(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, rec.Code)
+	}
+	if svc.loggedOut != "sid" {
+		t.Errorf("logged out session %q; want %q", svc.loggedOut, "sid")
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "" || cookies[0].MaxAge >= 0 {
+		t.Errorf("expected cleared cookie, got %+v", cookies)
+	}
+}
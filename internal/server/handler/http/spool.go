@@ -0,0 +1,104 @@
+package http
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// uploadSpool stages the secrets uploaded by a sync until the request was
+// read to the end and matched its checksum, so that a damaged body stores
+// nothing. The first UploadBatchSize secrets are held in memory; the rest
+// are written to a temporary file as they were received, each prefixed
+// with its length, so that memory does not grow with the upload. The file
+// is only created once the first batch is full and removed by close. The
+// zero value is ready to use.
+type uploadSpool struct {
+	head []models.Secret
+	f    *os.File
+	w    *bufio.Writer
+}
+
+// add stages sec, whose JSON as received is raw.
+func (s *uploadSpool) add(raw json.RawMessage, sec models.Secret) error {
+	if s.f == nil && len(s.head) < UploadBatchSize {
+		s.head = append(s.head, sec)
+		return nil
+	}
+	if s.f == nil {
+		f, err := os.CreateTemp("", "gophkeeper-upload-*")
+		if err != nil {
+			return err
+		}
+		s.f, s.w = f, bufio.NewWriter(f)
+	}
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(raw)))
+	if _, err := s.w.Write(n[:]); err != nil {
+		return err
+	}
+	_, err := s.w.Write(raw)
+	return err
+}
+
+// batches calls fn with the secrets staged, in order and up to
+// UploadBatchSize at a time, stopping at the first error of fn.
+func (s *uploadSpool) batches(fn func([]models.Secret) error) error {
+	if len(s.head) == 0 {
+		return nil
+	}
+	if err := fn(s.head); err != nil {
+		return err
+	}
+	if s.f == nil {
+		return nil
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(s.f)
+	batch := make([]models.Secret, 0, UploadBatchSize)
+	for {
+		var n [4]byte
+		if _, err := io.ReadFull(r, n[:]); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+		raw := make([]byte, binary.BigEndian.Uint32(n[:]))
+		if _, err := io.ReadFull(r, raw); err != nil {
+			return err
+		}
+		var sec models.Secret
+		if err := json.Unmarshal(raw, &sec); err != nil {
+			return err
+		}
+		if batch = append(batch, sec); len(batch) < UploadBatchSize {
+			continue
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return fn(batch)
+}
+
+// close removes the file.
+func (s *uploadSpool) close() {
+	if s.f != nil {
+		_ = s.f.Close()
+		_ = os.Remove(s.f.Name())
+	}
+}
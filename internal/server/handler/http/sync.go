@@ -2,57 +2,641 @@
 package http
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"maps"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/atinyakov/GophKeeper/internal/clock"
+	"github.com/atinyakov/GophKeeper/internal/jsonstream"
+	"github.com/atinyakov/GophKeeper/internal/limits"
 	"github.com/atinyakov/GophKeeper/internal/middleware"
 	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/atinyakov/GophKeeper/internal/problem"
+	"github.com/go-chi/chi/v5"
 )
 
 // SyncService defines the interface for synchronization operations
 // required by the SyncHandler.
 type SyncService interface {
-	// Sync processes the client's secrets and version map, returning
-	// a map containing the updated version and the slice of new/updated secrets.
+	// Upload applies a batch of the secrets submitted by the client and
+	// adds the outcome to res.
 	//   ctx:     request context for cancellation and deadlines
 	//   userID:  identifier of the authenticated user
 	//   secrets: slice of models.Secret submitted by the client
+	//   lastKnown: version of the client's last sync, 0 if unknown
+	Upload(ctx context.Context, userID string, secrets []models.Secret, lastKnown int64, res *models.UploadResult) error
+	// Respond completes the sync after the uploads, passing the
+	// new/updated secrets to emit one at a time.
+	//   uploaded: the outcome of the uploads, see Upload
 	//   versions: map of secret ID to version held by the client
-	// Returns a map with keys "version" (int64) and "secrets" ([]models.Secret),
-	// or an error if syncing fails.
-	Sync(ctx context.Context, userID string, secrets []models.Secret, versions map[string]int64) (map[string]any, error)
+	//   filter:  the part of the vault the client syncs
+	//   emit:    called with each matching secret newer than the client's version
+	// Returns a map with the keys "version" (int64), "updated", "skipped"
+	// and "restored" ([]string) and "conflicts" ([]models.Conflict), or an
+	// error if syncing fails.
+	Respond(ctx context.Context, userID string, uploaded models.UploadResult, versions map[string]int64, filter models.SyncFilter, emit func(models.Secret) error) (map[string]any, error)
+	// RecordSync marks a successful sync of the given device of the user.
+	RecordSync(ctx context.Context, userID, deviceID string) error
+	// Stats summarizes the user's stored vault and devices.
+	Stats(ctx context.Context, userID string) (*models.Stats, error)
+	// ETag returns an entity tag of the user's live secrets that changes
+	// whenever one of them is stored or deleted, or the filter changes.
+	ETag(ctx context.Context, userID string, filter models.SyncFilter) (string, error)
+	// Tombstones returns the tombstones of the user's deleted secrets,
+	// limited to those of the secrets in versions unless it is nil.
+	Tombstones(ctx context.Context, userID string, versions map[string]int64) ([]models.Secret, error)
+	// Purge permanently removes the user's deleted secrets with the given
+	// IDs and returns the IDs removed.
+	Purge(ctx context.Context, userID string, ids []string) ([]string, error)
+	// RecordAccess records that the given device of the user fetched the
+	// secrets with the given IDs.
+	RecordAccess(ctx context.Context, userID, deviceID string, ids []string) error
+	// AccessLog returns the recent accesses of the user's secret with the
+	// given ID, newest first.
+	AccessLog(ctx context.Context, userID, id string) ([]models.SecretAccess, error)
+	// Import stores the secrets returned by next in batches until it
+	// returns io.EOF, see service.SyncService.Import.
+	Import(ctx context.Context, userID string, next func() (models.Secret, error)) (models.ImportResult, error)
+	// Changes passes the user's secrets with the given IDs matching filter
+	// and the tombstones of those deleted to emit, see
+	// service.SyncService.Changes.
+	Changes(ctx context.Context, userID string, ids []string, filter models.SyncFilter, emit func(models.Secret) error) error
+	// VaultKDF stores kdf unless the user's vault has key derivation
+	// parameters already and returns those stored, "" if none.
+	VaultKDF(ctx context.Context, userID, kdf string) (string, error)
 }
 
+// maxPurgeIDs is the most secret IDs a purge request may name.
+const maxPurgeIDs = 10000
+
+// UploadBatchSize is the number of uploaded secrets a sync applies at a
+// time, as service.ImportBatchSize for imports.
+const UploadBatchSize = 500
+
+// maxKDFSize is the most bytes the key derivation parameters of a vault may
+// take, see CheckKDF.
+const maxKDFSize = 4 << 10
+
 // SyncHandler handles HTTP requests for secret synchronization.
 type SyncHandler struct {
 	SyncService SyncService
+	// Clock tells the time uploaded versions are checked against;
+	// clock.Real when nil.
+	Clock clock.Clock
+
+	// events notifies the watch streams of vault changes, see Watch.
+	events syncEvents
 }
 
 // Sync handles POST /api/sync requests.
-// It decodes a JSON body with "secrets" and "versions",
-// invokes the SyncService, and writes the resulting map as JSON.
+// It decodes a JSON body with "secrets", "versions" and an optional
+// "filter" (see models.SyncFilter) restricting the secrets returned to
+// part of the vault, "include_deleted" asking for the tombstones of
+// deleted secrets along, and "last_known_version", the version of the
+// client's last sync, against which concurrent edits are told apart (see
+// models.Conflict), and "kdf", the parameters the client derives the vault
+// key with, invokes the SyncService and writes the result as JSON. The
+// result carries the "kdf" of the vault, so that new devices derive the
+// same key. Secrets are decoded and encoded one at a time, and the
+// uploaded ones staged on disk until the body was read, then applied in
+// batches, see Upload, so the body is never held in memory as a whole. If
+// the sync fails after the response was started, the response is cut
+// short, which clients detect as truncated JSON.
+//
+// Both bodies may carry a "checksum" of their secrets, see
+// jsonstream.Checksum; the response always does. A request not matching
+// its checksum is rejected with jsonstream.ChecksumMismatchCode before any
+// of its secrets is stored, as are requests with a secret rejected by
+// CheckUpload with its error.
+//
+// Syncs that upload nothing carry the ETag of the user's vault. If the
+// request's If-None-Match header names it, nothing changed since the
+// client's last sync and the response is 304 Not Modified without a body.
 func (h *SyncHandler) Sync(w http.ResponseWriter, r *http.Request) {
+	begin := time.Now()
+	ctx := r.Context()
+
+	req, err := h.decodeSyncRequest(ctx, r.Body)
+	var p *problem.Error
+	if errors.As(err, &p) {
+		if p.Code == limits.FutureVersionCode {
+			w.Header().Set(limits.ErrorCodeHeader, limits.FutureVersionCode)
+		}
+		problem.WriteError(w, r, p)
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "invalid body")
+		return
+	}
+
+	// Answer polls of clients that are up to date without a body
+	if etag, unchanged := h.Unchanged(ctx, req, r.Header.Get("If-None-Match")); etag != "" {
+		w.Header().Set("ETag", etag)
+		if unchanged {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	resp := &syncResponse{w: w, begin: begin}
+	result, err := h.Apply(ctx, req, resp.secret)
+	if err != nil {
+		if !resp.started {
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, err.Error())
+		}
+		return
+	}
+	_ = resp.finish(result)
+}
+
+// SyncRequest is a sync of the authenticated user's vault as received by
+// the HTTP or the gRPC API.
+type SyncRequest struct {
+	// Uploads is the number of secrets uploaded, each checked with
+	// CheckUpload and applied by Upload.
+	Uploads int
+	// Uploaded is the outcome of the secrets uploaded, see Upload.
+	Uploaded models.UploadResult
+	// Versions maps the IDs of the secrets the client holds to their
+	// versions.
+	Versions map[string]int64
+	// LastKnownVersion is the version of the client's last sync, 0 if it
+	// never synced or did not tell. Uploads the server changed since too
+	// are reported as concurrent conflicts rather than stored, so it is
+	// set before the secrets are applied.
+	LastKnownVersion int64
+	// Filter restricts the secrets returned to part of the vault.
+	Filter models.SyncFilter
+	// IncludeDeleted asks for the tombstones of deleted secrets after the
+	// secrets, so that the client drops its copies; see
+	// SyncService.Tombstones.
+	IncludeDeleted bool
+	// KDF is the JSON of the parameters the client derives the vault key
+	// with, checked with CheckKDF; "" if not sent. It is stored for the
+	// user's other devices unless the server holds some already.
+	KDF string
+}
+
+// CheckKDF checks the key derivation parameters sent by a sync: the server
+// does not interpret them, but they must be a JSON object of at most
+// maxKDFSize bytes. Errors are *problem.Error.
+func CheckKDF(kdf string) error {
+	var params map[string]json.RawMessage
+	if len(kdf) > maxKDFSize || json.Unmarshal([]byte(kdf), &params) != nil || params == nil {
+		return problem.New(http.StatusBadRequest, problem.CodeInvalidRequest, "invalid kdf")
+	}
+	return nil
+}
+
+// CheckUpload checks a secret uploaded by a sync at time now: its payload
+// must not exceed the limit of its type, and its version must not be too
+// far ahead of now. Tombstones are not checked, so that secrets stored
+// before the limits can still be deleted. Errors are *problem.Error, with
+// the code limits.FutureVersionCode for versions ahead of now.
+func CheckUpload(sec models.Secret, now time.Time) error {
+	if sec.Deleted {
+		return nil
+	}
+	if err := limits.CheckEncoded(sec.ID, sec.Type, sec.Data); err != nil {
+		return problem.New(http.StatusRequestEntityTooLarge, problem.CodeTooLarge, err.Error())
+	}
+	if err := limits.CheckVersion(sec.ID, sec.Version, now); err != nil {
+		return problem.New(http.StatusUnprocessableEntity, limits.FutureVersionCode, err.Error())
+	}
+	return nil
+}
+
+// Now returns the time uploaded secrets are checked against, see
+// CheckUpload.
+func (h *SyncHandler) Now() time.Time {
+	return cmp.Or(h.Clock, clock.Real).Now()
+}
+
+// Upload checks a batch of the secrets uploaded by req with CheckUpload
+// and applies them, adding the outcome to req.Uploaded. Syncs call it with
+// up to UploadBatchSize secrets at a time, so that the uploads are never
+// held in memory as a whole. The secrets stored or deleted are delivered
+// to the devices watching the vault, see Subscribe.
+// Errors are *problem.Error.
+func (h *SyncHandler) Upload(ctx context.Context, req *SyncRequest, secrets []models.Secret) error {
+	if len(secrets) == 0 {
+		return nil
+	}
+	now := h.Now()
+	for _, sec := range secrets {
+		if err := CheckUpload(sec, now); err != nil {
+			return err
+		}
+	}
+	userID := middleware.GetUserIDFromContext(ctx)
+	updated, deleted := len(req.Uploaded.Updated), len(req.Uploaded.Deleted)
+	if err := h.SyncService.Upload(ctx, userID, secrets, req.LastKnownVersion, &req.Uploaded); err != nil {
+		return problem.Internal(err.Error())
+	}
+	req.Uploads += len(secrets)
+	// Push the secrets stored to the other devices watching the vault
+	// right away, so that no etag covers them before they are delivered
+	changed := slices.Concat(req.Uploaded.Updated[updated:], req.Uploaded.Deleted[deleted:])
+	if len(changed) > 0 {
+		h.events.publish(userID, middleware.GetDeviceIDFromContext(ctx), Change{IDs: changed})
+	}
+	return nil
+}
+
+// Unchanged returns the ETag of the part of the vault req syncs if it
+// uploads nothing, and reports whether the If-None-Match value ifNoneMatch
+// names it, in which case the sync of the device is recorded and the
+// client is up to date. etag is empty if req uploads secrets or the tag is
+// not available.
+func (h *SyncHandler) Unchanged(ctx context.Context, req SyncRequest, ifNoneMatch string) (etag string, unchanged bool) {
+	if req.Uploads > 0 {
+		return "", false
+	}
+	userID := middleware.GetUserIDFromContext(ctx)
+	etag, err := h.SyncService.ETag(ctx, userID, req.Filter)
+	if err != nil {
+		return "", false
+	}
+	// Parameters sent for the vault are stored by Apply
+	if !etagMatch(ifNoneMatch, etag) || req.KDF != "" {
+		return etag, false
+	}
+	if deviceID := middleware.GetDeviceIDFromContext(ctx); deviceID != "" {
+		_ = h.SyncService.RecordSync(ctx, userID, deviceID)
+	}
+	return etag, true
+}
+
+// Apply completes the sync req of the authenticated user, whose secrets
+// Upload applied, passing the secrets the client lacks, followed by the
+// tombstones if req asks for them, to emit one at a time, and returns the
+// result of SyncService.Respond with the "kdf" of the vault, see
+// SyncService.VaultKDF. The secrets sent are noted in the access log,
+// the sync of the device is recorded and the devices watching the vault
+// are woken if it changed.
+func (h *SyncHandler) Apply(ctx context.Context, req SyncRequest, emit func(models.Secret) error) (map[string]any, error) {
+	userID := middleware.GetUserIDFromContext(ctx)
+
+	// Note the secrets sent to the device for the access log; tombstones
+	// carry no data and are not noted
+	var sent []string
+	result, err := h.SyncService.Respond(ctx, userID, req.Uploaded, req.Versions, req.Filter, func(sec models.Secret) error {
+		if err := emit(sec); err != nil {
+			return err
+		}
+		if !sec.Deleted {
+			sent = append(sent, sec.ID)
+		}
+		return nil
+	})
+	if err == nil && req.IncludeDeleted {
+		err = h.emitTombstones(ctx, userID, req.Versions, emit)
+	}
+	// Record the device's sync and the secrets it was sent, even if the
+	// response was cut short; this is best effort and must not fail a sync
+	// that has already been applied.
+	_ = h.SyncService.RecordAccess(ctx, userID, accessor(ctx), sent)
+	if err != nil {
+		return nil, err
+	}
+	kdf, err := h.SyncService.VaultKDF(ctx, userID, req.KDF)
+	if err != nil {
+		return nil, err
+	}
+	if kdf != "" {
+		result["kdf"] = json.RawMessage(kdf)
+	}
+	deviceID := middleware.GetDeviceIDFromContext(ctx)
+	if deviceID != "" {
+		_ = h.SyncService.RecordSync(ctx, userID, deviceID)
+	}
+	// Tell the other devices watching the vault its version if it changed;
+	// the secrets were delivered by Upload
+	if len(req.Uploaded.Updated) > 0 || len(req.Uploaded.Deleted) > 0 {
+		version, _ := result["version"].(int64)
+		h.events.publish(userID, deviceID, Change{Version: version})
+	}
+	return result, nil
+}
+
+// accessor returns the name the access log knows the authenticated device
+// of ctx by.
+func accessor(ctx context.Context) string {
+	accessor := middleware.GetDeviceIDFromContext(ctx)
+	if leaseID := middleware.GetLeaseIDFromContext(ctx); leaseID != "" {
+		// Tell tokens apart, so that the leases report their fetches
+		accessor += ":" + leaseID
+	}
+	return accessor
+}
+
+// emitTombstones passes the tombstones of the user's deleted secrets to
+// emit, see SyncService.Tombstones.
+func (h *SyncHandler) emitTombstones(ctx context.Context, userID string, versions map[string]int64, emit func(models.Secret) error) error {
+	tombstones, err := h.SyncService.Tombstones(ctx, userID, versions)
+	if err != nil {
+		return err
+	}
+	for _, sec := range tombstones {
+		if err := emit(sec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// etagMatch reports whether the If-None-Match header value header names
+// etag. Weak tags match their strong counterparts.
+func etagMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSyncRequest reads the body of POST /api/sync and applies the
+// secrets uploaded in batches, see Upload, once it was read to the end.
+// Until then the secrets are staged, see uploadSpool, so that the fields
+// may come in any order and a body not matching its "checksum", see
+// jsonstream.Checksum, stores nothing; it is rejected with a
+// *problem.Error, as is the first secret rejected by CheckUpload while
+// reading.
+func (h *SyncHandler) decodeSyncRequest(ctx context.Context, r io.Reader) (SyncRequest, error) {
+	var (
+		dec      = json.NewDecoder(r)
+		req      SyncRequest
+		sum      jsonstream.Checksum
+		checksum string
+		uploads  uploadSpool
+	)
+	defer uploads.close()
+	now := h.Now()
+	err := jsonstream.Object(dec, func(key string) error {
+		switch key {
+		case "secrets":
+			return jsonstream.Array(dec, func() error {
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return err
+				}
+				if err := sum.Add(raw); err != nil {
+					return err
+				}
+				var sec models.Secret
+				if err := json.Unmarshal(raw, &sec); err != nil {
+					return err
+				}
+				if err := CheckUpload(sec, now); err != nil {
+					return err
+				}
+				return uploads.add(raw, sec)
+			})
+		case "versions":
+			return dec.Decode(&req.Versions)
+		case "last_known_version":
+			return dec.Decode(&req.LastKnownVersion)
+		case "filter":
+			return dec.Decode(&req.Filter)
+		case "include_deleted":
+			return dec.Decode(&req.IncludeDeleted)
+		case "kdf":
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return err
+			}
+			req.KDF = string(raw)
+			return CheckKDF(req.KDF)
+		case "checksum":
+			return dec.Decode(&checksum)
+		default:
+			return jsonstream.Skip(dec)
+		}
+	})
+	if err != nil {
+		return req, err
+	}
+	if err := sum.Verify(checksum); err != nil {
+		return req, problem.New(http.StatusBadRequest, jsonstream.ChecksumMismatchCode, err.Error())
+	}
+	err = uploads.batches(func(batch []models.Secret) error {
+		return h.Upload(ctx, &req, batch)
+	})
+	var p *problem.Error
+	if err != nil && !errors.As(err, &p) {
+		// Reading back the staged secrets failed
+		return req, problem.Internal(err.Error())
+	}
+	return req, err
+}
+
+// syncResponse writes the response of a sync: the secrets as the service
+// emits them, followed by the other fields of the result and the
+// "checksum" of the secrets, see jsonstream.Checksum.
+type syncResponse struct {
+	w       http.ResponseWriter
+	begin   time.Time // when the request was received
+	started bool
+	sum     jsonstream.Checksum
+}
+
+// start writes the response header and opens the secrets array. The
+// Server-Timing header reports the time until then, spent reading the
+// request and applying the uploaded secrets, so that clients can tell
+// server from network delays.
+func (s *syncResponse) start() error {
+	s.started = true
+	s.w.Header().Set("Content-Type", "application/json")
+	s.w.Header().Set("Server-Timing", "app;dur="+strconv.FormatFloat(float64(time.Since(s.begin))/float64(time.Millisecond), 'f', 3, 64))
+	_, err := io.WriteString(s.w, `{"secrets":[`)
+	return err
+}
+
+// secret writes one secret of the response.
+func (s *syncResponse) secret(sec models.Secret) error {
+	sep := ","
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+		sep = ""
+	}
+	data, err := json.Marshal(sec)
+	if err != nil {
+		return err
+	}
+	if err := s.sum.Add(data); err != nil {
+		return err
+	}
+	_, err = io.WriteString(s.w, sep+string(data)+"\n")
+	return err
+}
+
+// finish closes the secrets array and writes the fields of result with
+// the checksum of the secrets.
+func (s *syncResponse) finish(result map[string]any) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	result = maps.Clone(result)
+	if result == nil {
+		result = map[string]any{}
+	}
+	result["checksum"] = s.sum.String()
+	buf := []byte("]")
+	for _, k := range slices.Sorted(maps.Keys(result)) {
+		key, _ := json.Marshal(k)
+		val, err := json.Marshal(result[k])
+		if err != nil {
+			return err
+		}
+		buf = append(append(append(append(buf, ','), key...), ':'), val...)
+	}
+	buf = append(buf, "}\n"...)
+	_, err := s.w.Write(buf)
+	return err
+}
+
+// Stats handles GET /api/stats requests.
+// It returns per-type secret counts, the total size of the stored encrypted
+// payloads, the last sync time and the list of devices of the user.
+func (h *SyncHandler) Stats(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	userID := middleware.GetUserIDFromContext(ctx)
 
-	var req struct {
-		Secrets  []models.Secret  `json:"secrets"`
-		Versions map[string]int64 `json:"versions"`
+	stats, err := h.SyncService.Stats(ctx, userID)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, err.Error())
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid body", http.StatusBadRequest)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(stats)
+}
+
+// purgeRequest is the body of POST /api/purge.
+type purgeRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// Purge handles POST /api/purge requests.
+// It permanently deletes the tombstones of the secrets named in "ids"
+// instead of keeping them for the soft-delete retention period, and
+// responds with the IDs purged. Live secrets are never purged; they have to
+// be deleted, and the deletion synced, first.
+func (h *SyncHandler) Purge(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := middleware.GetUserIDFromContext(ctx)
+
+	var req purgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidRequest, "invalid body")
+		return
+	}
+	if len(req.IDs) > maxPurgeIDs {
+		problem.Write(w, r, http.StatusRequestEntityTooLarge, problem.CodeTooLarge, "too many ids")
+		return
+	}
+
+	purged, err := h.SyncService.Purge(ctx, userID, req.IDs)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string][]string{"purged": nonNilIDs(purged)})
+}
+
+// Import handles POST /api/secrets/import requests.
+// The body is NDJSON, one secret per line as in the "secrets" of a sync,
+// e.g. to migrate thousands of secrets from another password manager. The
+// secrets are read and stored in batches as the body arrives, bypassing
+// the version exchange of a sync, and each is checked with CheckUpload;
+// tombstones are refused. A secret is only stored if it is newer than the
+// stored version. The response is the models.ImportResult of the import.
+//
+// Batches stored before an invalid line stay stored, so that a failed
+// import can be repeated as a whole: the secrets stored by the first
+// attempt are skipped.
+func (h *SyncHandler) Import(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := middleware.GetUserIDFromContext(ctx)
+
+	dec := json.NewDecoder(r.Body)
+	now := h.Now()
+	res, err := h.SyncService.Import(ctx, userID, func() (models.Secret, error) {
+		var sec models.Secret
+		if err := dec.Decode(&sec); err != nil {
+			if err == io.EOF {
+				return sec, err
+			}
+			return sec, problem.New(http.StatusBadRequest, problem.CodeInvalidRequest, "invalid body")
+		}
+		if sec.Deleted || sec.ID == "" {
+			return sec, problem.New(http.StatusBadRequest, problem.CodeInvalidRequest, "secrets to import need an ID and must not be deleted")
+		}
+		return sec, CheckUpload(sec, now)
+	})
+	if res.Imported > 0 {
+		// Wake the devices watching the vault, including the importing one
+		h.events.publish(userID, "", Change{Version: res.Version, Resync: true})
+	}
+	var p *problem.Error
+	if errors.As(err, &p) {
+		problem.WriteError(w, r, p)
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, err.Error())
 		return
 	}
 
-	// Perform synchronization
-	result, err := h.SyncService.Sync(ctx, userID, req.Secrets, req.Versions)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// AccessLog handles GET /api/secrets/{id}/access-log requests.
+// It responds with the recent accesses of the secret, newest first, as
+// {"id": ..., "accesses": [{"device_id": ..., "time": ...}]}. A secret
+// is accessed whenever a sync sends it to a device. Unknown IDs have no
+// accesses.
+func (h *SyncHandler) AccessLog(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := middleware.GetUserIDFromContext(ctx)
+	id := chi.URLParam(r, "id")
+
+	log, err := h.SyncService.AccessLog(ctx, userID, id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, err.Error())
 		return
 	}
+	if log == nil {
+		log = []models.SecretAccess{}
+	}
 
-	// Write response
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(result)
+	_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "accesses": log})
+}
+
+// nonNilIDs returns ids, or an empty slice if it is nil, so that it
+// encodes as [] rather than null.
+func nonNilIDs(ids []string) []string {
+	if ids == nil {
+		return []string{}
+	}
+	return ids
 }
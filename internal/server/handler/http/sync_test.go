@@ -4,15 +4,30 @@ package http_test
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/atinyakov/GophKeeper/internal/clock"
+	"github.com/atinyakov/GophKeeper/internal/jsonstream"
+	"github.com/atinyakov/GophKeeper/internal/limits"
+	"github.com/atinyakov/GophKeeper/internal/middleware"
 	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/atinyakov/GophKeeper/internal/problem"
 	handler "github.com/atinyakov/GophKeeper/internal/server/handler/http"
+	"github.com/go-chi/chi/v5"
 )
 
 // fakeSyncService records calls and returns preconfigured results.
@@ -20,23 +35,176 @@ type fakeSyncService struct {
 	called           bool
 	receivedUserID   string
 	receivedSecrets  []models.Secret
+	batches          int
 	receivedVersions map[string]int64
+	receivedFilter   models.SyncFilter
+
+	receivedLastKnown int64
 
 	result map[string]any
 	err    error
+	// failAfterEmit makes err occur after the secrets were emitted.
+	failAfterEmit bool
+
+	recordedDevice string
+	stats          *models.Stats
+	statsErr       error
+
+	purgeIDs []string
+	purged   []string
+
+	tombstones         []models.Secret
+	tombstonesVersions map[string]int64
+	tombstonesAsked    bool
+
+	etag string
+
+	accessDevice string
+	accessed     []string
+	accessLog    []models.SecretAccess
+	accessLogID  string
+
+	imported []models.Secret
+
+	receivedKDF string
+	kdf         string
+}
+
+func (f *fakeSyncService) VaultKDF(ctx context.Context, userID, kdf string) (string, error) {
+	f.receivedKDF = kdf
+	if f.kdf == "" {
+		f.kdf = kdf
+	}
+	return f.kdf, nil
+}
+
+func (f *fakeSyncService) ETag(ctx context.Context, userID string, filter models.SyncFilter) (string, error) {
+	if f.etag == "" {
+		return "", errors.New("no etag")
+	}
+	return f.etag, nil
 }
 
-func (f *fakeSyncService) Sync(
+func (f *fakeSyncService) Changes(ctx context.Context, userID string, ids []string, filter models.SyncFilter, emit func(models.Secret) error) error {
+	return nil
+}
+
+func (f *fakeSyncService) Upload(
 	ctx context.Context,
 	userID string,
 	secrets []models.Secret,
+	lastKnown int64,
+	res *models.UploadResult,
+) error {
+	f.batches++
+	f.receivedSecrets = append(f.receivedSecrets, secrets...)
+	f.receivedLastKnown = lastKnown
+	for _, sec := range secrets {
+		if sec.Deleted {
+			res.Deleted = append(res.Deleted, sec.ID)
+		} else {
+			res.Updated = append(res.Updated, sec.ID)
+		}
+	}
+	return nil
+}
+
+func (f *fakeSyncService) Respond(
+	ctx context.Context,
+	userID string,
+	uploaded models.UploadResult,
 	versions map[string]int64,
+	filter models.SyncFilter,
+	emit func(models.Secret) error,
 ) (map[string]any, error) {
 	f.called = true
 	f.receivedUserID = userID
-	f.receivedSecrets = secrets
 	f.receivedVersions = versions
-	return f.result, f.err
+	f.receivedFilter = filter
+	if f.err != nil && !f.failAfterEmit {
+		return nil, f.err
+	}
+
+	res := make(map[string]any, len(f.result))
+	for k, v := range f.result {
+		if k != "secrets" {
+			res[k] = v
+			continue
+		}
+		for _, sec := range v.([]models.Secret) {
+			if err := emit(sec); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return res, nil
+}
+
+func (f *fakeSyncService) RecordSync(ctx context.Context, userID, deviceID string) error {
+	f.recordedDevice = deviceID
+	return nil
+}
+
+func (f *fakeSyncService) Stats(ctx context.Context, userID string) (*models.Stats, error) {
+	return f.stats, f.statsErr
+}
+
+func (f *fakeSyncService) Tombstones(ctx context.Context, userID string, versions map[string]int64) ([]models.Secret, error) {
+	f.tombstonesAsked = true
+	f.tombstonesVersions = versions
+	return f.tombstones, nil
+}
+
+func (f *fakeSyncService) Purge(ctx context.Context, userID string, ids []string) ([]string, error) {
+	f.receivedUserID = userID
+	f.purgeIDs = ids
+	return f.purged, f.err
+}
+
+func (f *fakeSyncService) RecordAccess(ctx context.Context, userID, deviceID string, ids []string) error {
+	f.accessDevice = deviceID
+	f.accessed = append(f.accessed, ids...)
+	return nil
+}
+
+func (f *fakeSyncService) AccessLog(ctx context.Context, userID, id string) ([]models.SecretAccess, error) {
+	f.receivedUserID = userID
+	f.accessLogID = id
+	return f.accessLog, f.err
+}
+
+func (f *fakeSyncService) Import(ctx context.Context, userID string, next func() (models.Secret, error)) (models.ImportResult, error) {
+	f.receivedUserID = userID
+	for {
+		sec, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return models.ImportResult{Imported: len(f.imported)}, err
+		}
+		f.imported = append(f.imported, sec)
+	}
+	return models.ImportResult{Imported: len(f.imported), Version: 9}, f.err
+}
+
+// decodeProblem decodes the problem details of an error response.
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) problem.Details {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Errorf("Content-Type = %q; want %q", ct, problem.ContentType)
+	}
+	var p problem.Details
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("invalid problem details: %v", err)
+	}
+	if p.Status != w.Code {
+		t.Errorf("problem status = %d; want %d", p.Status, w.Code)
+	}
+	return p
 }
 
 func TestSyncHandler_BadJSON(t *testing.T) {
@@ -49,8 +217,62 @@ func TestSyncHandler_BadJSON(t *testing.T) {
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("status = %d; want %d", w.Code, http.StatusBadRequest)
 	}
-	if body := w.Body.String(); body != "invalid body\n" {
-		t.Errorf("body = %q; want %q", body, "invalid body\n")
+	if p := decodeProblem(t, w); p.Code != problem.CodeInvalidRequest || p.Detail != "invalid body" {
+		t.Errorf("problem = %+v; want invalid body", p)
+	}
+}
+
+func TestSyncHandler_PayloadTooLarge(t *testing.T) {
+	fake := &fakeSyncService{}
+	h := &handler.SyncHandler{SyncService: fake}
+
+	huge := strings.Repeat("A", limits.Encoded("card")+4)
+	payload := map[string]any{
+		"secrets": []models.Secret{
+			{ID: "old", Type: "card", Data: huge, Deleted: true},
+			{ID: "c1", Type: "card", Data: huge},
+		},
+	}
+	b, _ := json.Marshal(payload)
+	w := httptest.NewRecorder()
+	h.Sync(w, httptest.NewRequest(http.MethodPost, "/api/sync", bytes.NewReader(b)))
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+	if p := decodeProblem(t, w); p.Code != problem.CodeTooLarge || !strings.HasPrefix(p.Detail, "secret c1: card payload of") {
+		t.Errorf("problem = %+v; want the oversized secret named", p)
+	}
+}
+
+func TestSyncHandler_FutureVersion(t *testing.T) {
+	fake := &fakeSyncService{}
+	now := time.Unix(1700000000, 0)
+	h := &handler.SyncHandler{SyncService: fake, Clock: clock.NewFake(now)}
+
+	future := now.Add(limits.MaxVersionSkew + time.Second).Unix()
+	payload := map[string]any{
+		"secrets": []models.Secret{
+			{ID: "old", Type: "text", Version: future, Deleted: true},
+			{ID: "ok", Type: "text", Version: now.Add(limits.MaxVersionSkew).Unix()},
+			{ID: "t1", Type: "text", Version: future},
+		},
+	}
+	b, _ := json.Marshal(payload)
+	w := httptest.NewRecorder()
+	h.Sync(w, httptest.NewRequest(http.MethodPost, "/api/sync", bytes.NewReader(b)))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+	if got := w.Header().Get(limits.ErrorCodeHeader); got != limits.FutureVersionCode {
+		t.Errorf("error code = %q; want %q", got, limits.FutureVersionCode)
+	}
+	if p := decodeProblem(t, w); p.Code != limits.FutureVersionCode || !strings.HasPrefix(p.Detail, "secret t1: version") {
+		t.Errorf("problem = %+v; want the secret named", p)
+	}
+	if fake.called {
+		t.Error("service called despite the rejected version")
 	}
 }
 
@@ -71,8 +293,8 @@ func TestSyncHandler_ServiceError(t *testing.T) {
 	if w.Code != http.StatusInternalServerError {
 		t.Errorf("status = %d; want %d", w.Code, http.StatusInternalServerError)
 	}
-	if body := w.Body.String(); body != "sync failed\n" {
-		t.Errorf("body = %q; want %q", body, "sync failed\n")
+	if p := decodeProblem(t, w); p.Code != problem.CodeInternal || p.Detail != "sync failed" {
+		t.Errorf("problem = %+v; want sync failed", p)
 	}
 }
 
@@ -82,6 +304,7 @@ func TestSyncHandler_Success(t *testing.T) {
 		{ID: "id1", Type: "t1", Data: "d1", Comment: "c1", Version: 1},
 	}
 	wantVersions := map[string]int64{"id1": 1}
+	wantFilter := models.SyncFilter{Folders: []string{"work"}, Types: []string{"chunk"}}
 	fake := &fakeSyncService{
 		result: map[string]any{
 			"version": wantVersion,
@@ -93,6 +316,9 @@ func TestSyncHandler_Success(t *testing.T) {
 	reqBody := map[string]any{
 		"secrets":  wantSecrets,
 		"versions": wantVersions,
+		"filter":   wantFilter,
+
+		"last_known_version": 3,
 	}
 	b, _ := json.Marshal(reqBody)
 	req := httptest.NewRequest(http.MethodPost, "/api/sync", bytes.NewReader(b))
@@ -106,6 +332,9 @@ func TestSyncHandler_Success(t *testing.T) {
 	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
 		t.Errorf("Content-Type = %q; want %q", ct, "application/json")
 	}
+	if st := w.Header().Get("Server-Timing"); !strings.HasPrefix(st, "app;dur=") {
+		t.Errorf("Server-Timing = %q; want the processing time", st)
+	}
 
 	var resp struct {
 		Version int64           `json:"version"`
@@ -123,7 +352,7 @@ func TestSyncHandler_Success(t *testing.T) {
 	}
 
 	if !fake.called {
-		t.Error("expected SyncService.Sync to be called")
+		t.Error("expected SyncService.Respond to be called")
 	}
 	if !reflect.DeepEqual(fake.receivedSecrets, wantSecrets) {
 		t.Errorf("receivedSecrets = %+v; want %+v", fake.receivedSecrets, wantSecrets)
@@ -131,4 +360,521 @@ func TestSyncHandler_Success(t *testing.T) {
 	if !reflect.DeepEqual(fake.receivedVersions, wantVersions) {
 		t.Errorf("receivedVersions = %+v; want %+v", fake.receivedVersions, wantVersions)
 	}
+	if !reflect.DeepEqual(fake.receivedFilter, wantFilter) {
+		t.Errorf("receivedFilter = %+v; want %+v", fake.receivedFilter, wantFilter)
+	}
+	if fake.receivedLastKnown != 3 {
+		t.Errorf("receivedLastKnown = %d; want 3", fake.receivedLastKnown)
+	}
+}
+
+func TestSyncHandler_UploadBatches(t *testing.T) {
+	uploaded := make([]models.Secret, handler.UploadBatchSize+1)
+	for i := range uploaded {
+		uploaded[i] = models.Secret{ID: fmt.Sprintf("s%d", i), Type: "text", Data: "d", Version: 1}
+	}
+
+	t.Run("applied once read", func(t *testing.T) {
+		fake := &fakeSyncService{result: map[string]any{"version": int64(1)}}
+		h := &handler.SyncHandler{SyncService: fake}
+		secrets, _ := json.Marshal(uploaded)
+		// The version of the last sync applies wherever it comes
+		b := fmt.Appendf(nil, `{"secrets":%s,"checksum":%q,"last_known_version":3}`, secrets, checksumOf(t, uploaded))
+		w := httptest.NewRecorder()
+		h.Sync(w, httptest.NewRequest(http.MethodPost, "/api/sync", bytes.NewReader(b)))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d; want %d", w.Code, http.StatusOK)
+		}
+		if fake.batches != 2 || len(fake.receivedSecrets) != len(uploaded) {
+			t.Errorf("uploaded %d secrets in %d batches; want %d in 2", len(fake.receivedSecrets), fake.batches, len(uploaded))
+		}
+		if fake.receivedLastKnown != 3 {
+			t.Errorf("receivedLastKnown = %d; want 3", fake.receivedLastKnown)
+		}
+	})
+
+	t.Run("mismatch after a batch", func(t *testing.T) {
+		fake := &fakeSyncService{}
+		h := &handler.SyncHandler{SyncService: fake}
+		b, _ := json.Marshal(map[string]any{"secrets": uploaded, "checksum": checksumOf(t, uploaded[1:])})
+		w := httptest.NewRecorder()
+		h.Sync(w, httptest.NewRequest(http.MethodPost, "/api/sync", bytes.NewReader(b)))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d; want %d", w.Code, http.StatusBadRequest)
+		}
+		if fake.batches != 0 {
+			t.Errorf("uploaded %d batches despite the checksum mismatch; want none", fake.batches)
+		}
+	})
+
+	t.Run("rejected after a batch", func(t *testing.T) {
+		fake := &fakeSyncService{}
+		h := &handler.SyncHandler{SyncService: fake}
+		rejected := append(slices.Clone(uploaded), models.Secret{ID: "big", Type: "card", Data: strings.Repeat("A", limits.Encoded("card")+4)})
+		b, _ := json.Marshal(map[string]any{"secrets": rejected})
+		w := httptest.NewRecorder()
+		h.Sync(w, httptest.NewRequest(http.MethodPost, "/api/sync", bytes.NewReader(b)))
+
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("status = %d; want %d", w.Code, http.StatusRequestEntityTooLarge)
+		}
+		if fake.batches != 0 {
+			t.Errorf("uploaded %d batches despite the rejected secret; want none", fake.batches)
+		}
+		if fake.called {
+			t.Error("sync answered despite the rejected secret")
+		}
+	})
+}
+
+// checksumOf returns the checksum of secrets as sent in sync bodies.
+func checksumOf(t *testing.T, secrets []models.Secret) string {
+	t.Helper()
+	var sum jsonstream.Checksum
+	for _, sec := range secrets {
+		b, err := json.Marshal(sec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sum.Add(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sum.String()
+}
+
+func TestSyncHandler_Checksum(t *testing.T) {
+	uploaded := []models.Secret{{ID: "id1", Type: "text", Data: "d1", Version: 1}}
+	sent := []models.Secret{{ID: "id2", Type: "text", Data: "d2", Version: 2}}
+
+	t.Run("valid", func(t *testing.T) {
+		fake := &fakeSyncService{result: map[string]any{"version": int64(2), "secrets": sent}}
+		h := &handler.SyncHandler{SyncService: fake}
+		b, _ := json.Marshal(map[string]any{"secrets": uploaded, "checksum": checksumOf(t, uploaded)})
+		w := httptest.NewRecorder()
+		h.Sync(w, httptest.NewRequest(http.MethodPost, "/api/sync", bytes.NewReader(b)))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d; want %d", w.Code, http.StatusOK)
+		}
+		var resp struct {
+			Secrets  []models.Secret `json:"secrets"`
+			Checksum string          `json:"checksum"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response JSON: %v", err)
+		}
+		if want := checksumOf(t, sent); resp.Checksum != want {
+			t.Errorf("response checksum = %q; want %q", resp.Checksum, want)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		fake := &fakeSyncService{result: map[string]any{"version": int64(2)}}
+		h := &handler.SyncHandler{SyncService: fake}
+		// The checksum of the secrets before one of them was cut off
+		sum := checksumOf(t, append(slices.Clone(uploaded), sent...))
+		b, _ := json.Marshal(map[string]any{"secrets": uploaded, "checksum": sum})
+		w := httptest.NewRecorder()
+		h.Sync(w, httptest.NewRequest(http.MethodPost, "/api/sync", bytes.NewReader(b)))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d; want %d", w.Code, http.StatusBadRequest)
+		}
+		if p := decodeProblem(t, w); p.Code != jsonstream.ChecksumMismatchCode {
+			t.Errorf("problem = %+v; want %s", p, jsonstream.ChecksumMismatchCode)
+		}
+		if fake.called {
+			t.Error("service called despite the checksum mismatch")
+		}
+	})
+}
+
+func TestSyncHandler_RecordsDevice(t *testing.T) {
+	fake := &fakeSyncService{result: map[string]any{"version": int64(1)}}
+	h := &handler.SyncHandler{SyncService: fake}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/sync", bytes.NewBufferString(`{"secrets":[]}`))
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{
+		Subject:      pkix.Name{CommonName: "alice"},
+		SerialNumber: big.NewInt(255),
+	}}}
+	w := httptest.NewRecorder()
+	middleware.CertAuth(http.HandlerFunc(h.Sync)).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", w.Code, http.StatusOK)
+	}
+	if fake.receivedUserID != "alice" {
+		t.Errorf("receivedUserID = %q; want %q", fake.receivedUserID, "alice")
+	}
+	if fake.recordedDevice != "ff" {
+		t.Errorf("recordedDevice = %q; want %q", fake.recordedDevice, "ff")
+	}
+}
+
+func TestSyncHandler_RecordsAccess(t *testing.T) {
+	fake := &fakeSyncService{result: map[string]any{
+		"version": int64(3),
+		"secrets": []models.Secret{{ID: "s1", Version: 1}, {ID: "gone", Version: 2, Deleted: true}, {ID: "s3", Version: 3}},
+	}}
+	h := &handler.SyncHandler{SyncService: fake}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/sync", bytes.NewBufferString(`{"secrets":[]}`))
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{
+		Subject:      pkix.Name{CommonName: "alice"},
+		SerialNumber: big.NewInt(255),
+	}}}
+	w := httptest.NewRecorder()
+	middleware.CertAuth(http.HandlerFunc(h.Sync)).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", w.Code, http.StatusOK)
+	}
+	if fake.accessDevice != "ff" {
+		t.Errorf("accessDevice = %q; want %q", fake.accessDevice, "ff")
+	}
+	// Tombstones carry no data and are not accesses
+	if want := []string{"s1", "s3"}; !reflect.DeepEqual(fake.accessed, want) {
+		t.Errorf("accessed = %v; want %v", fake.accessed, want)
+	}
+
+	// API tokens are told apart by their lease
+	req = httptest.NewRequest(http.MethodPost, "/api/sync", bytes.NewBufferString(`{"secrets":[]}`))
+	req.Header.Set("Authorization", "Bearer t1")
+	w = httptest.NewRecorder()
+	middleware.TokenAuth(leaseValidator{})(http.HandlerFunc(h.Sync)).ServeHTTP(w, req)
+	if want := middleware.TokenDeviceID + ":l1"; fake.accessDevice != want {
+		t.Errorf("accessDevice = %q; want %q", fake.accessDevice, want)
+	}
+}
+
+func TestSyncHandler_IncludeDeleted(t *testing.T) {
+	fake := &fakeSyncService{
+		result:     map[string]any{"version": int64(2), "secrets": []models.Secret{{ID: "s1", Version: 2}}},
+		tombstones: []models.Secret{{ID: "gone", Version: 1, Deleted: true}},
+	}
+	h := &handler.SyncHandler{SyncService: fake}
+
+	// Tombstones are only sent when asked for
+	w := httptest.NewRecorder()
+	h.Sync(w, httptest.NewRequest(http.MethodPost, "/api/sync", bytes.NewBufferString(`{"secrets":[]}`)))
+	if w.Code != http.StatusOK || fake.tombstonesAsked {
+		t.Fatalf("status = %d, tombstones asked = %v; want 200 without tombstones", w.Code, fake.tombstonesAsked)
+	}
+
+	body := `{"secrets":[],"versions":{"s1":1,"gone":1},"include_deleted":true}`
+	fake.accessed = nil
+	w = httptest.NewRecorder()
+	h.Sync(w, httptest.NewRequest(http.MethodPost, "/api/sync", bytes.NewBufferString(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", w.Code, http.StatusOK)
+	}
+	var resp struct {
+		Secrets  []models.Secret `json:"secrets"`
+		Checksum string          `json:"checksum"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := []models.Secret{{ID: "s1", Version: 2}, {ID: "gone", Version: 1, Deleted: true}}
+	if !reflect.DeepEqual(resp.Secrets, want) {
+		t.Errorf("secrets = %+v; want %+v", resp.Secrets, want)
+	}
+	if !reflect.DeepEqual(fake.tombstonesVersions, map[string]int64{"s1": 1, "gone": 1}) {
+		t.Errorf("tombstones asked for versions %v; want the client's", fake.tombstonesVersions)
+	}
+	if resp.Checksum != checksumOf(t, want) {
+		t.Errorf("checksum = %q; want the tombstones covered", resp.Checksum)
+	}
+	// Tombstones carry no data and are not accesses
+	if want := []string{"s1"}; !reflect.DeepEqual(fake.accessed, want) {
+		t.Errorf("accessed = %v; want %v", fake.accessed, want)
+	}
+}
+
+// leaseValidator accepts any token as alice's with lease l1.
+type leaseValidator struct{}
+
+func (leaseValidator) AuthenticateToken(ctx context.Context, token string) (string, string, error) {
+	return "alice", "l1", nil
+}
+
+func TestSyncHandler_AccessLog(t *testing.T) {
+	fake := &fakeSyncService{accessLog: []models.SecretAccess{{DeviceID: "ff", Time: 20}, {DeviceID: "api-token", Time: 10}}}
+	h := &handler.SyncHandler{SyncService: fake}
+	r := chi.NewRouter()
+	r.Use(middleware.CertAuth)
+	r.Get("/api/secrets/{id}/access-log", h.AccessLog)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/secrets/s1/access-log", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{
+		Subject:      pkix.Name{CommonName: "alice"},
+		SerialNumber: big.NewInt(255),
+	}}}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", w.Code, http.StatusOK)
+	}
+	if fake.receivedUserID != "alice" || fake.accessLogID != "s1" {
+		t.Errorf("AccessLog called with %q, %q; want alice, s1", fake.receivedUserID, fake.accessLogID)
+	}
+	var body struct {
+		ID       string                `json:"id"`
+		Accesses []models.SecretAccess `json:"accesses"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if body.ID != "s1" || !reflect.DeepEqual(body.Accesses, fake.accessLog) {
+		t.Errorf("response = %+v", body)
+	}
+
+	// Secrets never accessed have an empty log rather than null
+	fake.accessLog = nil
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if got := strings.TrimSpace(w.Body.String()); got != `{"accesses":[],"id":"s1"}` {
+		t.Errorf("response = %s", got)
+	}
+}
+
+func TestSyncHandler_ETag(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		ifNoneMatch string
+		wantStatus  int
+		wantETag    string
+	}{
+		{"unchanged", `{"secrets":[]}`, `"5-abc"`, http.StatusNotModified, `"5-abc"`},
+		{"weak tag in list", `{}`, `"4-old", W/"5-abc"`, http.StatusNotModified, `"5-abc"`},
+		{"changed", `{"secrets":[]}`, `"4-old"`, http.StatusOK, `"5-abc"`},
+		{"first poll", `{"secrets":[]}`, "", http.StatusOK, `"5-abc"`},
+		{"upload", `{"secrets":[{"id":"s1","type":"text","version":1}]}`, `"5-abc"`, http.StatusOK, ""},
+		{"kdf to store", `{"kdf":{"salt":"c2FsdA=="}}`, `"5-abc"`, http.StatusOK, `"5-abc"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSyncService{etag: `"5-abc"`, result: map[string]any{"version": int64(5)}}
+			h := &handler.SyncHandler{SyncService: fake}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/sync", strings.NewReader(tt.body))
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			h.Sync(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d; want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("ETag = %q; want %q", got, tt.wantETag)
+			}
+			if tt.wantStatus == http.StatusNotModified && (w.Body.Len() != 0 || fake.called) {
+				t.Errorf("304 with body %q, service called: %v; want neither", w.Body.String(), fake.called)
+			}
+		})
+	}
+}
+
+func TestSyncHandler_KDF(t *testing.T) {
+	stored := `{"salt":"Zmlyc3Q=","time":3}`
+	tests := []struct {
+		name       string
+		body       string
+		kdf        string // parameters the server holds
+		wantStatus int
+		wantSent   string
+		wantKDF    string
+	}{
+		{"first device", `{"kdf":` + stored + `}`, "", http.StatusOK, stored, stored},
+		{"other device", `{"kdf":{"salt":"bmV3"}}`, stored, http.StatusOK, `{"salt":"bmV3"}`, stored},
+		{"not sent", `{}`, stored, http.StatusOK, "", stored},
+		{"none yet", `{}`, "", http.StatusOK, "", ""},
+		{"not an object", `{"kdf":"salt"}`, "", http.StatusBadRequest, "", ""},
+		{"too large", `{"kdf":{"salt":"` + strings.Repeat("A", 5000) + `"}}`, "", http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSyncService{kdf: tt.kdf, result: map[string]any{"version": int64(5)}}
+			h := &handler.SyncHandler{SyncService: fake}
+			w := httptest.NewRecorder()
+			h.Sync(w, httptest.NewRequest(http.MethodPost, "/api/sync", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d; want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if p := decodeProblem(t, w); p.Code != problem.CodeInvalidRequest || p.Detail != "invalid kdf" {
+					t.Errorf("problem = %+v; want invalid kdf", p)
+				}
+				return
+			}
+			if fake.receivedKDF != tt.wantSent {
+				t.Errorf("service got kdf %q; want %q", fake.receivedKDF, tt.wantSent)
+			}
+			var resp struct {
+				KDF json.RawMessage `json:"kdf"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if string(resp.KDF) != tt.wantKDF {
+				t.Errorf("kdf = %s; want %s", resp.KDF, tt.wantKDF)
+			}
+		})
+	}
+}
+
+func TestSyncHandler_Stats(t *testing.T) {
+	want := &models.Stats{
+		Counts:     map[string]int64{"text": 2},
+		TotalBytes: 64,
+		LastSync:   100,
+		Devices:    []models.Device{{ID: "ff", LastSync: 100}},
+	}
+	h := &handler.SyncHandler{SyncService: &fakeSyncService{stats: want}}
+
+	w := httptest.NewRecorder()
+	h.Stats(w, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", w.Code, http.StatusOK)
+	}
+	var got models.Stats
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode response JSON: %v", err)
+	}
+	if !reflect.DeepEqual(&got, want) {
+		t.Errorf("stats = %+v; want %+v", got, *want)
+	}
+}
+
+func TestSyncHandler_StatsError(t *testing.T) {
+	h := &handler.SyncHandler{SyncService: &fakeSyncService{statsErr: errors.New("db down")}}
+
+	w := httptest.NewRecorder()
+	h.Stats(w, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestSyncHandler_Purge(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		purged     []string
+		err        error
+		wantStatus int
+		wantBody   string // body of a success, problem detail of an error
+	}{
+		{"purged", `{"ids":["a","b"]}`, []string{"a"}, nil, http.StatusOK, `{"purged":["a"]}` + "\n"},
+		{"none purged", `{"ids":["a"]}`, nil, nil, http.StatusOK, `{"purged":[]}` + "\n"},
+		{"no ids", `{"ids":[]}`, nil, nil, http.StatusBadRequest, "invalid body"},
+		{"bad json", `not-a-json`, nil, nil, http.StatusBadRequest, "invalid body"},
+		{"too many ids", `{"ids":[` + strings.Repeat(`"a",`, 10000) + `"a"]}`, nil, nil, http.StatusRequestEntityTooLarge, "too many ids"},
+		{"service error", `{"ids":["a"]}`, nil, errors.New("db down"), http.StatusInternalServerError, "db down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSyncService{purged: tt.purged, err: tt.err}
+			h := &handler.SyncHandler{SyncService: fake}
+
+			w := httptest.NewRecorder()
+			h.Purge(w, httptest.NewRequest(http.MethodPost, "/api/purge", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d; want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if p := decodeProblem(t, w); p.Detail != tt.wantBody {
+					t.Errorf("detail = %q; want %q", p.Detail, tt.wantBody)
+				}
+			} else if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q; want %q", got, tt.wantBody)
+			}
+			if tt.wantStatus == http.StatusOK && len(fake.purgeIDs) == 0 {
+				t.Error("service not called")
+			}
+		})
+	}
+}
+
+func TestSyncHandler_Import(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		wantStatus int
+		wantBody   string // body of a success, problem detail of an error
+		wantIDs    []string
+	}{
+		{"imported", `{"id":"a","type":"text","data":"x","version":1}` + "\n" + `{"id":"b","type":"text","data":"y","version":2}` + "\n",
+			nil, http.StatusOK, `{"imported":2,"skipped":0,"version":9}` + "\n", []string{"a", "b"}},
+		{"empty", ``, nil, http.StatusOK, `{"imported":0,"skipped":0,"version":9}` + "\n", nil},
+		{"tombstone", `{"id":"a","type":"text","data":"x","version":1}` + "\n" + `{"id":"b","deleted":true,"version":2}`,
+			nil, http.StatusBadRequest, "secrets to import need an ID and must not be deleted", []string{"a"}},
+		{"no id", `{"type":"text","data":"x","version":1}`, nil, http.StatusBadRequest, "secrets to import need an ID and must not be deleted", nil},
+		{"bad json", `{"id":"a","type":"text","data":"x","version":1}` + "\nnot-a-json", nil, http.StatusBadRequest, "invalid body", []string{"a"}},
+		{"service error", `{"id":"a","type":"text","data":"x","version":1}`, errors.New("db down"), http.StatusInternalServerError, "db down", []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSyncService{err: tt.err}
+			h := &handler.SyncHandler{SyncService: fake}
+
+			w := httptest.NewRecorder()
+			h.Import(w, httptest.NewRequest(http.MethodPost, "/api/secrets/import", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d; want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if p := decodeProblem(t, w); p.Detail != tt.wantBody {
+					t.Errorf("detail = %q; want %q", p.Detail, tt.wantBody)
+				}
+			} else if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q; want %q", got, tt.wantBody)
+			}
+			var ids []string
+			for _, sec := range fake.imported {
+				ids = append(ids, sec.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("imported %v; want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestSyncHandler_FailureAfterStreaming(t *testing.T) {
+	fake := &fakeSyncService{
+		result:        map[string]any{"secrets": []models.Secret{{ID: "id1", Version: 1}}},
+		err:           errors.New("connection lost"),
+		failAfterEmit: true,
+	}
+	h := &handler.SyncHandler{SyncService: fake}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/sync", bytes.NewBufferString(`{"secrets": []}`))
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{
+		Subject:      pkix.Name{CommonName: "alice"},
+		SerialNumber: big.NewInt(255),
+	}}}
+	w := httptest.NewRecorder()
+	middleware.CertAuth(http.HandlerFunc(h.Sync)).ServeHTTP(w, req)
+
+	if json.Valid(w.Body.Bytes()) {
+		t.Errorf("body = %q; want truncated JSON", w.Body.String())
+	}
+	if fake.recordedDevice != "" {
+		t.Error("failed sync was recorded")
+	}
 }
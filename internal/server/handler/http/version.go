@@ -0,0 +1,65 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	// ProtocolVersion is the version of the sync protocol spoken by the server.
+	// It is incremented on incompatible API changes.
+	ProtocolVersion = 1
+	// MinClientProtocol is the oldest client protocol version the server supports.
+	MinClientProtocol = 1
+)
+
+// VersionInfo is the JSON response of GET /api/version.
+type VersionInfo struct {
+	// Version is the server build version.
+	Version string `json:"version"`
+	// BuildDate is the server build date.
+	BuildDate string `json:"build_date"`
+	// GoVersion is the Go toolchain that built the server.
+	GoVersion string `json:"go_version,omitempty"`
+	// Revision is the VCS revision the server was built from, if known.
+	Revision string `json:"revision,omitempty"`
+	// Modified is set if the revision had uncommitted changes.
+	Modified bool `json:"modified,omitempty"`
+	// Protocol is the server's ProtocolVersion.
+	Protocol int `json:"protocol"`
+	// MinProtocol is the oldest client protocol version the server supports.
+	MinProtocol int `json:"min_protocol"`
+	// MinClientVersion is the oldest recommended client build version, if any.
+	MinClientVersion string `json:"min_client_version,omitempty"`
+}
+
+// VersionHandler serves the server version so clients can detect
+// incompatibilities before syncing.
+type VersionHandler struct {
+	// Version is the server build version.
+	Version string
+	// BuildDate is the server build date.
+	BuildDate string
+	// GoVersion, Revision and Modified describe the build further, see
+	// buildinfo.Info.
+	GoVersion string
+	Revision  string
+	Modified  bool
+	// MinClientVersion is the oldest recommended client build version.
+	MinClientVersion string
+}
+
+// Get handles GET /api/version requests. It requires no authentication.
+func (h *VersionHandler) Get(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(VersionInfo{
+		Version:          h.Version,
+		BuildDate:        h.BuildDate,
+		GoVersion:        h.GoVersion,
+		Revision:         h.Revision,
+		Modified:         h.Modified,
+		Protocol:         ProtocolVersion,
+		MinProtocol:      MinClientProtocol,
+		MinClientVersion: h.MinClientVersion,
+	})
+}
@@ -0,0 +1,208 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// WatchHeartbeat is how often an idle watch stream carries an empty
+// message, so that clients and proxies can tell it from a dead connection.
+const WatchHeartbeat = 30 * time.Second
+
+// maxWatchPush is the most secrets a change pushed to a watch stream may
+// name; larger changes only ask the client to sync.
+const maxWatchPush = UploadBatchSize
+
+// syncEvent is one line of a watch stream.
+type syncEvent struct {
+	Version int64 `json:"version"` // vault version after the change
+}
+
+// Change is a change to a vault as delivered to its watch streams.
+type Change struct {
+	// Version is the version of the vault after the change, 0 if not
+	// known yet: uploads are delivered as they are stored, and the
+	// version follows with the end of their sync.
+	Version int64
+	// IDs are the IDs of the secrets stored or deleted.
+	IDs []string
+	// Resync reports that the secrets changed are not known, or too many
+	// to push; IDs is nil then.
+	Resync bool
+}
+
+// Watcher is an open watch stream, see SyncHandler.Subscribe.
+type Watcher struct {
+	deviceID string
+	// ready is signalled when changes are pending, see Take.
+	ready chan struct{}
+
+	mu      sync.Mutex
+	version int64           // latest version not yet taken
+	ids     map[string]bool // IDs of the secrets changed since
+	resync  bool
+}
+
+// Ready returns a channel that receives when changes are pending.
+func (w *Watcher) Ready() <-chan struct{} {
+	return w.ready
+}
+
+// Take returns the changes delivered since the last call merged into one,
+// with the IDs in order.
+func (w *Watcher) Take() Change {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	c := Change{Version: w.version, Resync: w.resync}
+	if !c.Resync {
+		c.IDs = slices.Sorted(maps.Keys(w.ids))
+	}
+	w.version, w.ids, w.resync = 0, nil, false
+	return c
+}
+
+// add delivers c to the stream, merged with the changes not taken yet.
+func (w *Watcher) add(c Change) {
+	w.mu.Lock()
+	w.version = max(w.version, c.Version)
+	w.resync = w.resync || c.Resync || len(w.ids)+len(c.IDs) > maxWatchPush
+	if w.resync {
+		w.ids = nil
+	} else {
+		if w.ids == nil {
+			w.ids = make(map[string]bool, len(c.IDs))
+		}
+		for _, id := range c.IDs {
+			w.ids[id] = true
+		}
+	}
+	w.mu.Unlock()
+
+	select {
+	case w.ready <- struct{}{}:
+	default: // already signalled
+	}
+}
+
+// syncEvents delivers vault changes to the watch streams of their user.
+// The zero value is ready to use.
+type syncEvents struct {
+	mu   sync.Mutex
+	subs map[string]map[*Watcher]struct{} // by user ID
+}
+
+// subscribe registers a watch stream of the user's device. The returned
+// function unregisters it.
+func (e *syncEvents) subscribe(userID, deviceID string) (*Watcher, func()) {
+	w := &Watcher{deviceID: deviceID, ready: make(chan struct{}, 1)}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.subs == nil {
+		e.subs = make(map[string]map[*Watcher]struct{})
+	}
+	if e.subs[userID] == nil {
+		e.subs[userID] = make(map[*Watcher]struct{})
+	}
+	e.subs[userID][w] = struct{}{}
+
+	return w, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.subs[userID], w)
+		if len(e.subs[userID]) == 0 {
+			delete(e.subs, userID)
+		}
+	}
+}
+
+// publish delivers the change c to the watch streams of the user, except
+// those of the device that made it.
+func (e *syncEvents) publish(userID, deviceID string, c Change) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for w := range e.subs[userID] {
+		if deviceID != "" && w.deviceID == deviceID {
+			continue
+		}
+		w.add(c)
+	}
+}
+
+// Subscribe registers a watch stream of the authenticated device, to which
+// the changes the user's other devices make to the vault are delivered.
+// The returned function unregisters it.
+func (h *SyncHandler) Subscribe(ctx context.Context) (*Watcher, func()) {
+	return h.events.subscribe(middleware.GetUserIDFromContext(ctx), middleware.GetDeviceIDFromContext(ctx))
+}
+
+// Push passes the secrets of a change taken from a Watcher to emit, as
+// they are now, see SyncService.Changes. The secrets sent are noted in the
+// access log like those of a sync.
+func (h *SyncHandler) Push(ctx context.Context, ids []string, filter models.SyncFilter, emit func(models.Secret) error) error {
+	userID := middleware.GetUserIDFromContext(ctx)
+	var sent []string
+	err := h.SyncService.Changes(ctx, userID, ids, filter, func(sec models.Secret) error {
+		if err := emit(sec); err != nil {
+			return err
+		}
+		if !sec.Deleted {
+			sent = append(sent, sec.ID)
+		}
+		return nil
+	})
+	_ = h.SyncService.RecordAccess(ctx, userID, accessor(ctx), sent)
+	return err
+}
+
+// Watch handles GET /api/sync/watch requests. It keeps the response open
+// and writes a JSON line {"version": n} whenever another device of the
+// user uploads changes, so that always-on clients sync when the vault
+// changes instead of polling. The secrets themselves are still exchanged
+// through POST /api/sync; the gRPC API pushes them along, see
+// pb.GophKeeperServer.
+func (h *SyncHandler) Watch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	rc := http.NewResponseController(w)
+	sub, unsubscribe := h.Subscribe(ctx)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	heartbeat := time.NewTicker(WatchHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.Ready():
+			// Uploads are announced once their sync ended with a version
+			c := sub.Take()
+			if c.Version == 0 {
+				continue
+			}
+			err = enc.Encode(syncEvent{Version: c.Version})
+		case <-heartbeat.C:
+			_, err = w.Write([]byte("\n"))
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package http_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/middleware"
+	handler "github.com/atinyakov/GophKeeper/internal/server/handler/http"
+	"go.uber.org/zap"
+)
+
+// asDevice authenticates requests as alice's device with the serial number
+// given in the X-Serial header.
+func asDevice(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serial, _ := new(big.Int).SetString(r.Header.Get("X-Serial"), 10)
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{
+			Subject:      pkix.Name{CommonName: "alice"},
+			SerialNumber: serial,
+		}}}
+		middleware.CertAuth(next).ServeHTTP(w, r)
+	})
+}
+
+func TestWatch(t *testing.T) {
+	fake := &fakeSyncService{result: map[string]any{"version": int64(7), "updated": []string{"id1"}}}
+	h := &handler.SyncHandler{SyncService: fake}
+	mux := http.NewServeMux()
+	mux.Handle("/api/sync", asDevice(http.HandlerFunc(h.Sync)))
+	mux.Handle("/api/sync/watch", asDevice(http.HandlerFunc(h.Watch)))
+	srv := httptest.NewServer(middleware.WithRequestLogging(zap.NewNop())(mux))
+	t.Cleanup(srv.Close) // after the watch streams are closed
+
+	watch := func(serial string) *bufio.Reader {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/sync/watch", nil)
+		req.Header.Set("X-Serial", serial)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("watch: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("watch status = %d; want 200", resp.StatusCode)
+		}
+		return bufio.NewReader(resp.Body)
+	}
+	other, self := watch("1"), watch("2")
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/sync", strings.NewReader(`{"secrets": [{"id": "id1", "version": 7}]}`))
+	req.Header.Set("X-Serial", "2")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	resp.Body.Close()
+
+	line := make(chan string, 1)
+	go func() {
+		s, _ := other.ReadString('\n')
+		line <- s
+	}()
+	select {
+	case s := <-line:
+		if strings.TrimSpace(s) != `{"version":7}` {
+			t.Errorf("event = %q; want version 7", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event on the watch stream of the other device")
+	}
+
+	// The device that made the change is not notified
+	go func() {
+		s, _ := self.ReadString('\n')
+		line <- s
+	}()
+	select {
+	case s := <-line:
+		t.Errorf("syncing device received %q", s)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWatch_NoChange(t *testing.T) {
+	h := &handler.SyncHandler{SyncService: &fakeSyncService{result: map[string]any{"version": int64(3)}}}
+	mux := http.NewServeMux()
+	mux.Handle("/api/sync", asDevice(http.HandlerFunc(h.Sync)))
+	mux.Handle("/api/sync/watch", asDevice(http.HandlerFunc(h.Watch)))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/sync/watch", nil)
+	req.Header.Set("X-Serial", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// A sync that only downloads does not wake other devices
+	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/api/sync", strings.NewReader(`{"secrets": [], "versions": {}}`))
+	req.Header.Set("X-Serial", "2")
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+	}
+
+	line := make(chan string, 1)
+	go func() {
+		s, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		line <- s
+	}()
+	select {
+	case s := <-line:
+		t.Errorf("watch received %q; want nothing", s)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,289 @@
+// GophKeeper web UI.
+//
+// Secrets are encrypted in the browser with AES-GCM. The key is derived the
+// same way as in the CLI client: SHA-256 over the DER bytes of the client
+// private key. Stored data is base64(nonce || ciphertext), so secrets created
+// here and in the CLI are interchangeable.
+//
+// The API token is only used once to open a cookie-based session; later
+// requests carry the HTTP-only session cookie and the session's CSRF token.
+"use strict";
+
+const state = {
+  csrf: "",
+  key: null,
+  secrets: [],
+  refreshTimer: 0,
+};
+
+const $ = (id) => document.getElementById(id);
+
+function setStatus(message, isError) {
+  const el = $("status");
+  el.textContent = message || "";
+  el.classList.toggle("error", Boolean(isError));
+}
+
+function bytesToBase64(bytes) {
+  let binary = "";
+  for (const b of bytes) {
+    binary += String.fromCharCode(b);
+  }
+  return btoa(binary);
+}
+
+function base64ToBytes(b64) {
+  const binary = atob(b64);
+  const bytes = new Uint8Array(binary.length);
+  for (let i = 0; i < binary.length; i++) {
+    bytes[i] = binary.charCodeAt(i);
+  }
+  return bytes;
+}
+
+// pemToDER extracts the DER bytes of the first PEM block.
+function pemToDER(pem) {
+  const body = pem
+    .replace(/-----BEGIN [^-]+-----/, "")
+    .replace(/-----END [^-]+-----[\s\S]*/, "")
+    .replace(/\s+/g, "");
+  if (!body) {
+    throw new Error("invalid PEM key");
+  }
+  return base64ToBytes(body);
+}
+
+// deriveKey derives the vault AES-GCM key from a PEM-encoded private key.
+async function deriveKey(keyPEM) {
+  const digest = await crypto.subtle.digest("SHA-256", pemToDER(keyPEM));
+  return crypto.subtle.importKey("raw", digest, "AES-GCM", false, ["encrypt", "decrypt"]);
+}
+
+async function encrypt(plain) {
+  const nonce = crypto.getRandomValues(new Uint8Array(12));
+  const ct = new Uint8Array(
+    await crypto.subtle.encrypt({ name: "AES-GCM", iv: nonce }, state.key, new TextEncoder().encode(plain)),
+  );
+  const out = new Uint8Array(nonce.length + ct.length);
+  out.set(nonce);
+  out.set(ct, nonce.length);
+  return bytesToBase64(out);
+}
+
+async function decrypt(data) {
+  const raw = base64ToBytes(data);
+  const nonce = raw.slice(0, 12);
+  const plain = await crypto.subtle.decrypt({ name: "AES-GCM", iv: nonce }, state.key, raw.slice(12));
+  return new TextDecoder().decode(plain);
+}
+
+// apiError builds the error of a failed request from the problem details
+// of the response, falling back to its text.
+async function apiError(resp) {
+  if ((resp.headers.get("Content-Type") || "").startsWith("application/problem+json")) {
+    const problem = await resp.json();
+    const err = new Error(problem.detail || problem.title || resp.statusText);
+    err.code = problem.code;
+    err.requestID = problem.request_id;
+    return err;
+  }
+  return new Error((await resp.text()).trim() || resp.statusText);
+}
+
+// api posts body to path and returns the decoded JSON response. Errors
+// carry the problem details of the server and, for 428 responses, the
+// challenge to solve.
+async function api(path, body, token) {
+  const headers = { "Content-Type": "application/json" };
+  if (token) {
+    headers["Authorization"] = "Bearer " + token;
+  } else if (state.csrf) {
+    headers["X-CSRF-Token"] = state.csrf;
+  }
+  const resp = await fetch(path, { method: "POST", headers, body: JSON.stringify(body) });
+  if (resp.status === 428) {
+    const err = new Error("challenge required");
+    err.challenge = await resp.json();
+    throw err;
+  }
+  if (!resp.ok) {
+    throw await apiError(resp);
+  }
+  if (resp.status === 204) {
+    return null;
+  }
+  return resp.json();
+}
+
+// startSession stores the session's CSRF token and schedules a refresh
+// one minute before the session expires.
+function startSession(session) {
+  state.csrf = session.csrf_token;
+  clearTimeout(state.refreshTimer);
+  const delay = Math.max(session.expires_at * 1000 - Date.now() - 60000, 1000);
+  state.refreshTimer = setTimeout(async () => {
+    try {
+      startSession(await api("/api/session/refresh", {}));
+    } catch (err) {
+      lock();
+      setStatus("Session expired: " + err.message, true);
+    }
+  }, delay);
+}
+
+// sync uploads the given secrets and returns all secrets known to the server.
+async function sync(secrets) {
+  const result = await api("/api/sync", { secrets, versions: {} });
+  state.secrets = (result.secrets || []).filter((s) => !s.deleted);
+  await render();
+}
+
+async function render() {
+  const tbody = $("secrets");
+  tbody.replaceChildren();
+  for (const s of state.secrets) {
+    let data;
+    try {
+      data = await decrypt(s.data);
+    } catch {
+      data = "(decryption error)";
+    }
+    const row = document.createElement("tr");
+    for (const [text, cls] of [[s.type], [s.comment], [data, "data"], [String(s.version)]]) {
+      const td = document.createElement("td");
+      td.textContent = text;
+      if (cls) {
+        td.className = cls;
+      }
+      row.append(td);
+    }
+    tbody.append(row);
+  }
+}
+
+function showVault(unlocked) {
+  $("unlock-view").hidden = unlocked;
+  $("vault-view").hidden = !unlocked;
+  $("lock").hidden = !unlocked;
+}
+
+async function unlock(token, keyPEM) {
+  state.key = await deriveKey(keyPEM);
+  startSession(await api("/api/session", {}, token));
+  await sync([]);
+  showVault(true);
+}
+
+function lock() {
+  if (state.csrf) {
+    api("/api/session/logout", {}).catch(() => {});
+  }
+  clearTimeout(state.refreshTimer);
+  state.csrf = "";
+  state.key = null;
+  state.secrets = [];
+  $("secrets").replaceChildren();
+  showVault(false);
+}
+
+// leadingZeroBits counts the leading zero bits of a SHA-256 digest.
+function leadingZeroBits(digest) {
+  let n = 0;
+  for (const b of new Uint8Array(digest)) {
+    if (b !== 0) {
+      return n + Math.clz32(b) - 24;
+    }
+    n += 8;
+  }
+  return n;
+}
+
+// solveChallenge finds a decimal counter such that
+// SHA-256(challenge + ":" + counter) has the required leading zero bits.
+async function solveChallenge({ challenge, difficulty }) {
+  const encoder = new TextEncoder();
+  for (let n = 0; ; n++) {
+    const digest = await crypto.subtle.digest("SHA-256", encoder.encode(challenge + ":" + n));
+    if (leadingZeroBits(digest) >= difficulty) {
+      return String(n);
+    }
+  }
+}
+
+// register registers login, solving the proof-of-work challenge if the
+// server requires one.
+async function register(login) {
+  try {
+    return await api("/api/register", { login });
+  } catch (err) {
+    if (!err.challenge) {
+      throw err;
+    }
+    setStatus("Solving registration challenge...");
+    const solution = await solveChallenge(err.challenge);
+    return api("/api/register", { login, challenge: err.challenge.challenge, solution });
+  }
+}
+
+function downloadLink(el, content) {
+  el.href = URL.createObjectURL(new Blob([content], { type: "application/x-pem-file" }));
+}
+
+$("unlock-form").addEventListener("submit", async (e) => {
+  e.preventDefault();
+  try {
+    const keyPEM = await $("unlock-key").files[0].text();
+    await unlock($("unlock-token").value.trim(), keyPEM);
+    setStatus("Vault unlocked");
+  } catch (err) {
+    setStatus("Unlock failed: " + err.message, true);
+  }
+});
+
+$("register-form").addEventListener("submit", async (e) => {
+  e.preventDefault();
+  try {
+    const creds = await register($("register-login").value.trim());
+    downloadLink($("download-cert"), creds.cert);
+    downloadLink($("download-key"), creds.key);
+    $("register-token").textContent = creds.token;
+    $("register-codes").textContent = (creds.recovery_codes || []).join("\n");
+    $("register-result").hidden = false;
+    await unlock(creds.token, creds.key);
+    setStatus("Registered and unlocked");
+  } catch (err) {
+    setStatus("Registration failed: " + err.message, true);
+  }
+});
+
+$("add-form").addEventListener("submit", async (e) => {
+  e.preventDefault();
+  try {
+    const secret = {
+      id: crypto.randomUUID(),
+      type: $("add-type").value,
+      data: await encrypt($("add-data").value),
+      comment: $("add-comment").value,
+      version: Math.floor(Date.now() / 1000),
+    };
+    await sync([secret]);
+    e.target.reset();
+    setStatus("Secret added");
+  } catch (err) {
+    setStatus("Add failed: " + err.message, true);
+  }
+});
+
+$("refresh").addEventListener("click", async () => {
+  try {
+    await sync([]);
+    setStatus("Refreshed");
+  } catch (err) {
+    setStatus("Refresh failed: " + err.message, true);
+  }
+});
+
+$("lock").addEventListener("click", () => {
+  lock();
+  setStatus("Vault locked");
+});
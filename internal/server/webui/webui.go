@@ -0,0 +1,27 @@
+// Package webui embeds the single-page web interface of GophKeeper.
+//
+// The interface registers users, lists secrets and adds new ones. Secrets are
+// encrypted and decrypted in the browser with WebCrypto using the same
+// key derivation as the CLI client, so the server only ever sees ciphertext.
+// Requests are authenticated with an API bearer token.
+package webui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler returns an http.Handler serving the embedded static assets.
+// It expects request paths relative to the UI root, e.g. "/index.html".
+func Handler() http.Handler {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		// The embedded directory is fixed at build time.
+		panic(err)
+	}
+	return http.FileServer(http.FS(sub))
+}
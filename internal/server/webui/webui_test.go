@@ -0,0 +1,46 @@
+package webui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler_ServesAssets(t *testing.T) {
+	h := Handler()
+
+	tests := []struct {
+		path       string
+		wantSubstr string
+	}{
+		{"/", "<title>GophKeeper</title>"},
+		{"/app.js", "crypto.subtle"},
+		{"/style.css", "body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", tt.path, nil)
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d; want %d", rec.Code, http.StatusOK)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantSubstr) {
+				t.Errorf("body does not contain %q", tt.wantSubstr)
+			}
+		})
+	}
+}
+
+func TestHandler_NotFound(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/missing.js", nil)
+	Handler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d; want %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// AccountRepository defines the persistence operations needed by the
+// AccountService.
+type AccountRepository interface {
+	// RenameUser changes the login of a user and, if cert is not nil,
+	// replaces its certificates with cert, returning the number revoked.
+	// It returns models.ErrUserNotFound if from does not exist and
+	// models.ErrLoginTaken if to does.
+	RenameUser(ctx context.Context, from, to string, cert *models.Certificate) (int64, error)
+}
+
+// AccountService manages the accounts of users.
+type AccountService struct {
+	repo AccountRepository
+	// cache is the sync cache to drop renamed users from, see SetCache.
+	cache SyncCache
+}
+
+// NewAccountService constructs an AccountService using the provided
+// repository.
+func NewAccountService(repo AccountRepository) *AccountService {
+	return &AccountService{repo: repo}
+}
+
+// SetCache makes renames drop the cached headers of both logins, see
+// SyncService.SetCache.
+func (s *AccountService) SetCache(cache SyncCache) {
+	s.cache = cache
+}
+
+// NormalizeLogin validates login against the login policy and returns its
+// canonical form. See the package-level NormalizeLogin.
+func (s *AccountService) NormalizeLogin(login string) (string, error) {
+	return NormalizeLogin(login)
+}
+
+// RenameUser changes the login of the user from to to and returns the new
+// login in canonical form. The new login must satisfy the login policy,
+// see NormalizeLogin, and differ from the old one. certPEM is the PEM-encoded
+// client certificate issued for the new login; in the same transaction it
+// replaces the certificates of the user, which name the old login, those
+// of the user's other devices included. The number of certificates revoked
+// is returned as well.
+func (s *AccountService) RenameUser(ctx context.Context, from, to string, certPEM []byte) (string, int64, error) {
+	to, err := NormalizeLogin(to)
+	if err != nil {
+		return "", 0, err
+	}
+	if to == from {
+		return "", 0, fmt.Errorf("%w: %s", models.ErrLoginTaken, to)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return "", 0, errors.New("invalid certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", 0, err
+	}
+	if cert.Subject.CommonName != to {
+		return "", 0, fmt.Errorf("certificate names %q, not %q", cert.Subject.CommonName, to)
+	}
+
+	revoked, err := s.repo.RenameUser(ctx, from, to, &models.Certificate{
+		Serial:      CertificateSerial(cert),
+		Login:       to,
+		Fingerprint: CertificateFingerprint(cert),
+		IssuedAt:    time.Now().Unix(),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	if s.cache != nil {
+		// Headers cached for the old login must not be served to a user
+		// registering it later
+		_ = s.cache.Invalidate(ctx, from)
+		_ = s.cache.Invalidate(ctx, to)
+	}
+	return to, revoked, nil
+}
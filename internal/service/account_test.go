@@ -0,0 +1,88 @@
+package service_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/atinyakov/GophKeeper/internal/service"
+)
+
+// memAccountRepo is an in-memory service.AccountRepository of a set of
+// logins and the serials of their certificates.
+type memAccountRepo map[string][]string
+
+func (m memAccountRepo) RenameUser(_ context.Context, from, to string, cert *models.Certificate) (int64, error) {
+	if _, ok := m[from]; !ok {
+		return 0, models.ErrUserNotFound
+	}
+	if _, ok := m[to]; ok {
+		return 0, models.ErrLoginTaken
+	}
+	revoked := int64(len(m[from]))
+	delete(m, from)
+	m[to] = []string{cert.Serial}
+	return revoked, nil
+}
+
+// certFor returns a PEM-encoded self-signed certificate for login.
+func certFor(t *testing.T, login string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(42), Subject: pkix.Name{CommonName: login}}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestAccountService_RenameUser(t *testing.T) {
+	repo := memAccountRepo{"alice": {"1", "3"}, "bob": {"2"}}
+	cache := memCache{"alice": {"s1": 1}, "carol": {"s2": 2}}
+	s := service.NewAccountService(repo)
+	s.SetCache(cache)
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		from, to string
+		want     error
+	}{
+		{"alice", "x", service.ErrInvalidLogin},
+		{"alice", "bob", models.ErrLoginTaken},
+		{"alice", "alice", models.ErrLoginTaken},
+		{"dave", "erin", models.ErrUserNotFound},
+	} {
+		if _, _, err := s.RenameUser(ctx, tt.from, tt.to, certFor(t, tt.to)); !errors.Is(err, tt.want) {
+			t.Errorf("RenameUser(%q, %q) = %v; want %v", tt.from, tt.to, err, tt.want)
+		}
+	}
+	if _, _, err := s.RenameUser(ctx, "alice", "carol", certFor(t, "alice")); err == nil {
+		t.Error("RenameUser accepted a certificate for the old login")
+	}
+
+	login, revoked, err := s.RenameUser(ctx, "alice", " Carol ", certFor(t, "carol"))
+	if err != nil || login != "carol" || repo["alice"] != nil {
+		t.Fatalf("RenameUser = %q, %v; users %v; want alice renamed to carol", login, err, repo)
+	}
+	if revoked != 2 {
+		t.Errorf("revoked = %d; want both certificates of alice", revoked)
+	}
+	if certs := repo["carol"]; len(certs) != 1 || certs[0] != "2a" {
+		t.Errorf("certificates of carol = %v; want only the new one", certs)
+	}
+	if len(cache) != 0 {
+		t.Errorf("cache = %v; want the headers of both logins dropped", cache)
+	}
+}
@@ -4,8 +4,17 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"github.com/atinyakov/GophKeeper/internal/clock"
+	"github.com/atinyakov/GophKeeper/internal/models"
 )
 
+// ErrInvalidToken is returned when an API token is unknown.
+var ErrInvalidToken = errors.New("invalid token")
+
 // AuthRepository defines the persistence operations
 // required by the authentication service.
 type AuthRepository interface {
@@ -15,6 +24,38 @@ type AuthRepository interface {
 	// RegisterUser creates a new user record with the given login.
 	// Returns an error if the operation fails.
 	RegisterUser(ctx context.Context, login string) error
+	// SaveToken stores the hash of an API token issued to the user with
+	// its lease.
+	SaveToken(ctx context.Context, login, tokenHash string, lease models.Lease) error
+	// GetUserByToken returns the login owning the token hash and the lease
+	// of the token, or an empty string if the token is unknown.
+	GetUserByToken(ctx context.Context, tokenHash string) (string, models.Lease, error)
+	// GetLeases returns the leases of the user's API tokens, oldest first.
+	GetLeases(ctx context.Context, login string) ([]models.Lease, error)
+	// UpdateLease sets the TTL and expiry of the user's lease and reports
+	// whether it exists.
+	UpdateLease(ctx context.Context, login, id string, ttl, expiresAt int64) (bool, error)
+	// DeleteLease deletes the user's API token with the given lease ID and
+	// reports whether it existed.
+	DeleteLease(ctx context.Context, login, id string) (bool, error)
+	// SaveRecoveryCodes replaces the user's recovery codes with the given hashes.
+	SaveRecoveryCodes(ctx context.Context, login string, codeHashes []string) error
+	// UseRecoveryCode deletes the user's recovery code with the given hash
+	// and reports whether it existed.
+	UseRecoveryCode(ctx context.Context, login, codeHash string) (bool, error)
+	// SaveCertificate records a certificate issued to a user.
+	SaveCertificate(ctx context.Context, c models.Certificate) error
+	// GetCertificate returns the certificate with the given serial
+	// number, or nil if it is unknown.
+	GetCertificate(ctx context.Context, serial string) (*models.Certificate, error)
+	// GetCertificates returns the certificates of the user.
+	GetCertificates(ctx context.Context, login string) ([]models.Certificate, error)
+	// RevokeCertificates revokes the active certificates of the user, or
+	// only the one with serial if not empty, and returns their number.
+	RevokeCertificates(ctx context.Context, login, serial string, at int64) (int64, error)
+	// RevokeAccess deletes all API tokens and browser sessions of the user
+	// and returns their number.
+	RevokeAccess(ctx context.Context, login string) (int64, error)
 }
 
 // Service implements authentication operations by delegating
@@ -22,12 +63,21 @@ type AuthRepository interface {
 type Service struct {
 	// repo performs the data-layer operations.
 	repo AuthRepository
+	// clock tells the time tokens and certificates are issued and expire
+	// by, see SetClock.
+	clock clock.Clock
 }
 
 // NewAuthService constructs a new Service using the provided repository.
 // repo must implement AuthRepository.
 func NewAuthService(repo AuthRepository) *Service {
-	return &Service{repo: repo}
+	return &Service{repo: repo, clock: clock.Real}
+}
+
+// SetClock replaces the system clock the service tells the time by, e.g.
+// with a clock.Fake in tests.
+func (s *Service) SetClock(c clock.Clock) {
+	s.clock = c
 }
 
 // UserExists checks whether a user with the specified login exists.
@@ -36,8 +86,47 @@ func (s *Service) UserExists(ctx context.Context, login string) (bool, error) {
 	return s.repo.UserExists(ctx, login)
 }
 
+// NormalizeLogin validates login against the login policy and returns its
+// canonical form. See the package-level NormalizeLogin.
+func (s *Service) NormalizeLogin(login string) (string, error) {
+	return NormalizeLogin(login)
+}
+
 // RegisterUser attempts to register a new user with the given login.
-// Returns an error if the repository operation fails.
+// The login must satisfy the login policy; it is stored in canonical form.
+// Returns an error if the login is invalid or the repository operation fails.
 func (s *Service) RegisterUser(ctx context.Context, login string) error {
+	login, err := NormalizeLogin(login)
+	if err != nil {
+		return err
+	}
 	return s.repo.RegisterUser(ctx, login)
 }
+
+// IssueToken generates a new random API token for the user that never
+// expires, stores its hash and returns the token. The plaintext token is
+// never persisted.
+func (s *Service) IssueToken(ctx context.Context, login string) (string, error) {
+	token, _, err := s.IssueLease(ctx, login, 0)
+	return token, err
+}
+
+// AuthenticateToken resolves an API token to the login of its owner and
+// the ID of its lease. It returns ErrInvalidToken if the token is unknown
+// or its lease has expired.
+func (s *Service) AuthenticateToken(ctx context.Context, token string) (string, string, error) {
+	login, lease, err := s.repo.GetUserByToken(ctx, hashToken(token))
+	if err != nil {
+		return "", "", err
+	}
+	if login == "" || expired(lease, s.clock.Now()) {
+		return "", "", ErrInvalidToken
+	}
+	return login, lease.ID, nil
+}
+
+// hashToken returns the hex-encoded SHA-256 digest of an API token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -4,11 +4,26 @@ import (
 	"context"
 	"errors"
 	"testing"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
 )
 
 type mockAuthRepo struct {
-	UserExistsFunc   func(ctx context.Context, login string) (bool, error)
-	RegisterUserFunc func(ctx context.Context, login string) error
+	UserExistsFunc     func(ctx context.Context, login string) (bool, error)
+	RegisterUserFunc   func(ctx context.Context, login string) error
+	SaveRecoveryFunc   func(ctx context.Context, login string, codeHashes []string) error
+	UseRecoveryFunc    func(ctx context.Context, login, codeHash string) (bool, error)
+
+	// certs is an in-memory certificates table.
+	certs []models.Certificate
+	// tokens is an in-memory API tokens table.
+	tokens []mockToken
+}
+
+// mockToken is a row of mockAuthRepo.tokens.
+type mockToken struct {
+	hash, login string
+	lease       models.Lease
 }
 
 func (m *mockAuthRepo) UserExists(ctx context.Context, login string) (bool, error) {
@@ -17,6 +32,95 @@ func (m *mockAuthRepo) UserExists(ctx context.Context, login string) (bool, erro
 func (m *mockAuthRepo) RegisterUser(ctx context.Context, login string) error {
 	return m.RegisterUserFunc(ctx, login)
 }
+func (m *mockAuthRepo) SaveToken(ctx context.Context, login, tokenHash string, lease models.Lease) error {
+	m.tokens = append(m.tokens, mockToken{hash: tokenHash, login: login, lease: lease})
+	return nil
+}
+func (m *mockAuthRepo) GetUserByToken(ctx context.Context, tokenHash string) (string, models.Lease, error) {
+	for _, t := range m.tokens {
+		if t.hash == tokenHash {
+			return t.login, t.lease, nil
+		}
+	}
+	return "", models.Lease{}, nil
+}
+func (m *mockAuthRepo) GetLeases(ctx context.Context, login string) ([]models.Lease, error) {
+	var leases []models.Lease
+	for _, t := range m.tokens {
+		if t.login == login {
+			leases = append(leases, t.lease)
+		}
+	}
+	return leases, nil
+}
+func (m *mockAuthRepo) UpdateLease(ctx context.Context, login, id string, ttl, expiresAt int64) (bool, error) {
+	for i, t := range m.tokens {
+		if t.login == login && t.lease.ID == id {
+			m.tokens[i].lease.TTL, m.tokens[i].lease.ExpiresAt = ttl, expiresAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+func (m *mockAuthRepo) DeleteLease(ctx context.Context, login, id string) (bool, error) {
+	for i, t := range m.tokens {
+		if t.login == login && t.lease.ID == id {
+			m.tokens = append(m.tokens[:i], m.tokens[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+func (m *mockAuthRepo) SaveRecoveryCodes(ctx context.Context, login string, codeHashes []string) error {
+	return m.SaveRecoveryFunc(ctx, login, codeHashes)
+}
+func (m *mockAuthRepo) UseRecoveryCode(ctx context.Context, login, codeHash string) (bool, error) {
+	return m.UseRecoveryFunc(ctx, login, codeHash)
+}
+
+func (m *mockAuthRepo) SaveCertificate(ctx context.Context, c models.Certificate) error {
+	m.certs = append(m.certs, c)
+	return nil
+}
+func (m *mockAuthRepo) GetCertificate(ctx context.Context, serial string) (*models.Certificate, error) {
+	for _, c := range m.certs {
+		if c.Serial == serial {
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+func (m *mockAuthRepo) GetCertificates(ctx context.Context, login string) ([]models.Certificate, error) {
+	var certs []models.Certificate
+	for _, c := range m.certs {
+		if c.Login == login {
+			certs = append(certs, c)
+		}
+	}
+	return certs, nil
+}
+func (m *mockAuthRepo) RevokeAccess(ctx context.Context, login string) (int64, error) {
+	var n int64
+	for i := 0; i < len(m.tokens); {
+		if m.tokens[i].login == login {
+			m.tokens = append(m.tokens[:i], m.tokens[i+1:]...)
+			n++
+			continue
+		}
+		i++
+	}
+	return n, nil
+}
+func (m *mockAuthRepo) RevokeCertificates(ctx context.Context, login, serial string, at int64) (int64, error) {
+	var n int64
+	for i, c := range m.certs {
+		if c.Login == login && (serial == "" || c.Serial == serial) && c.RevokedAt == 0 {
+			m.certs[i].RevokedAt = at
+			n++
+		}
+	}
+	return n, nil
+}
 
 func TestUserExists_Success(t *testing.T) {
 	want := true
@@ -92,3 +196,60 @@ func TestRegisterUser_Error(t *testing.T) {
 		t.Fatalf("RegisterUser error = %v; want %v", err, wantErr)
 	}
 }
+
+func TestRegisterUser_Policy(t *testing.T) {
+	var got string
+	repo := &mockAuthRepo{
+		RegisterUserFunc: func(ctx context.Context, login string) error {
+			got = login
+			return nil
+		},
+	}
+	svc := NewAuthService(repo)
+
+	if err := svc.RegisterUser(context.Background(), " Erin "); err != nil {
+		t.Fatalf("RegisterUser returned error: %v", err)
+	}
+	if got != "erin" {
+		t.Errorf("RegisterUser stored login = %q; want %q", got, "erin")
+	}
+
+	got = ""
+	if err := svc.RegisterUser(context.Background(), "root"); !errors.Is(err, ErrInvalidLogin) {
+		t.Fatalf("RegisterUser error = %v; want %v", err, ErrInvalidLogin)
+	}
+	if got != "" {
+		t.Error("invalid login must not reach the repository")
+	}
+}
+
+func TestIssueAndAuthenticateToken(t *testing.T) {
+	repo := &mockAuthRepo{}
+	svc := NewAuthService(repo)
+
+	token, err := svc.IssueToken(context.Background(), "erin")
+	if err != nil {
+		t.Fatalf("IssueToken returned error: %v", err)
+	}
+	if token == "" {
+		t.Fatal("IssueToken returned empty token")
+	}
+	if len(repo.tokens) != 1 || repo.tokens[0].hash == token {
+		t.Error("plaintext token must not be stored")
+	}
+	if lease := repo.tokens[0].lease; lease.ExpiresAt != 0 || len(lease.ID) != leaseIDLen {
+		t.Errorf("lease = %+v; want one that never expires", lease)
+	}
+
+	login, leaseID, err := svc.AuthenticateToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("AuthenticateToken returned error: %v", err)
+	}
+	if login != "erin" || leaseID != repo.tokens[0].lease.ID {
+		t.Errorf("AuthenticateToken = %q, %q; want %q, %q", login, leaseID, "erin", repo.tokens[0].lease.ID)
+	}
+
+	if _, _, err := svc.AuthenticateToken(context.Background(), "bogus"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("AuthenticateToken(bogus) error = %v; want %v", err, ErrInvalidToken)
+	}
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+var (
+	// ErrUnknownCertificate is returned for client certificates that were
+	// not issued to the user they name.
+	ErrUnknownCertificate = errors.New("unknown client certificate")
+	// ErrRevokedCertificate is returned for revoked client certificates.
+	ErrRevokedCertificate = errors.New("client certificate revoked")
+)
+
+// CertificateSerial returns the serial number of cert as used to identify
+// certificates and devices: lower-case hexadecimal.
+func CertificateSerial(cert *x509.Certificate) string {
+	return cert.SerialNumber.Text(16)
+}
+
+// CertificateFingerprint returns the hex-encoded SHA-256 digest of cert.
+func CertificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// BindCertificate records the PEM-encoded certificate issued to the user,
+// so that CheckCertificate accepts it. With revokeOthers, e.g. on account
+// recovery, all other certificates of the user are revoked, and so are all
+// API tokens and browser sessions, which the devices of those may hold.
+func (s *Service) BindCertificate(ctx context.Context, login string, certPEM []byte, revokeOthers bool) error {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return errors.New("invalid certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+	now := s.clock.Now().Unix()
+	if revokeOthers {
+		if _, err := s.repo.RevokeCertificates(ctx, login, "", now); err != nil {
+			return err
+		}
+		if _, err := s.repo.RevokeAccess(ctx, login); err != nil {
+			return err
+		}
+	}
+	return s.repo.SaveCertificate(ctx, models.Certificate{
+		Serial:      CertificateSerial(cert),
+		Login:       login,
+		Fingerprint: CertificateFingerprint(cert),
+		IssuedAt:    now,
+	})
+}
+
+// ReplaceCertificate records the PEM-encoded certificate issued to the
+// user in place of old, which is revoked, e.g. when a device renews its
+// certificate. The other certificates of the user stay valid. The new
+// certificate is recorded first, so that a failure leaves the device with
+// a valid one.
+func (s *Service) ReplaceCertificate(ctx context.Context, login string, old *x509.Certificate, certPEM []byte) error {
+	if err := s.BindCertificate(ctx, login, certPEM, false); err != nil {
+		return err
+	}
+	_, err := s.repo.RevokeCertificates(ctx, login, CertificateSerial(old), s.clock.Now().Unix())
+	return err
+}
+
+// CheckCertificate verifies that cert, which names login as its common
+// name, was issued to the user and is still active. A CA-signed certificate
+// with a matching name is not enough, so a renamed or independently issued
+// certificate cannot impersonate the user.
+//
+// Users registered before certificates were recorded have none on record;
+// the first certificate they present is bound to them.
+func (s *Service) CheckCertificate(ctx context.Context, login string, cert *x509.Certificate) error {
+	c, err := s.repo.GetCertificate(ctx, CertificateSerial(cert))
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		known, err := s.repo.GetCertificates(ctx, login)
+		if err != nil {
+			return err
+		}
+		if len(known) > 0 {
+			return ErrUnknownCertificate
+		}
+		if exists, err := s.repo.UserExists(ctx, login); err != nil || !exists {
+			return cmp.Or(err, ErrUnknownCertificate)
+		}
+		return s.repo.SaveCertificate(ctx, models.Certificate{
+			Serial:      CertificateSerial(cert),
+			Login:       login,
+			Fingerprint: CertificateFingerprint(cert),
+			IssuedAt:    s.clock.Now().Unix(),
+		})
+	}
+	if c.Login != login || c.Fingerprint != CertificateFingerprint(cert) {
+		return ErrUnknownCertificate
+	}
+	if c.RevokedAt != 0 {
+		return ErrRevokedCertificate
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// testCertificate returns a self-signed certificate for login with serial.
+func testCertificate(t *testing.T, login string, serial int64) (*x509.Certificate, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(serial), Subject: pkix.Name{CommonName: login}}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCheckCertificate(t *testing.T) {
+	repo := &mockAuthRepo{}
+	svc := NewAuthService(repo)
+	ctx := context.Background()
+
+	issued, issuedPEM := testCertificate(t, "alice", 10)
+	if err := svc.BindCertificate(ctx, "alice", issuedPEM, false); err != nil {
+		t.Fatalf("BindCertificate returned error: %v", err)
+	}
+	if err := svc.CheckCertificate(ctx, "alice", issued); err != nil {
+		t.Errorf("CheckCertificate of the issued certificate = %v; want nil", err)
+	}
+
+	// Another certificate naming alice is rejected
+	other, _ := testCertificate(t, "alice", 11)
+	if err := svc.CheckCertificate(ctx, "alice", other); !errors.Is(err, ErrUnknownCertificate) {
+		t.Errorf("CheckCertificate of another certificate = %v; want ErrUnknownCertificate", err)
+	}
+	// So is one reusing the serial number
+	forged, _ := testCertificate(t, "alice", 10)
+	if err := svc.CheckCertificate(ctx, "alice", forged); !errors.Is(err, ErrUnknownCertificate) {
+		t.Errorf("CheckCertificate of a certificate with the same serial = %v; want ErrUnknownCertificate", err)
+	}
+	// And alice's certificate renamed to bob
+	if err := svc.CheckCertificate(ctx, "bob", issued); !errors.Is(err, ErrUnknownCertificate) {
+		t.Errorf("CheckCertificate for another user = %v; want ErrUnknownCertificate", err)
+	}
+
+	// Recovery revokes the previous certificates and tokens
+	token, err := svc.IssueToken(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, recoveredPEM := testCertificate(t, "alice", 12)
+	if err := svc.BindCertificate(ctx, "alice", recoveredPEM, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CheckCertificate(ctx, "alice", issued); !errors.Is(err, ErrRevokedCertificate) {
+		t.Errorf("CheckCertificate after recovery = %v; want ErrRevokedCertificate", err)
+	}
+	if _, _, err := svc.AuthenticateToken(ctx, token); err == nil {
+		t.Error("AuthenticateToken after recovery succeeded; want the token revoked")
+	}
+}
+
+func TestReplaceCertificate(t *testing.T) {
+	repo := &mockAuthRepo{}
+	svc := NewAuthService(repo)
+	ctx := context.Background()
+
+	laptop, laptopPEM := testCertificate(t, "alice", 10)
+	phone, phonePEM := testCertificate(t, "alice", 11)
+	for _, c := range [][]byte{laptopPEM, phonePEM} {
+		if err := svc.BindCertificate(ctx, "alice", c, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	renewed, renewedPEM := testCertificate(t, "alice", 12)
+	if err := svc.ReplaceCertificate(ctx, "alice", laptop, renewedPEM); err != nil {
+		t.Fatalf("ReplaceCertificate returned error: %v", err)
+	}
+	if err := svc.CheckCertificate(ctx, "alice", renewed); err != nil {
+		t.Errorf("CheckCertificate of the renewed certificate = %v; want nil", err)
+	}
+	if err := svc.CheckCertificate(ctx, "alice", laptop); !errors.Is(err, ErrRevokedCertificate) {
+		t.Errorf("CheckCertificate of the replaced certificate = %v; want ErrRevokedCertificate", err)
+	}
+	// The other devices keep theirs
+	if err := svc.CheckCertificate(ctx, "alice", phone); err != nil {
+		t.Errorf("CheckCertificate of another device = %v; want nil", err)
+	}
+}
+
+func TestCheckCertificate_BindsFirstCertificateOfExistingUser(t *testing.T) {
+	repo := &mockAuthRepo{
+		UserExistsFunc: func(ctx context.Context, login string) (bool, error) { return login == "carol", nil },
+	}
+	svc := NewAuthService(repo)
+	ctx := context.Background()
+
+	first, _ := testCertificate(t, "carol", 20)
+	if err := svc.CheckCertificate(ctx, "carol", first); err != nil {
+		t.Fatalf("CheckCertificate of the first certificate = %v; want nil", err)
+	}
+	second, _ := testCertificate(t, "carol", 21)
+	if err := svc.CheckCertificate(ctx, "carol", second); !errors.Is(err, ErrUnknownCertificate) {
+		t.Errorf("CheckCertificate of a second certificate = %v; want ErrUnknownCertificate", err)
+	}
+
+	// Certificates naming unknown users are not bound
+	stray, _ := testCertificate(t, "mallory", 22)
+	if err := svc.CheckCertificate(ctx, "mallory", stray); !errors.Is(err, ErrUnknownCertificate) {
+		t.Errorf("CheckCertificate of an unknown user = %v; want ErrUnknownCertificate", err)
+	}
+	if len(repo.certs) != 1 {
+		t.Errorf("certificates = %+v; want only carol's first", repo.certs)
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// ExportRepository defines the persistence operations needed by the
+// ExportService.
+type ExportRepository interface {
+	// EachSecret calls fn with every secret of the user, including the
+	// tombstones of deleted secrets, stopping at the first error of fn.
+	EachSecret(ctx context.Context, userID string, fn func(models.Secret) error) error
+	// GetDevices returns the devices of the user, most recently synced first.
+	GetDevices(ctx context.Context, userID string) ([]models.Device, error)
+}
+
+// AuditLog reads the audit trail.
+type AuditLog interface {
+	// GetEvents returns the audit events of the user, oldest first.
+	GetEvents(ctx context.Context, login string) ([]models.AuditEvent, error)
+}
+
+// ExportService collects everything stored about a user for takeout.
+type ExportService struct {
+	repo  ExportRepository
+	audit AuditLog
+	// now returns the current time; replaced in tests.
+	now func() time.Time
+}
+
+// NewExportService constructs an ExportService reading secrets and devices
+// from repo and audit events from audit.
+func NewExportService(repo ExportRepository, audit AuditLog) *ExportService {
+	return &ExportService{repo: repo, audit: audit, now: time.Now}
+}
+
+// Export passes every secret of the user, including tombstones, to emit and
+// returns the rest of the user's data: the keys "user", "exported_at" (Unix
+// time), "devices" and "audit". Devices and audit events are read first, so
+// that failures to read them are reported before anything is emitted.
+func (s *ExportService) Export(ctx context.Context, userID string, emit func(models.Secret) error) (map[string]any, error) {
+	devices, err := s.repo.GetDevices(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.audit.GetEvents(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.EachSecret(ctx, userID, emit); err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"user":        userID,
+		"exported_at": s.now().Unix(),
+		"devices":     nonNilSlice(devices),
+		"audit":       nonNilSlice(events),
+	}, nil
+}
+
+// nonNilSlice returns s, or an empty slice if s is nil, so that it is
+// encoded as an empty JSON array.
+func nonNilSlice[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
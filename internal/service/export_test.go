@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// memExportRepo is an in-memory ExportRepository and AuditLog.
+type memExportRepo struct {
+	secrets []models.Secret
+	devices []models.Device
+	events  []models.AuditEvent
+	err     error
+}
+
+func (m *memExportRepo) EachSecret(ctx context.Context, userID string, fn func(models.Secret) error) error {
+	for _, sec := range m.secrets {
+		if err := fn(sec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memExportRepo) GetDevices(ctx context.Context, userID string) ([]models.Device, error) {
+	return m.devices, nil
+}
+
+func (m *memExportRepo) GetEvents(ctx context.Context, login string) ([]models.AuditEvent, error) {
+	return m.events, m.err
+}
+
+func TestExport(t *testing.T) {
+	repo := &memExportRepo{
+		secrets: []models.Secret{{ID: "a", Version: 1}, {ID: "b", Version: 3, Deleted: true}},
+		events:  []models.AuditEvent{{Time: 5, Login: "alice", Action: "register"}},
+	}
+	s := NewExportService(repo, repo)
+	s.now = func() time.Time { return time.Unix(1000, 0) }
+
+	var emitted []models.Secret
+	result, err := s.Export(context.Background(), "alice", func(sec models.Secret) error {
+		emitted = append(emitted, sec)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+	if len(emitted) != 2 || !emitted[1].Deleted {
+		t.Errorf("emitted %+v; want the secret and the tombstone", emitted)
+	}
+	if result["user"] != "alice" || result["exported_at"] != int64(1000) {
+		t.Errorf("result = %v; want user alice exported at 1000", result)
+	}
+	if devices, ok := result["devices"].([]models.Device); !ok || devices == nil {
+		t.Errorf("devices = %#v; want an empty list", result["devices"])
+	}
+	if events := result["audit"].([]models.AuditEvent); len(events) != 1 {
+		t.Errorf("audit = %v; want the register event", events)
+	}
+}
+
+func TestExport_FailsBeforeEmitting(t *testing.T) {
+	repo := &memExportRepo{secrets: []models.Secret{{ID: "a"}}, err: errors.New("db down")}
+	s := NewExportService(repo, repo)
+	emitted := 0
+	_, err := s.Export(context.Background(), "alice", func(models.Secret) error {
+		emitted++
+		return nil
+	})
+	if err == nil || emitted != 0 {
+		t.Errorf("Export = %v after %d secrets; want an error before any secret", err, emitted)
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxSeenEntries bounds the devices remembered by a SeenTracker before
+// entries older than its interval are dropped.
+const maxSeenEntries = 10000
+
+// SeenRepository records when devices were last seen.
+type SeenRepository interface {
+	// TouchSeen records an authenticated request of the device at the given
+	// Unix time.
+	TouchSeen(ctx context.Context, userID, deviceID string, at int64) error
+}
+
+// SeenTracker records the last authenticated request of every device. It
+// writes at most once per interval and device, so that busy clients do not
+// cost a database write per request; the recorded time lags by at most the
+// interval. It is safe for concurrent use.
+type SeenTracker struct {
+	repo     SeenRepository
+	interval time.Duration
+	now      func() time.Time
+
+	mu   sync.Mutex
+	last map[[2]string]time.Time
+}
+
+// NewSeenTracker constructs a SeenTracker writing to repo at most once per
+// interval and device.
+func NewSeenTracker(repo SeenRepository, interval time.Duration) *SeenTracker {
+	return &SeenTracker{repo: repo, interval: interval, now: time.Now, last: make(map[[2]string]time.Time)}
+}
+
+// RecordSeen records a request of the given device of the user, unless one
+// was recorded less than the interval ago.
+func (t *SeenTracker) RecordSeen(ctx context.Context, userID, deviceID string) error {
+	now := t.now()
+	k := [2]string{userID, deviceID}
+
+	t.mu.Lock()
+	if last, ok := t.last[k]; ok && now.Sub(last) < t.interval {
+		t.mu.Unlock()
+		return nil
+	}
+	if len(t.last) >= maxSeenEntries {
+		for key, last := range t.last {
+			if now.Sub(last) >= t.interval {
+				delete(t.last, key)
+			}
+		}
+	}
+	t.last[k] = now
+	t.mu.Unlock()
+
+	if err := t.repo.TouchSeen(ctx, userID, deviceID, now.Unix()); err != nil {
+		// Try again with the next request
+		t.mu.Lock()
+		delete(t.last, k)
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// seenRepo records the TouchSeen calls, failing while err is set.
+type seenRepo struct {
+	calls []int64
+	err   error
+}
+
+func (r *seenRepo) TouchSeen(ctx context.Context, userID, deviceID string, at int64) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.calls = append(r.calls, at)
+	return nil
+}
+
+func TestSeenTracker(t *testing.T) {
+	repo := &seenRepo{}
+	tracker := NewSeenTracker(repo, time.Minute)
+	now := time.Unix(1000, 0)
+	tracker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_ = tracker.RecordSeen(ctx, "alice", "ff")
+	now = now.Add(30 * time.Second)
+	_ = tracker.RecordSeen(ctx, "alice", "ff")
+	_ = tracker.RecordSeen(ctx, "alice", "ee")
+	now = now.Add(31 * time.Second)
+	_ = tracker.RecordSeen(ctx, "alice", "ff")
+
+	// The second request of ff falls into the interval of the first
+	if want := []int64{1000, 1030, 1061}; len(repo.calls) != len(want) || repo.calls[0] != want[0] || repo.calls[1] != want[1] || repo.calls[2] != want[2] {
+		t.Errorf("TouchSeen calls = %v; want %v", repo.calls, want)
+	}
+
+	// A failed write is retried with the next request
+	repo.err = errors.New("db down")
+	now = now.Add(time.Hour)
+	if err := tracker.RecordSeen(ctx, "bob", "aa"); err == nil {
+		t.Error("RecordSeen succeeded; want the repository error")
+	}
+	repo.err = nil
+	_ = tracker.RecordSeen(ctx, "bob", "aa")
+	if len(repo.calls) != 4 {
+		t.Errorf("TouchSeen calls = %v; want the failed write retried", repo.calls)
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// MaxLeaseTTL is the longest lifetime an API token may be issued or
+// renewed for.
+const MaxLeaseTTL = 90 * 24 * time.Hour
+
+// leaseIDLen is the number of hex digits of the token hash forming the
+// lease ID.
+const leaseIDLen = 16
+
+// IssueLease generates a new random API token for the user that expires
+// after ttl, or never if ttl is 0, and returns the token and its lease.
+// Like with IssueToken, only the hash of the token is stored.
+func (s *Service) IssueLease(ctx context.Context, login string, ttl time.Duration) (string, *models.Lease, error) {
+	if ttl != 0 {
+		if err := checkTTL(ttl); err != nil {
+			return "", nil, err
+		}
+	}
+	token, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	hash := hashToken(token)
+	lease := models.Lease{ID: hash[:leaseIDLen], IssuedAt: s.clock.Now().Unix()}
+	if ttl != 0 {
+		lease.TTL = int64(ttl / time.Second)
+		lease.ExpiresAt = lease.IssuedAt + lease.TTL
+	}
+	if err := s.repo.SaveToken(ctx, login, hash, lease); err != nil {
+		return "", nil, err
+	}
+	return token, &lease, nil
+}
+
+// Leases returns the leases of the user's API tokens, oldest first,
+// including expired ones, with the secrets sent to each token.
+func (s *Service) Leases(ctx context.Context, login string) ([]models.Lease, error) {
+	return s.repo.GetLeases(ctx, login)
+}
+
+// RenewLease extends the user's lease with the given ID to expire ttl from
+// now, or the TTL of the lease if ttl is 0. Tokens that never expired get
+// an expiry this way. It returns models.ErrLeaseNotFound for unknown IDs,
+// models.ErrLeaseExpired if the lease has already expired, as expired
+// tokens must not be revived, and models.ErrInvalidTTL for TTLs out of
+// range.
+func (s *Service) RenewLease(ctx context.Context, login, id string, ttl time.Duration) (*models.Lease, error) {
+	lease, err := s.lease(ctx, login, id)
+	if err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	if expired(*lease, now) {
+		return nil, models.ErrLeaseExpired
+	}
+	if ttl == 0 {
+		if lease.TTL == 0 {
+			return nil, fmt.Errorf("%w: the lease does not expire, give a ttl", models.ErrInvalidTTL)
+		}
+		ttl = time.Duration(lease.TTL) * time.Second
+	}
+	if err := checkTTL(ttl); err != nil {
+		return nil, err
+	}
+
+	lease.TTL = int64(ttl / time.Second)
+	lease.ExpiresAt = now.Unix() + lease.TTL
+	ok, err := s.repo.UpdateLease(ctx, login, id, lease.TTL, lease.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// Revoked meanwhile
+		return nil, models.ErrLeaseNotFound
+	}
+	return lease, nil
+}
+
+// RevokeLease deletes the user's API token with the given lease ID, so that
+// it is rejected from then on. It returns models.ErrLeaseNotFound for
+// unknown IDs.
+func (s *Service) RevokeLease(ctx context.Context, login, id string) error {
+	ok, err := s.repo.DeleteLease(ctx, login, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return models.ErrLeaseNotFound
+	}
+	return nil
+}
+
+// lease returns the user's lease with the given ID.
+func (s *Service) lease(ctx context.Context, login, id string) (*models.Lease, error) {
+	leases, err := s.repo.GetLeases(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range leases {
+		if l.ID == id {
+			return &l, nil
+		}
+	}
+	return nil, models.ErrLeaseNotFound
+}
+
+// checkTTL returns models.ErrInvalidTTL unless ttl is whole seconds between
+// one second and MaxLeaseTTL.
+func checkTTL(ttl time.Duration) error {
+	if ttl < time.Second || ttl > MaxLeaseTTL || ttl%time.Second != 0 {
+		return fmt.Errorf("%w: must be whole seconds between 1s and %s", models.ErrInvalidTTL, MaxLeaseTTL)
+	}
+	return nil
+}
+
+// expired reports whether lease has expired at now.
+func expired(lease models.Lease, now time.Time) bool {
+	return lease.ExpiresAt != 0 && now.Unix() >= lease.ExpiresAt
+}
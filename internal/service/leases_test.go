@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/clock"
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+func TestIssueLease(t *testing.T) {
+	repo := &mockAuthRepo{}
+	svc := NewAuthService(repo)
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	svc.SetClock(clk)
+	ctx := context.Background()
+
+	for _, ttl := range []time.Duration{-time.Second, time.Millisecond, 1500 * time.Millisecond, MaxLeaseTTL + time.Second} {
+		if _, _, err := svc.IssueLease(ctx, "erin", ttl); !errors.Is(err, models.ErrInvalidTTL) {
+			t.Errorf("IssueLease(%s) error = %v; want %v", ttl, err, models.ErrInvalidTTL)
+		}
+	}
+
+	token, lease, err := svc.IssueLease(ctx, "erin", time.Hour)
+	if err != nil {
+		t.Fatalf("IssueLease returned error: %v", err)
+	}
+	if lease.IssuedAt != 1700000000 || lease.TTL != 3600 || lease.ExpiresAt != lease.IssuedAt+3600 {
+		t.Errorf("lease = %+v; want one expiring in an hour", lease)
+	}
+	clk.Advance(time.Hour - time.Second)
+	if _, _, err := svc.AuthenticateToken(ctx, token); err != nil {
+		t.Errorf("AuthenticateToken returned error: %v", err)
+	}
+
+	// Expired tokens are rejected
+	clk.Advance(time.Second)
+	if _, _, err := svc.AuthenticateToken(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("AuthenticateToken(expired) error = %v; want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestRenewLease(t *testing.T) {
+	now := time.Now().Unix()
+	repo := &mockAuthRepo{tokens: []mockToken{
+		{hash: "h1", login: "erin", lease: models.Lease{ID: "ci", IssuedAt: now - 100, TTL: 600, ExpiresAt: now + 500}},
+		{hash: "h2", login: "erin", lease: models.Lease{ID: "forever", IssuedAt: now - 100}},
+		{hash: "h3", login: "erin", lease: models.Lease{ID: "old", IssuedAt: now - 100, TTL: 60, ExpiresAt: now - 40}},
+		{hash: "h4", login: "frank", lease: models.Lease{ID: "other", IssuedAt: now - 100, TTL: 60, ExpiresAt: now + 40}},
+	}}
+	svc := NewAuthService(repo)
+	ctx := context.Background()
+
+	// The TTL of the lease is granted again from now
+	lease, err := svc.RenewLease(ctx, "erin", "ci", 0)
+	if err != nil {
+		t.Fatalf("RenewLease returned error: %v", err)
+	}
+	if lease.TTL != 600 || lease.ExpiresAt < now+600 || repo.tokens[0].lease.ExpiresAt != lease.ExpiresAt {
+		t.Errorf("renewed lease = %+v; want it to expire in 600s", lease)
+	}
+	if lease, err := svc.RenewLease(ctx, "erin", "ci", time.Minute); err != nil || lease.TTL != 60 {
+		t.Errorf("RenewLease(1m) = %+v, %v; want a TTL of 60s", lease, err)
+	}
+
+	tests := []struct {
+		id   string
+		ttl  time.Duration
+		want error
+	}{
+		{"forever", 0, models.ErrInvalidTTL},
+		{"old", time.Hour, models.ErrLeaseExpired},
+		{"other", time.Hour, models.ErrLeaseNotFound},
+		{"ci", MaxLeaseTTL + time.Hour, models.ErrInvalidTTL},
+	}
+	for _, tt := range tests {
+		if _, err := svc.RenewLease(ctx, "erin", tt.id, tt.ttl); !errors.Is(err, tt.want) {
+			t.Errorf("RenewLease(%s, %s) error = %v; want %v", tt.id, tt.ttl, err, tt.want)
+		}
+	}
+
+	// Tokens that never expired can be given an expiry
+	if lease, err := svc.RenewLease(ctx, "erin", "forever", time.Hour); err != nil || lease.ExpiresAt == 0 {
+		t.Errorf("RenewLease(forever, 1h) = %+v, %v; want an expiry", lease, err)
+	}
+}
+
+func TestRevokeLease(t *testing.T) {
+	repo := &mockAuthRepo{}
+	svc := NewAuthService(repo)
+	ctx := context.Background()
+
+	token, lease, err := svc.IssueLease(ctx, "erin", time.Hour)
+	if err != nil {
+		t.Fatalf("IssueLease returned error: %v", err)
+	}
+	if err := svc.RevokeLease(ctx, "frank", lease.ID); !errors.Is(err, models.ErrLeaseNotFound) {
+		t.Errorf("RevokeLease by another user error = %v; want %v", err, models.ErrLeaseNotFound)
+	}
+	if err := svc.RevokeLease(ctx, "erin", lease.ID); err != nil {
+		t.Fatalf("RevokeLease returned error: %v", err)
+	}
+	if _, _, err := svc.AuthenticateToken(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("AuthenticateToken(revoked) error = %v; want %v", err, ErrInvalidToken)
+	}
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidLogin is returned, wrapped with the violated rule, when a login
+// does not satisfy the login policy.
+var ErrInvalidLogin = errors.New("invalid login")
+
+const (
+	// MinLoginLength is the minimum length of a login.
+	MinLoginLength = 3
+	// MaxLoginLength is the maximum length of a login.
+	MaxLoginLength = 32
+)
+
+// reservedLogins lists logins that cannot be registered because they could
+// be mistaken for the service or its operators.
+var reservedLogins = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"root":          true,
+	"system":        true,
+	"support":       true,
+	"security":      true,
+	"server":        true,
+	"ca":            true,
+	"api":           true,
+	"gophkeeper":    true,
+	"null":          true,
+	"nobody":        true,
+}
+
+// NormalizeLogin validates login against the login policy and returns its
+// canonical form. Surrounding spaces are trimmed and letters are lowercased,
+// so logins are unique regardless of case. A valid login is 3 to 32
+// characters long, consists of ASCII letters, digits, '.', '_' and '-',
+// starts with a letter or digit and is not a reserved name.
+func NormalizeLogin(login string) (string, error) {
+	login = strings.ToLower(strings.TrimSpace(login))
+
+	if len(login) < MinLoginLength || len(login) > MaxLoginLength {
+		return "", fmt.Errorf("%w: must be %d to %d characters long", ErrInvalidLogin, MinLoginLength, MaxLoginLength)
+	}
+	for i, c := range login {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case (c == '.' || c == '_' || c == '-') && i > 0:
+		default:
+			return "", fmt.Errorf("%w: must start with a letter or digit and contain only letters, digits, '.', '_' and '-'", ErrInvalidLogin)
+		}
+	}
+	if reservedLogins[login] {
+		return "", fmt.Errorf("%w: %q is reserved", ErrInvalidLogin, login)
+	}
+	return login, nil
+}
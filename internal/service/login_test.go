@@ -0,0 +1,45 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeLogin(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"simple", "alice", "alice", false},
+		{"lowercased and trimmed", "  Alice.Smith ", "alice.smith", false},
+		{"digits and symbols", "bob_2-x", "bob_2-x", false},
+		{"too short", "ab", "", true},
+		{"too long", "abcdefghijklmnopqrstuvwxyz0123456789", "", true},
+		{"leading symbol", ".alice", "", true},
+		{"space inside", "al ice", "", true},
+		{"control character", "ali\x00ce", "", true},
+		{"non-ASCII", "алиса", "", true},
+		{"CN injection", "alice,O=evil", "", true},
+		{"reserved", "Admin", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeLogin(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidLogin) {
+					t.Errorf("NormalizeLogin(%q) error = %v; want %v", tt.in, err, ErrInvalidLogin)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeLogin(%q) returned error: %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeLogin(%q) = %q; want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/atinyakov/GophKeeper/internal/notify"
+)
+
+// MaxNotificationChannels is the number of notification channels a user
+// may have.
+const MaxNotificationChannels = 10
+
+// NotificationRepository defines the persistence operations needed by the
+// NotificationService.
+type NotificationRepository interface {
+	// GetChannels returns the notification channels of the user, oldest first.
+	GetChannels(ctx context.Context, login string) ([]models.NotificationChannel, error)
+	// AddChannel stores a notification channel of the user and returns its ID.
+	AddChannel(ctx context.Context, login string, c models.NotificationChannel) (int64, error)
+	// DeleteChannel removes a notification channel of the user and reports
+	// whether it existed.
+	DeleteChannel(ctx context.Context, login string, id int64) (bool, error)
+}
+
+// NotificationService manages the notification channels of users.
+type NotificationService struct {
+	repo NotificationRepository
+	// kinds are the kinds of channels the server can deliver to.
+	kinds []string
+}
+
+// NewNotificationService constructs a NotificationService accepting
+// channels of the given kinds, e.g. notify.Notifier.Kinds.
+func NewNotificationService(repo NotificationRepository, kinds []string) *NotificationService {
+	return &NotificationService{repo: repo, kinds: kinds}
+}
+
+// Channels returns the notification channels of the user.
+func (s *NotificationService) Channels(ctx context.Context, login string) ([]models.NotificationChannel, error) {
+	return s.repo.GetChannels(ctx, login)
+}
+
+// AddChannel validates and stores a notification channel of the user and
+// returns it with its ID. Channels of kinds the server is not configured
+// for, e.g. email without an SMTP relay, and channels beyond
+// MaxNotificationChannels are rejected with models.ErrInvalidChannel.
+func (s *NotificationService) AddChannel(ctx context.Context, login string, c models.NotificationChannel) (*models.NotificationChannel, error) {
+	if err := notify.ValidateChannel(c); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(s.kinds, c.Kind) {
+		return nil, fmt.Errorf("%w: %s notifications are not enabled on this server", models.ErrInvalidChannel, c.Kind)
+	}
+	existing, err := s.repo.GetChannels(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= MaxNotificationChannels {
+		return nil, fmt.Errorf("%w: at most %d channels", models.ErrInvalidChannel, MaxNotificationChannels)
+	}
+
+	c.Events = slices.Compact(slices.Sorted(slices.Values(c.Events)))
+	if c.ID, err = s.repo.AddChannel(ctx, login, c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// DeleteChannel removes the user's notification channel with the given ID,
+// or returns models.ErrChannelNotFound.
+func (s *NotificationService) DeleteChannel(ctx context.Context, login string, id int64) error {
+	ok, err := s.repo.DeleteChannel(ctx, login, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %d", models.ErrChannelNotFound, id)
+	}
+	return nil
+}
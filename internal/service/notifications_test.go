@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+	"github.com/atinyakov/GophKeeper/internal/notify"
+)
+
+// memNotificationRepo is an in-memory NotificationRepository.
+type memNotificationRepo struct {
+	channels map[string][]models.NotificationChannel
+	nextID   int64
+}
+
+func (m *memNotificationRepo) GetChannels(_ context.Context, login string) ([]models.NotificationChannel, error) {
+	return m.channels[login], nil
+}
+
+func (m *memNotificationRepo) AddChannel(_ context.Context, login string, c models.NotificationChannel) (int64, error) {
+	m.nextID++
+	c.ID = m.nextID
+	m.channels[login] = append(m.channels[login], c)
+	return c.ID, nil
+}
+
+func (m *memNotificationRepo) DeleteChannel(_ context.Context, login string, id int64) (bool, error) {
+	n := len(m.channels[login])
+	m.channels[login] = slices.DeleteFunc(m.channels[login], func(c models.NotificationChannel) bool { return c.ID == id })
+	return len(m.channels[login]) < n, nil
+}
+
+func TestNotificationService_Channels(t *testing.T) {
+	repo := &memNotificationRepo{channels: make(map[string][]models.NotificationChannel)}
+	s := NewNotificationService(repo, []string{notify.KindNtfy, notify.KindWebhook})
+	ctx := context.Background()
+
+	c, err := s.AddChannel(ctx, "alice", models.NotificationChannel{
+		Kind:   notify.KindNtfy,
+		Target: "https://ntfy.sh/alice",
+		Events: []string{notify.EventNewDevice, notify.EventSecretExpiry, notify.EventNewDevice},
+	})
+	if err != nil {
+		t.Fatalf("AddChannel returned error: %v", err)
+	}
+	if c.ID != 1 || !slices.Equal(c.Events, []string{notify.EventNewDevice, notify.EventSecretExpiry}) {
+		t.Errorf("channel = %+v; want ID 1 with deduplicated events", c)
+	}
+
+	// Email is not configured
+	_, err = s.AddChannel(ctx, "alice", models.NotificationChannel{Kind: notify.KindEmail, Target: "alice@example.com"})
+	if !errors.Is(err, models.ErrInvalidChannel) {
+		t.Errorf("AddChannel(email) = %v; want ErrInvalidChannel", err)
+	}
+
+	for range MaxNotificationChannels - 1 {
+		if _, err := s.AddChannel(ctx, "alice", models.NotificationChannel{Kind: notify.KindWebhook, Target: "https://example.com/hook"}); err != nil {
+			t.Fatalf("AddChannel returned error: %v", err)
+		}
+	}
+	_, err = s.AddChannel(ctx, "alice", models.NotificationChannel{Kind: notify.KindWebhook, Target: "https://example.com/hook"})
+	if !errors.Is(err, models.ErrInvalidChannel) {
+		t.Errorf("AddChannel beyond the limit = %v; want ErrInvalidChannel", err)
+	}
+
+	if err := s.DeleteChannel(ctx, "bob", 1); !errors.Is(err, models.ErrChannelNotFound) {
+		t.Errorf("DeleteChannel of another user = %v; want ErrChannelNotFound", err)
+	}
+	if err := s.DeleteChannel(ctx, "alice", 1); err != nil {
+		t.Errorf("DeleteChannel returned error: %v", err)
+	}
+	if channels, _ := s.Channels(ctx, "alice"); len(channels) != MaxNotificationChannels-1 {
+		t.Errorf("%d channels left; want %d", len(channels), MaxNotificationChannels-1)
+	}
+}
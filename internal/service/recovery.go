@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"strings"
+)
+
+// RecoveryCodeCount is the number of recovery codes issued at registration.
+const RecoveryCodeCount = 10
+
+// recoveryCodeBytes is the entropy of a recovery code: 80 bits, encoded
+// as 16 base32 characters.
+const recoveryCodeBytes = 10
+
+// IssueRecoveryCodes generates a new set of one-time recovery codes for the
+// user, replacing any previous set, and returns them. Only their hashes
+// are stored, like API tokens.
+func (s *Service) IssueRecoveryCodes(ctx context.Context, login string) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hashToken(normalizeRecoveryCode(code))
+	}
+	if err := s.repo.SaveRecoveryCodes(ctx, login, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RedeemRecoveryCode checks a recovery code of the user and invalidates
+// it. It reports false if the code is unknown or was already used. Codes
+// are compared ignoring case, dashes and spaces.
+func (s *Service) RedeemRecoveryCode(ctx context.Context, login, code string) (bool, error) {
+	login, err := NormalizeLogin(login)
+	if err != nil {
+		return false, nil
+	}
+	return s.repo.UseRecoveryCode(ctx, login, hashToken(normalizeRecoveryCode(code)))
+}
+
+// randomRecoveryCode returns a random code formatted as XXXX-XXXX-XXXX-XXXX.
+func randomRecoveryCode() (string, error) {
+	raw := make([]byte, recoveryCodeBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("generate recovery code: %w", err)
+	}
+	s := base32.StdEncoding.EncodeToString(raw)
+	return s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16], nil
+}
+
+// normalizeRecoveryCode brings a code typed by a user to canonical form.
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	stored := map[string]bool{}
+	repo := &mockAuthRepo{
+		SaveRecoveryFunc: func(ctx context.Context, login string, codeHashes []string) error {
+			if login != "alice" {
+				t.Errorf("SaveRecoveryCodes received login = %q; want %q", login, "alice")
+			}
+			clear(stored)
+			for _, h := range codeHashes {
+				stored[h] = true
+			}
+			return nil
+		},
+		UseRecoveryFunc: func(ctx context.Context, login, codeHash string) (bool, error) {
+			ok := login == "alice" && stored[codeHash]
+			delete(stored, codeHash)
+			return ok, nil
+		},
+	}
+	svc := NewAuthService(repo)
+
+	codes, err := svc.IssueRecoveryCodes(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("IssueRecoveryCodes returned error: %v", err)
+	}
+	if len(codes) != RecoveryCodeCount || len(stored) != RecoveryCodeCount {
+		t.Fatalf("issued %d codes, stored %d; want %d", len(codes), len(stored), RecoveryCodeCount)
+	}
+	format := regexp.MustCompile(`^[A-Z2-7]{4}(-[A-Z2-7]{4}){3}$`)
+	for _, c := range codes {
+		if !format.MatchString(c) {
+			t.Errorf("code %q does not match %v", c, format)
+		}
+		if stored[c] {
+			t.Errorf("code %q stored in plaintext", c)
+		}
+	}
+
+	// Codes are accepted in any case and without dashes, but only once.
+	typed := strings.ToLower(strings.ReplaceAll(codes[0], "-", " "))
+	if ok, err := svc.RedeemRecoveryCode(context.Background(), "Alice", typed); err != nil || !ok {
+		t.Errorf("RedeemRecoveryCode = %v, %v; want true, nil", ok, err)
+	}
+	if ok, _ := svc.RedeemRecoveryCode(context.Background(), "alice", codes[0]); ok {
+		t.Error("RedeemRecoveryCode accepted a used code")
+	}
+	if ok, _ := svc.RedeemRecoveryCode(context.Background(), "bob", codes[1]); ok {
+		t.Error("RedeemRecoveryCode accepted another user's code")
+	}
+}
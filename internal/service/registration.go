@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// Audit trail actions recorded by the RegistrationGuard.
+const (
+	AuditRegister       = "register"
+	AuditRegisterFailed = "register_failed"
+	AuditRegisterBanned = "register_banned"
+	AuditReenroll       = "reenroll"
+)
+
+// AbuseRepository defines the persistence operations needed by the RegistrationGuard.
+type AbuseRepository interface {
+	// GetAttempts returns the registration attempts recorded for ip, or nil if there are none.
+	GetAttempts(ctx context.Context, ip string) (*models.RegistrationAttempts, error)
+	// SaveAttempts inserts or replaces the registration attempts of an IP address.
+	SaveAttempts(ctx context.Context, a models.RegistrationAttempts) error
+	// RecordEvent appends an event to the audit trail.
+	RecordEvent(ctx context.Context, e models.AuditEvent) error
+}
+
+// RegistrationGuard tracks failed registration attempts per IP address and
+// temporarily bans addresses that keep failing. Once an address reaches the
+// failure threshold, every further failure doubles the ban, starting from
+// baseBan and capped at maxBan. Counters are forgotten after maxBan without
+// failures.
+type RegistrationGuard struct {
+	// repo is the underlying persistence repository.
+	repo AbuseRepository
+	// threshold is the number of failures that triggers the first ban.
+	threshold int
+	// baseBan is the duration of the first ban.
+	baseBan time.Duration
+	// maxBan caps the ban duration.
+	maxBan time.Duration
+	// now returns the current time; replaced in tests.
+	now func() time.Time
+}
+
+// NewRegistrationGuard constructs a RegistrationGuard with the provided
+// repository, failure threshold and ban durations.
+func NewRegistrationGuard(repo AbuseRepository, threshold int, baseBan, maxBan time.Duration) *RegistrationGuard {
+	return &RegistrationGuard{
+		repo:      repo,
+		threshold: threshold,
+		baseBan:   baseBan,
+		maxBan:    maxBan,
+		now:       time.Now,
+	}
+}
+
+// Check returns the remaining ban time of ip, or 0 if the address may
+// register. Refused attempts are recorded in the audit trail.
+func (g *RegistrationGuard) Check(ctx context.Context, ip string) (time.Duration, error) {
+	a, err := g.repo.GetAttempts(ctx, ip)
+	if err != nil {
+		return 0, err
+	}
+	now := g.now()
+	if a == nil || a.BannedUntil <= now.Unix() {
+		return 0, nil
+	}
+
+	g.audit(ctx, models.AuditEvent{Time: now.Unix(), IP: ip, Action: AuditRegisterBanned})
+	return time.Unix(a.BannedUntil, 0).Sub(now), nil
+}
+
+// Failure records a failed registration attempt from ip and bans the address
+// once the failure threshold is reached.
+func (g *RegistrationGuard) Failure(ctx context.Context, ip, login, reason string) error {
+	a, err := g.repo.GetAttempts(ctx, ip)
+	if err != nil {
+		return err
+	}
+	now := g.now()
+	if a == nil || now.Sub(time.Unix(a.LastAttempt, 0)) > g.maxBan {
+		a = &models.RegistrationAttempts{IP: ip}
+	}
+
+	a.Failures++
+	a.LastAttempt = now.Unix()
+	detail := reason
+	if ban := g.banDuration(a.Failures); ban > 0 {
+		a.BannedUntil = now.Add(ban).Unix()
+		detail = fmt.Sprintf("%s; banned for %s", reason, ban)
+	}
+	if err := g.repo.SaveAttempts(ctx, *a); err != nil {
+		return err
+	}
+
+	g.audit(ctx, models.AuditEvent{Time: now.Unix(), Login: login, IP: ip, Action: AuditRegisterFailed, Detail: detail})
+	return nil
+}
+
+// Success records a successful registration from ip in the audit trail.
+func (g *RegistrationGuard) Success(ctx context.Context, ip, login string) error {
+	return g.repo.RecordEvent(ctx, models.AuditEvent{Time: g.now().Unix(), Login: login, IP: ip, Action: AuditRegister})
+}
+
+// Reenrolled records in the audit trail that a certificate for a further
+// device was issued to login, which registered again from ip presenting an
+// existing certificate.
+func (g *RegistrationGuard) Reenrolled(ctx context.Context, ip, login string) error {
+	return g.repo.RecordEvent(ctx, models.AuditEvent{Time: g.now().Unix(), Login: login, IP: ip, Action: AuditReenroll})
+}
+
+// banDuration returns the ban for the given number of failures, or 0 if the
+// threshold has not been reached.
+func (g *RegistrationGuard) banDuration(failures int) time.Duration {
+	if failures < g.threshold {
+		return 0
+	}
+	ban := g.baseBan
+	for i := g.threshold; i < failures && ban < g.maxBan; i++ {
+		ban *= 2
+	}
+	return min(ban, g.maxBan)
+}
+
+// audit records an event, ignoring errors: the audit trail must not turn a
+// rejected request into an internal error.
+func (g *RegistrationGuard) audit(ctx context.Context, e models.AuditEvent) {
+	_ = g.repo.RecordEvent(ctx, e)
+}
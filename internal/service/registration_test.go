@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// memAbuseRepo is an in-memory AbuseRepository.
+type memAbuseRepo struct {
+	attempts map[string]models.RegistrationAttempts
+	events   []models.AuditEvent
+}
+
+func newMemAbuseRepo() *memAbuseRepo {
+	return &memAbuseRepo{attempts: map[string]models.RegistrationAttempts{}}
+}
+
+func (m *memAbuseRepo) GetAttempts(ctx context.Context, ip string) (*models.RegistrationAttempts, error) {
+	a, ok := m.attempts[ip]
+	if !ok {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+func (m *memAbuseRepo) SaveAttempts(ctx context.Context, a models.RegistrationAttempts) error {
+	m.attempts[a.IP] = a
+	return nil
+}
+
+func (m *memAbuseRepo) RecordEvent(ctx context.Context, e models.AuditEvent) error {
+	m.events = append(m.events, e)
+	return nil
+}
+
+func TestRegistrationGuard_BanAfterThreshold(t *testing.T) {
+	repo := newMemAbuseRepo()
+	g := NewRegistrationGuard(repo, 3, time.Minute, time.Hour)
+	now := time.Unix(1000, 0)
+	g.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := g.Failure(ctx, "10.0.0.1", "alice", "user already exists"); err != nil {
+			t.Fatalf("Failure returned error: %v", err)
+		}
+	}
+	if wait, err := g.Check(ctx, "10.0.0.1"); err != nil || wait != 0 {
+		t.Fatalf("Check before threshold = %s, %v; want 0, nil", wait, err)
+	}
+
+	if err := g.Failure(ctx, "10.0.0.1", "alice", "user already exists"); err != nil {
+		t.Fatalf("Failure returned error: %v", err)
+	}
+	wait, err := g.Check(ctx, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Check returned error: %v", err)
+	}
+	if wait != time.Minute {
+		t.Errorf("wait = %s; want %s", wait, time.Minute)
+	}
+
+	// Other addresses are unaffected.
+	if wait, _ := g.Check(ctx, "10.0.0.2"); wait != 0 {
+		t.Errorf("Check other IP = %s; want 0", wait)
+	}
+
+	// The ban expires.
+	now = now.Add(2 * time.Minute)
+	if wait, _ := g.Check(ctx, "10.0.0.1"); wait != 0 {
+		t.Errorf("Check after ban = %s; want 0", wait)
+	}
+
+	actions := map[string]int{}
+	for _, e := range repo.events {
+		actions[e.Action]++
+	}
+	if actions[AuditRegisterFailed] != 3 || actions[AuditRegisterBanned] != 1 {
+		t.Errorf("audit actions = %v", actions)
+	}
+}
+
+func TestRegistrationGuard_BanDuration(t *testing.T) {
+	g := NewRegistrationGuard(newMemAbuseRepo(), 3, time.Minute, 10*time.Minute)
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{6, 8 * time.Minute},
+		{7, 10 * time.Minute},
+		{100, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := g.banDuration(tt.failures); got != tt.want {
+			t.Errorf("banDuration(%d) = %s; want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestRegistrationGuard_ForgetsOldFailures(t *testing.T) {
+	repo := newMemAbuseRepo()
+	g := NewRegistrationGuard(repo, 2, time.Minute, time.Hour)
+	now := time.Unix(1000, 0)
+	g.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_ = g.Failure(ctx, "10.0.0.1", "", "invalid request")
+	now = now.Add(2 * time.Hour)
+	_ = g.Failure(ctx, "10.0.0.1", "", "invalid request")
+
+	if got := repo.attempts["10.0.0.1"].Failures; got != 1 {
+		t.Errorf("Failures = %d; want 1", got)
+	}
+	if wait, _ := g.Check(ctx, "10.0.0.1"); wait != 0 {
+		t.Errorf("Check = %s; want 0", wait)
+	}
+}
+
+func TestRegistrationGuard_Success(t *testing.T) {
+	repo := newMemAbuseRepo()
+	g := NewRegistrationGuard(repo, 3, time.Minute, time.Hour)
+
+	if err := g.Success(context.Background(), "10.0.0.1", "alice"); err != nil {
+		t.Fatalf("Success returned error: %v", err)
+	}
+	if len(repo.events) != 1 || repo.events[0].Action != AuditRegister || repo.events[0].Login != "alice" {
+		t.Errorf("events = %+v", repo.events)
+	}
+
+	if err := g.Reenrolled(context.Background(), "10.0.0.2", "alice"); err != nil {
+		t.Fatalf("Reenrolled returned error: %v", err)
+	}
+	if len(repo.events) != 2 || repo.events[1].Action != AuditReenroll || repo.events[1].IP != "10.0.0.2" {
+		t.Errorf("events = %+v", repo.events)
+	}
+}
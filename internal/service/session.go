@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/clock"
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// ErrInvalidSession is returned when a session is unknown or expired.
+var ErrInvalidSession = errors.New("invalid session")
+
+// SessionRepository defines the persistence operations needed by the SessionService.
+type SessionRepository interface {
+	// CreateSession stores a new session.
+	CreateSession(ctx context.Context, session models.Session) error
+	// GetSession returns the session with the given ID hash, or nil if it does not exist.
+	GetSession(ctx context.Context, idHash string) (*models.Session, error)
+	// DeleteSession removes the session with the given ID hash.
+	DeleteSession(ctx context.Context, idHash string) error
+}
+
+// SessionService manages server-side browser sessions. Only hashes of
+// session IDs are stored, and each session carries its own CSRF token.
+type SessionService struct {
+	// repo is the underlying persistence repository.
+	repo SessionRepository
+	// ttl is the lifetime of a session from creation or refresh.
+	ttl time.Duration
+	// clock tells the time sessions expire by, see SetClock.
+	clock clock.Clock
+}
+
+// NewSessionService constructs a SessionService with the provided repository
+// and session lifetime.
+func NewSessionService(repo SessionRepository, ttl time.Duration) *SessionService {
+	return &SessionService{repo: repo, ttl: ttl, clock: clock.Real}
+}
+
+// SetClock replaces the system clock the service tells the time by, e.g.
+// with a clock.Fake in tests.
+func (s *SessionService) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// Create starts a new session for the user and returns the session ID to be
+// stored in a cookie, together with the stored session record.
+func (s *SessionService) Create(ctx context.Context, login string) (string, *models.Session, error) {
+	id, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	session := models.Session{
+		IDHash:    hashToken(id),
+		UserLogin: login,
+		CSRFToken: csrf,
+		ExpiresAt: s.clock.Now().Add(s.ttl).Unix(),
+	}
+	if err := s.repo.CreateSession(ctx, session); err != nil {
+		return "", nil, err
+	}
+	return id, &session, nil
+}
+
+// Authenticate returns the session for the given session ID.
+// It returns ErrInvalidSession if the session is unknown or expired.
+func (s *SessionService) Authenticate(ctx context.Context, id string) (*models.Session, error) {
+	session, err := s.repo.GetSession(ctx, hashToken(id))
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.ExpiresAt < s.clock.Now().Unix() {
+		return nil, ErrInvalidSession
+	}
+	return session, nil
+}
+
+// Refresh replaces a valid session with a new one for the same user,
+// rotating both the session ID and the CSRF token.
+func (s *SessionService) Refresh(ctx context.Context, id string) (string, *models.Session, error) {
+	session, err := s.Authenticate(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.repo.DeleteSession(ctx, session.IDHash); err != nil {
+		return "", nil, err
+	}
+	return s.Create(ctx, session.UserLogin)
+}
+
+// Logout ends the session with the given ID.
+func (s *SessionService) Logout(ctx context.Context, id string) error {
+	return s.repo.DeleteSession(ctx, hashToken(id))
+}
+
+// randomToken returns 32 random bytes encoded as unpadded base64url.
+func randomToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/atinyakov/GophKeeper/internal/clock"
+	"github.com/atinyakov/GophKeeper/internal/models"
+)
+
+// memSessionRepo is an in-memory SessionRepository.
+type memSessionRepo struct {
+	sessions map[string]models.Session
+}
+
+func newMemSessionRepo() *memSessionRepo {
+	return &memSessionRepo{sessions: map[string]models.Session{}}
+}
+
+func (m *memSessionRepo) CreateSession(ctx context.Context, session models.Session) error {
+	m.sessions[session.IDHash] = session
+	return nil
+}
+
+func (m *memSessionRepo) GetSession(ctx context.Context, idHash string) (*models.Session, error) {
+	s, ok := m.sessions[idHash]
+	if !ok {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+func (m *memSessionRepo) DeleteSession(ctx context.Context, idHash string) error {
+	delete(m.sessions, idHash)
+	return nil
+}
+
+func TestSessionService_Lifecycle(t *testing.T) {
+	repo := newMemSessionRepo()
+	svc := NewSessionService(repo, time.Hour)
+	ctx := context.Background()
+
+	id, created, err := svc.Create(ctx, "alice")
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if id == "" || created.CSRFToken == "" {
+		t.Fatalf("Create returned empty id or CSRF token")
+	}
+	if _, ok := repo.sessions[id]; ok {
+		t.Error("plaintext session ID must not be stored")
+	}
+
+	got, err := svc.Authenticate(ctx, id)
+	if err != nil {
+		t.Fatalf("Authenticate returned error: %v", err)
+	}
+	if got.UserLogin != "alice" {
+		t.Errorf("UserLogin = %q; want %q", got.UserLogin, "alice")
+	}
+
+	newID, refreshed, err := svc.Refresh(ctx, id)
+	if err != nil {
+		t.Fatalf("Refresh returned error: %v", err)
+	}
+	if newID == id || refreshed.CSRFToken == created.CSRFToken {
+		t.Error("Refresh must rotate session ID and CSRF token")
+	}
+	if _, err := svc.Authenticate(ctx, id); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("old session error = %v; want %v", err, ErrInvalidSession)
+	}
+
+	if err := svc.Logout(ctx, newID); err != nil {
+		t.Fatalf("Logout returned error: %v", err)
+	}
+	if _, err := svc.Authenticate(ctx, newID); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("logged out session error = %v; want %v", err, ErrInvalidSession)
+	}
+}
+
+func TestSessionService_Expired(t *testing.T) {
+	repo := newMemSessionRepo()
+	svc := NewSessionService(repo, time.Minute)
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	svc.SetClock(clk)
+
+	id, _, err := svc.Create(context.Background(), "bob")
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if _, err := svc.Authenticate(context.Background(), id); err != nil {
+		t.Fatalf("Authenticate returned error: %v", err)
+	}
+	clk.Advance(time.Minute + time.Second)
+	if _, err := svc.Authenticate(context.Background(), id); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("expired session error = %v; want %v", err, ErrInvalidSession)
+	}
+}
@@ -4,7 +4,16 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
 
+	"github.com/atinyakov/GophKeeper/internal/fingerprint"
 	"github.com/atinyakov/GophKeeper/internal/models"
 )
 
@@ -17,20 +26,79 @@ type SyncRepository interface {
 	GetSecretsByUser(ctx context.Context, userID string) ([]models.Secret, error)
 	// UpsertSecrets inserts new secrets or updates existing ones for the given user.
 	// UpsertSecrets(ctx context.Context, userID string, secrets []models.Secret) error
+	// GetDeletedSecretsByUser returns the tombstones of the user's deleted
+	// secrets with their ID and version.
+	GetDeletedSecretsByUser(ctx context.Context, userID string) ([]models.Secret, error)
 	// DeleteSecrets removes the secrets with the given IDs for the specified user.
 	DeleteSecrets(ctx context.Context, userID string, ids []string) error
+	// PurgeSecrets permanently removes the tombstones with the given IDs
+	// for the specified user and returns the IDs removed.
+	PurgeSecrets(ctx context.Context, userID string, ids []string) ([]string, error)
 	// GetSecretByID fetches a single secret by ID for the specified user.
 	GetSecretByID(ctx context.Context, userID string, id string) (*models.Secret, error)
-	// UpsertIfNewer
-	UpsertIfNewer(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, error)
-	// GetNewerSecrets
-	GetNewerSecrets(ctx context.Context, userID string, versions map[string]int64) ([]models.Secret, error)
+	// UpsertIfNewer stores the secrets newer than the stored versions and
+	// returns the IDs stored and skipped, and the conflicts of the secrets
+	// skipped because the stored versions are newer.
+	UpsertIfNewer(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, []models.Conflict, error)
+	// BulkUpsert stores a batch of secrets newer than the stored versions
+	// in few statements and returns the IDs stored and skipped.
+	BulkUpsert(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, error)
+	// EachNewerSecret calls fn with each secret matching filter newer than
+	// the client's versions, stopping at the first error of fn.
+	EachNewerSecret(ctx context.Context, userID string, versions map[string]int64, filter models.SyncFilter, fn func(models.Secret) error) error
+	// GetSecretHeaders returns the version of every live secret of the
+	// user by ID.
+	GetSecretHeaders(ctx context.Context, userID string) (map[string]int64, error)
+	// GetTypeStats returns live secret counts and payload sizes grouped by type.
+	GetTypeStats(ctx context.Context, userID string) (map[string]int64, map[string]int64, error)
+	// GetVaultSummary returns live secret counts per type, folder and tag
+	// and the total payload size.
+	GetVaultSummary(ctx context.Context, userID string) (models.VaultSummary, error)
+	// TouchDevice records a successful sync of the device at the given Unix time.
+	TouchDevice(ctx context.Context, userID, deviceID string, at int64) error
+	// GetDevices returns the devices of the user, most recently synced first.
+	GetDevices(ctx context.Context, userID string) ([]models.Device, error)
+	// RecordAccess records that the device fetched the secrets with the
+	// given IDs at the given Unix time.
+	RecordAccess(ctx context.Context, userID, deviceID string, ids []string, at int64) error
+	// GetAccessLog returns up to limit accesses of the secret, newest first.
+	GetAccessLog(ctx context.Context, userID, secretID string, limit int) ([]models.SecretAccess, error)
+	// GetRollback returns the times of the backup the user's vault was
+	// last rolled back to and of the restore; both 0 if it never was.
+	GetRollback(ctx context.Context, userID string) (from, at int64, err error)
+	// GetKDF returns the key derivation parameters of the user's vault, ""
+	// if none are stored.
+	GetKDF(ctx context.Context, userID string) (string, error)
+	// SetKDF stores the key derivation parameters of the user's vault
+	// unless some are stored already and returns the parameters stored.
+	SetKDF(ctx context.Context, userID, kdf string) (string, error)
+}
+
+// AccessLogLimit is the most accesses of a secret AccessLog returns.
+const AccessLogLimit = 1000
+
+// ImportBatchSize is the number of secrets Import stores at a time.
+const ImportBatchSize = 500
+
+// SyncCache caches the secret headers, i.e. the version of every live
+// secret by ID, of users, so that syncs that change nothing are answered
+// without querying the repository.
+type SyncCache interface {
+	// Headers returns the cached headers of the user; ok is false if none
+	// are cached.
+	Headers(ctx context.Context, userID string) (headers map[string]int64, ok bool, err error)
+	// SetHeaders caches the headers of the user.
+	SetHeaders(ctx context.Context, userID string, headers map[string]int64) error
+	// Invalidate drops the cached headers of the user.
+	Invalidate(ctx context.Context, userID string) error
 }
 
 // SyncService implements synchronization business logic for user secrets.
 type SyncService struct {
 	// repo is the underlying persistence repository.
 	repo SyncRepository
+	// cache caches secret headers when non-nil, see SetCache.
+	cache SyncCache
 }
 
 // NewSyncService constructs a SyncService with the provided SyncRepository.
@@ -39,10 +107,67 @@ func NewSyncService(repo SyncRepository) *SyncService {
 	return &SyncService{repo: repo}
 }
 
+// SetCache makes the service answer syncs that upload nothing and find the
+// client up to date from cache, e.g. the periodic polls of idle clients.
+func (s *SyncService) SetCache(cache SyncCache) {
+	s.cache = cache
+}
+
 // Sync synchronizes client-provided secrets with the data store.
 // For each secret, the server compares versions and updates only if the incoming version is newer.
-// Deleted secrets are removed; version conflicts are resolved by keeping the higher version.
-func (s *SyncService) Sync(ctx context.Context, userID string, secrets []models.Secret, clientVersions map[string]int64) (map[string]any, error) {
+// Deleted secrets are removed; version conflicts are resolved by keeping the higher version
+// and reported in "conflicts". Only the secrets matching filter are
+// returned; uploads are stored whether they match or not. The result's
+// "summary" describes the whole vault after the sync, see
+// models.VaultSummary, whatever the filter.
+//
+// lastKnown is the version of the client's last sync. Uploads of secrets
+// that the server changed since too, to a different version, are not
+// stored but reported as concurrent conflicts with both versions, so that
+// neither edit is lost; see models.Conflict. With lastKnown 0, e.g. from
+// clients that never synced or do not send it, the higher version wins.
+//
+// Unchanged copies the client holds from before the vault was rolled back
+// to a backup are not stored either but listed in "restored", so that the
+// client takes the server's versions returned instead.
+func (s *SyncService) Sync(ctx context.Context, userID string, secrets []models.Secret, clientVersions map[string]int64, lastKnown int64, filter models.SyncFilter) (map[string]any, error) {
+	var newer []models.Secret
+	result, err := s.SyncStream(ctx, userID, secrets, clientVersions, lastKnown, filter, func(sec models.Secret) error {
+		newer = append(newer, sec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result["secrets"] = newer
+	return result, nil
+}
+
+// SyncStream is Sync passing the secrets newer than clientVersions to emit
+// one at a time instead of collecting them, so that memory does not grow
+// with the vault. The result lacks "secrets". An error of emit aborts the
+// sync after the uploaded secrets have been applied. Syncs answered from
+// the cache lack "summary" too, as nothing changed since the client's
+// last sync.
+func (s *SyncService) SyncStream(ctx context.Context, userID string, secrets []models.Secret, clientVersions map[string]int64, lastKnown int64, filter models.SyncFilter, emit func(models.Secret) error) (map[string]any, error) {
+	var uploaded models.UploadResult
+	if err := s.Upload(ctx, userID, secrets, lastKnown, &uploaded); err != nil {
+		return nil, err
+	}
+	return s.Respond(ctx, userID, uploaded, clientVersions, filter, emit)
+}
+
+// Upload applies secrets uploaded by a sync as SyncStream does and adds
+// the outcome to res. Syncs too large to hold in memory call it with one
+// batch of the secrets at a time as they are read, followed by Respond;
+// the batches stored stay stored if a later one fails.
+func (s *SyncService) Upload(ctx context.Context, userID string, secrets []models.Secret, lastKnown int64, res *models.UploadResult) error {
+	secrets, restored, err := s.holdRolledBack(ctx, userID, secrets)
+	if err != nil {
+		return err
+	}
+	res.Restored = append(res.Restored, restored...)
+
 	var toUpsert []models.Secret
 	var toDelete []string
 	for _, s := range secrets {
@@ -55,21 +180,60 @@ func (s *SyncService) Sync(ctx context.Context, userID string, secrets []models.
 
 	if len(toDelete) > 0 {
 		if err := s.repo.DeleteSecrets(ctx, userID, toDelete); err != nil {
-			return nil, err
+			return err
 		}
+		res.Deleted = append(res.Deleted, toDelete...)
 	}
 
-	var updated, skipped []string
+	var (
+		updated, skipped []string
+		conflicts        []models.Conflict
+	)
+	if len(toUpsert) > 0 && lastKnown > 0 {
+		var (
+			held []models.Conflict
+			err  error
+		)
+		toUpsert, held, err = s.holdConcurrent(ctx, userID, toUpsert, lastKnown)
+		if err != nil {
+			return err
+		}
+		for _, c := range held {
+			skipped = append(skipped, c.ID)
+		}
+		conflicts = append(conflicts, held...)
+	}
 	if len(toUpsert) > 0 {
-		var err error
-		updated, skipped, err = s.repo.UpsertIfNewer(ctx, userID, toUpsert)
+		stored, notStored, found, err := s.repo.UpsertIfNewer(ctx, userID, toUpsert)
 		if err != nil {
-			return nil, err
+			return err
 		}
+		updated, skipped = stored, append(notStored, skipped...)
+		conflicts = append(conflicts, found...)
 	}
+	res.Updated = append(res.Updated, updated...)
+	res.Skipped = append(res.Skipped, skipped...)
+	res.Conflicts = append(res.Conflicts, conflicts...)
 
-	newerSecrets, err := s.repo.GetNewerSecrets(ctx, userID, clientVersions)
-	if err != nil {
+	if s.cache != nil && (len(toDelete) > 0 || len(updated) > 0) {
+		// A failed invalidation leaves the entry to expire
+		_ = s.cache.Invalidate(ctx, userID)
+	}
+	return nil
+}
+
+// Respond completes a sync whose uploaded secrets Upload applied with the
+// outcome uploaded, passing the secrets newer than clientVersions to emit
+// and returning the result as SyncStream does.
+func (s *SyncService) Respond(ctx context.Context, userID string, uploaded models.UploadResult, clientVersions map[string]int64, filter models.SyncFilter, emit func(models.Secret) error) (map[string]any, error) {
+	// The cached headers cover the whole vault, so filtered syncs skip them
+	if uploaded.Empty() && s.cache != nil && filter.Empty() {
+		if result, ok := s.upToDate(ctx, userID, clientVersions); ok {
+			return result, nil
+		}
+	}
+
+	if err := s.repo.EachNewerSecret(ctx, userID, clientVersions, filter, emit); err != nil {
 		return nil, err
 	}
 
@@ -77,21 +241,381 @@ func (s *SyncService) Sync(ctx context.Context, userID string, secrets []models.
 	if err != nil {
 		return nil, err
 	}
+	summary, err := s.repo.GetVaultSummary(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
 
+	// Conflicts are always reported, so that clients can tell no conflicts
+	// from a server that does not report them
 	return map[string]any{
-		"version": version,
-		"updated": updated,
-		"skipped": skipped,
-		"secrets": newerSecrets,
+		"version":   version,
+		"updated":   uploaded.Updated,
+		"skipped":   uploaded.Skipped,
+		"conflicts": append([]models.Conflict{}, uploaded.Conflicts...),
+		"restored":  uploaded.Restored,
+		"summary":   summary,
 	}, nil
 }
 
+// holdRolledBack holds back the uploaded copies the client received from
+// the server and did not change, see models.Secret.Unchanged, that are
+// newer than the server's, or that the server no longer holds, because the
+// vault was rolled back to a backup since: their versions were given out
+// between the backup and the restore, see db.Restore. Storing them would
+// undo the restore, so the server's versions stay and the IDs are returned
+// for the client to take them.
+func (s *SyncService) holdRolledBack(ctx context.Context, userID string, secrets []models.Secret) ([]models.Secret, []string, error) {
+	from, at, err := s.repo.GetRollback(ctx, userID)
+	if err != nil || at == 0 {
+		return secrets, nil, err
+	}
+	rolledBack := func(sec models.Secret) bool {
+		return sec.Unchanged() && from < sec.Version && sec.Version <= at
+	}
+	if !slices.ContainsFunc(secrets, rolledBack) {
+		return secrets, nil, nil
+	}
+	// The cached headers may predate the restore
+	headers, err := s.repo.GetSecretHeaders(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		store    []models.Secret
+		restored []string
+	)
+	for _, sec := range secrets {
+		if version, ok := headers[sec.ID]; rolledBack(sec) && (!ok || version < sec.Version) {
+			restored = append(restored, sec.ID)
+			continue
+		}
+		store = append(store, sec)
+	}
+	return store, restored, nil
+}
+
+// holdConcurrent splits the uploaded secrets into those to store and the
+// conflicts of those changed concurrently on the server: both versions are
+// newer than lastKnown and differ, and the client changed a copy other than
+// the server's current version, see models.Secret.BaseVersion. Their
+// uploads are held back, so that the server's versions are not
+// overwritten, and the conflicts carry both versions for the client to
+// resolve.
+func (s *SyncService) holdConcurrent(ctx context.Context, userID string, secrets []models.Secret, lastKnown int64) ([]models.Secret, []models.Conflict, error) {
+	headers, err := s.headers(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		store []models.Secret
+		held  []models.Conflict
+	)
+	for _, sec := range secrets {
+		version, ok := headers[sec.ID]
+		if !ok || version == sec.Version || version <= lastKnown || sec.Version <= lastKnown || sec.Unchanged() || sec.BaseVersion == version {
+			store = append(store, sec)
+			continue
+		}
+		server, err := s.repo.GetSecretByID(ctx, userID, sec.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Deleted since the headers were read
+			store = append(store, sec)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		client := sec
+		held = append(held, models.Conflict{
+			ID:            sec.ID,
+			Version:       sec.Version,
+			ServerVersion: server.Version,
+			Concurrent:    true,
+			Client:        &client,
+			Server:        server,
+			Changed:       changedFields(client, *server),
+		})
+	}
+	return store, held, nil
+}
+
+// changedFields names the metadata fields stored in the clear that differ
+// between a and b, by their JSON names.
+func changedFields(a, b models.Secret) []string {
+	var changed []string
+	if a.Type != b.Type {
+		changed = append(changed, "type")
+	}
+	if a.Comment != b.Comment {
+		changed = append(changed, "comment")
+	}
+	if a.Folder != b.Folder {
+		changed = append(changed, "folder")
+	}
+	if !slices.Equal(a.Tags, b.Tags) {
+		changed = append(changed, "tags")
+	}
+	if a.Reprompt != b.Reprompt {
+		changed = append(changed, "reprompt")
+	}
+	if a.ExpiresAt != b.ExpiresAt {
+		changed = append(changed, "expires_at")
+	}
+	return changed
+}
+
+// upToDate returns the result of a sync without uploads if the cached
+// headers show that the client has the latest version of every secret.
+// Headers missing from the cache are loaded from the repository. Cache
+// errors fall back to a full sync.
+func (s *SyncService) upToDate(ctx context.Context, userID string, clientVersions map[string]int64) (map[string]any, bool) {
+	headers, err := s.headers(ctx, userID)
+	if err != nil {
+		return nil, false
+	}
+
+	var version int64
+	for id, v := range headers {
+		if cv, known := clientVersions[id]; !known || v > cv {
+			return nil, false
+		}
+		version = max(version, v)
+	}
+	return map[string]any{
+		"version":   version,
+		"updated":   []string(nil),
+		"skipped":   []string(nil),
+		"conflicts": []models.Conflict{},
+	}, true
+}
+
+// headers returns the version of every live secret of the user by ID,
+// from the cache if one is set and holds them.
+func (s *SyncService) headers(ctx context.Context, userID string) (map[string]int64, error) {
+	if s.cache == nil {
+		return s.repo.GetSecretHeaders(ctx, userID)
+	}
+	headers, ok, err := s.cache.Headers(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if headers, err = s.repo.GetSecretHeaders(ctx, userID); err != nil {
+			return nil, err
+		}
+		_ = s.cache.SetHeaders(ctx, userID, headers)
+	}
+	return headers, nil
+}
+
+// ETag returns an entity tag of the user's live secrets: the highest
+// version and a hash of the ID and version of every live secret. It
+// changes whenever a secret is stored or deleted, so that clients polling
+// for changes can be answered with 304 Not Modified while it stays the
+// same. A filter is hashed along, so that changing it changes the tag.
+func (s *SyncService) ETag(ctx context.Context, userID string, filter models.SyncFilter) (string, error) {
+	headers, err := s.headers(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	var version int64
+	h := sha256.New()
+	for _, id := range slices.Sorted(maps.Keys(headers)) {
+		version = max(version, headers[id])
+		fmt.Fprintf(h, "%s\x00%d\x00", id, headers[id])
+	}
+	if !filter.Empty() {
+		fmt.Fprintf(h, "filter\x00%q\x00%q\x00%q", filter.Folders, filter.Tags, filter.Types)
+	}
+	return fmt.Sprintf(`"%d-%x"`, version, h.Sum(nil)[:8]), nil
+}
+
+// Tombstones returns the tombstones of the user's deleted secrets, with
+// their ID and version only, so that devices that missed deletions can
+// drop their copies. If clientVersions is not nil, only the tombstones of
+// secrets the client holds at the same or an older version are returned;
+// a newer version is an edit made after the deletion.
+func (s *SyncService) Tombstones(ctx context.Context, userID string, clientVersions map[string]int64) ([]models.Secret, error) {
+	tombstones, err := s.repo.GetDeletedSecretsByUser(ctx, userID)
+	if err != nil || clientVersions == nil {
+		return tombstones, err
+	}
+	return slices.DeleteFunc(tombstones, func(sec models.Secret) bool {
+		v, held := clientVersions[sec.ID]
+		return !held || v > sec.Version
+	}), nil
+}
+
+// Changes passes the current state of the user's secrets with the given
+// IDs to emit, so that a change can be pushed to the devices watching the
+// vault: the live secrets matching filter, and the tombstones of the
+// deleted ones with their ID and version only. Secrets purged since are
+// skipped.
+func (s *SyncService) Changes(ctx context.Context, userID string, ids []string, filter models.SyncFilter, emit func(models.Secret) error) error {
+	var gone []string
+	for _, id := range ids {
+		sec, err := s.repo.GetSecretByID(ctx, userID, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			gone = append(gone, id)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !filter.Match(*sec) {
+			continue
+		}
+		if err := emit(*sec); err != nil {
+			return err
+		}
+	}
+	if len(gone) == 0 {
+		return nil
+	}
+	tombstones, err := s.repo.GetDeletedSecretsByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, sec := range tombstones {
+		if !slices.Contains(gone, sec.ID) {
+			continue
+		}
+		if err := emit(sec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import stores the secrets returned by next, e.g. as they are read from a
+// request, until it returns io.EOF. They are stored in batches of
+// ImportBatchSize, each in a transaction of its own, so that the import
+// is never held in memory as a whole; as by Sync, a secret is only stored
+// if it is newer than the stored version. Batches stored before an error
+// stay stored, and are skipped when the import is repeated; the result
+// counts them also when an error is returned.
+func (s *SyncService) Import(ctx context.Context, userID string, next func() (models.Secret, error)) (models.ImportResult, error) {
+	var res models.ImportResult
+	batch := make([]models.Secret, 0, ImportBatchSize)
+	flush := func() error {
+		stored, skipped, err := s.repo.BulkUpsert(ctx, userID, batch)
+		if err != nil {
+			return err
+		}
+		res.Imported += len(stored)
+		res.Skipped += len(skipped)
+		batch = batch[:0]
+		if s.cache != nil && len(stored) > 0 {
+			_ = s.cache.Invalidate(ctx, userID)
+		}
+		return nil
+	}
+
+	for {
+		sec, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, err
+		}
+		if batch = append(batch, sec); len(batch) == ImportBatchSize {
+			if err := flush(); err != nil {
+				return res, err
+			}
+		}
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return res, err
+		}
+	}
+
+	version, err := s.repo.GetMaxVersion(ctx, userID)
+	if err != nil {
+		return res, err
+	}
+	res.Version = version
+	return res, nil
+}
+
 // Delete removes the specified secrets for the user from the data store.
 func (s *SyncService) Delete(ctx context.Context, userID string, ids []string) error {
 	return s.repo.DeleteSecrets(ctx, userID, ids)
 }
 
+// Purge permanently removes the user's deleted secrets with the given IDs
+// instead of keeping their tombstones for the retention period. IDs of
+// live or unknown secrets are ignored. It returns the IDs purged.
+func (s *SyncService) Purge(ctx context.Context, userID string, ids []string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return s.repo.PurgeSecrets(ctx, userID, ids)
+}
+
 // GetByID retrieves a single secret by its ID for the given user.
 func (s *SyncService) GetByID(ctx context.Context, userID string, id string) (*models.Secret, error) {
 	return s.repo.GetSecretByID(ctx, userID, id)
 }
+
+// RecordSync marks a successful sync of the given device of the user.
+func (s *SyncService) RecordSync(ctx context.Context, userID, deviceID string) error {
+	return s.repo.TouchDevice(ctx, userID, deviceID, time.Now().Unix())
+}
+
+// RecordAccess records that the given device of the user fetched the
+// secrets with the given IDs.
+func (s *SyncService) RecordAccess(ctx context.Context, userID, deviceID string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.repo.RecordAccess(ctx, userID, deviceID, ids, time.Now().Unix())
+}
+
+// AccessLog returns the most recent AccessLogLimit accesses of the user's
+// secret with the given ID, newest first.
+func (s *SyncService) AccessLog(ctx context.Context, userID, id string) ([]models.SecretAccess, error) {
+	return s.repo.GetAccessLog(ctx, userID, id, AccessLogLimit)
+}
+
+// VaultKDF returns the parameters the user's clients derive the vault key
+// from the master password with, "" if none are known. A non-empty kdf is
+// stored first unless the server holds parameters already, so that every
+// device derives the same key as the first.
+func (s *SyncService) VaultKDF(ctx context.Context, userID, kdf string) (string, error) {
+	if kdf == "" {
+		return s.repo.GetKDF(ctx, userID)
+	}
+	return s.repo.SetKDF(ctx, userID, kdf)
+}
+
+// Stats summarizes the user's vault: live secret counts per type, the total
+// size of the encrypted payloads, the last sync and request times, the
+// known devices and the fingerprint of the live secrets.
+func (s *SyncService) Stats(ctx context.Context, userID string) (*models.Stats, error) {
+	counts, sizes, err := s.repo.GetTypeStats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.repo.GetDevices(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := s.headers(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &models.Stats{Counts: counts, Devices: devices, Fingerprint: fingerprint.Versions(headers)}
+	for _, size := range sizes {
+		stats.TotalBytes += size
+	}
+	for _, d := range devices {
+		stats.LastSync = max(stats.LastSync, d.LastSync)
+		stats.LastSeen = max(stats.LastSeen, d.LastSeen)
+	}
+	return stats, nil
+}
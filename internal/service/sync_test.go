@@ -2,34 +2,63 @@ package service_test
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"io"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/atinyakov/GophKeeper/internal/fingerprint"
 	"github.com/atinyakov/GophKeeper/internal/models"
 	"github.com/atinyakov/GophKeeper/internal/service"
 )
 
 type mockRepo struct {
 	DeleteSecretsFunc    func(ctx context.Context, userID string, ids []string) error
+	GetDeletedFunc       func(ctx context.Context, userID string) ([]models.Secret, error)
+	PurgeSecretsFunc     func(ctx context.Context, userID string, ids []string) ([]string, error)
 	GetSecretByIDFunc    func(ctx context.Context, userID, id string) (*models.Secret, error)
-	UpsertIfNewerFunc    func(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, error)
-	GetNewerSecretsFunc  func(ctx context.Context, userID string, versions map[string]int64) ([]models.Secret, error)
+	UpsertIfNewerFunc    func(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, []models.Conflict, error)
+	BulkUpsertFunc       func(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, error)
+	EachNewerSecretFunc  func(ctx context.Context, userID string, versions map[string]int64, filter models.SyncFilter, fn func(models.Secret) error) error
 	GetMaxVersionFunc    func(ctx context.Context, userID string) (int64, error)
 	GetSecretsByUserFunc func(ctx context.Context, userID string) ([]models.Secret, error)
 	UpsertSecretsFunc    func(ctx context.Context, userID string, secrets []models.Secret) error
+	GetTypeStatsFunc     func(ctx context.Context, userID string) (map[string]int64, map[string]int64, error)
+	GetVaultSummaryFunc  func(ctx context.Context, userID string) (models.VaultSummary, error)
+	GetSecretHeadersFunc func(ctx context.Context, userID string) (map[string]int64, error)
+	TouchDeviceFunc      func(ctx context.Context, userID, deviceID string, at int64) error
+	GetDevicesFunc       func(ctx context.Context, userID string) ([]models.Device, error)
+	RecordAccessFunc     func(ctx context.Context, userID, deviceID string, ids []string, at int64) error
+	GetAccessLogFunc     func(ctx context.Context, userID, secretID string, limit int) ([]models.SecretAccess, error)
+	GetKDFFunc           func(ctx context.Context, userID string) (string, error)
+	SetKDFFunc           func(ctx context.Context, userID, kdf string) (string, error)
+	GetRollbackFunc      func(ctx context.Context, userID string) (int64, int64, error)
 }
 
 func (m *mockRepo) DeleteSecrets(ctx context.Context, userID string, ids []string) error {
 	return m.DeleteSecretsFunc(ctx, userID, ids)
 }
+func (m *mockRepo) GetDeletedSecretsByUser(ctx context.Context, userID string) ([]models.Secret, error) {
+	return m.GetDeletedFunc(ctx, userID)
+}
+func (m *mockRepo) PurgeSecrets(ctx context.Context, userID string, ids []string) ([]string, error) {
+	return m.PurgeSecretsFunc(ctx, userID, ids)
+}
 func (m *mockRepo) GetSecretByID(ctx context.Context, userID, id string) (*models.Secret, error) {
 	return m.GetSecretByIDFunc(ctx, userID, id)
 }
-func (m *mockRepo) UpsertIfNewer(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, error) {
+func (m *mockRepo) UpsertIfNewer(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, []models.Conflict, error) {
 	return m.UpsertIfNewerFunc(ctx, userID, secrets)
 }
-func (m *mockRepo) GetNewerSecrets(ctx context.Context, userID string, versions map[string]int64) ([]models.Secret, error) {
-	return m.GetNewerSecretsFunc(ctx, userID, versions)
+func (m *mockRepo) BulkUpsert(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, error) {
+	return m.BulkUpsertFunc(ctx, userID, secrets)
+}
+func (m *mockRepo) EachNewerSecret(ctx context.Context, userID string, versions map[string]int64, filter models.SyncFilter, fn func(models.Secret) error) error {
+	return m.EachNewerSecretFunc(ctx, userID, versions, filter, fn)
 }
 func (m *mockRepo) GetMaxVersion(ctx context.Context, userID string) (int64, error) {
 	return m.GetMaxVersionFunc(ctx, userID)
@@ -40,6 +69,40 @@ func (m *mockRepo) GetSecretsByUser(ctx context.Context, userID string) ([]model
 func (m *mockRepo) UpsertSecrets(ctx context.Context, userID string, secrets []models.Secret) error {
 	return m.UpsertSecretsFunc(ctx, userID, secrets)
 }
+func (m *mockRepo) GetTypeStats(ctx context.Context, userID string) (map[string]int64, map[string]int64, error) {
+	return m.GetTypeStatsFunc(ctx, userID)
+}
+func (m *mockRepo) GetVaultSummary(ctx context.Context, userID string) (models.VaultSummary, error) {
+	return m.GetVaultSummaryFunc(ctx, userID)
+}
+func (m *mockRepo) GetSecretHeaders(ctx context.Context, userID string) (map[string]int64, error) {
+	return m.GetSecretHeadersFunc(ctx, userID)
+}
+func (m *mockRepo) TouchDevice(ctx context.Context, userID, deviceID string, at int64) error {
+	return m.TouchDeviceFunc(ctx, userID, deviceID, at)
+}
+func (m *mockRepo) GetDevices(ctx context.Context, userID string) ([]models.Device, error) {
+	return m.GetDevicesFunc(ctx, userID)
+}
+func (m *mockRepo) RecordAccess(ctx context.Context, userID, deviceID string, ids []string, at int64) error {
+	return m.RecordAccessFunc(ctx, userID, deviceID, ids, at)
+}
+func (m *mockRepo) GetAccessLog(ctx context.Context, userID, secretID string, limit int) ([]models.SecretAccess, error) {
+	return m.GetAccessLogFunc(ctx, userID, secretID, limit)
+}
+func (m *mockRepo) GetKDF(ctx context.Context, userID string) (string, error) {
+	return m.GetKDFFunc(ctx, userID)
+}
+func (m *mockRepo) SetKDF(ctx context.Context, userID, kdf string) (string, error) {
+	return m.SetKDFFunc(ctx, userID, kdf)
+}
+func (m *mockRepo) GetRollback(ctx context.Context, userID string) (int64, int64, error) {
+	if m.GetRollbackFunc == nil {
+		// Never rolled back
+		return 0, 0, nil
+	}
+	return m.GetRollbackFunc(ctx, userID)
+}
 
 func TestSync_FullSync(t *testing.T) {
 	syncSecrets := []models.Secret{{ID: "s1", Type: "t", Data: "d", Comment: "c", Version: 2}}
@@ -47,18 +110,26 @@ func TestSync_FullSync(t *testing.T) {
 	updated := []models.Secret{{ID: "s1", Type: "t", Data: "d2", Comment: "c", Version: 2}}
 
 	repo := &mockRepo{
-		UpsertIfNewerFunc: func(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, error) {
-			return []string{"s1"}, nil, nil
+		UpsertIfNewerFunc: func(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, []models.Conflict, error) {
+			return []string{"s1"}, []string{"s2"}, []models.Conflict{{ID: "s2", Version: 1, ServerVersion: 2, ServerModified: 50}}, nil
 		},
-		GetNewerSecretsFunc: func(ctx context.Context, userID string, versions map[string]int64) ([]models.Secret, error) {
+		EachNewerSecretFunc: func(ctx context.Context, userID string, versions map[string]int64, filter models.SyncFilter, fn func(models.Secret) error) error {
 			if !reflect.DeepEqual(versions, clientVersions) {
-				t.Errorf("GetNewerSecrets versions = %+v; want %+v", versions, clientVersions)
+				t.Errorf("EachNewerSecret versions = %+v; want %+v", versions, clientVersions)
 			}
-			return updated, nil
+			for _, sec := range updated {
+				if err := fn(sec); err != nil {
+					return err
+				}
+			}
+			return nil
 		},
 		GetMaxVersionFunc: func(ctx context.Context, userID string) (int64, error) {
 			return 2, nil
 		},
+		GetVaultSummaryFunc: func(ctx context.Context, userID string) (models.VaultSummary, error) {
+			return models.VaultSummary{Types: map[string]int64{"t": 2}, TotalBytes: 20}, nil
+		},
 		GetSecretsByUserFunc: func(ctx context.Context, userID string) ([]models.Secret, error) {
 			return nil, nil
 		},
@@ -68,7 +139,7 @@ func TestSync_FullSync(t *testing.T) {
 	}
 	svc := service.NewSyncService(repo)
 
-	res, err := svc.Sync(context.Background(), "u1", syncSecrets, clientVersions)
+	res, err := svc.Sync(context.Background(), "u1", syncSecrets, clientVersions, 0, models.SyncFilter{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -79,6 +150,366 @@ func TestSync_FullSync(t *testing.T) {
 	if got, want := res["secrets"].([]models.Secret), updated; !reflect.DeepEqual(got, want) {
 		t.Errorf("secrets = %+v; want %+v", got, want)
 	}
+	if got := res["conflicts"].([]models.Conflict); len(got) != 1 || got[0].ServerVersion != 2 {
+		t.Errorf("conflicts = %+v; want the server version of s2", got)
+	}
+	if got := res["summary"].(models.VaultSummary); got.Types["t"] != 2 || got.TotalBytes != 20 {
+		t.Errorf("summary = %+v; want the repository's", got)
+	}
+}
+
+func TestSync_HoldsConcurrentEdits(t *testing.T) {
+	// The client last synced at version 10; s1 and s2 changed on both sides
+	// since, s2 to the same version, s3 only on the client
+	uploads := []models.Secret{
+		{ID: "s1", Type: "text", Data: "mine", Folder: "home", Version: 12},
+		{ID: "s2", Type: "text", Data: "same", Version: 13},
+		{ID: "s3", Type: "text", Data: "new", Version: 14},
+	}
+	server := models.Secret{ID: "s1", Type: "text", Data: "theirs", Folder: "work", Version: 11}
+	var stored []string
+	repo := &mockRepo{
+		GetSecretHeadersFunc: func(ctx context.Context, userID string) (map[string]int64, error) {
+			return map[string]int64{"s1": 11, "s2": 13, "s3": 9}, nil
+		},
+		GetSecretByIDFunc: func(ctx context.Context, userID, id string) (*models.Secret, error) {
+			if id != "s1" {
+				t.Errorf("GetSecretByID(%q); want only the concurrent edit", id)
+			}
+			sec := server
+			return &sec, nil
+		},
+		UpsertIfNewerFunc: func(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, []models.Conflict, error) {
+			for _, sec := range secrets {
+				stored = append(stored, sec.ID)
+			}
+			return []string{"s3"}, []string{"s2"}, nil, nil
+		},
+		EachNewerSecretFunc: func(ctx context.Context, userID string, versions map[string]int64, filter models.SyncFilter, fn func(models.Secret) error) error {
+			return nil
+		},
+		GetMaxVersionFunc: func(ctx context.Context, userID string) (int64, error) {
+			return 14, nil
+		},
+		GetVaultSummaryFunc: func(ctx context.Context, userID string) (models.VaultSummary, error) {
+			return models.VaultSummary{}, nil
+		},
+	}
+	svc := service.NewSyncService(repo)
+
+	res, err := svc.Sync(context.Background(), "u1", uploads, nil, 10, models.SyncFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(stored, []string{"s2", "s3"}) {
+		t.Errorf("uploads stored = %v; want s1 held back", stored)
+	}
+	if got := res["skipped"].([]string); !reflect.DeepEqual(got, []string{"s2", "s1"}) {
+		t.Errorf("skipped = %v; want s2 and s1", got)
+	}
+	conflicts := res["conflicts"].([]models.Conflict)
+	if len(conflicts) != 1 {
+		t.Fatalf("conflicts = %+v; want one for s1", conflicts)
+	}
+	c := conflicts[0]
+	if !c.Concurrent || c.Version != 12 || c.ServerVersion != 11 {
+		t.Errorf("conflict = %+v; want a concurrent one of versions 12 and 11", c)
+	}
+	if c.Client == nil || c.Client.Data != "mine" || c.Server == nil || c.Server.Data != "theirs" {
+		t.Errorf("conflict versions = %+v, %+v; want both payloads", c.Client, c.Server)
+	}
+	if !reflect.DeepEqual(c.Changed, []string{"folder"}) {
+		t.Errorf("changed = %v; want [folder]", c.Changed)
+	}
+
+	// Without the version of the last sync, the newer upload wins
+	stored = nil
+	if _, err := svc.Sync(context.Background(), "u1", uploads, nil, 0, models.SyncFilter{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stored) != 3 {
+		t.Errorf("uploads stored = %v; want all of them", stored)
+	}
+
+	// An edit of the server's current version, e.g. pushed to the client
+	// since its last sync, is no concurrent edit
+	stored = nil
+	edit := models.Secret{ID: "s1", Type: "text", Data: "mine", Version: 12, BaseVersion: 11}
+	if _, err := svc.Sync(context.Background(), "u1", []models.Secret{edit}, nil, 10, models.SyncFilter{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(stored, []string{"s1"}) {
+		t.Errorf("uploads stored = %v; want s1", stored)
+	}
+}
+
+func TestSync_HoldsRolledBackCopies(t *testing.T) {
+	// The vault was backed up at 100 and restored at 200: r1 was restored
+	// to 90 and r2 removed. The client's copies of r1 and r2 and its
+	// tombstone of r3 are from before the restore, live is newer than it
+	// and edited was changed by the client
+	uploads := []models.Secret{
+		{ID: "r1", Data: "lost", Version: 150, BaseVersion: 150},
+		{ID: "r2", Data: "lost", Version: 160, BaseVersion: 160},
+		{ID: "r3", Version: 170, BaseVersion: 170, Deleted: true},
+		{ID: "live", Data: "kept", Version: 250, BaseVersion: 250},
+		{ID: "edited", Data: "mine", Version: 180, BaseVersion: 120},
+	}
+	var stored, deleted []string
+	repo := &mockRepo{
+		GetRollbackFunc: func(ctx context.Context, userID string) (int64, int64, error) {
+			return 100, 200, nil
+		},
+		GetSecretHeadersFunc: func(ctx context.Context, userID string) (map[string]int64, error) {
+			return map[string]int64{"r1": 90, "r3": 80, "live": 250, "edited": 120}, nil
+		},
+		DeleteSecretsFunc: func(ctx context.Context, userID string, ids []string) error {
+			deleted = append(deleted, ids...)
+			return nil
+		},
+		UpsertIfNewerFunc: func(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, []models.Conflict, error) {
+			for _, sec := range secrets {
+				stored = append(stored, sec.ID)
+			}
+			return []string{"edited"}, []string{"live"}, nil, nil
+		},
+		EachNewerSecretFunc: func(ctx context.Context, userID string, versions map[string]int64, filter models.SyncFilter, fn func(models.Secret) error) error {
+			return nil
+		},
+		GetMaxVersionFunc: func(ctx context.Context, userID string) (int64, error) {
+			return 250, nil
+		},
+		GetVaultSummaryFunc: func(ctx context.Context, userID string) (models.VaultSummary, error) {
+			return models.VaultSummary{}, nil
+		},
+	}
+	svc := service.NewSyncService(repo)
+
+	res, err := svc.Sync(context.Background(), "u1", uploads, nil, 0, models.SyncFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("deleted = %v; want the restored r3 kept", deleted)
+	}
+	if !reflect.DeepEqual(stored, []string{"live", "edited"}) {
+		t.Errorf("uploads stored = %v; want the copies from before the restore held back", stored)
+	}
+	if got := res["restored"].([]string); !reflect.DeepEqual(got, []string{"r1", "r2", "r3"}) {
+		t.Errorf("restored = %v; want r1, r2 and r3", got)
+	}
+}
+
+func TestSyncStream_EmitError(t *testing.T) {
+	errWrite := errors.New("client gone")
+	maxVersionCalled := false
+	repo := &mockRepo{
+		EachNewerSecretFunc: func(ctx context.Context, userID string, versions map[string]int64, filter models.SyncFilter, fn func(models.Secret) error) error {
+			return fn(models.Secret{ID: "s1", Version: 1})
+		},
+		GetMaxVersionFunc: func(ctx context.Context, userID string) (int64, error) {
+			maxVersionCalled = true
+			return 1, nil
+		},
+		GetVaultSummaryFunc: func(ctx context.Context, userID string) (models.VaultSummary, error) {
+			return models.VaultSummary{}, nil
+		},
+	}
+	svc := service.NewSyncService(repo)
+
+	_, err := svc.SyncStream(context.Background(), "u1", nil, nil, 0, models.SyncFilter{}, func(models.Secret) error { return errWrite })
+	if !errors.Is(err, errWrite) {
+		t.Errorf("SyncStream error = %v; want %v", err, errWrite)
+	}
+	if maxVersionCalled {
+		t.Error("SyncStream continued after emit failed")
+	}
+}
+
+func TestUploadRespond(t *testing.T) {
+	var deleted []string
+	repo := &mockRepo{
+		DeleteSecretsFunc: func(ctx context.Context, userID string, ids []string) error {
+			deleted = append(deleted, ids...)
+			return nil
+		},
+		UpsertIfNewerFunc: func(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, []models.Conflict, error) {
+			if secrets[0].ID == "old" {
+				return nil, []string{"old"}, []models.Conflict{{ID: "old", Version: 1, ServerVersion: 4}}, nil
+			}
+			return []string{secrets[0].ID}, nil, nil, nil
+		},
+		EachNewerSecretFunc: func(ctx context.Context, userID string, versions map[string]int64, filter models.SyncFilter, fn func(models.Secret) error) error {
+			return nil
+		},
+		GetMaxVersionFunc: func(ctx context.Context, userID string) (int64, error) {
+			return 4, nil
+		},
+		GetVaultSummaryFunc: func(ctx context.Context, userID string) (models.VaultSummary, error) {
+			return models.VaultSummary{}, nil
+		},
+	}
+	svc := service.NewSyncService(repo)
+	ctx := context.Background()
+
+	// The outcome of the batches adds up
+	var up models.UploadResult
+	batches := [][]models.Secret{
+		{{ID: "new", Version: 2}, {ID: "gone", Version: 3, Deleted: true}},
+		{{ID: "old", Version: 1}},
+	}
+	for _, batch := range batches {
+		if err := svc.Upload(ctx, "u1", batch, 0, &up); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := models.UploadResult{
+		Updated:   []string{"new"},
+		Skipped:   []string{"old"},
+		Conflicts: []models.Conflict{{ID: "old", Version: 1, ServerVersion: 4}},
+		Deleted:   []string{"gone"},
+	}
+	if !reflect.DeepEqual(up, want) || !reflect.DeepEqual(deleted, []string{"gone"}) {
+		t.Errorf("Upload = %+v, deleted %v; want %+v", up, deleted, want)
+	}
+
+	res, err := svc.Respond(ctx, "u1", up, nil, models.SyncFilter{}, func(models.Secret) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res["updated"], want.Updated) || !reflect.DeepEqual(res["skipped"], want.Skipped) || !reflect.DeepEqual(res["conflicts"], want.Conflicts) {
+		t.Errorf("Respond = %v; want the outcome of the uploads", res)
+	}
+
+	// Without uploads, conflicts are still reported
+	res, err = svc.Respond(ctx, "u1", models.UploadResult{}, nil, models.SyncFilter{}, func(models.Secret) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := res["conflicts"].([]models.Conflict); !ok || c == nil {
+		t.Errorf("conflicts = %#v; want an empty list", res["conflicts"])
+	}
+}
+
+// memCache is an in-memory service.SyncCache.
+type memCache map[string]map[string]int64
+
+func (m memCache) Headers(ctx context.Context, userID string) (map[string]int64, bool, error) {
+	h, ok := m[userID]
+	return h, ok, nil
+}
+
+func (m memCache) SetHeaders(ctx context.Context, userID string, headers map[string]int64) error {
+	m[userID] = headers
+	return nil
+}
+
+func (m memCache) Invalidate(ctx context.Context, userID string) error {
+	delete(m, userID)
+	return nil
+}
+
+func TestSyncStream_Cache(t *testing.T) {
+	headerLoads, fullSyncs := 0, 0
+	repo := &mockRepo{
+		GetSecretHeadersFunc: func(ctx context.Context, userID string) (map[string]int64, error) {
+			headerLoads++
+			return map[string]int64{"s1": 3, "s2": 5}, nil
+		},
+		EachNewerSecretFunc: func(ctx context.Context, userID string, versions map[string]int64, filter models.SyncFilter, fn func(models.Secret) error) error {
+			fullSyncs++
+			return nil
+		},
+		GetMaxVersionFunc: func(ctx context.Context, userID string) (int64, error) {
+			return 6, nil
+		},
+		GetVaultSummaryFunc: func(ctx context.Context, userID string) (models.VaultSummary, error) {
+			return models.VaultSummary{}, nil
+		},
+		UpsertIfNewerFunc: func(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, []models.Conflict, error) {
+			return []string{"s3"}, nil, nil, nil
+		},
+	}
+	cache := memCache{}
+	svc := service.NewSyncService(repo)
+	svc.SetCache(cache)
+	ctx := context.Background()
+	upToDate := map[string]int64{"s1": 3, "s2": 5}
+
+	// Up-to-date clients are answered from cache after the first poll
+	for range 3 {
+		res, err := svc.SyncStream(ctx, "u1", nil, upToDate, 0, models.SyncFilter{}, func(models.Secret) error { return nil })
+		if err != nil || res["version"] != int64(5) {
+			t.Fatalf("SyncStream = %v, %v; want version 5", res, err)
+		}
+	}
+	if headerLoads != 1 || fullSyncs != 0 {
+		t.Errorf("header loads = %d, full syncs = %d; want 1 and 0", headerLoads, fullSyncs)
+	}
+
+	// Outdated clients get a full sync
+	if _, err := svc.SyncStream(ctx, "u1", nil, map[string]int64{"s1": 3}, 0, models.SyncFilter{}, func(models.Secret) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if fullSyncs != 1 {
+		t.Errorf("full syncs = %d; want 1", fullSyncs)
+	}
+
+	// Uploads invalidate the cache
+	if _, err := svc.SyncStream(ctx, "u1", []models.Secret{{ID: "s3", Version: 6}}, upToDate, 0, models.SyncFilter{}, func(models.Secret) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache["u1"]; ok {
+		t.Error("cache entry survived an upload")
+	}
+
+	// Filtered syncs are not answered from the headers of the whole vault
+	work := models.SyncFilter{Folders: []string{"work"}}
+	var gotFilter models.SyncFilter
+	repo.EachNewerSecretFunc = func(ctx context.Context, userID string, versions map[string]int64, filter models.SyncFilter, fn func(models.Secret) error) error {
+		gotFilter = filter
+		return nil
+	}
+	if _, err := svc.SyncStream(ctx, "u1", nil, upToDate, 0, work, func(models.Secret) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotFilter, work) {
+		t.Errorf("repository filter = %+v; want %+v", gotFilter, work)
+	}
+}
+
+func TestETag(t *testing.T) {
+	headers := map[string]int64{"s1": 3, "s2": 5}
+	repo := &mockRepo{
+		GetSecretHeadersFunc: func(ctx context.Context, userID string) (map[string]int64, error) {
+			return headers, nil
+		},
+	}
+	svc := service.NewSyncService(repo)
+	ctx := context.Background()
+
+	etag, err := svc.ETag(ctx, "u1", models.SyncFilter{})
+	if err != nil {
+		t.Fatalf("ETag error: %v", err)
+	}
+	if !strings.HasPrefix(etag, `"5-`) || !strings.HasSuffix(etag, `"`) {
+		t.Errorf("ETag = %s; want the highest version 5 quoted", etag)
+	}
+	if again, _ := svc.ETag(ctx, "u1", models.SyncFilter{}); again != etag {
+		t.Errorf("ETag changed without changes: %s, %s", etag, again)
+	}
+
+	// A deletion changes the tag even though the highest version stays
+	headers = map[string]int64{"s2": 5}
+	if deleted, _ := svc.ETag(ctx, "u1", models.SyncFilter{}); deleted == etag {
+		t.Errorf("ETag = %s after a deletion; want a new tag", deleted)
+	}
+
+	// So does subscribing to part of the vault
+	plain, _ := svc.ETag(ctx, "u1", models.SyncFilter{})
+	if filtered, _ := svc.ETag(ctx, "u1", models.SyncFilter{Tags: []string{"work"}}); filtered == plain {
+		t.Errorf("ETag = %s with a filter; want a new tag", filtered)
+	}
 }
 
 func TestDelete(t *testing.T) {
@@ -108,6 +539,96 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestPurge(t *testing.T) {
+	repo := &mockRepo{
+		PurgeSecretsFunc: func(ctx context.Context, userID string, ids []string) ([]string, error) {
+			if userID != "u42" || !reflect.DeepEqual(ids, []string{"a", "b"}) {
+				t.Errorf("PurgeSecrets(%q, %v); want u42, [a b]", userID, ids)
+			}
+			return []string{"a"}, nil
+		},
+	}
+	svc := service.NewSyncService(repo)
+
+	purged, err := svc.Purge(context.Background(), "u42", []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Purge error: %v", err)
+	}
+	if !reflect.DeepEqual(purged, []string{"a"}) {
+		t.Errorf("purged = %v; want [a]", purged)
+	}
+
+	// Nothing to purge does not reach the repository
+	if purged, err := svc.Purge(context.Background(), "u42", nil); err != nil || purged != nil {
+		t.Errorf("Purge(nil) = %v, %v; want nil, nil", purged, err)
+	}
+}
+
+func TestTombstones(t *testing.T) {
+	repo := &mockRepo{
+		GetDeletedFunc: func(ctx context.Context, userID string) ([]models.Secret, error) {
+			return []models.Secret{
+				{ID: "a", Version: 3, Deleted: true},
+				{ID: "b", Version: 3, Deleted: true},
+				{ID: "c", Version: 3, Deleted: true},
+			}, nil
+		},
+	}
+	svc := service.NewSyncService(repo)
+
+	all, err := svc.Tombstones(context.Background(), "u1", nil)
+	if err != nil || len(all) != 3 {
+		t.Fatalf("Tombstones(nil) = %v, %v; want all 3", all, err)
+	}
+
+	// Only the secrets the client holds, and has not edited since
+	held, err := svc.Tombstones(context.Background(), "u1", map[string]int64{"a": 2, "b": 4})
+	if err != nil {
+		t.Fatalf("Tombstones error: %v", err)
+	}
+	if want := []models.Secret{{ID: "a", Version: 3, Deleted: true}}; !reflect.DeepEqual(held, want) {
+		t.Errorf("tombstones = %+v; want %+v", held, want)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	repo := &mockRepo{
+		GetSecretByIDFunc: func(ctx context.Context, userID, id string) (*models.Secret, error) {
+			switch id {
+			case "a":
+				return &models.Secret{ID: "a", Type: "text", Version: 4}, nil
+			case "b":
+				return &models.Secret{ID: "b", Type: "card", Version: 5}, nil
+			}
+			return nil, sql.ErrNoRows
+		},
+		GetDeletedFunc: func(ctx context.Context, userID string) ([]models.Secret, error) {
+			return []models.Secret{
+				{ID: "c", Version: 3, Deleted: true},
+				{ID: "x", Version: 3, Deleted: true},
+			}, nil
+		},
+	}
+	svc := service.NewSyncService(repo)
+
+	var got []models.Secret
+	err := svc.Changes(context.Background(), "u1", []string{"a", "b", "c", "purged"}, models.SyncFilter{Types: []string{"text"}}, func(sec models.Secret) error {
+		got = append(got, sec)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Changes error: %v", err)
+	}
+	// b is outside the filter, and tombstones of other secrets are not sent
+	want := []models.Secret{
+		{ID: "a", Type: "text", Version: 4},
+		{ID: "c", Version: 3, Deleted: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %+v; want %+v", got, want)
+	}
+}
+
 func TestGetByID(t *testing.T) {
 	want := &models.Secret{ID: "xx", Type: "tt", Data: "dd", Comment: "cc", Version: 5}
 	repo := &mockRepo{
@@ -130,3 +651,176 @@ func TestGetByID(t *testing.T) {
 		t.Fatalf("GetByID returned %p; want %p", got, want)
 	}
 }
+
+func TestRecordSync(t *testing.T) {
+	before := time.Now().Unix()
+	repo := &mockRepo{
+		TouchDeviceFunc: func(ctx context.Context, userID, deviceID string, at int64) error {
+			if userID != "u1" || deviceID != "dev1" {
+				t.Errorf("TouchDevice args = %q, %q; want u1, dev1", userID, deviceID)
+			}
+			if at < before {
+				t.Errorf("TouchDevice at = %d; want >= %d", at, before)
+			}
+			return nil
+		},
+	}
+	svc := service.NewSyncService(repo)
+	if err := svc.RecordSync(context.Background(), "u1", "dev1"); err != nil {
+		t.Fatalf("RecordSync error: %v", err)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var recorded []string
+	repo := &mockRepo{
+		RecordAccessFunc: func(ctx context.Context, userID, deviceID string, ids []string, at int64) error {
+			if userID != "u1" || deviceID != "dev1" {
+				t.Errorf("RecordAccess args = %q, %q; want u1, dev1", userID, deviceID)
+			}
+			recorded = append(recorded, ids...)
+			return nil
+		},
+		GetAccessLogFunc: func(ctx context.Context, userID, secretID string, limit int) ([]models.SecretAccess, error) {
+			if userID != "u1" || secretID != "s1" || limit != service.AccessLogLimit {
+				t.Errorf("GetAccessLog args = %q, %q, %d", userID, secretID, limit)
+			}
+			return []models.SecretAccess{{DeviceID: "dev1", Time: 10}}, nil
+		},
+	}
+	svc := service.NewSyncService(repo)
+
+	// Syncs that send nothing record nothing
+	if err := svc.RecordAccess(context.Background(), "u1", "dev1", nil); err != nil {
+		t.Fatalf("RecordAccess error: %v", err)
+	}
+	if err := svc.RecordAccess(context.Background(), "u1", "dev1", []string{"s1", "s2"}); err != nil {
+		t.Fatalf("RecordAccess error: %v", err)
+	}
+	if want := []string{"s1", "s2"}; !reflect.DeepEqual(recorded, want) {
+		t.Errorf("recorded = %v; want %v", recorded, want)
+	}
+
+	log, err := svc.AccessLog(context.Background(), "u1", "s1")
+	if err != nil || len(log) != 1 || log[0].DeviceID != "dev1" {
+		t.Errorf("AccessLog = %+v, %v", log, err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	repo := &mockRepo{
+		GetTypeStatsFunc: func(ctx context.Context, userID string) (map[string]int64, map[string]int64, error) {
+			return map[string]int64{"text": 2, "card": 1}, map[string]int64{"text": 100, "card": 40}, nil
+		},
+		GetDevicesFunc: func(ctx context.Context, userID string) ([]models.Device, error) {
+			return []models.Device{{ID: "a", LastSync: 30, LastSeen: 35}, {ID: "b", LastSync: 10, LastSeen: 50}}, nil
+		},
+		GetSecretHeadersFunc: func(ctx context.Context, userID string) (map[string]int64, error) {
+			return map[string]int64{"s1": 3, "s2": 1, "s3": 2}, nil
+		},
+	}
+	svc := service.NewSyncService(repo)
+
+	stats, err := svc.Stats(context.Background(), "u1")
+	if err != nil {
+		t.Fatalf("Stats error: %v", err)
+	}
+	if stats.TotalBytes != 140 {
+		t.Errorf("TotalBytes = %d; want 140", stats.TotalBytes)
+	}
+	if stats.LastSync != 30 {
+		t.Errorf("LastSync = %d; want 30", stats.LastSync)
+	}
+	if stats.LastSeen != 50 {
+		t.Errorf("LastSeen = %d; want 50", stats.LastSeen)
+	}
+	if stats.Counts["text"] != 2 || len(stats.Devices) != 2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if want := fingerprint.Versions(map[string]int64{"s1": 3, "s2": 1, "s3": 2}); stats.Fingerprint != want {
+		t.Errorf("Fingerprint = %q; want %q", stats.Fingerprint, want)
+	}
+}
+
+func TestImport_Batches(t *testing.T) {
+	var batches []int
+	repo := &mockRepo{
+		BulkUpsertFunc: func(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, error) {
+			batches = append(batches, len(secrets))
+			// The first secret of each batch is held at a newer version
+			stored := make([]string, 0, len(secrets))
+			for _, sec := range secrets[1:] {
+				stored = append(stored, sec.ID)
+			}
+			return stored, []string{secrets[0].ID}, nil
+		},
+		GetMaxVersionFunc: func(ctx context.Context, userID string) (int64, error) { return 42, nil },
+	}
+	svc := service.NewSyncService(repo)
+
+	n := 0
+	res, err := svc.Import(context.Background(), "alice", func() (models.Secret, error) {
+		if n == 2*service.ImportBatchSize+10 {
+			return models.Secret{}, io.EOF
+		}
+		n++
+		return models.Secret{ID: strconv.Itoa(n), Version: 1}, nil
+	})
+	if err != nil {
+		t.Fatalf("Import returned error: %v", err)
+	}
+	if !reflect.DeepEqual(batches, []int{service.ImportBatchSize, service.ImportBatchSize, 10}) {
+		t.Errorf("batches = %v; want two full batches and the rest", batches)
+	}
+	want := models.ImportResult{Imported: n - 3, Skipped: 3, Version: 42}
+	if res != want {
+		t.Errorf("result = %+v; want %+v", res, want)
+	}
+}
+
+func TestImport_ReadErrorKeepsStoredBatches(t *testing.T) {
+	repo := &mockRepo{
+		BulkUpsertFunc: func(ctx context.Context, userID string, secrets []models.Secret) ([]string, []string, error) {
+			return make([]string, len(secrets)), nil, nil
+		},
+	}
+	svc := service.NewSyncService(repo)
+
+	errRead := errors.New("bad line")
+	n := 0
+	res, err := svc.Import(context.Background(), "alice", func() (models.Secret, error) {
+		if n == service.ImportBatchSize+1 {
+			return models.Secret{}, errRead
+		}
+		n++
+		return models.Secret{ID: strconv.Itoa(n), Version: 1}, nil
+	})
+	if !errors.Is(err, errRead) || res.Imported != service.ImportBatchSize {
+		t.Errorf("Import = %+v, %v; want the first batch imported and the read error", res, err)
+	}
+}
+
+func TestVaultKDF(t *testing.T) {
+	var calls []string
+	repo := &mockRepo{
+		GetKDFFunc: func(ctx context.Context, userID string) (string, error) {
+			calls = append(calls, "get")
+			return `{"salt":"first"}`, nil
+		},
+		SetKDFFunc: func(ctx context.Context, userID, kdf string) (string, error) {
+			calls = append(calls, "set "+kdf)
+			return `{"salt":"first"}`, nil
+		},
+	}
+	svc := service.NewSyncService(repo)
+
+	for _, sent := range []string{"", `{"salt":"second"}`} {
+		kdf, err := svc.VaultKDF(context.Background(), "u1", sent)
+		if err != nil || kdf != `{"salt":"first"}` {
+			t.Errorf("VaultKDF(%q) = %q, %v; want the stored parameters", sent, kdf, err)
+		}
+	}
+	if want := []string{"get", `set {"salt":"second"}`}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("repository calls = %q; want %q", calls, want)
+	}
+}
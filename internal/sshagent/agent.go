@@ -0,0 +1,151 @@
+// Package sshagent implements the server side of the ssh-agent protocol
+// (draft-miller-ssh-agent), so that SSH keys stored in the vault can be
+// used by ssh without being written to disk. The agent is read-only: keys
+// are supplied by the vault and cannot be added or removed by clients.
+package sshagent
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// Message numbers of the agent protocol.
+const (
+	msgFailure           = 5
+	msgRequestIdentities = 11
+	msgIdentitiesAnswer  = 12
+	msgSignRequest       = 13
+	msgSignResponse      = 14
+)
+
+// maxMessageSize bounds the messages accepted from clients.
+const maxMessageSize = 256 << 10
+
+// Key is an identity offered by the agent.
+type Key struct {
+	Signer  crypto.Signer
+	Comment string
+}
+
+// Agent answers agent protocol requests with a fixed set of keys.
+type Agent struct {
+	keys  []Key
+	blobs [][]byte // public keys of keys in the wire format
+	// OnSign, if set, is called after a successful signature with the
+	// index of the key used.
+	OnSign func(i int)
+}
+
+// New returns an agent offering keys.
+func New(keys []Key) (*Agent, error) {
+	a := &Agent{keys: keys}
+	for _, k := range keys {
+		blob, err := PublicKey(k.Signer)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Comment, err)
+		}
+		a.blobs = append(a.blobs, blob)
+	}
+	return a, nil
+}
+
+// Serve accepts connections on l and serves each in its own goroutine
+// until ctx is done. It closes l and waits for open connections.
+func (a *Agent) Serve(ctx context.Context, l net.Listener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			_ = a.ServeConn(conn)
+		}()
+	}
+}
+
+// ServeConn answers requests read from rw until the client disconnects.
+func (a *Agent) ServeConn(rw io.ReadWriter) error {
+	var hdr [4]byte
+	for {
+		if _, err := io.ReadFull(rw, hdr[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		n := binary.BigEndian.Uint32(hdr[:])
+		if n == 0 || n > maxMessageSize {
+			return fmt.Errorf("sshagent: invalid message length %d", n)
+		}
+		req := make([]byte, n)
+		if _, err := io.ReadFull(rw, req); err != nil {
+			return err
+		}
+		var w writer
+		w.uint32(0) // length, set below
+		w.buf = append(w.buf, a.handle(req)...)
+		binary.BigEndian.PutUint32(w.buf, uint32(len(w.buf)-4))
+		if _, err := rw.Write(w.buf); err != nil {
+			return err
+		}
+	}
+}
+
+// handle returns the response to one request. Unsupported requests, such
+// as adding or removing keys, fail.
+func (a *Agent) handle(req []byte) []byte {
+	var w writer
+	switch req[0] {
+	case msgRequestIdentities:
+		w.byte(msgIdentitiesAnswer)
+		w.uint32(uint32(len(a.keys)))
+		for i, k := range a.keys {
+			w.bytes(a.blobs[i])
+			w.string(k.Comment)
+		}
+	case msgSignRequest:
+		r := &reader{buf: req[1:]}
+		blob, data, flags := r.bytes(), r.bytes(), r.uint32()
+		if r.err != nil {
+			return []byte{msgFailure}
+		}
+		for i, k := range a.keys {
+			if !bytes.Equal(a.blobs[i], blob) {
+				continue
+			}
+			sig, err := sign(k.Signer, data, flags)
+			if err != nil {
+				return []byte{msgFailure}
+			}
+			if a.OnSign != nil {
+				a.OnSign(i)
+			}
+			w.byte(msgSignResponse)
+			w.bytes(sig)
+			return w.buf
+		}
+		return []byte{msgFailure}
+	default:
+		return []byte{msgFailure}
+	}
+	return w.buf
+}
@@ -0,0 +1,265 @@
+package sshagent
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/atinyakov/GophKeeper/internal/pkcs8"
+)
+
+// ErrEncryptedKey is returned for passphrase-protected OpenSSH keys, whose
+// bcrypt KDF is not supported. Such keys can be converted to encrypted
+// PKCS#8 with "ssh-keygen -p -m PKCS8".
+var ErrEncryptedKey = errors.New("sshagent: encrypted OpenSSH keys are not supported, convert the key with ssh-keygen -p -m PKCS8")
+
+// opensshMagic starts the payload of OpenSSH private keys.
+const opensshMagic = "openssh-key-v1\x00"
+
+// ParsePrivateKey parses a PEM-encoded private key in OpenSSH, PKCS#1,
+// SEC 1 or PKCS#8 format. Encrypted PKCS#8 keys are decrypted with
+// passphrase. RSA, ECDSA (P-256, P-384, P-521) and Ed25519 keys are
+// supported.
+func ParsePrivateKey(pemBytes, passphrase []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("sshagent: no PEM block found")
+	}
+	var (
+		key any
+		err error
+	)
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		key, err = parseOpenSSH(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		key, err = pkcs8.Decrypt(block, passphrase)
+	default:
+		return nil, fmt.Errorf("sshagent: unsupported key type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		return k.(crypto.Signer), nil
+	case ed25519.PrivateKey:
+		return k, nil
+	case *ed25519.PrivateKey:
+		return *k, nil
+	}
+	return nil, fmt.Errorf("sshagent: unsupported key %T", key)
+}
+
+// parseOpenSSH parses the payload of an unencrypted OpenSSH private key,
+// see PROTOCOL.key in the OpenSSH sources.
+func parseOpenSSH(data []byte) (any, error) {
+	if !bytes.HasPrefix(data, []byte(opensshMagic)) {
+		return nil, errors.New("sshagent: invalid OpenSSH key")
+	}
+	r := &reader{buf: data[len(opensshMagic):]}
+	cipher, kdf := r.string(), r.string()
+	r.bytes() // KDF options
+	n := r.uint32()
+	r.bytes() // public key
+	priv := &reader{buf: r.bytes()}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if cipher != "none" || kdf != "none" {
+		return nil, ErrEncryptedKey
+	}
+	if n != 1 {
+		return nil, fmt.Errorf("sshagent: %d keys in one file are not supported", n)
+	}
+	if priv.uint32() != priv.uint32() {
+		return nil, errors.New("sshagent: corrupt OpenSSH key")
+	}
+
+	var key any
+	switch typ := priv.string(); typ {
+	case "ssh-ed25519":
+		priv.bytes() // public key, repeated in the private key
+		k := priv.bytes()
+		if priv.err == nil && len(k) != ed25519.PrivateKeySize {
+			return nil, errors.New("sshagent: invalid Ed25519 key")
+		}
+		key = ed25519.PrivateKey(k)
+	case "ssh-rsa":
+		n, e, d, _, p, q := priv.mpint(), priv.mpint(), priv.mpint(), priv.mpint(), priv.mpint(), priv.mpint()
+		if priv.err != nil {
+			break
+		}
+		k := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: n, E: int(e.Int64())},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		if err := k.Validate(); err != nil {
+			return nil, err
+		}
+		k.Precompute()
+		key = k
+	case "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521":
+		curve := curves[priv.string()]
+		point, d := priv.bytes(), priv.mpint()
+		if priv.err != nil {
+			break
+		}
+		if curve == nil {
+			return nil, errors.New("sshagent: invalid ECDSA curve")
+		}
+		x, y := elliptic.Unmarshal(curve, point)
+		if x == nil {
+			return nil, errors.New("sshagent: invalid ECDSA key")
+		}
+		k := &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y}, D: d}
+		if cx, cy := curve.ScalarBaseMult(d.Bytes()); cx.Cmp(x) != 0 || cy.Cmp(y) != 0 {
+			return nil, errors.New("sshagent: ECDSA key does not match its public key")
+		}
+		key = k
+	default:
+		return nil, fmt.Errorf("sshagent: unsupported key type %q", typ)
+	}
+	if priv.err != nil {
+		return nil, priv.err
+	}
+	return key, nil
+}
+
+// curves maps SSH curve names to curves.
+var curves = map[string]elliptic.Curve{
+	"nistp256": elliptic.P256(),
+	"nistp384": elliptic.P384(),
+	"nistp521": elliptic.P521(),
+}
+
+// curveName returns the SSH name of curve.
+func curveName(curve elliptic.Curve) string {
+	for name, c := range curves {
+		if c == curve {
+			return name
+		}
+	}
+	return ""
+}
+
+// PublicKey returns the public key of signer in the SSH wire format.
+func PublicKey(signer crypto.Signer) ([]byte, error) {
+	var w writer
+	switch pub := signer.Public().(type) {
+	case ed25519.PublicKey:
+		w.string("ssh-ed25519")
+		w.bytes(pub)
+	case *rsa.PublicKey:
+		w.string("ssh-rsa")
+		w.mpint(big.NewInt(int64(pub.E)))
+		w.mpint(pub.N)
+	case *ecdsa.PublicKey:
+		name := curveName(pub.Curve)
+		if name == "" {
+			return nil, errors.New("sshagent: unsupported ECDSA curve")
+		}
+		w.string("ecdsa-sha2-" + name)
+		w.string(name)
+		w.bytes(elliptic.Marshal(pub.Curve, pub.X, pub.Y))
+	default:
+		return nil, fmt.Errorf("sshagent: unsupported key %T", pub)
+	}
+	return w.buf, nil
+}
+
+// Signature flags of SSH2_AGENTC_SIGN_REQUEST for RSA keys.
+const (
+	flagRSASHA256 = 2
+	flagRSASHA512 = 4
+)
+
+// sign signs data with signer and returns the signature in the SSH wire
+// format. For RSA keys flags select the hash algorithm.
+func sign(signer crypto.Signer, data []byte, flags uint32) ([]byte, error) {
+	var w writer
+	switch pub := signer.Public().(type) {
+	case ed25519.PublicKey:
+		sig, err := signer.Sign(rand.Reader, data, crypto.Hash(0))
+		if err != nil {
+			return nil, err
+		}
+		w.string("ssh-ed25519")
+		w.bytes(sig)
+	case *rsa.PublicKey:
+		algo, hash := "ssh-rsa", crypto.SHA1
+		switch {
+		case flags&flagRSASHA512 != 0:
+			algo, hash = "rsa-sha2-512", crypto.SHA512
+		case flags&flagRSASHA256 != 0:
+			algo, hash = "rsa-sha2-256", crypto.SHA256
+		}
+		sig, err := signer.Sign(rand.Reader, digest(hash, data), hash)
+		if err != nil {
+			return nil, err
+		}
+		w.string(algo)
+		w.bytes(sig)
+	case *ecdsa.PublicKey:
+		hash := crypto.SHA256
+		switch pub.Curve.Params().BitSize {
+		case 384:
+			hash = crypto.SHA384
+		case 521:
+			hash = crypto.SHA512
+		}
+		der, err := signer.Sign(rand.Reader, digest(hash, data), hash)
+		if err != nil {
+			return nil, err
+		}
+		var sig struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(der, &sig); err != nil {
+			return nil, err
+		}
+		var blob writer
+		blob.mpint(sig.R)
+		blob.mpint(sig.S)
+		w.string("ecdsa-sha2-" + curveName(pub.Curve))
+		w.bytes(blob.buf)
+	default:
+		return nil, fmt.Errorf("sshagent: unsupported key %T", pub)
+	}
+	return w.buf, nil
+}
+
+// digest returns the hash of data.
+func digest(hash crypto.Hash, data []byte) []byte {
+	switch hash {
+	case crypto.SHA1:
+		sum := sha1.Sum(data)
+		return sum[:]
+	case crypto.SHA256:
+		sum := sha256.Sum256(data)
+		return sum[:]
+	case crypto.SHA384:
+		sum := sha512.Sum384(data)
+		return sum[:]
+	}
+	sum := sha512.Sum512(data)
+	return sum[:]
+}